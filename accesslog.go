@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accessLogLookupTimeout bounds resolving the country of a request the
+// blocking middleware did not locate
+const accessLogLookupTimeout = 2 * time.Second
+
+// Access log formats
+const (
+	accessLogJSON     = "json"
+	accessLogCombined = "combined"
+)
+
+// AccessLogEntry is one request in the access log
+type AccessLogEntry struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"request_id,omitempty"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	ClientIP   string  `json:"client_ip"`
+	Country    string  `json:"country,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	Referer    string  `json:"referer,omitempty"`
+
+	// start is when the request arrived, for the combined format
+	start time.Time
+}
+
+type accessLogContextKey struct{}
+
+// setAccessLogCountry records the country the blocking middleware resolved
+// for a request, so the access log does not look it up again
+func setAccessLogCountry(ctx context.Context, country string) {
+	if entry, ok := ctx.Value(accessLogContextKey{}).(*AccessLogEntry); ok {
+		entry.Country = country
+	}
+}
+
+// accessLogWriter records the status and size of a response
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush the event stream
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLogger writes one line per request, as JSON or in the Apache
+// combined format
+type AccessLogger struct {
+	format string
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewAccessLogger writes to out in the json or combined format
+func NewAccessLogger(out io.Writer, format string) *AccessLogger {
+	return &AccessLogger{out: out, format: format}
+}
+
+// newAccessLogger sets up ACCESS_LOG, "stdout" or a file path rotated by
+// size, in ACCESS_LOG_FORMAT. It returns nil when the access log is off.
+func newAccessLogger() *AccessLogger {
+	target := getEnv("ACCESS_LOG", "")
+	format := getEnv("ACCESS_LOG_FORMAT", accessLogJSON)
+	if format != accessLogJSON && format != accessLogCombined {
+		fmt.Printf("⚠️  Unknown ACCESS_LOG_FORMAT %q, using json\n", format)
+		format = accessLogJSON
+	}
+
+	var out io.Writer
+	switch target {
+	case "":
+		return nil
+	case "stdout":
+		// Stdout is already masked by LOG_REDACT
+		out = os.Stdout
+	default:
+		file, err := NewRotatingFile(target, int64(getEnvInt("ACCESS_LOG_MAX_SIZE_MB", 100))<<20, getEnvInt("ACCESS_LOG_MAX_BACKUPS", 5))
+		if err != nil {
+			fmt.Printf("⚠️  Access log disabled: %v\n", err)
+			return nil
+		}
+		out = file
+		if logRedactor.Enabled() {
+			out = &redactingWriter{out: file, redactor: logRedactor}
+		}
+	}
+	fmt.Printf("📝 Access log (%s) to %s\n", format, target)
+	return NewAccessLogger(out, format)
+}
+
+// Middleware logs every request once its response is complete, including
+// requests that panic. A nil logger logs nothing.
+func (l *AccessLogger) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &AccessLogEntry{start: time.Now()}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogContextKey{}, entry))
+		recorder := &accessLogWriter{ResponseWriter: w}
+
+		defer func() {
+			err := recover()
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+				if err != nil {
+					recorder.status = http.StatusInternalServerError
+				}
+			}
+			l.log(r, entry, recorder)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// log completes an entry and writes it
+func (l *AccessLogger) log(r *http.Request, entry *AccessLogEntry, recorder *accessLogWriter) {
+	entry.Time = entry.start.Format(time.RFC3339)
+	entry.DurationMs = float64(time.Since(entry.start).Microseconds()) / 1000
+	entry.RequestID = requestIDFromContext(r.Context())
+	entry.Method = r.Method
+	entry.Path = r.URL.Path
+	entry.Proto = r.Proto
+	entry.Status = recorder.status
+	entry.Bytes = recorder.bytes
+	entry.ClientIP = getRealIP(r)
+	entry.UserAgent = r.UserAgent()
+	entry.Referer = r.Referer()
+	if entry.Country == "" && !isPrivateIP(entry.ClientIP) {
+		ctx, cancel := context.WithTimeout(context.Background(), accessLogLookupTimeout)
+		entry.Country, _ = geoResolver.Lookup(ctx, entry.ClientIP)
+		cancel()
+	}
+
+	line := l.line(entry)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// line renders an entry in the logger's format, newline terminated
+func (l *AccessLogger) line(entry *AccessLogEntry) []byte {
+	if l.format == accessLogCombined {
+		return []byte(combinedLogLine(entry))
+	}
+	line, _ := json.Marshal(entry)
+	return append(line, '\n')
+}
+
+// combinedLogLine renders an entry in the Apache combined format, followed
+// by the response time in seconds and the country
+func combinedLogLine(entry *AccessLogEntry) string {
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+	country := entry.Country
+	if country == "" {
+		country = "-"
+	}
+	return fmt.Sprintf("%s - - [%s] %q %d %s %q %q rt=%.3f country=%s\n",
+		entry.ClientIP, entry.start.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method+" "+entry.Path+" "+entry.Proto, entry.Status, size,
+		orDash(entry.Referer), orDash(entry.UserAgent), entry.DurationMs/1000, country)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// RotatingFile appends to a file and rotates it once it reaches maxSize
+// bytes: path becomes path.1, path.1 becomes path.2 and so on, keeping at
+// most maxBackups old files. A maxSize of 0 never rotates.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens path for appending, creating it if needed
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups up by one, dropping the oldest, and starts a new
+// file
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxBackups <= 0 {
+		os.Remove(f.path)
+	} else {
+		os.Remove(f.backup(f.maxBackups))
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			os.Rename(f.backup(i), f.backup(i+1))
+		}
+		if err := os.Rename(f.path, f.backup(1)); err != nil {
+			return err
+		}
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) backup(n int) string {
+	return f.path + "." + strconv.Itoa(n)
+}
+
+// Close closes the current file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
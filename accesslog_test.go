@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setAccessLogCountry(r.Context(), "DE")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	var out bytes.Buffer
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ip-info?ip=1.2.3.4", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	NewAccessLogger(&out, accessLogJSON).Middleware(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry AccessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("access log line %q is not JSON: %v", out.String(), err)
+	}
+	if entry.Method != "GET" || entry.Path != "/api/v1/ip-info" || entry.Status != http.StatusTeapot || entry.Bytes != 15 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.Country != "DE" || entry.ClientIP != "192.0.2.1" || entry.UserAgent != "test-agent" {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	out.Reset()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/reload", nil)
+	req.RemoteAddr = "127.0.0.1:4321"
+	NewAccessLogger(&out, accessLogCombined).Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+	line := out.String()
+	if !strings.HasPrefix(line, "127.0.0.1 - - [") || !strings.Contains(line, `"POST /api/v1/reload HTTP/1.1" 404 19 "-" "-" rt=`) || !strings.HasSuffix(line, " country=-\n") {
+		t.Errorf("combined line = %q", line)
+	}
+}
+
+func TestAccessLogPanic(t *testing.T) {
+	var out bytes.Buffer
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.RemoteAddr = "127.0.0.1:4321"
+	handler := NewAccessLogger(&out, accessLogJSON).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	if !strings.Contains(out.String(), `"status":500`) {
+		t.Errorf("access log = %q, want status 500", out.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	file, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"}
+	for name, content := range want {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), data, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than 2 backups kept")
+	}
+}
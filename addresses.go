@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+)
+
+// AddressIssue flags an address whose country fields could not be reconciled.
+// Values holds the raw country, country_code and country_name that disagreed
+// or could not be recognized; Resolved is the code the address was counted under.
+type AddressIssue struct {
+	AddressID int64             `json:"address_id,omitempty"`
+	Problem   string            `json:"problem"`
+	Values    map[string]string `json:"values"`
+	Resolved  string            `json:"resolved,omitempty"`
+}
+
+// normalizeAddressCountry reconciles an address's country_code, country and
+// country_name fields, mapping free-text names to ISO codes. country_code wins
+// when the fields disagree. All three fields are rewritten to the resolved
+// country; an issue is returned if any field conflicted or was unrecognized.
+func normalizeAddressCountry(addr *Address) *AddressIssue {
+	fields := []struct{ name, value string }{
+		{"country_code", addr.CountryCode},
+		{"country", addr.Country},
+		{"country_name", addr.CountryName},
+	}
+
+	values := make(map[string]string)
+	resolved := ""
+	problem := ""
+	for _, field := range fields {
+		if strings.TrimSpace(field.value) == "" {
+			continue
+		}
+		values[field.name] = field.value
+		code, err := normalizeCountryCode(field.value)
+		switch {
+		case err != nil:
+			if problem == "" {
+				problem = "unrecognized country"
+			}
+		case resolved == "":
+			resolved = code
+		case code != resolved:
+			problem = "conflicting country fields"
+		}
+	}
+
+	if resolved != "" {
+		name, _ := getCountryName(resolved)
+		addr.CountryCode, addr.Country, addr.CountryName = resolved, name, name
+	}
+	if problem == "" {
+		return nil
+	}
+	return &AddressIssue{AddressID: addr.ID, Problem: problem, Values: values, Resolved: resolved}
+}
+
+// addressKey identifies an address for de-duplication, ignoring case,
+// surrounding spaces and who it is addressed to
+func addressKey(addr Address) string {
+	parts := []string{addr.Address1, addr.Address2, addr.City, addr.Province, addr.Zip, addr.CountryCode}
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.Join(strings.Fields(part), " "))
+	}
+	return strings.Join(parts, "|")
+}
+
+// normalizeCustomerAddresses reconciles the country fields of a customer's
+// addresses and drops duplicate addresses, keeping the first of each.
+// It returns the issues found and how many duplicates were dropped.
+func normalizeCustomerAddresses(customer *Customer) ([]AddressIssue, int) {
+	var issues []AddressIssue
+	seenIssues := make(map[int64]bool)
+	report := func(issue *AddressIssue) {
+		if issue != nil && !seenIssues[issue.AddressID] {
+			seenIssues[issue.AddressID] = true
+			issues = append(issues, *issue)
+		}
+	}
+
+	if customer.DefaultAddress != nil {
+		defaultAddress := *customer.DefaultAddress
+		report(normalizeAddressCountry(&defaultAddress))
+		customer.DefaultAddress = &defaultAddress
+	}
+
+	unique := make([]Address, 0, len(customer.Addresses))
+	seen := make(map[string]bool, len(customer.Addresses))
+	for _, addr := range customer.Addresses {
+		report(normalizeAddressCountry(&addr))
+		key := addressKey(addr)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, addr)
+	}
+
+	duplicates := len(customer.Addresses) - len(unique)
+	customer.Addresses = unique
+	return issues, duplicates
+}
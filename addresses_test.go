@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeAddressCountry(t *testing.T) {
+	tests := []struct {
+		name        string
+		addr        Address
+		wantCode    string
+		wantProblem string
+	}{
+		{"consistent", Address{CountryCode: "ca", Country: "Canada", CountryName: "Canada"}, "CA", ""},
+		{"name only", Address{Country: "Deutschland", CountryName: "Germany"}, "DE", "unrecognized country"},
+		{"free-text name", Address{Country: "United States of America"}, "US", ""},
+		{"alias", Address{Country: "UK"}, "GB", ""},
+		{"conflict keeps country_code", Address{CountryCode: "US", Country: "Canada"}, "US", "conflicting country fields"},
+		{"unrecognized only", Address{Country: "Atlantis"}, "", "unrecognized country"},
+		{"empty", Address{}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := tt.addr
+			issue := normalizeAddressCountry(&addr)
+			if addr.CountryCode != tt.wantCode {
+				t.Errorf("country_code = %q, want %q", addr.CountryCode, tt.wantCode)
+			}
+			gotProblem := ""
+			if issue != nil {
+				gotProblem = issue.Problem
+			}
+			if gotProblem != tt.wantProblem {
+				t.Errorf("problem = %q, want %q", gotProblem, tt.wantProblem)
+			}
+			if tt.wantCode != "" && (addr.Country == "" || addr.Country != addr.CountryName) {
+				t.Errorf("country = %q, country_name = %q, want both set to the resolved name", addr.Country, addr.CountryName)
+			}
+		})
+	}
+}
+
+func TestNormalizeCustomerAddresses(t *testing.T) {
+	customer := Customer{
+		DefaultAddress: &Address{ID: 1, Address1: "1 Main St", City: "Ottawa", CountryCode: "CA", Country: "France"},
+		Addresses: []Address{
+			{ID: 1, Address1: "1 Main St", City: "Ottawa", CountryCode: "CA", Country: "France"},
+			{ID: 2, Address1: " 1  main st ", City: "OTTAWA", Country: "Canada"},
+			{ID: 3, Address1: "5 Rue Lepic", City: "Paris", Country: "France"},
+		},
+	}
+
+	issues, duplicates := normalizeCustomerAddresses(&customer)
+	if duplicates != 1 || len(customer.Addresses) != 2 {
+		t.Errorf("duplicates = %d, addresses = %d, want 1 and 2", duplicates, len(customer.Addresses))
+	}
+	if len(issues) != 1 || issues[0].AddressID != 1 || issues[0].Resolved != "CA" {
+		t.Errorf("issues = %+v, want one conflict on address 1 resolved to CA", issues)
+	}
+	if customer.DefaultAddress.CountryCode != "CA" || customer.Addresses[1].CountryCode != "FR" {
+		t.Errorf("codes = %q, %q, want CA and FR", customer.DefaultAddress.CountryCode, customer.Addresses[1].CountryCode)
+	}
+}
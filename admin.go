@@ -0,0 +1,140 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"time"
+)
+
+//go:embed admin
+var adminFiles embed.FS
+
+// adminAssets is the dashboard's HTML, script and styles
+var adminAssets, _ = fs.Sub(adminFiles, "admin")
+
+// adminRealm names the dashboard in the browser's login prompt
+const adminRealm = `Basic realm="Geo-Blocking Admin", charset="UTF-8"`
+
+// adminTopCountries is how many of the most blocked countries the dashboard shows
+const adminTopCountries = 10
+
+// DashboardCountry is a country on the dashboard's blocklist. Status is
+// "blocked" when every client is blocked and "conditional" when only a
+// monitor-mode, challenge, scheduled or reputation rule matches it.
+type DashboardCountry struct {
+	Code   string `json:"code"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+}
+
+// DashboardSummary is what the admin dashboard shows, refreshed by polling
+type DashboardSummary struct {
+	Countries   []DashboardCountry   `json:"countries"`
+	Rules       int                  `json:"rules"`
+	Exemptions  int                  `json:"exemptions"`
+	Monitor     bool                 `json:"monitor"`
+	Traffic     TrafficTotals        `json:"traffic"`
+	TopBlocked  []CountryTraffic     `json:"top_blocked"`
+	Storefront  StorefrontSyncStatus `json:"storefront"`
+	GeneratedAt string               `json:"generated_at"`
+}
+
+// dashboardSummary gathers the blocklist, the last 24 hours of traffic and
+// the storefront sync status
+func dashboardSummary(now time.Time) DashboardSummary {
+	policy := blocklist.Policy()
+	summary := DashboardSummary{
+		Countries:   []DashboardCountry{},
+		Rules:       len(policy.Rules),
+		Exemptions:  len(policy.Exemptions),
+		Monitor:     policy.Monitor,
+		TopBlocked:  []CountryTraffic{},
+		Storefront:  storefrontSync.Status(),
+		GeneratedAt: now.Format(time.RFC3339),
+	}
+	for _, code := range blocklist.Countries() {
+		country := DashboardCountry{Code: code, Status: "conditional"}
+		country.Name, _ = getCountryName(code)
+		if blocklist.IsBlocked(code) {
+			country.Status = "blocked"
+		}
+		summary.Countries = append(summary.Countries, country)
+	}
+
+	for _, country := range trafficAnalytics.Summary(24*time.Hour, now) {
+		summary.Traffic.Requests += country.Requests
+		summary.Traffic.Blocks += country.Blocks
+		summary.Traffic.Monitored += country.Monitored
+		summary.Traffic.UniqueIPs += country.UniqueIPs
+		if country.Blocks > 0 {
+			country.CountryName, _ = getCountryName(country.CountryCode)
+			summary.TopBlocked = append(summary.TopBlocked, country)
+		}
+	}
+	sort.SliceStable(summary.TopBlocked, func(i, j int) bool {
+		return summary.TopBlocked[i].Blocks > summary.TopBlocked[j].Blocks
+	})
+	if len(summary.TopBlocked) > adminTopCountries {
+		summary.TopBlocked = summary.TopBlocked[:adminTopCountries]
+	}
+	return summary
+}
+
+// requireAdminLogin protects the dashboard with requireRole, also accepting
+// the API token as the password of HTTP Basic auth so browsers can log in.
+// Basic auth is only accepted here; the API itself still needs a header.
+func requireAdminLogin(next http.HandlerFunc) http.HandlerFunc {
+	protected := requireRole(RoleAdmin, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, password, ok := r.BasicAuth(); ok {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+password)
+		}
+		if authEnabled() && lookupPrincipal(tokenFromRequest(r)) == nil {
+			w.Header().Set("WWW-Authenticate", adminRealm)
+		}
+		protected(w, r)
+	}
+}
+
+// adminHeaders keeps the dashboard's pages to their own scripts and out of frames
+func adminHeaders(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r)
+	}
+}
+
+// handleAdminAssets serves the embedded dashboard
+func handleAdminAssets(w http.ResponseWriter, r *http.Request) {
+	http.StripPrefix("/admin", http.FileServerFS(adminAssets)).ServeHTTP(w, r)
+}
+
+// handleAdminSummary returns the dashboard's data
+func handleAdminSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dashboardSummary(time.Now()))
+}
+
+// registerAdminRoutes serves the dashboard at /admin/. Its data and event
+// stream are under /admin/ too, so browsers send the Basic credentials with them.
+// BLOCKED_ROUTES entries such as "/admin/*" put them behind country blocking.
+func registerAdminRoutes(mux *http.ServeMux) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		if isBlockedRoute(pattern) {
+			handler = routeBlockingMiddleware(handler)
+		}
+		mux.HandleFunc(pattern, handler)
+	}
+	mux.Handle("GET /admin", http.RedirectHandler("/admin/", http.StatusMovedPermanently))
+	handle("GET /admin/", adminHeaders(requireAdminLogin(handleAdminAssets)))
+	handle("GET /admin/summary", adminHeaders(requireAdminLogin(handleAdminSummary)))
+	handle("GET /admin/events", adminHeaders(requireAdminLogin(handleEvents)))
+}
@@ -0,0 +1,83 @@
+// Geo-Blocking admin dashboard. Every value from the server is inserted as
+// text, never as HTML: event paths and IPs come from untrusted clients.
+"use strict";
+
+const maxEvents = 50;
+
+function el(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (className) node.className = className;
+  return node;
+}
+
+function row(cells, className) {
+  const tr = el("tr", undefined, className);
+  for (const cell of cells) {
+    tr.append(cell instanceof Node ? cell : el("td", String(cell)));
+  }
+  return tr;
+}
+
+function render(summary) {
+  document.getElementById("updated").textContent = "Updated " + new Date(summary.generated_at).toLocaleTimeString();
+  document.getElementById("requests").textContent = summary.traffic.requests;
+  document.getElementById("blocks").textContent = summary.traffic.blocks;
+  document.getElementById("unique-ips").textContent = summary.traffic.unique_ips;
+  document.getElementById("rules").textContent = summary.rules;
+  document.getElementById("monitor").hidden = !summary.monitor;
+
+  const countries = document.getElementById("countries");
+  countries.replaceChildren(...summary.countries.map((country) => {
+    const chip = el("li", country.code, country.status);
+    chip.title = (country.name || country.code) + (country.status === "conditional" ? " (conditional rule)" : "");
+    return chip;
+  }));
+  if (summary.countries.length === 0) countries.append(el("li", "No countries blocked", "conditional"));
+
+  const most = summary.top_blocked.length ? summary.top_blocked[0].blocks : 1;
+  document.getElementById("top-blocked").replaceChildren(...summary.top_blocked.map((country) => {
+    const bar = el("div", undefined, "bar");
+    bar.style.width = Math.max(2, Math.round(100 * country.blocks / most)) + "%";
+    const barCell = el("td");
+    barCell.append(bar);
+    return row([(country.country_name || country.country_code) + " (" + country.country_code + ")", country.blocks, barCell]);
+  }));
+
+  const storefront = summary.storefront;
+  const fields = [["Enabled", storefront.enabled ? "yes" : "no"], ["State", storefront.state]];
+  if (storefront.synced_version) fields.push(["Synced version", storefront.synced_version]);
+  if (storefront.pending_version) fields.push(["Pending version", storefront.pending_version]);
+  if (storefront.last_synced_at) fields.push(["Last synced", new Date(storefront.last_synced_at).toLocaleString()]);
+  if (storefront.last_error) fields.push(["Last error", storefront.last_error]);
+  document.getElementById("storefront").replaceChildren(...fields.flatMap(([name, value]) => [el("dt", name), el("dd", String(value))]));
+}
+
+async function refresh() {
+  try {
+    const response = await fetch("summary", { headers: { Accept: "application/json" } });
+    if (!response.ok) throw new Error(response.status + " " + response.statusText);
+    render(await response.json());
+  } catch (err) {
+    document.getElementById("updated").textContent = "Update failed: " + err.message;
+  }
+}
+
+function streamEvents() {
+  const status = document.getElementById("stream");
+  const events = document.getElementById("events");
+  const source = new EventSource("events");
+  source.onopen = () => { status.textContent = "live"; status.className = "badge ok"; };
+  source.onerror = () => { status.textContent = "reconnecting"; status.className = "badge warn"; };
+  source.addEventListener("decision", (message) => {
+    const event = JSON.parse(message.data);
+    const time = new Date(event.time).toLocaleTimeString();
+    events.prepend(row([time, event.decision, event.country_code, event.client_ip,
+      event.method + " " + event.path, event.rule_id || event.network || event.exemption || ""], event.decision));
+    while (events.children.length > maxEvents) events.lastChild.remove();
+  });
+}
+
+refresh();
+setInterval(refresh, 10000);
+streamEvents();
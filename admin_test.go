@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminDashboardAuth(t *testing.T) {
+	saved := apiTokens
+	apiTokens = map[string]*Principal{
+		"admin-token":  {Name: "admin", Role: RoleAdmin},
+		"viewer-token": {Name: "viewer", Role: RoleViewer},
+	}
+	t.Cleanup(func() { apiTokens = saved })
+
+	mux := http.NewServeMux()
+	registerAdminRoutes(mux)
+
+	tests := []struct {
+		name          string
+		path          string
+		auth          func(*http.Request)
+		wantStatus    int
+		wantChallenge bool
+	}{
+		{"no credentials", "/admin/", func(r *http.Request) {}, http.StatusUnauthorized, true},
+		{"wrong password", "/admin/", func(r *http.Request) { r.SetBasicAuth("admin", "nope") }, http.StatusUnauthorized, true},
+		{"viewer token", "/admin/", func(r *http.Request) { r.SetBasicAuth("", "viewer-token") }, http.StatusForbidden, false},
+		{"basic auth", "/admin/", func(r *http.Request) { r.SetBasicAuth("admin", "admin-token") }, http.StatusOK, false},
+		{"bearer token", "/admin/summary", func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin-token") }, http.StatusOK, false},
+		{"script", "/admin/app.js", func(r *http.Request) { r.SetBasicAuth("admin", "admin-token") }, http.StatusOK, false},
+		{"redirect", "/admin", func(r *http.Request) {}, http.StatusMovedPermanently, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			tt.auth(req)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("GET %s = %d, want %d", tt.path, recorder.Code, tt.wantStatus)
+			}
+			if got := recorder.Header().Get("WWW-Authenticate") != ""; got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want challenge %v", recorder.Header().Get("WWW-Authenticate"), tt.wantChallenge)
+			}
+			if tt.path != "/admin" && !strings.Contains(recorder.Header().Get("Content-Security-Policy"), "default-src 'self'") {
+				t.Errorf("Content-Security-Policy = %q", recorder.Header().Get("Content-Security-Policy"))
+			}
+		})
+	}
+}
+
+func TestAdminBasicAuthOnlyOnDashboard(t *testing.T) {
+	saved := apiTokens
+	apiTokens = map[string]*Principal{"admin-token": {Name: "admin", Role: RoleAdmin}}
+	t.Cleanup(func() { apiTokens = saved })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/block-rules", nil)
+	req.SetBasicAuth("admin", "admin-token")
+	recorder := httptest.NewRecorder()
+	requireRole(RoleViewer, handleListBlockRules)(recorder, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("API with Basic auth = %d, want 401", recorder.Code)
+	}
+}
+
+func TestDashboardSummary(t *testing.T) {
+	summary := dashboardSummary(time.Now())
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// The dashboard script iterates these without checking for null
+	for _, field := range []string{`"countries":[`, `"top_blocked":[`, `"storefront":{`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("summary %s lacks %s", data, field)
+		}
+	}
+}
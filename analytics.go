@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// trafficBucketSize is the granularity of the traffic counters
+const trafficBucketSize = 5 * time.Minute
+
+// trafficRetention is how long counters are kept; it bounds the longest window
+const trafficRetention = 7 * 24 * time.Hour
+
+// maxTrafficIPsPerBucket caps the distinct IPs remembered per country and
+// bucket, so unique IP counts are a lower bound under very heavy traffic
+const maxTrafficIPsPerBucket = 10000
+
+// trafficWindows are the windows accepted by /api/v1/analytics/traffic
+var trafficWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// countryCounter holds one country's traffic within a bucket
+type countryCounter struct {
+	requests  int
+	blocks    int
+	monitored int
+	ips       map[string]struct{}
+}
+
+// TrafficAnalytics aggregates blocking decisions into time-bucketed counters per country
+type TrafficAnalytics struct {
+	mu      sync.Mutex
+	buckets map[int64]map[string]*countryCounter
+}
+
+// NewTrafficAnalytics creates an empty aggregator
+func NewTrafficAnalytics() *TrafficAnalytics {
+	return &TrafficAnalytics{buckets: make(map[int64]map[string]*countryCounter)}
+}
+
+// bucketKey returns the bucket containing t
+func bucketKey(t time.Time) int64 {
+	return t.UnixNano() / int64(trafficBucketSize)
+}
+
+// Record counts one request from ip in country at the given time. Monitored
+// requests were allowed but would have been blocked by a monitor-mode rule.
+func (a *TrafficAnalytics) Record(country, ip string, blocked, monitored bool, at time.Time) {
+	key := bucketKey(at)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	bucket, ok := a.buckets[key]
+	if !ok {
+		bucket = make(map[string]*countryCounter)
+		a.buckets[key] = bucket
+		a.prune(at)
+	}
+	counter, ok := bucket[country]
+	if !ok {
+		counter = &countryCounter{ips: make(map[string]struct{})}
+		bucket[country] = counter
+	}
+
+	counter.requests++
+	if blocked {
+		counter.blocks++
+	}
+	if monitored {
+		counter.monitored++
+	}
+	if ip != "" && len(counter.ips) < maxTrafficIPsPerBucket {
+		counter.ips[ip] = struct{}{}
+	}
+}
+
+// prune drops buckets older than the retention period. Callers must hold a.mu.
+func (a *TrafficAnalytics) prune(now time.Time) {
+	oldest := bucketKey(now.Add(-trafficRetention))
+	for key := range a.buckets {
+		if key < oldest {
+			delete(a.buckets, key)
+		}
+	}
+}
+
+// CountryTraffic is one country's traffic over a window
+type CountryTraffic struct {
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country_name,omitempty"`
+	Requests    int    `json:"requests"`
+	Blocks      int    `json:"blocks"`
+	Monitored   int    `json:"monitored"`
+	UniqueIPs   int    `json:"unique_ips"`
+}
+
+// Summary returns per-country traffic for the buckets overlapping the window
+// ending at now, busiest countries first
+func (a *TrafficAnalytics) Summary(window time.Duration, now time.Time) []CountryTraffic {
+	first, last := bucketKey(now.Add(-window)), bucketKey(now)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	totals := make(map[string]*CountryTraffic)
+	ips := make(map[string]map[string]struct{})
+	for key, bucket := range a.buckets {
+		if key < first || key > last {
+			continue
+		}
+		for country, counter := range bucket {
+			total, ok := totals[country]
+			if !ok {
+				total = &CountryTraffic{CountryCode: country}
+				totals[country] = total
+				ips[country] = make(map[string]struct{})
+			}
+			total.Requests += counter.requests
+			total.Blocks += counter.blocks
+			total.Monitored += counter.monitored
+			for ip := range counter.ips {
+				ips[country][ip] = struct{}{}
+			}
+		}
+	}
+
+	summary := make([]CountryTraffic, 0, len(totals))
+	for country, total := range totals {
+		total.UniqueIPs = len(ips[country])
+		summary = append(summary, *total)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Requests != summary[j].Requests {
+			return summary[i].Requests > summary[j].Requests
+		}
+		return summary[i].CountryCode < summary[j].CountryCode
+	})
+	return summary
+}
+
+// NetworkClients counts the distinct IPs within network seen in the buckets
+// overlapping the window ending at now, by the country they were resolved
+// to, along with the distinct IPs seen overall. IPs past
+// maxTrafficIPsPerBucket are not counted.
+func (a *TrafficAnalytics) NetworkClients(network *net.IPNet, window time.Duration, now time.Time) (map[string]int, int) {
+	first, last := bucketKey(now.Add(-window)), bucketKey(now)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	all := make(map[string]struct{})
+	inNetwork := make(map[string]map[string]struct{})
+	for key, bucket := range a.buckets {
+		if key < first || key > last {
+			continue
+		}
+		for country, counter := range bucket {
+			for ip := range counter.ips {
+				all[ip] = struct{}{}
+				if parsed := net.ParseIP(ip); parsed == nil || !network.Contains(parsed) {
+					continue
+				}
+				if inNetwork[country] == nil {
+					inNetwork[country] = make(map[string]struct{})
+				}
+				inNetwork[country][ip] = struct{}{}
+			}
+		}
+	}
+
+	byCountry := make(map[string]int, len(inNetwork))
+	for country, ips := range inNetwork {
+		byCountry[country] = len(ips)
+	}
+	return byCountry, len(all)
+}
+
+// TrafficBucket is one country's traffic within one bucket
+type TrafficBucket struct {
+	Start time.Time
+	CountryTraffic
+}
+
+// Buckets returns the per-country counters of every bucket starting at or
+// after since, oldest first
+func (a *TrafficAnalytics) Buckets(since time.Time) []TrafficBucket {
+	first := bucketKey(since)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var buckets []TrafficBucket
+	for key, bucket := range a.buckets {
+		if key < first {
+			continue
+		}
+		for country, counter := range bucket {
+			buckets = append(buckets, TrafficBucket{
+				Start: time.Unix(0, key*int64(trafficBucketSize)).UTC(),
+				CountryTraffic: CountryTraffic{
+					CountryCode: country,
+					Requests:    counter.requests,
+					Blocks:      counter.blocks,
+					Monitored:   counter.monitored,
+					UniqueIPs:   len(counter.ips),
+				},
+			})
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if !buckets[i].Start.Equal(buckets[j].Start) {
+			return buckets[i].Start.Before(buckets[j].Start)
+		}
+		return buckets[i].CountryCode < buckets[j].CountryCode
+	})
+	return buckets
+}
+
+// trafficAnalytics counts decisions made by the live blocking middleware
+var trafficAnalytics = NewTrafficAnalytics()
+
+type TrafficTotals struct {
+	Requests  int `json:"requests"`
+	Blocks    int `json:"blocks"`
+	Monitored int `json:"monitored"`
+	UniqueIPs int `json:"unique_ips"`
+}
+
+type TrafficResponse struct {
+	Window     string             `json:"window"`
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Totals     TrafficTotals      `json:"totals"`
+	Countries  []CountryTraffic   `json:"countries"`
+	Continents []ContinentTraffic `json:"continents"`
+}
+
+// handleTrafficAnalytics reports requests, blocks and unique IPs per country
+// and continent over a 1h, 24h or 7d window, optionally limited to the top N countries
+func handleTrafficAnalytics(w http.ResponseWriter, r *http.Request) {
+	windowName := r.URL.Query().Get("window")
+	if windowName == "" {
+		windowName = "24h"
+	}
+	window, ok := trafficWindows[windowName]
+	if !ok {
+		writeError(w, r, fmt.Sprintf("Invalid window %q: use 1h, 24h or 7d", windowName), http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, r, fmt.Sprintf("Invalid limit %q: must be a positive integer", value), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	now := time.Now()
+	countries := trafficAnalytics.Summary(window, now)
+
+	response := TrafficResponse{
+		Window: windowName,
+		From:   now.Add(-window).Format(time.RFC3339),
+		To:     now.Format(time.RFC3339),
+	}
+	for i := range countries {
+		response.Totals.Requests += countries[i].Requests
+		response.Totals.Blocks += countries[i].Blocks
+		response.Totals.Monitored += countries[i].Monitored
+		response.Totals.UniqueIPs += countries[i].UniqueIPs
+		countries[i].CountryName, _ = getCountryName(countries[i].CountryCode)
+	}
+	response.Continents = continentTraffic(countries)
+	if limit > 0 && len(countries) > limit {
+		countries = countries[:limit]
+	}
+	response.Countries = countries
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
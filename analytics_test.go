@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTrafficAnalyticsSummary(t *testing.T) {
+	now := time.Date(2025, time.March, 8, 12, 0, 0, 0, time.UTC)
+	analytics := NewTrafficAnalytics()
+
+	analytics.Record("RU", "203.0.113.1", true, false, now.Add(-10*time.Minute))
+	analytics.Record("RU", "203.0.113.1", true, false, now.Add(-5*time.Minute))
+	analytics.Record("RU", "203.0.113.2", false, false, now)
+	analytics.Record("US", "192.0.2.1", false, false, now.Add(-3*time.Hour))
+	analytics.Record("US", "192.0.2.1", false, false, now.Add(-2*time.Hour))
+	analytics.Record("DE", "198.51.100.1", false, false, now.Add(-3*24*time.Hour))
+
+	tests := []struct {
+		window time.Duration
+		want   []CountryTraffic
+	}{
+		{time.Hour, []CountryTraffic{
+			{CountryCode: "RU", Requests: 3, Blocks: 2, UniqueIPs: 2},
+		}},
+		{24 * time.Hour, []CountryTraffic{
+			{CountryCode: "RU", Requests: 3, Blocks: 2, UniqueIPs: 2},
+			{CountryCode: "US", Requests: 2, Blocks: 0, UniqueIPs: 1},
+		}},
+		{7 * 24 * time.Hour, []CountryTraffic{
+			{CountryCode: "RU", Requests: 3, Blocks: 2, UniqueIPs: 2},
+			{CountryCode: "US", Requests: 2, Blocks: 0, UniqueIPs: 1},
+			{CountryCode: "DE", Requests: 1, Blocks: 0, UniqueIPs: 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		got := analytics.Summary(tt.window, now)
+		if len(got) != len(tt.want) {
+			t.Errorf("Summary(%s) = %+v, want %+v", tt.window, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Summary(%s)[%d] = %+v, want %+v", tt.window, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestTrafficAnalyticsPrunesOldBuckets(t *testing.T) {
+	now := time.Date(2025, time.March, 8, 12, 0, 0, 0, time.UTC)
+	analytics := NewTrafficAnalytics()
+
+	analytics.Record("RU", "203.0.113.1", true, false, now.Add(-8*24*time.Hour))
+	analytics.Record("US", "192.0.2.1", false, false, now)
+
+	if len(analytics.buckets) != 1 {
+		t.Errorf("kept %d buckets, want 1", len(analytics.buckets))
+	}
+}
+
+func TestTrafficAnalyticsBuckets(t *testing.T) {
+	now := time.Date(2025, time.March, 8, 12, 2, 0, 0, time.UTC)
+	analytics := NewTrafficAnalytics()
+
+	analytics.Record("RU", "203.0.113.1", true, false, now.Add(-time.Hour))
+	analytics.Record("US", "192.0.2.1", false, false, now.Add(-6*time.Minute))
+	analytics.Record("RU", "203.0.113.1", true, false, now)
+	analytics.Record("RU", "203.0.113.2", false, true, now)
+
+	got := analytics.Buckets(now.Add(-10 * time.Minute))
+	want := []TrafficBucket{
+		{time.Date(2025, time.March, 8, 11, 55, 0, 0, time.UTC), CountryTraffic{CountryCode: "US", Requests: 1, UniqueIPs: 1}},
+		{time.Date(2025, time.March, 8, 12, 0, 0, 0, time.UTC), CountryTraffic{CountryCode: "RU", Requests: 2, Blocks: 1, Monitored: 1, UniqueIPs: 2}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Buckets = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if !got[i].Start.Equal(want[i].Start) || got[i].CountryTraffic != want[i].CountryTraffic {
+			t.Errorf("Buckets[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTrafficAnalyticsNetworkClients(t *testing.T) {
+	now := time.Date(2025, time.March, 8, 12, 2, 0, 0, time.UTC)
+	analytics := NewTrafficAnalytics()
+
+	analytics.Record("US", "203.0.113.1", false, false, now)
+	analytics.Record("US", "203.0.113.1", false, false, now.Add(-10*time.Minute))
+	analytics.Record("DE", "203.0.113.2", false, false, now)
+	analytics.Record("US", "192.0.2.1", false, false, now)
+	analytics.Record("US", "203.0.113.3", false, false, now.Add(-2*time.Hour))
+
+	_, network, _ := net.ParseCIDR("203.0.113.0/24")
+	byCountry, total := analytics.NetworkClients(network, time.Hour, now)
+	if total != 3 || len(byCountry) != 2 || byCountry["US"] != 1 || byCountry["DE"] != 1 {
+		t.Errorf("NetworkClients = %v, %d; want US and DE once each of 3", byCountry, total)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxAuditEntries bounds the in-memory audit log
+const maxAuditEntries = 1000
+
+// AuditEntry records a change made through the management API
+type AuditEntry struct {
+	Timestamp string      `json:"timestamp"`
+	Principal string      `json:"principal"`
+	Role      string      `json:"role"`
+	Action    string      `json:"action"`
+	ClientIP  string      `json:"client_ip,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+}
+
+var (
+	auditMu  sync.Mutex
+	auditLog []AuditEntry
+)
+
+// recordAudit appends an entry attributed to the request's principal
+func recordAudit(r *http.Request, action string, details interface{}) {
+	principal := principalFromContext(r.Context())
+
+	entry := AuditEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Principal: principal.Name,
+		Role:      principal.Role.String(),
+		Action:    action,
+		ClientIP:  getRealIP(r),
+		Details:   details,
+	}
+	appendAudit(entry)
+}
+
+// recordSystemAudit appends an entry for a change made by the server itself,
+// such as a background job
+func recordSystemAudit(action string, details interface{}) {
+	appendAudit(AuditEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Principal: "system",
+		Role:      RoleAdmin.String(),
+		Action:    action,
+		Details:   details,
+	})
+}
+
+// appendAudit keeps the entry in memory and, with Postgres storage, in the database
+func appendAudit(entry AuditEntry) {
+	auditMu.Lock()
+	auditLog = append(auditLog, entry)
+	if len(auditLog) > maxAuditEntries {
+		auditLog = auditLog[len(auditLog)-maxAuditEntries:]
+	}
+	auditMu.Unlock()
+
+	if postgresStore != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+		defer cancel()
+		if err := postgresStore.AppendAudit(ctx, entry); err != nil {
+			fmt.Printf("⚠️  Audit entry %q not saved to Postgres: %v\n", entry.Action, err)
+		}
+	}
+}
+
+// handleAuditLog returns the recorded audit entries, newest last. With Postgres
+// storage they include entries from before the last restart.
+func handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	auditMu.Lock()
+	entries := append(make([]AuditEntry, 0, len(auditLog)), auditLog...)
+	auditMu.Unlock()
+
+	if postgresStore != nil {
+		stored, err := postgresStore.RecentAudit(r.Context(), maxAuditEntries)
+		if err != nil {
+			fmt.Printf("⚠️  Could not read audit log from Postgres, showing this instance's entries: %v\n", err)
+		} else {
+			entries = stored
+		}
+	}
+
+	response := AuditLogResponse{
+		Entries: entries,
+		Total:   len(entries),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is a permission level granted to an API token
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "unknown"
+}
+
+// parseRole converts a role name from configuration into a Role
+func parseRole(name string) (Role, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "viewer":
+		return RoleViewer, true
+	case "operator":
+		return RoleOperator, true
+	case "admin":
+		return RoleAdmin, true
+	}
+	return 0, false
+}
+
+// Principal identifies the caller behind an API token
+type Principal struct {
+	Name string
+	Role Role
+}
+
+type principalContextKey struct{}
+
+// authDisabled opts out of authentication entirely when no tokens are configured.
+// Without it, anonymous callers may only read.
+var authDisabled = getEnv("AUTH_DISABLED", "") == "true"
+
+// anonymousPrincipal is used for every request when no tokens are configured
+var anonymousPrincipal = newAnonymousPrincipal()
+
+// newAnonymousPrincipal grants admin only when AUTH_DISABLED=true; otherwise
+// anonymous callers are viewers, kept from customer data and from anything
+// that changes state
+func newAnonymousPrincipal() *Principal {
+	if authDisabled {
+		return &Principal{Name: "anonymous", Role: RoleAdmin}
+	}
+	return &Principal{Name: "anonymous", Role: RoleViewer}
+}
+
+// apiTokens maps bearer tokens to principals
+var apiTokens = loadAPITokens()
+
+// loadAPITokens reads tokens from the environment.
+// ADMIN_API_KEY grants a single admin token; API_TOKENS adds more as
+// comma-separated name:role:token entries, e.g. "dashboard:viewer:abc123".
+func loadAPITokens() map[string]*Principal {
+	tokens := make(map[string]*Principal)
+
+	if adminKey := getEnv("ADMIN_API_KEY", ""); adminKey != "" {
+		tokens[adminKey] = &Principal{Name: "admin", Role: RoleAdmin}
+	}
+
+	for _, entry := range strings.Split(getEnv("API_TOKENS", ""), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			fmt.Printf("⚠️  Ignoring malformed API_TOKENS entry (expected name:role:token)\n")
+			continue
+		}
+		role, ok := parseRole(parts[1])
+		if !ok {
+			fmt.Printf("⚠️  Ignoring API token %q with unknown role %q\n", parts[0], parts[1])
+			continue
+		}
+		tokens[parts[2]] = &Principal{Name: parts[0], Role: role}
+	}
+
+	return tokens
+}
+
+// authEnabled reports whether any API tokens are configured
+func authEnabled() bool {
+	return len(apiTokens) > 0
+}
+
+// tokenFromRequest extracts the API token from the Authorization or X-API-Key header
+func tokenFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// lookupPrincipal finds the principal for a token using constant-time comparison
+func lookupPrincipal(token string) *Principal {
+	if token == "" {
+		return nil
+	}
+	for candidate, principal := range apiTokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return principal
+		}
+	}
+	return nil
+}
+
+// requestPrincipalName returns the name of the API token sent with a request,
+// or "" if it carries no valid token. Unlike requireRole it never rejects.
+func requestPrincipalName(r *http.Request) string {
+	if principal := lookupPrincipal(tokenFromRequest(r)); principal != nil {
+		return principal.Name
+	}
+	return ""
+}
+
+// principalFromContext returns the authenticated caller of a request
+func principalFromContext(ctx context.Context) *Principal {
+	if principal, ok := ctx.Value(principalContextKey{}).(*Principal); ok {
+		return principal
+	}
+	return anonymousPrincipal
+}
+
+// forbiddenMessage explains a denied request, pointing anonymous callers at token setup
+func forbiddenMessage(principal *Principal, role Role) string {
+	if principal == anonymousPrincipal {
+		return fmt.Sprintf("Forbidden: %s role required; configure ADMIN_API_KEY or API_TOKENS (or AUTH_DISABLED=true)", role)
+	}
+	return fmt.Sprintf("Forbidden: %s role required", role)
+}
+
+// requireRole rejects requests whose token does not grant at least the given role
+func requireRole(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := anonymousPrincipal
+
+		if authEnabled() {
+			principal = lookupPrincipal(tokenFromRequest(r))
+			if principal == nil {
+				writeError(w, r, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if geoVelocity.Blocked(principal.Name) {
+				fmt.Printf("⛔ DENIED: suspended API key %s for %s %s\n", principal.Name, r.Method, r.URL.Path)
+				writeError(w, r, suspendedKeyMessage, http.StatusForbidden)
+				return
+			}
+		}
+		if principal.Role < role {
+			fmt.Printf("🔒 DENIED: %s (%s) needs %s for %s %s\n", principal.Name, principal.Role, role, r.Method, r.URL.Path)
+			writeError(w, r, forbiddenMessage(principal, role), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey{}, principal)
+		next(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useTestTokens replaces the configured API tokens for one test
+func useTestTokens(t *testing.T, tokens map[string]*Principal) {
+	saved := apiTokens
+	apiTokens = tokens
+	t.Cleanup(func() { apiTokens = saved })
+}
+
+func TestLoadAPITokens(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "root-key")
+	t.Setenv("API_TOKENS", "dashboard:viewer:abc, ci:Operator:def,, broken, noToken:admin:, bad:superuser:ghi, colons:admin:x:y")
+
+	tokens := loadAPITokens()
+	want := map[string]Principal{
+		"root-key": {Name: "admin", Role: RoleAdmin},
+		"abc":      {Name: "dashboard", Role: RoleViewer},
+		"def":      {Name: "ci", Role: RoleOperator},
+		"x:y":      {Name: "colons", Role: RoleAdmin},
+	}
+	if len(tokens) != len(want) {
+		t.Errorf("loaded %d tokens, want %d: %v", len(tokens), len(want), tokens)
+	}
+	for token, principal := range want {
+		if got := tokens[token]; got == nil || *got != principal {
+			t.Errorf("token %q = %v, want %v", token, got, principal)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	useTestTokens(t, map[string]*Principal{
+		"viewer-token":   {Name: "dashboard", Role: RoleViewer},
+		"operator-token": {Name: "ci", Role: RoleOperator},
+		"admin-token":    {Name: "admin", Role: RoleAdmin},
+	})
+
+	tests := []struct {
+		name       string
+		role       Role
+		header     string
+		value      string
+		wantStatus int
+		wantCaller string
+	}{
+		{"missing token", RoleViewer, "", "", http.StatusUnauthorized, ""},
+		{"unknown token", RoleViewer, "Authorization", "Bearer nope", http.StatusUnauthorized, ""},
+		{"malformed authorization", RoleViewer, "Authorization", "Basic viewer-token", http.StatusUnauthorized, ""},
+		{"viewer reads", RoleViewer, "Authorization", "Bearer viewer-token", http.StatusOK, "dashboard"},
+		{"viewer denied operator", RoleOperator, "Authorization", "Bearer viewer-token", http.StatusForbidden, ""},
+		{"operator denied admin", RoleAdmin, "X-API-Key", "operator-token", http.StatusForbidden, ""},
+		{"operator allowed operator", RoleOperator, "X-API-Key", "operator-token", http.StatusOK, "ci"},
+		{"admin allowed everything", RoleAdmin, "Authorization", "Bearer admin-token", http.StatusOK, "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var caller string
+			handler := requireRole(tt.role, func(w http.ResponseWriter, r *http.Request) {
+				caller = principalFromContext(r.Context()).Name
+			})
+			r := httptest.NewRequest("GET", "/api/v1/audit-log", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if caller != tt.wantCaller {
+				t.Errorf("handler saw %q, want %q", caller, tt.wantCaller)
+			}
+		})
+	}
+}
+
+func TestRequireRoleAnonymous(t *testing.T) {
+	useTestTokens(t, map[string]*Principal{})
+	savedDisabled, savedAnonymous := authDisabled, anonymousPrincipal
+	defer func() { authDisabled, anonymousPrincipal = savedDisabled, savedAnonymous }()
+
+	tests := []struct {
+		name         string
+		authDisabled bool
+		role         Role
+		wantStatus   int
+	}{
+		{"anonymous reads", false, RoleViewer, http.StatusOK},
+		{"anonymous cannot analyze", false, RoleOperator, http.StatusForbidden},
+		{"anonymous cannot change the policy", false, RoleAdmin, http.StatusForbidden},
+		{"AUTH_DISABLED grants admin", true, RoleAdmin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authDisabled = tt.authDisabled
+			anonymousPrincipal = newAnonymousPrincipal()
+			handler := requireRole(tt.role, func(w http.ResponseWriter, r *http.Request) {
+				if principalFromContext(r.Context()) != anonymousPrincipal {
+					t.Error("handler did not see the anonymous principal")
+				}
+			})
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("POST", "/api/v1/block-countries", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAnonymousOperatorRoutes(t *testing.T) {
+	useTestTokens(t, map[string]*Principal{})
+	savedDisabled, savedAnonymous := authDisabled, anonymousPrincipal
+	defer func() { authDisabled, anonymousPrincipal = savedDisabled, savedAnonymous }()
+	authDisabled = false
+	anonymousPrincipal = newAnonymousPrincipal()
+
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/api/v1/countries/DE/customers"},
+		{"POST", "/api/v1/customers"},
+		{"POST", "/api/v1/geo-corrections"},
+		{"GET", "/api/v1/self-test"},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(route.method, route.path, nil))
+		if w.Code != http.StatusUnauthorized && w.Code != http.StatusForbidden {
+			t.Errorf("anonymous %s %s = %d, want 401 or 403", route.method, route.path, w.Code)
+		}
+	}
+}
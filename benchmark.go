@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// Default budgets a benchmark must meet, and its size limits
+var (
+	benchmarkDecisionBudget = getEnvDuration("BENCHMARK_P99_BUDGET", time.Millisecond)
+	benchmarkMinThroughput  = getEnvFloat("BENCHMARK_MIN_THROUGHPUT", 5000)
+	benchmarkGeoCacheBudget = getEnvDuration("BENCHMARK_GEO_CACHE_P99_BUDGET", 5*time.Millisecond)
+)
+
+const (
+	defaultBenchmarkRequests = 10000
+	defaultBenchmarkIPs      = 1000
+	maxBenchmarkRequests     = 1000000
+	maxBenchmarkIPs          = 1 << 17
+	maxBenchmarkConcurrency  = 256
+)
+
+// benchmarkMu lets one benchmark run at a time, so runs don't skew each other
+var benchmarkMu sync.Mutex
+
+type BenchmarkRequest struct {
+	Requests            int     `json:"requests,omitempty"`
+	IPs                 int     `json:"ips,omitempty"`
+	Concurrency         int     `json:"concurrency,omitempty"`
+	P99BudgetUS         int64   `json:"p99_budget_us,omitempty"`
+	MinThroughput       float64 `json:"min_throughput,omitempty"`
+	GeoCacheP99BudgetUS int64   `json:"geo_cache_p99_budget_us,omitempty"`
+}
+
+// BenchmarkPhase is the outcome of timing one component. Status is "pass"
+// when its p99 latency and throughput are within budget, "fail" otherwise,
+// and "skipped" when the component is not configured.
+type BenchmarkPhase struct {
+	Name          string         `json:"name"`
+	Status        string         `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Requests      int            `json:"requests"`
+	DurationMs    int64          `json:"duration_ms"`
+	Throughput    float64        `json:"throughput_per_sec"`
+	P50US         float64        `json:"p50_us"`
+	P99US         float64        `json:"p99_us"`
+	MaxUS         float64        `json:"max_us"`
+	P99BudgetUS   int64          `json:"p99_budget_us"`
+	MinThroughput float64        `json:"min_throughput,omitempty"`
+	Decisions     map[string]int `json:"decisions,omitempty"`
+}
+
+type BenchmarkResponse struct {
+	Passed      bool             `json:"passed"`
+	Requests    int              `json:"requests"`
+	IPs         int              `json:"ips"`
+	Concurrency int              `json:"concurrency"`
+	Phases      []BenchmarkPhase `json:"phases"`
+	StartedAt   string           `json:"started_at"`
+}
+
+// benchmarkIP returns the i-th synthetic client address, from the
+// 198.18.0.0/15 range reserved for benchmarks (RFC 2544)
+func benchmarkIP(i int) string {
+	return net.IPv4(198, 18+byte(i>>16&1), byte(i>>8), byte(i)).String()
+}
+
+// benchmarkDecision names a decision in the benchmark's tally
+func benchmarkDecision(decision geoblock.Decision) string {
+	switch {
+	case decision.Exemption != nil:
+		return "exempt"
+	case decision.Challenged:
+		return "challenge"
+	case decision.Monitored:
+		return "monitor"
+	case decision.Blocked:
+		return "block"
+	}
+	return "allow"
+}
+
+// discardResponseWriter drops responses so only the middleware is timed
+type discardResponseWriter struct{ header http.Header }
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+// timeConcurrently calls fn for every index from 0 to n on concurrency
+// workers, returning each call's latency and the total duration
+func timeConcurrently(ctx context.Context, n, concurrency int, fn func(i int)) ([]time.Duration, time.Duration) {
+	latencies := make([]time.Duration, n)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				callStart := time.Now()
+				fn(i)
+				latencies[i] = time.Since(callStart)
+			}
+		}()
+	}
+	wg.Wait()
+	return latencies, time.Since(start)
+}
+
+// percentile returns the p-th percentile (0 to 1) of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// microseconds converts a latency to fractional microseconds, as most
+// decisions take less than one
+func microseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1000
+}
+
+// summarizeLatencies fills a phase's latency and throughput figures and
+// judges them against its budget
+func summarizeLatencies(phase *BenchmarkPhase, latencies []time.Duration, elapsed time.Duration) {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	phase.Requests = len(latencies)
+	phase.DurationMs = elapsed.Milliseconds()
+	if elapsed > 0 {
+		phase.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	}
+	phase.P50US = microseconds(percentile(sorted, 0.50))
+	phase.P99US = microseconds(percentile(sorted, 0.99))
+	if len(sorted) > 0 {
+		phase.MaxUS = microseconds(sorted[len(sorted)-1])
+	}
+
+	phase.Status = "pass"
+	switch {
+	case phase.P99US > float64(phase.P99BudgetUS):
+		phase.Status = "fail"
+		phase.Detail = fmt.Sprintf("p99 %.1fµs is over the %dµs budget", phase.P99US, phase.P99BudgetUS)
+	case phase.Throughput < phase.MinThroughput:
+		phase.Status = "fail"
+		phase.Detail = fmt.Sprintf("%.0f requests/s is under the %.0f requests/s target", phase.Throughput, phase.MinThroughput)
+	}
+}
+
+// benchmarkDecisions sends synthetic requests through the blocking
+// middleware of the live blocklist. Each IP gets a country in turn, so
+// blocked countries are hit at their share of all countries. The location
+// is given to the middleware, so the rule indexes are timed without geo
+// lookups, reputation lookups or the decision log.
+func benchmarkDecisions(ctx context.Context, req BenchmarkRequest) BenchmarkPhase {
+	phase := BenchmarkPhase{
+		Name:          "decisions",
+		P99BudgetUS:   req.P99BudgetUS,
+		MinThroughput: req.MinThroughput,
+		Decisions:     make(map[string]int),
+	}
+
+	countries := getAllCountryCodes()
+	requests := make([]*http.Request, req.IPs)
+	for i := range requests {
+		ip := benchmarkIP(i)
+		r := httptest.NewRequest("GET", "/api/v1/test-access", nil)
+		r.RemoteAddr = net.JoinHostPort(ip, "0")
+		geo := geoblock.RequestGeo{ClientIP: ip, ActualIP: ip, Country: countries[i%len(countries)]}
+		requests[i] = r.WithContext(geoblock.ContextWithGeo(ctx, geo))
+	}
+
+	counts := make(map[string]*atomic.Int64)
+	for _, name := range []string{"allow", "block", "challenge", "monitor", "exempt"} {
+		counts[name] = new(atomic.Int64)
+	}
+	options := []geoblock.Option{
+		geoblock.WithCountryNames(func(code string) string {
+			name, _ := getCountryName(code)
+			return name
+		}),
+		geoblock.WithDecisionHook(func(r *http.Request, decision geoblock.Decision) {
+			counts[benchmarkDecision(decision)].Add(1)
+		}),
+	}
+	if geoFailClosed {
+		options = append(options, geoblock.WithFailClosed())
+	}
+	options = append(options, challengeOptions()...)
+	handler := geoblock.New(blocklist, nil, options...).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	latencies, elapsed := timeConcurrently(ctx, req.Requests, req.Concurrency, func(i int) {
+		handler(&discardResponseWriter{header: make(http.Header)}, requests[i%len(requests)])
+	})
+	summarizeLatencies(&phase, latencies, elapsed)
+	for name, count := range counts {
+		if n := count.Load(); n > 0 {
+			phase.Decisions[name] = int(n)
+		}
+	}
+	return phase
+}
+
+// benchmarkGeoCache times lookups of the synthetic IPs in the shared geo
+// cache. They are reads of addresses nobody uses, so the cache is left as is.
+func benchmarkGeoCache(ctx context.Context, req BenchmarkRequest) BenchmarkPhase {
+	phase := BenchmarkPhase{Name: "geo_cache", P99BudgetUS: req.GeoCacheP99BudgetUS}
+	cache := geoResolver.Cache
+	if cache == nil {
+		phase.Status = "skipped"
+		phase.Detail = "no shared geo cache configured (REDIS_URL)"
+		return phase
+	}
+
+	latencies, elapsed := timeConcurrently(ctx, req.Requests, req.Concurrency, func(i int) {
+		cache.Get(ctx, benchmarkIP(i%req.IPs))
+	})
+	summarizeLatencies(&phase, latencies, elapsed)
+	return phase
+}
+
+// normalizeBenchmarkRequest applies defaults and limits to a request
+func normalizeBenchmarkRequest(req *BenchmarkRequest) error {
+	if req.Requests == 0 {
+		req.Requests = defaultBenchmarkRequests
+	}
+	if req.IPs == 0 {
+		req.IPs = min(defaultBenchmarkIPs, req.Requests)
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if req.P99BudgetUS == 0 {
+		req.P99BudgetUS = benchmarkDecisionBudget.Microseconds()
+	}
+	if req.MinThroughput == 0 {
+		req.MinThroughput = benchmarkMinThroughput
+	}
+	if req.GeoCacheP99BudgetUS == 0 {
+		req.GeoCacheP99BudgetUS = benchmarkGeoCacheBudget.Microseconds()
+	}
+
+	switch {
+	case req.Requests < 0 || req.Requests > maxBenchmarkRequests:
+		return fmt.Errorf("requests must be between 1 and %d", maxBenchmarkRequests)
+	case req.IPs < 0 || req.IPs > req.Requests || req.IPs > maxBenchmarkIPs:
+		return fmt.Errorf("ips must be between 1 and the number of requests, at most %d", maxBenchmarkIPs)
+	case req.Concurrency < 0 || req.Concurrency > maxBenchmarkConcurrency:
+		return fmt.Errorf("concurrency must be between 1 and %d", maxBenchmarkConcurrency)
+	case req.P99BudgetUS < 0 || req.GeoCacheP99BudgetUS < 0 || req.MinThroughput < 0:
+		return fmt.Errorf("budgets must not be negative")
+	}
+	return nil
+}
+
+// handleBenchmark measures the blocking middleware's decision throughput
+// and p99 latency over synthetic IPs, and how fast the shared geo cache
+// answers, reporting whether each meets its budget
+func handleBenchmark(w http.ResponseWriter, r *http.Request) {
+	var req BenchmarkRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := normalizeBenchmarkRequest(&req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !benchmarkMu.TryLock() {
+		writeError(w, r, "A benchmark is already running", http.StatusConflict)
+		return
+	}
+	defer benchmarkMu.Unlock()
+
+	fmt.Printf("⏱️  Benchmarking %d decisions over %d synthetic IPs on %d workers\n", req.Requests, req.IPs, req.Concurrency)
+	response := BenchmarkResponse{
+		Passed:      true,
+		Requests:    req.Requests,
+		IPs:         req.IPs,
+		Concurrency: req.Concurrency,
+		StartedAt:   time.Now().Format(time.RFC3339),
+	}
+	for _, run := range []func(context.Context, BenchmarkRequest) BenchmarkPhase{benchmarkDecisions, benchmarkGeoCache} {
+		phase := run(r.Context(), req)
+		if phase.Status == "fail" {
+			response.Passed = false
+		}
+		if phase.Status == "skipped" {
+			fmt.Printf("⏱️  %s: skipped, %s\n", phase.Name, phase.Detail)
+		} else {
+			fmt.Printf("⏱️  %s: %s, %.0f/s, p99 %.1fµs (budget %dµs)\n", phase.Name, phase.Status, phase.Throughput, phase.P99US, phase.P99BudgetUS)
+		}
+		response.Phases = append(response.Phases, phase)
+	}
+	if err := r.Context().Err(); err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNormalizeBenchmarkRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     BenchmarkRequest
+		wantErr bool
+		wantIPs int
+	}{
+		{"defaults", BenchmarkRequest{}, false, defaultBenchmarkIPs},
+		{"fewer requests than default IPs", BenchmarkRequest{Requests: 10}, false, 10},
+		{"too many requests", BenchmarkRequest{Requests: maxBenchmarkRequests + 1}, true, 0},
+		{"more IPs than requests", BenchmarkRequest{Requests: 10, IPs: 20}, true, 0},
+		{"negative concurrency", BenchmarkRequest{Concurrency: -1}, true, 0},
+		{"negative budget", BenchmarkRequest{P99BudgetUS: -5}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			err := normalizeBenchmarkRequest(&req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeBenchmarkRequest() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && req.IPs != tt.wantIPs {
+				t.Errorf("IPs = %d, want %d", req.IPs, tt.wantIPs)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Microsecond
+	}
+	if got := percentile(sorted, 0.99); got != 99*time.Microsecond {
+		t.Errorf("p99 = %v, want 99µs", got)
+	}
+	if got := percentile(sorted, 0.50); got != 50*time.Microsecond {
+		t.Errorf("p50 = %v, want 50µs", got)
+	}
+	if got := percentile(nil, 0.99); got != 0 {
+		t.Errorf("p99 of nothing = %v", got)
+	}
+}
+
+func TestBenchmarkIP(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < maxBenchmarkIPs; i++ {
+		seen[benchmarkIP(i)] = true
+	}
+	if len(seen) != maxBenchmarkIPs {
+		t.Errorf("%d distinct IPs, want %d", len(seen), maxBenchmarkIPs)
+	}
+	if got := benchmarkIP(maxBenchmarkIPs - 1); got != "198.19.255.255" {
+		t.Errorf("last IP = %s", got)
+	}
+}
+
+func TestBenchmarkDecisions(t *testing.T) {
+	req := BenchmarkRequest{Requests: 500, IPs: 250, Concurrency: 4}
+	if err := normalizeBenchmarkRequest(&req); err != nil {
+		t.Fatal(err)
+	}
+	phase := benchmarkDecisions(context.Background(), req)
+	total := 0
+	for _, n := range phase.Decisions {
+		total += n
+	}
+	if total != req.Requests || phase.Requests != req.Requests {
+		t.Errorf("%d decisions for %d requests, want %d", total, phase.Requests, req.Requests)
+	}
+	if phase.P99US > phase.MaxUS || phase.P50US > phase.P99US {
+		t.Errorf("latencies out of order: %+v", phase)
+	}
+}
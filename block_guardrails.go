@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Guardrails on a single blocklist update, so a typo or a pasted list does
+// not cut off most customers. Each is off when its limit is 0.
+var (
+	// maxNewlyBlockedCountries caps the countries one update may add
+	maxNewlyBlockedCountries = getEnvInt("MAX_BLOCKED_COUNTRIES_PER_UPDATE", 25)
+
+	// maxNewlyBlockedTrafficPercent caps the share of recent traffic, per
+	// the traffic analytics, coming from the countries one update adds
+	maxNewlyBlockedTrafficPercent = getEnvFloat("MAX_BLOCKED_TRAFFIC_PERCENT", 20)
+
+	// blockGuardrailWindow is the traffic window the share is measured over
+	blockGuardrailWindow = getEnvDuration("BLOCK_GUARDRAIL_WINDOW", 24*time.Hour)
+
+	// blockGuardrailReject refuses updates past a guardrail unless they have
+	// ?override=true; with BLOCK_GUARDRAIL_MODE=warn they are applied with a warning
+	blockGuardrailReject = getEnv("BLOCK_GUARDRAIL_MODE", "reject") != "warn"
+)
+
+// blockGuardrailMinRequests is the least traffic the share is judged on;
+// below it a handful of requests would decide
+const blockGuardrailMinRequests = 100
+
+// BlockGuardrailViolation is one guardrail a blocklist update exceeds
+type BlockGuardrailViolation struct {
+	Guardrail string  `json:"guardrail"`
+	Limit     float64 `json:"limit"`
+	Value     float64 `json:"value"`
+	Message   string  `json:"message"`
+}
+
+// checkBlockGuardrails compares the countries an update newly blocks, i.e.
+// those in countries but not in blocked, against the guardrails
+func checkBlockGuardrails(blocked, countries []string, traffic []CountryTraffic) []BlockGuardrailViolation {
+	var added []string
+	for _, code := range countries {
+		if !slices.Contains(blocked, code) {
+			added = append(added, code)
+		}
+	}
+
+	var violations []BlockGuardrailViolation
+	if maxNewlyBlockedCountries > 0 && len(added) > maxNewlyBlockedCountries {
+		violations = append(violations, BlockGuardrailViolation{
+			Guardrail: "countries",
+			Limit:     float64(maxNewlyBlockedCountries),
+			Value:     float64(len(added)),
+			Message:   fmt.Sprintf("This update blocks %d more countries; the limit is %d", len(added), maxNewlyBlockedCountries),
+		})
+	}
+
+	total, affected := 0, 0
+	for _, country := range traffic {
+		total += country.Requests
+		if slices.Contains(added, country.CountryCode) {
+			affected += country.Requests
+		}
+	}
+	if maxNewlyBlockedTrafficPercent > 0 && total >= blockGuardrailMinRequests {
+		if percent := float64(affected) * 100 / float64(total); percent > maxNewlyBlockedTrafficPercent {
+			violations = append(violations, BlockGuardrailViolation{
+				Guardrail: "traffic",
+				Limit:     maxNewlyBlockedTrafficPercent,
+				Value:     percent,
+				Message:   fmt.Sprintf("This update blocks %.1f%% of recent traffic; the limit is %g%%", percent, maxNewlyBlockedTrafficPercent),
+			})
+		}
+	}
+	return violations
+}
+
+// checkCorrectionGuardrails compares the clients a geo correction newly
+// blocks, i.e. the affected of all recent distinct IPs, against the traffic
+// guardrail. It counts clients rather than requests, which the traffic
+// analytics keep per country only.
+func checkCorrectionGuardrails(affected, total int) []BlockGuardrailViolation {
+	if maxNewlyBlockedTrafficPercent <= 0 || total < blockGuardrailMinRequests {
+		return nil
+	}
+	percent := float64(affected) * 100 / float64(total)
+	if percent <= maxNewlyBlockedTrafficPercent {
+		return nil
+	}
+	return []BlockGuardrailViolation{{
+		Guardrail: "traffic",
+		Limit:     maxNewlyBlockedTrafficPercent,
+		Value:     percent,
+		Message:   fmt.Sprintf("This correction blocks %.1f%% of recent clients; the limit is %g%%", percent, maxNewlyBlockedTrafficPercent),
+	}}
+}
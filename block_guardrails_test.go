@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestCheckBlockGuardrails(t *testing.T) {
+	traffic := []CountryTraffic{
+		{CountryCode: "US", Requests: 700},
+		{CountryCode: "DE", Requests: 200},
+		{CountryCode: "RU", Requests: 100},
+	}
+	many := []string{"RU"}
+	for _, code := range []string{"AF", "AL", "AM", "AO", "AR", "AZ", "BA", "BD", "BF", "BI", "BJ", "BO", "BY", "CD", "CF", "CG", "CI", "CM", "CU", "DZ", "EG", "ER", "ET", "GA", "GH"} {
+		many = append(many, code)
+	}
+
+	tests := []struct {
+		name      string
+		blocked   []string
+		countries []string
+		traffic   []CountryTraffic
+		want      []string
+	}{
+		{"small update", nil, []string{"RU"}, traffic, nil},
+		{"too much traffic", nil, []string{"RU", "DE"}, traffic, []string{"traffic"}},
+		{"already blocked", []string{"DE"}, []string{"RU", "DE"}, traffic, nil},
+		{"too many countries", nil, many, traffic, []string{"countries"}},
+		{"too little traffic to judge", nil, []string{"DE"}, []CountryTraffic{{CountryCode: "DE", Requests: 10}}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, violation := range checkBlockGuardrails(tt.blocked, tt.countries, tt.traffic) {
+			got = append(got, violation.Guardrail)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("%s: guardrails = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCorrectionGuardrails(t *testing.T) {
+	tests := []struct {
+		name            string
+		affected, total int
+		want            int
+	}{
+		{"few clients", 5, 1000, 0},
+		{"too many clients", 300, 1000, 1},
+		{"too few clients to judge", 50, 60, 0},
+	}
+	for _, tt := range tests {
+		if got := checkCorrectionGuardrails(tt.affected, tt.total); len(got) != tt.want {
+			t.Errorf("%s: %d violations, want %d", tt.name, len(got), tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// challengeVerifyPath receives solved CAPTCHA tokens from the challenge page
+const challengeVerifyPath = "/api/v1/challenge"
+
+// challengeSecret signs the cookies of clients that passed a challenge;
+// replicas need the same CHALLENGE_SECRET to honor each other's
+var challengeSecret = getEnv("CHALLENGE_SECRET", "")
+
+// challengeProvider is the CAPTCHA shown to challenged clients, or nil for
+// the built-in JavaScript check
+var challengeProvider = newChallengeProvider()
+
+// newChallengeProvider reads CHALLENGE_PROVIDER (turnstile or hcaptcha) and
+// the provider's site key and secret
+func newChallengeProvider() geoblock.ChallengeProvider {
+	name := strings.ToLower(getEnv("CHALLENGE_PROVIDER", ""))
+	switch name {
+	case "":
+		return nil
+	case "turnstile":
+		siteKey, secret := getEnv("TURNSTILE_SITE_KEY", ""), getEnv("TURNSTILE_SECRET_KEY", "")
+		if siteKey == "" || secret == "" {
+			fmt.Println("⚠️  Using the built-in challenge: TURNSTILE_SITE_KEY and TURNSTILE_SECRET_KEY are required for turnstile")
+			return nil
+		}
+		turnstile := geoblock.NewTurnstile(siteKey, secret)
+		turnstile.SetHTTPClient(newHTTPClient(10 * time.Second))
+		return turnstile
+	case "hcaptcha":
+		siteKey, secret := getEnv("HCAPTCHA_SITE_KEY", ""), getEnv("HCAPTCHA_SECRET", "")
+		if siteKey == "" || secret == "" {
+			fmt.Println("⚠️  Using the built-in challenge: HCAPTCHA_SITE_KEY and HCAPTCHA_SECRET are required for hcaptcha")
+			return nil
+		}
+		hcaptcha := geoblock.NewHCaptcha(siteKey, secret)
+		hcaptcha.SetHTTPClient(newHTTPClient(10 * time.Second))
+		return hcaptcha
+	default:
+		fmt.Printf("⚠️  Unknown CHALLENGE_PROVIDER %q, using the built-in challenge\n", name)
+		return nil
+	}
+}
+
+// challengeOptions configures how the Blocker challenges clients
+func challengeOptions() []geoblock.Option {
+	var options []geoblock.Option
+	if challengeSecret != "" {
+		options = append(options, geoblock.WithChallengeSecret([]byte(challengeSecret)))
+	}
+	if challengeProvider != nil {
+		options = append(options, geoblock.WithChallengeProvider(challengeProvider, challengeVerifyPath))
+	}
+	return options
+}
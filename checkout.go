@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// What happens to an order shipped to a blocked country, set by
+// ORDER_BLOCKING
+const (
+	orderBlockingOff    = "off"
+	orderBlockingFlag   = "flag"
+	orderBlockingCancel = "cancel"
+)
+
+// orderBlocking acts on orders whose shipping address is in a blocked
+// country, as reported by the orders/create webhook: "flag" adds a high-risk
+// assessment for staff to review before fulfilling, "cancel" cancels,
+// refunds and restocks the order. Blocking client IPs alone does not stop an
+// order placed through a proxy and shipped to a blocked country.
+var orderBlocking = loadOrderBlocking()
+
+func loadOrderBlocking() string {
+	mode := getEnv("ORDER_BLOCKING", orderBlockingOff)
+	switch mode {
+	case orderBlockingOff, orderBlockingFlag, orderBlockingCancel:
+		return mode
+	}
+	fmt.Printf("⚠️  Unknown ORDER_BLOCKING %q, orders are not checked\n", mode)
+	return orderBlockingOff
+}
+
+// checkoutBlockedMessage is shown at checkout for a blocked shipping
+// country; %s is the country name
+var checkoutBlockedMessage = getEnv("CHECKOUT_BLOCKED_MESSAGE", "We can't ship orders to %s.")
+
+// orderActionTimeout leaves the webhook time to reply within the five
+// seconds Shopify waits before retrying
+const orderActionTimeout = 4 * time.Second
+
+// ShopifyOrderAddress is an order's shipping or billing address
+type ShopifyOrderAddress struct {
+	CountryCode string `json:"country_code"`
+}
+
+// ShopifyOrder is the part of the orders/create webhook payload that is checked
+type ShopifyOrder struct {
+	ID              int64                `json:"id"`
+	AdminGraphQLID  string               `json:"admin_graphql_api_id"`
+	Name            string               `json:"name"`
+	BrowserIP       string               `json:"browser_ip"`
+	ShippingAddress *ShopifyOrderAddress `json:"shipping_address"`
+	BillingAddress  *ShopifyOrderAddress `json:"billing_address"`
+	ClientDetails   *struct {
+		BrowserIP string `json:"browser_ip"`
+	} `json:"client_details"`
+}
+
+// shippingCountry is the order's shipping country, or "" for orders that
+// are not shipped, such as digital goods
+func (o ShopifyOrder) shippingCountry() string {
+	return o.ShippingAddress.country()
+}
+
+// billingCountry is the order's billing country, if it has a billing address
+func (o ShopifyOrder) billingCountry() string {
+	return o.BillingAddress.country()
+}
+
+// browserIP is the IP address the order was placed from, if Shopify knows it
+func (o ShopifyOrder) browserIP() string {
+	if o.BrowserIP == "" && o.ClientDetails != nil {
+		return o.ClientDetails.BrowserIP
+	}
+	return o.BrowserIP
+}
+
+func (a *ShopifyOrderAddress) country() string {
+	if a == nil {
+		return ""
+	}
+	return strings.ToUpper(a.CountryCode)
+}
+
+// orderAction decides what to do with an order given the blocklist: one of
+// the ORDER_BLOCKING modes, or "monitor" when the country is only monitored
+func orderAction(store *geoblock.Store, country, mode string) string {
+	if country == "" || mode == orderBlockingOff {
+		return orderBlockingOff
+	}
+	switch handling := countryHandling(store, country); {
+	case rejects(handling):
+		return mode
+	case handling == "monitor":
+		return "monitor"
+	}
+	return orderBlockingOff
+}
+
+// handleOrderCreated flags or cancels an order shipped to a blocked country,
+// and annotates the orders it leaves alone whose IP country diverges from
+// their addresses into a blocked country. A failed Shopify call answers 502,
+// so Shopify delivers the webhook again.
+func handleOrderCreated(w http.ResponseWriter, r *http.Request, body []byte) {
+	var order ShopifyOrder
+	if err := json.Unmarshal(body, &order); err != nil || order.AdminGraphQLID == "" {
+		writeError(w, r, "Invalid order webhook payload", http.StatusBadRequest)
+		return
+	}
+	country := order.shippingCountry()
+	action := orderAction(blocklist, country, orderBlocking)
+
+	ctx, cancel := context.WithTimeout(r.Context(), orderActionTimeout)
+	defer cancel()
+	var err error
+	switch action {
+	case orderBlockingFlag:
+		err = flagOrder(ctx, order, country)
+	case orderBlockingCancel:
+		err = cancelOrder(ctx, order)
+	default:
+		if orderRiskAnnotation {
+			err = annotateOrderRisk(ctx, order)
+		}
+	}
+	if err != nil {
+		fmt.Printf("❌ Could not process order %s shipped to %s: %v\n", order.Name, country, err)
+		writeError(w, r, fmt.Sprintf("Order processing failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	if action == orderBlockingOff {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	recordSystemAudit("block-order", map[string]interface{}{
+		"order_id": order.ID,
+		"order":    order.Name,
+		"country":  country,
+		"action":   action,
+	})
+	fmt.Printf("🛒 Order %s ships to blocked country %s: %s\n", order.Name, country, action)
+	w.WriteHeader(http.StatusOK)
+}
+
+// flagOrder adds a high-risk assessment to an order shipped to a blocked country
+func flagOrder(ctx context.Context, order ShopifyOrder, country string) error {
+	name, _ := getCountryName(country)
+	return createOrderRiskAssessment(ctx, order, "HIGH", []string{
+		fmt.Sprintf("Shipping address is in %s (%s), which is geo-blocked", name, country),
+	})
+}
+
+// createOrderRiskAssessment adds a risk assessment with negative facts to an
+// order through the Order Risk API. Delivering it twice only adds the same
+// assessment twice.
+func createOrderRiskAssessment(ctx context.Context, order ShopifyOrder, level string, facts []string) error {
+	inputFacts := make([]map[string]string, 0, len(facts))
+	for _, fact := range facts {
+		inputFacts = append(inputFacts, map[string]string{"description": fact, "sentiment": "NEGATIVE"})
+	}
+	var result struct {
+		OrderRiskAssessmentCreate struct {
+			UserErrors []struct {
+				Message string `json:"message"`
+			} `json:"userErrors"`
+		} `json:"orderRiskAssessmentCreate"`
+	}
+	err := shopifyGraphQL(ctx, shopifyToken(currentShopifyConfig.APIKey), `mutation FlagOrder($input: OrderRiskAssessmentCreateInput!) {
+  orderRiskAssessmentCreate(orderRiskAssessmentInput: $input) { userErrors { message } }
+}`, map[string]interface{}{
+		"input": map[string]interface{}{
+			"orderId":   order.AdminGraphQLID,
+			"riskLevel": level,
+			"facts":     inputFacts,
+		},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if errs := result.OrderRiskAssessmentCreate.UserErrors; len(errs) > 0 {
+		return fmt.Errorf("%s", errs[0].Message)
+	}
+	return nil
+}
+
+// cancelOrder cancels an order, refunding and restocking it and notifying
+// the customer
+func cancelOrder(ctx context.Context, order ShopifyOrder) error {
+	var result struct {
+		OrderCancel struct {
+			UserErrors []struct {
+				Message string `json:"message"`
+			} `json:"orderCancelUserErrors"`
+		} `json:"orderCancel"`
+	}
+	err := shopifyGraphQL(ctx, shopifyToken(currentShopifyConfig.APIKey), `mutation CancelOrder($orderId: ID!) {
+  orderCancel(orderId: $orderId, reason: OTHER, refund: true, restock: true, notifyCustomer: true, staffNote: "Ships to a geo-blocked country") {
+    orderCancelUserErrors { message }
+  }
+}`, map[string]interface{}{"orderId": order.AdminGraphQLID}, &result)
+	if err != nil {
+		return err
+	}
+	if errs := result.OrderCancel.UserErrors; len(errs) > 0 {
+		return fmt.Errorf("%s", errs[0].Message)
+	}
+	return nil
+}
+
+// CheckoutValidationInput is the input of a Shopify cart and checkout
+// validation function, as far as it is checked here
+type CheckoutValidationInput struct {
+	Cart struct {
+		DeliveryGroups []struct {
+			DeliveryAddress *struct {
+				CountryCode string `json:"countryCode"`
+			} `json:"deliveryAddress"`
+			CartLines []struct {
+				Merchandise struct {
+					Product *struct {
+						ID    string `json:"id"`
+						Title string `json:"title"`
+					} `json:"product"`
+				} `json:"merchandise"`
+			} `json:"cartLines"`
+		} `json:"deliveryGroups"`
+	} `json:"cart"`
+}
+
+// CheckoutValidationError is one error of a validation function's result
+type CheckoutValidationError struct {
+	LocalizedMessage string `json:"localizedMessage"`
+	Target           string `json:"target"`
+}
+
+// CheckoutValidationResult is a validation function's result; checkout is
+// blocked while it has errors
+type CheckoutValidationResult struct {
+	Errors []CheckoutValidationError `json:"errors"`
+}
+
+// validateCheckout reports every delivery address in a blocked country and,
+// if restrictions is set, every product restricted in the country it is
+// delivered to. Monitored countries are allowed.
+func validateCheckout(store *geoblock.Store, restrictions *ProductRestrictions, input CheckoutValidationInput) CheckoutValidationResult {
+	result := CheckoutValidationResult{Errors: []CheckoutValidationError{}}
+	for i, group := range input.Cart.DeliveryGroups {
+		if group.DeliveryAddress == nil || group.DeliveryAddress.CountryCode == "" {
+			continue
+		}
+		country := strings.ToUpper(group.DeliveryAddress.CountryCode)
+		name, ok := getCountryName(country)
+		if !ok {
+			name = country
+		}
+		if rejects(countryHandling(store, country)) {
+			result.Errors = append(result.Errors, CheckoutValidationError{
+				LocalizedMessage: fmt.Sprintf(checkoutBlockedMessage, name),
+				Target:           fmt.Sprintf("$.cart.deliveryGroups[%d].deliveryAddress.countryCode", i),
+			})
+			continue
+		}
+		if restrictions == nil {
+			continue
+		}
+		for j, line := range group.CartLines {
+			product := line.Merchandise.Product
+			if product == nil || restrictions.Restriction(parseShopifyID(product.ID), country) == nil {
+				continue
+			}
+			result.Errors = append(result.Errors, CheckoutValidationError{
+				LocalizedMessage: fmt.Sprintf(productRestrictedMessage, product.Title, name),
+				Target:           fmt.Sprintf("$.cart.deliveryGroups[%d].cartLines[%d]", i, j),
+			})
+		}
+	}
+	return result
+}
+
+// handleCheckoutValidation answers a cart and checkout validation function
+// with network access, which forwards its input here and returns the
+// response as its result. Functions without network access read the
+// blocklist from the storefront metafield instead.
+func handleCheckoutValidation(w http.ResponseWriter, r *http.Request) {
+	var input CheckoutValidationInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookSize)).Decode(&input); err != nil {
+		writeError(w, r, "Invalid validation function input", http.StatusBadRequest)
+		return
+	}
+
+	var restrictions *ProductRestrictions
+	if productRestrictionsEnabled {
+		restrictions = productRestrictions
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(validateCheckout(blocklist, restrictions, input))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func checkoutTestStore(t *testing.T) *geoblock.Store {
+	t.Helper()
+	store := geoblock.NewStore()
+	_, err := store.ReplacePolicy(&geoblock.Policy{
+		BlockedCountries: []string{"RU"},
+		Rules:            []geoblock.Rule{{ID: "watch", Countries: []string{"BR"}, Monitor: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestOrderAction(t *testing.T) {
+	store := checkoutTestStore(t)
+	tests := []struct {
+		country string
+		mode    string
+		want    string
+	}{
+		{"RU", orderBlockingFlag, orderBlockingFlag},
+		{"RU", orderBlockingCancel, orderBlockingCancel},
+		{"RU", orderBlockingOff, orderBlockingOff},
+		{"BR", orderBlockingCancel, "monitor"},
+		{"FR", orderBlockingCancel, orderBlockingOff},
+		{"", orderBlockingCancel, orderBlockingOff},
+	}
+	for _, tt := range tests {
+		if got := orderAction(store, tt.country, tt.mode); got != tt.want {
+			t.Errorf("orderAction(%q, %q) = %q, want %q", tt.country, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCheckout(t *testing.T) {
+	var input CheckoutValidationInput
+	err := json.Unmarshal([]byte(`{"cart": {"deliveryGroups": [
+		{"deliveryAddress": {"countryCode": "FR"}},
+		{"deliveryAddress": null},
+		{"deliveryAddress": {"countryCode": "ru"}},
+		{"deliveryAddress": {"countryCode": "BR"}}
+	]}}`), &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := validateCheckout(checkoutTestStore(t), nil, input)
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %+v, want one", result.Errors)
+	}
+	if result.Errors[0].Target != "$.cart.deliveryGroups[2].deliveryAddress.countryCode" {
+		t.Errorf("target = %q", result.Errors[0].Target)
+	}
+	if !strings.Contains(result.Errors[0].LocalizedMessage, "Russia") {
+		t.Errorf("message = %q, want the country name", result.Errors[0].LocalizedMessage)
+	}
+}
+
+func TestOrderWebhook(t *testing.T) {
+	secret := shopifyAPISecret
+	defer func() { shopifyAPISecret = secret }()
+	shopifyAPISecret = "webhook-secret"
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"not shipped to a blocked country", `{"id": 1, "admin_graphql_api_id": "gid://shopify/Order/1", "name": "#1001", "shipping_address": {"country_code": "FR"}}`, http.StatusOK},
+		{"not shipped", `{"id": 2, "admin_graphql_api_id": "gid://shopify/Order/2", "name": "#1002"}`, http.StatusOK},
+		{"missing order id", `{"name": "#1003"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/webhooks/shopify", strings.NewReader(tt.body))
+			req.Header.Set("X-Shopify-Topic", "orders/create")
+			req.Header.Set("X-Shopify-Hmac-Sha256", signWebhook("webhook-secret", tt.body))
+			recorder := httptest.NewRecorder()
+			handleShopifyWebhook(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// customerPageSize is the largest page of customers the server returns
+const customerPageSize = 1000
+
+// BlockCountries replaces the blocked countries. Codes may be alpha-2 or
+// alpha-3 codes, country names or country group IDs such as "eu".
+func (c *Client) BlockCountries(ctx context.Context, countries []string) (*BlockingResponse, error) {
+	var resp BlockingResponse
+	if err := c.do(ctx, http.MethodPost, "/block-countries", BlockingRequest{Countries: countries}, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BlockedCountries returns the countries blocked by the policy, not
+// counting those of block rules
+func (c *Client) BlockedCountries(ctx context.Context) ([]string, error) {
+	var policy struct {
+		BlockedCountries []string `json:"blocked_countries"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/block-countries/export?format=json", nil, &policy, true); err != nil {
+		return nil, err
+	}
+	return policy.BlockedCountries, nil
+}
+
+// BlockCountry adds a country to the blocked countries
+func (c *Client) BlockCountry(ctx context.Context, country string) (*BlockingResponse, error) {
+	var resp BlockingResponse
+	if err := c.do(ctx, http.MethodPut, "/block-countries/"+url.PathEscape(country), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UnblockCountry removes a country from the blocked countries
+func (c *Client) UnblockCountry(ctx context.Context, country string) (*BlockingResponse, error) {
+	var resp BlockingResponse
+	if err := c.do(ctx, http.MethodDelete, "/block-countries/"+url.PathEscape(country), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ValidateBlocking reports how requests from testCountries would be handled
+// if blockedCountries were blocked, without changing the blocklist
+func (c *Client) ValidateBlocking(ctx context.Context, blockedCountries, testCountries []string) (*ValidationResponse, error) {
+	req := ValidationRequest{BlockedCountries: blockedCountries, TestCountries: testCountries}
+	var resp ValidationResponse
+	if err := c.do(ctx, http.MethodPost, "/validate-blocking", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// IPInfo returns the caller's IP address and country as the server sees them
+func (c *Client) IPInfo(ctx context.Context) (*IPInfo, error) {
+	var resp IPInfo
+	if err := c.do(ctx, http.MethodGet, "/ip-info", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Job returns a job's status. Customers of a fetch-customers result are
+// paged by query, e.g. url.Values{"limit": {"100"}}.
+func (c *Client) Job(ctx context.Context, id string, query url.Values) (*Job, error) {
+	path := "/jobs/" + url.PathEscape(id)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var job Job
+	if err := c.do(ctx, http.MethodGet, path, nil, &job, true); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FetchCustomers has the server fetch a shop's customers, waits for the job
+// to finish and returns every customer, reading the result page by page.
+// The returned Page is that of the last page read.
+func (c *Client) FetchCustomers(ctx context.Context, req CustomerRequest) (*CustomerResponse, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodPost, "/customers", req, &job, false); err != nil {
+		return nil, err
+	}
+
+	var result CustomerResponse
+	query := url.Values{"limit": {fmt.Sprint(customerPageSize)}}
+	for offset := 0; ; {
+		query.Set("offset", fmt.Sprint(offset))
+		page, err := c.waitForJob(ctx, job.ID, query)
+		if err != nil {
+			return nil, err
+		}
+		var response CustomerResponse
+		if err := json.Unmarshal(page.Result, &response); err != nil {
+			return nil, fmt.Errorf("decode job %s result: %w", job.ID, err)
+		}
+		customers := append(result.CustomerCountries, response.CustomerCountries...)
+		result = response
+		result.CustomerCountries = customers
+		if response.Page == nil || response.Page.NextOffset == nil {
+			return &result, nil
+		}
+		offset = *response.Page.NextOffset
+	}
+}
+
+// waitForJob polls a job until it has finished, returning an error if it failed
+func (c *Client) waitForJob(ctx context.Context, id string, query url.Values) (*Job, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id, query)
+		if err != nil {
+			return nil, err
+		}
+		switch job.Status {
+		case "succeeded":
+			return job, nil
+		case "failed":
+			return nil, errors.New("job " + id + " failed: " + job.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
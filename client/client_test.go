@@ -0,0 +1,217 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBlockCountries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/block-countries" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var req BlockingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(BlockingResponse{Success: true, BlockedCountries: req.Countries})
+	}))
+	defer server.Close()
+
+	resp, err := New(server.URL+"/", WithToken("secret")).BlockCountries(context.Background(), []string{"KP", "IR"})
+	if err != nil {
+		t.Fatalf("BlockCountries: %v", err)
+	}
+	if !resp.Success || !reflect.DeepEqual(resp.BlockedCountries, []string{"KP", "IR"}) {
+		t.Errorf("BlockCountries() = %+v", resp)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		call         func(*Client) error
+		wantAttempts int32
+		wantStatus   int
+	}{
+		{
+			name:         "idempotent call retried on 503",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			call:         func(c *Client) error { _, err := c.IPInfo(context.Background()); return err },
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after max retries",
+			statuses:     []int{503, 503, 503, 503, 503},
+			call:         func(c *Client) error { _, err := c.IPInfo(context.Background()); return err },
+			wantAttempts: 3,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name:     "client errors are not retried",
+			statuses: []int{http.StatusBadRequest, http.StatusOK},
+			call: func(c *Client) error {
+				_, err := c.ValidateBlocking(context.Background(), nil, []string{"XX"})
+				return err
+			},
+			wantAttempts: 1,
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:     "fetch not retried on 503",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusAccepted},
+			call: func(c *Client) error {
+				_, err := c.FetchCustomers(context.Background(), CustomerRequest{ShopURL: "shop"})
+				return err
+			},
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name:     "fetch retried on 429",
+			statuses: []int{http.StatusTooManyRequests, http.StatusBadRequest},
+			call: func(c *Client) error {
+				_, err := c.FetchCustomers(context.Background(), CustomerRequest{ShopURL: "shop"})
+				return err
+			},
+			wantAttempts: 2,
+			wantStatus:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[attempts.Add(1)-1]
+				if status != http.StatusOK {
+					w.WriteHeader(status)
+					json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": "failed", "message": "nope", "request_id": "req-1"}})
+					return
+				}
+				json.NewEncoder(w).Encode(IPInfo{IP: "203.0.113.7"})
+			}))
+			defer server.Close()
+
+			err := tt.call(New(server.URL, WithRetries(2, time.Millisecond)))
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			var apiErr *APIError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("error = %v, want none", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus):
+				t.Errorf("error = %v, want APIError %d", err, tt.wantStatus)
+			case apiErr != nil && (apiErr.Code != "failed" || apiErr.RequestID != "req-1"):
+				t.Errorf("APIError = %+v, want code and request ID from the envelope", apiErr)
+			}
+		})
+	}
+}
+
+func TestFetchCustomers(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/customers":
+			var req CustomerRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.ShopURL != "shop.myshopify.com" {
+				t.Errorf("request = %+v", req)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(Job{ID: "job-1", Status: "queued"})
+		case r.URL.Path == "/api/v1/jobs/job-1":
+			if polls.Add(1) == 1 {
+				json.NewEncoder(w).Encode(Job{ID: "job-1", Status: "running"})
+				return
+			}
+			result := CustomerResponse{TotalCustomers: 2, Page: &CustomerPage{Offset: 1}}
+			if r.URL.Query().Get("offset") == "0" {
+				next := 1
+				result.Page = &CustomerPage{NextOffset: &next}
+				result.CustomerCountries = []CustomerCountry{{CustomerName: "Ada"}}
+			} else {
+				result.CustomerCountries = []CustomerCountry{{CustomerName: "Grace"}}
+			}
+			raw, _ := json.Marshal(result)
+			json.NewEncoder(w).Encode(Job{ID: "job-1", Status: "succeeded", Result: raw})
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithPollInterval(time.Millisecond))
+	resp, err := c.FetchCustomers(context.Background(), CustomerRequest{ShopURL: "shop.myshopify.com", APIKey: "token"})
+	if err != nil {
+		t.Fatalf("FetchCustomers: %v", err)
+	}
+	if len(resp.CustomerCountries) != 2 || resp.CustomerCountries[1].CustomerName != "Grace" || resp.TotalCustomers != 2 {
+		t.Errorf("FetchCustomers() = %+v, want both pages", resp)
+	}
+}
+
+func TestFetchCustomersJobFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Job{ID: "job-1", Status: "failed", Error: "shopify unavailable"})
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).FetchCustomers(context.Background(), CustomerRequest{})
+	if err == nil || err.Error() != "job job-1 failed: shopify unavailable" {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestContextCancelStopsRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := New(server.URL).IPInfo(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want deadline exceeded", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("IPInfo waited %v despite the deadline", time.Since(start))
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "event: decision\ndata: {\"decision\":\"block\",\"country_code\":\"KP\"}\n\n")
+		fmt.Fprint(w, "event: decision\ndata: {\"decision\":\"allow\",\"country_code\":\"US\"}\n\n")
+	}))
+	defer server.Close()
+
+	var got []string
+	err := New(server.URL).Events(context.Background(), func(event BlockingEvent) error {
+		got = append(got, event.Decision+" "+event.Country)
+		return nil
+	})
+	if err == nil || err.Error() != "event stream closed by the server" {
+		t.Errorf("Events() error = %v, want the stream to be closed", err)
+	}
+	if !reflect.DeepEqual(got, []string{"block KP", "allow US"}) {
+		t.Errorf("events = %v", got)
+	}
+}
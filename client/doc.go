@@ -0,0 +1,15 @@
+// Package client calls the geo-blocking API from Go services.
+//
+// A Client wraps the v1 HTTP API with typed methods. Every method takes a
+// context, and requests that fail with a network error, 429 or a 502, 503
+// or 504 are retried with exponential backoff, honoring Retry-After:
+//
+//	c := client.New("https://geoblock.example.com", client.WithToken(os.Getenv("GEOBLOCK_TOKEN")))
+//
+//	blocked, err := c.BlockCountries(ctx, []string{"KP", "IR"})
+//	result, err := c.ValidateBlocking(ctx, []string{"KP"}, []string{"KP", "US"})
+//	customers, err := c.FetchCustomers(ctx, client.CustomerRequest{ShopURL: shop, APIKey: token})
+//
+// Errors returned by the API are *APIError values carrying the status, the
+// error code and the request ID to quote when reporting a problem.
+package client
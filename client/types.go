@@ -0,0 +1,222 @@
+package client
+
+import "encoding/json"
+
+// The types below mirror the JSON of the server's request and response
+// bodies; see GET /api/openapi.json for the full API.
+
+// BlockingRequest replaces the blocked countries
+type BlockingRequest struct {
+	Countries []string `json:"countries"`
+}
+
+// BlockingResponse is the blocklist after a change
+type BlockingResponse struct {
+	Message          string               `json:"message"`
+	BlockedCountries []string             `json:"blocked_countries"`
+	Success          bool                 `json:"success"`
+	Storefront       StorefrontSyncStatus `json:"storefront"`
+	Warnings         []string             `json:"warnings,omitempty"`
+}
+
+// StorefrontSyncStatus reports whether the blocklist has reached the storefront
+type StorefrontSyncStatus struct {
+	Enabled         bool     `json:"enabled"`
+	State           string   `json:"state"`
+	Metafield       string   `json:"metafield"`
+	PendingVersion  int      `json:"pending_version,omitempty"`
+	SyncedVersion   int      `json:"synced_version,omitempty"`
+	SyncedCountries []string `json:"synced_countries,omitempty"`
+	LastAttemptAt   string   `json:"last_attempt_at,omitempty"`
+	LastSyncedAt    string   `json:"last_synced_at,omitempty"`
+	LastError       string   `json:"last_error,omitempty"`
+}
+
+// ValidationRequest asks how requests from TestCountries would be handled
+// if BlockedCountries were blocked
+type ValidationRequest struct {
+	BlockedCountries []string `json:"blocked_countries"`
+	TestCountries    []string `json:"test_countries"`
+}
+
+// TestResult is the outcome of a synthetic request from one country.
+// ResponseTime is in milliseconds; ResponseTimeUS has full precision.
+type TestResult struct {
+	Country        string `json:"country"`
+	CountryCode    string `json:"country_code,omitempty"`
+	Blocked        bool   `json:"blocked"`
+	Monitored      bool   `json:"monitored,omitempty"`
+	Challenged     bool   `json:"challenged,omitempty"`
+	Status         string `json:"status"`
+	RuleID         string `json:"rule_id,omitempty"`
+	SimulatedIP    string `json:"simulated_ip,omitempty"`
+	StatusCode     int    `json:"status_code,omitempty"`
+	ResponseTime   int    `json:"response_time"`
+	ResponseTimeUS int64  `json:"response_time_us"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ValidationResponse holds the result for each test country
+type ValidationResponse struct {
+	TestResults []TestResult `json:"test_results"`
+	Summary     struct {
+		BlockedCount   int   `json:"blocked_count"`
+		AllowedCount   int   `json:"allowed_count"`
+		MonitoredCount int   `json:"monitored_count"`
+		InvalidCount   int   `json:"invalid_count"`
+		TotalTests     int   `json:"total_tests"`
+		DurationMs     int64 `json:"duration_ms"`
+	} `json:"summary"`
+}
+
+// IPInfo is the caller's IP address and country as the server sees them
+type IPInfo struct {
+	IP          string `json:"ip"`
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country_name"`
+	City        string `json:"city"`
+	Region      string `json:"region"`
+	ISP         string `json:"isp"`
+
+	// DataSource tells how the country was determined and how fresh it is
+	DataSource GeoDataSource `json:"data_source"`
+}
+
+// GeoDataSource describes the provider or database that determined a
+// country. Kind is database, snapshot, api, cache, correction, consensus
+// or none; databases report their BuildDate and when they were loaded.
+type GeoDataSource struct {
+	Provider    string `json:"provider"`
+	Kind        string `json:"kind"`
+	Database    string `json:"database,omitempty"`
+	BuildDate   string `json:"build_date,omitempty"`
+	RefreshedAt string `json:"refreshed_at,omitempty"`
+}
+
+// CustomerRequest asks the server to fetch a shop's customers. APIKey is the
+// shop's Admin API access token.
+type CustomerRequest struct {
+	ShopURL string `json:"shop_url"`
+	APIKey  string `json:"api_key"`
+
+	// EmailCountryHints adds country hints from email ccTLDs such as .de or .jp
+	EmailCountryHints bool `json:"email_country_hints,omitempty"`
+
+	// VerifyAddresses geocodes each address's city and zip, flagging those
+	// outside the address's country; the server needs GEOCODER
+	VerifyAddresses bool `json:"verify_addresses,omitempty"`
+}
+
+// CustomerResponse is the shop's customers and their countries
+type CustomerResponse struct {
+	TotalCustomers     int                `json:"total_customers"`
+	CustomerCountries  []CustomerCountry  `json:"customer_countries"`
+	UniqueCountries    []string           `json:"unique_countries"`
+	Segments           []CustomerSegment  `json:"segments"`
+	MarketingByCountry []CountryMarketing `json:"marketing_by_country"`
+
+	// Page is the last page fetched; FetchCustomers returns every customer
+	Page *CustomerPage `json:"page,omitempty"`
+}
+
+// CustomerCountry is a customer and the countries of their addresses
+type CustomerCountry struct {
+	CustomerID         int64          `json:"customer_id,omitempty"`
+	CustomerName       string         `json:"customer_name"`
+	CustomerEmail      string         `json:"customer_email"`
+	CountryCodes       []string       `json:"country_codes"`
+	DefaultCountry     string         `json:"default_country"`
+	AddressCount       int            `json:"address_count"`
+	Tags               []string       `json:"tags,omitempty"`
+	AcceptsMarketing   bool           `json:"accepts_marketing"`
+	OrdersCount        int            `json:"orders_count"`
+	TotalSpent         float64        `json:"total_spent"`
+	AddressIssues      []AddressIssue `json:"address_issues,omitempty"`
+	DuplicateAddresses int            `json:"duplicate_addresses,omitempty"`
+	CountryHints       []CountryHint  `json:"country_hints,omitempty"`
+
+	// CustomerHash replaces the ID, name and email when the server minimizes PII
+	CustomerHash string `json:"customer_hash,omitempty"`
+}
+
+// AddressIssue flags an address whose country fields disagree or are unrecognized
+type AddressIssue struct {
+	AddressID int64             `json:"address_id,omitempty"`
+	Problem   string            `json:"problem"`
+	Values    map[string]string `json:"values"`
+	Resolved  string            `json:"resolved,omitempty"`
+}
+
+// CountryHint is a low-confidence country signal, such as an email ccTLD
+type CountryHint struct {
+	CountryCode string `json:"country_code"`
+	Source      string `json:"source"`
+	Confidence  string `json:"confidence"`
+}
+
+// CustomerSegment counts the customers with a tag, by country
+type CustomerSegment struct {
+	Tag           string           `json:"tag"`
+	CustomerCount int              `json:"customer_count"`
+	Countries     []SegmentCountry `json:"countries"`
+}
+
+// SegmentCountry counts a segment's customers with an address in one country
+type SegmentCountry struct {
+	CountryCode   string `json:"country_code"`
+	CustomerCount int    `json:"customer_count"`
+}
+
+// CountryMarketing is the marketing consent of a country's customers
+type CountryMarketing struct {
+	CountryCode         string  `json:"country_code"`
+	CustomerCount       int     `json:"customer_count"`
+	MarketableCustomers int     `json:"marketable_customers"`
+	ConsentRate         float64 `json:"consent_rate"`
+	Blocked             bool    `json:"blocked"`
+}
+
+// CustomerPage describes one page of customers
+type CustomerPage struct {
+	Limit      int  `json:"limit"`
+	Offset     int  `json:"offset"`
+	Matching   int  `json:"matching"`
+	Returned   int  `json:"returned"`
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// Job is a long-running operation on the server, such as a customer fetch
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Principal  string          `json:"principal"`
+	Progress   JobProgress     `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  string          `json:"created_at"`
+	StartedAt  string          `json:"started_at,omitempty"`
+	FinishedAt string          `json:"finished_at,omitempty"`
+}
+
+// JobProgress is what a running job has done so far
+type JobProgress struct {
+	PagesFetched       int    `json:"pages_fetched"`
+	CustomersProcessed int    `json:"customers_processed"`
+	Message            string `json:"message,omitempty"`
+}
+
+// BlockingEvent is a blocking decision streamed by Events
+type BlockingEvent struct {
+	Time      string `json:"time"`
+	Decision  string `json:"decision"`
+	ClientIP  string `json:"client_ip"`
+	ActualIP  string `json:"actual_ip,omitempty"`
+	Country   string `json:"country_code"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	RuleID    string `json:"rule_id,omitempty"`
+	Network   string `json:"network,omitempty"`
+	Exemption string `json:"exemption,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
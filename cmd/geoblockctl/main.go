@@ -0,0 +1,274 @@
+// Command geoblockctl manages the geo-blocking API from the terminal: the
+// blocked countries, validations, customer syncs and live block events.
+//
+// The server is taken from --server or GEOBLOCK_SERVER, the API token from
+// GEOBLOCK_TOKEN and the Shopify token for customer syncs from
+// SHOPIFY_ACCESS_TOKEN. Tokens are read from the environment only, so they
+// stay out of shell history and process listings.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"shopify-customers/client"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := newRootCommand(os.Getenv).ExecuteContext(ctx); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCommand builds the command tree, reading configuration with getenv
+func newRootCommand(getenv func(string) string) *cobra.Command {
+	server := getenv("GEOBLOCK_SERVER")
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+
+	root := &cobra.Command{
+		Use:          "geoblockctl",
+		Short:        "Manage the geo-blocking API",
+		SilenceUsage: true,
+	}
+	root.PersistentFlags().StringVar(&server, "server", server, "API server URL (GEOBLOCK_SERVER)")
+	api := func() *client.Client {
+		return client.New(server, client.WithToken(getenv("GEOBLOCK_TOKEN")))
+	}
+
+	root.AddCommand(
+		countriesCommand(api),
+		validateCommand(api),
+		customersCommand(api, getenv),
+		eventsCommand(api),
+	)
+	return root
+}
+
+func countriesCommand(api func() *client.Client) *cobra.Command {
+	cmd := &cobra.Command{Use: "countries", Short: "List and change the blocked countries"}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the blocked countries",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			countries, err := api().BlockedCountries(cmd.Context())
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if len(countries) == 0 {
+				fmt.Fprintln(out, "No countries are blocked")
+				return nil
+			}
+			for _, country := range countries {
+				fmt.Fprintln(out, country)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add CODE...",
+		Short: "Block countries, by code, name or country group",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return changeCountries(cmd, args, api().BlockCountry)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove CODE...",
+		Short: "Unblock countries",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return changeCountries(cmd, args, api().UnblockCountry)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set [CODE...]",
+		Short: "Replace the blocked countries; no codes unblocks every country",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := api().BlockCountries(cmd.Context(), append([]string{}, args...))
+			if err != nil {
+				return err
+			}
+			printBlocked(cmd.OutOrStdout(), resp)
+			return nil
+		},
+	})
+	return cmd
+}
+
+// changeCountries blocks or unblocks each country in turn, stopping at the
+// first failure
+func changeCountries(cmd *cobra.Command, countries []string, change func(context.Context, string) (*client.BlockingResponse, error)) error {
+	var resp *client.BlockingResponse
+	for _, country := range countries {
+		var err error
+		if resp, err = change(cmd.Context(), country); err != nil {
+			return fmt.Errorf("%s: %w", country, err)
+		}
+	}
+	printBlocked(cmd.OutOrStdout(), resp)
+	return nil
+}
+
+func printBlocked(out io.Writer, resp *client.BlockingResponse) {
+	fmt.Fprintln(out, resp.Message)
+	fmt.Fprintf(out, "Blocked: %s\n", strings.Join(resp.BlockedCountries, ", "))
+	if resp.Storefront.Enabled {
+		fmt.Fprintf(out, "Storefront sync: %s\n", resp.Storefront.State)
+	}
+}
+
+func validateCommand(api func() *client.Client) *cobra.Command {
+	var blocked, test []string
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check how requests from test countries would be handled, without changing the blocklist",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := api().ValidateBlocking(cmd.Context(), blocked, test)
+			if err != nil {
+				return err
+			}
+
+			table := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(table, "COUNTRY\tSTATUS\tRULE\tTIME")
+			for _, result := range resp.TestResults {
+				status := result.Status
+				if result.Error != "" {
+					status += " (" + result.Error + ")"
+				}
+				fmt.Fprintf(table, "%s\t%s\t%s\t%dµs\n", result.Country, status, result.RuleID, result.ResponseTimeUS)
+			}
+			table.Flush()
+			summary := resp.Summary
+			fmt.Fprintf(cmd.OutOrStdout(), "\n%d blocked, %d allowed, %d monitored, %d invalid in %dms\n",
+				summary.BlockedCount, summary.AllowedCount, summary.MonitoredCount, summary.InvalidCount, summary.DurationMs)
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&blocked, "blocked", nil, "countries to block for the test")
+	cmd.Flags().StringSliceVar(&test, "test", nil, "countries to send test requests from")
+	cmd.MarkFlagRequired("test")
+	return cmd
+}
+
+func customersCommand(api func() *client.Client, getenv func(string) string) *cobra.Command {
+	cmd := &cobra.Command{Use: "customers", Short: "Work with the shop's customers"}
+
+	var shop string
+	var verify, emailHints bool
+	sync := &cobra.Command{
+		Use:   "sync",
+		Short: "Fetch the shop's customers from Shopify and summarize their countries",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token := getenv("SHOPIFY_ACCESS_TOKEN")
+			if shop == "" || token == "" {
+				return errors.New("set --shop (or SHOPIFY_SHOP) and SHOPIFY_ACCESS_TOKEN")
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Fetching customers of %s...\n", shop)
+			resp, err := api().FetchCustomers(cmd.Context(), client.CustomerRequest{
+				ShopURL:           shop,
+				APIKey:            token,
+				VerifyAddresses:   verify,
+				EmailCountryHints: emailHints,
+			})
+			if err != nil {
+				return err
+			}
+			printCustomerSummary(cmd.OutOrStdout(), resp)
+			return nil
+		},
+	}
+	sync.Flags().StringVar(&shop, "shop", getenv("SHOPIFY_SHOP"), "shop domain, e.g. example.myshopify.com (SHOPIFY_SHOP)")
+	sync.Flags().BoolVar(&verify, "verify-addresses", false, "geocode addresses to flag those outside their country")
+	sync.Flags().BoolVar(&emailHints, "email-hints", false, "add country hints from email domains")
+	cmd.AddCommand(sync)
+	return cmd
+}
+
+// printCustomerSummary prints the customer count and the customers per country, most first
+func printCustomerSummary(out io.Writer, resp *client.CustomerResponse) {
+	perCountry := make(map[string]int)
+	issues := 0
+	for _, customer := range resp.CustomerCountries {
+		for _, code := range customer.CountryCodes {
+			perCountry[code]++
+		}
+		issues += len(customer.AddressIssues)
+	}
+	codes := make([]string, 0, len(perCountry))
+	for code := range perCountry {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if perCountry[codes[i]] != perCountry[codes[j]] {
+			return perCountry[codes[i]] > perCountry[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	fmt.Fprintf(out, "%d customers in %d countries, %d address issues\n\n", resp.TotalCustomers, len(resp.UniqueCountries), issues)
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "COUNTRY\tCUSTOMERS")
+	for _, code := range codes {
+		fmt.Fprintf(table, "%s\t%d\n", code, perCountry[code])
+	}
+	table.Flush()
+}
+
+func eventsCommand(api func() *client.Client) *cobra.Command {
+	var asJSON bool
+	var decision string
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Tail live blocking decisions until interrupted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			encoder := json.NewEncoder(out)
+			err := api().Events(cmd.Context(), func(event client.BlockingEvent) error {
+				if decision != "" && event.Decision != decision {
+					return nil
+				}
+				if asJSON {
+					return encoder.Encode(event)
+				}
+				rule := event.RuleID
+				if rule == "" {
+					rule = event.Network
+				}
+				_, err := fmt.Fprintf(out, "%s  %-9s %-2s  %-15s %s %s %s\n",
+					event.Time, event.Decision, event.Country, event.ClientIP, event.Method, event.Path, rule)
+				return err
+			})
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print each event as a JSON line")
+	cmd.Flags().StringVar(&decision, "decision", "", "only show one decision: block, challenge, monitor, exempt, allow or honeypot")
+	return cmd
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shopify-customers/client"
+)
+
+func TestCommands(t *testing.T) {
+	blocked := []string{"KP"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer api-token" {
+			t.Errorf("%s %s: missing API token", r.Method, r.URL.Path)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/block-countries/export":
+			json.NewEncoder(w).Encode(map[string]any{"blocked_countries": blocked})
+		case "PUT /api/v1/block-countries/IR":
+			blocked = append(blocked, "IR")
+			json.NewEncoder(w).Encode(client.BlockingResponse{Message: "Blocked IR", BlockedCountries: blocked, Success: true})
+		case "POST /api/v1/validate-blocking":
+			var req client.ValidationRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			resp := client.ValidationResponse{TestResults: []client.TestResult{
+				{Country: req.TestCountries[0], Status: "blocked", RuleID: "r1"},
+				{Country: req.TestCountries[1], Status: "allowed"},
+			}}
+			resp.Summary.BlockedCount, resp.Summary.AllowedCount = 1, 1
+			json.NewEncoder(w).Encode(resp)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"countries", "list"}, []string{"KP"}},
+		{[]string{"countries", "add", "IR"}, []string{"Blocked IR", "Blocked: KP, IR"}},
+		{[]string{"validate", "--blocked", "KP", "--test", "KP,US"}, []string{"KP       blocked  r1", "US       allowed", "1 blocked, 1 allowed"}},
+	}
+	env := map[string]string{"GEOBLOCK_SERVER": server.URL, "GEOBLOCK_TOKEN": "api-token"}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		cmd := newRootCommand(func(name string) string { return env[name] })
+		cmd.SetArgs(tt.args)
+		cmd.SetOut(&out)
+		if err := cmd.Execute(); err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%v output = %q, want %q", tt.args, out.String(), want)
+			}
+		}
+	}
+}
+
+func TestCustomersSyncNeedsShopifyToken(t *testing.T) {
+	cmd := newRootCommand(func(name string) string { return map[string]string{"SHOPIFY_SHOP": "example.myshopify.com"}[name] })
+	cmd.SetArgs([]string{"customers", "sync"})
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "SHOPIFY_ACCESS_TOKEN") {
+		t.Errorf("Execute() error = %v, want SHOPIFY_ACCESS_TOKEN required", err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest response body worth compressing
+const minCompressSize = 1024
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip,
+// either by name or through "*"
+func acceptsGzip(r *http.Request) bool {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			quality, _ = strconv.ParseFloat(value, 64)
+		}
+		accepted[coding] = quality > 0
+	}
+	if ok, listed := accepted["gzip"]; listed {
+		return ok
+	}
+	return accepted["*"]
+}
+
+// compressWriter gzips a response once its body reaches minCompressSize.
+// Smaller bodies, event streams and responses that are already encoded are
+// passed through unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+// compressible reports whether the response may be compressed, judging by
+// its status and headers
+func (c *compressWriter) compressible() bool {
+	return compressibleResponse(c.status, c.Header())
+}
+
+// compressibleResponse reports whether a response with the status and
+// headers may be compressed
+func compressibleResponse(status int, header http.Header) bool {
+	switch {
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	case header.Get("Content-Encoding") != "":
+		return false
+	case strings.HasPrefix(header.Get("Content-Type"), "text/event-stream"):
+		return false
+	}
+	return true
+}
+
+// decide sends the status line and headers, with or without gzip, then any buffered body
+func (c *compressWriter) decide(compress bool) error {
+	c.decided = true
+	if compress {
+		c.Header().Set("Content-Encoding", "gzip")
+		c.Header().Del("Content-Length")
+		c.gz = gzipWriters.Get().(*gzip.Writer)
+		c.gz.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := c.write(buf)
+	return err
+}
+
+func (c *compressWriter) write(p []byte) (int, error) {
+	if c.gz != nil {
+		return c.gz.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	if !c.compressible() {
+		c.decide(false)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.decided {
+		return c.write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= minCompressSize {
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// FlushError sends what has been written so far, compressing it if the
+// response could be compressed
+func (c *compressWriter) FlushError() error {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.decided {
+		if err := c.decide(c.compressible()); err != nil {
+			return err
+		}
+	}
+	if c.gz != nil {
+		if err := c.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// close finishes the response once the handler has returned
+func (c *compressWriter) close() {
+	if c.status != 0 && !c.decided {
+		c.decide(false)
+	}
+	if c.gz != nil {
+		c.gz.Close()
+	}
+	c.release()
+}
+
+// release returns the gzip writer to the pool. After a panic the stream is
+// left unfinished, so the client does not take a cut-off body for a whole one.
+func (c *compressWriter) release() {
+	if c.gz != nil {
+		gzipWriters.Put(c.gz)
+		c.gz = nil
+	}
+}
+
+// addVary lists a request header in Vary unless it is there already
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// compressResponses gzips API responses of at least minCompressSize bytes
+// for clients that accept it
+func compressResponses(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.release()
+		next(cw, r)
+		cw.close()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressResponses(t *testing.T) {
+	large := strings.Repeat(`{"country_code": "DE"}`, 200)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantGzip       bool
+	}{
+		{"large JSON", "gzip, deflate, br", "application/json", large, true},
+		{"small JSON", "gzip", "application/json", `{"ok": true}`, false},
+		{"client without gzip", "br", "application/json", large, false},
+		{"gzip refused", "gzip;q=0, *", "application/json", large, false},
+		{"any encoding", "*", "application/json", large, true},
+		{"event stream", "gzip", "text/event-stream", large, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := compressResponses(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				// Write in pieces, as json.Encoder and streams do
+				for i := 0; i < len(tt.body); i += 100 {
+					io.WriteString(w, tt.body[i:min(i+100, len(tt.body))])
+				}
+			})
+			req := httptest.NewRequest("GET", "/api/v1/jobs/1", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			body := rec.Body.String()
+			if got := rec.Header().Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", got, tt.wantGzip)
+			}
+			if tt.wantGzip {
+				reader, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("invalid gzip body: %v", err)
+				}
+				data, _ := io.ReadAll(reader)
+				body = string(data)
+			}
+			if body != tt.body {
+				t.Errorf("body = %.40q..., want %.40q...", body, tt.body)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCompressResponsesFlush(t *testing.T) {
+	handler := compressResponses(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+		io.WriteString(w, "data: {}\n\n")
+	})
+	req := httptest.NewRequest("GET", "/api/v1/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "data: {}\n\n" {
+		t.Errorf("flushed %v, encoding %q, body %q; want a flushed plain stream", rec.Flushed, rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+}
+
+func TestCompressResponsesPanic(t *testing.T) {
+	handler := compressResponses(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 2*minCompressSize))
+		panic("handler failed")
+	})
+	req := httptest.NewRequest("GET", "/api/v1/jobs/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		handler(rec, req)
+	}()
+
+	// The cut-off body must not end in a gzip trailer that makes it look whole
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	if _, err := io.ReadAll(reader); err == nil {
+		t.Error("body of the failed response reads as a complete gzip stream")
+	}
+}
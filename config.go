@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnv returns the value of an environment variable or a fallback when unset
+func getEnv(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvDuration parses a duration such as "3s" from the environment
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value := getEnv(key, ""); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		fmt.Printf("⚠️  Invalid duration %q for %s, using %s\n", value, key, fallback)
+	}
+	return fallback
+}
+
+// getEnvFloat parses a number such as "0.05" from the environment
+func getEnvFloat(key string, fallback float64) float64 {
+	if value := getEnv(key, ""); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+		fmt.Printf("⚠️  Invalid number %q for %s, using %g\n", value, key, fallback)
+	}
+	return fallback
+}
+
+// getEnvInt parses a whole number such as "30" from the environment
+func getEnvInt(key string, fallback int) int {
+	if value := getEnv(key, ""); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		fmt.Printf("⚠️  Invalid number %q for %s, using %d\n", value, key, fallback)
+	}
+	return fallback
+}
+
+// getEnvList splits a comma-separated environment variable into trimmed entries
+func getEnvList(key, fallback string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"shopify-customers/geoblock"
+)
+
+// Continent is one of the continents every country belongs to. GroupID is
+// its built-in country group; continent codes such as AF and NA are also
+// country codes, so groups use the name.
+type Continent struct {
+	Code    string
+	Name    string
+	GroupID string
+}
+
+var continents = []Continent{
+	{"AF", "Africa", "africa"},
+	{"AN", "Antarctica", "antarctica"},
+	{"AS", "Asia", "asia"},
+	{"EU", "Europe", "europe"},
+	{"NA", "North America", "north-america"},
+	{"OC", "Oceania", "oceania"},
+	{"SA", "South America", "south-america"},
+}
+
+// continentGroups are the built-in country groups of each continent, such as
+// "africa", added to geoblock.BuiltinCountryGroups
+var continentGroups = registerContinentGroups()
+
+func registerContinentGroups() []geoblock.CountryGroup {
+	groups := make([]geoblock.CountryGroup, 0, len(continents))
+	for _, continent := range continents {
+		group := geoblock.CountryGroup{ID: continent.GroupID, Name: continent.Name}
+		for _, country := range countryDataset {
+			if country.Continent == continent.Code {
+				group.Countries = append(group.Countries, country.Code)
+			}
+		}
+		groups = append(groups, group)
+	}
+	geoblock.BuiltinCountryGroups = append(geoblock.BuiltinCountryGroups, groups...)
+	return groups
+}
+
+// continentName returns the name of a continent code
+func continentName(code string) string {
+	for _, continent := range continents {
+		if continent.Code == code {
+			return continent.Name
+		}
+	}
+	return ""
+}
+
+// countryContinent returns the continent of an alpha-2 code, or "" for
+// unknown and disputed countries
+func countryContinent(code string) string {
+	if country, ok := lookupCountry(code); ok {
+		return country.Continent
+	}
+	return ""
+}
+
+// ContinentTraffic is the traffic of a continent's countries
+type ContinentTraffic struct {
+	Continent     string `json:"continent"`
+	ContinentName string `json:"continent_name"`
+	Countries     int    `json:"countries"`
+	Requests      int    `json:"requests"`
+	Blocks        int    `json:"blocks"`
+	Monitored     int    `json:"monitored"`
+	UniqueIPs     int    `json:"unique_ips"`
+}
+
+// continentTraffic rolls per-country traffic up by continent, busiest first
+func continentTraffic(countries []CountryTraffic) []ContinentTraffic {
+	totals := make(map[string]*ContinentTraffic)
+	for _, country := range countries {
+		code := countryContinent(country.CountryCode)
+		if code == "" {
+			continue
+		}
+		total, ok := totals[code]
+		if !ok {
+			total = &ContinentTraffic{Continent: code, ContinentName: continentName(code)}
+			totals[code] = total
+		}
+		total.Countries++
+		total.Requests += country.Requests
+		total.Blocks += country.Blocks
+		total.Monitored += country.Monitored
+		total.UniqueIPs += country.UniqueIPs
+	}
+
+	rollup := make([]ContinentTraffic, 0, len(totals))
+	for _, total := range totals {
+		rollup = append(rollup, *total)
+	}
+	sort.Slice(rollup, func(i, j int) bool {
+		if rollup[i].Requests != rollup[j].Requests {
+			return rollup[i].Requests > rollup[j].Requests
+		}
+		return rollup[i].Continent < rollup[j].Continent
+	})
+	return rollup
+}
+
+// ContinentPresence is the business presence of a continent's countries.
+// Customers with addresses in several of its countries are counted once per
+// country, as in the country scores; orders and revenue are counted once.
+type ContinentPresence struct {
+	Continent             string  `json:"continent"`
+	ContinentName         string  `json:"continent_name"`
+	Customers             int     `json:"customers"`
+	Orders                int     `json:"orders"`
+	Revenue               float64 `json:"revenue"`
+	CountriesWithPresence int     `json:"countries_with_presence"`
+	BlockedCountries      int     `json:"blocked_countries"`
+}
+
+// continentPresence rolls country presence up by continent, most revenue
+// first. Every continent is listed.
+func continentPresence(countries []CountryPresence) []ContinentPresence {
+	totals := make(map[string]*ContinentPresence, len(continents))
+	rollup := make([]ContinentPresence, len(continents))
+	for i, continent := range continents {
+		rollup[i] = ContinentPresence{Continent: continent.Code, ContinentName: continent.Name}
+		totals[continent.Code] = &rollup[i]
+	}
+	for _, country := range countries {
+		total, ok := totals[countryContinent(country.CountryCode)]
+		if !ok {
+			continue
+		}
+		total.Customers += country.Customers
+		total.Orders += country.Orders
+		total.Revenue += country.Revenue
+		if country.HasPresence {
+			total.CountriesWithPresence++
+		}
+		if country.Blocked {
+			total.BlockedCountries++
+		}
+	}
+
+	for i := range rollup {
+		rollup[i].Revenue = math.Round(rollup[i].Revenue*100) / 100
+	}
+	sort.SliceStable(rollup, func(i, j int) bool {
+		if rollup[i].Revenue != rollup[j].Revenue {
+			return rollup[i].Revenue > rollup[j].Revenue
+		}
+		return rollup[i].Customers > rollup[j].Customers
+	})
+	return rollup
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestContinentGroups(t *testing.T) {
+	for _, country := range countryDataset {
+		if continentName(country.Continent) == "" {
+			t.Errorf("%s has unknown continent %q", country.Code, country.Continent)
+		}
+	}
+
+	policy := &geoblock.Policy{Rules: []geoblock.Rule{{ID: "africa", Groups: []string{"Africa"}, ExceptCountries: []string{"za"}}}}
+	if err := normalizePolicy(policy); err != nil {
+		t.Fatalf("normalizePolicy: %v", err)
+	}
+	countries, err := policy.RuleCountries(&policy.Rules[0])
+	if err != nil {
+		t.Fatalf("RuleCountries: %v", err)
+	}
+	for code, want := range map[string]bool{"NG": true, "EG": true, "KE": true, "ZA": false, "AF": false, "FR": false} {
+		if got := slices.Contains(countries, code); got != want {
+			t.Errorf("africa except ZA includes %s = %v, want %v", code, got, want)
+		}
+	}
+	if got := expandCountryGroups(policy, []string{"AF", "oceania"}); got[0] != "AF" || !slices.Contains(got, "NZ") {
+		t.Errorf("expandCountryGroups(AF, oceania) = %v, want Afghanistan and Oceania", got)
+	}
+}
+
+func TestContinentTraffic(t *testing.T) {
+	countries := []CountryTraffic{
+		{CountryCode: "DE", Requests: 10, Blocks: 1, UniqueIPs: 3},
+		{CountryCode: "US", Requests: 30, UniqueIPs: 5},
+		{CountryCode: "FR", Requests: 25, Blocks: 2, Monitored: 1, UniqueIPs: 4},
+		{CountryCode: "UNKNOWN", Requests: 7},
+	}
+	want := []ContinentTraffic{
+		{Continent: "EU", ContinentName: "Europe", Countries: 2, Requests: 35, Blocks: 3, Monitored: 1, UniqueIPs: 7},
+		{Continent: "NA", ContinentName: "North America", Countries: 1, Requests: 30, UniqueIPs: 5},
+	}
+	if got := continentTraffic(countries); !reflect.DeepEqual(got, want) {
+		t.Errorf("continentTraffic() = %+v, want %+v", got, want)
+	}
+}
+
+func TestContinentPresence(t *testing.T) {
+	countries := []CountryPresence{
+		{CountryCode: "US", Customers: 2, Orders: 10, Revenue: 1000, HasPresence: true},
+		{CountryCode: "DE", Customers: 1, Orders: 1, Revenue: 50.005, HasPresence: true},
+		{CountryCode: "FR", Customers: 1, Blocked: true},
+		{CountryCode: "JP", Blocked: true},
+	}
+
+	rollup := continentPresence(countries)
+	if len(rollup) != len(continents) {
+		t.Fatalf("got %d continents, want %d", len(rollup), len(continents))
+	}
+	want := []ContinentPresence{
+		{Continent: "NA", ContinentName: "North America", Customers: 2, Orders: 10, Revenue: 1000, CountriesWithPresence: 1},
+		{Continent: "EU", ContinentName: "Europe", Customers: 2, Orders: 1, Revenue: 50.01, CountriesWithPresence: 1, BlockedCountries: 1},
+	}
+	if !reflect.DeepEqual(rollup[:2], want) {
+		t.Errorf("continentPresence() = %+v, want %+v first", rollup[:2], want)
+	}
+	for _, continent := range rollup[2:] {
+		if continent.Continent == "AS" && continent.BlockedCountries != 1 {
+			t.Errorf("Asia = %+v, want 1 blocked country", continent)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// geoCorrectionsFilePath persists corrections of wrong geolocation lookups
+var geoCorrectionsFilePath = getEnv("GEO_CORRECTIONS_FILE", "geo-corrections.json")
+
+// Corrections may cover at most a network of this prefix length, so one
+// cannot reassign a provider's whole allocation, let alone every address
+const (
+	minCorrectionPrefixIPv4 = 24
+	minCorrectionPrefixIPv6 = 48
+)
+
+// GeoCorrection records that addresses in Network are in Country, after
+// support staff marked a decision for them as a false positive. Providers
+// holds what each provider answered when the correction was made.
+type GeoCorrection struct {
+	ID              string                    `json:"id"`
+	Network         string                    `json:"network"`
+	Country         string                    `json:"country"`
+	ReportedCountry string                    `json:"reported_country,omitempty"`
+	RequestID       string                    `json:"request_id,omitempty"`
+	Note            string                    `json:"note,omitempty"`
+	Principal       string                    `json:"principal"`
+	CreatedAt       string                    `json:"created_at"`
+	Providers       []geoblock.ProviderResult `json:"providers"`
+
+	network *net.IPNet
+}
+
+// ProviderAccuracy counts how often a provider was wrong about corrected addresses
+type ProviderAccuracy struct {
+	Provider          string  `json:"provider"`
+	Checked           int     `json:"checked"`
+	Wrong             int     `json:"wrong"`
+	Lookups           int64   `json:"lookups"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// GeoCorrections holds corrections and serves them as chain overrides; the
+// most specific network containing an address wins
+type GeoCorrections struct {
+	mu          sync.RWMutex
+	path        string
+	corrections []GeoCorrection
+}
+
+// NewGeoCorrections loads corrections from path; a missing file is empty
+func NewGeoCorrections(path string) (*GeoCorrections, error) {
+	store := &GeoCorrections{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return store, err
+	}
+	if err := json.Unmarshal(data, &store.corrections); err != nil {
+		return &GeoCorrections{path: path}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i := range store.corrections {
+		_, network, err := net.ParseCIDR(store.corrections[i].Network)
+		if err != nil {
+			return &GeoCorrections{path: path}, fmt.Errorf("correction %s: %w", store.corrections[i].ID, err)
+		}
+		store.corrections[i].network = network
+	}
+	return store, nil
+}
+
+// Override returns the corrected country of the most specific network containing ip
+func (g *GeoCorrections) Override(ip string) (string, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", false
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	best, bestSize := "", -1
+	for _, correction := range g.corrections {
+		if !correction.network.Contains(parsed) {
+			continue
+		}
+		if size, _ := correction.network.Mask.Size(); size > bestSize {
+			best, bestSize = correction.Country, size
+		}
+	}
+	return best, bestSize >= 0
+}
+
+// Add stores a correction, replacing any earlier one for the same network
+func (g *GeoCorrections) Add(correction GeoCorrection) error {
+	_, network, err := net.ParseCIDR(correction.Network)
+	if err != nil {
+		return err
+	}
+	correction.network = network
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	corrections := make([]GeoCorrection, 0, len(g.corrections)+1)
+	for _, existing := range g.corrections {
+		if existing.Network != correction.Network {
+			corrections = append(corrections, existing)
+		}
+	}
+	return g.save(append(corrections, correction))
+}
+
+// Delete removes a correction, reporting whether it existed
+func (g *GeoCorrections) Delete(id string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	corrections := make([]GeoCorrection, 0, len(g.corrections))
+	for _, existing := range g.corrections {
+		if existing.ID != id {
+			corrections = append(corrections, existing)
+		}
+	}
+	if len(corrections) == len(g.corrections) {
+		return false, nil
+	}
+	return true, g.save(corrections)
+}
+
+// save writes corrections to the file and then makes them active. Callers must hold g.mu.
+func (g *GeoCorrections) save(corrections []GeoCorrection) error {
+	data, err := json.MarshalIndent(corrections, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(g.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to save corrections to %s: %w", g.path, err)
+	}
+	g.corrections = corrections
+	return nil
+}
+
+// List returns the corrections, newest first
+func (g *GeoCorrections) List() []GeoCorrection {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	list := append([]GeoCorrection(nil), g.corrections...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+	return list
+}
+
+// Accuracy counts, per provider, how many corrected addresses it was asked
+// about and got wrong. The rate relates wrong answers to the provider's
+// successful lookups since startup, so it is a lower bound: only reported
+// false positives are counted.
+func (g *GeoCorrections) Accuracy(statuses []geoblock.ProviderStatus) []ProviderAccuracy {
+	byProvider := make(map[string]*ProviderAccuracy)
+	accuracy := make([]ProviderAccuracy, 0, len(statuses))
+	for _, status := range statuses {
+		accuracy = append(accuracy, ProviderAccuracy{Provider: status.Provider, Lookups: status.RequestCount - status.FailureCount})
+	}
+	for i := range accuracy {
+		byProvider[accuracy[i].Provider] = &accuracy[i]
+	}
+
+	for _, correction := range g.List() {
+		for _, result := range correction.Providers {
+			entry, ok := byProvider[result.Provider]
+			if !ok || result.Error != "" {
+				continue
+			}
+			entry.Checked++
+			if result.Country != correction.Country {
+				entry.Wrong++
+			}
+		}
+	}
+	for i := range accuracy {
+		if accuracy[i].Lookups > 0 {
+			accuracy[i].FalsePositiveRate = float64(accuracy[i].Wrong) / float64(accuracy[i].Lookups)
+		}
+	}
+	return accuracy
+}
+
+// geoCorrections overrides the process-wide provider chain; it starts empty
+// if the corrections file is unreadable
+var geoCorrections = loadGeoCorrections()
+
+func loadGeoCorrections() *GeoCorrections {
+	corrections, err := NewGeoCorrections(geoCorrectionsFilePath)
+	if err != nil {
+		fmt.Printf("⚠️  Could not load geo corrections, starting without them: %v\n", err)
+	}
+	return corrections
+}
+
+type GeoCorrectionRequest struct {
+	IP              string `json:"ip"`
+	Network         string `json:"network"`
+	Country         string `json:"country"`
+	ReportedCountry string `json:"reported_country"`
+	RequestID       string `json:"request_id"`
+	Note            string `json:"note"`
+}
+
+type GeoCorrectionsResponse struct {
+	Corrections []GeoCorrection    `json:"corrections"`
+	Providers   []ProviderAccuracy `json:"providers"`
+	Total       int                `json:"total"`
+}
+
+// handleListGeoCorrections lists corrections and the false-positive rate of every provider
+func handleListGeoCorrections(w http.ResponseWriter, r *http.Request) {
+	corrections := geoCorrections.List()
+	response := GeoCorrectionsResponse{
+		Corrections: corrections,
+		Providers:   geoCorrections.Accuracy(geoResolver.ProviderStatuses()),
+		Total:       len(corrections),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// correctionNewlyBlocked counts the recent clients in network that a
+// correction to country would start blocking, and all recent clients
+func correctionNewlyBlocked(network *net.IPNet, country string) (int, int) {
+	byCountry, total := trafficAnalytics.NetworkClients(network, blockGuardrailWindow, time.Now())
+	if !rejects(countryHandling(blocklist, country)) {
+		return 0, total
+	}
+	affected := 0
+	for code, clients := range byCountry {
+		if !rejects(countryHandling(blocklist, code)) {
+			affected += clients
+		}
+	}
+	return affected, total
+}
+
+// handleAddGeoCorrection marks the country resolved for an IP or network as
+// wrong. Every provider is asked about the address to attribute the error,
+// and the corrected country is used for future lookups. Corrections take
+// precedence over every provider, so networks are limited in size, need the
+// admin role, and pass the same lockout and guardrail checks as blocklist
+// changes.
+func handleAddGeoCorrection(w http.ResponseWriter, r *http.Request) {
+	var req GeoCorrectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, "Invalid JSON in request body", http.StatusBadRequest)
+		return
+	}
+	target := strings.TrimSpace(req.Network)
+	if target == "" {
+		target = strings.TrimSpace(req.IP)
+	}
+	if target == "" || (req.IP != "" && req.Network != "") {
+		writeError(w, r, "Set exactly one of ip or network", http.StatusBadRequest)
+		return
+	}
+	networks, err := normalizeNetworks([]string{target})
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	country, err := normalizeCountryCode(req.Country)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("Invalid country: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	_, network, _ := net.ParseCIDR(networks[0])
+	ones, bits := network.Mask.Size()
+	minimum := minCorrectionPrefixIPv4
+	if bits == 128 {
+		minimum = minCorrectionPrefixIPv6
+	}
+	if ones < minimum {
+		writeError(w, r, fmt.Sprintf("Network %s is too broad; corrections cover at most a /%d", networks[0], minimum), http.StatusBadRequest)
+		return
+	}
+	if principal := principalFromContext(r.Context()); ones < bits && principal.Role < RoleAdmin {
+		writeError(w, r, forbiddenMessage(principal, RoleAdmin)+" to correct a network", http.StatusForbidden)
+		return
+	}
+	if caller, protect := lockoutCaller(r); protect {
+		if err := checkCorrectionLockout(network, country, caller, requestPrincipalName(r)); err != nil {
+			writeError(w, r, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+	violations := checkCorrectionGuardrails(correctionNewlyBlocked(network, country))
+	if len(violations) > 0 && blockGuardrailReject && r.URL.Query().Get("override") != "true" {
+		fmt.Printf("❌ Rejected geo correction of %s exceeding the blocking guardrails\n", networks[0])
+		writeErrorDetails(w, r, http.StatusConflict, "block_guardrail",
+			"The correction exceeds the blocking guardrails; repeat it with ?override=true to apply it anyway", violations)
+		return
+	}
+	for _, violation := range violations {
+		fmt.Printf("⚠️  Geo correction of %s: %s\n", networks[0], violation.Message)
+	}
+
+	correction := GeoCorrection{
+		ID:              newRequestID(),
+		Network:         networks[0],
+		Country:         country,
+		ReportedCountry: strings.ToUpper(strings.TrimSpace(req.ReportedCountry)),
+		RequestID:       req.RequestID,
+		Note:            req.Note,
+		Principal:       changePrincipal(r),
+		CreatedAt:       time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// Providers are asked about the network's first address
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	if results, err := geoResolver.LookupAll(ctx, network.IP.String()); err == nil {
+		correction.Providers = results
+	}
+
+	if err := geoCorrections.Add(correction); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	blocker.ClearDecisions()
+	recordAudit(r, "add-geo-correction", correction)
+	fmt.Printf("🩹 Geo correction %s: %s is %s (reported as %s) by %s\n",
+		correction.ID, correction.Network, correction.Country, correction.ReportedCountry, correction.Principal)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(correction)
+}
+
+// handleDeleteGeoCorrection removes a correction, so the providers decide again
+func handleDeleteGeoCorrection(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	found, err := geoCorrections.Delete(id)
+	switch {
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	case !found:
+		writeError(w, r, fmt.Sprintf("Geo correction %s not found", id), http.StatusNotFound)
+		return
+	}
+	blocker.ClearDecisions()
+	recordAudit(r, "delete-geo-correction", map[string]string{"id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+func TestGeoCorrections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrections.json")
+	store, err := NewGeoCorrections(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ id, network, country string }{
+		{"wide", "203.0.113.0/24", "DE"},
+		{"narrow", "203.0.113.7/32", "FR"},
+		{"v6", "2001:db8::/32", "NL"},
+	} {
+		if err := store.Add(GeoCorrection{ID: c.id, Network: c.network, Country: c.country}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := store.Override("203.0.113.7"); got != "FR" {
+		t.Errorf("Override before reload = %q, want FR", got)
+	}
+
+	// Reloading the file parses the stored networks again
+	store, err = NewGeoCorrections(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+		ok   bool
+	}{
+		{"203.0.113.7", "FR", true},
+		{"203.0.113.8", "DE", true},
+		{"2001:db8::1", "NL", true},
+		{"198.51.100.1", "", false},
+		{"not an ip", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := store.Override(tt.ip); got != tt.want || ok != tt.ok {
+			t.Errorf("Override(%s) = %q, %v, want %q, %v", tt.ip, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if found, err := store.Delete("narrow"); !found || err != nil {
+		t.Fatalf("Delete = %v, %v", found, err)
+	}
+	if found, _ := store.Delete("narrow"); found {
+		t.Error("deleted correction was found again")
+	}
+	if got, _ := store.Override("203.0.113.7"); got != "DE" {
+		t.Errorf("after delete Override = %q, want DE from the wider network", got)
+	}
+}
+
+func TestGeoCorrectionsAccuracy(t *testing.T) {
+	store, _ := NewGeoCorrections(filepath.Join(t.TempDir(), "corrections.json"))
+	store.Add(GeoCorrection{ID: "a", Network: "203.0.113.7/32", Country: "DE", CreatedAt: "2026-03-01T00:00:00Z", Providers: []geoblock.ProviderResult{
+		{Provider: "ipinfo", Country: "RU"},
+		{Provider: "maxmind", Country: "DE"},
+	}})
+	store.Add(GeoCorrection{ID: "b", Network: "198.51.100.9/32", Country: "FR", CreatedAt: "2026-03-02T00:00:00Z", Providers: []geoblock.ProviderResult{
+		{Provider: "ipinfo", Country: "BE"},
+		{Provider: "maxmind", Error: "timeout"},
+	}})
+
+	got := store.Accuracy([]geoblock.ProviderStatus{
+		{Provider: "ipinfo", RequestCount: 110, FailureCount: 10},
+		{Provider: "maxmind", RequestCount: 50},
+	})
+	want := []ProviderAccuracy{
+		{Provider: "ipinfo", Checked: 2, Wrong: 2, Lookups: 100, FalsePositiveRate: 0.02},
+		{Provider: "maxmind", Checked: 1, Wrong: 0, Lookups: 50},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Accuracy = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Accuracy[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if list := store.List(); list[0].ID != "b" {
+		t.Errorf("List starts with %s, want the newest correction b", list[0].ID)
+	}
+}
+
+func TestHandleAddGeoCorrectionLimits(t *testing.T) {
+	useTestPolicyFile(t)
+	useTestTokens(t, map[string]*Principal{
+		"operator-token": {Name: "support", Role: RoleOperator},
+		"admin-token":    {Name: "admin", Role: RoleAdmin},
+	})
+	savedAnalytics := trafficAnalytics
+	defer func() { trafficAnalytics = savedAnalytics }()
+	trafficAnalytics = NewTrafficAnalytics()
+	for i := 0; i < 100; i++ {
+		ip := fmt.Sprintf("198.51.100.%d", i)
+		if i < 30 {
+			ip = fmt.Sprintf("203.0.113.%d", i)
+		}
+		trafficAnalytics.Record("US", ip, false, false, time.Now())
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"every IPv4 address", "admin-token", `{"network": "0.0.0.0/0", "country": "US"}`, http.StatusBadRequest},
+		{"IPv4 network too broad", "admin-token", `{"network": "10.0.0.0/8", "country": "RU"}`, http.StatusBadRequest},
+		{"IPv6 network too broad", "admin-token", `{"network": "2001:db8::/32", "country": "US"}`, http.StatusBadRequest},
+		{"operator correcting a network", "operator-token", `{"network": "203.0.113.0/28", "country": "US"}`, http.StatusForbidden},
+		{"network moved into a blocked country", "admin-token", `{"network": "203.0.113.0/24", "country": "RU"}`, http.StatusConflict},
+	}
+	handler := requireRole(RoleOperator, handleAddGeoCorrection)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/v1/geo-corrections?force=true", strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCheckCorrectionLockout(t *testing.T) {
+	useTestPolicyFile(t)
+	_, network, _ := net.ParseCIDR("198.51.100.0/24")
+	geo := geoblock.RequestGeo{ActualIP: "198.51.100.7", Country: "DE"}
+
+	if err := checkCorrectionLockout(network, "RU", geo, "admin"); !errors.Is(err, errSelfLockout) {
+		t.Errorf("moving the caller into a blocked country: err = %v, want errSelfLockout", err)
+	}
+	if err := checkCorrectionLockout(network, "FR", geo, "admin"); err != nil {
+		t.Errorf("moving the caller into an allowed country: err = %v", err)
+	}
+	other := geoblock.RequestGeo{ActualIP: "192.0.2.1", Country: "DE"}
+	if err := checkCorrectionLockout(network, "RU", other, "admin"); err != nil {
+		t.Errorf("caller outside the network: err = %v", err)
+	}
+}
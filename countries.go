@@ -0,0 +1,272 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:embed data/countries.json
+var countriesJSON []byte
+
+// CountryInfo is an ISO 3166-1 country record
+type CountryInfo struct {
+	Code         string            `json:"code"`
+	Alpha3       string            `json:"alpha3"`
+	Numeric      string            `json:"numeric"`
+	Name         string            `json:"name"`
+	CommonName   string            `json:"common_name,omitempty"`
+	OfficialName string            `json:"official_name,omitempty"`
+	LocalNames   map[string]string `json:"local_names,omitempty"`
+	// Continent is AF, AN, AS, EU, NA, OC or SA
+	Continent string `json:"continent"`
+	// Currency is the ISO 4217 code of the default currency
+	Currency string `json:"currency,omitempty"`
+	// Languages are the ISO 639-1 codes of the primary languages, most spoken first
+	Languages []string `json:"languages,omitempty"`
+}
+
+// ShortName returns the commonly used English name, e.g. "South Korea"
+// rather than the ISO name "Korea, Republic of"
+func (c *CountryInfo) ShortName() string {
+	if c.CommonName != "" {
+		return c.CommonName
+	}
+	return c.Name
+}
+
+// DisplayName returns the country name in the given locale, falling back to English
+func (c *CountryInfo) DisplayName(locale string) string {
+	locale = canonicalLocale(locale)
+	if name, ok := c.LocalNames[locale]; ok {
+		return name
+	}
+	// Try the base language for regional locales such as "de-AT"
+	if base, _, found := strings.Cut(locale, "-"); found {
+		if name, ok := c.LocalNames[base]; ok {
+			return name
+		}
+	}
+	return c.ShortName()
+}
+
+// canonicalLocale normalizes the case of a BCP 47 tag, e.g. "PT-br" -> "pt-BR"
+// and "zh-hans-cn" -> "zh-Hans-CN"
+func canonicalLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 2:
+			parts[i] = strings.ToUpper(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+var (
+	// countryDataset holds every ISO 3166-1 country, sorted by alpha-2 code
+	countryDataset = loadCountryDataset()
+
+	countriesByCode, countriesByAlpha3, countriesByName = indexCountries(countryDataset)
+)
+
+// indexCountries builds lookup tables by alpha-2 code, alpha-3 code, and lowercased name
+func indexCountries(dataset []CountryInfo) (byCode, byAlpha3, byName map[string]*CountryInfo) {
+	byCode = make(map[string]*CountryInfo, len(dataset))
+	byAlpha3 = make(map[string]*CountryInfo, len(dataset))
+	byName = make(map[string]*CountryInfo, len(dataset))
+
+	for i := range dataset {
+		country := &dataset[i]
+		byCode[country.Code] = country
+		byAlpha3[country.Alpha3] = country
+		for _, name := range []string{country.Name, country.CommonName, country.OfficialName} {
+			if name != "" {
+				byName[strings.ToLower(name)] = country
+			}
+		}
+	}
+	return byCode, byAlpha3, byName
+}
+
+// loadCountryDataset parses the embedded ISO 3166-1 dataset
+func loadCountryDataset() []CountryInfo {
+	var countries []CountryInfo
+	if err := json.Unmarshal(countriesJSON, &countries); err != nil {
+		panic(fmt.Sprintf("invalid embedded country dataset: %v", err))
+	}
+	sort.Slice(countries, func(i, j int) bool { return countries[i].Code < countries[j].Code })
+	return countries
+}
+
+// lookupCountry returns the dataset record for an alpha-2 code
+func lookupCountry(code string) (*CountryInfo, bool) {
+	country, ok := countriesByCode[strings.ToUpper(code)]
+	return country, ok
+}
+
+// getCountryName returns the English name for an alpha-2 code
+func getCountryName(countryCode string) (string, bool) {
+	if country, ok := lookupCountry(countryCode); ok {
+		return country.ShortName(), true
+	}
+	return "", false
+}
+
+// getAllCountryCodes returns every ISO 3166-1 alpha-2 code in the dataset
+func getAllCountryCodes() []string {
+	codes := make([]string, len(countryDataset))
+	for i := range countryDataset {
+		codes[i] = countryDataset[i].Code
+	}
+	return codes
+}
+
+// countryNameAliases maps common English country names that differ from the
+// dataset names to ISO 3166-1 alpha-2 codes
+var countryNameAliases = map[string]string{
+	"usa": "US", "america": "US",
+	"uk": "GB", "great britain": "GB", "britain": "GB", "england": "GB",
+	"russia": "RU", "holland": "NL", "korea": "KR", "uae": "AE",
+	"turkey": "TR", "turkiye": "TR",
+}
+
+// CountryCodeError describes a submitted country that could not be resolved
+type CountryCodeError struct {
+	Index int    `json:"index"`
+	Input string `json:"input"`
+	Error string `json:"error"`
+}
+
+// isValidCountryCode reports whether code is a known ISO 3166-1 alpha-2 code
+func isValidCountryCode(code string) bool {
+	_, ok := countriesByCode[code]
+	return ok
+}
+
+// normalizeCountryCode resolves an alpha-2 code, alpha-3 code, or common
+// country name (case-insensitively) to an ISO 3166-1 alpha-2 code
+func normalizeCountryCode(input string) (string, error) {
+	value := strings.TrimSpace(input)
+	if value == "" {
+		return "", fmt.Errorf("country code is empty")
+	}
+
+	upper := strings.ToUpper(value)
+	switch len(upper) {
+	case 2:
+		if isValidCountryCode(upper) {
+			return upper, nil
+		}
+	case 3:
+		if country, ok := countriesByAlpha3[upper]; ok {
+			return country.Code, nil
+		}
+	}
+
+	lower := strings.ToLower(value)
+	if code, ok := countryNameAliases[lower]; ok {
+		return code, nil
+	}
+	if country, ok := countriesByName[lower]; ok {
+		return country.Code, nil
+	}
+
+	return "", fmt.Errorf("%q is not a valid ISO 3166-1 country code", input)
+}
+
+// normalizeCountryCodes validates a list of submitted countries, returning the
+// de-duplicated alpha-2 codes and an error entry for every invalid item
+func normalizeCountryCodes(inputs []string) ([]string, []CountryCodeError) {
+	codes := make([]string, 0, len(inputs))
+	var errs []CountryCodeError
+	seen := make(map[string]bool)
+
+	for i, input := range inputs {
+		code, err := normalizeCountryCode(input)
+		if err != nil {
+			errs = append(errs, CountryCodeError{Index: i, Input: input, Error: err.Error()})
+			continue
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+
+	return codes, errs
+}
+
+type CountryListItem struct {
+	Code         string   `json:"code"`
+	Alpha3       string   `json:"alpha3"`
+	Numeric      string   `json:"numeric"`
+	Name         string   `json:"name"`
+	CommonName   string   `json:"common_name,omitempty"`
+	OfficialName string   `json:"official_name,omitempty"`
+	DisplayName  string   `json:"display_name"`
+	Continent    string   `json:"continent"`
+	Currency     string   `json:"currency,omitempty"`
+	Languages    []string `json:"languages,omitempty"`
+}
+
+type CountryListResponse struct {
+	Countries []CountryListItem `json:"countries"`
+	Locale    string            `json:"locale"`
+	Total     int               `json:"total"`
+}
+
+// requestLocale picks the display locale from ?locale= or the Accept-Language header
+func requestLocale(r *http.Request) string {
+	locale := r.URL.Query().Get("locale")
+	if locale == "" {
+		// Use the first language tag, e.g. "de-DE,de;q=0.9" -> "de-DE"
+		locale, _, _ = strings.Cut(r.Header.Get("Accept-Language"), ",")
+		locale, _, _ = strings.Cut(locale, ";")
+	}
+	locale = canonicalLocale(locale)
+	if locale == "" || locale == "*" {
+		return "en"
+	}
+	return locale
+}
+
+// handleCountries serves the ISO 3166 reference dataset with localized display names
+func handleCountries(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(r)
+
+	countries := make([]CountryListItem, 0, len(countryDataset))
+	for i := range countryDataset {
+		country := &countryDataset[i]
+		countries = append(countries, CountryListItem{
+			Code:         country.Code,
+			Alpha3:       country.Alpha3,
+			Numeric:      country.Numeric,
+			Name:         country.Name,
+			CommonName:   country.CommonName,
+			OfficialName: country.OfficialName,
+			DisplayName:  country.DisplayName(locale),
+			Continent:    country.Continent,
+			Currency:     country.Currency,
+			Languages:    country.Languages,
+		})
+	}
+
+	response := CountryListResponse{
+		Countries: countries,
+		Locale:    locale,
+		Total:     len(countries),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
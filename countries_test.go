@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeCountryCode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "US", want: "US"},
+		{input: " de ", want: "DE"},
+		{input: "gbr", want: "GB"},
+		{input: "USA", want: "US"},
+		{input: "usa", want: "US"},
+		{input: "uk", want: "GB"},
+		{input: "Holland", want: "NL"},
+		{input: "Germany", want: "DE"},
+		{input: "korea, republic of", want: "KR"},
+		{input: "South Korea", want: "KR"},
+		{input: "XX", wantErr: true},
+		{input: "ZZZ", wantErr: true},
+		{input: "Atlantis", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "   ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeCountryCode(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("normalizeCountryCode(%q) = %q, want error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeCountryCode(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCountryCodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputs      []string
+		wantCodes   []string
+		wantInvalid []int
+	}{
+		{
+			name:      "empty",
+			inputs:    nil,
+			wantCodes: []string{},
+		},
+		{
+			name:      "mixed forms are de-duplicated in order",
+			inputs:    []string{"cn", "CHN", "China", "RU", "russia"},
+			wantCodes: []string{"CN", "RU"},
+		},
+		{
+			name:        "invalid entries are reported by index",
+			inputs:      []string{"US", "XX", "DEU", "", "Narnia"},
+			wantCodes:   []string{"US", "DE"},
+			wantInvalid: []int{1, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes, errs := normalizeCountryCodes(tt.inputs)
+			if !reflect.DeepEqual(codes, tt.wantCodes) {
+				t.Errorf("codes = %v, want %v", codes, tt.wantCodes)
+			}
+
+			var invalid []int
+			for _, e := range errs {
+				if e.Input != tt.inputs[e.Index] {
+					t.Errorf("error at index %d has input %q, want %q", e.Index, e.Input, tt.inputs[e.Index])
+				}
+				invalid = append(invalid, e.Index)
+			}
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("invalid indexes = %v, want %v", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestDisplayNameLocaleCase(t *testing.T) {
+	germany, _ := lookupCountry("DE")
+	china, _ := lookupCountry("CN")
+
+	tests := []struct {
+		country *CountryInfo
+		locale  string
+		want    string
+	}{
+		{germany, "de", "Deutschland"},
+		{germany, "DE-at", "Deutschland"},
+		{germany, "pt_br", germany.LocalNames["pt"]},
+		{china, "zh-cn", china.LocalNames["zh-CN"]},
+		{china, "ZH-CN", china.LocalNames["zh-CN"]},
+		{germany, "xx", "Germany"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.country.DisplayName(tt.locale); got != tt.want {
+			t.Errorf("DisplayName(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestCountryLocalizationData(t *testing.T) {
+	for _, country := range countryDataset {
+		// Antarctica has no currency, and uninhabited territories no language
+		if country.Currency == "" && country.Code != "AQ" {
+			t.Errorf("%s has no currency", country.Code)
+		}
+		if len(country.Currency) != 0 && len(country.Currency) != 3 {
+			t.Errorf("%s currency %q is not an ISO 4217 code", country.Code, country.Currency)
+		}
+		for _, language := range country.Languages {
+			if len(language) != 2 {
+				t.Errorf("%s language %q is not an ISO 639-1 code", country.Code, language)
+			}
+		}
+	}
+
+	if japan, _ := lookupCountry("JP"); japan.Currency != "JPY" || !reflect.DeepEqual(japan.Languages, []string{"ja"}) {
+		t.Errorf("JP = %s %v, want JPY [ja]", japan.Currency, japan.Languages)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+)
+
+// CountryCustomer is a customer with an address in the drilled-down country.
+// AddressRole is "default" when it is their default address's country, else
+// "secondary".
+type CountryCustomer struct {
+	CustomerCountry
+	AddressRole string `json:"address_role"`
+}
+
+type CountryCustomersResponse struct {
+	CountryCode      string            `json:"country_code"`
+	CountryName      string            `json:"country_name"`
+	Blocked          bool              `json:"blocked"`
+	StoreCustomers   int               `json:"store_customers"`
+	TotalCustomers   int               `json:"total_customers"`
+	DefaultAddress   int               `json:"default_address_customers"`
+	SecondaryAddress int               `json:"secondary_address_customers"`
+	AcceptsMarketing int               `json:"accepts_marketing"`
+	DefaultOrders    int               `json:"default_address_orders"`
+	DefaultRevenue   float64           `json:"default_address_revenue"`
+	Customers        []CountryCustomer `json:"customers"`
+	Page             *CustomerPage     `json:"page"`
+}
+
+// countryCustomers summarizes the customers with an address in a country and
+// returns the page of them selected by query. The counts ignore the query's
+// tag filter. Orders and revenue are counted for customers whose default
+// address is there, as in the presence score.
+func countryCustomers(code string, customers []CustomerCountry, query CustomerQuery) CountryCustomersResponse {
+	response := CountryCustomersResponse{CountryCode: code, StoreCustomers: len(customers)}
+	response.CountryName, _ = getCountryName(code)
+	response.Blocked = blocklist.IsBlocked(code)
+
+	for _, customer := range customers {
+		if !slices.Contains(customer.CountryCodes, code) {
+			continue
+		}
+		response.TotalCustomers++
+		if customer.AcceptsMarketing {
+			response.AcceptsMarketing++
+		}
+		if customer.DefaultCountry == code {
+			response.DefaultAddress++
+			response.DefaultOrders += customer.OrdersCount
+			response.DefaultRevenue += customer.TotalSpent
+		} else {
+			response.SecondaryAddress++
+		}
+	}
+	response.DefaultRevenue = math.Round(response.DefaultRevenue*100) / 100
+
+	query.Countries = []string{code}
+	page := query.Apply(CustomerResponse{CustomerCountries: customers})
+	response.Page = page.Page
+	response.Customers = make([]CountryCustomer, 0, len(page.CustomerCountries))
+	for _, customer := range page.CustomerCountries {
+		role := "secondary"
+		if customer.DefaultCountry == code {
+			role = "default"
+		}
+		response.Customers = append(response.Customers, CountryCustomer{CustomerCountry: customer, AddressRole: role})
+	}
+	return response
+}
+
+// handleCountryCustomers lists the store's customers with any address in a
+// country, to show who blocking it would affect. The customers are fetched
+// from Shopify as for the presence analysis, and can be filtered by ?tag=,
+// sorted and paged like job results.
+func handleCountryCustomers(w http.ResponseWriter, r *http.Request) {
+	code, err := normalizeCountryCode(r.PathValue("code"))
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	values.Del("country")
+	query, err := parseCustomerQuery(values)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	customers, err := fetchAllCustomersFromShopify(r.Context(), currentShopifyConfig.APIKey, nil)
+	if err != nil {
+		fmt.Printf("❌ Error fetching customers: %v\n", err)
+		writeError(w, r, fmt.Sprintf("Failed to fetch customers: %v", err), http.StatusInternalServerError)
+		return
+	}
+	customerCountries := extractCountryCodes(customers)
+	if piiMinimization {
+		minimizeCustomers(customerCountries)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countryCustomers(code, customerCountries, query))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCountryCustomers(t *testing.T) {
+	customers := []CustomerCountry{
+		{CustomerID: 1, CustomerName: "Anna", CountryCodes: []string{"DE"}, DefaultCountry: "DE", OrdersCount: 2, TotalSpent: 10.005, AcceptsMarketing: true},
+		{CustomerID: 2, CustomerName: "Ben", CountryCodes: []string{"DE", "FR"}, DefaultCountry: "FR", OrdersCount: 5, TotalSpent: 99, Tags: []string{"vip"}},
+		{CustomerID: 3, CustomerName: "Cleo", CountryCodes: []string{"US"}, DefaultCountry: "US"},
+		{CustomerID: 4, CustomerName: "Dan", CountryCodes: []string{"DE"}, OrdersCount: 1, TotalSpent: 5},
+	}
+
+	tests := []struct {
+		name          string
+		code          string
+		query         CustomerQuery
+		wantTotal     int
+		wantDefault   int
+		wantSecondary int
+		wantIDs       []int64
+		wantRoles     []string
+	}{
+		{"every address counts", "DE", CustomerQuery{Limit: 10}, 3, 1, 2, []int64{1, 2, 4}, []string{"default", "secondary", "secondary"}},
+		{"tag filters the list, not the counts", "DE", CustomerQuery{Limit: 10, Tag: "vip"}, 3, 1, 2, []int64{2}, []string{"secondary"}},
+		{"paged", "DE", CustomerQuery{Limit: 1, Offset: 1}, 3, 1, 2, []int64{2}, []string{"secondary"}},
+		{"no customers", "JP", CustomerQuery{Limit: 10}, 0, 0, 0, []int64{}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := countryCustomers(tt.code, customers, tt.query)
+			if got.TotalCustomers != tt.wantTotal || got.DefaultAddress != tt.wantDefault || got.SecondaryAddress != tt.wantSecondary {
+				t.Errorf("counts = %d total, %d default, %d secondary; want %d, %d, %d",
+					got.TotalCustomers, got.DefaultAddress, got.SecondaryAddress, tt.wantTotal, tt.wantDefault, tt.wantSecondary)
+			}
+			if got.StoreCustomers != len(customers) {
+				t.Errorf("store_customers = %d, want %d", got.StoreCustomers, len(customers))
+			}
+			if len(got.Customers) != len(tt.wantIDs) {
+				t.Fatalf("customers = %+v, want IDs %v", got.Customers, tt.wantIDs)
+			}
+			for i, customer := range got.Customers {
+				if customer.CustomerID != tt.wantIDs[i] || customer.AddressRole != tt.wantRoles[i] {
+					t.Errorf("customer %d = %d (%s), want %d (%s)", i, customer.CustomerID, customer.AddressRole, tt.wantIDs[i], tt.wantRoles[i])
+				}
+			}
+		})
+	}
+
+	if got := countryCustomers("DE", customers, CustomerQuery{Limit: 10}); got.DefaultOrders != 2 || got.DefaultRevenue != 10.01 || got.AcceptsMarketing != 1 {
+		t.Errorf("default orders %d, revenue %v, marketing %d; want 2, 10.01, 1", got.DefaultOrders, got.DefaultRevenue, got.AcceptsMarketing)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"shopify-customers/geoblock"
+)
+
+// countryGroupIDPattern is the form of custom country group IDs, e.g. "high-risk"
+var countryGroupIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// CountryGroupStatus is a country group with where it comes from and the
+// rules that block it
+type CountryGroupStatus struct {
+	geoblock.CountryGroup
+	Builtin bool     `json:"builtin"`
+	Rules   []string `json:"rules"`
+}
+
+type CountryGroupsResponse struct {
+	Groups []CountryGroupStatus `json:"groups"`
+	Total  int                  `json:"total"`
+}
+
+// normalizeCountryGroupID lowercases a group ID, so "EU" and "eu" are the same group
+func normalizeCountryGroupID(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
+
+// isBuiltinCountryGroup reports whether id is one of geoblock.BuiltinCountryGroups
+func isBuiltinCountryGroup(id string) bool {
+	for _, group := range geoblock.BuiltinCountryGroups {
+		if group.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCountryGroups validates the policy's custom groups and the groups
+// its rules refer to
+func normalizeCountryGroups(p *geoblock.Policy) error {
+	ids := make(map[string]bool, len(p.CountryGroups))
+	for i := range p.CountryGroups {
+		group := &p.CountryGroups[i]
+		group.ID = normalizeCountryGroupID(group.ID)
+		switch {
+		case !countryGroupIDPattern.MatchString(group.ID):
+			return fmt.Errorf("invalid country group id %q: use lowercase letters, digits and dashes", group.ID)
+		case isBuiltinCountryGroup(group.ID):
+			return fmt.Errorf("country group %q is built in", group.ID)
+		case ids[group.ID]:
+			return fmt.Errorf("duplicate country group id %q", group.ID)
+		}
+		ids[group.ID] = true
+		countries, invalid := normalizeCountryCodes(group.Countries)
+		if len(invalid) > 0 {
+			return fmt.Errorf("country group %s: invalid country %q: %s", group.ID, invalid[0].Input, invalid[0].Error)
+		}
+		if len(countries) == 0 {
+			return fmt.Errorf("country group %s: needs at least one country", group.ID)
+		}
+		group.Countries = countries
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		groups := rule.Groups[:0]
+		seen := make(map[string]bool, len(rule.Groups))
+		for _, id := range rule.Groups {
+			if id = normalizeCountryGroupID(id); !seen[id] {
+				seen[id] = true
+				groups = append(groups, id)
+			}
+		}
+		rule.Groups = groups
+		if _, err := p.RuleCountries(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countryGroupRules returns the IDs of the rules that block a group
+func countryGroupRules(policy *geoblock.Policy, id string) []string {
+	rules := []string{}
+	for _, rule := range policy.Rules {
+		if slices.Contains(rule.Groups, id) {
+			rules = append(rules, rule.ID)
+		}
+	}
+	return rules
+}
+
+// expandCountryGroups replaces the IDs of country groups in a list of
+// submitted countries with the groups' members, leaving other entries as they are
+func expandCountryGroups(policy *geoblock.Policy, inputs []string) []string {
+	var expanded []string
+	for _, input := range inputs {
+		if group, ok := policy.CountryGroup(normalizeCountryGroupID(input)); ok {
+			expanded = append(expanded, group.Countries...)
+		} else {
+			expanded = append(expanded, input)
+		}
+	}
+	return expanded
+}
+
+// handleListCountryGroups lists the built-in and custom country groups
+func handleListCountryGroups(w http.ResponseWriter, r *http.Request) {
+	policy := blocklist.Policy()
+	groups := make([]CountryGroupStatus, 0, len(geoblock.BuiltinCountryGroups)+len(policy.CountryGroups))
+	for _, group := range geoblock.BuiltinCountryGroups {
+		groups = append(groups, CountryGroupStatus{CountryGroup: group, Builtin: true, Rules: countryGroupRules(policy, group.ID)})
+	}
+	custom := append([]geoblock.CountryGroup(nil), policy.CountryGroups...)
+	sort.Slice(custom, func(i, j int) bool { return custom[i].ID < custom[j].ID })
+	for _, group := range custom {
+		groups = append(groups, CountryGroupStatus{CountryGroup: group, Rules: countryGroupRules(policy, group.ID)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CountryGroupsResponse{Groups: groups, Total: len(groups)})
+}
+
+// handleUpsertCountryGroup creates or replaces the custom group given by the
+// {id} path parameter. Rules blocking the group follow its new countries.
+func handleUpsertCountryGroup(w http.ResponseWriter, r *http.Request) {
+	var group geoblock.CountryGroup
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	group.ID = normalizeCountryGroupID(r.PathValue("id"))
+
+	var rules []string
+	previous, err := updatePolicy(r, "upsert-country-group", func(policy *geoblock.Policy) error {
+		replaced := false
+		for i := range policy.CountryGroups {
+			if normalizeCountryGroupID(policy.CountryGroups[i].ID) == group.ID {
+				policy.CountryGroups[i] = group
+				replaced = true
+			}
+		}
+		if !replaced {
+			policy.CountryGroups = append(policy.CountryGroups, group)
+		}
+		if err := normalizePolicy(policy); err != nil {
+			return fmt.Errorf("%w: %v", geoblock.ErrInvalidPolicy, err)
+		}
+		rules = countryGroupRules(policy, group.ID)
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "upsert-country-group", map[string]interface{}{
+		"group":     group.ID,
+		"countries": group.Countries,
+		"rules":     rules,
+		"before":    previous,
+		"after":     blocklist.Countries(),
+	})
+	fmt.Printf("🗺️  Saved country group %s: %v (used by %d rules)\n", group.ID, group.Countries, len(rules))
+
+	handleListCountryGroups(w, r)
+}
+
+// handleDeleteCountryGroup removes the custom group given by the {id} path
+// parameter, unless a rule still blocks it
+func handleDeleteCountryGroup(w http.ResponseWriter, r *http.Request) {
+	id := normalizeCountryGroupID(r.PathValue("id"))
+	if isBuiltinCountryGroup(id) {
+		writeError(w, r, fmt.Sprintf("Country group %q is built in and cannot be deleted", id), http.StatusBadRequest)
+		return
+	}
+
+	_, err := updatePolicy(r, "delete-country-group", func(policy *geoblock.Policy) error {
+		if rules := countryGroupRules(policy, id); len(rules) > 0 {
+			return fmt.Errorf("%w: country group %q is used by rules %v", geoblock.ErrInvalidPolicy, id, rules)
+		}
+		kept := policy.CountryGroups[:0]
+		for _, group := range policy.CountryGroups {
+			if group.ID != id {
+				kept = append(kept, group)
+			}
+		}
+		if len(kept) == len(policy.CountryGroups) {
+			return geoblock.ErrNoPolicyChange
+		}
+		policy.CountryGroups = kept
+		return nil
+	})
+	if errors.Is(err, geoblock.ErrNoPolicyChange) {
+		writeError(w, r, fmt.Sprintf("Country group %q not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "delete-country-group", map[string]interface{}{"group": id})
+	fmt.Printf("🗑️  Deleted country group %s\n", id)
+
+	handleListCountryGroups(w, r)
+}
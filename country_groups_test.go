@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestNormalizeCountryGroups(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     geoblock.Policy
+		wantErr    bool
+		wantGroups []string
+	}{
+		{
+			name: "custom and built-in groups",
+			policy: geoblock.Policy{
+				CountryGroups: []geoblock.CountryGroup{{ID: "High-Risk", Countries: []string{"kp", "Iran"}}},
+				Rules:         []geoblock.Rule{{ID: "r", Groups: []string{"EU", "eu", "high-risk"}}},
+			},
+			wantGroups: []string{"eu", "high-risk"},
+		},
+		{
+			name:    "unknown group",
+			policy:  geoblock.Policy{Rules: []geoblock.Rule{{ID: "r", Groups: []string{"mercosur"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "custom group reusing a built-in id",
+			policy:  geoblock.Policy{CountryGroups: []geoblock.CountryGroup{{ID: "eu", Countries: []string{"FR"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid id",
+			policy:  geoblock.Policy{CountryGroups: []geoblock.CountryGroup{{ID: "high risk", Countries: []string{"FR"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid country",
+			policy:  geoblock.Policy{CountryGroups: []geoblock.CountryGroup{{ID: "x", Countries: []string{"XX"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "empty group",
+			policy:  geoblock.Policy{CountryGroups: []geoblock.CountryGroup{{ID: "x"}}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate id",
+			policy: geoblock.Policy{CountryGroups: []geoblock.CountryGroup{
+				{ID: "x", Countries: []string{"FR"}}, {ID: "X", Countries: []string{"DE"}},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			err := normalizePolicy(&policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(policy.Rules[0].Groups, tt.wantGroups) {
+				t.Errorf("rule groups = %v, want %v", policy.Rules[0].Groups, tt.wantGroups)
+			}
+			if got := policy.CountryGroups[0]; got.ID != "high-risk" || !reflect.DeepEqual(got.Countries, []string{"KP", "IR"}) {
+				t.Errorf("custom group = %+v, want high-risk [KP IR]", got)
+			}
+		})
+	}
+}
+
+func TestExpandCountryGroups(t *testing.T) {
+	policy := &geoblock.Policy{CountryGroups: []geoblock.CountryGroup{{ID: "high-risk", Countries: []string{"KP", "IR"}}}}
+
+	got := expandCountryGroups(policy, []string{"US", "GCC", "high-risk", "narnia"})
+	want := []string{"US", "AE", "BH", "KW", "OM", "QA", "SA", "KP", "IR", "narnia"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandCountryGroups() = %v, want %v", got, want)
+	}
+}
+
+func TestCountryGroupRules(t *testing.T) {
+	policy := &geoblock.Policy{Rules: []geoblock.Rule{
+		{ID: "eu-block", Groups: []string{"eu"}},
+		{ID: "gulf", Groups: []string{"gcc", "eu"}},
+		{ID: "plain", Countries: []string{"FR"}},
+	}}
+	if got := countryGroupRules(policy, "eu"); !reflect.DeepEqual(got, []string{"eu-block", "gulf"}) {
+		t.Errorf("countryGroupRules(eu) = %v", got)
+	}
+	if got := countryGroupRules(policy, "asean"); len(got) != 0 {
+		t.Errorf("countryGroupRules(asean) = %v, want none", got)
+	}
+}
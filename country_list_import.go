@@ -0,0 +1,452 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// xlsxContentType is the media type of Excel workbooks
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// countryColumnHeaders are the header names recognized as the country
+// column when ?column= is not given
+var countryColumnHeaders = []string{"country", "country code", "country_code", "code", "iso", "iso code", "alpha2", "alpha-2", "country name"}
+
+// CountryListRow reports how one spreadsheet row was read. Status is ok,
+// duplicate, empty or invalid; a country group expands to several countries.
+type CountryListRow struct {
+	Row       int      `json:"row"`
+	Value     string   `json:"value"`
+	Status    string   `json:"status"`
+	Countries []string `json:"countries,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type CountryListImportResponse struct {
+	Success          bool             `json:"success"`
+	Message          string           `json:"message"`
+	DryRun           bool             `json:"dry_run,omitempty"`
+	Version          int              `json:"version,omitempty"`
+	Format           string           `json:"format"`
+	Column           string           `json:"column"`
+	Rows             []CountryListRow `json:"rows"`
+	Invalid          int              `json:"invalid"`
+	BlockedCountries []string         `json:"blocked_countries"`
+	Added            []string         `json:"added"`
+	Removed          []string         `json:"removed"`
+	Warnings         []string         `json:"warnings,omitempty"`
+}
+
+// countryListUpload returns the uploaded spreadsheet and its format, csv or
+// xlsx, if the import request carries one: as the body with ?format= or a
+// CSV or XLSX Content-Type, or as the "file" field of a multipart form
+func countryListUpload(w http.ResponseWriter, r *http.Request) (data []byte, format string, ok bool, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format = r.URL.Query().Get("format")
+	switch {
+	case mediaType == "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, maxPolicyDocumentSize)
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", true, fmt.Errorf("multipart upload needs a \"file\" field: %w", err)
+		}
+		defer file.Close()
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		data, err = io.ReadAll(file)
+		if err != nil {
+			return nil, "", true, err
+		}
+	case format == "csv" || format == "xlsx":
+	case mediaType == "text/csv":
+		format = "csv"
+	case mediaType == xlsxContentType:
+		format = "xlsx"
+	default:
+		return nil, "", false, nil
+	}
+	if format != "csv" && format != "xlsx" {
+		return nil, "", true, fmt.Errorf("invalid format %q: upload a .csv or .xlsx file", format)
+	}
+	if data == nil {
+		data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicyDocumentSize))
+	}
+	return data, format, true, err
+}
+
+// readCountryListTable parses a CSV file or the first sheet of an XLSX
+// workbook into rows of cells
+func readCountryListTable(data []byte, format string) ([][]string, error) {
+	if format == "xlsx" {
+		return readXLSXSheet(data)
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// countryListColumn finds the country column from ?column=, a header name
+// or a 1-based column number, or else from the header row. It reports
+// whether the first row is a header.
+func countryListColumn(rows [][]string, column string) (index int, name string, header bool, err error) {
+	var first []string
+	if len(rows) > 0 {
+		first = rows[0]
+	}
+	if column != "" {
+		if n, err := strconv.Atoi(column); err == nil {
+			if n < 1 {
+				return 0, "", false, fmt.Errorf("invalid column %q: columns are numbered from 1", column)
+			}
+			// A header is assumed when the first row is not a country
+			header := n <= len(first) && strings.TrimSpace(first[n-1]) != "" && !isCountryListEntry(first[n-1])
+			return n - 1, column, header, nil
+		}
+		for i, cell := range first {
+			if strings.EqualFold(strings.TrimSpace(cell), column) {
+				return i, column, true, nil
+			}
+		}
+		return 0, "", false, fmt.Errorf("no column named %q in the header row", column)
+	}
+	for i, cell := range first {
+		if slices.Contains(countryColumnHeaders, strings.ToLower(strings.TrimSpace(cell))) {
+			return i, strings.TrimSpace(cell), true, nil
+		}
+	}
+	header = len(first) > 0 && !isCountryListEntry(first[0])
+	return 0, "1", header, nil
+}
+
+// isCountryListEntry reports whether a cell names a country or country group
+func isCountryListEntry(cell string) bool {
+	for _, code := range expandCountryGroups(blocklist.Policy(), []string{strings.TrimSpace(cell)}) {
+		if _, err := normalizeCountryCode(code); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCountryList validates the country column of every row, numbering rows
+// as a spreadsheet does, and returns the de-duplicated countries
+func parseCountryList(policy *geoblock.Policy, rows [][]string, column int, header bool) ([]CountryListRow, []string) {
+	var report []CountryListRow
+	var countries []string
+	for i, cells := range rows {
+		if header && i == 0 {
+			continue
+		}
+		row := CountryListRow{Row: i + 1, Status: "ok"}
+		if column < len(cells) {
+			row.Value = strings.TrimSpace(cells[column])
+		}
+		if row.Value == "" {
+			row.Status = "empty"
+			report = append(report, row)
+			continue
+		}
+
+		codes, invalid := normalizeCountryCodes(expandCountryGroups(policy, []string{row.Value}))
+		if len(invalid) > 0 {
+			row.Status, row.Error = "invalid", invalid[0].Error
+			report = append(report, row)
+			continue
+		}
+		row.Countries = codes
+		duplicate := true
+		for _, code := range codes {
+			if !slices.Contains(countries, code) {
+				countries = append(countries, code)
+				duplicate = false
+			}
+		}
+		if duplicate {
+			row.Status = "duplicate"
+		}
+		report = append(report, row)
+	}
+	return report, countries
+}
+
+// handleImportCountryList replaces the blocked countries with a list from a
+// CSV or XLSX spreadsheet. Every row is reported; any invalid row rejects
+// the import. With ?dry_run=true it is only a preview of the change.
+func handleImportCountryList(w http.ResponseWriter, r *http.Request, data []byte, format string) {
+	rows, err := readCountryListTable(data, format)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	column, name, header, err := countryListColumn(rows, r.URL.Query().Get("column"))
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, countries := parseCountryList(blocklist.Policy(), rows, column, header)
+	response := CountryListImportResponse{
+		Success:          true,
+		DryRun:           r.URL.Query().Get("dry_run") == "true",
+		Format:           format,
+		Column:           name,
+		Rows:             report,
+		BlockedCountries: countries,
+		Added:            []string{},
+		Removed:          []string{},
+	}
+	if response.Rows == nil {
+		response.Rows = []CountryListRow{}
+	}
+	if response.BlockedCountries == nil {
+		response.BlockedCountries = []string{}
+	}
+	current := blocklist.Policy().BlockedCountries
+	for _, code := range countries {
+		if !slices.Contains(current, code) {
+			response.Added = append(response.Added, code)
+		}
+	}
+	for _, code := range current {
+		if !slices.Contains(countries, code) {
+			response.Removed = append(response.Removed, code)
+		}
+	}
+	for _, row := range report {
+		if row.Status == "invalid" {
+			response.Invalid++
+		}
+	}
+
+	violations := checkBlockGuardrails(blocklist.Countries(), countries, trafficAnalytics.Summary(blockGuardrailWindow, time.Now()))
+	for _, violation := range violations {
+		response.Warnings = append(response.Warnings, violation.Message)
+	}
+
+	if response.DryRun {
+		response.Success = response.Invalid == 0
+		response.Message = fmt.Sprintf("Preview: %d countries would be blocked (%d added, %d removed); nothing was changed",
+			len(countries), len(response.Added), len(response.Removed))
+		if response.Invalid > 0 {
+			response.Message = fmt.Sprintf("%d rows are not valid countries and must be fixed before importing", response.Invalid)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if response.Invalid > 0 {
+		invalid := slices.DeleteFunc(slices.Clone(report), func(row CountryListRow) bool { return row.Status != "invalid" })
+		writeErrorDetails(w, r, http.StatusBadRequest, "invalid_country",
+			fmt.Sprintf("%d rows are not valid countries; nothing was changed", response.Invalid), invalid)
+		return
+	}
+	if len(violations) > 0 && blockGuardrailReject && r.URL.Query().Get("override") != "true" {
+		writeErrorDetails(w, r, http.StatusConflict, "block_guardrail",
+			"The import exceeds the blocking guardrails; repeat it with ?override=true to apply it anyway", violations)
+		return
+	}
+
+	previous, version, err := updatePolicyVersion(r, "import-country-list", func(policy *geoblock.Policy) error {
+		policy.BlockedCountries = countries
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	details := map[string]interface{}{
+		"format":  format,
+		"column":  name,
+		"version": version.Version,
+		"before":  previous,
+		"after":   countries,
+	}
+	if len(violations) > 0 {
+		details["guardrails_exceeded"] = violations
+	}
+	recordAudit(r, "import-country-list", details)
+	fmt.Printf("📥 Imported %d blocked countries from a %s file\n", len(countries), format)
+
+	response.Version = version.Version
+	response.Message = fmt.Sprintf("Blocked %d countries from the %s file as version %d", len(countries), format, version.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// readXLSXSheet reads the cell text of the first worksheet of an XLSX
+// workbook; formulas are read as their cached values
+func readXLSXSheet(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var shared struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXLSXPart(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetPath, err := firstXLSXSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var sheet struct {
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeXLSXPart(files[sheetPath], &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		// Rows and cells without content are left out of the file
+		for row.Number > len(rows)+1 {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for i, cell := range row.Cells {
+			column := i
+			if cell.Ref != "" {
+				column = xlsxColumn(cell.Ref)
+			}
+			for len(cells) < column {
+				cells = append(cells, "")
+			}
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid XLSX file: cell %s refers to a missing string", cell.Ref)
+				}
+				value = shared.Items[index].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			}
+			cells = append(cells, value)
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// xlsxText is rich or plain text in a shared string or inline string cell
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	text := t.Text
+	for _, run := range t.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+// firstXLSXSheet returns the archive path of the workbook's first sheet
+func firstXLSXSheet(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeXLSXPart(files["xl/workbook.xml"], &workbook); err != nil {
+		return "", err
+	}
+	if err := decodeXLSXPart(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("invalid XLSX file: the workbook has no sheets")
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		target := path.Join("xl", rel.Target)
+		if strings.HasPrefix(rel.Target, "/") {
+			target = strings.TrimPrefix(rel.Target, "/")
+		}
+		if _, ok := files[target]; ok {
+			return target, nil
+		}
+	}
+	return "", errors.New("invalid XLSX file: the first sheet is missing")
+}
+
+// decodeXLSXPart decodes one XML part of a workbook
+func decodeXLSXPart(file *zip.File, v any) error {
+	if file == nil {
+		return errors.New("invalid XLSX file: not an Excel workbook")
+	}
+	part, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("invalid XLSX file: %w", err)
+	}
+	defer part.Close()
+	if err := xml.NewDecoder(part).Decode(v); err != nil {
+		return fmt.Errorf("invalid XLSX file: %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+// xlsxColumn converts the letters of a cell reference such as "AB12" to a
+// 0-based column index
+func xlsxColumn(ref string) int {
+	column := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		column = column*26 + int(c-'A'+1)
+	}
+	return column - 1
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestParseCountryListCSV(t *testing.T) {
+	data := []byte("Name,Country Code,Note\nRussia,RU,\nNorth Korea,prk,\nNowhere,ZZ,typo\nEmpty,,\nAgain,RU,\n")
+	rows, err := readCountryListTable(data, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	column, name, header, err := countryListColumn(rows, "")
+	if err != nil || column != 1 || name != "Country Code" || !header {
+		t.Fatalf("countryListColumn = %d, %q, %v, %v; want column 1 with a header", column, name, header, err)
+	}
+
+	report, countries := parseCountryList(&geoblock.Policy{}, rows, column, header)
+	if strings.Join(countries, ",") != "RU,KP" {
+		t.Errorf("countries = %v, want [RU KP]", countries)
+	}
+	var statuses []string
+	for _, row := range report {
+		statuses = append(statuses, row.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "ok,ok,invalid,empty,duplicate" {
+		t.Errorf("statuses = %s", got)
+	}
+	if report[2].Row != 4 || report[2].Error == "" {
+		t.Errorf("invalid row = %+v, want row 4 with an error", report[2])
+	}
+}
+
+func TestCountryListColumn(t *testing.T) {
+	tests := []struct {
+		rows       [][]string
+		column     string
+		wantIndex  int
+		wantHeader bool
+		wantErr    bool
+	}{
+		{[][]string{{"RU"}, {"KP"}}, "", 0, false, false},
+		{[][]string{{"x", "RU"}}, "2", 1, false, false},
+		{[][]string{{"id", "blocked"}, {"1", "RU"}}, "blocked", 1, true, false},
+		{[][]string{{"id", "blocked"}, {"1", "RU"}}, "2", 1, true, false},
+		{[][]string{{"id"}}, "missing", 0, false, true},
+		{[][]string{{"RU"}}, "0", 0, false, true},
+	}
+	for _, tt := range tests {
+		index, _, header, err := countryListColumn(tt.rows, tt.column)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("column %q: err = %v", tt.column, err)
+			continue
+		}
+		if err == nil && (index != tt.wantIndex || header != tt.wantHeader) {
+			t.Errorf("column %q: got %d header %v, want %d header %v", tt.column, index, header, tt.wantIndex, tt.wantHeader)
+		}
+	}
+}
+
+func TestReadXLSXSheet(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Blocked" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>Country</t></si><si><r><t>Ru</t></r><r><t>ssia</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="B1" t="s"><v>0</v></c></row>
+<row r="2"><c r="B2" t="s"><v>1</v></c></row>
+<row r="4"><c r="A4"><v>7</v></c><c r="B4" t="inlineStr"><is><t>eu</t></is></c></row>
+</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		part, _ := archive.Create(name)
+		part.Write([]byte(content))
+	}
+	archive.Close()
+
+	rows, err := readCountryListTable(buf.Bytes(), "xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0][1] != "Country" || rows[1][1] != "Russia" || rows[2] != nil || rows[3][0] != "7" || rows[3][1] != "eu" {
+		t.Fatalf("rows = %q", rows)
+	}
+
+	column, _, header, err := countryListColumn(rows, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, countries := parseCountryList(&geoblock.Policy{}, rows, column, header)
+	if countries[0] != "RU" || len(countries) < 20 || report[len(report)-1].Row != 4 {
+		t.Errorf("countries = %v, report = %+v", countries, report)
+	}
+
+	if _, err := readCountryListTable([]byte("not a zip"), "xlsx"); err == nil {
+		t.Error("expected an error for a file that is not a workbook")
+	}
+}
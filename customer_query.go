@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultCustomerPageSize is how many customers a fetch-customers job
+	// result lists when no ?limit= is given
+	defaultCustomerPageSize = 100
+
+	// maxCustomerPageSize bounds ?limit=
+	maxCustomerPageSize = 1000
+)
+
+// CustomerQuery filters, sorts and pages the customers of a fetch-customers result
+type CustomerQuery struct {
+	Countries  []string
+	Tag        string
+	SortBy     string
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+// CustomerPage describes the slice of matching customers in a response
+type CustomerPage struct {
+	Limit      int  `json:"limit"`
+	Offset     int  `json:"offset"`
+	Matching   int  `json:"matching"`
+	Returned   int  `json:"returned"`
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// customerSortFields are the values of ?sort=, optionally prefixed with "-"
+// for descending order
+var customerSortFields = map[string]bool{"name": true, "address_count": true}
+
+// parseCustomerQuery reads ?country= (comma-separated codes or country
+// groups, any of which must match), ?tag=, ?sort=name|address_count|-name|-address_count,
+// ?limit= and ?offset=
+func parseCustomerQuery(values url.Values) (CustomerQuery, error) {
+	query := CustomerQuery{Limit: defaultCustomerPageSize, Tag: strings.ToLower(strings.TrimSpace(values.Get("tag")))}
+
+	codes := expandCountryGroups(blocklist.Policy(), strings.Split(values.Get("country"), ","))
+	for _, code := range codes {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			query.Countries = append(query.Countries, code)
+		}
+	}
+
+	if sortBy := values.Get("sort"); sortBy != "" {
+		query.SortBy, query.Descending = strings.TrimPrefix(sortBy, "-"), strings.HasPrefix(sortBy, "-")
+		if !customerSortFields[query.SortBy] {
+			return query, fmt.Errorf("invalid sort %q: use name or address_count, with - for descending", sortBy)
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxCustomerPageSize {
+			return query, fmt.Errorf("invalid limit %q: must be between 1 and %d", value, maxCustomerPageSize)
+		}
+		query.Limit = n
+	}
+	if value := values.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid offset %q: must be a non-negative integer", value)
+		}
+		query.Offset = n
+	}
+	return query, nil
+}
+
+// matches reports whether a customer passes the tag filter and has an
+// address in one of countries, the set of the query's countries
+func (q CustomerQuery) matches(customer CustomerCountry, countries map[string]bool) bool {
+	if q.Tag != "" && !slices.Contains(customer.Tags, q.Tag) {
+		return false
+	}
+	if len(countries) == 0 {
+		return true
+	}
+	for _, code := range customer.CountryCodes {
+		if countries[code] {
+			return true
+		}
+	}
+	return false
+}
+
+// less orders customers by the sort field, then by ID or hash, so pages are stable
+func (q CustomerQuery) less(a, b CustomerCountry) bool {
+	switch q.SortBy {
+	case "name":
+		if name, other := strings.ToLower(a.CustomerName), strings.ToLower(b.CustomerName); name != other {
+			return name < other != q.Descending
+		}
+	case "address_count":
+		if a.AddressCount != b.AddressCount {
+			return a.AddressCount < b.AddressCount != q.Descending
+		}
+	}
+	if a.CustomerID != b.CustomerID {
+		return a.CustomerID < b.CustomerID
+	}
+	return a.CustomerHash < b.CustomerHash
+}
+
+// Apply returns the report with only the requested page of matching
+// customers. Totals and aggregates still cover every customer.
+func (q CustomerQuery) Apply(report CustomerResponse) CustomerResponse {
+	countries := stringSet(q.Countries)
+	matching := make([]CustomerCountry, 0, len(report.CustomerCountries))
+	for _, customer := range report.CustomerCountries {
+		if q.matches(customer, countries) {
+			matching = append(matching, customer)
+		}
+	}
+	if q.SortBy != "" {
+		sort.SliceStable(matching, func(i, j int) bool { return q.less(matching[i], matching[j]) })
+	}
+
+	start := min(q.Offset, len(matching))
+	end := min(start+q.Limit, len(matching))
+	page := &CustomerPage{Limit: q.Limit, Offset: q.Offset, Matching: len(matching), Returned: end - start}
+	if end < len(matching) {
+		page.NextOffset = &end
+	}
+	report.CustomerCountries = matching[start:end]
+	report.Page = page
+	return report
+}
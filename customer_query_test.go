@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestCustomerQueryApply(t *testing.T) {
+	report := CustomerResponse{TotalCustomers: 4, UniqueCountries: []string{"DE", "FR", "US"}, CustomerCountries: []CustomerCountry{
+		{CustomerID: 1, CustomerName: "Carla", CountryCodes: []string{"DE"}, AddressCount: 2, Tags: []string{"vip"}},
+		{CustomerID: 2, CustomerName: "anna", CountryCodes: []string{"FR", "DE"}, AddressCount: 3},
+		{CustomerID: 3, CustomerName: "Bert", CountryCodes: []string{"US"}, AddressCount: 1, Tags: []string{"vip", "wholesale"}},
+		{CustomerID: 4, CustomerName: "Bert", CountryCodes: []string{"DE"}, AddressCount: 1},
+	}}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantIDs    []int64
+		wantNext   int
+		wantErr    bool
+		wantMatchN int
+	}{
+		{"defaults keep the order", "", []int64{1, 2, 3, 4}, -1, false, 4},
+		{"country", "country=de", []int64{1, 2, 4}, -1, false, 3},
+		{"any of several countries", "country=US,FR", []int64{2, 3}, -1, false, 2},
+		{"tag", "tag=VIP", []int64{1, 3}, -1, false, 2},
+		{"country and tag", "country=DE&tag=vip", []int64{1}, -1, false, 1},
+		{"name, ties by ID", "sort=name", []int64{2, 3, 4, 1}, -1, false, 4},
+		{"address count descending", "sort=-address_count", []int64{2, 1, 3, 4}, -1, false, 4},
+		{"first page", "sort=name&limit=2", []int64{2, 3}, 2, false, 4},
+		{"last page", "sort=name&limit=2&offset=2", []int64{4, 1}, -1, false, 4},
+		{"offset past the end", "offset=10", []int64{}, -1, false, 4},
+		{"unknown sort", "sort=email", nil, 0, true, 0},
+		{"limit too large", "limit=5000", nil, 0, true, 0},
+		{"negative offset", "offset=-1", nil, 0, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			query, err := parseCustomerQuery(values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCustomerQuery(%q) succeeded, want an error", tt.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := query.Apply(report)
+			ids := []int64{}
+			for _, customer := range got.CustomerCountries {
+				ids = append(ids, customer.CustomerID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("customers = %v, want %v", ids, tt.wantIDs)
+			}
+			if got.Page.Matching != tt.wantMatchN || got.TotalCustomers != 4 || len(got.UniqueCountries) != 3 {
+				t.Errorf("page = %+v, total = %d; want %d matching of 4", got.Page, got.TotalCustomers, tt.wantMatchN)
+			}
+			if next := got.Page.NextOffset; (next == nil) != (tt.wantNext < 0) || (next != nil && *next != tt.wantNext) {
+				t.Errorf("next_offset = %v, want %d", next, tt.wantNext)
+			}
+		})
+	}
+
+	if report.CustomerCountries[0].CustomerID != 1 {
+		t.Error("Apply reordered the stored report")
+	}
+}
+
+func BenchmarkCustomerQueryApply(b *testing.B) {
+	report := CustomerResponse{CustomerCountries: extractCountryCodes(syntheticCustomers(100000))}
+	query, err := parseCustomerQuery(url.Values{"country": {"eu,asean"}, "tag": {"vip"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		query.Apply(report)
+	}
+}
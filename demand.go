@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// demandMaxPages bounds how many pages of 250 abandoned checkouts or draft
+// orders one analysis reads
+const demandMaxPages = 40
+
+// abandonedCheckoutsQuery pages through the store's abandoned checkouts
+const abandonedCheckoutsQuery = `query AbandonedCheckouts($after: String) {
+  abandonedCheckouts(first: 250, after: $after) {
+    nodes {
+      shippingAddress { countryCodeV2 }
+      billingAddress { countryCodeV2 }
+      totalPriceSet { shopMoney { amount currencyCode } }
+    }
+    pageInfo { hasNextPage endCursor }
+  }
+}`
+
+// draftOrdersQuery pages through the store's draft orders
+const draftOrdersQuery = `query DraftOrders($after: String) {
+  draftOrders(first: 250, after: $after) {
+    nodes {
+      status
+      shippingAddress { countryCodeV2 }
+      billingAddress { countryCodeV2 }
+      totalPriceSet { shopMoney { amount currencyCode } }
+    }
+    pageInfo { hasNextPage endCursor }
+  }
+}`
+
+// demandNode is an abandoned checkout or draft order as returned by the
+// queries above
+type demandNode struct {
+	Status          string `json:"status"`
+	ShippingAddress *struct {
+		CountryCode string `json:"countryCodeV2"`
+	} `json:"shippingAddress"`
+	BillingAddress *struct {
+		CountryCode string `json:"countryCodeV2"`
+	} `json:"billingAddress"`
+	TotalPriceSet struct {
+		ShopMoney struct {
+			Amount       string `json:"amount"`
+			CurrencyCode string `json:"currencyCode"`
+		} `json:"shopMoney"`
+	} `json:"totalPriceSet"`
+}
+
+// DemandRecord is one abandoned checkout or open draft order: where it
+// would have shipped and its value in the shop currency
+type DemandRecord struct {
+	CountryCode string
+	Value       float64
+	Currency    string
+}
+
+// record attributes a node to its shipping country, or else its
+// billing country
+func (n demandNode) record() DemandRecord {
+	record := DemandRecord{Currency: n.TotalPriceSet.ShopMoney.CurrencyCode}
+	switch {
+	case n.ShippingAddress != nil && n.ShippingAddress.CountryCode != "":
+		record.CountryCode = n.ShippingAddress.CountryCode
+	case n.BillingAddress != nil:
+		record.CountryCode = n.BillingAddress.CountryCode
+	}
+	record.Value, _ = strconv.ParseFloat(n.TotalPriceSet.ShopMoney.Amount, 64)
+	return record
+}
+
+// fetchDemandRecords reads every page of an abandoned checkout or draft
+// order query, up to demandMaxPages, keeping the nodes keep accepts
+func fetchDemandRecords(ctx context.Context, token, query, field string, keep func(demandNode) bool) ([]DemandRecord, error) {
+	var records []DemandRecord
+	truncated, err := shopifyGraphQLPages(ctx, token, query, field, nil, demandMaxPages, func(data json.RawMessage) error {
+		var nodes []demandNode
+		if err := json.Unmarshal(data, &nodes); err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		for _, node := range nodes {
+			if keep == nil || keep(node) {
+				records = append(records, node.record())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		fmt.Printf("⚠️  Read only the first %d pages of %s\n", demandMaxPages, field)
+	}
+	return records, nil
+}
+
+// fetchAbandonedCheckouts returns the store's abandoned checkouts
+func fetchAbandonedCheckouts(ctx context.Context, token string) ([]DemandRecord, error) {
+	records, err := fetchDemandRecords(ctx, token, abandonedCheckoutsQuery, "abandonedCheckouts", nil)
+	if err != nil {
+		return nil, fmt.Errorf("abandoned checkouts: %w", err)
+	}
+	return records, nil
+}
+
+// fetchOpenDraftOrders returns the draft orders that have not been completed
+// yet; completed ones are already orders
+func fetchOpenDraftOrders(ctx context.Context, token string) ([]DemandRecord, error) {
+	records, err := fetchDemandRecords(ctx, token, draftOrdersQuery, "draftOrders", func(node demandNode) bool {
+		return node.Status != "COMPLETED"
+	})
+	if err != nil {
+		return nil, fmt.Errorf("draft orders: %w", err)
+	}
+	return records, nil
+}
+
+// DemandTotals counts abandoned checkouts and open draft orders and their value
+type DemandTotals struct {
+	AbandonedCheckouts int     `json:"abandoned_checkouts"`
+	AbandonedValue     float64 `json:"abandoned_value"`
+	DraftOrders        int     `json:"draft_orders"`
+	DraftOrderValue    float64 `json:"draft_order_value"`
+	TotalValue         float64 `json:"total_value"`
+}
+
+func (t *DemandTotals) add(other DemandTotals) {
+	t.AbandonedCheckouts += other.AbandonedCheckouts
+	t.AbandonedValue += other.AbandonedValue
+	t.DraftOrders += other.DraftOrders
+	t.DraftOrderValue += other.DraftOrderValue
+	t.TotalValue += other.TotalValue
+}
+
+func (t *DemandTotals) round() {
+	t.AbandonedValue = math.Round(t.AbandonedValue*100) / 100
+	t.DraftOrderValue = math.Round(t.DraftOrderValue*100) / 100
+	t.TotalValue = math.Round(t.TotalValue*100) / 100
+}
+
+// CountryDemand is the unconverted demand from one country
+type CountryDemand struct {
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country_name"`
+	Blocked     bool   `json:"blocked"`
+	DemandTotals
+}
+
+// BlockedDemandResponse shows what revenue geo-blocking might be preventing:
+// abandoned checkouts and open draft orders per country, and how much of
+// their value comes from blocked countries
+type BlockedDemandResponse struct {
+	Currency  string          `json:"currency,omitempty"`
+	Countries []CountryDemand `json:"countries"`
+	Total     DemandTotals    `json:"total"`
+	Blocked   DemandTotals    `json:"blocked"`
+
+	// BlockedShare is the share of the total value from blocked countries
+	BlockedShare float64 `json:"blocked_share"`
+}
+
+// summarizeDemand totals abandoned checkouts and draft orders per country,
+// highest value first. Records without a country count towards the total
+// only.
+func summarizeDemand(checkouts, drafts []DemandRecord, blocked func(string) bool) BlockedDemandResponse {
+	response := BlockedDemandResponse{Countries: []CountryDemand{}}
+	byCountry := make(map[string]*CountryDemand)
+	add := func(record DemandRecord, totals DemandTotals) {
+		if response.Currency == "" {
+			response.Currency = record.Currency
+		}
+		response.Total.add(totals)
+		if record.CountryCode == "" {
+			return
+		}
+		country := byCountry[record.CountryCode]
+		if country == nil {
+			country = &CountryDemand{CountryCode: record.CountryCode, Blocked: blocked(record.CountryCode)}
+			country.CountryName, _ = getCountryName(record.CountryCode)
+			byCountry[record.CountryCode] = country
+		}
+		country.add(totals)
+		if country.Blocked {
+			response.Blocked.add(totals)
+		}
+	}
+	for _, record := range checkouts {
+		add(record, DemandTotals{AbandonedCheckouts: 1, AbandonedValue: record.Value, TotalValue: record.Value})
+	}
+	for _, record := range drafts {
+		add(record, DemandTotals{DraftOrders: 1, DraftOrderValue: record.Value, TotalValue: record.Value})
+	}
+
+	for _, country := range byCountry {
+		country.round()
+		response.Countries = append(response.Countries, *country)
+	}
+	sort.Slice(response.Countries, func(i, j int) bool {
+		a, b := response.Countries[i], response.Countries[j]
+		if a.TotalValue != b.TotalValue {
+			return a.TotalValue > b.TotalValue
+		}
+		return a.CountryCode < b.CountryCode
+	})
+	if response.Total.TotalValue > 0 {
+		response.BlockedShare = math.Round(response.Blocked.TotalValue/response.Total.TotalValue*1000) / 1000
+	}
+	response.Total.round()
+	response.Blocked.round()
+	return response
+}
+
+// handleBlockedDemand reports the demand from blocked countries in the
+// store's abandoned checkouts and draft orders
+func handleBlockedDemand(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("🔍 Analyzing abandoned checkouts and draft orders...")
+
+	fail := func(err error) {
+		fmt.Printf("❌ Error fetching store data: %v\n", err)
+		writeError(w, r, fmt.Sprintf("Failed to fetch store data: %v", err), http.StatusInternalServerError)
+	}
+
+	token := shopifyToken(currentShopifyConfig.APIKey)
+	checkouts, err := fetchAbandonedCheckouts(r.Context(), token)
+	if err != nil {
+		fail(err)
+		return
+	}
+	drafts, err := fetchOpenDraftOrders(r.Context(), token)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	response := summarizeDemand(checkouts, drafts, blocklist.IsBlocked)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	fmt.Printf("✅ %.1f%% of %.2f %s unconverted demand is from blocked countries\n",
+		response.BlockedShare*100, response.Total.TotalValue, response.Currency)
+}
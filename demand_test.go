@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDemandNodeRecord(t *testing.T) {
+	var nodes []demandNode
+	err := json.Unmarshal([]byte(`[
+		{"shippingAddress": {"countryCodeV2": "RU"}, "billingAddress": {"countryCodeV2": "DE"}, "totalPriceSet": {"shopMoney": {"amount": "12.50", "currencyCode": "EUR"}}},
+		{"shippingAddress": null, "billingAddress": {"countryCodeV2": "DE"}, "totalPriceSet": {"shopMoney": {"amount": "3", "currencyCode": "EUR"}}},
+		{"totalPriceSet": {"shopMoney": {"amount": "1", "currencyCode": "EUR"}}}
+	]`), &nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DemandRecord{{"RU", 12.5, "EUR"}, {"DE", 3, "EUR"}, {"", 1, "EUR"}}
+	for i, node := range nodes {
+		if got := node.record(); got != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestSummarizeDemand(t *testing.T) {
+	checkouts := []DemandRecord{{"RU", 100, "USD"}, {"RU", 50.255, "USD"}, {"FR", 80, "USD"}, {"", 10, "USD"}}
+	drafts := []DemandRecord{{"KP", 60, "USD"}, {"FR", 20, "USD"}}
+	blocked := func(code string) bool { return code == "RU" || code == "KP" }
+
+	response := summarizeDemand(checkouts, drafts, blocked)
+	if response.Currency != "USD" || len(response.Countries) != 3 {
+		t.Fatalf("response = %+v", response)
+	}
+	if first := response.Countries[0]; first.CountryCode != "RU" || first.AbandonedCheckouts != 2 || first.AbandonedValue != 150.26 || !first.Blocked {
+		t.Errorf("first country = %+v", first)
+	}
+	if second := response.Countries[1]; second.CountryCode != "FR" || second.DraftOrders != 1 || second.TotalValue != 100 || second.Blocked {
+		t.Errorf("second country = %+v", second)
+	}
+	if response.Total.AbandonedCheckouts != 4 || response.Total.DraftOrders != 2 || response.Total.TotalValue != 320.26 {
+		t.Errorf("total = %+v", response.Total)
+	}
+	if response.Blocked.AbandonedCheckouts != 2 || response.Blocked.DraftOrders != 1 || response.Blocked.TotalValue != 210.26 {
+		t.Errorf("blocked = %+v", response.Blocked)
+	}
+	if response.BlockedShare != 0.657 {
+		t.Errorf("blocked share = %v, want 0.657", response.BlockedShare)
+	}
+
+	if empty := summarizeDemand(nil, nil, blocked); empty.Countries == nil || empty.BlockedShare != 0 {
+		t.Errorf("empty response = %+v", empty)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// diagnosticsAddr is where pprof profiles and expvar variables are served,
+// e.g. "127.0.0.1:6060"; empty disables them. They are kept off the API port
+// so they can be firewalled separately.
+var diagnosticsAddr = getEnv("DIAGNOSTICS_ADDR", "")
+
+// publishDiagnostics adds the service's own variables to /debug/vars, next
+// to the runtime's memstats and cmdline
+func publishDiagnostics() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	expvar.Publish("geo_providers", expvar.Func(func() any { return geoResolver.ProviderStatuses() }))
+	expvar.Publish("jobs", expvar.Func(func() any { return jobs.Counts() }))
+	expvar.Publish("shopify_page_cache", expvar.Func(func() any {
+		pages, bytes := shopifyPages.Stats()
+		return map[string]int{"pages": pages, "bytes": bytes}
+	}))
+}
+
+// diagnosticsMux serves net/http/pprof under /debug/pprof/ and expvar at
+// /debug/vars, all for admins only
+func diagnosticsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/", requireAdminLogin(pprof.Index))
+	mux.HandleFunc("GET /debug/pprof/cmdline", requireAdminLogin(pprof.Cmdline))
+	mux.HandleFunc("GET /debug/pprof/profile", requireAdminLogin(pprof.Profile))
+	mux.HandleFunc("GET /debug/pprof/symbol", requireAdminLogin(pprof.Symbol))
+	mux.HandleFunc("POST /debug/pprof/symbol", requireAdminLogin(pprof.Symbol))
+	mux.HandleFunc("GET /debug/pprof/trace", requireAdminLogin(pprof.Trace))
+	mux.HandleFunc("GET /debug/vars", requireAdminLogin(expvar.Handler().ServeHTTP))
+	return mux
+}
+
+// startDiagnostics serves the diagnostics on DIAGNOSTICS_ADDR. Without API
+// tokens there is no way to protect them, so they stay off.
+func startDiagnostics() {
+	if diagnosticsAddr == "" {
+		return
+	}
+	if !authEnabled() {
+		fmt.Println("⚠️  DIAGNOSTICS_ADDR is set but no API tokens are configured; diagnostics are off")
+		return
+	}
+	publishDiagnostics()
+
+	// No write timeout: CPU profiles and traces run for ?seconds=
+	server := &http.Server{
+		Addr:              diagnosticsAddr,
+		Handler:           diagnosticsMux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		fmt.Printf("🩺 Diagnostics (pprof, expvar) on %s\n", diagnosticsAddr)
+		if err := server.ListenAndServe(); err != nil {
+			fmt.Printf("❌ Diagnostics server stopped: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticsAuth(t *testing.T) {
+	saved := apiTokens
+	apiTokens = map[string]*Principal{
+		"admin-token":    {Name: "admin", Role: RoleAdmin},
+		"operator-token": {Name: "operator", Role: RoleOperator},
+	}
+	t.Cleanup(func() { apiTokens = saved })
+
+	mux := diagnosticsMux()
+	tests := []struct {
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		{"/debug/pprof/", "", http.StatusUnauthorized, ""},
+		{"/debug/pprof/", "operator-token", http.StatusForbidden, ""},
+		{"/debug/pprof/", "admin-token", http.StatusOK, "goroutine"},
+		{"/debug/pprof/goroutine?debug=1", "admin-token", http.StatusOK, "goroutine profile"},
+		{"/debug/vars", "", http.StatusUnauthorized, ""},
+		{"/debug/vars", "admin-token", http.StatusOK, "memstats"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.SetBasicAuth("admin", tt.token)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		if recorder.Code != tt.status {
+			t.Errorf("GET %s with %q = %d, want %d", tt.path, tt.token, recorder.Code, tt.status)
+			continue
+		}
+		if !strings.Contains(recorder.Body.String(), tt.body) {
+			t.Errorf("GET %s body lacks %q", tt.path, tt.body)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// edgeConnectorName selects where the blocklist is enforced in front of the
+// server: "aws-waf", "fastly", or empty to only block in this server
+var edgeConnectorName = getEnv("EDGE_CONNECTOR", "")
+
+// errNothingToRollBack is returned by Rollback before anything was applied
+var errNothingToRollBack = errors.New("nothing to roll back: no edge change has been applied since the server started")
+
+// EdgeConnector reads and replaces the countries blocked by an edge provider
+// such as a CDN or web application firewall
+type EdgeConnector interface {
+	Name() string
+	BlockedCountries(ctx context.Context) ([]string, error)
+	SetBlockedCountries(ctx context.Context, countries []string) error
+}
+
+// EdgeDiff compares what the edge blocks with what it should block
+type EdgeDiff struct {
+	Connector string   `json:"connector"`
+	Current   []string `json:"current"`
+	Desired   []string `json:"desired"`
+	Add       []string `json:"add"`
+	Remove    []string `json:"remove"`
+	InSync    bool     `json:"in_sync"`
+	AppliedAt string   `json:"applied_at,omitempty"`
+}
+
+// EdgeSync runs the diff, apply and rollback lifecycle against one connector.
+// Each apply remembers what the edge blocked before, so it can be rolled back.
+type EdgeSync struct {
+	mu        sync.Mutex
+	connector EdgeConnector
+	previous  []string
+	appliedAt string
+}
+
+// NewEdgeSync creates the lifecycle for a connector
+func NewEdgeSync(connector EdgeConnector) *EdgeSync {
+	return &EdgeSync{connector: connector}
+}
+
+// diffCountries lists the countries to add and remove to go from current to desired
+func diffCountries(current, desired []string) (add, remove []string) {
+	have := make(map[string]bool, len(current))
+	for _, code := range current {
+		have[code] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, code := range desired {
+		want[code] = true
+		if !have[code] {
+			add = append(add, code)
+		}
+	}
+	for _, code := range current {
+		if !want[code] {
+			remove = append(remove, code)
+		}
+	}
+	sort.Strings(add)
+	sort.Strings(remove)
+	return add, remove
+}
+
+// Diff reads the edge and compares it with desired
+func (e *EdgeSync) Diff(ctx context.Context, desired []string) (EdgeDiff, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.diff(ctx, desired)
+}
+
+// diff is Diff for callers holding e.mu
+func (e *EdgeSync) diff(ctx context.Context, desired []string) (EdgeDiff, error) {
+	current, err := e.connector.BlockedCountries(ctx)
+	if err != nil {
+		return EdgeDiff{}, fmt.Errorf("%s: %w", e.connector.Name(), err)
+	}
+	sort.Strings(current)
+	desired = append([]string{}, desired...)
+	sort.Strings(desired)
+
+	add, remove := diffCountries(current, desired)
+	return EdgeDiff{
+		Connector: e.connector.Name(),
+		Current:   append([]string{}, current...),
+		Desired:   desired,
+		Add:       append([]string{}, add...),
+		Remove:    append([]string{}, remove...),
+		InSync:    len(add) == 0 && len(remove) == 0,
+		AppliedAt: e.appliedAt,
+	}, nil
+}
+
+// Apply makes the edge block exactly desired. The diff returned is the one
+// that was applied; nothing is written when the edge is already in sync.
+func (e *EdgeSync) Apply(ctx context.Context, desired []string) (EdgeDiff, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	diff, err := e.diff(ctx, desired)
+	if err != nil || diff.InSync {
+		return diff, err
+	}
+	if err := e.connector.SetBlockedCountries(ctx, diff.Desired); err != nil {
+		return diff, fmt.Errorf("%s: %w", e.connector.Name(), err)
+	}
+	e.previous = diff.Current
+	e.appliedAt = time.Now().Format(time.RFC3339)
+	diff.AppliedAt = e.appliedAt
+	return diff, nil
+}
+
+// CanRollBack reports whether an apply can be rolled back
+func (e *EdgeSync) CanRollBack() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.previous != nil
+}
+
+// Rollback restores what the edge blocked before the last apply
+func (e *EdgeSync) Rollback(ctx context.Context) (EdgeDiff, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.previous == nil {
+		return EdgeDiff{}, errNothingToRollBack
+	}
+	diff, err := e.diff(ctx, e.previous)
+	if err != nil {
+		return diff, err
+	}
+	if err := e.connector.SetBlockedCountries(ctx, diff.Desired); err != nil {
+		return diff, fmt.Errorf("%s: %w", e.connector.Name(), err)
+	}
+	e.previous = nil
+	e.appliedAt = time.Now().Format(time.RFC3339)
+	diff.AppliedAt = e.appliedAt
+	return diff, nil
+}
+
+// newEdgeConnector creates the connector selected by EDGE_CONNECTOR from its environment settings
+func newEdgeConnector(name string) (EdgeConnector, error) {
+	switch strings.ToLower(name) {
+	case "aws-waf":
+		return newAWSWAFConnector()
+	case "fastly":
+		return newFastlyConnector()
+	default:
+		return nil, fmt.Errorf("unknown edge connector %q: use aws-waf or fastly", name)
+	}
+}
+
+// edgeSync is nil unless an edge connector is configured
+var edgeSync = loadEdgeSync()
+
+func loadEdgeSync() *EdgeSync {
+	if edgeConnectorName == "" {
+		return nil
+	}
+	connector, err := newEdgeConnector(edgeConnectorName)
+	if err != nil {
+		fmt.Printf("⚠️  Edge sync disabled: %v\n", err)
+		return nil
+	}
+	return NewEdgeSync(connector)
+}
+
+// edgeBlockedCountries is what the edge should block: every country the
+// blocklist enforces now, leaving out monitor-only countries
+func edgeBlockedCountries() []string {
+	countries := []string{}
+	for _, code := range blocklist.Countries() {
+		if blocklist.IsBlocked(code) {
+			countries = append(countries, code)
+		}
+	}
+	return countries
+}
+
+// requireEdgeSync writes an error unless an edge connector is configured
+func requireEdgeSync(w http.ResponseWriter, r *http.Request) bool {
+	if edgeSync == nil {
+		writeError(w, r, "No edge connector configured: set EDGE_CONNECTOR to aws-waf or fastly", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// writeEdgeDiff writes the diff, or a 502 if the edge provider failed
+func writeEdgeDiff(w http.ResponseWriter, r *http.Request, diff EdgeDiff, err error) {
+	if err != nil {
+		fmt.Printf("❌ Edge sync failed: %v\n", err)
+		writeError(w, r, fmt.Sprintf("Edge sync failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// handleEdgeDiff shows what applying the blocklist to the edge would change
+func handleEdgeDiff(w http.ResponseWriter, r *http.Request) {
+	if !requireEdgeSync(w, r) {
+		return
+	}
+	diff, err := edgeSync.Diff(r.Context(), edgeBlockedCountries())
+	writeEdgeDiff(w, r, diff, err)
+}
+
+// handleEdgeApply queues a job making the edge block the current blocklist;
+// the job's result is the applied diff
+func handleEdgeApply(w http.ResponseWriter, r *http.Request) {
+	if !requireEdgeSync(w, r) {
+		return
+	}
+	desired := edgeBlockedCountries()
+	submitJob(w, r, "edge-apply", func(ctx context.Context, progress func(JobProgress)) (interface{}, error) {
+		progress(JobProgress{Message: "Applying blocklist to " + edgeSync.connector.Name()})
+		diff, err := edgeSync.Apply(ctx, desired)
+		if err != nil {
+			fmt.Printf("❌ Edge sync failed: %v\n", err)
+			return nil, err
+		}
+		if !diff.InSync {
+			recordAudit(r, "edge-apply", map[string]interface{}{
+				"connector": diff.Connector,
+				"add":       diff.Add,
+				"remove":    diff.Remove,
+			})
+			fmt.Printf("🌐 %s now blocks %v (+%v -%v)\n", diff.Connector, diff.Desired, diff.Add, diff.Remove)
+		}
+		return diff, nil
+	})
+}
+
+// handleEdgeRollback queues a job restoring what the edge blocked before the last apply
+func handleEdgeRollback(w http.ResponseWriter, r *http.Request) {
+	if !requireEdgeSync(w, r) {
+		return
+	}
+	if !edgeSync.CanRollBack() {
+		writeError(w, r, errNothingToRollBack.Error(), http.StatusConflict)
+		return
+	}
+	submitJob(w, r, "edge-rollback", func(ctx context.Context, progress func(JobProgress)) (interface{}, error) {
+		progress(JobProgress{Message: "Rolling back " + edgeSync.connector.Name()})
+		diff, err := edgeSync.Rollback(ctx)
+		if err != nil {
+			fmt.Printf("❌ Edge rollback failed: %v\n", err)
+			return nil, err
+		}
+		recordAudit(r, "edge-rollback", map[string]interface{}{
+			"connector": diff.Connector,
+			"restored":  diff.Desired,
+		})
+		fmt.Printf("⏪ %s rolled back to blocking %v\n", diff.Connector, diff.Desired)
+		return diff, nil
+	})
+}
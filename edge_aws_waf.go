@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// awsWAFUpdatableFields are the web ACL fields UpdateWebACL takes back;
+// everything else GetWebACL returns is read-only
+var awsWAFUpdatableFields = []string{
+	"DefaultAction", "Description", "Rules", "VisibilityConfig", "CustomResponseBodies",
+	"CaptchaConfig", "ChallengeConfig", "TokenDomains", "AssociationConfig",
+}
+
+// AWSWAFConnector blocks countries with a geo match rule in an AWS WAF web ACL.
+// Other rules of the web ACL are left as they are.
+type AWSWAFConnector struct {
+	endpoint     string
+	region       string
+	scope        string
+	webACLName   string
+	webACLID     string
+	ruleName     string
+	rulePriority int
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	client          *http.Client
+}
+
+// newAWSWAFConnector reads the web ACL from AWS_WAF_WEB_ACL_NAME, AWS_WAF_WEB_ACL_ID
+// and AWS_WAF_SCOPE, and credentials from the standard AWS_* variables
+func newAWSWAFConnector() (*AWSWAFConnector, error) {
+	region := getEnv("AWS_REGION", "us-east-1")
+	connector := &AWSWAFConnector{
+		endpoint:        getEnv("AWS_WAF_ENDPOINT", fmt.Sprintf("https://wafv2.%s.amazonaws.com", region)),
+		region:          region,
+		scope:           strings.ToUpper(getEnv("AWS_WAF_SCOPE", "REGIONAL")),
+		webACLName:      getEnv("AWS_WAF_WEB_ACL_NAME", ""),
+		webACLID:        getEnv("AWS_WAF_WEB_ACL_ID", ""),
+		ruleName:        getEnv("AWS_WAF_RULE_NAME", "geoblock-countries"),
+		accessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		secretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		sessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		client:          newHTTPClient(30 * time.Second),
+	}
+	priority, err := strconv.Atoi(getEnv("AWS_WAF_RULE_PRIORITY", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWS_WAF_RULE_PRIORITY: %w", err)
+	}
+	connector.rulePriority = priority
+
+	if connector.webACLName == "" || connector.webACLID == "" {
+		return nil, fmt.Errorf("aws-waf connector needs AWS_WAF_WEB_ACL_NAME and AWS_WAF_WEB_ACL_ID")
+	}
+	if connector.accessKeyID == "" || connector.secretAccessKey == "" {
+		return nil, fmt.Errorf("aws-waf connector needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if connector.scope != "REGIONAL" && connector.scope != "CLOUDFRONT" {
+		return nil, fmt.Errorf("invalid AWS_WAF_SCOPE %q: use REGIONAL or CLOUDFRONT", connector.scope)
+	}
+	return connector, nil
+}
+
+func (a *AWSWAFConnector) Name() string { return "aws-waf" }
+
+// call invokes a WAFv2 API action such as GetWebACL
+func (a *AWSWAFConnector) call(ctx context.Context, action string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSWAF_20190729."+action)
+	signAWSRequest(req, body, time.Now().UTC(), a.region, "wafv2", a.accessKeyID, a.secretAccessKey, a.sessionToken)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d: %s", action, resp.StatusCode, string(data))
+	}
+	return json.Unmarshal(data, output)
+}
+
+// signAWSRequest adds an AWS Signature Version 4 Authorization header to the request
+func signAWSRequest(req *http.Request, body []byte, now time.Time, region, service, accessKeyID, secretAccessKey, sessionToken string) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// getWebACL returns the web ACL, kept as raw JSON so unknown fields survive an update, and its lock token
+func (a *AWSWAFConnector) getWebACL(ctx context.Context) (map[string]interface{}, string, error) {
+	var output struct {
+		WebACL    map[string]interface{} `json:"WebACL"`
+		LockToken string                 `json:"LockToken"`
+	}
+	input := map[string]string{"Name": a.webACLName, "Scope": a.scope, "Id": a.webACLID}
+	if err := a.call(ctx, "GetWebACL", input, &output); err != nil {
+		return nil, "", err
+	}
+	return output.WebACL, output.LockToken, nil
+}
+
+// geoMatchRule returns the managed rule of a web ACL and its index, or -1
+func (a *AWSWAFConnector) geoMatchRule(webACL map[string]interface{}) (map[string]interface{}, int) {
+	rules, _ := webACL["Rules"].([]interface{})
+	for i, rule := range rules {
+		if rule, ok := rule.(map[string]interface{}); ok && rule["Name"] == a.ruleName {
+			return rule, i
+		}
+	}
+	return nil, -1
+}
+
+// BlockedCountries reads the country codes of the managed geo match rule
+func (a *AWSWAFConnector) BlockedCountries(ctx context.Context) ([]string, error) {
+	webACL, _, err := a.getWebACL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	countries := []string{}
+	rule, _ := a.geoMatchRule(webACL)
+	statement, _ := rule["Statement"].(map[string]interface{})
+	geoMatch, _ := statement["GeoMatchStatement"].(map[string]interface{})
+	codes, _ := geoMatch["CountryCodes"].([]interface{})
+	for _, code := range codes {
+		if code, ok := code.(string); ok {
+			countries = append(countries, code)
+		}
+	}
+	return countries, nil
+}
+
+// SetBlockedCountries updates the managed rule's country codes, creating the
+// rule if needed. A geo match needs at least one country, so an empty list
+// removes the rule.
+func (a *AWSWAFConnector) SetBlockedCountries(ctx context.Context, countries []string) error {
+	webACL, lockToken, err := a.getWebACL(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules, _ := webACL["Rules"].([]interface{})
+	rule, index := a.geoMatchRule(webACL)
+	switch {
+	case len(countries) == 0 && index >= 0:
+		rules = append(rules[:index], rules[index+1:]...)
+	case len(countries) == 0:
+		return nil
+	case index >= 0:
+		rule["Statement"] = map[string]interface{}{"GeoMatchStatement": map[string]interface{}{"CountryCodes": countries}}
+	default:
+		rules = append(rules, map[string]interface{}{
+			"Name":      a.ruleName,
+			"Priority":  a.rulePriority,
+			"Statement": map[string]interface{}{"GeoMatchStatement": map[string]interface{}{"CountryCodes": countries}},
+			"Action":    map[string]interface{}{"Block": map[string]interface{}{}},
+			"VisibilityConfig": map[string]interface{}{
+				"SampledRequestsEnabled":   true,
+				"CloudWatchMetricsEnabled": true,
+				"MetricName":               a.ruleName,
+			},
+		})
+	}
+	webACL["Rules"] = rules
+
+	input := map[string]interface{}{
+		"Name":      a.webACLName,
+		"Scope":     a.scope,
+		"Id":        a.webACLID,
+		"LockToken": lockToken,
+	}
+	for _, field := range awsWAFUpdatableFields {
+		if value, ok := webACL[field]; ok {
+			input[field] = value
+		}
+	}
+	var output struct{}
+	return a.call(ctx, "UpdateWebACL", input, &output)
+}
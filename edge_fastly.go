@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// fastlyBlockedPrefix marks the line of a managed snippet listing its countries
+const fastlyBlockedPrefix = "# blocked: "
+
+// FastlyConnector blocks countries with a dynamic VCL snippet, which Fastly
+// updates without activating a new service version
+type FastlyConnector struct {
+	apiURL    string
+	token     string
+	serviceID string
+	snippetID string
+	client    *http.Client
+}
+
+// newFastlyConnector reads FASTLY_API_TOKEN, FASTLY_SERVICE_ID and FASTLY_SNIPPET_ID.
+// The snippet must be a dynamic "recv" snippet.
+func newFastlyConnector() (*FastlyConnector, error) {
+	connector := &FastlyConnector{
+		apiURL:    strings.TrimSuffix(getEnv("FASTLY_API_URL", "https://api.fastly.com"), "/"),
+		token:     getEnv("FASTLY_API_TOKEN", ""),
+		serviceID: getEnv("FASTLY_SERVICE_ID", ""),
+		snippetID: getEnv("FASTLY_SNIPPET_ID", ""),
+		client:    newHTTPClient(30 * time.Second),
+	}
+	if connector.token == "" || connector.serviceID == "" || connector.snippetID == "" {
+		return nil, fmt.Errorf("fastly connector needs FASTLY_API_TOKEN, FASTLY_SERVICE_ID and FASTLY_SNIPPET_ID")
+	}
+	return connector, nil
+}
+
+func (f *FastlyConnector) Name() string { return "fastly" }
+
+// renderFastlySnippet returns VCL that rejects requests from the countries
+func renderFastlySnippet(countries []string) string {
+	var b strings.Builder
+	b.WriteString("# Managed by the geo-blocking server; manual edits are overwritten\n")
+	b.WriteString(fastlyBlockedPrefix + strings.Join(countries, ",") + "\n")
+	if len(countries) > 0 {
+		fmt.Fprintf(&b, "if (client.geo.country_code ~ \"^(%s)$\") {\n", strings.Join(countries, "|"))
+		b.WriteString("  error 403 \"Forbidden\";\n")
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// parseFastlySnippet reads the countries back from a snippet written by renderFastlySnippet.
+// A snippet without the marker line blocks nothing.
+func parseFastlySnippet(content string) []string {
+	countries := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if list, ok := strings.CutPrefix(strings.TrimSpace(line), fastlyBlockedPrefix); ok {
+			for _, code := range strings.Split(list, ",") {
+				if code = strings.TrimSpace(code); code != "" {
+					countries = append(countries, code)
+				}
+			}
+		}
+	}
+	return countries
+}
+
+// snippet calls the dynamic snippet endpoint, returning the snippet's VCL
+func (f *FastlyConnector) snippet(ctx context.Context, method string, body io.Reader) (string, error) {
+	endpoint := fmt.Sprintf("%s/service/%s/snippet/%s", f.apiURL, url.PathEscape(f.serviceID), url.PathEscape(f.snippetID))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Fastly-Key", f.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(data))
+	}
+	var snippet struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(data, &snippet); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return snippet.Content, nil
+}
+
+// BlockedCountries reads the countries from the snippet
+func (f *FastlyConnector) BlockedCountries(ctx context.Context) ([]string, error) {
+	content, err := f.snippet(ctx, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseFastlySnippet(content), nil
+}
+
+// SetBlockedCountries rewrites the snippet to block exactly the countries
+func (f *FastlyConnector) SetBlockedCountries(ctx context.Context, countries []string) error {
+	form := url.Values{"content": {renderFastlySnippet(countries)}}
+	_, err := f.snippet(ctx, "PUT", strings.NewReader(form.Encode()))
+	return err
+}
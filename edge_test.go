@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEdge is an EdgeConnector kept in memory
+type fakeEdge struct {
+	countries []string
+	err       error
+}
+
+func (f *fakeEdge) Name() string { return "fake" }
+
+func (f *fakeEdge) BlockedCountries(ctx context.Context) ([]string, error) {
+	return append([]string{}, f.countries...), f.err
+}
+
+func (f *fakeEdge) SetBlockedCountries(ctx context.Context, countries []string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.countries = append([]string{}, countries...)
+	return nil
+}
+
+func TestEdgeSyncLifecycle(t *testing.T) {
+	edge := &fakeEdge{countries: []string{"CN", "RU"}}
+	sync := NewEdgeSync(edge)
+	ctx := context.Background()
+
+	if _, err := sync.Rollback(ctx); !errors.Is(err, errNothingToRollBack) {
+		t.Errorf("Rollback before apply = %v, want errNothingToRollBack", err)
+	}
+
+	diff, err := sync.Diff(ctx, []string{"RU", "KP"})
+	if err != nil || !reflect.DeepEqual(diff.Add, []string{"KP"}) || !reflect.DeepEqual(diff.Remove, []string{"CN"}) || diff.InSync {
+		t.Errorf("Diff = %+v, %v", diff, err)
+	}
+	if !reflect.DeepEqual(edge.countries, []string{"CN", "RU"}) {
+		t.Errorf("Diff changed the edge: %v", edge.countries)
+	}
+
+	if diff, err = sync.Apply(ctx, []string{"RU", "KP"}); err != nil || diff.AppliedAt == "" {
+		t.Fatalf("Apply = %+v, %v", diff, err)
+	}
+	if !reflect.DeepEqual(edge.countries, []string{"KP", "RU"}) {
+		t.Errorf("edge after apply = %v", edge.countries)
+	}
+	if diff, _ = sync.Diff(ctx, []string{"KP", "RU"}); !diff.InSync {
+		t.Errorf("Diff after apply = %+v, want in sync", diff)
+	}
+
+	if diff, err = sync.Rollback(ctx); err != nil || !reflect.DeepEqual(edge.countries, []string{"CN", "RU"}) {
+		t.Errorf("Rollback = %+v, %v; edge %v", diff, err, edge.countries)
+	}
+	if _, err := sync.Rollback(ctx); !errors.Is(err, errNothingToRollBack) {
+		t.Errorf("second Rollback = %v, want errNothingToRollBack", err)
+	}
+
+	edge.err = errors.New("edge down")
+	if _, err := sync.Apply(ctx, []string{"KP"}); err == nil || !strings.Contains(err.Error(), "fake: edge down") {
+		t.Errorf("Apply with failing edge = %v", err)
+	}
+}
+
+func TestFastlySnippet(t *testing.T) {
+	tests := [][]string{{"KP", "RU"}, {}}
+	for _, countries := range tests {
+		snippet := renderFastlySnippet(countries)
+		if got := parseFastlySnippet(snippet); !reflect.DeepEqual(got, countries) {
+			t.Errorf("parse(render(%v)) = %v\n%s", countries, got, snippet)
+		}
+		if strings.Contains(snippet, "error 403") != (len(countries) > 0) {
+			t.Errorf("render(%v) = %s", countries, snippet)
+		}
+	}
+	if got := parseFastlySnippet(`if (req.url ~ "^/admin") { error 403; }`); len(got) != 0 {
+		t.Errorf("unmanaged snippet parsed as %v", got)
+	}
+}
+
+func TestFastlyConnector(t *testing.T) {
+	content := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/service/svc/snippet/snip" || r.Header.Get("Fastly-Key") != "token" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if r.Method == "PUT" {
+			body, _ := io.ReadAll(r.Body)
+			form, _ := url.ParseQuery(string(body))
+			content = form.Get("content")
+		}
+		json.NewEncoder(w).Encode(map[string]string{"content": content})
+	}))
+	defer server.Close()
+
+	fastly := &FastlyConnector{apiURL: server.URL, token: "token", serviceID: "svc", snippetID: "snip", client: server.Client()}
+	ctx := context.Background()
+	if err := fastly.SetBlockedCountries(ctx, []string{"IR", "KP"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := fastly.BlockedCountries(ctx); err != nil || !reflect.DeepEqual(got, []string{"IR", "KP"}) {
+		t.Errorf("BlockedCountries = %v, %v", got, err)
+	}
+}
+
+func TestAWSWAFConnector(t *testing.T) {
+	webACL := map[string]interface{}{
+		"Name":          "shop",
+		"ARN":           "arn:aws:wafv2:read-only",
+		"DefaultAction": map[string]interface{}{"Allow": map[string]interface{}{}},
+		"Rules": []interface{}{
+			map[string]interface{}{"Name": "rate-limit", "Priority": 1},
+		},
+	}
+	var updates []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		var input map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&input)
+		switch r.Header.Get("X-Amz-Target") {
+		case "AWSWAF_20190729.GetWebACL":
+			json.NewEncoder(w).Encode(map[string]interface{}{"WebACL": webACL, "LockToken": "lock"})
+		case "AWSWAF_20190729.UpdateWebACL":
+			updates = append(updates, input)
+			webACL["Rules"] = input["Rules"]
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	waf := &AWSWAFConnector{
+		endpoint: server.URL, region: "us-east-1", scope: "REGIONAL", webACLName: "shop", webACLID: "id",
+		ruleName: "geoblock-countries", rulePriority: 5, accessKeyID: "AKID", secretAccessKey: "secret",
+		client: server.Client(),
+	}
+	ctx := context.Background()
+
+	if err := waf.SetBlockedCountries(ctx, []string{"CU", "KP"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := waf.BlockedCountries(ctx); err != nil || !reflect.DeepEqual(got, []string{"CU", "KP"}) {
+		t.Errorf("BlockedCountries = %v, %v", got, err)
+	}
+	update := updates[0]
+	if update["LockToken"] != "lock" || update["ARN"] != nil || update["DefaultAction"] == nil || len(update["Rules"].([]interface{})) != 2 {
+		t.Errorf("UpdateWebACL input = %v", update)
+	}
+
+	if err := waf.SetBlockedCountries(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rules := webACL["Rules"].([]interface{}); len(rules) != 1 || rules[0].(map[string]interface{})["Name"] != "rate-limit" {
+		t.Errorf("rules after clearing = %v, want only rate-limit", rules)
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite
+	req := httptest.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	req.Header = http.Header{}
+	signAWSRequest(req, nil, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC),
+		"us-east-1", "service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "")
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SMTP TLS modes: STARTTLS on a submission port, TLS from the first byte
+// (port 465), or plaintext for a relay on the local network
+const (
+	smtpSTARTTLS = "starttls"
+	smtpTLS      = "tls"
+	smtpNone     = "none"
+)
+
+// smtpConfig is the mail server email notifications are sent through
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	tls      string
+	timeout  time.Duration
+
+	// templateDir holds <event>.tmpl or default.tmpl overriding the
+	// built-in email template
+	templateDir string
+}
+
+var smtpSettings = smtpConfig{
+	host:        getEnv("SMTP_HOST", ""),
+	port:        getEnvInt("SMTP_PORT", 587),
+	username:    getEnv("SMTP_USERNAME", ""),
+	password:    getEnv("SMTP_PASSWORD", ""),
+	from:        getEnv("SMTP_FROM", ""),
+	tls:         strings.ToLower(getEnv("SMTP_TLS", smtpSTARTTLS)),
+	timeout:     getEnvDuration("SMTP_TIMEOUT", 30*time.Second),
+	templateDir: getEnv("EMAIL_TEMPLATE_DIR", ""),
+}
+
+// defaultEmailTemplate renders a notification as a plain-text email. Custom
+// templates define "subject" and "body" the same way, with the Notification
+// as data.
+const defaultEmailTemplate = `{{define "subject"}}[geoblock] {{.Title}}{{end}}
+{{- define "body"}}{{.Text}}
+{{range .Fields}}
+{{.Name}}: {{.Value}}{{end}}
+
+Event: {{.Event}}
+Time: {{.Time.UTC.Format "2006-01-02 15:04:05 MST"}}
+{{end}}`
+
+// emailTemplate returns the template for an event: <event>.tmpl or
+// default.tmpl from EMAIL_TEMPLATE_DIR if present, else the built-in one.
+// Templates are read for every email, so they can be edited in place.
+func emailTemplate(dir, event string) (*template.Template, error) {
+	tmpl := template.Must(template.New("email").Parse(defaultEmailTemplate))
+	if dir == "" {
+		return tmpl, nil
+	}
+	for _, name := range []string{event + ".tmpl", "default.tmpl"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("email template %s: %w", name, err)
+		}
+		break
+	}
+	return tmpl, nil
+}
+
+// renderEmail formats a notification as the headers and body of an email;
+// the recipients are added when it is sent
+func renderEmail(cfg smtpConfig, n Notification) ([]byte, error) {
+	tmpl, err := emailTemplate(cfg.templateDir, n.Event)
+	if err != nil {
+		return nil, err
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", n); err != nil {
+		return nil, fmt.Errorf("email subject: %w", err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", n); err != nil {
+		return nil, fmt.Errorf("email body: %w", err)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", cfg.from)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&message, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	encoder := quotedprintable.NewWriter(&message)
+	encoder.Write(bytes.ReplaceAll(body.Bytes(), []byte("\n"), []byte("\r\n")))
+	encoder.Close()
+	return message.Bytes(), nil
+}
+
+// sendEmail delivers a rendered email to recipients separated by ";"
+func sendEmail(cfg smtpConfig, recipients string, message []byte) error {
+	if cfg.host == "" || cfg.from == "" {
+		return errors.New("email notifications need SMTP_HOST and SMTP_FROM")
+	}
+	if err := egress.check(cfg.host); err != nil {
+		return err
+	}
+	var to []string
+	for _, recipient := range strings.Split(recipients, ";") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			to = append(to, recipient)
+		}
+	}
+	if len(to) == 0 {
+		return errors.New("no email recipients")
+	}
+
+	address := net.JoinHostPort(cfg.host, strconv.Itoa(cfg.port))
+	dialer := &net.Dialer{Timeout: cfg.timeout}
+	var conn net.Conn
+	var err error
+	if cfg.tls == smtpTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: cfg.host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(cfg.timeout))
+
+	client, err := smtp.NewClient(conn, cfg.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if cfg.tls == smtpSTARTTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: cfg.host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if cfg.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.username, cfg.password, cfg.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(cfg.from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("recipient %s refused: %w", recipient, err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(data, "To: %s\r\n", strings.Join(to, ", "))
+	if _, err := data.Write(message); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+)
+
+// emailHintConfidence marks email-derived countries as weak evidence
+const emailHintConfidence = "low"
+
+// genericCCTLDs are country-code TLDs widely used without any tie to the
+// country, e.g. .io for tech companies, so they say nothing about location
+var genericCCTLDs = map[string]bool{
+	"ai": true, "am": true, "cc": true, "co": true, "fm": true, "gg": true, "io": true,
+	"ly": true, "me": true, "nu": true, "to": true, "tv": true, "ws": true,
+}
+
+// ccTLDAliases maps country-code TLDs that differ from the ISO 3166 code
+var ccTLDAliases = map[string]string{
+	"uk": "GB",
+}
+
+// CountryHint is a weak signal of where a customer may be, from something other than an address
+type CountryHint struct {
+	CountryCode string `json:"country_code"`
+	Source      string `json:"source"`
+	Confidence  string `json:"confidence"`
+}
+
+// emailCountryHint returns the country of an email address's ccTLD, e.g.
+// "anna@example.de" -> "DE", or "" for generic TLDs like .com and .io
+func emailCountryHint(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(email[at+1:])), ".")
+	tld := domain[strings.LastIndex(domain, ".")+1:]
+	if len(tld) != 2 || tld == domain || genericCCTLDs[tld] {
+		return ""
+	}
+	if code, ok := ccTLDAliases[tld]; ok {
+		return code
+	}
+	if code := strings.ToUpper(tld); isValidCountryCode(code) {
+		return code
+	}
+	return ""
+}
+
+// addEmailCountryHints adds a low-confidence country hint from each customer's
+// email domain, useful for stores with sparse address data
+func addEmailCountryHints(customerCountries []CustomerCountry) {
+	for i := range customerCountries {
+		if code := emailCountryHint(customerCountries[i].CustomerEmail); code != "" {
+			customerCountries[i].CountryHints = append(customerCountries[i].CountryHints, CountryHint{
+				CountryCode: code,
+				Source:      "email_tld",
+				Confidence:  emailHintConfidence,
+			})
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestEmailCountryHint(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"anna@example.de", "DE"},
+		{"jean@mail.example.FR", "FR"},
+		{"taro@example.co.jp", "JP"},
+		{"sam@example.co.uk", "GB"},
+		{"kim@example.com", ""},
+		{"dev@startup.io", ""},
+		{"shop@brand.co", ""},
+		{"x@example.zz", ""},
+		{"not-an-email", ""},
+		{"user@localhost", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := emailCountryHint(tt.email); got != tt.want {
+			t.Errorf("emailCountryHint(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
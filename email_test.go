@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderEmail(t *testing.T) {
+	notification := shopifySyncFailedNotification(4, os.ErrDeadlineExceeded)
+	notification.Time = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	message, err := renderEmail(smtpConfig{from: "geoblock@example.com"}, notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(message)
+	for _, want := range []string{"From: geoblock@example.com\r\n", "Subject: [geoblock] Shopify sync failed\r\n", "Version: 4", "Event: shopify_sync_failed"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("email lacks %q:\n%s", want, text)
+		}
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "shopify_sync_failed.tmpl"), []byte(`{{define "subject"}}Sync broken: v{{(index .Fields 0).Value}}{{end}}`), 0o644)
+	message, err = renderEmail(smtpConfig{from: "geoblock@example.com", templateDir: dir}, notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(message); !strings.Contains(text, "Subject: Sync broken: v4\r\n") || !strings.Contains(text, "Event: shopify_sync_failed") {
+		t.Errorf("custom subject not used, or built-in body lost:\n%s", text)
+	}
+}
+
+func TestSendEmail(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		var commands []string
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if inData {
+				if line == "." {
+					inData = false
+					conn.Write([]byte("250 queued\r\n"))
+				} else {
+					commands = append(commands, line)
+				}
+				continue
+			}
+			commands = append(commands, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				conn.Write([]byte("250-localhost\r\n250 8BITMIME\r\n"))
+			case line == "DATA":
+				inData = true
+				conn.Write([]byte("354 go ahead\r\n"))
+			case line == "QUIT":
+				conn.Write([]byte("221 bye\r\n"))
+				received <- commands
+				return
+			default:
+				conn.Write([]byte("250 OK\r\n"))
+			}
+		}
+		received <- commands
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	cfg := smtpConfig{host: host, port: portNumber, from: "geoblock@example.com", tls: smtpNone, timeout: 5 * time.Second}
+	message, _ := renderEmail(cfg, blocklistChangedNotification(PolicyVersion{Version: 1, After: []string{"RU"}, Principal: "admin"}))
+	if err := sendEmail(cfg, "ops@example.com; sec@example.com", message); err != nil {
+		t.Fatal(err)
+	}
+
+	session := strings.Join(<-received, "\n")
+	for _, want := range []string{"MAIL FROM:<geoblock@example.com>", "RCPT TO:<ops@example.com>", "RCPT TO:<sec@example.com>", "To: ops@example.com, sec@example.com", "Subject: [geoblock] Blocklist changed to version 1"} {
+		if !strings.Contains(session, want) {
+			t.Errorf("SMTP session lacks %q:\n%s", want, session)
+		}
+	}
+
+	if err := sendEmail(smtpConfig{}, "ops@example.com", message); err == nil {
+		t.Error("expected an error without SMTP_HOST")
+	}
+}
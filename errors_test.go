@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		requestID string
+		status    int
+		code      string
+	}{
+		{
+			name:    "handler error",
+			handler: func(w http.ResponseWriter, r *http.Request) { writeError(w, r, "Invalid JSON", http.StatusBadRequest) },
+			status:  http.StatusBadRequest,
+			code:    "bad_request",
+		},
+		{
+			name:      "panic",
+			handler:   func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			requestID: "trace-123",
+			status:    http.StatusInternalServerError,
+			code:      "internal_server_error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/anything", nil)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			recorder := httptest.NewRecorder()
+			errorMiddleware(tt.handler).ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			var body ErrorResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+				t.Fatalf("response is not a JSON error envelope: %v", err)
+			}
+			if body.Error.Code != tt.code || body.Error.Message == "" {
+				t.Errorf("error = %+v, want code %q with a message", body.Error, tt.code)
+			}
+			id := recorder.Header().Get("X-Request-ID")
+			if id == "" || body.Error.RequestID != id {
+				t.Errorf("request_id = %q, header = %q", body.Error.RequestID, id)
+			}
+			if tt.requestID != "" && id != tt.requestID {
+				t.Errorf("X-Request-ID = %q, want incoming %q", id, tt.requestID)
+			}
+		})
+	}
+}
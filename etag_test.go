@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithETag(t *testing.T) {
+	status, body := http.StatusOK, `{"countries": []}`
+	handler := withETag(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/analyze-business-presence", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || first.Body.String() != body || etag == "" {
+		t.Fatalf("first response = %d %q with ETag %q, want 200 with the body and an ETag", first.Code, first.Body.String(), etag)
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{"same ETag", etag, http.StatusNotModified},
+		{"strong form of the ETag", etag[2:], http.StatusNotModified},
+		{"one of several", `"other", ` + etag, http.StatusNotModified},
+		{"any", "*", http.StatusNotModified},
+		{"stale ETag", `W/"stale"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.ifNoneMatch)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag) {
+				t.Errorf("304 with body %q and ETag %q, want no body and %q", rec.Body.String(), rec.Header().Get("ETag"), etag)
+			}
+		})
+	}
+
+	body = `{"countries": ["DE"]}`
+	if changed := get(etag); changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Errorf("changed body: status %d ETag %q, want 200 with a new ETag", changed.Code, changed.Header().Get("ETag"))
+	}
+
+	status, body = http.StatusInternalServerError, `{"error": "boom"}`
+	if failed := get("*"); failed.Code != status || failed.Body.String() != body || failed.Header().Get("ETag") != "" {
+		t.Errorf("error response = %d %q ETag %q, want it passed through untagged", failed.Code, failed.Body.String(), failed.Header().Get("ETag"))
+	}
+}
+
+func TestWithETagCompressed(t *testing.T) {
+	body := strings.Repeat(`{"country_code": "DE"}`, 100)
+	handler := compressResponses(withETag(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/jobs/1", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	gzipped, identity := get("gzip", ""), get("identity", "")
+	gzipTag, identityTag := gzipped.Header().Get("ETag"), identity.Header().Get("ETag")
+	if gzipped.Header().Get("Content-Encoding") != "gzip" || !strings.HasSuffix(gzipTag, `-gzip"`) {
+		t.Fatalf("gzipped response has Content-Encoding %q and ETag %q", gzipped.Header().Get("Content-Encoding"), gzipTag)
+	}
+	if identityTag == "" || identityTag == gzipTag {
+		t.Fatalf("identity ETag %q, want one different from the gzip ETag %q", identityTag, gzipTag)
+	}
+	for _, rec := range []*httptest.ResponseRecorder{gzipped, identity} {
+		if vary := rec.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Encoding" {
+			t.Errorf("Vary = %q, want Accept-Encoding once", vary)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		ifNoneMatch    string
+		wantStatus     int
+		wantETag       string
+	}{
+		{"gzip ETag for gzip", "gzip", gzipTag, http.StatusNotModified, gzipTag},
+		{"identity ETag for identity", "identity", identityTag, http.StatusNotModified, identityTag},
+		{"gzip ETag for identity", "identity", gzipTag, http.StatusOK, identityTag},
+		{"identity ETag for gzip", "gzip", identityTag, http.StatusOK, gzipTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.acceptEncoding, tt.ifNoneMatch)
+			if rec.Code != tt.wantStatus || rec.Header().Get("ETag") != tt.wantETag {
+				t.Errorf("got %d with ETag %q, want %d with %q", rec.Code, rec.Header().Get("ETag"), tt.wantStatus, tt.wantETag)
+			}
+		})
+	}
+}
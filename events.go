@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// eventBufferSize is how many events a slow subscriber may fall behind
+// before further events are dropped for it
+const eventBufferSize = 64
+
+// eventKeepAliveInterval keeps idle streams open through proxies
+const eventKeepAliveInterval = 15 * time.Second
+
+// BlockingEvent is one allow, block, challenge, monitor or exempt decision streamed to the dashboard
+type BlockingEvent struct {
+	Time      string `json:"time"`
+	Decision  string `json:"decision"`
+	ClientIP  string `json:"client_ip"`
+	ActualIP  string `json:"actual_ip,omitempty"`
+	Country   string `json:"country_code"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	RuleID    string `json:"rule_id,omitempty"`
+	Network   string `json:"network,omitempty"`
+	Exemption string `json:"exemption,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// EventHub fans blocking events out to every connected stream
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan BlockingEvent]struct{}
+}
+
+// NewEventHub creates a hub with no subscribers
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[chan BlockingEvent]struct{})}
+}
+
+// Subscribe registers a stream and returns its channel and an unsubscribe function
+func (h *EventHub) Subscribe() (<-chan BlockingEvent, func()) {
+	ch := make(chan BlockingEvent, eventBufferSize)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Publish sends an event to every subscriber without waiting; subscribers
+// whose buffer is full miss the event rather than slowing down requests
+func (h *EventHub) Publish(event BlockingEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribers returns the number of connected streams
+func (h *EventHub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// blockingEvents streams decisions made by the live blocking middleware
+var blockingEvents = NewEventHub()
+
+// publishBlockingDecision converts a blocking decision into a streamed event
+func publishBlockingDecision(r *http.Request, decision geoblock.Decision) {
+	event := BlockingEvent{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		ClientIP:  decision.Geo.ClientIP,
+		Country:   decision.Geo.Country,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		RequestID: requestIDFromContext(r.Context()),
+	}
+	if decision.Geo.ActualIP != decision.Geo.ClientIP {
+		event.ActualIP = decision.Geo.ActualIP
+	}
+	event.Decision = decisionName(decision)
+	if decision.Exemption != nil {
+		event.Exemption = decision.Exemption.ID
+	}
+	if decision.Match != nil {
+		event.RuleID = decision.Match.RuleID()
+		event.Network = decision.Match.Network
+	}
+	blockingEvents.Publish(event)
+}
+
+// decisionName is the allow, block, challenge, monitor or exempt outcome of a decision
+func decisionName(decision geoblock.Decision) string {
+	switch {
+	case decision.Skipped:
+		return "skip"
+	case decision.Blocked:
+		return "block"
+	case decision.Challenged:
+		return "challenge"
+	case decision.Monitored:
+		return "monitor"
+	case decision.Exemption != nil:
+		return "exempt"
+	}
+	return "allow"
+}
+
+// handleEvents streams blocking decisions as Server-Sent Events until the client disconnects
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		fmt.Printf("⚠️  Event stream does not support flushing: %v\n", err)
+		return
+	}
+
+	events, unsubscribe := blockingEvents.Subscribe()
+	defer unsubscribe()
+	fmt.Printf("📡 Event stream opened (%d subscribers)\n", blockingEvents.Subscribers())
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: decision\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+func TestEventHubDropsWhenFull(t *testing.T) {
+	hub := NewEventHub()
+	events, unsubscribe := hub.Subscribe()
+
+	for i := 0; i < eventBufferSize+10; i++ {
+		hub.Publish(BlockingEvent{Decision: "allow"})
+	}
+	if len(events) != eventBufferSize {
+		t.Errorf("buffered %d events, want %d", len(events), eventBufferSize)
+	}
+
+	unsubscribe()
+	if hub.Subscribers() != 0 {
+		t.Errorf("Subscribers() = %d after unsubscribe, want 0", hub.Subscribers())
+	}
+}
+
+func TestHandleEventsStreamsDecisions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handleEvents))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// The handler subscribes after flushing the headers
+	for blockingEvents.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	store := geoblock.NewStore()
+	if _, err := store.ReplacePolicy(&geoblock.Policy{BlockedNetworks: []string{"198.51.100.0/24"}}); err != nil {
+		t.Fatal(err)
+	}
+	blocked := httptest.NewRequest("GET", "/api/v1/test-access", nil)
+	geo := geoblock.RequestGeo{ClientIP: "198.51.100.7", ActualIP: "198.51.100.7", Country: "US"}
+	publishBlockingDecision(blocked, geoblock.Decision{Geo: geo, Blocked: true, Match: store.MatchIP(geo.ClientIP)})
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+		var event BlockingEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Decision != "block" || event.ClientIP != "198.51.100.7" || event.Network != "198.51.100.0/24" || event.Path != "/api/v1/test-access" {
+			t.Errorf("event = %+v", event)
+		}
+		return
+	}
+	t.Fatalf("stream ended without an event: %v", scanner.Err())
+}
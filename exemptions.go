@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+type ExemptionsResponse struct {
+	Exemptions []geoblock.Exemption `json:"exemptions"`
+	Total      int                  `json:"total"`
+}
+
+// handleListExemptions returns the IPs, networks and API callers exempt from blocking
+func handleListExemptions(w http.ResponseWriter, r *http.Request) {
+	exemptions := blocklist.Policy().Exemptions
+	if exemptions == nil {
+		exemptions = []geoblock.Exemption{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ExemptionsResponse{Exemptions: exemptions, Total: len(exemptions)})
+}
+
+// handleUpsertExemption creates an exemption or replaces the exemption with the same ID
+func handleUpsertExemption(w http.ResponseWriter, r *http.Request) {
+	var exemption geoblock.Exemption
+	if err := json.NewDecoder(r.Body).Decode(&exemption); err != nil {
+		writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if exemption.ID == "" {
+		exemption.ID = fmt.Sprintf("exemption-%d", time.Now().UnixNano())
+	}
+
+	_, err := updatePolicy(r, "upsert-exemption", func(policy *geoblock.Policy) error {
+		replaced := false
+		for i := range policy.Exemptions {
+			if policy.Exemptions[i].ID == exemption.ID {
+				policy.Exemptions[i] = exemption
+				replaced = true
+			}
+		}
+		if !replaced {
+			policy.Exemptions = append(policy.Exemptions, exemption)
+		}
+		if err := normalizePolicy(policy); err != nil {
+			return fmt.Errorf("%w: %v", geoblock.ErrInvalidPolicy, err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "upsert-exemption", map[string]interface{}{
+		"exemption":  exemption.ID,
+		"networks":   exemption.Networks,
+		"principals": exemption.Principals,
+	})
+	fmt.Printf("🎟️  Saved exemption %s for %v %v\n", exemption.ID, exemption.Networks, exemption.Principals)
+
+	handleListExemptions(w, r)
+}
+
+// handleDeleteExemption removes the exemption given by the {id} path parameter
+func handleDeleteExemption(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	_, err := updatePolicy(r, "delete-exemption", func(policy *geoblock.Policy) error {
+		kept := policy.Exemptions[:0]
+		for _, exemption := range policy.Exemptions {
+			if exemption.ID != id {
+				kept = append(kept, exemption)
+			}
+		}
+		if len(kept) == len(policy.Exemptions) {
+			return geoblock.ErrNoPolicyChange
+		}
+		policy.Exemptions = kept
+		return nil
+	})
+	if errors.Is(err, geoblock.ErrNoPolicyChange) {
+		writeError(w, r, fmt.Sprintf("Exemption %q not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "delete-exemption", map[string]interface{}{"exemption": id})
+	fmt.Printf("🗑️  Deleted exemption %s\n", id)
+
+	handleListExemptions(w, r)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"shopify-customers/geoblock"
+)
+
+// explainDefaultPath is the protected path explained when none is given
+const explainDefaultPath = "/api/v1/test-access"
+
+type ExplainDecisionResponse struct {
+	ClientIP     string                     `json:"client_ip,omitempty"`
+	Country      string                     `json:"country"`
+	CountryFrom  string                     `json:"country_from"`
+	LookupFailed bool                       `json:"lookup_failed,omitempty"`
+	Reputation   *int                       `json:"reputation,omitempty"`
+	Path         string                     `json:"path"`
+	Host         string                     `json:"host,omitempty"`
+	Principal    string                     `json:"principal,omitempty"`
+	Decision     string                     `json:"decision"`
+	RuleID       string                     `json:"rule_id,omitempty"`
+	Exemption    string                     `json:"exemption,omitempty"`
+	Steps        []geoblock.Step            `json:"steps"`
+	Response     geoblock.ExplainedResponse `json:"response"`
+}
+
+// handleExplainDecision explains how the blocking middleware would decide a
+// request from ?ip= or ?country= (both to override the IP's country), with an
+// optional ?path=, ?host=, ?principal= and ?reputation= (to override the IP's
+// abuse score): every check in evaluation order, the rule
+// that fires and the response the client would get
+func handleExplainDecision(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ipParam, countryParam := query.Get("ip"), query.Get("country")
+	if ipParam == "" && countryParam == "" {
+		writeError(w, r, "Provide an ip, a country, or both", http.StatusBadRequest)
+		return
+	}
+
+	response := ExplainDecisionResponse{Path: query.Get("path"), Host: geoblock.NormalizeHost(query.Get("host")), Principal: query.Get("principal")}
+	if response.Path == "" {
+		response.Path = explainDefaultPath
+	}
+	if !strings.HasPrefix(response.Path, "/") {
+		writeError(w, r, fmt.Sprintf("Invalid path %q: must start with /", response.Path), http.StatusBadRequest)
+		return
+	}
+	if _, err := url.ParseRequestURI(response.Path); err != nil {
+		writeError(w, r, fmt.Sprintf("Invalid path %q", response.Path), http.StatusBadRequest)
+		return
+	}
+
+	if ipParam != "" {
+		if response.ClientIP = geoblock.CanonicalIP(ipParam); response.ClientIP == "" {
+			writeError(w, r, fmt.Sprintf("Invalid IP address %q", ipParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case strings.EqualFold(countryParam, geoblock.UnknownCountry):
+		response.Country, response.CountryFrom = geoblock.UnknownCountry, "request"
+	case countryParam != "":
+		code, err := normalizeCountryCode(countryParam)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("Invalid country %q: %v", countryParam, err), http.StatusBadRequest)
+			return
+		}
+		response.Country, response.CountryFrom = code, "request"
+	default:
+		response.CountryFrom = "geolocation"
+		country, err := getCountryFromIPAddress(r.Context(), response.ClientIP)
+		if err != nil || country == "" {
+			country, response.LookupFailed = geoblock.UnknownCountry, true
+		}
+		response.Country = country
+	}
+
+	var reputation *int
+	if param := query.Get("reputation"); param != "" {
+		score, err := strconv.Atoi(param)
+		if err != nil || score < 0 || score > 100 {
+			writeError(w, r, fmt.Sprintf("Invalid reputation %q: must be 0-100", param), http.StatusBadRequest)
+			return
+		}
+		reputation = &score
+	}
+
+	req := httptest.NewRequest("GET", response.Path, nil)
+	if response.ClientIP != "" {
+		req.RemoteAddr = net.JoinHostPort(response.ClientIP, "0")
+	}
+	if response.Host != "" {
+		req.Host = response.Host
+	}
+	geo := geoblock.RequestGeo{ClientIP: response.ClientIP, ActualIP: response.ClientIP, Country: response.Country, LookupFailed: response.LookupFailed, Host: response.Host}
+	if reputation != nil {
+		geo.Reputation, geo.ReputationKnown = *reputation, true
+	}
+	explanation := blocker.Explain(req, geo, response.Principal)
+	if explanation.Decision.Geo.ReputationKnown {
+		score := explanation.Decision.Geo.Reputation
+		response.Reputation = &score
+	}
+
+	response.Decision = decisionName(explanation.Decision)
+	response.Steps = explanation.Steps
+	response.Response = explanation.Response
+	if explanation.Decision.Match != nil {
+		response.RuleID = explanation.Decision.Match.RuleID()
+	}
+	if explanation.Decision.Exemption != nil {
+		response.Exemption = explanation.Decision.Exemption.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// exportFormats render a country deny-list for a web server or load balancer
+var exportFormats = map[string]struct {
+	filename string
+	render   func(countries []string, ranges map[string][]*net.IPNet, header string) string
+}{
+	"nginx":   {"geoblock-deny.conf", renderNginxDenyList},
+	"haproxy": {"geoblock-deny.cfg", renderHAProxyDenyList},
+}
+
+// exportRanges resolves countries to their networks. A configured MaxMind
+// database gives every network; without one, the built-in and IP_RANGES_FILE
+// tables used for simulation cover only major allocations.
+func exportRanges(countries []string) (map[string][]*net.IPNet, string) {
+	wanted := make(map[string]bool, len(countries))
+	for _, code := range countries {
+		wanted[code] = true
+	}
+
+	for _, provider := range geoResolver.Providers() {
+		if mm, ok := provider.(*geoblock.MaxMind); ok {
+			return geoDatabaseRanges(mm.Reader(), 0, wanted), mm.Path()
+		}
+	}
+
+	countryRangesOnce.Do(func() { countryRanges = loadCountryRanges() })
+	ranges := make(map[string][]*net.IPNet, len(countries))
+	for _, code := range countries {
+		ranges[code] = countryRanges[code]
+	}
+	return ranges, "built-in ranges (partial coverage; configure a MaxMind database for complete lists)"
+}
+
+// exportHeader is the comment block at the top of every exported deny-list
+func exportHeader(countries []string, ranges map[string][]*net.IPNet, source string) string {
+	networks := 0
+	for _, code := range countries {
+		networks += len(ranges[code])
+	}
+	lines := []string{
+		"Country deny-list generated " + time.Now().Format(time.RFC3339),
+		fmt.Sprintf("Countries (%d): %s", len(countries), strings.Join(countries, ", ")),
+		fmt.Sprintf("Networks: %d", networks),
+		"Source: " + source,
+	}
+	for _, code := range countries {
+		if len(ranges[code]) == 0 {
+			lines = append(lines, fmt.Sprintf("WARNING: no networks known for %s, it is not blocked by this list", code))
+		}
+	}
+	return "# " + strings.Join(lines, "\n# ") + "\n"
+}
+
+// renderNginxDenyList renders deny directives to include in an http, server or location block
+func renderNginxDenyList(countries []string, ranges map[string][]*net.IPNet, header string) string {
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString("# Include in an nginx http, server or location block\n")
+	for _, code := range countries {
+		for _, network := range ranges[code] {
+			fmt.Fprintf(&b, "deny %s; # %s\n", network, code)
+		}
+	}
+	return b.String()
+}
+
+// renderHAProxyDenyList renders an ACL and deny rule to include in a frontend section
+func renderHAProxyDenyList(countries []string, ranges map[string][]*net.IPNet, header string) string {
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString("# Include in an HAProxy frontend or listen section\n")
+	denied := false
+	for _, code := range countries {
+		for _, network := range ranges[code] {
+			fmt.Fprintf(&b, "acl geoblock_denied src %s # %s\n", network, code)
+			denied = true
+		}
+	}
+	if denied {
+		b.WriteString("http-request deny deny_status 403 if geoblock_denied\n")
+	}
+	return b.String()
+}
+
+// handleExportBlocklist renders the enforced blocklist as an nginx or HAProxy
+// deny-list, resolving each country to its CIDR ranges. The json and yaml
+// formats export the whole policy as a document for POST /block-countries/import.
+func handleExportBlocklist(w http.ResponseWriter, r *http.Request) {
+	formatName := r.URL.Query().Get("format")
+	if formatName == "json" || formatName == "yaml" {
+		writePolicyDocument(w, r, formatName)
+		return
+	}
+	format, ok := exportFormats[formatName]
+	if !ok {
+		writeError(w, r, fmt.Sprintf("Invalid format %q: use nginx, haproxy, json or yaml", formatName), http.StatusBadRequest)
+		return
+	}
+
+	countries := edgeBlockedCountries()
+	sort.Strings(countries)
+	ranges, source := exportRanges(countries)
+	body := format.render(countries, ranges, exportHeader(countries, ranges, source))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", format.filename))
+	fmt.Fprint(w, body)
+	fmt.Printf("📤 Exported %s deny-list for %d countries from %s\n", formatName, len(countries), source)
+}
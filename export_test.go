@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestRenderDenyLists(t *testing.T) {
+	_, ru, _ := net.ParseCIDR("5.255.192.0/18")
+	_, ruV6, _ := net.ParseCIDR("2a02:6b8::/32")
+	ranges := map[string][]*net.IPNet{"RU": {ru, ruV6}}
+	countries := []string{"KP", "RU"}
+	header := exportHeader(countries, ranges, "test")
+
+	if !strings.Contains(header, "Networks: 2") || !strings.Contains(header, "no networks known for KP") {
+		t.Errorf("header = %s", header)
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"nginx", []string{"deny 5.255.192.0/18; # RU\n", "deny 2a02:6b8::/32; # RU\n"}},
+		{"haproxy", []string{
+			"acl geoblock_denied src 5.255.192.0/18 # RU\n",
+			"acl geoblock_denied src 2a02:6b8::/32 # RU\n",
+			"http-request deny deny_status 403 if geoblock_denied\n",
+		}},
+	}
+	for _, tt := range tests {
+		got := exportFormats[tt.format].render(countries, ranges, header)
+		if !strings.HasPrefix(got, header) {
+			t.Errorf("%s output does not start with the header", tt.format)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s output missing %q:\n%s", tt.format, want, got)
+			}
+		}
+	}
+
+	if got := renderHAProxyDenyList(nil, nil, ""); strings.Contains(got, "http-request deny") {
+		t.Errorf("empty HAProxy list should not deny anything:\n%s", got)
+	}
+}
+
+func TestPolicyDocumentRoundTrip(t *testing.T) {
+	doc := PolicyDocument{
+		FormatVersion: policyDocumentVersion,
+		Policy: geoblock.Policy{
+			BlockedCountries: []string{"KP", "RU"},
+			Rules: []geoblock.Rule{
+				{ID: "preset-embargo", Countries: []string{"IR"}, Challenge: true, Preset: "embargo", PresetVersion: "2"},
+			},
+			Exemptions:     []geoblock.Exemption{{ID: "office", Networks: []string{"203.0.113.0/24"}}},
+			UnknownCountry: geoblock.FallbackChallenge,
+		},
+		Presets: []CountryPreset{{ID: "embargo", Name: "Embargo", Version: "2", AsOf: "2026-01-15", Countries: []string{"IR"}}},
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		data, err := marshalPolicyDocument(doc, format)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", format, err)
+		}
+		got, err := parsePolicyDocument(data, format)
+		if err != nil {
+			t.Fatalf("%s: parse: %v\n%s", format, err, data)
+		}
+		if !reflect.DeepEqual(*got, doc) {
+			t.Errorf("%s round trip = %+v, want %+v", format, *got, doc)
+		}
+	}
+	if data, _ := marshalPolicyDocument(doc, "yaml"); !strings.Contains(string(data), "blocked_countries:") {
+		t.Errorf("YAML should use the JSON field names:\n%s", data)
+	}
+}
+
+func TestParsePolicyDocumentRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{"missing version", "json", `{"blocked_countries": ["RU"]}`},
+		{"future version", "yaml", "format_version: 2\nblocked_countries: [RU]\n"},
+		{"invalid country", "yaml", "format_version: 1\nblocked_countries: [ZZZ]\n"},
+		{"preset without version", "json", `{"format_version": 1, "blocked_countries": [], "presets": [{"id": "embargo", "countries": ["IR"]}]}`},
+		{"malformed YAML", "yaml", "format_version: [1\n"},
+	}
+	for _, tt := range tests {
+		if _, err := parsePolicyDocument([]byte(tt.data), tt.format); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
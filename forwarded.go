@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+)
+
+// parseForwarded parses RFC 7239 Forwarded header values into one element
+// per proxy hop, oldest first, each mapping lower-case parameter names such
+// as "for", "proto" and "host" to their unquoted values. Malformed pairs
+// are skipped.
+func parseForwarded(values []string) []map[string]string {
+	var elements []map[string]string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			params := make(map[string]string)
+			for _, pair := range splitQuoted(element, ';') {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || name == "" {
+					continue
+				}
+				params[strings.ToLower(name)] = unquoteForwarded(value)
+			}
+			elements = append(elements, params)
+		}
+	}
+	return elements
+}
+
+// splitQuoted splits s at sep outside double-quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteForwarded removes the quotes and escapes of a quoted-string value
+func unquoteForwarded(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var b strings.Builder
+	escaped := false
+	for _, c := range value[1 : len(value)-1] {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// forwardedFor lists the for= node of every Forwarded element, oldest
+// first. Obfuscated identifiers such as "_hidden" and "unknown" are kept so
+// hops are counted right, but never resolve to a client IP. Only headers of
+// requests from a trusted proxy may be passed; clients can send anything.
+func forwardedFor(values []string) []string {
+	var nodes []string
+	for _, element := range parseForwarded(values) {
+		nodes = append(nodes, element["for"])
+	}
+	return nodes
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	got := parseForwarded([]string{
+		`for=192.0.2.60;proto=http;by=203.0.113.43, For="[2001:db8:cafe::17]:4711"`,
+		`for=_hidden;host="shop.example.com";proto=https`,
+		`for="198.51.100.7;x=\"y\"", garbage`,
+	})
+	want := []map[string]string{
+		{"for": "192.0.2.60", "proto": "http", "by": "203.0.113.43"},
+		{"for": "[2001:db8:cafe::17]:4711"},
+		{"for": "_hidden", "host": "shop.example.com", "proto": "https"},
+		{"for": `198.51.100.7;x="y"`},
+		{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseForwarded = %v, want %v", got, want)
+	}
+}
+
+func TestGetRealIPForwarded(t *testing.T) {
+	defer func(saved []*net.IPNet, hops int) { trustedProxies, trustedProxyHops = saved, hops }(trustedProxies, trustedProxyHops)
+	trustedProxies, trustedProxyHops = parseTrustedProxies([]string{"10.0.0.0/8"}), 1
+
+	tests := []struct {
+		name      string
+		forwarded string
+		xff       string
+		remote    string
+		want      string
+	}{
+		{"ipv4", "for=203.0.113.7;proto=https", "198.51.100.1", "10.0.0.1:80", "203.0.113.7"},
+		{"ipv6 with port", `for="[2001:db8:cafe::17]:4711"`, "", "10.0.0.1:80", "2001:db8:cafe::17"},
+		{"rightmost hop", "for=1.2.3.4, for=203.0.113.7", "", "10.0.0.1:80", "203.0.113.7"},
+		{"obfuscated falls back", "for=_hidden", "198.51.100.1", "10.0.0.1:80", "198.51.100.1"},
+		{"unknown falls back", "for=unknown", "", "10.0.0.1:80", "10.0.0.1"},
+		{"untrusted peer ignored", "for=1.1.1.1", "", "198.51.100.7:51234", "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set("Forwarded", tt.forwarded)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := getRealIP(req); got != tt.want {
+				t.Errorf("getRealIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"shopify-customers/geoblock"
+)
+
+// gatewayUpstream turns the server into a geo-blocking gateway: with
+// GATEWAY_UPSTREAM set, every request the app does not route itself is
+// country-checked, rate limited and proxied there
+var gatewayUpstream = loadGatewayUpstream()
+
+// gatewayPreserveHost forwards the client's Host header upstream instead of
+// the upstream's own host, for upstreams serving several domains
+var gatewayPreserveHost = getEnv("GATEWAY_PRESERVE_HOST", "false") == "true"
+
+// gatewayCountryHeader tells the upstream which country a request came from
+const gatewayCountryHeader = "X-Geo-Country"
+
+// loadGatewayUpstream reads GATEWAY_UPSTREAM, ignoring URLs that are not
+// absolute http or https URLs
+func loadGatewayUpstream() *url.URL {
+	raw := getEnv("GATEWAY_UPSTREAM", "")
+	if raw == "" {
+		return nil
+	}
+	upstream, err := url.Parse(raw)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		fmt.Printf("⚠️  Ignoring GATEWAY_UPSTREAM %q: expected e.g. http://localhost:3000\n", raw)
+		return nil
+	}
+	return upstream
+}
+
+// newGatewayProxy proxies requests to upstream, adding the X-Forwarded
+// headers and the client's country. The upstream is a trusted backend, so
+// it is reached directly rather than through the outbound proxy and egress
+// allowlist.
+func newGatewayProxy(upstream *url.URL, preserveHost bool) *httputil.ReverseProxy {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			pr.SetXForwarded()
+			if preserveHost {
+				pr.Out.Host = pr.In.Host
+			}
+			pr.Out.Header.Del(gatewayCountryHeader)
+			if geo, ok := geoblock.GeoFromContext(pr.In.Context()); ok {
+				pr.Out.Header.Set(gatewayCountryHeader, geo.Country)
+			}
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Printf("❌ Gateway request %s %s failed: %v\n", r.Method, r.URL.Path, err)
+			writeError(w, r, "Upstream unavailable", http.StatusBadGateway)
+		},
+	}
+}
+
+// registerGateway routes every path no other route claims to the upstream,
+// behind country blocking and the policy's rate limits, when
+// GATEWAY_UPSTREAM is set
+func registerGateway(mux *http.ServeMux) {
+	if gatewayUpstream == nil {
+		return
+	}
+	proxy := newGatewayProxy(gatewayUpstream, gatewayPreserveHost)
+	mux.HandleFunc("/", countryBlockingMiddleware(countryRateLimitMiddleware(proxy.ServeHTTP)))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestGatewayProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Host", r.Host)
+		w.Header().Set("X-Upstream-Country", r.Header.Get(gatewayCountryHeader))
+		w.Header().Set("X-Upstream-Forwarded-Host", r.Header.Get("X-Forwarded-Host"))
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	tests := []struct {
+		name         string
+		preserveHost bool
+		geo          *geoblock.RequestGeo
+		wantHost     string
+		wantCountry  string
+	}{
+		{"upstream host", false, &geoblock.RequestGeo{Country: "DE"}, target.Host, "DE"},
+		{"preserved host", true, &geoblock.RequestGeo{Country: "FR"}, "myshop.de", "FR"},
+		{"client header dropped", false, nil, target.Host, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://myshop.de/products/shoes", nil)
+		req.Header.Set(gatewayCountryHeader, "US")
+		if tt.geo != nil {
+			req = req.WithContext(geoblock.ContextWithGeo(req.Context(), *tt.geo))
+		}
+		recorder := httptest.NewRecorder()
+		newGatewayProxy(target, tt.preserveHost).ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusOK || recorder.Body.String() != "/products/shoes" {
+			t.Errorf("%s: got %d %q", tt.name, recorder.Code, recorder.Body.String())
+		}
+		if got := recorder.Header().Get("X-Upstream-Host"); got != tt.wantHost {
+			t.Errorf("%s: upstream Host = %q, want %q", tt.name, got, tt.wantHost)
+		}
+		if got := recorder.Header().Get("X-Upstream-Country"); got != tt.wantCountry {
+			t.Errorf("%s: %s = %q, want %q", tt.name, gatewayCountryHeader, got, tt.wantCountry)
+		}
+		if got := recorder.Header().Get("X-Upstream-Forwarded-Host"); got != "myshop.de" {
+			t.Errorf("%s: X-Forwarded-Host = %q, want myshop.de", tt.name, got)
+		}
+	}
+}
+
+func TestGatewayProxyUpstreamDown(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	recorder := httptest.NewRecorder()
+	newGatewayProxy(target, false).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusBadGateway)
+	}
+}
+
+func TestRegisterRoutesGateway(t *testing.T) {
+	previous := gatewayUpstream
+	gatewayUpstream, _ = url.Parse("http://localhost:3000")
+	defer func() { gatewayUpstream = previous }()
+
+	// The catch-all route must not conflict with any other
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	for path, want := range map[string]string{"/products/shoes": "/", "/healthz": "GET /healthz"} {
+		if _, pattern := mux.Handler(httptest.NewRequest("GET", path, nil)); pattern != want {
+			t.Errorf("%s routed to %q, want %q", path, pattern, want)
+		}
+	}
+}
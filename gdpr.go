@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWebhookSize bounds a Shopify webhook body
+const maxWebhookSize = 1 << 20
+
+// shopifyAPISecret verifies the HMAC of Shopify webhooks. Without it every
+// webhook is rejected.
+var shopifyAPISecret = getEnv("SHOPIFY_API_SECRET", "")
+
+// CustomerJobRecord is a customer as held in the result of a fetch job
+type CustomerJobRecord struct {
+	JobID    string          `json:"job_id"`
+	Customer CustomerCountry `json:"customer"`
+}
+
+// CustomerDataExport is everything the service holds about one customer
+type CustomerDataExport struct {
+	CustomerID int64               `json:"customer_id"`
+	ExportedAt string              `json:"exported_at"`
+	Found      bool                `json:"found"`
+	Stored     *StoredCustomer     `json:"stored,omitempty"`
+	JobResults []CustomerJobRecord `json:"job_results"`
+}
+
+// CustomerErasure reports where a customer's data was erased from
+type CustomerErasure struct {
+	CustomerID         int64 `json:"customer_id,omitempty"`
+	StoredDeleted      int64 `json:"stored_deleted"`
+	JobResultsRedacted int   `json:"job_results_redacted"`
+	CachedPagesDropped int   `json:"cached_pages_dropped"`
+}
+
+// exportCustomerData collects a customer's stored row and job result entries
+func exportCustomerData(ctx context.Context, id int64) (CustomerDataExport, error) {
+	export := CustomerDataExport{
+		CustomerID: id,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		JobResults: []CustomerJobRecord{},
+	}
+	if postgresStore != nil {
+		ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+		defer cancel()
+		stored, err := postgresStore.GetCustomer(ctx, id)
+		if err == nil && stored == nil && piiMinimization {
+			stored, err = postgresStore.GetAnonymousCustomer(ctx, customerHash(id))
+		}
+		if err != nil {
+			return export, fmt.Errorf("failed to read customer from Postgres: %w", err)
+		}
+		export.Stored = stored
+	}
+
+	ids, results := jobs.Results()
+	for i, result := range results {
+		report, ok := result.(CustomerResponse)
+		if !ok {
+			continue
+		}
+		for _, customer := range report.CustomerCountries {
+			if matchesCustomer(customer, id) {
+				export.JobResults = append(export.JobResults, CustomerJobRecord{JobID: ids[i], Customer: customer})
+			}
+		}
+	}
+	export.Found = export.Stored != nil || len(export.JobResults) > 0
+	return export, nil
+}
+
+// withoutCustomers removes the customers matched by erase from a fetch job's
+// report, reporting whether any were removed. Aggregates keep their counts.
+func withoutCustomers(result interface{}, erase func(CustomerCountry) bool) (interface{}, bool) {
+	report, ok := result.(CustomerResponse)
+	if !ok {
+		return result, false
+	}
+	kept := make([]CustomerCountry, 0, len(report.CustomerCountries))
+	for _, customer := range report.CustomerCountries {
+		if !erase(customer) {
+			kept = append(kept, customer)
+		}
+	}
+	if len(kept) == len(report.CustomerCountries) {
+		return result, false
+	}
+	report.CustomerCountries = kept
+	return report, true
+}
+
+// eraseCustomerData deletes a customer from the database, job results and
+// the Shopify page cache. With all set, every customer is erased, as for a
+// shop/redact webhook.
+func eraseCustomerData(ctx context.Context, id int64, all bool) (CustomerErasure, error) {
+	erasure := CustomerErasure{CustomerID: id}
+	erase := func(customer CustomerCountry) bool { return all || matchesCustomer(customer, id) }
+	erasure.JobResultsRedacted = jobs.RewriteResults(func(result interface{}) (interface{}, bool) {
+		return withoutCustomers(result, erase)
+	})
+	// Cached Shopify pages hold raw customers; the next sync refetches them
+	erasure.CachedPagesDropped = shopifyPages.Clear()
+
+	if postgresStore == nil {
+		return erasure, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	if all {
+		deleted, err := postgresStore.DeleteAllCustomers(ctx)
+		erasure.StoredDeleted = deleted
+		return erasure, err
+	}
+	hash := ""
+	if piiMinimization {
+		hash = customerHash(id)
+	}
+	deleted, err := postgresStore.DeleteCustomer(ctx, id, hash)
+	erasure.StoredDeleted = deleted
+	return erasure, err
+}
+
+// customerIDParam parses the {id} path value as a Shopify customer ID
+func customerIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid customer ID %q", r.PathValue("id"))
+	}
+	return id, nil
+}
+
+// handleExportCustomer returns everything stored about a customer, for a
+// GDPR data request
+func handleExportCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := customerIDParam(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	export, err := exportCustomerData(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, "export-customer", map[string]interface{}{"customer_id": id, "found": export.Found})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("customer-%d.json", id)))
+	json.NewEncoder(w).Encode(export)
+}
+
+// handleEraseCustomer deletes a customer's personal data
+func handleEraseCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := customerIDParam(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	erasure, err := eraseCustomerData(r.Context(), id, false)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, "erase-customer", erasure)
+	fmt.Printf("🧹 Erased customer %d: %d stored rows, %d job results\n", id, erasure.StoredDeleted, erasure.JobResultsRedacted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(erasure)
+}
+
+// verifyShopifyWebhook checks the base64 HMAC-SHA256 Shopify signs webhook bodies with
+func verifyShopifyWebhook(secret string, body []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// GDPRWebhook is the payload of Shopify's mandatory compliance webhooks
+type GDPRWebhook struct {
+	ShopID     int64  `json:"shop_id"`
+	ShopDomain string `json:"shop_domain"`
+	Customer   struct {
+		ID int64 `json:"id"`
+	} `json:"customer"`
+	DataRequest struct {
+		ID int64 `json:"id"`
+	} `json:"data_request"`
+}
+
+// handleShopifyWebhook handles the customers/data_request, customers/redact
+// and shop/redact compliance webhooks and orders/create, named by
+// X-Shopify-Topic. Requests without a valid HMAC are refused with 401, as
+// Shopify requires.
+func handleShopifyWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		writeError(w, r, "Webhook body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !verifyShopifyWebhook(shopifyAPISecret, body, r.Header.Get("X-Shopify-Hmac-Sha256")) {
+		fmt.Printf("🔒 Rejected Shopify webhook %q with an invalid signature\n", r.Header.Get("X-Shopify-Topic"))
+		writeError(w, r, "Invalid webhook signature", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-Shopify-Topic") == "orders/create" {
+		handleOrderCreated(w, r, body)
+		return
+	}
+	var payload GDPRWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, r, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+
+	topic := r.Header.Get("X-Shopify-Topic")
+	details := map[string]interface{}{"topic": topic, "shop_domain": payload.ShopDomain}
+	switch topic {
+	case "customers/data_request":
+		// The merchant receives the data from GET /customers/{id}/export
+		export, err := exportCustomerData(r.Context(), payload.Customer.ID)
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		details["customer_id"] = payload.Customer.ID
+		details["data_request_id"] = payload.DataRequest.ID
+		details["found"] = export.Found
+	case "customers/redact":
+		erasure, err := eraseCustomerData(r.Context(), payload.Customer.ID, false)
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		details["erasure"] = erasure
+	case "shop/redact":
+		if !strings.EqualFold(payload.ShopDomain, shopifyShop+".myshopify.com") {
+			fmt.Printf("⚠️  Ignoring shop/redact for %s, which is not this shop\n", payload.ShopDomain)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		erasure, err := eraseCustomerData(r.Context(), 0, true)
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		details["erasure"] = erasure
+	default:
+		writeError(w, r, fmt.Sprintf("Unsupported webhook topic %q", topic), http.StatusBadRequest)
+		return
+	}
+
+	recordSystemAudit("shopify-webhook", details)
+	fmt.Printf("📬 Handled Shopify %s webhook for %s\n", topic, payload.ShopDomain)
+	w.WriteHeader(http.StatusOK)
+}
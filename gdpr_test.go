@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// signWebhook signs a body the way Shopify does
+func signWebhook(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestWithoutCustomers(t *testing.T) {
+	report := CustomerResponse{TotalCustomers: 3, CustomerCountries: []CustomerCountry{
+		{CustomerID: 1, CustomerEmail: "a@example.com"},
+		{CustomerID: 2, CustomerEmail: "b@example.com"},
+		{CustomerID: 3, CustomerEmail: "c@example.com"},
+	}}
+
+	tests := []struct {
+		name    string
+		result  interface{}
+		erase   func(CustomerCountry) bool
+		wantIDs []int64
+		changed bool
+	}{
+		{"one customer", report, func(c CustomerCountry) bool { return c.CustomerID == 2 }, []int64{1, 3}, true},
+		{"unknown customer", report, func(c CustomerCountry) bool { return c.CustomerID == 9 }, []int64{1, 2, 3}, false},
+		{"every customer", report, func(CustomerCountry) bool { return true }, nil, true},
+		{"other job result", "edge sync", func(CustomerCountry) bool { return true }, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, changed := withoutCustomers(tt.result, tt.erase)
+			if changed != tt.changed {
+				t.Fatalf("changed = %v, want %v", changed, tt.changed)
+			}
+			got, ok := result.(CustomerResponse)
+			if !ok {
+				return
+			}
+			var ids []int64
+			for _, customer := range got.CustomerCountries {
+				ids = append(ids, customer.CustomerID)
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Errorf("customers = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+	if len(report.CustomerCountries) != 3 {
+		t.Error("the original report was modified")
+	}
+}
+
+func TestHandleShopifyWebhook(t *testing.T) {
+	secret := shopifyAPISecret
+	defer func() { shopifyAPISecret = secret }()
+	shopifyAPISecret = "webhook-secret"
+
+	body := `{"shop_id": 1, "shop_domain": "other-shop.myshopify.com", "customer": {"id": 42}, "data_request": {"id": 7}}`
+	tests := []struct {
+		name       string
+		topic      string
+		signature  string
+		wantStatus int
+	}{
+		{"data request", "customers/data_request", signWebhook("webhook-secret", body), http.StatusOK},
+		{"customer redact", "customers/redact", signWebhook("webhook-secret", body), http.StatusOK},
+		{"shop redact for another shop", "shop/redact", signWebhook("webhook-secret", body), http.StatusOK},
+		{"wrong secret", "customers/redact", signWebhook("other-secret", body), http.StatusUnauthorized},
+		{"missing signature", "customers/redact", "", http.StatusUnauthorized},
+		{"unknown topic", "products/update", signWebhook("webhook-secret", body), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/webhooks/shopify", strings.NewReader(body))
+			req.Header.Set("X-Shopify-Topic", tt.topic)
+			req.Header.Set("X-Shopify-Hmac-Sha256", tt.signature)
+			recorder := httptest.NewRecorder()
+			handleShopifyWebhook(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
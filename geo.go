@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// defaultGeoProviderTimeout applies to providers without an explicit timeout
+const defaultGeoProviderTimeout = 5 * time.Second
+
+// geoFailClosed blocks clients whose country could not be determined, e.g.
+// while every provider's circuit is open. GEO_FAILURE_MODE is open or closed.
+var geoFailClosed = strings.EqualFold(getEnv("GEO_FAILURE_MODE", "open"), "closed")
+
+// geoConsensusChallenge challenges clients whose providers disagree in
+// consensus mode instead of allowing them. GEO_CONSENSUS_DISPUTED is allow
+// or challenge; a disagreement is never handled as a failed lookup.
+var geoConsensusChallenge = strings.EqualFold(getEnv("GEO_CONSENSUS_DISPUTED", "allow"), "challenge")
+
+// ipinfoToken authenticates ipinfo.io calls; without it the free tier is
+// limited per source IP and quickly returns 429 in production
+var ipinfoToken = getEnv("IPINFO_TOKEN", "")
+
+// geoRetry retries geolocation calls that time out or fail with a 5xx,
+// GEO_RETRY_ATTEMPTS times in all with GEO_RETRY_BACKOFF between them. The
+// circuit breaker only counts a provider failure once its retries run out.
+var geoRetry = newRetryPolicy("geo provider", getEnvInt("GEO_RETRY_ATTEMPTS", 2), getEnvDuration("GEO_RETRY_BACKOFF", 100*time.Millisecond))
+
+// ipinfoClient discovers this server's public IP. When ipinfo is in the
+// provider chain, the chain's provider is used so both share one quota.
+var ipinfoClient = newIPInfoClient(defaultGeoProviderTimeout)
+
+// newIPInfoClient creates an ipinfo.io provider with the configured token
+func newIPInfoClient(timeout time.Duration) *geoblock.IPInfo {
+	client := geoblock.NewIPInfo(ipinfoToken, timeout)
+	client.Logf = logf
+	client.Retry = geoRetry
+	client.SetHTTPClient(newHTTPClient(timeout))
+	return client
+}
+
+// logf prints a library diagnostic message on its own line
+func logf(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+// newGeoResolverChain builds the provider chain from GEO_PROVIDERS, a
+// comma-separated priority list of provider[:timeout] entries such as
+// "maxmind,ipinfo:3s,ip-api:2s". Providers missing required credentials are
+// skipped. OFFLINE_MODE replaces the list with the bundled snapshot.
+func newGeoResolverChain() *geoblock.Chain {
+	chain := geoblock.NewChain()
+	chain.Logf = logf
+	chain.Overrides = geoCorrections
+	chain.RecoveryTimeout = getEnvDuration("GEO_BREAKER_RECOVERY", 30*time.Second)
+	chain.FailureThreshold = 5
+	if value := getEnv("GEO_BREAKER_FAILURES", ""); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 0 {
+			fmt.Printf("⚠️  Invalid GEO_BREAKER_FAILURES %q, using %d\n", value, chain.FailureThreshold)
+		} else {
+			chain.FailureThreshold = threshold
+		}
+	}
+	defaultTimeout := getEnvDuration("GEO_PROVIDER_TIMEOUT", defaultGeoProviderTimeout)
+
+	entries := getEnvList("GEO_PROVIDERS", "ipinfo")
+	if offlineMode {
+		fmt.Println("✈️  OFFLINE_MODE: resolving countries from the GeoIP snapshot only")
+		entries = []string{"snapshot"}
+	}
+
+	for _, entry := range entries {
+		name, timeoutValue, _ := strings.Cut(entry, ":")
+		timeout := defaultTimeout
+		if timeoutValue != "" {
+			parsed, err := time.ParseDuration(timeoutValue)
+			if err != nil {
+				fmt.Printf("⚠️  Invalid timeout %q for geo provider %s, using %s\n", timeoutValue, name, defaultTimeout)
+			} else {
+				timeout = parsed
+			}
+		}
+
+		var provider geoblock.Provider
+		switch strings.ToLower(name) {
+		case "ipinfo":
+			// Share the provider, and its quota state, with public IP discovery
+			ipinfoClient = newIPInfoClient(timeout)
+			provider = ipinfoClient
+		case "ip-api":
+			ipapi := geoblock.NewIPAPI(getEnv("IPAPI_KEY", ""), timeout)
+			ipapi.Retry = geoRetry
+			ipapi.SetHTTPClient(newHTTPClient(timeout))
+			provider = ipapi
+		case "ipstack":
+			accessKey := getEnv("IPSTACK_ACCESS_KEY", "")
+			if accessKey == "" {
+				fmt.Println("⚠️  Skipping ipstack geo provider: IPSTACK_ACCESS_KEY is not set")
+				continue
+			}
+			scheme := getEnv("IPSTACK_SCHEME", "https")
+			if scheme == "http" {
+				fmt.Println("⚠️  IPSTACK_SCHEME=http sends the ipstack access key unencrypted")
+			}
+			ipstack := geoblock.NewIPStack(accessKey, scheme, timeout)
+			ipstack.Retry = geoRetry
+			ipstack.SetHTTPClient(newHTTPClient(timeout))
+			provider = ipstack
+		case "maxmind":
+			path := getEnv("MAXMIND_DB_PATH", "GeoLite2-Country.mmdb")
+			mm, err := geoblock.OpenMaxMind(path)
+			if err != nil && installMissingGeoIPDatabase(path) {
+				mm, err = geoblock.OpenMaxMind(path)
+			}
+			if err != nil {
+				fmt.Printf("⚠️  Skipping maxmind geo provider: %v\n", err)
+				continue
+			}
+			provider = mm
+		case "snapshot":
+			provider = newSnapshotProvider()
+		default:
+			fmt.Printf("⚠️  Unknown geo provider %q in GEO_PROVIDERS\n", name)
+			continue
+		}
+
+		chain.Add(provider, timeout)
+	}
+
+	// GEO_CONSENSUS=true only blocks by country when the first two providers
+	// that answer agree; disagreements are reported at /api/v1/geo-conflicts
+	if getEnv("GEO_CONSENSUS", "false") == "true" {
+		if len(chain.Providers()) < 2 {
+			fmt.Println("⚠️  GEO_CONSENSUS needs at least two geo providers; every lookup will fail until more are configured")
+		}
+		chain.Consensus = true
+		chain.OnConflict = func(conflict geoblock.Conflict) { geoConflicts.Record(conflict) }
+	}
+
+	return chain
+}
+
+// geoResolver is the process-wide geolocation chain
+var geoResolver = newGeoResolverChain()
+
+type GeoProviderStatusResponse struct {
+	Providers  []geoblock.ProviderStatus `json:"providers"`
+	Reputation *geoblock.ProviderStatus  `json:"reputation,omitempty"`
+}
+
+// handleGeoProviderStatus reports quota and health for every configured geolocation provider
+func handleGeoProviderStatus(w http.ResponseWriter, r *http.Request) {
+	response := GeoProviderStatusResponse{
+		Providers: geoResolver.ProviderStatuses(),
+	}
+	if reputationProvider != nil {
+		status := reputationProvider.Status()
+		response.Reputation = &status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// maxGeoConflicts caps the addresses remembered by the conflict log
+const maxGeoConflicts = 1000
+
+// GeoConflictEntry is an address whose geolocation providers disagreed
+type GeoConflictEntry struct {
+	IP        string                    `json:"ip"`
+	Answers   []geoblock.ProviderAnswer `json:"answers"`
+	Count     int                       `json:"count"`
+	FirstSeen string                    `json:"first_seen"`
+	LastSeen  string                    `json:"last_seen"`
+
+	last time.Time
+}
+
+// GeoConflictPair counts conflicts between two countries, e.g. "RU/UA"
+type GeoConflictPair struct {
+	Countries string `json:"countries"`
+	Count     int    `json:"count"`
+}
+
+// GeoConflictLog remembers provider disagreements by address, forgetting
+// the least recently seen address once maxGeoConflicts are stored
+type GeoConflictLog struct {
+	mu      sync.Mutex
+	entries map[string]*GeoConflictEntry
+	total   int
+}
+
+// NewGeoConflictLog creates an empty conflict log
+func NewGeoConflictLog() *GeoConflictLog {
+	return &GeoConflictLog{entries: make(map[string]*GeoConflictEntry)}
+}
+
+// Record counts one disagreement
+func (l *GeoConflictLog) Record(conflict geoblock.Conflict) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total++
+	entry, ok := l.entries[conflict.IP]
+	if !ok {
+		if len(l.entries) >= maxGeoConflicts {
+			l.evictOldest()
+		}
+		entry = &GeoConflictEntry{IP: conflict.IP, FirstSeen: conflict.At.Format(time.RFC3339)}
+		l.entries[conflict.IP] = entry
+	}
+	entry.Answers = conflict.Answers
+	entry.Count++
+	entry.last = conflict.At
+	entry.LastSeen = conflict.At.Format(time.RFC3339)
+}
+
+// evictOldest drops the least recently seen address. Callers must hold l.mu.
+func (l *GeoConflictLog) evictOldest() {
+	var oldest *GeoConflictEntry
+	for _, entry := range l.entries {
+		if oldest == nil || entry.last.Before(oldest.last) {
+			oldest = entry
+		}
+	}
+	if oldest != nil {
+		delete(l.entries, oldest.IP)
+	}
+}
+
+// conflictPair names the countries of a conflict in a stable order
+func conflictPair(answers []geoblock.ProviderAnswer) string {
+	countries := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		countries = append(countries, answer.Country)
+	}
+	sort.Strings(countries)
+	return strings.Join(countries, "/")
+}
+
+// Report returns the remembered addresses, most recent first, and conflict counts per country pair
+func (l *GeoConflictLog) Report() (entries []GeoConflictEntry, pairs []GeoConflictPair, total int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make(map[string]int)
+	entries = make([]GeoConflictEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entries = append(entries, *entry)
+		counts[conflictPair(entry.Answers)] += entry.Count
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].last.After(entries[j].last) })
+
+	pairs = make([]GeoConflictPair, 0, len(counts))
+	for countries, count := range counts {
+		pairs = append(pairs, GeoConflictPair{Countries: countries, Count: count})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Count != pairs[j].Count {
+			return pairs[i].Count > pairs[j].Count
+		}
+		return pairs[i].Countries < pairs[j].Countries
+	})
+	return entries, pairs, l.total
+}
+
+// geoConflicts records disagreements of the process-wide provider chain
+var geoConflicts = NewGeoConflictLog()
+
+type GeoConflictsResponse struct {
+	Consensus bool               `json:"consensus"`
+	Total     int                `json:"total"`
+	Pairs     []GeoConflictPair  `json:"pairs"`
+	Conflicts []GeoConflictEntry `json:"conflicts"`
+}
+
+// handleGeoConflicts reports addresses whose providers disagreed in consensus mode
+func handleGeoConflicts(w http.ResponseWriter, r *http.Request) {
+	entries, pairs, total := geoConflicts.Report()
+	response := GeoConflictsResponse{
+		Consensus: geoResolver.Consensus,
+		Total:     total,
+		Pairs:     pairs,
+		Conflicts: entries,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+func TestGeoConflictLog(t *testing.T) {
+	log := NewGeoConflictLog()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	conflict := func(ip, a, b string, at time.Time) geoblock.Conflict {
+		return geoblock.Conflict{IP: ip, At: at, Answers: []geoblock.ProviderAnswer{
+			{Provider: "maxmind", Country: a},
+			{Provider: "ipinfo", Country: b},
+		}}
+	}
+
+	log.Record(conflict("203.0.113.7", "UA", "RU", start))
+	log.Record(conflict("203.0.113.7", "UA", "RU", start.Add(time.Minute)))
+	log.Record(conflict("198.51.100.9", "RU", "UA", start.Add(2*time.Minute)))
+	log.Record(conflict("192.0.2.1", "DE", "NL", start.Add(3*time.Minute)))
+
+	entries, pairs, total := log.Report()
+	if total != 4 || len(entries) != 3 {
+		t.Fatalf("total = %d with %d entries, want 4 with 3", total, len(entries))
+	}
+	if entries[0].IP != "192.0.2.1" {
+		t.Errorf("most recent entry = %s, want 192.0.2.1", entries[0].IP)
+	}
+	for _, entry := range entries {
+		if entry.IP == "203.0.113.7" && (entry.Count != 2 || entry.FirstSeen != "2026-03-01T12:00:00Z" || entry.LastSeen != "2026-03-01T12:01:00Z") {
+			t.Errorf("203.0.113.7 = %+v", entry)
+		}
+	}
+	want := []GeoConflictPair{{Countries: "RU/UA", Count: 3}, {Countries: "DE/NL", Count: 1}}
+	if fmt.Sprint(pairs) != fmt.Sprint(want) {
+		t.Errorf("pairs = %v, want %v", pairs, want)
+	}
+
+	full := NewGeoConflictLog()
+	for i := 0; i <= maxGeoConflicts; i++ {
+		full.Record(conflict(fmt.Sprintf("10.0.%d.%d", i/256, i%256), "RU", "UA", start.Add(time.Duration(i)*time.Second)))
+	}
+	entries, _, _ = full.Report()
+	if len(entries) != maxGeoConflicts || entries[len(entries)-1].IP != "10.0.0.1" {
+		t.Errorf("after overflow: %d entries, oldest %s; want %d, oldest 10.0.0.1", len(entries), entries[len(entries)-1].IP, maxGeoConflicts)
+	}
+}
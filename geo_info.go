@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// GeoDataSource tells what determined a country and how fresh its data is.
+// Database providers report their build date and when they were loaded;
+// API providers answer live.
+type GeoDataSource struct {
+	Provider    string `json:"provider"`
+	Kind        string `json:"kind"`
+	Database    string `json:"database,omitempty"`
+	BuildDate   string `json:"build_date,omitempty"`
+	RefreshedAt string `json:"refreshed_at,omitempty"`
+}
+
+// GeoProviderInfo describes one configured geolocation provider
+type GeoProviderInfo struct {
+	GeoDataSource
+	Priority int    `json:"priority"`
+	Circuit  string `json:"circuit,omitempty"`
+	Networks int    `json:"networks,omitempty"`
+}
+
+type GeoProviderInfoResponse struct {
+	// Active is the highest-priority provider whose circuit is not open
+	Active      string            `json:"active,omitempty"`
+	Consensus   bool              `json:"consensus"`
+	OfflineMode bool              `json:"offline_mode"`
+	Providers   []GeoProviderInfo `json:"providers"`
+	Updater     GeoIPUpdateStatus `json:"updater"`
+}
+
+// Kinds of geolocation data sources
+const (
+	geoSourceDatabase   = "database"
+	geoSourceSnapshot   = "snapshot"
+	geoSourceAPI        = "api"
+	geoSourceCache      = "cache"
+	geoSourceCorrection = "correction"
+	geoSourceConsensus  = "consensus"
+	geoSourceNone       = "none"
+)
+
+// describeGeoProvider reports a provider's kind, database and freshness
+func describeGeoProvider(provider geoblock.Provider) GeoDataSource {
+	source := GeoDataSource{Provider: provider.Name(), Kind: geoSourceAPI}
+	switch p := provider.(type) {
+	case *geoblock.MaxMind:
+		metadata := p.Metadata()
+		source.Kind = geoSourceDatabase
+		source.Database = metadata.DatabaseType
+		if metadata.BuildEpoch > 0 {
+			source.BuildDate = time.Unix(int64(metadata.BuildEpoch), 0).UTC().Format(time.RFC3339)
+		}
+		source.RefreshedAt = p.LoadedAt().Format(time.RFC3339)
+	case *geoblock.Snapshot:
+		source.Kind = geoSourceSnapshot
+		source.Database = p.Source
+		source.RefreshedAt = p.LoadedAt().Format(time.RFC3339)
+	}
+	return source
+}
+
+// geoDataSource describes the source LookupWithSource reported for a
+// lookup; an empty source means the country was not determined
+func geoDataSource(source string) GeoDataSource {
+	switch source {
+	case "":
+		return GeoDataSource{Provider: "none", Kind: geoSourceNone}
+	case geoblock.SourceOverride:
+		return GeoDataSource{Provider: "geo-corrections", Kind: geoSourceCorrection}
+	case geoblock.SourceCache:
+		// Cached for up to GEO_CACHE_TTL; when it was resolved is not kept
+		return GeoDataSource{Provider: "shared cache", Kind: geoSourceCache}
+	case geoblock.SourceConsensus:
+		return GeoDataSource{Provider: "consensus", Kind: geoSourceConsensus}
+	}
+	for _, provider := range geoResolver.Providers() {
+		if provider.Name() == source {
+			return describeGeoProvider(provider)
+		}
+	}
+	return GeoDataSource{Provider: source, Kind: geoSourceAPI}
+}
+
+// handleGeoProviderInfo reports which geolocation providers and databases
+// are in use, their build dates and when they were last refreshed
+func handleGeoProviderInfo(w http.ResponseWriter, r *http.Request) {
+	response := GeoProviderInfoResponse{
+		Consensus:   geoResolver.Consensus,
+		OfflineMode: offlineMode,
+		Providers:   []GeoProviderInfo{},
+		Updater:     geoIPUpdater.Status(),
+	}
+	statuses := geoResolver.ProviderStatuses()
+	for i, provider := range geoResolver.Providers() {
+		info := GeoProviderInfo{GeoDataSource: describeGeoProvider(provider), Priority: i + 1, Circuit: statuses[i].Circuit}
+		if snapshot, ok := provider.(*geoblock.Snapshot); ok {
+			info.Networks = snapshot.Len()
+		}
+		if response.Active == "" && info.Circuit != string(geoblock.CircuitOpen) {
+			response.Active = info.Provider
+		}
+		response.Providers = append(response.Providers, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestDescribeGeoProvider(t *testing.T) {
+	_, network, _ := net.ParseCIDR("126.0.0.0/8")
+	snapshot := geoblock.NewSnapshot(map[string][]*net.IPNet{"JP": {network}})
+	snapshot.Source = "snapshot.json"
+
+	source := describeGeoProvider(snapshot)
+	if source.Kind != geoSourceSnapshot || source.Database != "snapshot.json" || source.RefreshedAt == "" {
+		t.Errorf("snapshot = %+v, want a snapshot loaded from snapshot.json", source)
+	}
+	if source := describeGeoProvider(geoblock.NewIPAPI("", 0)); source.Kind != geoSourceAPI || source.RefreshedAt != "" {
+		t.Errorf("ip-api = %+v, want a live API", source)
+	}
+}
+
+func TestGeoDataSource(t *testing.T) {
+	tests := []struct {
+		source string
+		kind   string
+	}{
+		{"", geoSourceNone},
+		{geoblock.SourceOverride, geoSourceCorrection},
+		{geoblock.SourceCache, geoSourceCache},
+		{geoblock.SourceConsensus, geoSourceConsensus},
+		{"ipstack", geoSourceAPI},
+	}
+	for _, tt := range tests {
+		if got := geoDataSource(tt.source); got.Kind != tt.kind {
+			t.Errorf("geoDataSource(%q).Kind = %q, want %q", tt.source, got.Kind, tt.kind)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package geoblock
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling a provider whose circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of a provider's circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// circuitBreaker stops calling a provider after consecutive failures, so an
+// outage costs one fast error per lookup instead of a timeout. Once the
+// recovery timeout has passed, a single probe is let through: success closes
+// the circuit, failure opens it again.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	trips    int64
+}
+
+// allow reports whether the provider may be called now, moving an open
+// circuit to half-open once recovery has elapsed
+func (cb *circuitBreaker) allow(now time.Time, recovery time.Duration) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if now.Sub(cb.openedAt) < recovery {
+			return ErrCircuitOpen
+		}
+		cb.state = CircuitHalfOpen
+		cb.probing = true
+		return nil
+	case CircuitHalfOpen:
+		// Only one probe at a time; other lookups skip the provider meanwhile
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	}
+	return nil
+}
+
+// record counts a call's outcome and returns the state it left the circuit
+// in and whether that state changed
+func (cb *circuitBreaker) record(err error, threshold int, now time.Time) (CircuitState, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	previous := cb.current()
+	cb.probing = false
+	if err == nil {
+		cb.state = CircuitClosed
+		cb.failures = 0
+		return CircuitClosed, previous != CircuitClosed
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= threshold {
+		cb.state = CircuitOpen
+		cb.openedAt = now
+		if previous == CircuitClosed {
+			cb.trips++
+		}
+	}
+	return cb.current(), cb.current() != previous
+}
+
+// abandon releases a probe whose outcome says nothing about the provider,
+// such as a lookup cancelled by its caller
+func (cb *circuitBreaker) abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// current returns the state, treating the zero value as closed. Callers must hold cb.mu.
+func (cb *circuitBreaker) current() CircuitState {
+	if cb.state == "" {
+		return CircuitClosed
+	}
+	return cb.state
+}
+
+// report fills the circuit fields of a provider status
+func (cb *circuitBreaker) report(status *ProviderStatus) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status.Circuit = string(cb.current())
+	status.CircuitTrips = cb.trips
+	if cb.state == CircuitOpen || cb.state == CircuitHalfOpen {
+		status.CircuitOpenedAt = cb.openedAt.Format(time.RFC3339)
+	}
+}
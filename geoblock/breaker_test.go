@@ -0,0 +1,73 @@
+package geoblock
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	failure := errors.New("timeout")
+
+	// Each step asks to call the provider at an offset from start and, if
+	// allowed, records the outcome
+	steps := []struct {
+		name      string
+		at        time.Duration
+		err       error
+		wantAllow bool
+		wantState CircuitState
+	}{
+		{"first failure", 0, failure, true, CircuitClosed},
+		{"success resets the count", time.Second, nil, true, CircuitClosed},
+		{"failure 1 of 2", 2 * time.Second, failure, true, CircuitClosed},
+		{"failure 2 of 2 trips", 3 * time.Second, failure, true, CircuitOpen},
+		{"open skips the provider", 4 * time.Second, nil, false, CircuitOpen},
+		{"failed probe reopens", 33 * time.Second, failure, true, CircuitOpen},
+		{"reopened circuit waits again", 40 * time.Second, nil, false, CircuitOpen},
+		{"successful probe closes", 63 * time.Second, nil, true, CircuitClosed},
+	}
+
+	breaker := &circuitBreaker{}
+	for _, step := range steps {
+		now := start.Add(step.at)
+		err := breaker.allow(now, 30*time.Second)
+		if allowed := err == nil; allowed != step.wantAllow {
+			t.Fatalf("%s: allowed = %v, want %v", step.name, allowed, step.wantAllow)
+		}
+		if err == nil {
+			breaker.record(step.err, 2, now)
+		}
+		var status ProviderStatus
+		breaker.report(&status)
+		if status.Circuit != string(step.wantState) {
+			t.Fatalf("%s: state = %s, want %s", step.name, status.Circuit, step.wantState)
+		}
+	}
+
+	var status ProviderStatus
+	breaker.report(&status)
+	if status.CircuitTrips != 1 {
+		t.Errorf("trips = %d, want 1", status.CircuitTrips)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := &circuitBreaker{}
+	breaker.record(errors.New("timeout"), 1, now)
+
+	later := now.Add(time.Minute)
+	if err := breaker.allow(later, time.Second); err != nil {
+		t.Fatalf("probe not allowed: %v", err)
+	}
+	if err := breaker.allow(later, time.Second); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second concurrent call = %v, want ErrCircuitOpen", err)
+	}
+
+	breaker.abandon()
+	if err := breaker.allow(later, time.Second); err != nil {
+		t.Errorf("probe after an abandoned one not allowed: %v", err)
+	}
+}
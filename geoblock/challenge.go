@@ -0,0 +1,265 @@
+package geoblock
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// challengeCookie carries the token of a passed challenge
+const challengeCookie = "geoblock_challenge"
+
+// challengeTTL is how long a passed challenge lets a client through
+const challengeTTL = time.Hour
+
+// challengePage stores a signed token in a cookie with JavaScript and
+// reloads, so clients that run scripts get through and simple bots do not
+var challengePage = template.Must(template.New("challenge").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Checking your browser</title>
+</head>
+<body>
+<p>Checking your browser before continuing&hellip;</p>
+<noscript><p>Your location could not be determined. Enable JavaScript to continue.</p></noscript>
+<script>
+document.cookie = {{.Cookie}} + "=" + {{.Token}} + "; path=/; max-age=" + {{.MaxAge}} + "; SameSite=Lax";
+location.reload();
+</script>
+</body>
+</html>
+`))
+
+// providerChallengePage shows a CAPTCHA widget, posts its token for
+// verification and reloads once the challenge cookie is set
+var providerChallengePage = template.Must(template.New("provider-challenge").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Verify you are human</title>
+</head>
+<body>
+<p>Please complete the check below to continue.</p>
+{{.Widget}}
+<p id="geoblock-status"></p>
+<script>
+function geoblockSolved(token) {
+  fetch({{.VerifyPath}}, {
+    method: "POST",
+    headers: {"Content-Type": "application/x-www-form-urlencoded"},
+    body: "token=" + encodeURIComponent(token),
+    credentials: "same-origin"
+  }).then(function (resp) {
+    if (resp.ok) {
+      location.reload();
+    } else {
+      document.getElementById("geoblock-status").textContent = "Verification failed, please try again.";
+    }
+  });
+}
+</script>
+</body>
+</html>
+`))
+
+// ChallengeProvider is a CAPTCHA service such as Turnstile or hCaptcha
+type ChallengeProvider interface {
+	Name() string
+
+	// Widget returns the HTML that loads the provider's widget. Once solved,
+	// the widget must call the page's geoblockSolved(token) function.
+	Widget() template.HTML
+
+	// Verify checks a token the widget issued to the client at remoteIP
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// siteVerifyWidget loads a CAPTCHA script and renders its widget container
+var siteVerifyWidget = template.Must(template.New("widget").Parse(
+	`<script src="{{.Script}}" async defer></script>
+<div class="{{.Class}}" data-sitekey="{{.SiteKey}}" data-callback="geoblockSolved"></div>`))
+
+// SiteVerify is a ChallengeProvider for CAPTCHA services verified by a
+// siteverify endpoint, as Cloudflare Turnstile and hCaptcha are
+type SiteVerify struct {
+	name      string
+	siteKey   string
+	secret    string
+	verifyURL string
+	script    string
+	class     string
+	client    *http.Client
+}
+
+// NewTurnstile creates a Cloudflare Turnstile challenge provider
+func NewTurnstile(siteKey, secret string) *SiteVerify {
+	return &SiteVerify{
+		name:      "turnstile",
+		siteKey:   siteKey,
+		secret:    secret,
+		verifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+		script:    "https://challenges.cloudflare.com/turnstile/v0/api.js",
+		class:     "cf-turnstile",
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewHCaptcha creates an hCaptcha challenge provider
+func NewHCaptcha(siteKey, secret string) *SiteVerify {
+	return &SiteVerify{
+		name:      "hcaptcha",
+		siteKey:   siteKey,
+		secret:    secret,
+		verifyURL: "https://api.hcaptcha.com/siteverify",
+		script:    "https://js.hcaptcha.com/1/api.js",
+		class:     "h-captcha",
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *SiteVerify) Name() string { return s.name }
+
+// SetHTTPClient replaces the client used to verify challenge responses
+func (s *SiteVerify) SetHTTPClient(client *http.Client) { s.client = client }
+
+func (s *SiteVerify) Widget() template.HTML {
+	var b strings.Builder
+	siteVerifyWidget.Execute(&b, map[string]string{"Script": s.script, "Class": s.class, "SiteKey": s.siteKey})
+	return template.HTML(b.String())
+}
+
+// Verify asks the provider whether the token is a solved challenge
+func (s *SiteVerify) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return errors.New("missing challenge token")
+	}
+	form := url.Values{"secret": {s.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s verification failed: %w", s.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s verification returned status %d", s.name, resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%s verification: invalid response: %w", s.name, err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%s rejected the challenge token: %s", s.name, strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
+
+// challengeToken signs a client IP and the token's expiry
+func challengeToken(secret []byte, ip string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ip + "|" + expiry))
+	return expiry + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validChallengeToken reports whether token was issued to ip and has not expired
+func validChallengeToken(secret []byte, ip, token string, now time.Time) bool {
+	expiry, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return false
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(challengeToken(secret, ip, expires)))
+}
+
+// passedChallenge reports whether the request carries a valid challenge cookie for its client
+func (b *Blocker) passedChallenge(r *http.Request, geo RequestGeo) bool {
+	cookie, err := r.Cookie(challengeCookie)
+	return err == nil && validChallengeToken(b.challengeSecret, geo.ClientIP, cookie.Value, time.Now())
+}
+
+// writeChallenge answers with the provider's CAPTCHA page, or with the
+// built-in JavaScript check when no provider is configured
+func (b *Blocker) writeChallenge(w http.ResponseWriter, geo RequestGeo) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+
+	var err error
+	if b.challenger != nil {
+		err = providerChallengePage.Execute(w, struct {
+			Widget     template.HTML
+			VerifyPath string
+		}{b.challenger.Widget(), b.challengePath})
+	} else {
+		err = challengePage.Execute(w, struct {
+			Cookie string
+			Token  string
+			MaxAge int
+		}{challengeCookie, challengeToken(b.challengeSecret, geo.ClientIP, time.Now().Add(challengeTTL)), int(challengeTTL.Seconds())})
+	}
+	if err != nil {
+		b.logf.printf("❌ Failed to render challenge page: %v", err)
+	}
+}
+
+// VerifyChallenge checks a solved CAPTCHA token posted by the challenge page
+// and, if the provider accepts it, sets the cookie that lets the client
+// through. Mount it at the verify path given to WithChallengeProvider.
+func (b *Blocker) VerifyChallenge(w http.ResponseWriter, r *http.Request) {
+	if b.challenger == nil {
+		http.Error(w, "no challenge provider configured", http.StatusNotFound)
+		return
+	}
+	geo, ok := GeoFromContext(r.Context())
+	if !ok {
+		geo = b.Resolve(r)
+	}
+	if err := b.challenger.Verify(r.Context(), r.FormValue("token"), geo.ClientIP); err != nil {
+		b.logf.printf("⚠️  Challenge failed for %s: %v", geo.ClientIP, err)
+		http.Error(w, "challenge failed", http.StatusForbidden)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     challengeCookie,
+		Value:    challengeToken(b.challengeSecret, geo.ClientIP, time.Now().Add(challengeTTL)),
+		Path:     "/",
+		MaxAge:   int(challengeTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,118 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSiteVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "secret" || r.FormValue("remoteip") != "203.0.113.7" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("response") == "solved" {
+			fmt.Fprint(w, `{"success": true}`)
+			return
+		}
+		fmt.Fprint(w, `{"success": false, "error-codes": ["invalid-input-response"]}`)
+	}))
+	defer server.Close()
+
+	provider := NewTurnstile("site-key", "secret")
+	provider.verifyURL = server.URL
+
+	tests := []struct {
+		token   string
+		wantErr string
+	}{
+		{"solved", ""},
+		{"forged", "invalid-input-response"},
+		{"", "missing challenge token"},
+	}
+	for _, tt := range tests {
+		err := provider.Verify(context.Background(), tt.token, "203.0.113.7")
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("Verify(%q) = %v, want success", tt.token, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Verify(%q) = %v, want error containing %q", tt.token, err, tt.wantErr)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret") {
+			t.Errorf("Verify(%q) error leaks the secret: %v", tt.token, err)
+		}
+	}
+
+	if widget := string(provider.Widget()); !strings.Contains(widget, `data-sitekey="site-key"`) || !strings.Contains(widget, "geoblockSolved") {
+		t.Errorf("Widget() = %s, want the site key and callback", widget)
+	}
+}
+
+// tokenProvider accepts one token
+type tokenProvider string
+
+func (p tokenProvider) Name() string          { return "token" }
+func (p tokenProvider) Widget() template.HTML { return "<div id=widget></div>" }
+func (p tokenProvider) Verify(ctx context.Context, token, remoteIP string) error {
+	if token != string(p) {
+		return errors.New("wrong token")
+	}
+	return nil
+}
+
+func TestBlockerChallengeRule(t *testing.T) {
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{Rules: []Rule{{ID: "borderline", Countries: []string{"BR"}, Challenge: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.IsBlocked("BR") {
+		t.Error("IsBlocked(BR) = true for a challenge rule")
+	}
+
+	resolver := ResolverFunc(func(context.Context, string) (string, error) { return "BR", nil })
+	blocker := New(store, resolver, WithChallengeProvider(tokenProvider("solved"), "/challenge"))
+	handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		return recorder
+	}
+
+	challenged := request(nil)
+	if challenged.Code != http.StatusForbidden || !strings.Contains(challenged.Body.String(), "<div id=widget></div>") {
+		t.Fatalf("first request = %d %s, want the provider's challenge", challenged.Code, challenged.Body.String())
+	}
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/challenge", strings.NewReader("token="+token))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "203.0.113.7:1234"
+		recorder := httptest.NewRecorder()
+		blocker.VerifyChallenge(recorder, req)
+		return recorder
+	}
+	if rejected := verify("forged"); rejected.Code != http.StatusForbidden || len(rejected.Result().Cookies()) != 0 {
+		t.Errorf("forged token = %d with cookies %v, want 403 without a cookie", rejected.Code, rejected.Result().Cookies())
+	}
+	accepted := verify("solved")
+	if accepted.Code != http.StatusNoContent {
+		t.Fatalf("solved token = %d, want %d", accepted.Code, http.StatusNoContent)
+	}
+
+	if passed := request(accepted.Result().Cookies()); passed.Code != http.StatusOK {
+		t.Errorf("request after the challenge = %d, want %d", passed.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,79 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DisputedCountry is the country of clients whose geolocation providers
+// disagree in consensus mode. No rule can match it, so only blocked networks
+// apply to such clients: they are allowed, or challenged with
+// WithDisputedChallenge. A disagreement is an answer, not a failed lookup,
+// so WithFailClosed never blocks them.
+const DisputedCountry = "DISPUTED"
+
+// consensusSize is how many providers must agree on a country
+const consensusSize = 2
+
+// ErrNoConsensus is returned in consensus mode when fewer than two providers answered
+var ErrNoConsensus = errors.New("not enough geolocation providers answered to reach consensus")
+
+// ProviderAnswer is the country one provider resolved
+type ProviderAnswer struct {
+	Provider string `json:"provider"`
+	Country  string `json:"country"`
+}
+
+// Conflict records geolocation providers disagreeing about an address
+type Conflict struct {
+	IP      string           `json:"ip"`
+	Answers []ProviderAnswer `json:"answers"`
+	At      time.Time        `json:"at"`
+}
+
+// consensusLookup asks providers in priority order until two have answered,
+// failing over past providers that fail or whose circuit is open. Agreeing
+// answers are returned; disagreeing ones return DisputedCountry, so the
+// request is not blocked by country, and are reported to OnConflict. Both
+// outcomes are cached. With fewer than two answers the error wraps ErrNoConsensus.
+func (c *Chain) consensusLookup(ctx context.Context, ip string) (string, error) {
+	var answers []ProviderAnswer
+	var failures []string
+	for _, entry := range c.providers {
+		if len(answers) == consensusSize {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		country, err := c.query(ctx, entry, ip)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", entry.provider.Name(), err))
+			continue
+		}
+		answers = append(answers, ProviderAnswer{Provider: entry.provider.Name(), Country: country})
+	}
+	if len(answers) < consensusSize {
+		if len(failures) == 0 {
+			return "", fmt.Errorf("%w: %d providers configured", ErrNoConsensus, len(c.providers))
+		}
+		return "", fmt.Errorf("%w (%s)", ErrNoConsensus, strings.Join(failures, "; "))
+	}
+
+	country := answers[0].Country
+	if answers[1].Country != country {
+		country = DisputedCountry
+		c.Logf.printf("⚖️  Geo providers disagree for %s: %s says %s, %s says %s",
+			ip, answers[0].Provider, answers[0].Country, answers[1].Provider, answers[1].Country)
+		if c.OnConflict != nil {
+			c.OnConflict(Conflict{IP: ip, Answers: answers, At: time.Now()})
+		}
+	}
+	if c.Cache != nil {
+		c.Cache.Set(ctx, ip, country)
+	}
+	return country, nil
+}
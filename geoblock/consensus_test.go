@@ -0,0 +1,105 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChainConsensus(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []Provider
+		want      string
+		wantErr   error
+		conflict  bool
+	}{
+		{"agree", []Provider{&countingProvider{country: "ru"}, &countingProvider{country: "RU"}}, "RU", nil, false},
+		{"disagree", []Provider{&countingProvider{country: "RU"}, &countingProvider{country: "UA"}}, DisputedCountry, nil, true},
+		{"fails over to a third provider", []Provider{&countingProvider{country: "RU"}, &failingProvider{}, &countingProvider{country: "RU"}}, "RU", nil, false},
+		{"one answer", []Provider{&countingProvider{country: "RU"}, &failingProvider{}}, "", ErrNoConsensus, false},
+		{"one provider", []Provider{&countingProvider{country: "RU"}}, "", ErrNoConsensus, false},
+	}
+	for _, tt := range tests {
+		var conflicts []Conflict
+		chain := NewChain()
+		chain.Consensus = true
+		chain.OnConflict = func(conflict Conflict) { conflicts = append(conflicts, conflict) }
+		cache := mapCache{}
+		chain.Cache = cache
+		for _, provider := range tt.providers {
+			chain.Add(provider, 0)
+		}
+
+		got, err := chain.Lookup(context.Background(), "203.0.113.7")
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Lookup = %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+		if (len(conflicts) == 1) != tt.conflict {
+			t.Errorf("%s: %d conflicts reported", tt.name, len(conflicts))
+		}
+		if tt.want != "" && cache["203.0.113.7"] != tt.want {
+			t.Errorf("%s: cached %q, want %q", tt.name, cache["203.0.113.7"], tt.want)
+		}
+	}
+}
+
+func TestChainConsensusStopsAtTwoAnswers(t *testing.T) {
+	third := &countingProvider{country: "RU"}
+	chain := NewChain()
+	chain.Consensus = true
+	chain.Add(&countingProvider{country: "RU"}, 0)
+	chain.Add(&countingProvider{country: "RU"}, 0)
+	chain.Add(third, 0)
+
+	if _, err := chain.Lookup(context.Background(), "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if third.lookups != 0 {
+		t.Errorf("third provider was asked %d times after two agreed", third.lookups)
+	}
+}
+
+func TestConsensusDisagreementFailClosed(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{BlockedCountries: []string{"RU"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		providers      []Provider
+		options        []Option
+		wantBlocked    bool
+		wantChallenged bool
+	}{
+		{"disagreement allowed", []Provider{&countingProvider{country: "RU"}, &countingProvider{country: "UA"}}, nil, false, false},
+		{"disagreement challenged", []Provider{&countingProvider{country: "RU"}, &countingProvider{country: "UA"}}, []Option{WithDisputedChallenge()}, false, true},
+		{"no consensus fails closed", []Provider{&countingProvider{country: "RU"}, &failingProvider{}}, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := NewChain()
+			chain.Consensus = true
+			for _, provider := range tt.providers {
+				chain.Add(provider, 0)
+			}
+			var decision Decision
+			options := append([]Option{
+				WithFailClosed(),
+				WithChallengeSecret([]byte("secret")),
+				WithDecisionHook(func(r *http.Request, d Decision) { decision = d }),
+			}, tt.options...)
+			blocker := New(store, chain, options...)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "203.0.113.7:1234"
+			blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(httptest.NewRecorder(), req)
+			if decision.Blocked != tt.wantBlocked || decision.Challenged != tt.wantChallenged {
+				t.Errorf("blocked %v, challenged %v; want %v, %v", decision.Blocked, decision.Challenged, tt.wantBlocked, tt.wantChallenged)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package geoblock
+
+import (
+	"sync"
+	"time"
+)
+
+// decisionKey identifies the requests a cached decision applies to
+type decisionKey struct {
+	ip        string
+	host      string
+	path      string
+	principal string
+}
+
+// decisionEntry is a cached decision, the policy snapshot it was made
+// under and when it expires
+type decisionEntry struct {
+	decision Decision
+	snapshot *snapshot
+	expires  time.Time
+}
+
+// decisionCache remembers decisions for a TTL, keeping at most maxEntries.
+// An entry made under an older policy snapshot is never returned, so every
+// policy change invalidates the whole cache.
+type decisionCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[decisionKey]decisionEntry
+}
+
+func newDecisionCache(ttl time.Duration, maxEntries int) *decisionCache {
+	return &decisionCache{ttl: ttl, maxEntries: maxEntries, entries: make(map[decisionKey]decisionEntry)}
+}
+
+// get returns the decision cached for key under the current snapshot
+func (c *decisionCache) get(key decisionKey, current *snapshot, now time.Time) (Decision, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || entry.snapshot != current || !now.Before(entry.expires) {
+		return Decision{}, false
+	}
+	return entry.decision, true
+}
+
+// put caches a decision made under a snapshot
+func (c *decisionCache) put(key decisionKey, decision Decision, made *snapshot, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		// Drop stale entries first, then everything if still full
+		for k, cached := range c.entries {
+			if cached.snapshot != made || !now.Before(cached.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = make(map[decisionKey]decisionEntry)
+		}
+	}
+	c.entries[key] = decisionEntry{decision: decision, snapshot: made, expires: now.Add(c.ttl)}
+}
+
+// clear drops every cached decision
+func (c *decisionCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[decisionKey]decisionEntry)
+	c.mu.Unlock()
+}
+
+// WithDecisionCache remembers each client's decision for ttl, keyed by the
+// client IP (see WithClientIP), request path and principal, so repeat
+// requests skip geolocation and rule evaluation. Every policy change in the
+// store invalidates the cache; call ClearDecisions when the location of
+// clients changes outside it, e.g. after correcting a lookup. At most
+// maxEntries decisions are kept. Clients that could not be located or
+// scored are not cached, and challenges are still checked on every request.
+func WithDecisionCache(ttl time.Duration, maxEntries int) Option {
+	return func(b *Blocker) { b.decisions = newDecisionCache(ttl, maxEntries) }
+}
+
+// ClearDecisions drops every cached decision
+func (b *Blocker) ClearDecisions() {
+	if b.decisions != nil {
+		b.decisions.clear()
+	}
+}
+
+// cacheable reports whether a decision may be reused for later requests:
+// transient lookup failures are retried instead
+func (b *Blocker) cacheable(decision Decision) bool {
+	if decision.Exemption != nil {
+		return true
+	}
+	if decision.Geo.LookupFailed {
+		return false
+	}
+	return b.reputation == nil || decision.Geo.ReputationKnown || !b.store.UsesReputation()
+}
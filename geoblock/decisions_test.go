@@ -0,0 +1,88 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDecisionCache(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{BlockedCountries: []string{"RU"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := 0
+	fail := false
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) {
+		lookups++
+		if fail {
+			return "", errors.New("provider down")
+		}
+		return "RU", nil
+	})
+	blocker := New(store, resolver, WithDecisionCache(time.Minute, 100))
+	handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := func(remoteAddr, path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		return recorder.Code
+	}
+
+	steps := []struct {
+		name        string
+		remoteAddr  string
+		path        string
+		change      func()
+		wantStatus  int
+		wantLookups int
+	}{
+		{"first request resolved", "203.0.113.7:1", "/", nil, http.StatusForbidden, 1},
+		{"repeat served from cache", "203.0.113.7:2", "/", nil, http.StatusForbidden, 1},
+		{"other path resolved", "203.0.113.7:1", "/other", nil, http.StatusForbidden, 2},
+		{"other client resolved", "203.0.113.8:1", "/", nil, http.StatusForbidden, 3},
+		{"policy change invalidates", "203.0.113.7:1", "/", func() {
+			store.ReplacePolicy(&Policy{})
+		}, http.StatusOK, 4},
+		{"cleared cache resolved", "203.0.113.7:1", "/", blocker.ClearDecisions, http.StatusOK, 5},
+		{"failed lookup", "203.0.113.9:1", "/", func() { fail = true }, http.StatusOK, 6},
+		{"failed lookup not cached", "203.0.113.9:1", "/", nil, http.StatusOK, 7},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			step.change()
+		}
+		if got := request(step.remoteAddr, step.path); got != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d", step.name, got, step.wantStatus)
+		}
+		if lookups != step.wantLookups {
+			t.Errorf("%s: %d lookups, want %d", step.name, lookups, step.wantLookups)
+		}
+	}
+}
+
+func TestDecisionCacheEviction(t *testing.T) {
+	cache := newDecisionCache(time.Minute, 2)
+	current := &snapshot{}
+	now := time.Now()
+	for _, ip := range []string{"a", "b", "c"} {
+		cache.put(decisionKey{ip: ip}, Decision{Blocked: true}, current, now)
+	}
+	if len(cache.entries) > 2 {
+		t.Errorf("%d entries, want at most 2", len(cache.entries))
+	}
+	if _, ok := cache.get(decisionKey{ip: "c"}, current, now); !ok {
+		t.Error("latest entry was evicted")
+	}
+	if _, ok := cache.get(decisionKey{ip: "c"}, current, now.Add(time.Minute)); ok {
+		t.Error("expired entry returned")
+	}
+	if _, ok := cache.get(decisionKey{ip: "c"}, &snapshot{}, now); ok {
+		t.Error("entry of an older policy returned")
+	}
+}
@@ -0,0 +1,18 @@
+// Package geoblock blocks HTTP requests by client country and IP network.
+//
+// A Store holds the blocking Policy and is safe for concurrent use; a
+// Resolver maps client IPs to ISO 3166-1 alpha-2 country codes; and a
+// Blocker is the middleware that ties them together:
+//
+//	store := geoblock.NewStore()
+//	store.ReplacePolicy(&geoblock.Policy{BlockedCountries: []string{"KP"}})
+//
+//	resolver := geoblock.NewChain()
+//	resolver.Add(geoblock.NewIPAPI("", 2*time.Second), 2*time.Second)
+//
+//	blocker := geoblock.New(store, resolver)
+//	http.ListenAndServe(":8080", blocker.Handler(mux))
+//
+// Country codes in a Policy must already be normalized to upper-case
+// alpha-2 codes; the store indexes them as given.
+package geoblock
@@ -0,0 +1,168 @@
+package geoblock
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// Step is one check made while deciding a request. Check is skip_path,
+// exemption, network, country or fail_closed; Outcome is what the candidate
+// would do: skip, exempt, block, challenge, monitor, allow, inactive,
+// other_host, reputation_below or no_match. Decisive marks the step that determined the decision.
+type Step struct {
+	Check     string `json:"check"`
+	Subject   string `json:"subject"`
+	RuleID    string `json:"rule_id,omitempty"`
+	Network   string `json:"network,omitempty"`
+	Exemption string `json:"exemption,omitempty"`
+	Outcome   string `json:"outcome"`
+	Decisive  bool   `json:"decisive,omitempty"`
+
+	match *Match
+}
+
+// ExplainedResponse is what the client would receive. Body is only set for
+// rejected requests; allowed ones reach the protected handler.
+type ExplainedResponse struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// Explanation traces how the Blocker decides a request
+type Explanation struct {
+	Decision Decision
+	Steps    []Step
+	Response ExplainedResponse
+}
+
+// Explain decides a request for the given location and principal like
+// HandlerFunc, without the decision hook or the next handler, and lists the
+// checks in the order they were made. Evaluation stops at the first
+// exemption or enforced match, as it does for real requests.
+func (b *Blocker) Explain(r *http.Request, geo RequestGeo, principal string) Explanation {
+	if b.Skips(r) {
+		return Explanation{
+			Decision: Decision{Geo: geo, Skipped: true},
+			Steps:    []Step{{Check: "skip_path", Subject: r.URL.Path, Outcome: "skip", Decisive: true}},
+			Response: ExplainedResponse{StatusCode: http.StatusOK},
+		}
+	}
+	decision := b.decide(r, geo, principal)
+	explanation := Explanation{Decision: decision, Steps: b.trace(decision.Geo, principal, time.Now())}
+	for i := range explanation.Steps {
+		step := &explanation.Steps[i]
+		switch {
+		case decision.Exemption != nil:
+			step.Decisive = step.Check == "exemption" && step.Outcome == "exempt"
+		case decision.Match != nil:
+			step.Decisive = step.match == decision.Match
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	if !b.reject(recorder, r, decision) {
+		recorder.WriteHeader(http.StatusOK)
+	}
+	explanation.Response = ExplainedResponse{
+		StatusCode:  recorder.Code,
+		ContentType: recorder.Header().Get("Content-Type"),
+		Location:    recorder.Header().Get("Location"),
+		Body:        recorder.Body.String(),
+	}
+	return explanation
+}
+
+// trace lists the candidates Check considers for a location, mirroring its order
+func (b *Blocker) trace(geo RequestGeo, principal string, now time.Time) []Step {
+	var steps []Step
+	if exemption := b.exemption(geo, principal); exemption != nil {
+		return append(steps, Step{Check: "exemption", Subject: exemptionSubject(geo, principal), Exemption: exemption.ID, Outcome: "exempt"})
+	}
+	steps = append(steps, Step{Check: "exemption", Subject: exemptionSubject(geo, principal), Outcome: "no_match"})
+
+	current := b.store.current.Load()
+	decided := false
+	visit := func(check, subject string, match *Match) {
+		step := Step{Check: check, Subject: subject, RuleID: match.RuleID(), Network: match.Network, Outcome: matchOutcome(match), match: match}
+		switch {
+		case !match.activeAt(now):
+			step.Outcome = "inactive"
+		case !match.appliesToHost(geo.Host):
+			step.Outcome = "other_host"
+		case !match.appliesTo(geo):
+			step.Outcome = "reputation_below"
+		}
+		steps = append(steps, step)
+		decided = step.Outcome == "block" || step.Outcome == "challenge" || step.Outcome == "allow"
+	}
+
+	addresses := []string{geo.ClientIP}
+	if geo.ActualIP != geo.ClientIP {
+		addresses = append(addresses, geo.ActualIP)
+	}
+	for _, ip := range addresses {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			continue
+		}
+		matched := false
+		for _, entry := range current.networks {
+			if entry.network.Contains(parsed) {
+				matched = true
+				if visit("network", ip, entry.match); decided {
+					return steps
+				}
+			}
+		}
+		if !matched {
+			steps = append(steps, Step{Check: "network", Subject: ip, Outcome: "no_match"})
+		}
+	}
+
+	active := false
+	for _, match := range current.matches[geo.Country] {
+		if visit("country", geo.Country, match); decided {
+			return steps
+		}
+		active = active || (match.activeAt(now) && match.appliesTo(geo))
+	}
+	if len(current.matches[geo.Country]) == 0 {
+		steps = append(steps, Step{Check: "country", Subject: geo.Country, Outcome: "no_match"})
+	}
+	switch {
+	case !active && geo.Country == UnknownCountry && b.failClosed:
+		visit("fail_closed", geo.Country, current.failClosed)
+	case !active && geo.Country == DisputedCountry && b.challengeDisputed:
+		visit("disputed", geo.Country, current.disputed)
+	}
+	return steps
+}
+
+// matchOutcome is what an active match does to a request
+func matchOutcome(match *Match) string {
+	switch {
+	case match.Fallback == FallbackAllow:
+		return "allow"
+	case match.Monitor:
+		return "monitor"
+	case match.Challenges():
+		return "challenge"
+	}
+	return "block"
+}
+
+// exemptionSubject describes what the exemption check looked at
+func exemptionSubject(geo RequestGeo, principal string) string {
+	subject := geo.ClientIP
+	if geo.ActualIP != geo.ClientIP {
+		subject += ", " + geo.ActualIP
+	}
+	if principal != "" {
+		subject += ", principal " + principal
+	}
+	return subject
+}
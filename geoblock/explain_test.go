@@ -0,0 +1,69 @@
+package geoblock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBlockerExplain(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{
+		BlockedCountries: []string{"RU"},
+		Rules: []Rule{
+			{ID: "expired", Countries: []string{"RU"}, EffectiveUntil: &past},
+			{ID: "trial", Countries: []string{"RU"}, Monitor: true},
+			{ID: "partners", Networks: []string{"198.51.100.0/24"}, Monitor: true},
+			{ID: "borderline", Countries: []string{"BR"}, Challenge: true},
+		},
+		Exemptions: []Exemption{{ID: "office", Networks: []string{"192.0.2.0/24"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocker := New(store, nil)
+
+	tests := []struct {
+		name         string
+		geo          RequestGeo
+		wantOutcomes []string
+		wantDecisive int
+		wantStatus   int
+	}{
+		{"exempt", RequestGeo{ClientIP: "192.0.2.1", ActualIP: "192.0.2.1", Country: "RU"},
+			[]string{"exempt"}, 0, http.StatusOK},
+		{"blocked after inactive and monitored rules", RequestGeo{ClientIP: "198.51.100.7", ActualIP: "198.51.100.7", Country: "RU"},
+			[]string{"no_match", "monitor", "inactive", "monitor", "block"}, 4, http.StatusForbidden},
+		{"challenged", RequestGeo{ClientIP: "203.0.113.7", ActualIP: "203.0.113.7", Country: "BR"},
+			[]string{"no_match", "no_match", "challenge"}, 2, http.StatusForbidden},
+		{"allowed", RequestGeo{ClientIP: "203.0.113.7", ActualIP: "203.0.113.7", Country: "US"},
+			[]string{"no_match", "no_match", "no_match"}, -1, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explanation := blocker.Explain(httptest.NewRequest("GET", "/checkout", nil), tt.geo, "")
+
+			var outcomes []string
+			decisive := -1
+			for i, step := range explanation.Steps {
+				outcomes = append(outcomes, step.Outcome)
+				if step.Decisive {
+					decisive = i
+				}
+			}
+			if !reflect.DeepEqual(outcomes, tt.wantOutcomes) {
+				t.Errorf("outcomes = %v, want %v", outcomes, tt.wantOutcomes)
+			}
+			if decisive != tt.wantDecisive {
+				t.Errorf("decisive step = %d, want %d", decisive, tt.wantDecisive)
+			}
+			if explanation.Response.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", explanation.Response.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
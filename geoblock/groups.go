@@ -0,0 +1,82 @@
+package geoblock
+
+import "fmt"
+
+// CountryGroup names a set of countries, such as a trade bloc, that rules
+// can block together
+type CountryGroup struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Countries   []string `json:"countries"`
+}
+
+// BuiltinCountryGroups are the regional groups every policy can use.
+// Programs may add their own, such as continents, before loading a policy.
+var BuiltinCountryGroups = []CountryGroup{
+	{
+		ID:   "eu",
+		Name: "European Union",
+		Countries: []string{"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+			"IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK"},
+	},
+	{
+		ID:          "eea",
+		Name:        "European Economic Area",
+		Description: "The EU together with Iceland, Liechtenstein and Norway",
+		Countries: []string{"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+			"IE", "IS", "IT", "LI", "LT", "LU", "LV", "MT", "NL", "NO", "PL", "PT", "RO", "SE", "SI", "SK"},
+	},
+	{
+		ID:        "gcc",
+		Name:      "Gulf Cooperation Council",
+		Countries: []string{"AE", "BH", "KW", "OM", "QA", "SA"},
+	},
+	{
+		ID:        "asean",
+		Name:      "Association of Southeast Asian Nations",
+		Countries: []string{"BN", "ID", "KH", "LA", "MM", "MY", "PH", "SG", "TH", "TL", "VN"},
+	},
+}
+
+// CountryGroup finds a group by ID among the policy's groups, then the built-in ones
+func (p *Policy) CountryGroup(id string) (*CountryGroup, bool) {
+	for _, groups := range [][]CountryGroup{p.CountryGroups, BuiltinCountryGroups} {
+		for i := range groups {
+			if groups[i].ID == id {
+				return &groups[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// RuleCountries returns a rule's countries followed by the members of its
+// groups, without duplicates or the rule's excepted countries
+func (p *Policy) RuleCountries(rule *Rule) ([]string, error) {
+	if len(rule.Groups) == 0 && len(rule.ExceptCountries) == 0 {
+		return rule.Countries, nil
+	}
+	seen := make(map[string]bool, len(rule.Countries)+len(rule.ExceptCountries))
+	for _, code := range rule.ExceptCountries {
+		seen[code] = true
+	}
+	var countries []string
+	add := func(codes []string) {
+		for _, code := range codes {
+			if !seen[code] {
+				seen[code] = true
+				countries = append(countries, code)
+			}
+		}
+	}
+	add(rule.Countries)
+	for _, id := range rule.Groups {
+		group, ok := p.CountryGroup(id)
+		if !ok {
+			return nil, fmt.Errorf("rule %s: unknown country group %q", rule.ID, id)
+		}
+		add(group.Countries)
+	}
+	return countries, nil
+}
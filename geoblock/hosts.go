@@ -0,0 +1,31 @@
+package geoblock
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NormalizeHost lowercases a host and strips any port and trailing dot, so
+// "MyShop.de:443" and "myshop.de." both become "myshop.de"
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// RequestHost returns the normalized host a request was for
+func RequestHost(r *http.Request) string {
+	return NormalizeHost(r.Host)
+}
+
+// HostMatches reports whether a normalized host matches a rule's host
+// pattern: an exact domain, or "*.domain" for any of its subdomains
+func HostMatches(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
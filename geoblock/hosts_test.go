@@ -0,0 +1,81 @@
+package geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHostMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"myshop.de", "myshop.de", true},
+		{"myshop.de", "www.myshop.de", false},
+		{"*.myshop.de", "www.myshop.de", true},
+		{"*.myshop.de", "a.b.myshop.de", true},
+		{"*.myshop.de", "myshop.de", false},
+		{"*.myshop.de", "notmyshop.de", false},
+		{"myshop.de", "", false},
+	}
+	for _, tt := range tests {
+		if got := HostMatches(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("HostMatches(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+
+	for input, want := range map[string]string{"MyShop.DE:443": "myshop.de", "myshop.fr.": "myshop.fr", "[::1]:8080": "::1", " shop.example ": "shop.example"} {
+		if got := NormalizeHost(input); got != want {
+			t.Errorf("NormalizeHost(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestBlockerHostRules(t *testing.T) {
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{
+		BlockedCountries: []string{"RU"},
+		Rules: []Rule{
+			{ID: "de-shop", Countries: []string{"FR"}, Hosts: []string{"myshop.de", "*.myshop.de"}, Response: &ResponseTemplate{StatusCode: http.StatusUnavailableForLegalReasons}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.IsBlocked("FR") {
+		t.Error("a country blocked on one domain is reported as blocked everywhere")
+	}
+
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) { return "FR", nil })
+	blocker := New(store, resolver, WithDecisionCache(time.Minute, 10))
+	handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		host       string
+		wantStatus int
+	}{
+		{"myshop.de", http.StatusUnavailableForLegalReasons},
+		{"WWW.MyShop.de:443", http.StatusUnavailableForLegalReasons},
+		{"myshop.fr", http.StatusOK},
+		{"myshop.de", http.StatusUnavailableForLegalReasons},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = tt.host
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		if recorder.Code != tt.wantStatus {
+			t.Errorf("request for %s = %d, want %d", tt.host, recorder.Code, tt.wantStatus)
+		}
+	}
+
+	for _, host := range []string{"MyShop.de", "*.*.myshop.de", "*."} {
+		if _, err := store.ReplacePolicy(&Policy{Rules: []Rule{{ID: "bad", Countries: []string{"FR"}, Hosts: []string{host}}}}); err == nil {
+			t.Errorf("host %q was accepted", host)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package geoblock
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UnknownCountry is the country of clients whose location could not be resolved
+const UnknownCountry = "UNKNOWN"
+
+// RequestGeo is the client location resolved for a request. ActualIP
+// differs from ClientIP when the geo function looked up a different
+// address, such as the public address behind a private client IP.
+// LookupFailed is set when Country is UnknownCountry because geolocation
+// failed, e.g. every provider errored or had its circuit open.
+type RequestGeo struct {
+	ClientIP     string
+	ActualIP     string
+	Country      string
+	LookupFailed bool
+
+	// Host is the domain the request was for, as normalized by RequestHost.
+	// Rules scoped to hosts only match requests for one of theirs.
+	Host string
+
+	// Reputation is the client's abuse score from 0 to 100, set when
+	// ReputationKnown is. It is only looked up when a rule depends on it.
+	Reputation      int
+	ReputationKnown bool
+}
+
+type geoContextKey struct{}
+
+// ContextWithGeo attaches a resolved location to a context. The Blocker
+// uses a location already in the context instead of resolving the request,
+// which lets callers evaluate synthetic requests.
+func ContextWithGeo(ctx context.Context, geo RequestGeo) context.Context {
+	return context.WithValue(ctx, geoContextKey{}, geo)
+}
+
+// GeoFromContext returns the location resolved for the request, if any
+func GeoFromContext(ctx context.Context) (RequestGeo, bool) {
+	geo, ok := ctx.Value(geoContextKey{}).(RequestGeo)
+	return geo, ok
+}
+
+// Decision is what the Blocker decided for one request. Match is nil when
+// no rule matched. Monitored requests matched a monitor-mode rule and were
+// allowed; Match then holds the rule that would have blocked them.
+// Exemption is set when an exemption let the request through unchecked.
+// Skipped requests were on a skip path and not located or checked at all.
+// Challenged requests matched a challenge rule or fallback and were answered
+// with a challenge page instead; once passed, they are allowed with Match
+// still set. Sticky requests were allowed by the decision recorded in their
+// cookie, without locating the client again.
+type Decision struct {
+	Geo        RequestGeo
+	Blocked    bool
+	Monitored  bool
+	Challenged bool
+	Match      *Match
+	Exemption  *Exemption
+	Skipped    bool
+	Sticky     bool
+}
+
+// Blocker is HTTP middleware that rejects requests from blocked countries
+// and networks with the matching rule's block response
+type Blocker struct {
+	store        *Store
+	resolver     Resolver
+	clientIP     func(*http.Request) string
+	geoFunc      func(*http.Request) RequestGeo
+	principal    func(*http.Request) string
+	countryName  func(string) string
+	onDecision   func(*http.Request, Decision)
+	debugHeaders bool
+	failClosed   bool
+	logf         Logf
+
+	reputation ReputationProvider
+	decisions  *decisionCache
+	stickyTTL  time.Duration
+
+	challengeSecret   []byte
+	challenger        ChallengeProvider
+	challengePath     string
+	challengeDisputed bool
+
+	skipPaths []string
+}
+
+// Option configures a Blocker
+type Option func(*Blocker)
+
+// WithClientIP sets how the client IP is taken from a request. The default
+// is the peer address, which is only correct without a reverse proxy.
+func WithClientIP(clientIP func(*http.Request) string) Option {
+	return func(b *Blocker) { b.clientIP = clientIP }
+}
+
+// WithGeoFunc replaces client IP extraction and resolver lookup with a
+// function that resolves the whole location
+func WithGeoFunc(geoFunc func(*http.Request) RequestGeo) Option {
+	return func(b *Blocker) { b.geoFunc = geoFunc }
+}
+
+// WithPrincipal sets how the authenticated caller's name is taken from a
+// request, for exemptions listing principals. It must return "" for
+// unauthenticated requests.
+func WithPrincipal(principal func(*http.Request) string) Option {
+	return func(b *Blocker) { b.principal = principal }
+}
+
+// WithCountryNames provides country names for block page templates
+func WithCountryNames(countryName func(code string) string) Option {
+	return func(b *Blocker) { b.countryName = countryName }
+}
+
+// WithDecisionHook is called with every allow or block decision, e.g. for
+// logging or metrics. It runs on the request goroutine and must not block.
+func WithDecisionHook(hook func(*http.Request, Decision)) Option {
+	return func(b *Blocker) { b.onDecision = hook }
+}
+
+// WithDebugHeaders adds X-Client-Country and X-Client-IP to allowed responses
+func WithDebugHeaders() Option {
+	return func(b *Blocker) { b.debugHeaders = true }
+}
+
+// WithFailClosed blocks requests of an unknown country with the policy's
+// default block response when neither the policy nor a rule sets an
+// unknown_country fallback. By default they fail open and are only checked
+// against blocked networks.
+func WithFailClosed() Option {
+	return func(b *Blocker) { b.failClosed = true }
+}
+
+// WithDisputedChallenge challenges clients whose geolocation providers
+// disagree in consensus mode, instead of allowing them
+func WithDisputedChallenge() Option {
+	return func(b *Blocker) { b.challengeDisputed = true }
+}
+
+// WithChallengeProvider serves the provider's CAPTCHA as the challenge
+// instead of the built-in JavaScript check. Solved tokens are posted to
+// verifyPath, where VerifyChallenge must be mounted outside the Blocker.
+func WithChallengeProvider(provider ChallengeProvider, verifyPath string) Option {
+	return func(b *Blocker) {
+		b.challenger = provider
+		b.challengePath = verifyPath
+	}
+}
+
+// WithChallengeSecret signs challenge cookies. Replicas behind a load
+// balancer need the same secret to honor each other's challenges; without
+// one, a random secret is generated.
+func WithChallengeSecret(secret []byte) Option {
+	return func(b *Blocker) { b.challengeSecret = secret }
+}
+
+// WithReputation scores clients with provider when a rule depends on
+// reputation. Lookups that fail leave the score unknown, so such rules do
+// not match.
+func WithReputation(provider ReputationProvider) Option {
+	return func(b *Blocker) { b.reputation = provider }
+}
+
+// WithSkipPaths lets requests for the given paths through without locating
+// or checking them, e.g. health checks probed from every cloud region. A
+// path ending in "/" or "*" matches every path it prefixes ("*" itself is
+// dropped); any other path matches only itself.
+func WithSkipPaths(paths ...string) Option {
+	return func(b *Blocker) { b.skipPaths = append(b.skipPaths, paths...) }
+}
+
+// Skips reports whether a request's path is on the skip list
+func (b *Blocker) Skips(r *http.Request) bool {
+	for _, path := range b.skipPaths {
+		switch {
+		case strings.HasSuffix(path, "*"):
+			if strings.HasPrefix(r.URL.Path, strings.TrimSuffix(path, "*")) {
+				return true
+			}
+		case strings.HasSuffix(path, "/"):
+			if strings.HasPrefix(r.URL.Path, path) {
+				return true
+			}
+		case r.URL.Path == path:
+			return true
+		}
+	}
+	return false
+}
+
+// WithLogf receives lookup and rendering errors
+func WithLogf(logf Logf) Option {
+	return func(b *Blocker) { b.logf = logf }
+}
+
+// New creates a Blocker enforcing the store's policy, locating clients with resolver
+func New(store *Store, resolver Resolver, opts ...Option) *Blocker {
+	b := &Blocker{
+		store:    store,
+		resolver: resolver,
+		clientIP: func(r *http.Request) string { return CanonicalIP(r.RemoteAddr) },
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if len(b.challengeSecret) == 0 {
+		b.challengeSecret = make([]byte, 32)
+		rand.Read(b.challengeSecret)
+	}
+	return b
+}
+
+// Resolve determines the client's IP and country, and the host the request was for
+func (b *Blocker) Resolve(r *http.Request) RequestGeo {
+	geo := b.resolve(r)
+	geo.Host = RequestHost(r)
+	return geo
+}
+
+// resolve determines the client's IP and country
+func (b *Blocker) resolve(r *http.Request) RequestGeo {
+	if b.geoFunc != nil {
+		return b.geoFunc(r)
+	}
+
+	ip := b.clientIP(r)
+	geo := RequestGeo{ClientIP: ip, ActualIP: ip, Country: UnknownCountry}
+	if b.resolver != nil && ip != "" {
+		country, err := b.resolver.Lookup(r.Context(), ip)
+		if err != nil {
+			b.logf.printf("⚠️  Could not determine country for IP %s: %v", ip, err)
+			geo.LookupFailed = true
+		} else if country != "" {
+			geo.Country = country
+		}
+	}
+	return geo
+}
+
+// Exempt returns the exemption covering a request's client, checking the
+// authenticated principal, the client IP and the looked-up IP
+func (b *Blocker) Exempt(r *http.Request, geo RequestGeo) *Exemption {
+	return b.exemption(geo, b.principalOf(r))
+}
+
+// principalOf returns the request's authenticated principal, or ""
+func (b *Blocker) principalOf(r *http.Request) string {
+	if b.principal == nil {
+		return ""
+	}
+	return b.principal(r)
+}
+
+// exemption returns the exemption covering a principal, the client IP or the looked-up IP
+func (b *Blocker) exemption(geo RequestGeo, principal string) *Exemption {
+	exemption := b.store.Exemption(geo.ClientIP, principal)
+	if exemption == nil && geo.ActualIP != geo.ClientIP {
+		exemption = b.store.Exemption(geo.ActualIP, "")
+	}
+	return exemption
+}
+
+// Check returns the match blocking a location right now, or nil if it is
+// allowed. Blocked networks are checked before the country, and an enforced
+// match wins over a monitor-mode one. An unknown country is handled by the
+// first rule or the policy setting an unknown_country fallback, or blocked
+// if the Blocker fails closed; an allow fallback lets it through. A
+// disputed country is allowed unless the Blocker challenges it. Rules
+// depending on reputation only match if geo carries a high enough score.
+func (b *Blocker) Check(geo RequestGeo) *Match {
+	var monitored *Match
+	enforced := func(match *Match) bool {
+		if match != nil && match.Monitor && monitored == nil {
+			monitored = match
+		}
+		return match != nil && !match.Monitor
+	}
+
+	now := time.Now()
+	applies := func(match *Match) bool { return match.appliesTo(geo) }
+	if match := b.store.matchIPAt(geo.ClientIP, now, applies); enforced(match) {
+		return match
+	}
+	if geo.ActualIP != geo.ClientIP {
+		if match := b.store.matchIPAt(geo.ActualIP, now, applies); enforced(match) {
+			return match
+		}
+	}
+	match := b.store.matchAt(geo.Country, now, applies)
+	switch {
+	case match == nil && geo.Country == UnknownCountry && b.failClosed:
+		match = b.store.FailClosedMatch()
+	case match == nil && geo.Country == DisputedCountry && b.challengeDisputed:
+		match = b.store.current.Load().disputed
+	}
+	if match != nil && match.Fallback == FallbackAllow {
+		return monitored
+	}
+	if enforced(match) {
+		return match
+	}
+	return monitored
+}
+
+// HandlerFunc wraps next, answering blocked requests itself. Allowed
+// requests reach next with the resolved location in their context.
+func (b *Blocker) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b.Skips(r) {
+			next(w, r)
+			return
+		}
+		decision := b.decideRequest(r)
+		if b.onDecision != nil {
+			b.onDecision(r, decision)
+		}
+		if _, synthetic := GeoFromContext(r.Context()); b.stickyTTL > 0 && !synthetic {
+			b.setStickyCookie(w, r, decision)
+		}
+		if b.reject(w, r, decision) {
+			return
+		}
+
+		geo := decision.Geo
+		if b.debugHeaders {
+			w.Header().Set("X-Client-Country", geo.Country)
+			w.Header().Set("X-Client-IP", geo.ClientIP)
+		}
+		next(w, r.WithContext(ContextWithGeo(r.Context(), geo)))
+	}
+}
+
+// decideRequest locates and decides a request, reusing the decision
+// recorded in its sticky cookie or cached for its client if there is one.
+// A location already in the context is always decided afresh.
+func (b *Blocker) decideRequest(r *http.Request) Decision {
+	principal := b.principalOf(r)
+	if geo, ok := GeoFromContext(r.Context()); ok {
+		if geo.Host == "" {
+			geo.Host = RequestHost(r)
+		}
+		return b.decide(r, geo, principal)
+	}
+	if b.stickyTTL > 0 {
+		if decision, ok := b.stickyDecision(r); ok {
+			return decision
+		}
+	}
+	if b.decisions == nil {
+		return b.decide(r, b.Resolve(r), principal)
+	}
+
+	key := decisionKey{ip: b.clientIP(r), host: RequestHost(r), path: r.URL.Path, principal: principal}
+	current := b.store.current.Load()
+	now := time.Now()
+	decision, ok := b.decisions.get(key, current, now)
+	if !ok {
+		decision = b.evaluate(r.Context(), b.Resolve(r), principal)
+		if b.cacheable(decision) {
+			b.decisions.put(key, decision, current, now)
+		}
+	}
+	return b.challenge(r, decision)
+}
+
+// decide makes the exempt, allow, block, challenge or monitor decision for a located request
+func (b *Blocker) decide(r *http.Request, geo RequestGeo, principal string) Decision {
+	return b.challenge(r, b.evaluate(r.Context(), geo, principal))
+}
+
+// evaluate makes the exempt, allow, block or monitor decision for a located
+// client. Challenge matches are left blocked for challenge to settle, as
+// that depends on the request rather than the client.
+func (b *Blocker) evaluate(ctx context.Context, geo RequestGeo, principal string) Decision {
+	if exemption := b.exemption(geo, principal); exemption != nil {
+		return Decision{Geo: geo, Exemption: exemption}
+	}
+	geo = b.scoreReputation(ctx, geo)
+	match := b.Check(geo)
+	return Decision{Geo: geo, Blocked: match != nil && !match.Monitor, Monitored: match != nil && match.Monitor, Match: match}
+}
+
+// challenge turns a block by a challenge match into a challenge, or lets
+// the request through if it passed one
+func (b *Blocker) challenge(r *http.Request, decision Decision) Decision {
+	if decision.Blocked && decision.Match.Challenges() {
+		decision.Blocked = false
+		decision.Challenged = !b.passedChallenge(r, decision.Geo)
+	}
+	return decision
+}
+
+// reject writes the block response or challenge for a decision, reporting
+// whether it did; allowed requests are left for the next handler
+func (b *Blocker) reject(w http.ResponseWriter, r *http.Request, decision Decision) bool {
+	switch {
+	case decision.Blocked:
+		decision.Match.response.write(w, r, b.pageData(decision.Geo, decision.Match), b.logf)
+	case decision.Challenged:
+		b.writeChallenge(w, decision.Geo)
+	default:
+		return false
+	}
+	return true
+}
+
+// Handler wraps next like HandlerFunc
+func (b *Blocker) Handler(next http.Handler) http.Handler {
+	return b.HandlerFunc(next.ServeHTTP)
+}
+
+// pageData collects the values exposed to block responses
+func (b *Blocker) pageData(geo RequestGeo, match *Match) PageData {
+	data := PageData{
+		CountryCode: geo.Country,
+		ClientIP:    geo.ActualIP,
+		DetectedVia: geo.ClientIP,
+		BlockedAt:   time.Now().Format(time.RFC3339),
+		Reason:      "Geo-blocking policy in effect",
+		RuleID:      match.RuleID(),
+	}
+	if b.countryName != nil {
+		data.CountryName = b.countryName(geo.Country)
+	}
+	return data
+}
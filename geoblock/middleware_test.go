@@ -0,0 +1,389 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlockerHandlerFunc(t *testing.T) {
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{
+		BlockedCountries: []string{"RU"},
+		BlockedNetworks:  []string{"198.51.100.0/24"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countries := map[string]string{
+		"203.0.113.7":   "RU",
+		"198.51.100.20": "US",
+		"192.0.2.1":     "US",
+	}
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) {
+		if country, ok := countries[ip]; ok {
+			return country, nil
+		}
+		return "", errors.New("not found")
+	})
+
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		wantStatus  int
+		wantCountry string
+		wantNetwork string
+	}{
+		{"blocked country", "203.0.113.7:1234", http.StatusForbidden, "RU", ""},
+		{"blocked network before country", "198.51.100.20:1234", http.StatusForbidden, "US", "198.51.100.0/24"},
+		{"allowed", "192.0.2.1:1234", http.StatusOK, "US", ""},
+		{"unresolved", "[2001:db8::1]:1234", http.StatusOK, UnknownCountry, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decision Decision
+			blocker := New(store, resolver, WithDecisionHook(func(r *http.Request, d Decision) { decision = d }))
+
+			var got RequestGeo
+			handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = GeoFromContext(r.Context())
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			recorder := httptest.NewRecorder()
+			handler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if decision.Geo.Country != tt.wantCountry {
+				t.Errorf("decision country = %q, want %q", decision.Geo.Country, tt.wantCountry)
+			}
+			if decision.Blocked != (tt.wantStatus == http.StatusForbidden) {
+				t.Errorf("decision blocked = %v, want %v", decision.Blocked, !decision.Blocked)
+			}
+			if tt.wantNetwork != "" && (decision.Match == nil || decision.Match.Network != tt.wantNetwork) {
+				t.Errorf("decision match = %+v, want network %s", decision.Match, tt.wantNetwork)
+			}
+			if tt.wantStatus == http.StatusOK && got.Country != tt.wantCountry {
+				t.Errorf("context country = %q, want %q", got.Country, tt.wantCountry)
+			}
+		})
+	}
+}
+
+func TestBlockerUsesContextGeo(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{BlockedCountries: []string{"KP"}}); err != nil {
+		t.Fatal(err)
+	}
+	blocker := New(store, ResolverFunc(func(ctx context.Context, ip string) (string, error) {
+		t.Errorf("resolver called for %s, want context location", ip)
+		return "", nil
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(ContextWithGeo(req.Context(), RequestGeo{ClientIP: "192.0.2.1", ActualIP: "192.0.2.1", Country: "KP"}))
+	recorder := httptest.NewRecorder()
+	blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(recorder, req)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+}
+
+func TestBlockerMonitorMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        Policy
+		wantStatus    int
+		wantMonitored bool
+		wantRule      string
+	}{
+		{"global monitor", Policy{BlockedCountries: []string{"RU"}, Monitor: true}, http.StatusOK, true, ""},
+		{"monitored rule", Policy{Rules: []Rule{{ID: "trial", Countries: []string{"RU"}, Monitor: true}}}, http.StatusOK, true, "trial"},
+		{"enforced country wins over monitored rule", Policy{
+			BlockedCountries: []string{"RU"},
+			Rules:            []Rule{{ID: "trial", Countries: []string{"RU"}, Monitor: true}},
+		}, http.StatusForbidden, false, ""},
+		{"enforced country wins over monitored network", Policy{
+			BlockedCountries: []string{"RU"},
+			Rules:            []Rule{{ID: "trial", Networks: []string{"203.0.113.0/24"}, Monitor: true}},
+		}, http.StatusForbidden, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			if _, err := store.ReplacePolicy(&tt.policy); err != nil {
+				t.Fatal(err)
+			}
+
+			var decision Decision
+			blocker := New(store, ResolverFunc(func(context.Context, string) (string, error) { return "RU", nil }),
+				WithDecisionHook(func(r *http.Request, d Decision) { decision = d }))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "203.0.113.7:1234"
+			recorder := httptest.NewRecorder()
+			blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if decision.Monitored != tt.wantMonitored || decision.Blocked == tt.wantMonitored {
+				t.Errorf("decision blocked=%v monitored=%v, want monitored=%v", decision.Blocked, decision.Monitored, tt.wantMonitored)
+			}
+			if decision.Match == nil || decision.Match.RuleID() != tt.wantRule {
+				t.Errorf("decision match = %+v, want rule %q", decision.Match, tt.wantRule)
+			}
+			if store.IsBlocked("RU") == tt.wantMonitored {
+				t.Errorf("IsBlocked(RU) = %v, want %v", !tt.wantMonitored, tt.wantMonitored)
+			}
+		})
+	}
+}
+
+func TestBlockerExemptions(t *testing.T) {
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{
+		BlockedCountries: []string{"RU"},
+		BlockedNetworks:  []string{"203.0.113.0/24"},
+		Exemptions: []Exemption{
+			{ID: "office", Networks: []string{"203.0.113.8/29"}},
+			{ID: "partner", Principals: []string{"partner-api"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		principal     string
+		wantStatus    int
+		wantExemption string
+	}{
+		{"exempt network inside blocked network", "203.0.113.9:1234", "", http.StatusOK, "office"},
+		{"blocked network outside exemption", "203.0.113.20:1234", "", http.StatusForbidden, ""},
+		{"exempt principal in blocked country", "192.0.2.1:1234", "partner-api", http.StatusOK, "partner"},
+		{"other principal in blocked country", "192.0.2.1:1234", "dashboard", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decision Decision
+			blocker := New(store, ResolverFunc(func(context.Context, string) (string, error) { return "RU", nil }),
+				WithPrincipal(func(*http.Request) string { return tt.principal }),
+				WithDecisionHook(func(r *http.Request, d Decision) { decision = d }))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			recorder := httptest.NewRecorder()
+			blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			gotExemption := ""
+			if decision.Exemption != nil {
+				gotExemption = decision.Exemption.ID
+			}
+			if gotExemption != tt.wantExemption {
+				t.Errorf("exemption = %q, want %q", gotExemption, tt.wantExemption)
+			}
+		})
+	}
+}
+
+func TestBlockerFailureMode(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{BlockedCountries: []string{"RU"}}); err != nil {
+		t.Fatal(err)
+	}
+	down := ResolverFunc(func(context.Context, string) (string, error) { return "", ErrCircuitOpen })
+
+	tests := []struct {
+		name       string
+		options    []Option
+		wantStatus int
+	}{
+		{"fails open by default", nil, http.StatusOK},
+		{"fails closed", []Option{WithFailClosed()}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decision Decision
+			options := append([]Option{WithDecisionHook(func(r *http.Request, d Decision) { decision = d })}, tt.options...)
+			blocker := New(store, down, options...)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "203.0.113.7:1234"
+			recorder := httptest.NewRecorder()
+			blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if !decision.Geo.LookupFailed || decision.Geo.Country != UnknownCountry {
+				t.Errorf("decision geo = %+v, want a failed lookup", decision.Geo)
+			}
+		})
+	}
+}
+
+func TestBlockerUnknownCountry(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         Policy
+		options        []Option
+		wantStatus     int
+		wantChallenged bool
+		wantRule       string
+	}{
+		{"policy allows", Policy{UnknownCountry: FallbackAllow}, []Option{WithFailClosed()}, http.StatusOK, false, ""},
+		{"policy blocks", Policy{UnknownCountry: FallbackBlock}, nil, http.StatusForbidden, false, ""},
+		{"policy challenges", Policy{UnknownCountry: FallbackChallenge}, nil, http.StatusForbidden, true, ""},
+		{"rule wins over policy", Policy{
+			UnknownCountry: FallbackAllow,
+			Rules:          []Rule{{ID: "sanctions", Countries: []string{"KP"}, UnknownCountry: FallbackBlock}},
+		}, nil, http.StatusForbidden, false, "sanctions"},
+		{"rule allows despite failing closed", Policy{
+			Rules: []Rule{{ID: "open", Countries: []string{"KP"}, UnknownCountry: FallbackAllow}},
+		}, []Option{WithFailClosed()}, http.StatusOK, false, ""},
+		{"monitored policy only reports", Policy{UnknownCountry: FallbackBlock, Monitor: true}, nil, http.StatusOK, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			if _, err := store.ReplacePolicy(&tt.policy); err != nil {
+				t.Fatal(err)
+			}
+			var decision Decision
+			options := append([]Option{WithDecisionHook(func(r *http.Request, d Decision) { decision = d })}, tt.options...)
+			blocker := New(store, nil, options...)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "203.0.113.7:1234"
+			recorder := httptest.NewRecorder()
+			blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if decision.Challenged != tt.wantChallenged {
+				t.Errorf("challenged = %v, want %v", decision.Challenged, tt.wantChallenged)
+			}
+			if decision.Match != nil && decision.Match.RuleID() != tt.wantRule {
+				t.Errorf("rule = %q, want %q", decision.Match.RuleID(), tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestBlockerChallengeCookie(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{UnknownCountry: FallbackChallenge}); err != nil {
+		t.Fatal(err)
+	}
+	blocker := New(store, nil, WithChallengeSecret([]byte("secret")))
+	handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		wantStatus int
+	}{
+		{"no cookie", "203.0.113.7:1234", "", http.StatusForbidden},
+		{"valid cookie", "203.0.113.7:1234", challengeToken([]byte("secret"), "203.0.113.7", time.Now().Add(time.Minute)), http.StatusOK},
+		{"cookie for another client", "203.0.113.8:1234", challengeToken([]byte("secret"), "203.0.113.7", time.Now().Add(time.Minute)), http.StatusForbidden},
+		{"expired cookie", "203.0.113.7:1234", challengeToken([]byte("secret"), "203.0.113.7", time.Now().Add(-time.Minute)), http.StatusForbidden},
+		{"other secret", "203.0.113.7:1234", challengeToken([]byte("other"), "203.0.113.7", time.Now().Add(time.Minute)), http.StatusForbidden},
+		{"malformed cookie", "203.0.113.7:1234", "garbage", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.token != "" {
+				req.AddCookie(&http.Cookie{Name: challengeCookie, Value: tt.token})
+			}
+			recorder := httptest.NewRecorder()
+			handler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBlockerSkipPaths(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{BlockedCountries: []string{"KP"}}); err != nil {
+		t.Fatal(err)
+	}
+	decided := 0
+	blocker := New(store, ResolverFunc(func(ctx context.Context, ip string) (string, error) { return "KP", nil }),
+		WithSkipPaths("/healthz", "/webhooks/", "/static*"),
+		WithDecisionHook(func(*http.Request, Decision) { decided++ }))
+	handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/healthz/deep", http.StatusForbidden},
+		{"/webhooks/shopify", http.StatusOK},
+		{"/webhooks", http.StatusForbidden},
+		{"/static-assets/app.js", http.StatusOK},
+		{"/api/v1/test-access", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest("GET", tt.path, nil))
+		if recorder.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.path, recorder.Code, tt.want)
+		}
+	}
+	if decided != 3 {
+		t.Errorf("%d decisions made, want only the 3 checked paths", decided)
+	}
+
+	explanation := blocker.Explain(httptest.NewRequest("GET", "/healthz", nil), RequestGeo{Country: "KP"}, "")
+	if !explanation.Decision.Skipped || explanation.Response.StatusCode != http.StatusOK {
+		t.Errorf("explanation = %+v, want the path skipped", explanation)
+	}
+}
+
+func TestBlockerBrokenBlockPageWithoutLogger(t *testing.T) {
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{
+		BlockedCountries: []string{"RU"},
+		BlockResponse:    &ResponseTemplate{HTML: "<p>{{.Nope}}</p>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) { return "RU", nil })
+	handler := New(store, resolver).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	// Rendering fails at execution; without WithLogf this must not panic
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+}
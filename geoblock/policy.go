@@ -0,0 +1,164 @@
+package geoblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Policy is the blocking configuration: plain country and network
+// blocklists, rules with their own responses and schedules, and per-country
+// rate limits
+type Policy struct {
+	BlockedCountries []string          `json:"blocked_countries"`
+	BlockedNetworks  []string          `json:"blocked_networks,omitempty"`
+	BlockResponse    *ResponseTemplate `json:"block_response,omitempty"`
+	Rules            []Rule            `json:"rules,omitempty"`
+	RateLimits       []RateLimit       `json:"rate_limits,omitempty"`
+	Exemptions       []Exemption       `json:"exemptions,omitempty"`
+
+	// CountryGroups are the policy's own country groups, in addition to
+	// BuiltinCountryGroups
+	CountryGroups []CountryGroup `json:"country_groups,omitempty"`
+
+	// Monitor puts the whole policy in dry-run mode: matching requests are
+	// reported as monitored but still allowed
+	Monitor bool `json:"monitor,omitempty"`
+
+	// UnknownCountry is what happens to requests whose country could not be
+	// determined, unless a rule decides. Empty leaves it to the Blocker,
+	// which allows them unless it fails closed.
+	UnknownCountry Fallback `json:"unknown_country,omitempty"`
+}
+
+// Fallback is how a request whose country is UnknownCountry is handled
+type Fallback string
+
+const (
+	FallbackAllow     Fallback = "allow"
+	FallbackBlock     Fallback = "block"
+	FallbackChallenge Fallback = "challenge"
+)
+
+// Valid reports whether f is a known fallback or empty
+func (f Fallback) Valid() bool {
+	switch f {
+	case "", FallbackAllow, FallbackBlock, FallbackChallenge:
+		return true
+	}
+	return false
+}
+
+// Clone returns a deep copy of the policy
+func (p *Policy) Clone() *Policy {
+	data, err := json.Marshal(p)
+	if err != nil {
+		panic(fmt.Sprintf("failed to copy blocking policy: %v", err))
+	}
+	var copied Policy
+	if err := json.Unmarshal(data, &copied); err != nil {
+		panic(fmt.Sprintf("failed to copy blocking policy: %v", err))
+	}
+	return &copied
+}
+
+// Rule blocks a set of countries and IP networks with its own response settings
+type Rule struct {
+	ID        string            `json:"id"`
+	Countries []string          `json:"countries"`
+	Networks  []string          `json:"networks,omitempty"`
+	Response  *ResponseTemplate `json:"response,omitempty"`
+
+	// Groups are country group IDs whose current members the rule also
+	// matches, so changing a group changes every rule using it
+	Groups []string `json:"groups,omitempty"`
+
+	// ExceptCountries are left out of the rule's countries and groups, as in
+	// "all of Africa except ZA"
+	ExceptCountries []string `json:"except_countries,omitempty"`
+
+	// Monitor reports requests the rule would block without blocking them
+	Monitor bool `json:"monitor,omitempty"`
+
+	// Challenge answers matching requests with a challenge instead of the
+	// block response, for borderline countries; clients that pass it are let through
+	Challenge bool `json:"challenge,omitempty"`
+
+	// Hosts, if set, limit the rule to requests for these storefront domains,
+	// so each domain of a shop can have its own blocklist and block page.
+	// "*.myshop.de" matches every subdomain of myshop.de but not myshop.de.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// ReputationAbove, if set, limits the rule to clients whose reputation
+	// score (0-100, higher is more abusive) is above it. Clients without a
+	// score, e.g. when no reputation provider is configured, do not match.
+	ReputationAbove int `json:"reputation_above,omitempty"`
+
+	// UnknownCountry, if set, handles requests whose country could not be
+	// determined with this rule's response and schedule. The first active
+	// rule setting it wins over the policy's setting.
+	UnknownCountry Fallback `json:"unknown_country,omitempty"`
+
+	// EffectiveFrom and EffectiveUntil bound when the rule applies; lapsed
+	// rules are removed by the rule expirer. DailyWindow further limits it
+	// to a time of day.
+	EffectiveFrom  *time.Time   `json:"effective_from,omitempty"`
+	EffectiveUntil *time.Time   `json:"effective_until,omitempty"`
+	DailyWindow    *DailyWindow `json:"daily_window,omitempty"`
+
+	// Preset and PresetVersion are set when the rule was created from a preset list
+	Preset        string `json:"preset,omitempty"`
+	PresetVersion string `json:"preset_version,omitempty"`
+}
+
+// ExpiredAt reports whether the rule's effective period has ended
+func (r *Rule) ExpiredAt(t time.Time) bool {
+	return r.EffectiveUntil != nil && !t.Before(*r.EffectiveUntil)
+}
+
+// Exemption lets clients through regardless of country and network rules,
+// e.g. the merchant's own office in a blocked country. Principals are the
+// names of authenticated API callers, never the keys themselves.
+type Exemption struct {
+	ID         string   `json:"id"`
+	Networks   []string `json:"networks,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+	Note       string   `json:"note,omitempty"`
+}
+
+// DailyWindow limits a rule to a time-of-day range such as 00:00-06:00 UTC.
+// Windows whose end is before their start wrap past midnight.
+type DailyWindow struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// RateLimit caps request rates for clients from the listed countries.
+// "*" matches every country without a more specific limit. Scope "ip"
+// (the default) gives each client IP its own bucket; "country" shares one
+// bucket across all clients from the same country.
+type RateLimit struct {
+	Countries         []string `json:"countries"`
+	RequestsPerMinute int      `json:"requests_per_minute"`
+	Burst             int      `json:"burst,omitempty"`
+	Scope             string   `json:"scope,omitempty"`
+}
+
+// Validate checks a rate limit and fills in defaults
+func (l *RateLimit) Validate() error {
+	if l.RequestsPerMinute <= 0 {
+		return fmt.Errorf("requests_per_minute must be positive")
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.RequestsPerMinute
+	}
+	switch l.Scope {
+	case "":
+		l.Scope = "ip"
+	case "ip", "country":
+	default:
+		return fmt.Errorf("unknown rate limit scope %q", l.Scope)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package geoblock
+
+import "testing"
+
+func TestRateLimitValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     RateLimit
+		wantErr   bool
+		wantBurst int
+		wantScope string
+	}{
+		{"defaults", RateLimit{RequestsPerMinute: 30}, false, 30, "ip"},
+		{"explicit burst and scope", RateLimit{RequestsPerMinute: 30, Burst: 5, Scope: "country"}, false, 5, "country"},
+		{"zero rate", RateLimit{RequestsPerMinute: 0}, true, 0, ""},
+		{"negative rate", RateLimit{RequestsPerMinute: -1}, true, 0, ""},
+		{"unknown scope", RateLimit{RequestsPerMinute: 30, Scope: "session"}, true, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := tt.limit
+			err := limit.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (limit.Burst != tt.wantBurst || limit.Scope != tt.wantScope) {
+				t.Errorf("Validate() set burst %d scope %q, want %d %q", limit.Burst, limit.Scope, tt.wantBurst, tt.wantScope)
+			}
+		})
+	}
+}
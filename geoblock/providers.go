@@ -0,0 +1,413 @@
+package geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ipinfoDefaultBackoff is how long to stop calling ipinfo.io after a quota
+// response that carries no Retry-After header
+const ipinfoDefaultBackoff = time.Minute
+
+// IPInfo looks up countries via ipinfo.io. Without a token the free tier is
+// limited per source IP and quickly returns 429 in production; after a 429
+// no calls are made until the quota resets.
+type IPInfo struct {
+	client *http.Client
+	token  string
+
+	mu               sync.Mutex
+	rateLimitedUntil time.Time
+	lastStatusCode   int
+	lastError        string
+	lastSuccessAt    time.Time
+	requestCount     int64
+	failureCount     int64
+	quotaHits        int64
+
+	// Logf, if set, is told when the quota is exceeded or the token rejected
+	Logf Logf
+
+	// Retry retries calls that fail transiently
+	Retry RetryPolicy
+}
+
+// NewIPInfo creates an ipinfo.io provider; token may be empty
+func NewIPInfo(token string, timeout time.Duration) *IPInfo {
+	return &IPInfo{client: &http.Client{Timeout: timeout}, token: token}
+}
+
+func (p *IPInfo) Name() string { return "ipinfo" }
+
+// SetHTTPClient replaces the client used for lookups, e.g. with one sharing
+// a pooled transport; the client's Timeout bounds each call
+func (p *IPInfo) SetHTTPClient(client *http.Client) { p.client = client }
+
+// Get calls an ipinfo.io path with the configured token, tracking quota
+// responses and refusing to call out while the quota is exhausted
+func (p *IPInfo) Get(ctx context.Context, path string) (*http.Response, error) {
+	p.mu.Lock()
+	if until := p.rateLimitedUntil; time.Now().Before(until) {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("ipinfo.io quota exhausted until %s", until.Format(time.RFC3339))
+	}
+	p.requestCount++
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://ipinfo.io"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.Retry.Do(ctx, func() (*http.Response, error) { return p.client.Do(req) })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.failureCount++
+		p.lastError = err.Error()
+		return nil, err
+	}
+
+	p.lastStatusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		p.failureCount++
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		backoff := retryAfter(resp, ipinfoDefaultBackoff)
+		p.rateLimitedUntil = time.Now().Add(backoff)
+		p.quotaHits++
+		p.lastError = "quota exceeded (HTTP 429)"
+		p.Logf.printf("⚠️  ipinfo.io quota exceeded, pausing lookups for %s", backoff)
+	case resp.StatusCode == http.StatusForbidden && p.token != "":
+		p.lastError = "token rejected (HTTP 403)"
+		p.Logf.printf("⚠️  ipinfo.io rejected the configured token")
+	case resp.StatusCode == http.StatusOK:
+		p.lastSuccessAt = time.Now()
+		p.lastError = ""
+	default:
+		p.lastError = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func (p *IPInfo) Lookup(ctx context.Context, ip string) (string, error) {
+	resp, err := p.Get(ctx, fmt.Sprintf("/%s/json", ip))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ipinfo.io returned status %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Country string `json:"country"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("failed to parse ipinfo.io response: %w", err)
+	}
+	if info.Country == "" {
+		return "", fmt.Errorf("ipinfo.io has no country for %s", ip)
+	}
+	return info.Country, nil
+}
+
+// Status returns a snapshot of the ipinfo.io quota and request state
+func (p *IPInfo) Status() ProviderStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := ProviderStatus{
+		Provider:       p.Name(),
+		Authenticated:  p.token != "",
+		RateLimited:    time.Now().Before(p.rateLimitedUntil),
+		LastStatusCode: p.lastStatusCode,
+		LastError:      p.lastError,
+		RequestCount:   p.requestCount,
+		FailureCount:   p.failureCount,
+		QuotaHits:      p.quotaHits,
+	}
+	if status.RateLimited {
+		status.RateLimitedUntil = p.rateLimitedUntil.Format(time.RFC3339)
+	}
+	if !p.lastSuccessAt.IsZero() {
+		status.LastSuccessAt = p.lastSuccessAt.Format(time.RFC3339)
+	}
+	return status
+}
+
+// retryAfter parses a Retry-After header in seconds, falling back to a default
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// IPAPI looks up countries via ip-api.com, using the pro endpoint when a key is set
+type IPAPI struct {
+	client *http.Client
+	key    string
+	stats  providerStats
+
+	// Retry retries calls that fail transiently
+	Retry RetryPolicy
+}
+
+// NewIPAPI creates an ip-api.com provider; key may be empty for the free tier
+func NewIPAPI(key string, timeout time.Duration) *IPAPI {
+	return &IPAPI{client: &http.Client{Timeout: timeout}, key: key}
+}
+
+func (p *IPAPI) Name() string { return "ip-api" }
+
+// SetHTTPClient replaces the client used for lookups
+func (p *IPAPI) SetHTTPClient(client *http.Client) { p.client = client }
+
+func (p *IPAPI) Lookup(ctx context.Context, ip string) (string, error) {
+	country, err := p.lookup(ctx, ip)
+	p.stats.record(err)
+	return country, err
+}
+
+func (p *IPAPI) lookup(ctx context.Context, ip string) (string, error) {
+	// The free tier is HTTP only; HTTPS requires a pro key
+	endpoint := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,countryCode", ip)
+	if p.key != "" {
+		endpoint = fmt.Sprintf("https://pro.ip-api.com/json/%s?fields=status,message,countryCode&key=%s", ip, url.QueryEscape(p.key))
+	}
+
+	resp, err := providerGet(ctx, p.client, p.Retry, endpoint)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ip-api.com returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Status      string `json:"status"`
+		Message     string `json:"message"`
+		CountryCode string `json:"countryCode"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse ip-api.com response: %w", err)
+	}
+	if result.Status != "success" || result.CountryCode == "" {
+		return "", fmt.Errorf("ip-api.com lookup failed: %s", result.Message)
+	}
+	return result.CountryCode, nil
+}
+
+func (p *IPAPI) Status() ProviderStatus {
+	status := p.stats.status(p.Name())
+	status.Authenticated = p.key != ""
+	return status
+}
+
+// IPStack looks up countries via ipstack.com
+type IPStack struct {
+	client    *http.Client
+	accessKey string
+	scheme    string
+	stats     providerStats
+
+	// Retry retries calls that fail transiently
+	Retry RetryPolicy
+}
+
+// NewIPStack creates an ipstack.com provider. scheme is "https", or "http"
+// for plans without TLS support, which sends the access key unencrypted.
+func NewIPStack(accessKey, scheme string, timeout time.Duration) *IPStack {
+	return &IPStack{client: &http.Client{Timeout: timeout}, accessKey: accessKey, scheme: scheme}
+}
+
+func (p *IPStack) Name() string { return "ipstack" }
+
+// SetHTTPClient replaces the client used for lookups
+func (p *IPStack) SetHTTPClient(client *http.Client) { p.client = client }
+
+func (p *IPStack) Lookup(ctx context.Context, ip string) (string, error) {
+	country, err := p.lookup(ctx, ip)
+	p.stats.record(err)
+	return country, err
+}
+
+func (p *IPStack) lookup(ctx context.Context, ip string) (string, error) {
+	endpoint := fmt.Sprintf("%s://api.ipstack.com/%s?access_key=%s&fields=country_code", p.scheme, ip, url.QueryEscape(p.accessKey))
+
+	resp, err := providerGet(ctx, p.client, p.Retry, endpoint)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ipstack returned status %d", resp.StatusCode)
+	}
+
+	// ipstack reports errors with a 200 status and an error object
+	var result struct {
+		CountryCode string `json:"country_code"`
+		Error       *struct {
+			Code int    `json:"code"`
+			Info string `json:"info"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse ipstack response: %w", err)
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("ipstack error %d: %s", result.Error.Code, result.Error.Info)
+	}
+	if result.CountryCode == "" {
+		return "", fmt.Errorf("ipstack has no country for %s", ip)
+	}
+	return result.CountryCode, nil
+}
+
+func (p *IPStack) Status() ProviderStatus {
+	status := p.stats.status(p.Name())
+	status.Authenticated = true
+	return status
+}
+
+// MaxMind looks up countries in a local GeoLite2/GeoIP2 Country database.
+// The database can be replaced while lookups run with Reload.
+type MaxMind struct {
+	reader   atomic.Pointer[maxminddb.Reader]
+	path     string
+	loadedAt atomic.Int64
+	stats    providerStats
+}
+
+// OpenMaxMind opens a GeoLite2/GeoIP2 Country database
+func OpenMaxMind(path string) (*MaxMind, error) {
+	reader, err := openMaxMindReader(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &MaxMind{path: path}
+	p.swap(reader)
+	return p, nil
+}
+
+// openMaxMindReader opens a database and checks it is a valid country database
+func openMaxMindReader(path string) (*maxminddb.Reader, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MaxMind database %s: %w", path, err)
+	}
+	if !strings.Contains(reader.Metadata.DatabaseType, "Country") {
+		reader.Close()
+		return nil, fmt.Errorf("MaxMind database %s is a %s database, not a country database", path, reader.Metadata.DatabaseType)
+	}
+	return reader, nil
+}
+
+// ValidateMaxMind checks that path holds an intact country database, e.g.
+// before it replaces the one in use
+func ValidateMaxMind(path string) (*maxminddb.Metadata, error) {
+	reader, err := openMaxMindReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if err := reader.Verify(); err != nil {
+		return nil, fmt.Errorf("MaxMind database %s is corrupt: %w", path, err)
+	}
+	metadata := reader.Metadata
+	return &metadata, nil
+}
+
+// Reload reopens the database file, e.g. after a new edition was moved into
+// place. Lookups in flight finish on the previous database, which is
+// released once nothing uses it; on error the previous database stays.
+func (p *MaxMind) Reload() error {
+	reader, err := openMaxMindReader(p.path)
+	if err != nil {
+		return err
+	}
+	p.swap(reader)
+	return nil
+}
+
+// swap makes reader the database for new lookups. The old reader is not
+// closed, as network iterations may still use it; its finalizer unmaps it.
+func (p *MaxMind) swap(reader *maxminddb.Reader) {
+	p.reader.Store(reader)
+	p.loadedAt.Store(time.Now().UnixNano())
+}
+
+// LoadedAt returns when the database in use was opened
+func (p *MaxMind) LoadedAt() time.Time { return time.Unix(0, p.loadedAt.Load()) }
+
+// Metadata describes the database in use, including its build time
+func (p *MaxMind) Metadata() maxminddb.Metadata { return p.reader.Load().Metadata }
+
+func (p *MaxMind) Name() string { return "maxmind" }
+
+// Path returns the database file the provider was opened from
+func (p *MaxMind) Path() string { return p.path }
+
+// Reader returns the underlying database, e.g. to iterate its networks
+func (p *MaxMind) Reader() *maxminddb.Reader { return p.reader.Load() }
+
+func (p *MaxMind) Lookup(ctx context.Context, ip string) (string, error) {
+	country, err := p.lookup(ctx, ip)
+	p.stats.record(err)
+	return country, err
+}
+
+func (p *MaxMind) lookup(ctx context.Context, ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		RegisteredCountry struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+	}
+	if err := p.reader.Load().Lookup(parsed, &record); err != nil {
+		return "", fmt.Errorf("MaxMind lookup failed: %w", err)
+	}
+
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	if record.RegisteredCountry.ISOCode != "" {
+		return record.RegisteredCountry.ISOCode, nil
+	}
+	return "", fmt.Errorf("MaxMind database has no country for %s", ip)
+}
+
+func (p *MaxMind) Status() ProviderStatus {
+	return p.stats.status(p.Name())
+}
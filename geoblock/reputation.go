@@ -0,0 +1,175 @@
+package geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ReputationProvider scores how abusive an IP address is, from 0 (clean)
+// to 100 (certainly abusive)
+type ReputationProvider interface {
+	Name() string
+	Score(ctx context.Context, ip string) (int, error)
+	Status() ProviderStatus
+}
+
+type simulatedContextKey struct{}
+
+// ContextSimulated marks a request as simulated, such as a validation run
+// from a made-up address. Its client is never scored for reputation, so no
+// provider quota is spent on addresses nobody uses; set a score in its
+// RequestGeo to evaluate reputation rules.
+func ContextSimulated(ctx context.Context) context.Context {
+	return context.WithValue(ctx, simulatedContextKey{}, true)
+}
+
+// simulated reports whether ctx belongs to a simulated request
+func simulated(ctx context.Context) bool {
+	marked, _ := ctx.Value(simulatedContextKey{}).(bool)
+	return marked
+}
+
+// scoreReputation adds the client's reputation to a location when a rule
+// depends on it. The looked-up address is scored, since the client IP may
+// be private in development.
+func (b *Blocker) scoreReputation(ctx context.Context, geo RequestGeo) RequestGeo {
+	if b.reputation == nil || geo.ReputationKnown || geo.ActualIP == "" || !b.store.UsesReputation() || simulated(ctx) {
+		return geo
+	}
+	score, err := b.reputation.Score(ctx, geo.ActualIP)
+	if err != nil {
+		b.logf.printf("⚠️  Could not score reputation of %s with %s: %v", geo.ActualIP, b.reputation.Name(), err)
+		return geo
+	}
+	geo.Reputation, geo.ReputationKnown = score, true
+	return geo
+}
+
+// AbuseIPDB scores addresses with the AbuseIPDB abuse confidence score
+type AbuseIPDB struct {
+	client   *http.Client
+	key      string
+	maxAge   int
+	endpoint string
+	stats    providerStats
+}
+
+// NewAbuseIPDB creates an AbuseIPDB provider considering reports from the
+// last maxAgeDays days
+func NewAbuseIPDB(key string, maxAgeDays int, timeout time.Duration) *AbuseIPDB {
+	return &AbuseIPDB{
+		client:   &http.Client{Timeout: timeout},
+		key:      key,
+		maxAge:   maxAgeDays,
+		endpoint: "https://api.abuseipdb.com/api/v2/check",
+	}
+}
+
+func (p *AbuseIPDB) Name() string { return "abuseipdb" }
+
+// SetHTTPClient replaces the client used for score lookups
+func (p *AbuseIPDB) SetHTTPClient(client *http.Client) { p.client = client }
+
+func (p *AbuseIPDB) Score(ctx context.Context, ip string) (int, error) {
+	score, err := p.score(ctx, ip)
+	p.stats.record(err)
+	return score, err
+}
+
+func (p *AbuseIPDB) score(ctx context.Context, ip string) (int, error) {
+	query := url.Values{"ipAddress": {ip}, "maxAgeInDays": {fmt.Sprint(p.maxAge)}}
+	req, err := http.NewRequestWithContext(ctx, "GET", p.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	// The key goes in a header, so it never appears in URLs or their errors
+	req.Header.Set("Key", p.key)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("abuseipdb request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("abuseipdb returned status %d", resp.StatusCode)
+	}
+	var result struct {
+		Data struct {
+			AbuseConfidenceScore int `json:"abuseConfidenceScore"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to parse abuseipdb response: %w", err)
+	}
+	return result.Data.AbuseConfidenceScore, nil
+}
+
+func (p *AbuseIPDB) Status() ProviderStatus {
+	status := p.stats.status(p.Name())
+	status.Authenticated = p.key != ""
+	return status
+}
+
+// reputationEntry is a cached score and when it expires
+type reputationEntry struct {
+	score   int
+	expires time.Time
+}
+
+// ReputationCache remembers scores of another provider for a TTL, keeping at
+// most maxEntries addresses. Failed lookups are not cached.
+type ReputationCache struct {
+	provider   ReputationProvider
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]reputationEntry
+}
+
+// NewReputationCache caches the scores of provider
+func NewReputationCache(provider ReputationProvider, ttl time.Duration, maxEntries int) *ReputationCache {
+	return &ReputationCache{provider: provider, ttl: ttl, maxEntries: maxEntries, entries: make(map[string]reputationEntry)}
+}
+
+func (c *ReputationCache) Name() string { return c.provider.Name() }
+
+func (c *ReputationCache) Score(ctx context.Context, ip string) (int, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[ip]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.score, nil
+	}
+
+	score, err := c.provider.Score(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		// Drop expired entries first, then everything if still full
+		for key, cached := range c.entries {
+			if !now.Before(cached.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = make(map[string]reputationEntry)
+		}
+	}
+	c.entries[ip] = reputationEntry{score: score, expires: now.Add(c.ttl)}
+	return score, nil
+}
+
+func (c *ReputationCache) Status() ProviderStatus { return c.provider.Status() }
@@ -0,0 +1,151 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeReputation scores addresses from a map, failing for unknown ones
+type fakeReputation struct {
+	scores map[string]int
+	calls  int
+}
+
+func (f *fakeReputation) Name() string { return "fake" }
+
+func (f *fakeReputation) Score(ctx context.Context, ip string) (int, error) {
+	f.calls++
+	score, ok := f.scores[ip]
+	if !ok {
+		return 0, errors.New("no score")
+	}
+	return score, nil
+}
+
+func (f *fakeReputation) Status() ProviderStatus { return ProviderStatus{Provider: f.Name()} }
+
+func TestAbuseIPDBScore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("ipAddress") != "203.0.113.7" || r.URL.Query().Get("maxAgeInDays") != "30" {
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"data": {"ipAddress": "203.0.113.7", "abuseConfidenceScore": 87}}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		key       string
+		wantScore int
+		wantErr   bool
+	}{
+		{"scored", "secret", 87, false},
+		{"rejected key", "wrong", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewAbuseIPDB(tt.key, 30, time.Second)
+			provider.endpoint = server.URL
+			score, err := provider.Score(context.Background(), "203.0.113.7")
+			if (err != nil) != tt.wantErr || score != tt.wantScore {
+				t.Errorf("Score = %d, %v, want %d (error %v)", score, err, tt.wantScore, tt.wantErr)
+			}
+			if status := provider.Status(); status.RequestCount != 1 {
+				t.Errorf("request count = %d, want 1", status.RequestCount)
+			}
+		})
+	}
+}
+
+func TestReputationCache(t *testing.T) {
+	fake := &fakeReputation{scores: map[string]int{"203.0.113.7": 60}}
+	cache := NewReputationCache(fake, time.Hour, 10)
+
+	for i := 0; i < 3; i++ {
+		if score, err := cache.Score(context.Background(), "203.0.113.7"); err != nil || score != 60 {
+			t.Fatalf("Score = %d, %v, want 60", score, err)
+		}
+	}
+	if fake.calls != 1 {
+		t.Errorf("provider calls = %d, want 1", fake.calls)
+	}
+
+	// Failures are retried rather than cached
+	cache.Score(context.Background(), "192.0.2.1")
+	cache.Score(context.Background(), "192.0.2.1")
+	if fake.calls != 3 {
+		t.Errorf("provider calls = %d, want 3", fake.calls)
+	}
+}
+
+func TestBlockerReputationRules(t *testing.T) {
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{Rules: []Rule{{ID: "abusive-br", Countries: []string{"BR"}, ReputationAbove: 50}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.IsBlocked("BR") {
+		t.Error("IsBlocked(BR) = true, want false for a reputation rule")
+	}
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) { return "BR", nil })
+	reputation := &fakeReputation{scores: map[string]int{"203.0.113.7": 90, "203.0.113.8": 50}}
+
+	tests := []struct {
+		name       string
+		ip         string
+		options    []Option
+		wantStatus int
+	}{
+		{"abusive client blocked", "203.0.113.7", []Option{WithReputation(reputation)}, http.StatusForbidden},
+		{"score at threshold allowed", "203.0.113.8", []Option{WithReputation(reputation)}, http.StatusOK},
+		{"unscored client allowed", "203.0.113.9", []Option{WithReputation(reputation)}, http.StatusOK},
+		{"no provider allowed", "203.0.113.7", nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocker := New(store, resolver, tt.options...)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.ip + ":1234"
+			recorder := httptest.NewRecorder()
+			blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSimulatedRequestsNotScored(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{Rules: []Rule{{ID: "abusive-br", Countries: []string{"BR"}, ReputationAbove: 50}}}); err != nil {
+		t.Fatal(err)
+	}
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) { return "BR", nil })
+	reputation := &fakeReputation{scores: map[string]int{"203.0.113.7": 90}}
+	blocker := New(store, resolver, WithReputation(reputation))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	geo := RequestGeo{ClientIP: "203.0.113.7", ActualIP: "203.0.113.7", Country: "BR"}
+	req = req.WithContext(ContextSimulated(ContextWithGeo(req.Context(), geo)))
+	recorder := httptest.NewRecorder()
+	blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})(recorder, req)
+
+	if reputation.calls != 0 {
+		t.Errorf("simulated request scored %d times, want none", reputation.calls)
+	}
+	if recorder.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 for an unscored client", recorder.Code)
+	}
+}
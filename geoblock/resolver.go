@@ -0,0 +1,384 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver maps a public IP address to an ISO 3166-1 alpha-2 country code.
+// Remote lookups are abandoned when ctx is cancelled.
+type Resolver interface {
+	Lookup(ctx context.Context, ip string) (string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver
+type ResolverFunc func(ctx context.Context, ip string) (string, error)
+
+func (f ResolverFunc) Lookup(ctx context.Context, ip string) (string, error) { return f(ctx, ip) }
+
+// Provider is a named Resolver that reports its health, for use in a Chain
+type Provider interface {
+	Resolver
+	Name() string
+	Status() ProviderStatus
+}
+
+// ProviderStatus reports the health and quota state of a geolocation provider
+type ProviderStatus struct {
+	Provider         string `json:"provider"`
+	Priority         int    `json:"priority,omitempty"`
+	Timeout          string `json:"timeout,omitempty"`
+	Authenticated    bool   `json:"authenticated"`
+	RateLimited      bool   `json:"rate_limited"`
+	RateLimitedUntil string `json:"rate_limited_until,omitempty"`
+	LastStatusCode   int    `json:"last_status_code,omitempty"`
+	LastError        string `json:"last_error,omitempty"`
+	LastSuccessAt    string `json:"last_success_at,omitempty"`
+	RequestCount     int64  `json:"request_count"`
+	FailureCount     int64  `json:"failure_count"`
+	QuotaHits        int64  `json:"quota_hits"`
+	Circuit          string `json:"circuit,omitempty"`
+	CircuitOpenedAt  string `json:"circuit_opened_at,omitempty"`
+	CircuitTrips     int64  `json:"circuit_trips,omitempty"`
+}
+
+// Logf receives diagnostic messages, e.g. log.Printf
+type Logf func(format string, args ...interface{})
+
+func (f Logf) printf(format string, args ...interface{}) {
+	if f != nil {
+		f(format, args...)
+	}
+}
+
+// CanonicalIP extracts an IPv4 or IPv6 address from a header value or
+// RemoteAddr, accepting "ip", "ip:port", "[ipv6]:port" and zoned IPv6
+// addresses. IPv4-mapped IPv6 addresses are returned in IPv4 form, and ""
+// is returned if there is no valid address.
+func CanonicalIP(value string) string {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if zone := strings.IndexByte(value, '%'); zone >= 0 {
+		value = value[:zone]
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip.String()
+}
+
+// providerStats tracks request outcomes for providers without their own bookkeeping
+type providerStats struct {
+	mu            sync.Mutex
+	requests      int64
+	failures      int64
+	lastError     string
+	lastSuccessAt time.Time
+}
+
+func (s *providerStats) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if err != nil {
+		s.failures++
+		s.lastError = err.Error()
+		return
+	}
+	s.lastError = ""
+	s.lastSuccessAt = time.Now()
+}
+
+func (s *providerStats) status(provider string) ProviderStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ProviderStatus{
+		Provider:     provider,
+		LastError:    s.lastError,
+		RequestCount: s.requests,
+		FailureCount: s.failures,
+	}
+	if !s.lastSuccessAt.IsZero() {
+		status.LastSuccessAt = s.lastSuccessAt.Format(time.RFC3339)
+	}
+	return status
+}
+
+// secretQueryParams are provider credentials that must never appear in logs or errors
+var secretQueryParams = []string{"key", "access_key", "token"}
+
+// redactURL masks credential query parameters in a URL
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	query := parsed.Query()
+	for _, param := range secretQueryParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// providerGet performs a GET whose URL carries a credential, retrying
+// transient failures. Transport errors from net/http embed the full URL, so
+// they are rewrapped with it redacted.
+func providerGet(ctx context.Context, client *http.Client, retry RetryPolicy, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request to %s", redactURL(rawURL))
+	}
+	resp, err := retry.Do(ctx, func() (*http.Response, error) { return client.Do(req) })
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return nil, fmt.Errorf("%s %s: %w", urlErr.Op, redactURL(urlErr.URL), urlErr.Err)
+	}
+	return resp, err
+}
+
+// chainedProvider is a provider with its timeout and circuit breaker in the chain
+type chainedProvider struct {
+	provider Provider
+	timeout  time.Duration
+	breaker  *circuitBreaker
+}
+
+// Overrides supplies countries that take precedence over the cache and
+// every provider, such as corrections of wrong lookups
+type Overrides interface {
+	Override(ip string) (country string, ok bool)
+}
+
+// Cache remembers resolved countries by canonical IP, e.g. in a store
+// shared by several servers so each address is only looked up once
+type Cache interface {
+	Get(ctx context.Context, ip string) (country string, ok bool)
+	Set(ctx context.Context, ip, country string)
+}
+
+// Chain tries providers in priority order, failing over on errors
+type Chain struct {
+	providers []chainedProvider
+
+	// Overrides, if set, is consulted before the cache
+	Overrides Overrides
+
+	// Cache, if set, is consulted before the providers and filled from them
+	Cache Cache
+
+	// Logf, if set, receives a message for every provider failure
+	Logf Logf
+
+	// FailureThreshold opens a provider's circuit after that many consecutive
+	// failures, skipping it until RecoveryTimeout has passed. Zero disables
+	// the circuit breakers.
+	FailureThreshold int
+	RecoveryTimeout  time.Duration
+
+	// Consensus, if set, makes Lookup ask two providers and only return a
+	// country they agree on; see consensusLookup
+	Consensus bool
+
+	// OnConflict, if set, is called whenever providers disagree in consensus mode
+	OnConflict func(Conflict)
+}
+
+// NewChain creates an empty provider chain
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+// Add appends a provider at the lowest priority. timeout is the provider's
+// request timeout, reported in its status.
+func (c *Chain) Add(provider Provider, timeout time.Duration) {
+	c.providers = append(c.providers, chainedProvider{provider: provider, timeout: timeout, breaker: &circuitBreaker{}})
+}
+
+// Providers returns the providers in priority order
+func (c *Chain) Providers() []Provider {
+	providers := make([]Provider, len(c.providers))
+	for i, entry := range c.providers {
+		providers[i] = entry.provider
+	}
+	return providers
+}
+
+func (c *Chain) Name() string { return "chain" }
+
+// Sources reported by LookupWithSource besides provider names
+const (
+	SourceOverride  = "override"
+	SourceCache     = "cache"
+	SourceConsensus = "consensus"
+)
+
+// Lookup returns the first country any provider resolves, in priority order,
+// unless an override or the cache already knows the address. IPv4 and IPv6
+// addresses are canonicalized first so every provider and the cache see one
+// form. Once ctx is cancelled no further providers are tried. Providers
+// whose circuit is open are skipped, and if that leaves none the error
+// wraps ErrCircuitOpen.
+// In consensus mode two providers must answer; see consensusLookup.
+func (c *Chain) Lookup(ctx context.Context, ip string) (string, error) {
+	country, _, err := c.LookupWithSource(ctx, ip)
+	return country, err
+}
+
+// LookupWithSource is Lookup that also reports what answered: the name of
+// the provider, SourceOverride, SourceCache or SourceConsensus
+func (c *Chain) LookupWithSource(ctx context.Context, ip string) (string, string, error) {
+	canonical := CanonicalIP(ip)
+	if canonical == "" {
+		return "", "", fmt.Errorf("invalid IP address %q", ip)
+	}
+	ip = canonical
+	if c.Overrides != nil {
+		if country, ok := c.Overrides.Override(ip); ok {
+			return country, SourceOverride, nil
+		}
+	}
+	if c.Cache != nil {
+		if country, ok := c.Cache.Get(ctx, ip); ok {
+			return country, SourceCache, nil
+		}
+	}
+
+	if c.Consensus {
+		country, err := c.consensusLookup(ctx, ip)
+		return country, SourceConsensus, err
+	}
+
+	var failures []string
+	skipped := 0
+	for _, entry := range c.providers {
+		if err := ctx.Err(); err != nil {
+			return "", "", err
+		}
+		country, err := c.query(ctx, entry, ip)
+		if err == nil {
+			if c.Cache != nil {
+				c.Cache.Set(ctx, ip, country)
+			}
+			return country, entry.provider.Name(), nil
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			skipped++
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", entry.provider.Name(), err))
+	}
+	if len(failures) == 0 {
+		return "", "", fmt.Errorf("no geolocation providers configured")
+	}
+	if skipped == len(c.providers) {
+		return "", "", fmt.Errorf("all geolocation providers skipped: %w", ErrCircuitOpen)
+	}
+	return "", "", fmt.Errorf("all geolocation providers failed (%s)", strings.Join(failures, "; "))
+}
+
+// query asks one provider for a canonical IP's country through its circuit
+// breaker, returning ErrCircuitOpen without calling it while the circuit is open
+func (c *Chain) query(ctx context.Context, entry chainedProvider, ip string) (string, error) {
+	if c.FailureThreshold > 0 {
+		if err := entry.breaker.allow(time.Now(), c.RecoveryTimeout); err != nil {
+			return "", err
+		}
+	}
+
+	country, err := entry.provider.Lookup(ctx, ip)
+	c.recordOutcome(ctx, entry, err)
+	if err != nil {
+		c.Logf.printf("⚠️  Geo provider %s failed for %s: %v", entry.provider.Name(), ip, err)
+		return "", err
+	}
+	return strings.ToUpper(country), nil
+}
+
+// recordOutcome feeds a lookup result to the provider's circuit breaker.
+// Lookups cancelled by the caller say nothing about the provider's health.
+func (c *Chain) recordOutcome(ctx context.Context, entry chainedProvider, err error) {
+	if c.FailureThreshold <= 0 {
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		entry.breaker.abandon()
+		return
+	}
+	state, changed := entry.breaker.record(err, c.FailureThreshold, time.Now())
+	if !changed {
+		return
+	}
+	switch state {
+	case CircuitOpen:
+		c.Logf.printf("🔌 Geo provider %s circuit opened, skipping it for %s", entry.provider.Name(), c.RecoveryTimeout)
+	case CircuitClosed:
+		c.Logf.printf("🔌 Geo provider %s circuit closed, it answered again", entry.provider.Name())
+	}
+}
+
+// ProviderResult is one provider's answer for an address, or its error
+type ProviderResult struct {
+	Provider string `json:"provider"`
+	Country  string `json:"country,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// LookupAll asks every provider for an address, bypassing overrides and the
+// cache, e.g. to find out which providers resolve it wrongly. Providers
+// whose circuit is open report ErrCircuitOpen.
+func (c *Chain) LookupAll(ctx context.Context, ip string) ([]ProviderResult, error) {
+	canonical := CanonicalIP(ip)
+	if canonical == "" {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	results := make([]ProviderResult, 0, len(c.providers))
+	for _, entry := range c.providers {
+		result := ProviderResult{Provider: entry.provider.Name()}
+		country, err := c.query(ctx, entry, canonical)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Country = country
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (c *Chain) Status() ProviderStatus {
+	return ProviderStatus{Provider: c.Name()}
+}
+
+// ProviderStatuses reports the status of every provider in priority order
+func (c *Chain) ProviderStatuses() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(c.providers))
+	for i, entry := range c.providers {
+		status := entry.provider.Status()
+		status.Priority = i + 1
+		status.Timeout = entry.timeout.String()
+		if c.FailureThreshold > 0 {
+			entry.breaker.report(&status)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,260 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCanonicalIP(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"203.0.113.7", "203.0.113.7"},
+		{" 203.0.113.7:443 ", "203.0.113.7"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[2001:db8::1]:8080", "2001:db8::1"},
+		{"[2001:DB8:0:0::1]", "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"::ffff:203.0.113.7", "203.0.113.7"},
+		{"unknown", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalIP(tt.input); got != tt.want {
+			t.Errorf("CanonicalIP(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// countingProvider resolves every IP to one country, counting lookups
+type countingProvider struct {
+	country string
+	lookups int
+}
+
+func (p *countingProvider) Lookup(ctx context.Context, ip string) (string, error) {
+	p.lookups++
+	return p.country, nil
+}
+func (p *countingProvider) Name() string           { return "counting" }
+func (p *countingProvider) Status() ProviderStatus { return ProviderStatus{Provider: p.Name()} }
+
+// mapCache is a Cache kept in a map
+type mapCache map[string]string
+
+func (c mapCache) Get(ctx context.Context, ip string) (string, bool) {
+	country, ok := c[ip]
+	return country, ok
+}
+func (c mapCache) Set(ctx context.Context, ip, country string) { c[ip] = country }
+
+func TestChainCache(t *testing.T) {
+	provider := &countingProvider{country: "de"}
+	cache := mapCache{"2001:db8::1": "FR"}
+	chain := NewChain()
+	chain.Add(provider, 0)
+	chain.Cache = cache
+
+	lookups := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "DE"},
+		{"203.0.113.7:443", "DE"},
+		{"[2001:DB8::1]", "FR"},
+	}
+	for _, lookup := range lookups {
+		if got, err := chain.Lookup(context.Background(), lookup.ip); err != nil || got != lookup.want {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", lookup.ip, got, err, lookup.want)
+		}
+	}
+	if provider.lookups != 1 {
+		t.Errorf("provider was asked %d times, want once", provider.lookups)
+	}
+	if cache["203.0.113.7"] != "DE" {
+		t.Errorf("cache = %v, want 203.0.113.7 cached as DE", cache)
+	}
+}
+
+func TestChainLookupWithSource(t *testing.T) {
+	chain := NewChain()
+	chain.Cache = mapCache{"203.0.113.8": "FR"}
+	chain.Overrides = mapOverrides{"203.0.113.9": "DE"}
+	chain.Add(&failingProvider{}, 0)
+	chain.Add(&countingProvider{country: "us"}, 0)
+
+	tests := []struct {
+		ip, country, source string
+	}{
+		{"203.0.113.7", "US", "counting"},
+		{"203.0.113.8", "FR", SourceCache},
+		{"203.0.113.9", "DE", SourceOverride},
+	}
+	for _, tt := range tests {
+		country, source, err := chain.LookupWithSource(context.Background(), tt.ip)
+		if err != nil || country != tt.country || source != tt.source {
+			t.Errorf("LookupWithSource(%q) = %q, %q, %v, want %q from %q", tt.ip, country, source, err, tt.country, tt.source)
+		}
+	}
+}
+
+// cancellingProvider fails like a provider whose request was cancelled
+type cancellingProvider struct {
+	cancel context.CancelFunc
+}
+
+func (p cancellingProvider) Lookup(ctx context.Context, ip string) (string, error) {
+	p.cancel()
+	return "", ctx.Err()
+}
+func (p cancellingProvider) Name() string           { return "cancelling" }
+func (p cancellingProvider) Status() ProviderStatus { return ProviderStatus{Provider: p.Name()} }
+
+func TestChainStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fallback := &countingProvider{country: "DE"}
+	chain := NewChain()
+	chain.Add(cancellingProvider{cancel: cancel}, 0)
+	chain.Add(fallback, 0)
+
+	if _, err := chain.Lookup(ctx, "203.0.113.7"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Lookup = %v, want context.Canceled", err)
+	}
+	if fallback.lookups != 0 {
+		t.Errorf("fallback provider was asked %d times after cancellation", fallback.lookups)
+	}
+}
+
+// failingProvider fails every lookup, counting them
+type failingProvider struct {
+	lookups int
+}
+
+func (p *failingProvider) Lookup(ctx context.Context, ip string) (string, error) {
+	p.lookups++
+	return "", errors.New("timeout")
+}
+func (p *failingProvider) Name() string           { return "failing" }
+func (p *failingProvider) Status() ProviderStatus { return ProviderStatus{Provider: p.Name()} }
+
+func TestChainCircuitBreaker(t *testing.T) {
+	down := &failingProvider{}
+	chain := NewChain()
+	chain.FailureThreshold = 3
+	chain.RecoveryTimeout = time.Hour
+	chain.Add(down, 0)
+
+	for i := 0; i < 5; i++ {
+		chain.Lookup(context.Background(), "203.0.113.7")
+	}
+	if down.lookups != 3 {
+		t.Errorf("provider was asked %d times, want 3 before its circuit opened", down.lookups)
+	}
+	if _, err := chain.Lookup(context.Background(), "203.0.113.7"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Lookup = %v, want ErrCircuitOpen", err)
+	}
+	if status := chain.ProviderStatuses()[0]; status.Circuit != string(CircuitOpen) || status.CircuitTrips != 1 {
+		t.Errorf("status circuit = %q with %d trips, want open after 1 trip", status.Circuit, status.CircuitTrips)
+	}
+
+	// A healthy fallback still answers while the first provider is skipped
+	fallback := &countingProvider{country: "DE"}
+	chain.Add(fallback, 0)
+	if got, err := chain.Lookup(context.Background(), "203.0.113.7"); err != nil || got != "DE" {
+		t.Errorf("Lookup = %q, %v, want DE from the fallback", got, err)
+	}
+	if down.lookups != 3 {
+		t.Errorf("provider with an open circuit was asked again")
+	}
+}
+
+// mapOverrides overrides the countries of the IPs in a map
+type mapOverrides map[string]string
+
+func (o mapOverrides) Override(ip string) (string, bool) {
+	country, ok := o[ip]
+	return country, ok
+}
+
+func TestChainOverridesAndLookupAll(t *testing.T) {
+	provider := &countingProvider{country: "RU"}
+	chain := NewChain()
+	chain.Cache = mapCache{"203.0.113.7": "RU"}
+	chain.Overrides = mapOverrides{"203.0.113.7": "DE"}
+	chain.Add(provider, 0)
+	chain.Add(&failingProvider{}, 0)
+
+	if got, err := chain.Lookup(context.Background(), "203.0.113.7"); err != nil || got != "DE" {
+		t.Errorf("Lookup = %q, %v, want the override DE", got, err)
+	}
+	if provider.lookups != 0 {
+		t.Errorf("provider was asked about an overridden address")
+	}
+
+	results, err := chain.LookupAll(context.Background(), "::ffff:203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProviderResult{{Provider: "counting", Country: "RU"}, {Provider: "failing", Error: "timeout"}}
+	if len(results) != len(want) || results[0] != want[0] || results[1] != want[1] {
+		t.Errorf("LookupAll = %+v, want %+v", results, want)
+	}
+}
+
+// stubTransport sends every request to a test server instead of its host
+type stubTransport struct {
+	server *url.URL
+}
+
+func (t stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.server.Scheme, t.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestIPInfoQuotaFallback(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	ipinfo := NewIPInfo("token", time.Second)
+	ipinfo.SetHTTPClient(&http.Client{Transport: stubTransport{server: serverURL}})
+	fallback := &countingProvider{country: "DE"}
+	chain := NewChain()
+	chain.FailureThreshold = 3
+	chain.RecoveryTimeout = time.Hour
+	chain.Add(ipinfo, time.Second)
+	chain.Add(fallback, 0)
+
+	for i := 0; i < 5; i++ {
+		if got, err := chain.Lookup(context.Background(), "203.0.113.7"); err != nil || got != "DE" {
+			t.Fatalf("lookup %d = %q, %v, want DE from the fallback", i, got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("ipinfo.io was called %d times, want 1 until the quota resets", calls)
+	}
+	if fallback.lookups != 5 {
+		t.Errorf("fallback answered %d lookups, want 5", fallback.lookups)
+	}
+
+	status := chain.ProviderStatuses()[0]
+	if !status.RateLimited || status.QuotaHits != 1 || status.LastStatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %+v, want rate limited after 1 quota hit", status)
+	}
+	if status.Circuit != string(CircuitOpen) {
+		t.Errorf("circuit = %q, want open after repeated quota errors", status.Circuit)
+	}
+}
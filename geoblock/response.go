@@ -0,0 +1,173 @@
+package geoblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ResponseTemplate configures what a blocked client receives.
+// Exactly one of RedirectURL, HTML/HTMLFile, or the JSON body is used.
+// HTMLFile names a template inside the store's block pages directory.
+// Setting LegalReference marks the block as legally mandated (e.g. sanctions)
+// and defaults the status to 451 Unavailable For Legal Reasons (RFC 7725).
+type ResponseTemplate struct {
+	StatusCode     int                    `json:"status_code,omitempty"`
+	RedirectURL    string                 `json:"redirect_url,omitempty"`
+	HTML           string                 `json:"html,omitempty"`
+	HTMLFile       string                 `json:"html_file,omitempty"`
+	JSONFields     map[string]interface{} `json:"json_fields,omitempty"`
+	LegalReference string                 `json:"legal_reference,omitempty"`
+	PolicyURL      string                 `json:"policy_url,omitempty"`
+}
+
+// PageData is available to HTML block page templates, e.g. {{.CountryName}}
+type PageData struct {
+	CountryCode string
+	CountryName string
+	ClientIP    string
+	DetectedVia string
+	BlockedAt   string
+	Reason      string
+	RuleID      string
+
+	// Set when the block is legally mandated, e.g. by sanctions
+	LegalReference string
+	PolicyURL      string
+}
+
+// compiledResponse is a validated template ready to render
+type compiledResponse struct {
+	statusCode     int
+	redirectURL    string
+	html           *template.Template
+	jsonFields     map[string]interface{}
+	legalReference string
+	policyURL      string
+}
+
+// defaultResponse is the built-in 403 JSON response
+var defaultResponse = &compiledResponse{statusCode: http.StatusForbidden}
+
+// compileResponse validates a template and parses its HTML page, reading
+// html_file pages from pagesDir
+func compileResponse(tmpl *ResponseTemplate, pagesDir string) (*compiledResponse, error) {
+	if tmpl == nil {
+		return defaultResponse, nil
+	}
+
+	compiled := &compiledResponse{
+		statusCode:     tmpl.StatusCode,
+		redirectURL:    tmpl.RedirectURL,
+		jsonFields:     tmpl.JSONFields,
+		legalReference: tmpl.LegalReference,
+		policyURL:      tmpl.PolicyURL,
+	}
+
+	if compiled.redirectURL != "" {
+		if compiled.statusCode == 0 {
+			compiled.statusCode = http.StatusFound
+		}
+		if compiled.statusCode < 300 || compiled.statusCode > 399 {
+			return nil, fmt.Errorf("redirect block response needs a 3xx status code, got %d", compiled.statusCode)
+		}
+		return compiled, nil
+	}
+
+	if compiled.statusCode == 0 {
+		compiled.statusCode = http.StatusForbidden
+		if compiled.legalReference != "" {
+			compiled.statusCode = http.StatusUnavailableForLegalReasons
+		}
+	}
+	if compiled.statusCode < 400 || compiled.statusCode > 599 {
+		return nil, fmt.Errorf("block response status code must be 4xx or 5xx, got %d", compiled.statusCode)
+	}
+
+	source := tmpl.HTML
+	if tmpl.HTMLFile != "" {
+		data, err := readBlockPage(pagesDir, tmpl.HTMLFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block page %s: %w", tmpl.HTMLFile, err)
+		}
+		source = string(data)
+	}
+	if source != "" {
+		page, err := template.New("block-page").Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block page template: %w", err)
+		}
+		compiled.html = page
+	}
+
+	return compiled, nil
+}
+
+// readBlockPage reads an html_file template, which must be a relative path
+// inside pagesDir. Pages are served to unauthenticated visitors, so
+// arbitrary paths are refused.
+func readBlockPage(pagesDir, name string) ([]byte, error) {
+	if pagesDir == "" {
+		return nil, fmt.Errorf("html_file %q needs a block pages directory", name)
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("html_file %q must be a relative path inside %s", name, pagesDir)
+	}
+	return os.ReadFile(filepath.Join(pagesDir, name))
+}
+
+// write renders the blocked response for a request
+func (c *compiledResponse) write(w http.ResponseWriter, r *http.Request, data PageData, logf Logf) {
+	// RFC 7725 identifies the blocking policy through a blocked-by link
+	if c.policyURL != "" {
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"blocked-by\"", c.policyURL))
+	}
+	if c.legalReference != "" {
+		data.Reason = "Unavailable for legal reasons"
+		data.LegalReference = c.legalReference
+	}
+	data.PolicyURL = c.policyURL
+
+	if c.redirectURL != "" {
+		http.Redirect(w, r, c.redirectURL, c.statusCode)
+		return
+	}
+
+	if c.html != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(c.statusCode)
+		if err := c.html.Execute(w, data); err != nil {
+			logf.printf("❌ Error rendering block page: %v", err)
+		}
+		return
+	}
+
+	blockResponse := map[string]interface{}{
+		"error":        "Country Blocked",
+		"message":      fmt.Sprintf("Access denied: Your country (%s) has been blocked", data.CountryCode),
+		"country_code": data.CountryCode,
+		"client_ip":    data.ClientIP,
+		"detected_via": data.DetectedVia,
+		"blocked_at":   data.BlockedAt,
+		"reason":       data.Reason,
+	}
+	if data.RuleID != "" {
+		blockResponse["rule_id"] = data.RuleID
+	}
+	if data.LegalReference != "" {
+		blockResponse["legal_reference"] = data.LegalReference
+	}
+	if data.PolicyURL != "" {
+		blockResponse["policy_url"] = data.PolicyURL
+	}
+	for key, value := range c.jsonFields {
+		blockResponse[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(c.statusCode)
+	json.NewEncoder(w).Encode(blockResponse)
+}
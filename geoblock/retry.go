@@ -0,0 +1,102 @@
+package geoblock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries HTTP calls that fail transiently: timeouts, refused
+// or reset connections, and 500, 502, 503 and 504 responses. Other errors
+// and statuses are returned at once. The zero value makes a single call.
+type RetryPolicy struct {
+	// Attempts is the total number of calls, including the first
+	Attempts int
+
+	// BaseDelay is the wait before the first retry, doubled for each later
+	// one up to MaxDelay, with jitter. A Retry-After header on a 503 is
+	// honored up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// OnRetry, if set, is told about every retry before its wait
+	OnRetry func(attempt int, wait time.Duration, reason string)
+}
+
+// Do calls call until it succeeds, fails permanently or runs out of
+// attempts, returning the last response or error. call must build a new
+// request each time if the request has a body. Responses that are retried
+// are drained and closed. Do stops waiting once ctx is done.
+func (p RetryPolicy) Do(ctx context.Context, call func() (*http.Response, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := call()
+		reason := transientFailure(resp, err)
+		if reason == "" || attempt >= p.Attempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := p.delay(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt+1, wait, reason)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// delay is the wait before the retry following attempt
+func (p RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = time.Minute
+	}
+	if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
+		if wait := retryAfter(resp, 0); wait > 0 {
+			return min(wait, maxDelay)
+		}
+	}
+
+	wait := p.BaseDelay << (attempt - 1)
+	if wait <= 0 || wait > maxDelay {
+		wait = maxDelay
+	}
+	// Jitter keeps clients that failed together from retrying together
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// transientFailure describes why a call is worth retrying, or returns ""
+func transientFailure(resp *http.Response, err error) string {
+	if err != nil {
+		// A cancelled caller is caught by Do; a client timeout is retried
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return "timeout"
+		case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+			errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return "connection failed"
+		}
+		return ""
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Sprintf("status %d", resp.StatusCode)
+	}
+	return ""
+}
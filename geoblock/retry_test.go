@@ -0,0 +1,92 @@
+package geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		attempts   int
+		wantCalls  int32
+		wantStatus int
+	}{
+		{"success first", []int{200}, 3, 1, 200},
+		{"5xx then success", []int{503, 502, 200}, 3, 3, 200},
+		{"client error not retried", []int{400, 200}, 3, 1, 400},
+		{"attempts exhausted", []int{500, 500, 500, 200}, 3, 3, 500},
+		{"zero value calls once", []int{504, 200}, 0, 1, 504},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.WriteHeader(tt.statuses[min(int(n), len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			policy := RetryPolicy{Attempts: tt.attempts, BaseDelay: time.Millisecond}
+			resp, err := policy.Do(context.Background(), func() (*http.Response, error) {
+				return http.Get(server.URL)
+			})
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyStopsWhenCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var retries int
+	policy := RetryPolicy{
+		Attempts:  5,
+		BaseDelay: time.Hour,
+		OnRetry: func(attempt int, wait time.Duration, reason string) {
+			retries++
+			cancel()
+		},
+	}
+	start := time.Now()
+	_, err := policy.Do(ctx, func() (*http.Response, error) { return http.Get(server.URL) })
+	if err != context.Canceled {
+		t.Errorf("Do() error = %v, want context.Canceled", err)
+	}
+	if retries != 1 || time.Since(start) > 5*time.Second {
+		t.Errorf("retries = %d after %s, want 1 without waiting", retries, time.Since(start))
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, limit := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		limit *= time.Millisecond
+		if wait := policy.delay(attempt+1, nil); wait < limit/2 || wait > limit {
+			t.Errorf("delay(%d) = %s, want between %s and %s", attempt+1, wait, limit/2, limit)
+		}
+	}
+
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"30"}}}
+	if wait := policy.delay(1, resp); wait != time.Second {
+		t.Errorf("delay() with Retry-After = %s, want capped at %s", wait, time.Second)
+	}
+}
@@ -0,0 +1,81 @@
+package geoblock
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// Snapshot looks up countries in a fixed in-memory table of networks, such
+// as one bundled with the binary, without any I/O. The most specific
+// network containing an address wins.
+type Snapshot struct {
+	// prefixes lists the prefix lengths present per IP version, longest first
+	prefixes map[int][]int
+	networks map[string]string
+	count    int
+	loadedAt time.Time
+	stats    providerStats
+
+	// Source describes where the table came from, e.g. a file path
+	Source string
+}
+
+// NewSnapshot builds a snapshot from networks per country code
+func NewSnapshot(ranges map[string][]*net.IPNet) *Snapshot {
+	s := &Snapshot{prefixes: make(map[int][]int), networks: make(map[string]string), loadedAt: time.Now()}
+	seen := make(map[[2]int]bool)
+	for country, networks := range ranges {
+		for _, network := range networks {
+			ones, bits := network.Mask.Size()
+			s.networks[network.String()] = country
+			s.count++
+			if key := [2]int{bits, ones}; !seen[key] {
+				seen[key] = true
+				s.prefixes[bits] = append(s.prefixes[bits], ones)
+			}
+		}
+	}
+	for bits := range s.prefixes {
+		sort.Sort(sort.Reverse(sort.IntSlice(s.prefixes[bits])))
+	}
+	return s
+}
+
+func (s *Snapshot) Name() string { return "snapshot" }
+
+// Len returns how many networks the snapshot holds
+func (s *Snapshot) Len() int { return s.count }
+
+// LoadedAt returns when the snapshot was built
+func (s *Snapshot) LoadedAt() time.Time { return s.loadedAt }
+
+func (s *Snapshot) Lookup(ctx context.Context, ip string) (string, error) {
+	country, err := s.lookup(ip)
+	s.stats.record(err)
+	return country, err
+}
+
+func (s *Snapshot) lookup(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP address %q", ip)
+	}
+	bits := net.IPv6len * 8
+	if v4 := parsed.To4(); v4 != nil {
+		parsed, bits = v4, net.IPv4len*8
+	}
+	for _, ones := range s.prefixes[bits] {
+		network := net.IPNet{IP: parsed.Mask(net.CIDRMask(ones, bits)), Mask: net.CIDRMask(ones, bits)}
+		if country, ok := s.networks[network.String()]; ok {
+			return country, nil
+		}
+	}
+	return "", fmt.Errorf("snapshot has no country for %s", ip)
+}
+
+func (s *Snapshot) Status() ProviderStatus {
+	return s.stats.status(s.Name())
+}
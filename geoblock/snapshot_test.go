@@ -0,0 +1,48 @@
+package geoblock
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestSnapshotLookup(t *testing.T) {
+	ranges := make(map[string][]*net.IPNet)
+	for country, cidrs := range map[string][]string{
+		"DE": {"91.0.0.0/10", "2003::/19"},
+		"AT": {"91.1.0.0/16"},
+		"US": {"8.8.8.0/24"},
+	} {
+		for _, cidr := range cidrs {
+			_, network, _ := net.ParseCIDR(cidr)
+			ranges[country] = append(ranges[country], network)
+		}
+	}
+	snapshot := NewSnapshot(ranges)
+	if snapshot.Len() != 4 {
+		t.Fatalf("Len() = %d, want 4", snapshot.Len())
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"91.2.3.4", "DE"},
+		{"91.1.2.3", "AT"},
+		{"8.8.8.8", "US"},
+		{"::ffff:8.8.8.8", "US"},
+		{"2003:e1::1", "DE"},
+		{"203.0.113.7", ""},
+		{"not-an-ip", ""},
+	}
+	for _, tt := range tests {
+		got, err := snapshot.Lookup(context.Background(), tt.ip)
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", tt.ip, got, err, tt.want)
+		}
+	}
+
+	if status := snapshot.Status(); status.RequestCount != int64(len(tests)) || status.FailureCount != 2 {
+		t.Errorf("status = %+v, want %d requests and 2 failures", status, len(tests))
+	}
+}
@@ -0,0 +1,118 @@
+package geoblock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stickyCookie carries a client's signed allow decision
+const stickyCookie = "geoblock_decision"
+
+// WithStickyDecisions remembers each allowed client's country in a signed
+// cookie for ttl, so its later requests are allowed without locating it
+// again and a mid-session IP change cannot flip the decision. The cookie
+// is bound to the request's host and the store's Version: any policy change
+// revalidates every client on its next request. It expires no later than
+// the next time a scheduled rule starts to apply, and the client's current
+// address is still checked against blocked networks, and its country against
+// conditional rules, on every request. Only plain allow decisions
+// are recorded; exempt, monitored, challenged, unlocated and unscored
+// clients are always decided afresh. Cookies are signed with the challenge
+// secret, so replicas need the same one (see WithChallengeSecret).
+func WithStickyDecisions(ttl time.Duration) Option {
+	return func(b *Blocker) { b.stickyTTL = ttl }
+}
+
+// stickyToken signs an allow decision for a country and host under a
+// policy version until expires
+func stickyToken(secret []byte, country, host, version string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("allow|" + country + "|" + host + "|" + version + "|" + expiry))
+	return country + "." + version + "." + expiry + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseStickyToken returns the country of a token issued for host under
+// version that has not expired
+func parseStickyToken(secret []byte, token, host, version string, now time.Time) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[1] != version {
+		return "", false
+	}
+	unix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", false
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return "", false
+	}
+	if !hmac.Equal([]byte(token), []byte(stickyToken(secret, parts[0], host, version, expires))) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// stickyDecision returns the allow decision recorded in the request's
+// cookie, if it is valid for the current policy
+func (b *Blocker) stickyDecision(r *http.Request) (Decision, bool) {
+	cookie, err := r.Cookie(stickyCookie)
+	if err != nil {
+		return Decision{}, false
+	}
+	host := RequestHost(r)
+	now := time.Now()
+	country, ok := parseStickyToken(b.challengeSecret, cookie.Value, host, b.store.Version(), now)
+	if !ok {
+		return Decision{}, false
+	}
+	// The cookie vouches for the country, not the address: a new address may
+	// be in a blocked network or score worse under a conditional rule
+	ip := b.clientIP(r)
+	if b.store.MatchIPAt(ip, now) != nil || b.store.MatchAt(country, now) != nil {
+		return Decision{}, false
+	}
+	return Decision{Geo: RequestGeo{ClientIP: ip, ActualIP: ip, Country: country, Host: host}, Sticky: true}, true
+}
+
+// sticks reports whether a decision may be recorded in a cookie. Countries
+// with a conditional rule are decided afresh anyway (see stickyDecision).
+func (b *Blocker) sticks(decision Decision) bool {
+	return !decision.Sticky && !decision.Blocked && !decision.Challenged && decision.Match == nil &&
+		decision.Exemption == nil && decision.Geo.Country != UnknownCountry && decision.Geo.Country != DisputedCountry && b.cacheable(decision) &&
+		b.store.Match(decision.Geo.Country) == nil
+}
+
+// setStickyCookie records an allowed client's decision, or expires a
+// cookie the request carried when its decision can no longer be recorded
+func (b *Blocker) setStickyCookie(w http.ResponseWriter, r *http.Request, decision Decision) {
+	if decision.Sticky {
+		return
+	}
+	cookie := &http.Cookie{
+		Name:     stickyCookie,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if b.sticks(decision) {
+		now := time.Now()
+		expires := now.Add(b.stickyTTL)
+		if next := b.store.nextActivation(now); !next.IsZero() && next.Before(expires) {
+			expires = next
+		}
+		cookie.Value = stickyToken(b.challengeSecret, decision.Geo.Country, decision.Geo.Host, b.store.Version(), expires)
+		cookie.MaxAge = max(1, int(expires.Sub(now).Seconds()))
+	} else if _, err := r.Cookie(stickyCookie); err == nil {
+		cookie.MaxAge = -1
+	} else {
+		return
+	}
+	http.SetCookie(w, cookie)
+}
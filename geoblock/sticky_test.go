@@ -0,0 +1,146 @@
+package geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStickyDecisions(t *testing.T) {
+	store := NewStore()
+	if _, err := store.ReplacePolicy(&Policy{BlockedCountries: []string{"RU"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := 0
+	country := "DE"
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) {
+		lookups++
+		return country, nil
+	})
+	blocker := New(store, resolver, WithStickyDecisions(time.Hour), WithChallengeSecret([]byte("secret")))
+	handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var cookies []*http.Cookie
+	request := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		if set := recorder.Result().Cookies(); len(set) > 0 {
+			cookies = set
+		}
+		return recorder
+	}
+
+	steps := []struct {
+		name        string
+		host        string
+		change      func()
+		wantStatus  int
+		wantLookups int
+		wantCookie  bool
+	}{
+		{"first request located", "myshop.de", nil, http.StatusOK, 1, true},
+		{"IP change kept allowed", "myshop.de", func() { country = "RU" }, http.StatusOK, 1, true},
+		{"other host located", "myshop.fr", nil, http.StatusForbidden, 2, false},
+		{"removed cookie ignored", "myshop.de", nil, http.StatusForbidden, 3, false},
+		{"allowed again", "myshop.de", func() { country = "DE" }, http.StatusOK, 4, true},
+		{"policy change revalidates", "myshop.de", func() {
+			store.ReplacePolicy(&Policy{BlockedCountries: []string{"RU", "DE"}})
+		}, http.StatusForbidden, 5, false},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			step.change()
+		}
+		recorder := request(step.host)
+		if recorder.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d", step.name, recorder.Code, step.wantStatus)
+		}
+		if lookups != step.wantLookups {
+			t.Errorf("%s: %d lookups, want %d", step.name, lookups, step.wantLookups)
+		}
+		if got := len(cookies) > 0 && cookies[0].MaxAge > 0; got != step.wantCookie {
+			t.Errorf("%s: sticky cookie = %v, want %v", step.name, got, step.wantCookie)
+		}
+	}
+}
+
+func TestStickyToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	token := stickyToken(secret, "DE", "myshop.de", "v1", now.Add(time.Minute))
+	if country, ok := parseStickyToken(secret, token, "myshop.de", "v1", now); !ok || country != "DE" {
+		t.Errorf("valid token parsed as %q, %v", country, ok)
+	}
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		token   string
+		host    string
+		version string
+		now     time.Time
+	}{
+		{"expired", secret, token, "myshop.de", "v1", now.Add(time.Minute)},
+		{"other version", secret, token, "myshop.de", "v2", now},
+		{"other host", secret, token, "myshop.fr", "v1", now},
+		{"other secret", []byte("other"), token, "myshop.de", "v1", now},
+		{"forged country", secret, "US" + token[2:], "myshop.de", "v1", now},
+		{"malformed", secret, "DE.v1", "myshop.de", "v1", now},
+	}
+	for _, tt := range tests {
+		if _, ok := parseStickyToken(tt.secret, tt.token, tt.host, tt.version, tt.now); ok {
+			t.Errorf("%s token accepted", tt.name)
+		}
+	}
+}
+
+func TestStickyDecisionsScheduledRule(t *testing.T) {
+	// A rule blocking DE starts to apply while the cookie would still be valid
+	from := time.Now().Add(time.Second).Truncate(time.Second)
+	store := NewStore()
+	policy := &Policy{
+		Rules:           []Rule{{ID: "de-later", Countries: []string{"DE"}, EffectiveFrom: &from}},
+		BlockedNetworks: []string{"203.0.113.0/24"},
+	}
+	if _, err := store.ReplacePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	resolver := ResolverFunc(func(ctx context.Context, ip string) (string, error) { return "DE", nil })
+	blocker := New(store, resolver, WithStickyDecisions(time.Hour), WithChallengeSecret([]byte("secret")))
+	handler := blocker.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := func(remoteAddr string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://myshop.de/", nil)
+		req.RemoteAddr = remoteAddr
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		return recorder
+	}
+
+	first := request("198.51.100.7:1234", nil)
+	cookies := first.Result().Cookies()
+	if first.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("first request: status %d with %d cookies, want 200 with a cookie", first.Code, len(cookies))
+	}
+	if cookies[0].MaxAge > 1 {
+		t.Errorf("cookie max age = %ds, want it to end when the rule starts", cookies[0].MaxAge)
+	}
+
+	// The cookie does not cover an address in a blocked network
+	if moved := request("203.0.113.9:1234", cookies); moved.Code != http.StatusForbidden {
+		t.Errorf("cookie from a blocked network: status %d, want 403", moved.Code)
+	}
+
+	time.Sleep(time.Until(from))
+	if later := request("198.51.100.7:1234", cookies); later.Code != http.StatusForbidden {
+		t.Errorf("cookie after the rule started: status %d, want 403", later.Code)
+	}
+}
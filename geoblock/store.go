@@ -0,0 +1,578 @@
+package geoblock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// compiledWindow is a DailyWindow as minutes since midnight in its location
+type compiledWindow struct {
+	start, end int
+	location   *time.Location
+}
+
+func compileDailyWindow(window *DailyWindow) (*compiledWindow, error) {
+	parseClock := func(value string) (int, error) {
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+		}
+		return t.Hour()*60 + t.Minute(), nil
+	}
+
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(window.End)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("daily window start and end are both %s", window.Start)
+	}
+
+	location := time.UTC
+	if window.Timezone != "" {
+		if location, err = time.LoadLocation(window.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", window.Timezone, err)
+		}
+	}
+
+	return &compiledWindow{start: start, end: end, location: location}, nil
+}
+
+func (w *compiledWindow) contains(t time.Time) bool {
+	local := t.In(w.location)
+	minute := local.Hour()*60 + local.Minute()
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// nextStart returns the first start of the window after t
+func (w *compiledWindow) nextStart(t time.Time) time.Time {
+	local := t.In(w.location)
+	for day := 0; ; day++ {
+		start := time.Date(local.Year(), local.Month(), local.Day()+day, w.start/60, w.start%60, 0, 0, w.location)
+		if start.After(t) {
+			return start
+		}
+	}
+}
+
+// Match describes why a country or IP network is blocked. Network is set,
+// in CIDR form, only for matches on an IP network; Rule is nil for the
+// plain blocklists. Monitor is set when the policy or rule is in monitor
+// mode, so the request should be reported but not blocked. Fallback is set
+// on matches for UnknownCountry.
+type Match struct {
+	Country  string
+	Network  string
+	Rule     *Rule
+	Monitor  bool
+	Fallback Fallback
+	response *compiledResponse
+	window   *compiledWindow
+}
+
+// activeAt reports whether the match applies at the given time
+func (m *Match) activeAt(t time.Time) bool {
+	if m.Rule == nil {
+		return true
+	}
+	if m.Rule.EffectiveFrom != nil && t.Before(*m.Rule.EffectiveFrom) {
+		return false
+	}
+	if m.Rule.ExpiredAt(t) {
+		return false
+	}
+	return m.window == nil || m.window.contains(t)
+}
+
+// nextActivation returns the first time after t at which the match starts
+// to apply, or the zero time if it never will
+func (m *Match) nextActivation(t time.Time) time.Time {
+	if m.Rule == nil || m.Rule.ExpiredAt(t) {
+		return time.Time{}
+	}
+	from := t
+	if m.Rule.EffectiveFrom != nil && m.Rule.EffectiveFrom.After(t) {
+		from = *m.Rule.EffectiveFrom
+		if m.window == nil || m.window.contains(from) {
+			return from
+		}
+	}
+	if m.window == nil {
+		return time.Time{}
+	}
+	if next := m.window.nextStart(from); !m.Rule.ExpiredAt(next) {
+		return next
+	}
+	return time.Time{}
+}
+
+// appliesTo reports whether a located request meets the match's conditions
+// beyond country, network and time
+func (m *Match) appliesTo(geo RequestGeo) bool {
+	if !m.appliesToHost(geo.Host) {
+		return false
+	}
+	if m.Rule == nil || m.Rule.ReputationAbove == 0 {
+		return true
+	}
+	return geo.ReputationKnown && geo.Reputation > m.Rule.ReputationAbove
+}
+
+// appliesToHost reports whether the match's rule covers requests for host
+func (m *Match) appliesToHost(host string) bool {
+	if m.Rule == nil || len(m.Rule.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range m.Rule.Hosts {
+		if HostMatches(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conditional reports whether the match only applies to some requests from
+// its country or network, such as those from clients with a poor reputation
+// or for one of several storefront domains
+func (m *Match) Conditional() bool {
+	return m.Rule != nil && (m.Rule.ReputationAbove > 0 || len(m.Rule.Hosts) > 0)
+}
+
+// Challenges reports whether the match challenges clients instead of blocking them
+func (m *Match) Challenges() bool {
+	if m.Fallback != "" {
+		return m.Fallback == FallbackChallenge
+	}
+	return m.Rule != nil && m.Rule.Challenge
+}
+
+// RuleID returns the matching rule's ID, or "" for the plain blocklists
+func (m *Match) RuleID() string {
+	if m.Rule == nil {
+		return ""
+	}
+	return m.Rule.ID
+}
+
+// snapshot is an immutable view of the blocking policy.
+// Readers never lock; writers build a new snapshot and swap it in.
+type snapshot struct {
+	policy     *Policy
+	version    string
+	matches    map[string][]*Match
+	ordered    []string
+	networks   []networkMatch
+	rateLimits map[string]*RateLimit
+
+	// usesReputation is set when a rule depends on the client's reputation score
+	usesReputation bool
+
+	// scheduled holds a match of every rule with an effective_from or a
+	// daily window, which start to apply without a policy change
+	scheduled []*Match
+
+	// failClosed blocks clients that could not be located when neither the
+	// policy nor a rule decides and the Blocker fails closed
+	failClosed *Match
+
+	// disputed challenges clients whose providers disagree when the
+	// Blocker is set to
+	disputed *Match
+
+	exemptNetworks   []exemptNetwork
+	exemptPrincipals map[string]*Exemption
+}
+
+// networkMatch pairs a blocked IPv4 or IPv6 network with its match
+type networkMatch struct {
+	network *net.IPNet
+	match   *Match
+}
+
+// exemptNetwork pairs an exempted IPv4 or IPv6 network with its exemption
+type exemptNetwork struct {
+	network   *net.IPNet
+	exemption *Exemption
+}
+
+// Store holds the active blocking policy and is safe for concurrent use.
+// Reads load the current snapshot; writes are serialized by writeMu from the
+// moment the policy is copied until the new snapshot is swapped in.
+type Store struct {
+	current  atomic.Pointer[snapshot]
+	writeMu  sync.Mutex
+	persist  func(*Policy) error
+	pagesDir string
+}
+
+var (
+	// ErrInvalidPolicy marks update failures caused by the policy itself rather than storage
+	ErrInvalidPolicy = errors.New("invalid blocking policy")
+
+	// ErrNoPolicyChange lets an update function abort without committing anything
+	ErrNoPolicyChange = errors.New("no policy change")
+)
+
+// StoreOption configures a Store
+type StoreOption func(*Store)
+
+// WithPersist calls persist with every updated policy before it becomes
+// active; if it fails, the update is abandoned
+func WithPersist(persist func(*Policy) error) StoreOption {
+	return func(s *Store) { s.persist = persist }
+}
+
+// WithBlockPagesDir sets the only directory html_file block pages are read from.
+// Without it, policies using html_file are rejected.
+func WithBlockPagesDir(dir string) StoreOption {
+	return func(s *Store) { s.pagesDir = dir }
+}
+
+// NewStore creates a store with an empty policy
+func NewStore(opts ...StoreOption) *Store {
+	store := &Store{}
+	for _, opt := range opts {
+		opt(store)
+	}
+	empty, _ := store.compile(&Policy{})
+	store.current.Store(empty)
+	return store
+}
+
+// compile indexes a policy by country and network and compiles its block responses.
+// Rules take precedence over the plain blocklists, and earlier rules over later
+// ones; a country may have several time-limited matches.
+func (s *Store) compile(policy *Policy) (*snapshot, error) {
+	defaultResponse, err := compileResponse(policy.BlockResponse, s.pagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("default block response: %w", err)
+	}
+
+	compiled := &snapshot{
+		policy:           policy,
+		version:          policyVersion(policy),
+		matches:          make(map[string][]*Match),
+		rateLimits:       make(map[string]*RateLimit),
+		exemptPrincipals: make(map[string]*Exemption),
+		failClosed:       &Match{Country: UnknownCountry, Monitor: policy.Monitor, Fallback: FallbackBlock, response: defaultResponse},
+		disputed:         &Match{Country: DisputedCountry, Monitor: policy.Monitor, Fallback: FallbackChallenge, response: defaultResponse},
+	}
+	// Unknown-country matches are kept out of the ordered country list
+	addUnknown := func(fallback Fallback, match *Match) error {
+		if !fallback.Valid() {
+			return fmt.Errorf("invalid unknown_country %q: use allow, block or challenge", fallback)
+		}
+		if fallback != "" {
+			match.Fallback = fallback
+			compiled.matches[UnknownCountry] = append(compiled.matches[UnknownCountry], match)
+		}
+		return nil
+	}
+	add := func(code string, match *Match) {
+		if _, exists := compiled.matches[code]; !exists {
+			compiled.ordered = append(compiled.ordered, code)
+		}
+		compiled.matches[code] = append(compiled.matches[code], match)
+	}
+	addNetwork := func(cidr string, match *Match) error {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid network %q", cidr)
+		}
+		match.Network = network.String()
+		compiled.networks = append(compiled.networks, networkMatch{network: network, match: match})
+		return nil
+	}
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		response := defaultResponse
+		if rule.Response != nil {
+			if response, err = compileResponse(rule.Response, s.pagesDir); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+		}
+		if rule.EffectiveFrom != nil && rule.EffectiveUntil != nil && !rule.EffectiveFrom.Before(*rule.EffectiveUntil) {
+			return nil, fmt.Errorf("rule %s: effective_from must be before effective_until", rule.ID)
+		}
+		var window *compiledWindow
+		if rule.DailyWindow != nil {
+			if window, err = compileDailyWindow(rule.DailyWindow); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+		}
+		for _, host := range rule.Hosts {
+			if host != NormalizeHost(host) || strings.TrimPrefix(host, "*.") == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+				return nil, fmt.Errorf("rule %s: invalid host %q, expected e.g. myshop.de or *.myshop.de", rule.ID, host)
+			}
+		}
+		if rule.ReputationAbove < 0 || rule.ReputationAbove > 99 {
+			return nil, fmt.Errorf("rule %s: reputation_above must be between 0 and 99", rule.ID)
+		}
+		compiled.usesReputation = compiled.usesReputation || rule.ReputationAbove > 0
+		monitor := policy.Monitor || rule.Monitor
+		countries, err := policy.RuleCountries(rule)
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range countries {
+			add(code, &Match{Country: code, Rule: rule, Monitor: monitor, response: response, window: window})
+		}
+		for _, cidr := range rule.Networks {
+			if err := addNetwork(cidr, &Match{Rule: rule, Monitor: monitor, response: response, window: window}); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+		}
+		unknown := &Match{Country: UnknownCountry, Rule: rule, Monitor: monitor, response: response, window: window}
+		if err := addUnknown(rule.UnknownCountry, unknown); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		if rule.EffectiveFrom != nil || window != nil {
+			compiled.scheduled = append(compiled.scheduled, unknown)
+		}
+	}
+	unknown := &Match{Country: UnknownCountry, Monitor: policy.Monitor, response: defaultResponse}
+	if err := addUnknown(policy.UnknownCountry, unknown); err != nil {
+		return nil, err
+	}
+	for _, code := range policy.BlockedCountries {
+		add(code, &Match{Country: code, Monitor: policy.Monitor, response: defaultResponse})
+	}
+	for _, cidr := range policy.BlockedNetworks {
+		if err := addNetwork(cidr, &Match{Monitor: policy.Monitor, response: defaultResponse}); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range policy.Exemptions {
+		exemption := &policy.Exemptions[i]
+		for _, cidr := range exemption.Networks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("exemption %s: invalid network %q", exemption.ID, cidr)
+			}
+			compiled.exemptNetworks = append(compiled.exemptNetworks, exemptNetwork{network: network, exemption: exemption})
+		}
+		for _, principal := range exemption.Principals {
+			if _, exists := compiled.exemptPrincipals[principal]; !exists {
+				compiled.exemptPrincipals[principal] = exemption
+			}
+		}
+	}
+
+	// The first rate limit listing a country wins
+	for i := range policy.RateLimits {
+		limit := &policy.RateLimits[i]
+		for _, code := range limit.Countries {
+			if _, exists := compiled.rateLimits[code]; !exists {
+				compiled.rateLimits[code] = limit
+			}
+		}
+	}
+
+	return compiled, nil
+}
+
+// policyVersion hashes a policy's content, so equal policies have the same
+// version in every process
+func policyVersion(policy *Policy) string {
+	data, _ := json.Marshal(policy)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Version identifies the active policy. It changes with every change to the
+// policy and is the same on replicas enforcing the same one.
+func (s *Store) Version() string {
+	return s.current.Load().version
+}
+
+// nextActivation returns the first time after t at which a scheduled rule
+// starts to apply, or the zero time if none will. Decisions made at t may
+// no longer hold from then on, although the Version stays the same.
+func (s *Store) nextActivation(t time.Time) time.Time {
+	var next time.Time
+	for _, match := range s.current.Load().scheduled {
+		if at := match.nextActivation(t); !at.IsZero() && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+// IsBlocked reports whether a country code is blocked right now for every
+// client. Countries matched only by monitor-mode, challenge or conditional
+// rules are not blocked.
+func (s *Store) IsBlocked(countryCode string) bool {
+	match := s.matchAt(countryCode, time.Now(), func(m *Match) bool { return !m.Conditional() })
+	return match != nil && !match.Monitor && !match.Challenges()
+}
+
+// Match returns the rule blocking a country right now, or nil if it is allowed
+func (s *Store) Match(countryCode string) *Match {
+	return s.MatchAt(countryCode, time.Now())
+}
+
+// MatchAt returns the first match for a country that is active at the given
+// time, preferring enforced matches over monitor-mode ones
+func (s *Store) MatchAt(countryCode string, t time.Time) *Match {
+	return s.matchAt(countryCode, t, nil)
+}
+
+// matchAt is MatchAt considering only matches accepted by applies, if set
+func (s *Store) matchAt(countryCode string, t time.Time, applies func(*Match) bool) *Match {
+	var monitored *Match
+	for _, match := range s.current.Load().matches[countryCode] {
+		if !match.activeAt(t) || (applies != nil && !applies(match)) {
+			continue
+		}
+		if !match.Monitor {
+			return match
+		}
+		if monitored == nil {
+			monitored = match
+		}
+	}
+	return monitored
+}
+
+// UsesReputation reports whether any rule depends on the client's reputation score
+func (s *Store) UsesReputation() bool {
+	return s.current.Load().usesReputation
+}
+
+// FailClosedMatch returns the match blocking clients whose location could
+// not be resolved, with the policy's default block response
+func (s *Store) FailClosedMatch() *Match {
+	return s.current.Load().failClosed
+}
+
+// MatchIP returns the rule blocking an IPv4 or IPv6 address by network right
+// now, or nil if no blocked network contains it
+func (s *Store) MatchIP(ip string) *Match {
+	return s.MatchIPAt(ip, time.Now())
+}
+
+// MatchIPAt returns the first network match for an address that is active at
+// the given time, preferring enforced matches over monitor-mode ones
+func (s *Store) MatchIPAt(ip string, t time.Time) *Match {
+	return s.matchIPAt(ip, t, nil)
+}
+
+// matchIPAt is MatchIPAt considering only matches accepted by applies, if set
+func (s *Store) matchIPAt(ip string, t time.Time, applies func(*Match) bool) *Match {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+	var monitored *Match
+	for _, entry := range s.current.Load().networks {
+		if !entry.network.Contains(parsed) || !entry.match.activeAt(t) || (applies != nil && !applies(entry.match)) {
+			continue
+		}
+		if !entry.match.Monitor {
+			return entry.match
+		}
+		if monitored == nil {
+			monitored = entry.match
+		}
+	}
+	return monitored
+}
+
+// Exemption returns the exemption covering an address or an authenticated
+// principal, or nil. Either argument may be empty.
+func (s *Store) Exemption(ip, principal string) *Exemption {
+	current := s.current.Load()
+	if principal != "" {
+		if exemption, ok := current.exemptPrincipals[principal]; ok {
+			return exemption
+		}
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		for _, entry := range current.exemptNetworks {
+			if entry.network.Contains(parsed) {
+				return entry.exemption
+			}
+		}
+	}
+	return nil
+}
+
+// RateLimitFor returns the rate limit for a country, falling back to the "*" limit
+func (s *Store) RateLimitFor(countryCode string) *RateLimit {
+	limits := s.current.Load().rateLimits
+	if limit, ok := limits[countryCode]; ok {
+		return limit
+	}
+	return limits["*"]
+}
+
+// Countries returns every country with a blocking rule, including rules that
+// are outside their time window, rule countries first
+func (s *Store) Countries() []string {
+	return append([]string(nil), s.current.Load().ordered...)
+}
+
+// Policy returns a copy of the active policy for modification
+func (s *Store) Policy() *Policy {
+	return s.current.Load().policy.Clone()
+}
+
+// ReplacePolicy validates and swaps in a new policy without persisting it,
+// returning the previously blocked countries
+func (s *Store) ReplacePolicy(policy *Policy) ([]string, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	compiled, err := s.compile(policy)
+	if err != nil {
+		return nil, err
+	}
+	return s.swap(compiled), nil
+}
+
+// Update applies fn to a copy of the active policy, then validates, persists,
+// and activates the result, returning the previously blocked countries.
+// Nothing is written unless the policy compiles. fn may return
+// ErrNoPolicyChange to leave the policy untouched.
+func (s *Store) Update(fn func(*Policy) error) ([]string, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	policy := s.Policy()
+	if err := fn(policy); err != nil {
+		return nil, err
+	}
+	compiled, err := s.compile(policy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if s.persist != nil {
+		if err := s.persist(policy); err != nil {
+			return nil, fmt.Errorf("failed to save blocking policy: %w", err)
+		}
+	}
+	return s.swap(compiled), nil
+}
+
+// swap activates a compiled snapshot, returning the previously blocked countries
+func (s *Store) swap(compiled *snapshot) []string {
+	previous := s.current.Swap(compiled)
+	return append([]string(nil), previous.ordered...)
+}
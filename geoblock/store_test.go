@@ -0,0 +1,218 @@
+package geoblock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCompiledWindowContains(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	utc := func(hour, minute int) time.Time {
+		return time.Date(2025, time.March, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window DailyWindow
+		at     time.Time
+		want   bool
+	}{
+		{"same-day window, inside", DailyWindow{Start: "09:00", End: "17:00"}, utc(12, 0), true},
+		{"same-day window, at start", DailyWindow{Start: "09:00", End: "17:00"}, utc(9, 0), true},
+		{"same-day window, at end", DailyWindow{Start: "09:00", End: "17:00"}, utc(17, 0), false},
+		{"same-day window, before", DailyWindow{Start: "09:00", End: "17:00"}, utc(8, 59), false},
+		{"wrapping window, before midnight", DailyWindow{Start: "23:00", End: "02:00"}, utc(23, 30), true},
+		{"wrapping window, after midnight", DailyWindow{Start: "23:00", End: "02:00"}, utc(1, 59), true},
+		{"wrapping window, at end", DailyWindow{Start: "23:00", End: "02:00"}, utc(2, 0), false},
+		{"wrapping window, midday", DailyWindow{Start: "23:00", End: "02:00"}, utc(12, 0), false},
+		// 23:30 in New York (EST, UTC-5) is 04:30 UTC the next day
+		{"new york window, local night", DailyWindow{Start: "23:00", End: "02:00", Timezone: "America/New_York"}, time.Date(2025, time.March, 2, 4, 30, 0, 0, time.UTC), true},
+		{"new york window, utc night", DailyWindow{Start: "23:00", End: "02:00", Timezone: "America/New_York"}, utc(23, 30), false},
+		// After the DST change on 2025-03-09, New York is UTC-4
+		{"new york window, daylight time", DailyWindow{Start: "23:00", End: "02:00", Timezone: "America/New_York"}, time.Date(2025, time.March, 10, 3, 30, 0, 0, time.UTC), true},
+		// 20:00 in New York is 01:00 UTC, inside a UTC window
+		{"instant converted to window zone", DailyWindow{Start: "23:00", End: "02:00"}, time.Date(2025, time.March, 1, 20, 0, 0, 0, newYork), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := compileDailyWindow(&tt.window)
+			if err != nil {
+				t.Fatalf("compileDailyWindow: %v", err)
+			}
+			if got := window.contains(tt.at); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.at.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileDailyWindowErrors(t *testing.T) {
+	for _, window := range []DailyWindow{
+		{Start: "9am", End: "17:00"},
+		{Start: "09:00", End: "25:00"},
+		{Start: "09:00", End: "09:00"},
+		{Start: "09:00", End: "17:00", Timezone: "Mars/Olympus_Mons"},
+	} {
+		if _, err := compileDailyWindow(&window); err == nil {
+			t.Errorf("compileDailyWindow(%+v) succeeded, want error", window)
+		}
+	}
+}
+
+func TestMatchActiveAt(t *testing.T) {
+	from := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2025, time.March, 2, 0, 0, 0, 0, time.UTC)
+	window, err := compileDailyWindow(&DailyWindow{Start: "22:00", End: "06:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		match Match
+		at    time.Time
+		want  bool
+	}{
+		{"plain blocklist entry", Match{}, from, true},
+		{"before effective_from", Match{Rule: &Rule{EffectiveFrom: &from}}, from.Add(-time.Second), false},
+		{"at effective_from", Match{Rule: &Rule{EffectiveFrom: &from}}, from, true},
+		{"before effective_until", Match{Rule: &Rule{EffectiveUntil: &until}}, until.Add(-time.Nanosecond), true},
+		{"at effective_until", Match{Rule: &Rule{EffectiveUntil: &until}}, until, false},
+		{"inside period and window", Match{Rule: &Rule{EffectiveFrom: &from, EffectiveUntil: &until}, window: window}, from.Add(23 * time.Hour), true},
+		{"inside period, outside window", Match{Rule: &Rule{EffectiveFrom: &from, EffectiveUntil: &until}, window: window}, from.Add(12 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match.activeAt(tt.at); got != tt.want {
+				t.Errorf("activeAt(%s) = %v, want %v", tt.at.Format(time.RFC3339Nano), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchNextActivation(t *testing.T) {
+	from := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	until := time.Date(2025, time.March, 2, 12, 0, 0, 0, time.UTC)
+	window, err := compileDailyWindow(&DailyWindow{Start: "22:00", End: "06:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		match Match
+		at    time.Time
+		want  time.Time
+	}{
+		{"plain blocklist entry", Match{}, from, time.Time{}},
+		{"before effective_from", Match{Rule: &Rule{EffectiveFrom: &from}}, from.Add(-time.Hour), from},
+		{"after effective_from", Match{Rule: &Rule{EffectiveFrom: &from}}, from.Add(time.Hour), time.Time{}},
+		{"window later today", Match{Rule: &Rule{}, window: window}, from, from.Add(10 * time.Hour)},
+		{"window open, starts again tomorrow", Match{Rule: &Rule{}, window: window}, from.Add(11 * time.Hour), from.Add(34 * time.Hour)},
+		{"effective_from outside the window", Match{Rule: &Rule{EffectiveFrom: &from}, window: window}, from.Add(-time.Hour), from.Add(10 * time.Hour)},
+		{"last window before effective_until", Match{Rule: &Rule{EffectiveUntil: &until}, window: window}, from.Add(11 * time.Hour), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match.nextActivation(tt.at); !got.Equal(tt.want) {
+				t.Errorf("nextActivation(%s) = %s, want %s", tt.at.Format(time.RFC3339), got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestMatchIPAt(t *testing.T) {
+	until := time.Date(2025, time.March, 2, 0, 0, 0, 0, time.UTC)
+	store := NewStore()
+	_, err := store.ReplacePolicy(&Policy{
+		BlockedNetworks: []string{"198.51.100.0/24", "2001:db8::/32"},
+		Rules: []Rule{
+			{ID: "temporary", Networks: []string{"203.0.113.0/24"}, EffectiveUntil: &until},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := until.Add(-time.Hour)
+	tests := []struct {
+		ip      string
+		at      time.Time
+		network string
+		rule    string
+	}{
+		{"198.51.100.20", before, "198.51.100.0/24", ""},
+		{"2001:db8:ffff::1", before, "2001:db8::/32", ""},
+		{"203.0.113.5", before, "203.0.113.0/24", "temporary"},
+		{"203.0.113.5", until, "", ""},
+		{"192.0.2.1", before, "", ""},
+		{"2001:db9::1", before, "", ""},
+		{"not-an-ip", before, "", ""},
+	}
+
+	for _, tt := range tests {
+		match := store.MatchIPAt(tt.ip, tt.at)
+		switch {
+		case tt.network == "" && match != nil:
+			t.Errorf("MatchIPAt(%s) = %s, want no match", tt.ip, match.Network)
+		case tt.network != "" && match == nil:
+			t.Errorf("MatchIPAt(%s) = nil, want %s", tt.ip, tt.network)
+		case match != nil && (match.Network != tt.network || match.RuleID() != tt.rule):
+			t.Errorf("MatchIPAt(%s) = %s/%q, want %s/%q", tt.ip, match.Network, match.RuleID(), tt.network, tt.rule)
+		}
+	}
+}
+
+func TestCompileRejectsUnknownFallback(t *testing.T) {
+	policies := []Policy{
+		{UnknownCountry: "deny"},
+		{Rules: []Rule{{ID: "r", Countries: []string{"RU"}, UnknownCountry: "captcha"}}},
+	}
+	for _, policy := range policies {
+		if _, err := NewStore().ReplacePolicy(&policy); err == nil {
+			t.Errorf("ReplacePolicy(%+v) accepted an invalid fallback", policy)
+		}
+	}
+}
+
+func TestRuleCountryGroups(t *testing.T) {
+	store := NewStore()
+	policy := &Policy{
+		CountryGroups: []CountryGroup{{ID: "high-risk", Countries: []string{"KP", "IR"}}},
+		Rules: []Rule{
+			{ID: "gulf", Countries: []string{"IR"}, Groups: []string{"gcc", "high-risk"}},
+		},
+	}
+	if _, err := store.ReplacePolicy(policy); err != nil {
+		t.Fatalf("ReplacePolicy: %v", err)
+	}
+	for code, want := range map[string]bool{"SA": true, "QA": true, "KP": true, "IR": true, "DE": false} {
+		if got := store.IsBlocked(code); got != want {
+			t.Errorf("IsBlocked(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if got, want := store.Countries(), []string{"IR", "AE", "BH", "KW", "OM", "QA", "SA", "KP"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Countries() = %v, want %v", got, want)
+	}
+
+	except := &Policy{Rules: []Rule{{ID: "gulf", Groups: []string{"gcc"}, ExceptCountries: []string{"AE", "QA"}}}}
+	if _, err := store.ReplacePolicy(except); err != nil {
+		t.Fatalf("ReplacePolicy: %v", err)
+	}
+	if got, want := store.Countries(), []string{"BH", "KW", "OM", "SA"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Countries() with exceptions = %v, want %v", got, want)
+	}
+
+	unknown := &Policy{Rules: []Rule{{ID: "r", Groups: []string{"mercosur"}}}}
+	if _, err := store.ReplacePolicy(unknown); err == nil {
+		t.Error("ReplacePolicy accepted a rule with an unknown group")
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Geocoding problems reported as address issues
+const (
+	geocodeMismatch    = "geocoded to another country"
+	geocodeNotFound    = "address not found"
+	geocodePlaceholder = "placeholder address"
+)
+
+// GeocodeQuery is the part of an address checked against its country. With
+// Country set, only that country is searched.
+type GeocodeQuery struct {
+	City    string
+	Zip     string
+	Country string
+}
+
+// Geocoder finds the country an address's city and zip belong to
+type Geocoder interface {
+	Name() string
+	// Locate returns the ISO country code of the best match, or "" if nothing matches
+	Locate(ctx context.Context, query GeocodeQuery) (string, error)
+}
+
+// withoutURL drops the request URL from an HTTP client error, since geocoder
+// URLs can carry an API key
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// Nominatim geocodes with OpenStreetMap's Nominatim, at most one request per
+// interval as its usage policy requires
+type Nominatim struct {
+	client   *http.Client
+	endpoint string
+	email    string
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewNominatim creates a geocoder for a Nominatim server such as
+// https://nominatim.openstreetmap.org; email identifies heavy users to its operators
+func NewNominatim(endpoint, email string, interval, timeout time.Duration) *Nominatim {
+	return &Nominatim{client: newHTTPClient(timeout), endpoint: strings.TrimRight(endpoint, "/"), email: email, interval: interval}
+}
+
+func (n *Nominatim) Name() string { return "nominatim" }
+
+// wait holds a request until interval has passed since the previous one
+func (n *Nominatim) wait(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if delay := time.Until(n.last.Add(n.interval)); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	n.last = time.Now()
+	return nil
+}
+
+func (n *Nominatim) Locate(ctx context.Context, query GeocodeQuery) (string, error) {
+	params := url.Values{"format": {"jsonv2"}, "addressdetails": {"1"}, "limit": {"1"}}
+	if query.City != "" {
+		params.Set("city", query.City)
+	}
+	if query.Zip != "" {
+		params.Set("postalcode", query.Zip)
+	}
+	if query.Country != "" {
+		params.Set("countrycodes", strings.ToLower(query.Country))
+	}
+	if n.email != "" {
+		params.Set("email", n.email)
+	}
+	if err := n.wait(ctx); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", n.endpoint+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "shopify-customers-geoblock")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("nominatim request failed: %w", withoutURL(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("nominatim returned status %d", resp.StatusCode)
+	}
+
+	var places []struct {
+		Address struct {
+			CountryCode string `json:"country_code"`
+		} `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&places); err != nil {
+		return "", fmt.Errorf("failed to parse nominatim response: %w", err)
+	}
+	if len(places) == 0 {
+		return "", nil
+	}
+	return strings.ToUpper(places[0].Address.CountryCode), nil
+}
+
+// GoogleGeocoder geocodes with the Google Maps Geocoding API
+type GoogleGeocoder struct {
+	client   *http.Client
+	key      string
+	endpoint string
+}
+
+// NewGoogleGeocoder creates a geocoder using a Google Maps API key
+func NewGoogleGeocoder(key string, timeout time.Duration) *GoogleGeocoder {
+	return &GoogleGeocoder{client: newHTTPClient(timeout), key: key, endpoint: "https://maps.googleapis.com/maps/api/geocode/json"}
+}
+
+func (g *GoogleGeocoder) Name() string { return "google" }
+
+func (g *GoogleGeocoder) Locate(ctx context.Context, query GeocodeQuery) (string, error) {
+	// The API takes its key in the URL, which is why errors are stripped of it
+	params := url.Values{"key": {g.key}}
+	var components []string
+	if query.Zip != "" {
+		components = append(components, "postal_code:"+query.Zip)
+	}
+	if query.Country != "" {
+		components = append(components, "country:"+query.Country)
+	}
+	if query.City != "" {
+		params.Set("address", query.City)
+	}
+	if len(components) > 0 {
+		params.Set("components", strings.Join(components, "|"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", g.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", withoutURL(err)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("google geocoding request failed: %w", withoutURL(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("google geocoding returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Status  string `json:"status"`
+		Results []struct {
+			AddressComponents []struct {
+				ShortName string   `json:"short_name"`
+				Types     []string `json:"types"`
+			} `json:"address_components"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse google geocoding response: %w", err)
+	}
+	switch result.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return "", nil
+	default:
+		return "", fmt.Errorf("google geocoding returned %s", result.Status)
+	}
+	for _, component := range result.Results[0].AddressComponents {
+		if slices.Contains(component.Types, "country") {
+			return strings.ToUpper(component.ShortName), nil
+		}
+	}
+	return "", nil
+}
+
+// geocoder verifies addresses for fetches with verify_addresses; nil unless
+// GEOCODER is nominatim or google
+var geocoder = newGeocoder()
+
+// maxGeocodeLookups bounds the lookups of one fetch, from GEOCODE_MAX_LOOKUPS
+var maxGeocodeLookups = getEnvInt("GEOCODE_MAX_LOOKUPS", 1000)
+
+func newGeocoder() Geocoder {
+	timeout := getEnvDuration("GEOCODE_TIMEOUT", 5*time.Second)
+	switch name := strings.ToLower(getEnv("GEOCODER", "")); name {
+	case "":
+		return nil
+	case "nominatim":
+		return NewNominatim(getEnv("NOMINATIM_URL", "https://nominatim.openstreetmap.org"), getEnv("NOMINATIM_EMAIL", ""),
+			getEnvDuration("NOMINATIM_INTERVAL", time.Second), timeout)
+	case "google":
+		key := getEnv("GOOGLE_GEOCODING_API_KEY", "")
+		if key == "" {
+			fmt.Println("⚠️  GEOCODER=google needs GOOGLE_GEOCODING_API_KEY; address verification is off")
+			return nil
+		}
+		return NewGoogleGeocoder(key, timeout)
+	default:
+		fmt.Printf("⚠️  Unknown GEOCODER %q: use nominatim or google; address verification is off\n", name)
+		return nil
+	}
+}
+
+// placeholderValues are city and zip values that are clearly not real
+var placeholderValues = map[string]bool{
+	"test": true, "testing": true, "none": true, "n/a": true, "na": true, "null": true,
+	"unknown": true, "asdf": true, "qwerty": true, "xxx": true, "abc": true, "-": true, ".": true,
+}
+
+// isPlaceholder reports whether a city or zip is a placeholder such as
+// "test" or a run of one repeated character such as "00000"
+func isPlaceholder(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if placeholderValues[value] {
+		return true
+	}
+	if len(value) < 3 {
+		return false
+	}
+	return strings.Count(value, value[:1]) == len(value)
+}
+
+// addressVerifier checks addresses with a geocoder, remembering answers so
+// repeated cities and zips are looked up once, and stops after maxLookups
+type addressVerifier struct {
+	geocoder   Geocoder
+	maxLookups int
+	lookups    int
+	skipped    int
+	failures   int
+	answers    map[GeocodeQuery]string
+}
+
+// locate looks up a query, reporting false once the lookup budget is spent or the lookup failed
+func (v *addressVerifier) locate(ctx context.Context, query GeocodeQuery) (string, bool) {
+	if country, ok := v.answers[query]; ok {
+		return country, true
+	}
+	if v.lookups >= v.maxLookups {
+		return "", false
+	}
+	v.lookups++
+	country, err := v.geocoder.Locate(ctx, query)
+	if err != nil {
+		v.failures++
+		if v.failures == 1 {
+			fmt.Printf("⚠️  Geocoding with %s failed: %v\n", v.geocoder.Name(), err)
+		}
+		return "", false
+	}
+	v.answers[query] = country
+	return country, true
+}
+
+// verify checks that an address's city and zip are in its country, returning
+// an issue if they are placeholders, lie elsewhere or cannot be found
+func (v *addressVerifier) verify(ctx context.Context, addr Address) *AddressIssue {
+	city, zip, claimed := strings.TrimSpace(addr.City), strings.TrimSpace(addr.Zip), addr.CountryCode
+	if claimed == "" || (city == "" && zip == "") {
+		return nil
+	}
+	values := map[string]string{"city": city, "zip": zip}
+	issue := &AddressIssue{AddressID: addr.ID, Values: values, Resolved: claimed}
+	if (city != "" && isPlaceholder(city)) || (zip != "" && isPlaceholder(zip)) {
+		issue.Problem = geocodePlaceholder
+		return issue
+	}
+
+	query := GeocodeQuery{City: city, Zip: zip, Country: claimed}
+	inClaimed, ok := v.locate(ctx, query)
+	if !ok {
+		v.skipped++
+		return nil
+	}
+	if inClaimed != "" {
+		return nil
+	}
+	query.Country = ""
+	elsewhere, ok := v.locate(ctx, query)
+	switch {
+	case !ok:
+		v.skipped++
+		return nil
+	case elsewhere == "" || elsewhere == claimed:
+		issue.Problem = geocodeNotFound
+	default:
+		issue.Problem = geocodeMismatch
+		values["geocoded_country"] = elsewhere
+	}
+	return issue
+}
+
+// verifyCustomerAddresses adds an address issue for every address whose city
+// and zip do not belong to its country. customerCountries must be
+// extractCountryCodes(customers), in the same order.
+func verifyCustomerAddresses(ctx context.Context, g Geocoder, customers []Customer, customerCountries []CustomerCountry, progress func(JobProgress)) {
+	verifier := &addressVerifier{geocoder: g, maxLookups: maxGeocodeLookups, answers: make(map[GeocodeQuery]string)}
+	flagged := 0
+	for i := range customers {
+		customer := customers[i]
+		normalizeCustomerAddresses(&customer)
+		for _, addr := range customer.Addresses {
+			if issue := verifier.verify(ctx, addr); issue != nil {
+				customerCountries[i].AddressIssues = append(customerCountries[i].AddressIssues, *issue)
+				flagged++
+			}
+		}
+		if (i+1)%100 == 0 {
+			progress(JobProgress{CustomersProcessed: i + 1, Message: fmt.Sprintf("Verified addresses of %d customers", i+1)})
+		}
+	}
+	fmt.Printf("🗺️  Verified addresses with %s: %d lookups, %d flagged, %d unverified\n", g.Name(), verifier.lookups, flagged, verifier.skipped)
+}
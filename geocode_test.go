@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGeocoder knows where a few city and zip pairs are
+type fakeGeocoder struct {
+	places map[string]string
+	err    error
+	calls  int
+}
+
+func (f *fakeGeocoder) Name() string { return "fake" }
+
+func (f *fakeGeocoder) Locate(ctx context.Context, query GeocodeQuery) (string, error) {
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	country := f.places[query.City+"|"+query.Zip]
+	if query.Country != "" && country != query.Country {
+		return "", nil
+	}
+	return country, nil
+}
+
+func TestAddressVerifier(t *testing.T) {
+	geocoder := &fakeGeocoder{places: map[string]string{"Berlin|10115": "DE", "Paris|75001": "FR"}}
+
+	tests := []struct {
+		name         string
+		addr         Address
+		wantProblem  string
+		wantGeocoded string
+	}{
+		{"in its country", Address{City: "Berlin", Zip: "10115", CountryCode: "DE"}, "", ""},
+		{"in another country", Address{City: "Paris", Zip: "75001", CountryCode: "DE"}, geocodeMismatch, "FR"},
+		{"nowhere", Address{City: "Atlantis", Zip: "00001", CountryCode: "DE"}, geocodeNotFound, ""},
+		{"placeholder city", Address{City: "test", Zip: "10115", CountryCode: "DE"}, geocodePlaceholder, ""},
+		{"repeated zip", Address{City: "Berlin", Zip: "99999", CountryCode: "DE"}, geocodePlaceholder, ""},
+		{"no city or zip", Address{CountryCode: "DE"}, "", ""},
+		{"no country", Address{City: "Berlin", Zip: "10115"}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &addressVerifier{geocoder: geocoder, maxLookups: 10, answers: make(map[GeocodeQuery]string)}
+			issue := verifier.verify(context.Background(), tt.addr)
+			if tt.wantProblem == "" {
+				if issue != nil {
+					t.Fatalf("issue = %+v, want none", issue)
+				}
+				return
+			}
+			if issue == nil || issue.Problem != tt.wantProblem || issue.Values["geocoded_country"] != tt.wantGeocoded || issue.Resolved != tt.addr.CountryCode {
+				t.Errorf("issue = %+v, want %q geocoded to %q", issue, tt.wantProblem, tt.wantGeocoded)
+			}
+		})
+	}
+}
+
+func TestAddressVerifierBudgetAndFailures(t *testing.T) {
+	geocoder := &fakeGeocoder{places: map[string]string{"Berlin|10115": "DE"}}
+	verifier := &addressVerifier{geocoder: geocoder, maxLookups: 1, answers: make(map[GeocodeQuery]string)}
+	berlin := Address{City: "Berlin", Zip: "10115", CountryCode: "DE"}
+
+	for i := 0; i < 3; i++ {
+		if issue := verifier.verify(context.Background(), berlin); issue != nil {
+			t.Fatalf("issue = %+v, want none", issue)
+		}
+	}
+	if geocoder.calls != 1 {
+		t.Errorf("geocoder called %d times, want 1 for a repeated address", geocoder.calls)
+	}
+	if issue := verifier.verify(context.Background(), Address{City: "Paris", Zip: "75001", CountryCode: "FR"}); issue != nil || verifier.skipped != 1 {
+		t.Errorf("over budget: issue %+v, skipped %d; want unverified", issue, verifier.skipped)
+	}
+
+	failing := &addressVerifier{geocoder: &fakeGeocoder{err: errors.New("down")}, maxLookups: 10, answers: make(map[GeocodeQuery]string)}
+	if issue := failing.verify(context.Background(), berlin); issue != nil || failing.skipped != 1 {
+		t.Errorf("failed lookup: issue %+v, skipped %d; want unverified", issue, failing.skipped)
+	}
+}
+
+func TestGeocoderProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/search" && query.Get("postalcode") == "10115" && query.Get("countrycodes") != "fr":
+			w.Write([]byte(`[{"address": {"country_code": "de"}}]`))
+		case r.URL.Path == "/search":
+			w.Write([]byte(`[]`))
+		case query.Get("key") != "google-key":
+			w.Write([]byte(`{"status": "REQUEST_DENIED"}`))
+		case strings.Contains(query.Get("components"), "postal_code:10115") && !strings.Contains(query.Get("components"), "country:FR"):
+			w.Write([]byte(`{"status": "OK", "results": [{"address_components": [
+				{"short_name": "Berlin", "types": ["locality"]}, {"short_name": "DE", "types": ["country", "political"]}]}]}`))
+		default:
+			w.Write([]byte(`{"status": "ZERO_RESULTS", "results": []}`))
+		}
+	}))
+	defer server.Close()
+
+	google := NewGoogleGeocoder("google-key", time.Second)
+	google.endpoint = server.URL + "/geocode"
+	deniedGoogle := NewGoogleGeocoder("wrong-key", time.Second)
+	deniedGoogle.endpoint = server.URL + "/geocode"
+
+	for _, g := range []Geocoder{NewNominatim(server.URL, "", 0, time.Second), google} {
+		t.Run(g.Name(), func(t *testing.T) {
+			tests := []struct {
+				query GeocodeQuery
+				want  string
+			}{
+				{GeocodeQuery{City: "Berlin", Zip: "10115"}, "DE"},
+				{GeocodeQuery{City: "Berlin", Zip: "10115", Country: "DE"}, "DE"},
+				{GeocodeQuery{City: "Berlin", Zip: "10115", Country: "FR"}, ""},
+				{GeocodeQuery{City: "Atlantis", Zip: "00001"}, ""},
+			}
+			for _, tt := range tests {
+				if got, err := g.Locate(context.Background(), tt.query); got != tt.want || err != nil {
+					t.Errorf("Locate(%+v) = %q, %v; want %q", tt.query, got, err, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, err := deniedGoogle.Locate(context.Background(), GeocodeQuery{City: "Berlin"}); err == nil || strings.Contains(err.Error(), "wrong-key") {
+		t.Errorf("denied Locate error = %v, want an error without the key", err)
+	}
+}
+
+func TestIsPlaceholder(t *testing.T) {
+	for value, want := range map[string]bool{"test": true, " N/A ": true, "00000": true, "aaa": true, "10115": false, "Berlin": false, "11": false} {
+		if got := isPlaceholder(value); got != want {
+			t.Errorf("isPlaceholder(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
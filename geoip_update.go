@@ -0,0 +1,238 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// geoipDownloadTimeout bounds one database download; a country edition is a
+// few megabytes
+const geoipDownloadTimeout = 5 * time.Minute
+
+// errGeoIPNotModified is returned when the published edition is not newer
+// than the local database
+var errGeoIPNotModified = errors.New("database is up to date")
+
+// GeoIPUpdateStatus reports the background updater's last check and update
+type GeoIPUpdateStatus struct {
+	Enabled    bool   `json:"enabled"`
+	Edition    string `json:"edition,omitempty"`
+	Interval   string `json:"interval,omitempty"`
+	LastCheck  string `json:"last_check,omitempty"`
+	LastUpdate string `json:"last_update,omitempty"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// geoipUpdater downloads new editions of the MaxMind database, validates
+// them and swaps them in. MAXMIND_ACCOUNT_ID and MAXMIND_LICENSE_KEY
+// authenticate downloads of MAXMIND_EDITION_ID every GEOIP_UPDATE_INTERVAL.
+type geoipUpdater struct {
+	edition   string
+	url       string
+	accountID string
+	key       string
+	interval  time.Duration
+	client    *http.Client
+
+	mu         sync.Mutex
+	lastCheck  time.Time
+	lastUpdate time.Time
+	lastError  string
+}
+
+var geoIPUpdater = newGeoIPUpdater()
+
+// newGeoIPUpdater returns nil unless a license key is configured
+func newGeoIPUpdater() *geoipUpdater {
+	key := getEnv("MAXMIND_LICENSE_KEY", "")
+	if key == "" {
+		return nil
+	}
+	edition := getEnv("MAXMIND_EDITION_ID", "GeoLite2-Country")
+	return &geoipUpdater{
+		edition:   edition,
+		url:       getEnv("MAXMIND_DOWNLOAD_URL", "https://download.maxmind.com/geoip/databases/"+edition+"/download?suffix=tar.gz"),
+		accountID: getEnv("MAXMIND_ACCOUNT_ID", ""),
+		key:       key,
+		interval:  getEnvDuration("GEOIP_UPDATE_INTERVAL", 24*time.Hour),
+		client:    newHTTPClient(geoipDownloadTimeout),
+	}
+}
+
+// Update downloads the edition if it is newer than the file at path,
+// validates it and moves it into place. It returns errGeoIPNotModified when
+// there is nothing to do; on any other error path is left untouched.
+func (u *geoipUpdater) Update(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid MAXMIND_DOWNLOAD_URL: %w", err)
+	}
+	req.SetBasicAuth(u.accountID, u.key)
+	if info, err := os.Stat(path); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", u.edition, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return errGeoIPNotModified
+	case http.StatusUnauthorized:
+		return fmt.Errorf("MaxMind rejected MAXMIND_ACCOUNT_ID and MAXMIND_LICENSE_KEY")
+	default:
+		return fmt.Errorf("MaxMind download returned status %d", resp.StatusCode)
+	}
+
+	// Write next to the target so the final rename is atomic
+	temp, err := os.CreateTemp(filepath.Dir(path), ".geoip-*.mmdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if err := extractMMDB(resp.Body, temp); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	metadata, err := geoblock.ValidateMaxMind(temp.Name())
+	if err != nil {
+		return fmt.Errorf("downloaded database rejected: %w", err)
+	}
+	if current, err := geoblock.ValidateMaxMind(path); err == nil && metadata.BuildEpoch < current.BuildEpoch {
+		return fmt.Errorf("downloaded database is older than the one in use")
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(temp.Name(), modified, modified)
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// extractMMDB copies the .mmdb file out of a MaxMind tar.gz archive
+func extractMMDB(archive io.Reader, out io.Writer) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("download is not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	files := tar.NewReader(gz)
+	for {
+		header, err := files.Next()
+		if err == io.EOF {
+			return fmt.Errorf("download has no .mmdb file")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && strings.HasSuffix(header.Name, ".mmdb") {
+			_, err := io.Copy(out, files)
+			return err
+		}
+	}
+}
+
+// run checks for a new edition and reloads the provider when one was
+// installed
+func (u *geoipUpdater) run(mm *geoblock.MaxMind) {
+	ctx, cancel := context.WithTimeout(context.Background(), geoipDownloadTimeout)
+	defer cancel()
+
+	err := u.Update(ctx, mm.Path())
+	if err == nil {
+		err = mm.Reload()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.lastCheck = time.Now()
+	switch {
+	case errors.Is(err, errGeoIPNotModified):
+		u.lastError = ""
+	case err != nil:
+		u.lastError = err.Error()
+		fmt.Printf("⚠️  GeoIP update failed, keeping the current database: %v\n", err)
+	default:
+		u.lastError = ""
+		u.lastUpdate = u.lastCheck
+		blocker.ClearDecisions()
+		fmt.Printf("🗺️  Installed new %s database built %s\n", u.edition, time.Unix(int64(mm.Metadata().BuildEpoch), 0).UTC().Format(time.RFC3339))
+	}
+}
+
+// Status reports the updater's configuration and last results
+func (u *geoipUpdater) Status() GeoIPUpdateStatus {
+	if u == nil {
+		return GeoIPUpdateStatus{}
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	status := GeoIPUpdateStatus{Enabled: true, Edition: u.edition, Interval: u.interval.String(), LastError: u.lastError}
+	if !u.lastCheck.IsZero() {
+		status.LastCheck = u.lastCheck.Format(time.RFC3339)
+	}
+	if !u.lastUpdate.IsZero() {
+		status.LastUpdate = u.lastUpdate.Format(time.RFC3339)
+	}
+	return status
+}
+
+// installMissingGeoIPDatabase downloads the database when the file does not
+// exist yet, so a fresh deployment only needs a license key. It reports
+// whether a database was installed.
+func installMissingGeoIPDatabase(path string) bool {
+	if geoIPUpdater == nil || offlineMode {
+		return false
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), geoipDownloadTimeout)
+	defer cancel()
+	fmt.Printf("🗺️  Downloading %s to %s\n", geoIPUpdater.edition, path)
+	if err := geoIPUpdater.Update(ctx, path); err != nil {
+		fmt.Printf("⚠️  Could not download %s: %v\n", geoIPUpdater.edition, err)
+		return false
+	}
+	return true
+}
+
+// startGeoIPUpdater periodically updates the MaxMind database in the
+// provider chain, if there is one and a license key is configured
+func startGeoIPUpdater() {
+	if geoIPUpdater == nil || offlineMode || geoIPUpdater.interval <= 0 {
+		return
+	}
+	for _, provider := range geoResolver.Providers() {
+		if mm, ok := provider.(*geoblock.MaxMind); ok {
+			go func() {
+				ticker := time.NewTicker(geoIPUpdater.interval)
+				defer ticker.Stop()
+				for {
+					geoIPUpdater.run(mm)
+					<-ticker.C
+				}
+			}()
+			return
+		}
+	}
+	fmt.Println("⚠️  MAXMIND_LICENSE_KEY is set but no maxmind geo provider is configured; the GeoIP updater is off")
+}
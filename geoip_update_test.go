@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarGz packs files into a MaxMind-style tar.gz archive
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		archive.Write([]byte(content))
+	}
+	archive.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestExtractMMDB(t *testing.T) {
+	data := tarGz(t, map[string]string{
+		"GeoLite2-Country_20260101/LICENSE.txt":           "license",
+		"GeoLite2-Country_20260101/GeoLite2-Country.mmdb": "database",
+	})
+	var out bytes.Buffer
+	if err := extractMMDB(bytes.NewReader(data), &out); err != nil || out.String() != "database" {
+		t.Errorf("extractMMDB = %q, %v, want the .mmdb file", out.String(), err)
+	}
+
+	if err := extractMMDB(bytes.NewReader(tarGz(t, map[string]string{"README": "x"})), &out); err == nil {
+		t.Error("an archive without a .mmdb file should be rejected")
+	}
+}
+
+func TestGeoIPUpdaterUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	if err := os.WriteFile(path, []byte("current"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotAuth, gotSince string
+	archive := tarGz(t, map[string]string{"GeoLite2-Country.mmdb": "not a real database"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, key, _ := r.BasicAuth()
+		gotAuth, gotSince = user+":"+key, r.Header.Get("If-Modified-Since")
+		if r.URL.Query().Get("edition") == "unchanged" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	updater := &geoipUpdater{edition: "GeoLite2-Country", url: server.URL, accountID: "42", key: "license", client: server.Client()}
+	err := updater.Update(context.Background(), path)
+	if err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("Update with an invalid database = %v, want it rejected", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "current" {
+		t.Errorf("database = %q, want the current one kept", data)
+	}
+	if gotAuth != "42:license" {
+		t.Errorf("credentials = %q, want account ID and license key", gotAuth)
+	}
+	if _, err := http.ParseTime(gotSince); err != nil {
+		t.Errorf("If-Modified-Since = %q, want the local file's time", gotSince)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("%d files left, want the temporary download removed", len(entries))
+	}
+
+	updater.url = server.URL + "?edition=unchanged"
+	if err := updater.Update(context.Background(), path); !errors.Is(err, errGeoIPNotModified) {
+		t.Errorf("Update of an unchanged edition = %v, want errGeoIPNotModified", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// readinessCacheTTL limits how often /readyz calls out to external dependencies,
+// since probes run every few seconds and geo lookups count against provider quotas
+const readinessCacheTTL = 15 * time.Second
+
+// readinessCheckTimeout is the deadline for each dependency check
+const readinessCheckTimeout = 5 * time.Second
+
+// healthGeoProbeIP is resolved to check that the geo provider chain answers
+var healthGeoProbeIP = getEnv("HEALTH_GEO_PROBE_IP", "8.8.8.8")
+
+// serverStartedAt is reported as uptime by the health endpoints
+var serverStartedAt = time.Now()
+
+// HealthCheck is the result of checking one dependency. Only critical
+// failures make the server unready; others report it as degraded.
+type HealthCheck struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt string `json:"checked_at"`
+}
+
+type HealthResponse struct {
+	Status    string        `json:"status"`
+	Uptime    string        `json:"uptime"`
+	Checks    []HealthCheck `json:"checks,omitempty"`
+	CheckedAt string        `json:"checked_at"`
+}
+
+// dependencyCheck is a named readiness check
+type dependencyCheck struct {
+	name     string
+	critical bool
+	run      func(ctx context.Context) error
+}
+
+// errCheckSkipped marks a dependency that is not configured
+var errCheckSkipped = errors.New("not configured")
+
+// readinessChecks are run by /readyz. Only local dependencies are critical:
+// a failing geolocation provider is shared by every replica, and blocking
+// fails open without it, so taking them all out of rotation would not help.
+var readinessChecks = []dependencyCheck{
+	{name: "storage", critical: true, run: checkPolicyStorage},
+	{name: "postgres", critical: true, run: checkPostgres},
+	{name: "geo_provider", critical: false, run: checkGeoProvider},
+	{name: "shopify", critical: false, run: checkShopify},
+	{name: "redis", critical: false, run: checkRedis},
+}
+
+var readinessCache struct {
+	sync.Mutex
+	response  HealthResponse
+	checkedAt time.Time
+}
+
+// checkPolicyStorage verifies the policy file is readable and its directory writable
+func checkPolicyStorage(ctx context.Context) error {
+	if _, err := os.Stat(policyFilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("policy file %s: %w", policyFilePath, err)
+	}
+
+	probe, err := os.CreateTemp(filepath.Dir(policyFilePath), ".healthz-*")
+	if err != nil {
+		return fmt.Errorf("policy directory is not writable: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// checkGeoProvider resolves a well-known public IP through the provider chain
+func checkGeoProvider(ctx context.Context) error {
+	if len(geoResolver.Providers()) == 0 {
+		return fmt.Errorf("no geolocation providers configured")
+	}
+	_, err := geoResolver.Lookup(ctx, healthGeoProbeIP)
+	return err
+}
+
+// checkShopify calls the shop endpoint of the Admin API with the configured token
+func checkShopify(ctx context.Context) error {
+	if shopifyAccessToken == "" || offlineMode {
+		return errCheckSkipped
+	}
+	return pingShopify(ctx, shopifyAccessToken)
+}
+
+// pingShopify calls the shop endpoint of the Admin API with a token
+func pingShopify(ctx context.Context, token string) error {
+	if offlineMode {
+		return errShopifyOffline
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", shopifyAdminBaseURL()+"/shop.json", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Shopify-Access-Token", token)
+	req.Header.Set("Accept", "application/json")
+
+	client := newHTTPClient(5 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Shopify unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Shopify returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runReadinessChecks runs every dependency check concurrently, each with its
+// own deadline. The result is shared between probes, so it does not depend
+// on any one probe's request staying connected.
+func runReadinessChecks() HealthResponse {
+	checks := make([]HealthCheck, len(readinessChecks))
+
+	var wg sync.WaitGroup
+	for i, check := range readinessChecks {
+		wg.Add(1)
+		go func(i int, check dependencyCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), readinessCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.run(ctx)
+			result := HealthCheck{
+				Name:      check.name,
+				Status:    "ok",
+				Critical:  check.critical,
+				LatencyMs: time.Since(start).Milliseconds(),
+				CheckedAt: start.Format(time.RFC3339),
+			}
+			switch {
+			case errors.Is(err, errCheckSkipped):
+				result.Status = "skipped"
+			case err != nil:
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+			checks[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	status := "ok"
+	for _, check := range checks {
+		if check.Status != "fail" {
+			continue
+		}
+		if check.Critical {
+			status = "unavailable"
+			break
+		}
+		status = "degraded"
+	}
+
+	return HealthResponse{
+		Status:    status,
+		Checks:    checks,
+		CheckedAt: time.Now().Format(time.RFC3339),
+	}
+}
+
+// cachedReadiness returns the last readiness result, re-running the checks once it is stale
+func cachedReadiness() HealthResponse {
+	readinessCache.Lock()
+	defer readinessCache.Unlock()
+
+	if time.Since(readinessCache.checkedAt) > readinessCacheTTL {
+		readinessCache.response = runReadinessChecks()
+		readinessCache.checkedAt = time.Now()
+	}
+	return readinessCache.response
+}
+
+// handleHealthz is the liveness probe: it only reports that the process is serving
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{
+		Status:    "ok",
+		Uptime:    time.Since(serverStartedAt).Round(time.Second).String(),
+		CheckedAt: time.Now().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleReadyz is the readiness probe: it returns 503 while a critical dependency is failing
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	response := cachedReadiness()
+	response.Uptime = time.Since(serverStartedAt).Round(time.Second).String()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if response.Status == "unavailable" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
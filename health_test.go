@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubReadinessChecks replaces the dependency checks for one test, with
+// the cached result cleared before and after
+func stubReadinessChecks(t *testing.T, checks []dependencyCheck) {
+	saved := readinessChecks
+	reset := func() {
+		readinessCache.Lock()
+		readinessCache.response, readinessCache.checkedAt = HealthResponse{}, time.Time{}
+		readinessCache.Unlock()
+	}
+	readinessChecks = checks
+	reset()
+	t.Cleanup(func() {
+		readinessChecks = saved
+		reset()
+	})
+}
+
+func TestHandleHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	var response HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || response.Status != "ok" || response.Uptime == "" {
+		t.Errorf("got %d %+v", w.Code, response)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	skipped := func(ctx context.Context) error { return errCheckSkipped }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name        string
+		postgres    func(context.Context) error
+		redis       func(context.Context) error
+		wantStatus  int
+		wantReady   string
+		wantChecks  map[string]string
+		wantErrorOf string
+	}{
+		{"all ok", ok, ok, http.StatusOK, "ok", map[string]string{"postgres": "ok", "redis": "ok"}, ""},
+		{"not configured", skipped, skipped, http.StatusOK, "ok", map[string]string{"postgres": "skipped", "redis": "skipped"}, ""},
+		{"redis down degrades", ok, failing, http.StatusOK, "degraded", map[string]string{"postgres": "ok", "redis": "fail"}, "redis"},
+		{"database down is not ready", failing, ok, http.StatusServiceUnavailable, "unavailable", map[string]string{"postgres": "fail", "redis": "ok"}, "postgres"},
+		{"both down is not ready", failing, failing, http.StatusServiceUnavailable, "unavailable", map[string]string{"postgres": "fail", "redis": "fail"}, "postgres"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubReadinessChecks(t, []dependencyCheck{
+				{name: "postgres", critical: true, run: tt.postgres},
+				{name: "redis", critical: false, run: tt.redis},
+			})
+			w := httptest.NewRecorder()
+			handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			var response HealthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantStatus || response.Status != tt.wantReady {
+				t.Errorf("got %d %q, want %d %q", w.Code, response.Status, tt.wantStatus, tt.wantReady)
+			}
+			for _, check := range response.Checks {
+				if want := tt.wantChecks[check.Name]; check.Status != want {
+					t.Errorf("%s = %q, want %q", check.Name, check.Status, want)
+				}
+				if check.Name == tt.wantErrorOf && check.Error != "connection refused" {
+					t.Errorf("%s error = %q, want the check's error", check.Name, check.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestReadinessCriticalChecks(t *testing.T) {
+	critical := map[string]bool{"storage": true, "postgres": true}
+	for _, check := range readinessChecks {
+		if check.critical != critical[check.name] {
+			t.Errorf("%s critical = %v, want %v", check.name, check.critical, critical[check.name])
+		}
+	}
+
+	// A geolocation outage degrades readiness without failing it
+	stubReadinessChecks(t, []dependencyCheck{
+		{name: "storage", critical: true, run: func(ctx context.Context) error { return nil }},
+		{name: "geo_provider", critical: false, run: func(ctx context.Context) error { return errors.New("ipinfo: quota exceeded") }},
+	})
+	w := httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	var response HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || response.Status != "degraded" {
+		t.Errorf("got %d %q with the geo provider down, want 200 degraded", w.Code, response.Status)
+	}
+}
+
+func TestReadinessCached(t *testing.T) {
+	runs := 0
+	stubReadinessChecks(t, []dependencyCheck{
+		{name: "postgres", critical: true, run: func(ctx context.Context) error {
+			runs++
+			return nil
+		}},
+	})
+	for i := 0; i < 3; i++ {
+		handleReadyz(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil))
+	}
+	if runs != 1 {
+		t.Errorf("checks ran %d times within the cache TTL, want 1", runs)
+	}
+}
+
+func TestOptionalDependencyChecksSkipped(t *testing.T) {
+	if sharedState != nil || postgresStore != nil {
+		t.Skip("Redis or PostgreSQL configured in the environment")
+	}
+	for name, check := range map[string]func(context.Context) error{"redis": checkRedis, "postgres": checkPostgres} {
+		if err := check(context.Background()); !errors.Is(err, errCheckSkipped) {
+			t.Errorf("%s check without configuration = %v, want skipped", name, err)
+		}
+	}
+}
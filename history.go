@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// maxPolicyVersions bounds the blocklist versions kept for rollback
+const maxPolicyVersions = 200
+
+// policyHistoryFilePath is where every blocklist version is appended, so history survives restarts
+var policyHistoryFilePath = getEnv("BLOCKING_POLICY_HISTORY_FILE", "blocking-policy-history.jsonl")
+
+// PolicyVersion is the blocklist as it was after one change
+type PolicyVersion struct {
+	Version   int              `json:"version"`
+	Timestamp string           `json:"timestamp"`
+	Principal string           `json:"principal"`
+	Action    string           `json:"action"`
+	Before    []string         `json:"before"`
+	After     []string         `json:"after"`
+	Policy    *geoblock.Policy `json:"policy,omitempty"`
+}
+
+// PolicyHistory keeps recent blocklist versions in memory and appends each one to a file
+type PolicyHistory struct {
+	mu       sync.Mutex
+	path     string
+	versions []PolicyVersion
+}
+
+// NewPolicyHistory loads the most recent versions from path; a missing file is an empty history
+func NewPolicyHistory(path string) (*PolicyHistory, error) {
+	history := &PolicyHistory{path: path}
+	if path == "" {
+		return history, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var version PolicyVersion
+		if err := json.Unmarshal(scanner.Bytes(), &version); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		history.append(version)
+	}
+	return history, scanner.Err()
+}
+
+// append adds a version, dropping the oldest beyond maxPolicyVersions. Callers must hold h.mu.
+func (h *PolicyHistory) append(version PolicyVersion) {
+	h.versions = append(h.versions, version)
+	if len(h.versions) > maxPolicyVersions {
+		h.versions = h.versions[len(h.versions)-maxPolicyVersions:]
+	}
+}
+
+// Record stores the policy as a new version unless it equals the latest one
+func (h *PolicyHistory) Record(principal, action string, policy *geoblock.Policy) (PolicyVersion, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	version := PolicyVersion{
+		Version:   1,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Principal: principal,
+		Action:    action,
+		Before:    []string{},
+		After:     append([]string{}, policy.BlockedCountries...),
+		Policy:    policy.Clone(),
+	}
+	if len(h.versions) > 0 {
+		latest := h.versions[len(h.versions)-1]
+		if samePolicy(latest.Policy, version.Policy) {
+			return latest, nil
+		}
+		version.Version = latest.Version + 1
+		version.Before = latest.After
+	}
+
+	if h.path != "" {
+		if err := appendJSONLine(h.path, version); err != nil {
+			return version, fmt.Errorf("failed to save policy history: %w", err)
+		}
+	}
+	h.append(version)
+	return version, nil
+}
+
+// Versions returns the kept versions, oldest first
+func (h *PolicyHistory) Versions() []PolicyVersion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]PolicyVersion(nil), h.versions...)
+}
+
+// Latest returns the most recent version, if any
+func (h *PolicyHistory) Latest() (PolicyVersion, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.versions) == 0 {
+		return PolicyVersion{}, false
+	}
+	return h.versions[len(h.versions)-1], true
+}
+
+// Get returns a kept version by number
+func (h *PolicyHistory) Get(number int) (PolicyVersion, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, version := range h.versions {
+		if version.Version == number {
+			return version, true
+		}
+	}
+	return PolicyVersion{}, false
+}
+
+// samePolicy reports whether two policies serialize identically
+func samePolicy(a, b *geoblock.Policy) bool {
+	left, errA := json.Marshal(a)
+	right, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(left, right)
+}
+
+// appendJSONLine writes value as one line at the end of the file at path
+func appendJSONLine(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// policyHistory records every blocklist version; it starts empty if the history file is unreadable
+var policyHistory = loadPolicyHistory()
+
+func loadPolicyHistory() *PolicyHistory {
+	history, err := NewPolicyHistory(policyHistoryFilePath)
+	if err != nil {
+		fmt.Printf("⚠️  Could not load blocklist history, starting a new one: %v\n", err)
+		history = &PolicyHistory{path: policyHistoryFilePath}
+	}
+	return history
+}
+
+// policyChangeMu keeps history versions in the order their changes were applied
+var policyChangeMu sync.Mutex
+
+// changePrincipal names who made a change; r is nil for changes made by the server itself
+func changePrincipal(r *http.Request) string {
+	if r == nil {
+		return "system"
+	}
+	return principalFromContext(r.Context()).Name
+}
+
+// recordPolicyVersion adds the active policy to the history, logging rather than
+// failing when the history can't be saved, since the change already took effect.
+// A new version is announced to the notification channels and pushed to the
+// storefront.
+func recordPolicyVersion(r *http.Request, action string, policy *geoblock.Policy) PolicyVersion {
+	latest, _ := policyHistory.Latest()
+	version, err := policyHistory.Record(changePrincipal(r), action, policy)
+	if err != nil {
+		fmt.Printf("⚠️  Blocklist version %d not saved to history: %v\n", version.Version, err)
+	}
+	if version.Version != latest.Version {
+		notifier.Notify(blocklistChangedNotification(version))
+	}
+	storefrontSync.Trigger(version.Version)
+	return version
+}
+
+// updatePolicy applies fn to the blocklist like blocklist.Update and records
+// the result as a new version in the blocklist history. Unless forced, a
+// change that would block the caller is refused with errSelfLockout.
+func updatePolicy(r *http.Request, action string, fn func(*geoblock.Policy) error) ([]string, error) {
+	previous, _, err := updatePolicyVersion(r, action, fn)
+	return previous, err
+}
+
+// updatePolicyVersion is updatePolicy, also returning the recorded version
+func updatePolicyVersion(r *http.Request, action string, fn func(*geoblock.Policy) error) ([]string, PolicyVersion, error) {
+	caller, protect := lockoutCaller(r)
+
+	policyChangeMu.Lock()
+	defer policyChangeMu.Unlock()
+
+	var updated *geoblock.Policy
+	previous, err := blocklist.Update(func(policy *geoblock.Policy) error {
+		if err := fn(policy); err != nil {
+			return err
+		}
+		if protect {
+			if err := checkSelfLockout(policy, caller, requestPrincipalName(r)); err != nil {
+				return err
+			}
+		}
+		updated = policy
+		return nil
+	})
+	if err != nil {
+		return nil, PolicyVersion{}, err
+	}
+	return previous, recordPolicyVersion(r, action, updated), nil
+}
+
+type PolicyHistoryResponse struct {
+	Versions []PolicyVersion `json:"versions"`
+	Total    int             `json:"total"`
+}
+
+type RollbackResponse struct {
+	Success     bool     `json:"success"`
+	Message     string   `json:"message"`
+	RestoredTo  int      `json:"restored_to"`
+	NewVersion  int      `json:"new_version"`
+	BlockedFrom []string `json:"blocked_before"`
+	BlockedNow  []string `json:"blocked_after"`
+}
+
+// handlePolicyHistory lists blocklist versions, oldest first, without the full policies
+func handlePolicyHistory(w http.ResponseWriter, r *http.Request) {
+	versions := policyHistory.Versions()
+	for i := range versions {
+		versions[i].Policy = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PolicyHistoryResponse{Versions: versions, Total: len(versions)})
+}
+
+// historyVersion looks up the {version} path parameter, writing an error if it is unknown
+func historyVersion(w http.ResponseWriter, r *http.Request) (PolicyVersion, bool) {
+	number, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("Invalid version %q", r.PathValue("version")), http.StatusBadRequest)
+		return PolicyVersion{}, false
+	}
+	version, ok := policyHistory.Get(number)
+	if !ok {
+		writeError(w, r, fmt.Sprintf("Version %d not found in history", number), http.StatusNotFound)
+	}
+	return version, ok
+}
+
+// handlePolicyVersion returns one blocklist version including its full policy
+func handlePolicyVersion(w http.ResponseWriter, r *http.Request) {
+	version, ok := historyVersion(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version)
+}
+
+// handleRollbackPolicy restores the whole policy of an earlier version. The
+// rollback is itself recorded as a new version, so it can be undone too.
+func handleRollbackPolicy(w http.ResponseWriter, r *http.Request) {
+	target, ok := historyVersion(w, r)
+	if !ok {
+		return
+	}
+
+	previous, latest, err := updatePolicyVersion(r, fmt.Sprintf("rollback-to-%d", target.Version), func(policy *geoblock.Policy) error {
+		*policy = *target.Policy.Clone()
+		if err := normalizePolicy(policy); err != nil {
+			return fmt.Errorf("%w: %v", geoblock.ErrInvalidPolicy, err)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("❌ Rollback to version %d failed: %v\n", target.Version, err)
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "rollback-policy", map[string]interface{}{
+		"to_version": target.Version,
+		"before":     previous,
+		"after":      blocklist.Countries(),
+	})
+	fmt.Printf("⏪ Rolled blocklist back to version %d (now version %d)\n", target.Version, latest.Version)
+
+	response := RollbackResponse{
+		Success:     true,
+		Message:     fmt.Sprintf("Restored blocklist version %d", target.Version),
+		RestoredTo:  target.Version,
+		NewVersion:  latest.Version,
+		BlockedFrom: latest.Before,
+		BlockedNow:  latest.After,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestPolicyHistoryRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	history, err := NewPolicyHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		countries   []string
+		wantVersion int
+		wantBefore  string
+	}{
+		{[]string{"RU"}, 1, ""},
+		{[]string{"RU", "KP"}, 2, "RU"},
+		{[]string{"RU", "KP"}, 2, "RU"},
+		{[]string{}, 3, "RU,KP"},
+	}
+	for _, step := range steps {
+		version, err := history.Record("admin", "block-countries", &geoblock.Policy{BlockedCountries: step.countries})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version.Version != step.wantVersion || strings.Join(version.Before, ",") != step.wantBefore {
+			t.Errorf("Record(%v) = version %d before %v, want version %d before %s",
+				step.countries, version.Version, version.Before, step.wantVersion, step.wantBefore)
+		}
+	}
+
+	reloaded, err := NewPolicyHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, ok := reloaded.Get(2)
+	if !ok || strings.Join(version.Policy.BlockedCountries, ",") != "RU,KP" || version.Principal != "admin" {
+		t.Errorf("reloaded version 2 = %+v, %v", version, ok)
+	}
+	if got := len(reloaded.Versions()); got != 3 {
+		t.Errorf("reloaded %d versions, want 3", got)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxHoneypotHits caps the hits remembered for the honeypot report
+const maxHoneypotHits = 1000
+
+// maxHoneypotBody is how much of a decoy request's body is kept
+const maxHoneypotBody = 4 << 10
+
+// honeypotPaths are decoy routes, e.g. "/wp-login.php,/api/v1/admin/export",
+// that always answer as blocked. HONEYPOT_PATHS is empty by default.
+var honeypotPaths = getEnvList("HONEYPOT_PATHS", "")
+
+// credentialHeaders carry credentials and are never stored with captured requests
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+}
+
+// HoneypotHit is one request to a decoy route. SincePrevious is the time
+// since the client IP's previous hit, to spot scripted scans.
+type HoneypotHit struct {
+	ID            string            `json:"id"`
+	Time          string            `json:"time"`
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	Query         string            `json:"query,omitempty"`
+	ClientIP      string            `json:"client_ip"`
+	Country       string            `json:"country_code"`
+	UserAgent     string            `json:"user_agent,omitempty"`
+	Headers       map[string]string `json:"headers"`
+	Body          string            `json:"body,omitempty"`
+	BodyTruncated bool              `json:"body_truncated,omitempty"`
+	SincePrevious string            `json:"since_previous,omitempty"`
+	IPHits        int               `json:"ip_hits"`
+}
+
+// HoneypotCount is the number of hits for a path, country or client IP
+type HoneypotCount struct {
+	Key  string `json:"key"`
+	Hits int    `json:"hits"`
+}
+
+// HoneypotLog keeps the latest decoy hits and per-IP hit counts
+type HoneypotLog struct {
+	mu     sync.Mutex
+	hits   []HoneypotHit
+	lastAt map[string]time.Time
+	ipHits map[string]int
+}
+
+// NewHoneypotLog creates an empty honeypot log
+func NewHoneypotLog() *HoneypotLog {
+	return &HoneypotLog{lastAt: make(map[string]time.Time), ipHits: make(map[string]int)}
+}
+
+// Record stores a hit, filling in its timing and per-IP count
+func (l *HoneypotLog) Record(hit HoneypotHit, at time.Time) HoneypotHit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if previous, ok := l.lastAt[hit.ClientIP]; ok {
+		hit.SincePrevious = at.Sub(previous).Round(time.Millisecond).String()
+	}
+	l.lastAt[hit.ClientIP] = at
+	l.ipHits[hit.ClientIP]++
+	hit.IPHits = l.ipHits[hit.ClientIP]
+
+	l.hits = append(l.hits, hit)
+	if len(l.hits) > maxHoneypotHits {
+		l.hits = l.hits[len(l.hits)-maxHoneypotHits:]
+		l.forgetIdle()
+	}
+	return hit
+}
+
+// forgetIdle drops timing state of IPs no longer in the log. Callers must hold l.mu.
+func (l *HoneypotLog) forgetIdle() {
+	present := make(map[string]bool, len(l.hits))
+	for _, hit := range l.hits {
+		present[hit.ClientIP] = true
+	}
+	for ip := range l.lastAt {
+		if !present[ip] {
+			delete(l.lastAt, ip)
+			delete(l.ipHits, ip)
+		}
+	}
+}
+
+// HoneypotReport summarizes the remembered hits
+type HoneypotReport struct {
+	Total     int             `json:"total"`
+	Paths     []HoneypotCount `json:"paths"`
+	Countries []HoneypotCount `json:"countries"`
+	ClientIPs []HoneypotCount `json:"client_ips"`
+	Hits      []HoneypotHit   `json:"hits"`
+}
+
+// Report counts hits per path, country and client IP, busiest first, and
+// returns up to limit hits, newest first
+func (l *HoneypotLog) Report(limit int) HoneypotReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths, countries, ips := map[string]int{}, map[string]int{}, map[string]int{}
+	for _, hit := range l.hits {
+		paths[hit.Path]++
+		countries[hit.Country]++
+		ips[hit.ClientIP]++
+	}
+	report := HoneypotReport{
+		Total:     len(l.hits),
+		Paths:     honeypotCounts(paths),
+		Countries: honeypotCounts(countries),
+		ClientIPs: honeypotCounts(ips),
+		Hits:      []HoneypotHit{},
+	}
+	for i := len(l.hits) - 1; i >= 0 && len(report.Hits) < limit; i-- {
+		report.Hits = append(report.Hits, l.hits[i])
+	}
+	return report
+}
+
+// honeypotCounts sorts counts by hits, then key
+func honeypotCounts(counts map[string]int) []HoneypotCount {
+	list := make([]HoneypotCount, 0, len(counts))
+	for key, hits := range counts {
+		list = append(list, HoneypotCount{Key: key, Hits: hits})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Hits != list[j].Hits {
+			return list[i].Hits > list[j].Hits
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// honeypotLog records hits of the configured decoy routes
+var honeypotLog = NewHoneypotLog()
+
+// registerHoneypots serves every HONEYPOT_PATHS entry with handleHoneypot.
+// Invalid paths are skipped, and methods already routed for a path are left
+// to their handlers.
+func registerHoneypots(mux *http.ServeMux) {
+	for _, path := range honeypotPaths {
+		if !strings.HasPrefix(path, "/") {
+			fmt.Printf("⚠️  Ignoring honeypot path %q: must start with /\n", path)
+			continue
+		}
+		if methods := registerHoneypot(mux, path); len(methods) > 0 {
+			fmt.Printf("🍯 Honeypot route %s (%s)\n", path, strings.Join(methods, ", "))
+		}
+	}
+}
+
+// honeypotMethods are answered by decoy routes. Listing them, rather than
+// matching any method, keeps decoys under /api/ from clashing with the CORS
+// preflight route.
+var honeypotMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// registerHoneypot adds a decoy route for every method whose pattern does
+// not conflict with an existing route, returning the methods added
+func registerHoneypot(mux *http.ServeMux, path string) []string {
+	var registered []string
+	for _, method := range honeypotMethods {
+		if err := handleFuncSafely(mux, method+" "+path, handleHoneypot); err != nil {
+			fmt.Printf("⚠️  Honeypot %s %s not added: %v\n", method, path, err)
+			continue
+		}
+		registered = append(registered, method)
+	}
+	return registered
+}
+
+// handleFuncSafely registers a pattern, returning the mux's panic for a
+// conflicting pattern as an error
+func handleFuncSafely(mux *http.ServeMux, pattern string, handler http.HandlerFunc) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%v", recovered)
+		}
+	}()
+	mux.HandleFunc(pattern, handler)
+	return nil
+}
+
+// honeypotHeaders flattens request headers, redacting credentials
+func honeypotHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if credentialHeaders[name] {
+			headers[name] = "[redacted]"
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// handleHoneypot answers every decoy request like a blocked country and
+// records the caller's headers, body and timing. Hits count as blocked
+// requests in the traffic analytics.
+func handleHoneypot(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	geo := resolveRequestGeo(r)
+
+	body, _ := io.ReadAll(io.LimitReader(r.Body, maxHoneypotBody+1))
+	hit := HoneypotHit{
+		ID:            newRequestID(),
+		Time:          now.UTC().Format(time.RFC3339Nano),
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Query:         r.URL.RawQuery,
+		ClientIP:      geo.ClientIP,
+		Country:       geo.Country,
+		UserAgent:     r.UserAgent(),
+		Headers:       honeypotHeaders(r.Header),
+		BodyTruncated: len(body) > maxHoneypotBody,
+	}
+	if hit.BodyTruncated {
+		body = body[:maxHoneypotBody]
+	}
+	if utf8.Valid(body) {
+		hit.Body = string(body)
+	} else {
+		hit.Body = fmt.Sprintf("%q", body)
+	}
+
+	hit = honeypotLog.Record(hit, now)
+	trafficAnalytics.Record(geo.Country, geo.ClientIP, true, false, now)
+	blockingEvents.Publish(BlockingEvent{
+		Time:      now.Format(time.RFC3339Nano),
+		Decision:  "honeypot",
+		ClientIP:  geo.ClientIP,
+		Country:   geo.Country,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		RequestID: requestIDFromContext(r.Context()),
+	})
+	fmt.Printf("🍯 HONEYPOT: %s %s from %s (%s), hit %d from this IP\n", r.Method, r.URL.Path, geo.ClientIP, geo.Country, hit.IPHits)
+
+	// Same shape as the default block response, so decoys look like real blocks
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":        "Country Blocked",
+		"message":      fmt.Sprintf("Access denied: Your country (%s) has been blocked", geo.Country),
+		"country_code": geo.Country,
+		"client_ip":    geo.ActualIP,
+		"detected_via": geo.ClientIP,
+		"blocked_at":   now.Format(time.RFC3339),
+		"reason":       "Geo-blocking policy in effect",
+	})
+}
+
+// handleHoneypotAnalytics reports decoy hits per path, country and client
+// IP with the latest ?limit= hits (default 100)
+func handleHoneypotAnalytics(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, r, fmt.Sprintf("Invalid limit %q: must be a positive integer", value), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(honeypotLog.Report(limit))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHoneypotLog(t *testing.T) {
+	log := NewHoneypotLog()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	first := log.Record(HoneypotHit{Path: "/wp-login.php", ClientIP: "203.0.113.7", Country: "RU"}, start)
+	second := log.Record(HoneypotHit{Path: "/.env", ClientIP: "203.0.113.7", Country: "RU"}, start.Add(1500*time.Millisecond))
+	log.Record(HoneypotHit{Path: "/wp-login.php", ClientIP: "198.51.100.9", Country: "CN"}, start.Add(2*time.Second))
+
+	if first.SincePrevious != "" || first.IPHits != 1 {
+		t.Errorf("first hit = %+v, want no previous and 1 hit", first)
+	}
+	if second.SincePrevious != "1.5s" || second.IPHits != 2 {
+		t.Errorf("second hit = %+v, want 1.5s since previous and 2 hits", second)
+	}
+
+	report := log.Report(2)
+	if report.Total != 3 || len(report.Hits) != 2 || report.Hits[0].ClientIP != "198.51.100.9" {
+		t.Errorf("report = %+v, want 3 hits with the 2 newest listed", report)
+	}
+	if report.Paths[0] != (HoneypotCount{Key: "/wp-login.php", Hits: 2}) || report.ClientIPs[0] != (HoneypotCount{Key: "203.0.113.7", Hits: 2}) {
+		t.Errorf("paths = %v, client IPs = %v", report.Paths, report.ClientIPs)
+	}
+}
+
+func TestHoneypotHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+	header.Set("X-API-Key", "secret")
+	header.Set("Cookie", "session=secret")
+	header.Add("X-Forwarded-For", "203.0.113.7")
+	header.Add("X-Forwarded-For", "10.0.0.1")
+
+	headers := honeypotHeaders(header)
+	for _, name := range []string{"Authorization", "X-Api-Key", "Cookie"} {
+		if headers[name] != "[redacted]" {
+			t.Errorf("%s = %q, want it redacted", name, headers[name])
+		}
+	}
+	if headers["X-Forwarded-For"] != "203.0.113.7, 10.0.0.1" {
+		t.Errorf("X-Forwarded-For = %q", headers["X-Forwarded-For"])
+	}
+}
+
+func TestRegisterHoneypotConflict(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/reload", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("OPTIONS /api/v1/", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/wp-login.php", "/api/v1/admin/export"} {
+		if methods := registerHoneypot(mux, path); len(methods) != len(honeypotMethods) {
+			t.Errorf("decoy %s registered for %v, want every method", path, methods)
+		}
+	}
+	if methods := registerHoneypot(mux, "/api/v1/reload"); strings.Join(methods, ",") != "GET,PUT,PATCH,DELETE" {
+		t.Errorf("decoy clashing with POST registered for %v, want the other methods", methods)
+	}
+}
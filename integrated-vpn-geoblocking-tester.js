@@ -282,7 +282,7 @@ class IntegratedVPNGeoBlockingTester {
         this.log('🔍 Checking API server...', 'info');
         
         try {
-            const response = await this.page.goto(`${this.config.apiUrl}/api/ip-info`, {
+            const response = await this.page.goto(`${this.config.apiUrl}/api/v1/ip-info`, {
                 waitUntil: 'networkidle2',
                 timeout: 10000
             });
@@ -304,7 +304,7 @@ class IntegratedVPNGeoBlockingTester {
     async getCurrentLocation() {
         try {
             const response = await this.page.evaluate(async (apiUrl) => {
-                const resp = await fetch(`${apiUrl}/api/ip-info`);
+                const resp = await fetch(`${apiUrl}/api/v1/ip-info`);
                 if (!resp.ok) throw new Error(`HTTP ${resp.status}`);
                 return await resp.json();
             }, this.config.apiUrl);
@@ -414,7 +414,7 @@ class IntegratedVPNGeoBlockingTester {
     async testAPIAccess() {
         try {
             const response = await this.page.evaluate(async (apiUrl) => {
-                const resp = await fetch(`${apiUrl}/api/test-access`);
+                const resp = await fetch(`${apiUrl}/api/v1/test-access`);
                 const data = await resp.json();
                 return {
                     status: resp.status,
@@ -444,7 +444,7 @@ class IntegratedVPNGeoBlockingTester {
         
         try {
             await this.page.evaluate(async (apiUrl, countriesToBlock) => {
-                const resp = await fetch(`${apiUrl}/api/block-countries`, {
+                const resp = await fetch(`${apiUrl}/api/v1/block-countries`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({ countries: countriesToBlock })
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetRealIP(t *testing.T) {
+	defer func(saved []*net.IPNet, hops int) { trustedProxies, trustedProxyHops = saved, hops }(trustedProxies, trustedProxyHops)
+	trustedProxies, trustedProxyHops = parseTrustedProxies([]string{"10.0.0.0/8"}), 1
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		remote  string
+		want    string
+	}{
+		{"ipv6 remote addr", nil, "[2001:db8::7]:51234", "2001:db8::7"},
+		{"ipv4 remote addr", nil, "203.0.113.7:51234", "203.0.113.7"},
+		{"ipv6 forwarded", map[string]string{"X-Forwarded-For": "2001:db8::9"}, "10.0.0.1:80", "2001:db8::9"},
+		{"rightmost hop", map[string]string{"X-Forwarded-For": "198.51.100.66, 203.0.113.7"}, "10.0.0.1:80", "203.0.113.7"},
+		{"invalid forwarded skipped", map[string]string{"X-Forwarded-For": "garbage", "X-Real-IP": "[2001:db8::5]"}, "10.0.0.1:80", "2001:db8::5"},
+		{"untrusted peer forwarded ignored", map[string]string{"X-Forwarded-For": "8.8.4.4"}, "198.51.100.7:51234", "198.51.100.7"},
+		{"untrusted peer real ip ignored", map[string]string{"X-Real-IP": "8.8.8.8"}, "198.51.100.7:51234", "198.51.100.7"},
+		{"untrusted peer cloudflare ignored", map[string]string{"CF-Connecting-IP": "8.8.8.8"}, "198.51.100.7:51234", "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := getRealIP(req); got != tt.want {
+				t.Errorf("getRealIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxyHopsDefault(t *testing.T) {
+	defer func(saved []*net.IPNet) { trustedProxies = saved }(trustedProxies)
+
+	trustedProxies = nil
+	if got := defaultProxyHops(); got != 0 {
+		t.Errorf("hops without TRUSTED_PROXIES = %d, want 0", got)
+	}
+	trustedProxies = parseTrustedProxies([]string{"10.0.0.0/8"})
+	if got := defaultProxyHops(); got != 1 {
+		t.Errorf("hops with TRUSTED_PROXIES = %d, want 1", got)
+	}
+}
+
+func TestForwardedClient(t *testing.T) {
+	defer func(saved []*net.IPNet) { trustedProxies = saved }(trustedProxies)
+	trustedProxies = parseTrustedProxies([]string{"10.0.0.0/8"})
+
+	// A spoofed entry, the client, a CDN edge and an internal proxy
+	chain := []string{"1.2.3.4", "203.0.113.7", "198.51.100.1", "10.1.2.3"}
+	tests := []struct {
+		hops int
+		want string
+	}{
+		{0, ""},
+		{1, "198.51.100.1"},
+		{2, "198.51.100.1"},
+		{3, "203.0.113.7"},
+		{9, "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		if got := forwardedClient(chain, tt.hops); got != tt.want {
+			t.Errorf("forwardedClient(%d hops) = %q, want %q", tt.hops, got, tt.want)
+		}
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"172.2.0.1", false},
+		{"172.32.0.1", false},
+		{"192.168.1.1", true},
+		{"127.0.0.1", true},
+		{"169.254.1.1", true},
+		{"8.8.8.8", false},
+		{"::1", true},
+		{"fd12:3456::1", true},
+		{"fe80::1", true},
+		{"::", true},
+		{"2001:4860:4860::8888", false},
+		{"not-an-ip", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPrivateIP(tt.ip); got != tt.want {
+			t.Errorf("isPrivateIP(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxJobs bounds how many jobs are remembered; the oldest finished ones are forgotten first
+const maxJobs = 200
+
+// jobQueueSize bounds how many jobs may wait for a worker
+const jobQueueSize = 100
+
+// jobTimeout is the deadline for a job, after which its outbound calls are cancelled
+const jobTimeout = 15 * time.Minute
+
+// errJobQueueFull is returned by Submit when every queue slot is taken
+var errJobQueueFull = errors.New("too many jobs waiting, try again later")
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// JobProgress is what a running job has done so far
+type JobProgress struct {
+	PagesFetched       int    `json:"pages_fetched"`
+	CustomersProcessed int    `json:"customers_processed"`
+	Message            string `json:"message,omitempty"`
+}
+
+// Job is a long-running operation such as a Shopify fetch, run in the background
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Status     JobStatus   `json:"status"`
+	Principal  string      `json:"principal"`
+	Progress   JobProgress `json:"progress"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  string      `json:"created_at"`
+	StartedAt  string      `json:"started_at,omitempty"`
+	FinishedAt string      `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job succeeded or failed
+func (j Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// JobFunc does the work of a job, reporting progress as it goes
+type JobFunc func(ctx context.Context, progress func(JobProgress)) (interface{}, error)
+
+type queuedJob struct {
+	id string
+	fn JobFunc
+}
+
+// JobQueue runs submitted jobs on a fixed number of workers and keeps their
+// status for polling
+type JobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string
+	maxJobs int
+	queue   chan queuedJob
+}
+
+// NewJobQueue starts workers that run jobs from a queue of the given size
+func NewJobQueue(workers, size, maxJobs int) *JobQueue {
+	q := &JobQueue{
+		jobs:    make(map[string]*Job),
+		maxJobs: maxJobs,
+		queue:   make(chan queuedJob, size),
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Submit queues fn as a new job and returns it in the queued state
+func (q *JobQueue) Submit(jobType, principal string, fn JobFunc) (Job, error) {
+	job := &Job{
+		ID:        newRequestID(),
+		Type:      jobType,
+		Status:    JobQueued,
+		Principal: principal,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.queue <- queuedJob{id: job.ID, fn: fn}:
+	default:
+		return Job{}, errJobQueueFull
+	}
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job.ID)
+	q.forget()
+	return *job, nil
+}
+
+// forget drops the oldest finished jobs beyond maxJobs. Callers must hold q.mu.
+func (q *JobQueue) forget() {
+	excess := len(q.order) - q.maxJobs
+	kept := q.order[:0]
+	for _, id := range q.order {
+		if excess > 0 && q.jobs[id].Finished() {
+			delete(q.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	q.order = kept
+}
+
+// Get returns a copy of the job
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Counts returns how many kept jobs are in each status
+func (q *JobQueue) Counts() map[JobStatus]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	counts := make(map[JobStatus]int)
+	for _, job := range q.jobs {
+		counts[job.Status]++
+	}
+	return counts
+}
+
+// Results returns the results of succeeded jobs, oldest first, by job ID
+func (q *JobQueue) Results() ([]string, []interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var ids []string
+	var results []interface{}
+	for _, id := range q.order {
+		if job := q.jobs[id]; job.Status == JobSucceeded && job.Result != nil {
+			ids = append(ids, id)
+			results = append(results, job.Result)
+		}
+	}
+	return ids, results
+}
+
+// RewriteResults replaces the result of every succeeded job for which
+// rewrite reports a change, returning how many were changed. Results must
+// be rewritten into new values, since earlier copies of jobs share them.
+func (q *JobQueue) RewriteResults(rewrite func(result interface{}) (interface{}, bool)) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	changed := 0
+	for _, job := range q.jobs {
+		if job.Status != JobSucceeded || job.Result == nil {
+			continue
+		}
+		if result, ok := rewrite(job.Result); ok {
+			job.Result = result
+			changed++
+		}
+	}
+	return changed
+}
+
+// update changes a job under the lock
+func (q *JobQueue) update(id string, fn func(*Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+func (q *JobQueue) work() {
+	for queued := range q.queue {
+		q.run(queued)
+	}
+}
+
+// run executes one job, turning a panic into a failure so the worker survives
+func (q *JobQueue) run(queued queuedJob) {
+	q.update(queued.id, func(job *Job) {
+		job.Status = JobRunning
+		job.StartedAt = time.Now().Format(time.RFC3339)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	var result interface{}
+	var err error
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("job panicked: %v", recovered)
+			}
+		}()
+		result, err = queued.fn(ctx, func(progress JobProgress) {
+			q.update(queued.id, func(job *Job) { job.Progress = progress })
+		})
+	}()
+
+	q.update(queued.id, func(job *Job) {
+		job.FinishedAt = time.Now().Format(time.RFC3339)
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = JobSucceeded
+		job.Result = result
+	})
+}
+
+// jobs runs the server's background work
+var jobs = NewJobQueue(jobWorkerCount(), jobQueueSize, maxJobs)
+
+// jobWorkerCount reads how many jobs run at the same time from JOB_WORKERS
+func jobWorkerCount() int {
+	value := getEnv("JOB_WORKERS", "4")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		fmt.Printf("⚠️  Invalid JOB_WORKERS %q, using 4\n", value)
+		return 4
+	}
+	return n
+}
+
+// submitJob queues fn for the request's principal and answers 202 Accepted
+// with the job and where to poll it
+func submitJob(w http.ResponseWriter, r *http.Request, jobType string, fn JobFunc) {
+	job, err := jobs.Submit(jobType, changePrincipal(r), fn)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Printf("🧵 Queued %s job %s\n", jobType, job.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleGetJob reports a job's status, progress and, once finished, its
+// result. Customers of a fetch-customers result are filtered and paged as
+// described by parseCustomerQuery.
+func handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobs.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, fmt.Sprintf("Job %q not found", r.PathValue("id")), http.StatusNotFound)
+		return
+	}
+	if report, ok := job.Result.(CustomerResponse); ok {
+		query, err := parseCustomerQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		job.Result = query.Apply(report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
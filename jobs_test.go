@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForJob polls until the job finishes
+func waitForJob(t *testing.T, q *JobQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := q.Get(id); ok && job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobQueue(t *testing.T) {
+	q := NewJobQueue(2, 10, 10)
+	release := make(chan struct{})
+
+	running, err := q.Submit("fetch-customers", "alice", func(ctx context.Context, progress func(JobProgress)) (interface{}, error) {
+		progress(JobProgress{PagesFetched: 1, Message: "Fetched 250 customers"})
+		<-release
+		return "done", nil
+	})
+	if err != nil || running.Status != JobQueued || running.Principal != "alice" {
+		t.Fatalf("Submit = %+v, %v", running, err)
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		job, _ := q.Get(running.ID)
+		if job.Status == JobRunning && job.Progress.PagesFetched == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job = %+v, want running with progress", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	if job := waitForJob(t, q, running.ID); job.Status != JobSucceeded || job.Result != "done" || job.FinishedAt == "" {
+		t.Errorf("finished job = %+v", job)
+	}
+
+	failed, _ := q.Submit("edge-apply", "bob", func(ctx context.Context, progress func(JobProgress)) (interface{}, error) {
+		return nil, errors.New("edge unreachable")
+	})
+	if job := waitForJob(t, q, failed.ID); job.Status != JobFailed || job.Error != "edge unreachable" {
+		t.Errorf("failed job = %+v", job)
+	}
+
+	panicked, _ := q.Submit("edge-apply", "bob", func(ctx context.Context, progress func(JobProgress)) (interface{}, error) {
+		panic("boom")
+	})
+	if job := waitForJob(t, q, panicked.ID); job.Status != JobFailed || job.Error != "job panicked: boom" {
+		t.Errorf("panicked job = %+v", job)
+	}
+
+	if _, ok := q.Get("unknown"); ok {
+		t.Error("Get(unknown) found a job")
+	}
+}
+
+func TestJobQueueForgetsOldestFinishedJobs(t *testing.T) {
+	q := NewJobQueue(1, 10, 2)
+	done := func(ctx context.Context, progress func(JobProgress)) (interface{}, error) { return nil, nil }
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		job, _ := q.Submit("test", "alice", done)
+		waitForJob(t, q, job.ID)
+		ids = append(ids, job.ID)
+	}
+	job, _ := q.Submit("test", "alice", done)
+	waitForJob(t, q, job.ID)
+
+	if _, ok := q.Get(ids[0]); ok {
+		t.Error("oldest job kept beyond maxJobs")
+	}
+	if _, ok := q.Get(job.ID); !ok {
+		t.Error("newest job forgotten")
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	q := NewJobQueue(0, 1, 10)
+	noop := func(ctx context.Context, progress func(JobProgress)) (interface{}, error) { return nil, nil }
+	if _, err := q.Submit("test", "alice", noop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit("test", "alice", noop); !errors.Is(err, errJobQueueFull) {
+		t.Errorf("second Submit = %v, want errJobQueueFull", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenAddr is where the API is served, from LISTEN: a TCP address such as
+// ":8080", or "unix:/run/geoblock/api.sock" for a Unix domain socket, e.g.
+// behind a local nginx. Sockets passed by systemd socket activation take
+// precedence; LISTEN=systemd requires them.
+var listenAddr = getEnv("LISTEN", ":8080")
+
+// listenSocketMode is the permission of a Unix socket created for LISTEN,
+// from LISTEN_SOCKET_MODE in octal; only the owner and group may connect by
+// default
+var listenSocketMode = loadListenSocketMode()
+
+// systemdListenFDsStart is the first file descriptor systemd passes
+const systemdListenFDsStart = 3
+
+func loadListenSocketMode() os.FileMode {
+	raw := getEnv("LISTEN_SOCKET_MODE", "0660")
+	mode, err := strconv.ParseUint(raw, 8, 32)
+	if err != nil || mode > 0o777 {
+		fmt.Printf("⚠️  Invalid LISTEN_SOCKET_MODE %q, using 0660\n", raw)
+		return 0o660
+	}
+	return os.FileMode(mode)
+}
+
+// openListeners returns the sockets systemd passed to the process, or else
+// a listener for addr
+func openListeners(addr string) ([]net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil || len(listeners) > 0 {
+		return listeners, err
+	}
+	if addr == "systemd" {
+		return nil, errors.New("LISTEN=systemd but no sockets were passed by systemd")
+	}
+	listener, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{listener}, nil
+}
+
+// listen opens a TCP listener, or a Unix socket for a "unix:" address. A
+// socket file left behind by a previous run is replaced, but no other file.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, listenSocketMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation,
+// as described by LISTEN_PID and LISTEN_FDS. The variables are cleared so
+// child processes do not take the sockets for theirs.
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		name := "systemd"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(systemdListenFDsStart+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// describeListeners lists the addresses served, e.g. "[::]:8080" or
+// "unix:/run/geoblock/api.sock"
+func describeListeners(listeners []net.Listener) string {
+	addrs := make([]string, 0, len(listeners))
+	for _, listener := range listeners {
+		addr := listener.Addr()
+		if addr.Network() == "unix" {
+			addrs = append(addrs, "unix:"+addr.String())
+		} else {
+			addrs = append(addrs, addr.String())
+		}
+	}
+	return strings.Join(addrs, ", ")
+}
+
+// serve serves every listener until one fails, returning its error
+func serve(server *http.Server, listeners []net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- server.Serve(listener)
+		}(listener)
+	}
+	return <-errs
+}
+
+// unixSocketPeer reports whether a request arrived over a Unix socket. Only
+// local processes allowed by the socket's permissions can connect, so such a
+// peer is a trusted proxy.
+func unixSocketPeer(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// shortTempDir keeps socket paths below the 108-byte limit of sun_path
+func shortTempDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(shortTempDir(t), "api.sock")
+
+	// A socket left behind by a previous run is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != listenSocketMode {
+		t.Errorf("socket mode = %v (%v), want %v", info.Mode().Perm(), err, listenSocketMode)
+	}
+	if got := describeListeners([]net.Listener{listener}); got != "unix:"+path {
+		t.Errorf("describeListeners = %q", got)
+	}
+
+	// Requests through the socket come from a trusted local proxy
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strconv.FormatBool(unixSocketPeer(r))+" "+rateLimitIP(r))
+	})}
+	go serve(server, []net.Listener{listener})
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "true 203.0.113.7" {
+		t.Errorf("response = %q, want %q", body, "true 203.0.113.7")
+	}
+}
+
+func TestListenRefusesOtherFiles(t *testing.T) {
+	path := filepath.Join(shortTempDir(t), "api.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen("unix:" + path); err == nil {
+		t.Error("listen replaced a regular file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Error("regular file was modified")
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	// Sockets passed to another process are not ours
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	if listeners, err := systemdListeners(); err != nil || len(listeners) != 0 {
+		t.Errorf("got %d listeners (%v), want none", len(listeners), err)
+	}
+	if _, err := openListeners("systemd"); err == nil {
+		t.Error("LISTEN=systemd without sockets succeeded")
+	}
+}
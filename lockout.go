@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"shopify-customers/geoblock"
+)
+
+// lockoutProtection refuses blocklist changes that would start blocking the
+// administrator making them, unless the request has ?force=true
+var lockoutProtection = getEnv("LOCKOUT_PROTECTION", "true") == "true"
+
+// errSelfLockout is returned for a change that would block its own author
+var errSelfLockout = errors.New("change would block your own location")
+
+// lockoutCaller resolves who to protect from a change: nobody for changes
+// made by the server itself, forced changes, or callers whose country could
+// not be determined
+func lockoutCaller(r *http.Request) (geoblock.RequestGeo, bool) {
+	if !lockoutProtection || r == nil || r.URL.Query().Get("force") == "true" {
+		return geoblock.RequestGeo{}, false
+	}
+	geo := resolveRequestGeo(r)
+	return geo, !geo.LookupFailed
+}
+
+// rejectsCaller reports whether a store blocks or challenges the caller,
+// whose API client cannot answer a challenge
+func rejectsCaller(store *geoblock.Store, geo geoblock.RequestGeo, principal string) bool {
+	if store.Exemption(geo.ActualIP, principal) != nil {
+		return false
+	}
+	if match := store.MatchIP(geo.ActualIP); match != nil && !match.Monitor && !match.Conditional() {
+		return true
+	}
+	return rejects(countryHandling(store, geo.Country))
+}
+
+// checkSelfLockout returns errSelfLockout if policy would block the caller
+// while the live blocklist does not; a caller already blocked is not
+// locked out any further
+func checkSelfLockout(policy *geoblock.Policy, geo geoblock.RequestGeo, principal string) error {
+	if rejectsCaller(blocklist, geo, principal) {
+		return nil
+	}
+	candidate := geoblock.NewStore(geoblock.WithBlockPagesDir(blockPagesDir))
+	if _, err := candidate.ReplacePolicy(policy); err != nil {
+		// An invalid policy is refused when the change is applied
+		return nil
+	}
+	if !rejectsCaller(candidate, geo, principal) {
+		return nil
+	}
+	return fmt.Errorf("%w (%s, %s); repeat the request with ?force=true to apply it anyway", errSelfLockout, geo.Country, geo.ActualIP)
+}
+
+// checkCorrectionLockout returns errSelfLockout if correcting the country of
+// network would block the caller while the live blocklist does not
+func checkCorrectionLockout(network *net.IPNet, country string, geo geoblock.RequestGeo, principal string) error {
+	ip := net.ParseIP(geo.ActualIP)
+	if ip == nil || !network.Contains(ip) || rejectsCaller(blocklist, geo, principal) {
+		return nil
+	}
+	corrected := geo
+	corrected.Country = country
+	if !rejectsCaller(blocklist, corrected, principal) {
+		return nil
+	}
+	return fmt.Errorf("%w (%s, %s); repeat the request with ?force=true to apply it anyway", errSelfLockout, country, geo.ActualIP)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestRejectsCaller(t *testing.T) {
+	store := geoblock.NewStore()
+	_, err := store.ReplacePolicy(&geoblock.Policy{
+		BlockedCountries: []string{"DE"},
+		BlockedNetworks:  []string{"203.0.113.0/24"},
+		Exemptions:       []geoblock.Exemption{{ID: "ops", Principals: []string{"ops"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		geo       geoblock.RequestGeo
+		principal string
+		want      bool
+	}{
+		{"blocked country", geoblock.RequestGeo{ActualIP: "198.51.100.7", Country: "DE"}, "admin", true},
+		{"allowed country", geoblock.RequestGeo{ActualIP: "198.51.100.7", Country: "FR"}, "admin", false},
+		{"blocked network", geoblock.RequestGeo{ActualIP: "203.0.113.9", Country: "FR"}, "admin", true},
+		{"exempt principal", geoblock.RequestGeo{ActualIP: "203.0.113.9", Country: "DE"}, "ops", false},
+	}
+	for _, tt := range tests {
+		if got := rejectsCaller(store, tt.geo, tt.principal); got != tt.want {
+			t.Errorf("%s: rejectsCaller = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSelfLockout(t *testing.T) {
+	geo := geoblock.RequestGeo{ActualIP: "198.51.100.7", Country: "DE"}
+	err := checkSelfLockout(&geoblock.Policy{BlockedCountries: []string{"DE"}}, geo, "admin")
+	if !errors.Is(err, errSelfLockout) {
+		t.Errorf("blocking the caller's country: err = %v, want errSelfLockout", err)
+	}
+	if updateErrorStatus(err) != http.StatusConflict {
+		t.Errorf("status = %d, want 409", updateErrorStatus(err))
+	}
+	if err := checkSelfLockout(&geoblock.Policy{BlockedCountries: []string{"RU"}}, geo, "admin"); err != nil {
+		t.Errorf("blocking another country: err = %v", err)
+	}
+}
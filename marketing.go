@@ -0,0 +1,48 @@
+package main
+
+import "sort"
+
+// CountryMarketing counts the customers in a country who accept marketing,
+// i.e. the marketable audience lost if the country is blocked
+type CountryMarketing struct {
+	CountryCode         string  `json:"country_code"`
+	CustomerCount       int     `json:"customer_count"`
+	MarketableCustomers int     `json:"marketable_customers"`
+	ConsentRate         float64 `json:"consent_rate"`
+	Blocked             bool    `json:"blocked"`
+}
+
+// marketingByCountry breaks down marketing consent per country, counting a
+// customer once in every country they have an address in. Countries with the
+// most marketable customers come first.
+func marketingByCountry(customerCountries []CustomerCountry) []CountryMarketing {
+	totals := make(map[string]*CountryMarketing)
+	for _, cc := range customerCountries {
+		for _, code := range cc.CountryCodes {
+			total, ok := totals[code]
+			if !ok {
+				total = &CountryMarketing{CountryCode: code}
+				totals[code] = total
+			}
+			total.CustomerCount++
+			if cc.AcceptsMarketing {
+				total.MarketableCustomers++
+			}
+		}
+	}
+
+	breakdown := make([]CountryMarketing, 0, len(totals))
+	for _, total := range totals {
+		total.ConsentRate = float64(total.MarketableCustomers) / float64(total.CustomerCount)
+		total.Blocked = blocklist.IsBlocked(total.CountryCode)
+		breakdown = append(breakdown, *total)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		a, b := breakdown[i], breakdown[j]
+		if a.MarketableCustomers != b.MarketableCustomers {
+			return a.MarketableCustomers > b.MarketableCustomers
+		}
+		return a.CountryCode < b.CountryCode
+	})
+	return breakdown
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarketingByCountry(t *testing.T) {
+	customers := []CustomerCountry{
+		{CustomerID: 1, CountryCodes: []string{"US", "CA"}, AcceptsMarketing: true},
+		{CustomerID: 2, CountryCodes: []string{"US"}, AcceptsMarketing: true},
+		{CustomerID: 3, CountryCodes: []string{"US"}},
+		{CustomerID: 4, CountryCodes: []string{"DE"}},
+	}
+
+	want := []CountryMarketing{
+		{CountryCode: "US", CustomerCount: 3, MarketableCustomers: 2, ConsentRate: 2.0 / 3},
+		{CountryCode: "CA", CustomerCount: 1, MarketableCustomers: 1, ConsentRate: 1},
+		{CountryCode: "DE", CustomerCount: 1, MarketableCustomers: 0, ConsentRate: 0},
+	}
+	if got := marketingByCountry(customers); !reflect.DeepEqual(got, want) {
+		t.Errorf("marketingByCountry = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+-- Blocking policy: the single active policy, including its rules
+CREATE TABLE blocking_policy (
+    id         integer PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    policy     jsonb NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Customers as last fetched from Shopify, with their resolved countries
+CREATE TABLE customers (
+    id                bigint PRIMARY KEY,
+    name              text NOT NULL,
+    email             text NOT NULL,
+    country_codes     text[] NOT NULL DEFAULT '{}',
+    default_country   text NOT NULL DEFAULT '',
+    accepts_marketing boolean NOT NULL DEFAULT false,
+    orders_count      integer NOT NULL DEFAULT 0,
+    total_spent       numeric(14, 2) NOT NULL DEFAULT 0,
+    synced_at         timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX customers_country_codes_idx ON customers USING gin (country_codes);
+
+-- Audit log of changes made through the management API or by the server itself
+CREATE TABLE audit_log (
+    id          bigserial PRIMARY KEY,
+    occurred_at timestamptz NOT NULL,
+    principal   text NOT NULL,
+    role        text NOT NULL,
+    action      text NOT NULL,
+    client_ip   text NOT NULL DEFAULT '',
+    details     jsonb
+);
+
+CREATE INDEX audit_log_occurred_at_idx ON audit_log (occurred_at);
+
+-- Traffic counters per country and 5-minute bucket, one row per server instance
+CREATE TABLE traffic_aggregates (
+    bucket_start timestamptz NOT NULL,
+    country_code text NOT NULL,
+    instance     text NOT NULL,
+    requests     integer NOT NULL,
+    blocks       integer NOT NULL,
+    monitored    integer NOT NULL,
+    unique_ips   integer NOT NULL,
+    PRIMARY KEY (bucket_start, country_code, instance)
+);
@@ -0,0 +1,13 @@
+-- Customers saved in PII minimization mode, keyed by a hash of the Shopify ID
+-- and without names or emails
+CREATE TABLE anonymous_customers (
+    customer_hash     text PRIMARY KEY,
+    country_codes     text[] NOT NULL DEFAULT '{}',
+    default_country   text NOT NULL DEFAULT '',
+    accepts_marketing boolean NOT NULL DEFAULT false,
+    orders_count      integer NOT NULL DEFAULT 0,
+    total_spent       numeric(14, 2) NOT NULL DEFAULT 0,
+    synced_at         timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX anonymous_customers_country_codes_idx ON anonymous_customers USING gin (country_codes);
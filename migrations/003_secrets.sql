@@ -0,0 +1,9 @@
+-- Secrets such as the Shopify token, each encrypted with its own data key.
+-- The data key is stored wrapped by the master key key_id, never in the clear.
+CREATE TABLE secrets (
+    name        text PRIMARY KEY,
+    key_id      text NOT NULL,
+    wrapped_key bytea NOT NULL,
+    ciphertext  bytea NOT NULL,
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
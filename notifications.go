@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// notificationTimeout bounds delivering one notification to one channel
+const notificationTimeout = 10 * time.Second
+
+// Events notifications are sent for
+const (
+	eventBlocklistChanged    = "blocklist_changed"
+	eventBlockedTrafficSpike = "blocked_traffic_spike"
+	eventShopifySyncFailed   = "shopify_sync_failed"
+	eventValidationFailed    = "validation_failed"
+)
+
+// Kinds of notification channels, by the message format they expect
+const (
+	channelSlack   = "slack"
+	channelTeams   = "teams"
+	channelWebhook = "webhook"
+	channelEmail   = "email"
+)
+
+// Notification is one event to tell people about
+type Notification struct {
+	Event  string
+	Title  string
+	Text   string
+	Fields []NotificationField
+	Time   time.Time
+}
+
+// NotificationField is a labelled value shown with a notification
+type NotificationField struct {
+	Name  string
+	Value string
+}
+
+// notificationChannel is a Slack or Teams incoming webhook, a generic JSON
+// webhook, or email recipients separated by ";"
+type notificationChannel struct {
+	name string
+	kind string
+	url  string
+}
+
+// Notifier sends notifications to the channels their event is routed to
+type Notifier struct {
+	channels []notificationChannel
+
+	// routes lists the channels per event; events without a route go to
+	// every channel
+	routes map[string][]string
+	client *http.Client
+
+	// send delivers one formatted message; replaced in tests
+	send func(channel notificationChannel, payload []byte) error
+}
+
+var notifier = newNotifier(getEnvList("NOTIFY_CHANNELS", ""), getEnvList("NOTIFY_ROUTES", ""))
+
+// newNotifier parses NOTIFY_CHANNELS entries such as
+// "ops=slack:https://hooks.slack.com/services/..." and NOTIFY_ROUTES entries
+// such as "blocked_traffic_spike=ops|security". Invalid entries are skipped
+// with a warning.
+func newNotifier(channels, routes []string) *Notifier {
+	n := &Notifier{routes: make(map[string][]string), client: newHTTPClient(notificationTimeout)}
+	n.send = n.post
+	for _, entry := range channels {
+		name, target, _ := strings.Cut(entry, "=")
+		kind, url, _ := strings.Cut(target, ":")
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if name == "" || url == "" || !slices.Contains([]string{channelSlack, channelTeams, channelWebhook, channelEmail}, kind) {
+			fmt.Printf("⚠️  Ignoring NOTIFY_CHANNELS entry %q: use name=slack|teams|webhook:url or name=email:recipients\n", name)
+			continue
+		}
+		n.channels = append(n.channels, notificationChannel{name: strings.TrimSpace(name), kind: kind, url: strings.TrimSpace(url)})
+	}
+	for _, entry := range routes {
+		event, names, found := strings.Cut(entry, "=")
+		if !found {
+			fmt.Printf("⚠️  Ignoring NOTIFY_ROUTES entry %q: use event=channel|channel\n", entry)
+			continue
+		}
+		event = strings.TrimSpace(event)
+		n.routes[event] = []string{}
+		for _, name := range strings.Split(names, "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				n.routes[event] = append(n.routes[event], name)
+			}
+		}
+	}
+	return n
+}
+
+// channelsFor returns the channels an event is routed to
+func (n *Notifier) channelsFor(event string) []notificationChannel {
+	names, routed := n.routes[event]
+	if !routed {
+		return n.channels
+	}
+	var channels []notificationChannel
+	for _, channel := range n.channels {
+		if slices.Contains(names, channel.name) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// Notify delivers a notification in the background; failures are logged
+func (n *Notifier) Notify(notification Notification) {
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	for _, channel := range n.channelsFor(notification.Event) {
+		payload, err := formatNotification(channel.kind, notification)
+		if err != nil {
+			fmt.Printf("⚠️  Could not format %s notification: %v\n", notification.Event, err)
+			continue
+		}
+		go func() {
+			if err := n.send(channel, payload); err != nil {
+				fmt.Printf("⚠️  %s notification to %s failed: %v\n", notification.Event, channel.name, err)
+			}
+		}()
+	}
+}
+
+// post sends a formatted message to a channel's webhook, or mails it
+func (n *Notifier) post(channel notificationChannel, payload []byte) error {
+	if channel.kind == channelEmail {
+		return sendEmail(smtpSettings, channel.url, payload)
+	}
+	resp, err := n.client.Post(channel.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// formatNotification renders a notification as a Slack Block Kit message, a
+// Teams Adaptive Card message, an email or, for generic webhooks, plain JSON
+func formatNotification(kind string, n Notification) ([]byte, error) {
+	switch kind {
+	case channelEmail:
+		return renderEmail(smtpSettings, n)
+
+	case channelSlack:
+		blocks := []map[string]any{
+			{"type": "header", "text": map[string]any{"type": "plain_text", "text": n.Title}},
+			{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": n.Text}},
+		}
+		var fields []map[string]any
+		for _, field := range n.Fields {
+			// Slack shows at most 10 fields per section
+			if len(fields) < 10 {
+				fields = append(fields, map[string]any{"type": "mrkdwn", "text": "*" + field.Name + "*\n" + field.Value})
+			}
+		}
+		if len(fields) > 0 {
+			blocks = append(blocks, map[string]any{"type": "section", "fields": fields})
+		}
+		blocks = append(blocks, map[string]any{"type": "context", "elements": []map[string]any{
+			{"type": "mrkdwn", "text": n.Event + " · " + n.Time.UTC().Format(time.RFC3339)},
+		}})
+		return json.Marshal(map[string]any{"text": n.Title + ": " + n.Text, "blocks": blocks})
+
+	case channelTeams:
+		facts := []map[string]string{}
+		for _, field := range n.Fields {
+			facts = append(facts, map[string]string{"title": field.Name, "value": field.Value})
+		}
+		card := map[string]any{
+			"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+			"type":    "AdaptiveCard",
+			"version": "1.4",
+			"body": []map[string]any{
+				{"type": "TextBlock", "text": n.Title, "weight": "Bolder", "size": "Medium", "wrap": true},
+				{"type": "TextBlock", "text": n.Text, "wrap": true},
+				{"type": "FactSet", "facts": facts},
+				{"type": "TextBlock", "text": n.Event + " · " + n.Time.UTC().Format(time.RFC3339), "isSubtle": true, "size": "Small"},
+			},
+		}
+		return json.Marshal(map[string]any{
+			"type":        "message",
+			"attachments": []map[string]any{{"contentType": "application/vnd.microsoft.card.adaptive", "content": card}},
+		})
+	}
+
+	fields := make(map[string]string, len(n.Fields))
+	for _, field := range n.Fields {
+		fields[field.Name] = field.Value
+	}
+	return json.Marshal(map[string]any{
+		"event":     n.Event,
+		"title":     n.Title,
+		"text":      n.Text,
+		"fields":    fields,
+		"timestamp": n.Time.Format(time.RFC3339),
+	})
+}
+
+// joinOrNone lists countries for a notification field
+func joinOrNone(countries []string) string {
+	if len(countries) == 0 {
+		return "none"
+	}
+	return strings.Join(countries, ", ")
+}
+
+// blocklistChangedNotification describes a new blocklist version
+func blocklistChangedNotification(version PolicyVersion) Notification {
+	var added, removed []string
+	for _, code := range version.After {
+		if !slices.Contains(version.Before, code) {
+			added = append(added, code)
+		}
+	}
+	for _, code := range version.Before {
+		if !slices.Contains(version.After, code) {
+			removed = append(removed, code)
+		}
+	}
+	return Notification{
+		Event: eventBlocklistChanged,
+		Title: fmt.Sprintf("Blocklist changed to version %d", version.Version),
+		Text:  fmt.Sprintf("%s changed the blocklist (%s); %d countries are blocked now.", version.Principal, version.Action, len(version.After)),
+		Fields: []NotificationField{
+			{"Blocked", joinOrNone(added)},
+			{"Unblocked", joinOrNone(removed)},
+			{"Changed by", version.Principal},
+		},
+	}
+}
+
+// blockedTrafficSpikeNotification describes a country whose blocked requests
+// rose well above their usual rate
+func blockedTrafficSpikeNotification(country string, blocked int, baseline float64, window time.Duration) Notification {
+	name, _ := getCountryName(country)
+	return Notification{
+		Event: eventBlockedTrafficSpike,
+		Title: fmt.Sprintf("Spike in blocked traffic from %s", name),
+		Text:  fmt.Sprintf("%d requests from %s (%s) were blocked in the last %s, against a usual %.1f.", blocked, name, country, shortDuration(window), baseline),
+		Fields: []NotificationField{
+			{"Country", country},
+			{"Blocked", fmt.Sprint(blocked)},
+			{"Baseline", fmt.Sprintf("%.1f", baseline)},
+		},
+	}
+}
+
+// shopifySyncFailedNotification describes a failed push of the blocklist to Shopify
+func shopifySyncFailedNotification(version int, err error) Notification {
+	return Notification{
+		Event: eventShopifySyncFailed,
+		Title: "Shopify sync failed",
+		Text:  fmt.Sprintf("Blocklist version %d could not be pushed to the storefront: %v", version, err),
+		Fields: []NotificationField{
+			{"Version", fmt.Sprint(version)},
+			{"Error", err.Error()},
+		},
+	}
+}
+
+// validationFailedNotification describes a self-test that found a
+// misconfiguration
+func validationFailedNotification(response SelfTestResponse) Notification {
+	notification := Notification{
+		Event: eventValidationFailed,
+		Title: "Blocking self-test failed",
+	}
+	var failed []string
+	for _, check := range response.Checks {
+		if check.Status == "fail" {
+			failed = append(failed, check.Component)
+			notification.Fields = append(notification.Fields, NotificationField{check.Component, check.Error})
+		}
+	}
+	notification.Text = fmt.Sprintf("The self-test found a problem with %s; blocking may not work as configured.", strings.Join(failed, ", "))
+	return notification
+}
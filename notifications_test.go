@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifierRouting(t *testing.T) {
+	n := newNotifier(
+		[]string{"ops=slack:https://hooks.slack.test/ops", "it=teams:https://teams.test/hook", "bad=pager:x"},
+		[]string{"blocked_traffic_spike=ops", "shopify_sync_failed=ops|it"},
+	)
+	if len(n.channels) != 2 {
+		t.Fatalf("channels = %+v, want ops and it", n.channels)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sent := make(map[string][]string)
+	n.send = func(channel notificationChannel, payload []byte) error {
+		defer wg.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		var message map[string]any
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Errorf("%s payload is not JSON: %v", channel.name, err)
+		}
+		sent[channel.name] = append(sent[channel.name], channel.kind)
+		return nil
+	}
+
+	wg.Add(1 + 2 + 2)
+	n.Notify(blockedTrafficSpikeNotification("RU", 500, 20, time.Hour))
+	n.Notify(shopifySyncFailedNotification(3, errors.New("401 Unauthorized")))
+	n.Notify(blocklistChangedNotification(PolicyVersion{Version: 2, Before: []string{"RU"}, After: []string{"KP"}, Principal: "admin"}))
+	wg.Wait()
+
+	if len(sent["ops"]) != 3 || len(sent["it"]) != 2 {
+		t.Errorf("sent = %v, want 3 to ops and 2 to it", sent)
+	}
+}
+
+func TestFormatNotification(t *testing.T) {
+	notification := blocklistChangedNotification(PolicyVersion{Version: 2, Action: "block-country", Before: []string{"RU"}, After: []string{"RU", "KP"}, Principal: "admin"})
+	notification.Time = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var slack struct {
+		Text   string           `json:"text"`
+		Blocks []map[string]any `json:"blocks"`
+	}
+	data, _ := formatNotification(channelSlack, notification)
+	if err := json.Unmarshal(data, &slack); err != nil || len(slack.Blocks) != 4 || slack.Blocks[0]["type"] != "header" {
+		t.Errorf("slack message = %s", data)
+	}
+
+	var teams struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string           `json:"type"`
+				Body []map[string]any `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	data, _ = formatNotification(channelTeams, notification)
+	if err := json.Unmarshal(data, &teams); err != nil || teams.Type != "message" || len(teams.Attachments) != 1 || teams.Attachments[0].Content.Type != "AdaptiveCard" {
+		t.Errorf("teams message = %s", data)
+	}
+
+	var webhook struct {
+		Event  string            `json:"event"`
+		Fields map[string]string `json:"fields"`
+	}
+	data, _ = formatNotification(channelWebhook, notification)
+	if err := json.Unmarshal(data, &webhook); err != nil || webhook.Event != eventBlocklistChanged || webhook.Fields["Blocked"] != "KP" || webhook.Fields["Unblocked"] != "none" {
+		t.Errorf("webhook message = %s", data)
+	}
+}
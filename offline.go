@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"shopify-customers/geoblock"
+)
+
+// offlineMode runs without any outbound calls, for air-gapped networks:
+// countries come only from the bundled snapshot and Shopify is not called
+var offlineMode = getEnv("OFFLINE_MODE", "false") == "true"
+
+// errShopifyOffline is returned instead of calling Shopify in offline mode
+var errShopifyOffline = errors.New("Shopify access is disabled in offline mode")
+
+// newSnapshotProvider loads GEOIP_SNAPSHOT_FILE, a {"CC": ["cidr", ...]}
+// table, or else the ranges built into the binary, which only cover the
+// major networks of a few countries
+func newSnapshotProvider() *geoblock.Snapshot {
+	data, source := builtinIPRangesJSON, "built-in ranges"
+	if path := getEnv("GEOIP_SNAPSHOT_FILE", ""); path != "" {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("⚠️  Using the built-in GeoIP snapshot: %v\n", err)
+		} else {
+			data, source = file, path
+		}
+	}
+
+	ranges, err := parseIPRanges(data)
+	if err != nil && source != "built-in ranges" {
+		fmt.Printf("⚠️  Using the built-in GeoIP snapshot: %s: %v\n", source, err)
+		ranges, err = parseIPRanges(builtinIPRangesJSON)
+		source = "built-in ranges"
+	}
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in IP ranges: %v", err))
+	}
+
+	snapshot := geoblock.NewSnapshot(ranges)
+	snapshot.Source = source
+	fmt.Printf("🗺️  Loaded GeoIP snapshot with %d networks in %d countries from %s\n", snapshot.Len(), len(ranges), source)
+	return snapshot
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSnapshotProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(`{"ch": ["193.5.0.0/16"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GEOIP_SNAPSHOT_FILE", path)
+	if country, err := newSnapshotProvider().Lookup(context.Background(), "193.5.1.2"); err != nil || country != "CH" {
+		t.Errorf("Lookup from GEOIP_SNAPSHOT_FILE = %q, %v, want CH", country, err)
+	}
+
+	// An unreadable snapshot falls back to the built-in ranges
+	t.Setenv("GEOIP_SNAPSHOT_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	if country, err := newSnapshotProvider().Lookup(context.Background(), "126.1.2.3"); err != nil || country != "JP" {
+		t.Errorf("Lookup from built-in ranges = %q, %v, want JP", country, err)
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// apiParameter is a query parameter of an API operation
+type apiParameter struct {
+	Name        string
+	Description string
+}
+
+// apiOperation documents one route for the OpenAPI document. Request and
+// Response are zero values of the JSON bodies, whose schemas are derived
+// from their types.
+type apiOperation struct {
+	Summary     string
+	Description string
+	Query       []apiParameter
+	Request     any
+	Response    any
+	Status      int  // success status, 200 when zero
+	Public      bool // served without an API token
+}
+
+// customerQueryParameters filter and page the customers of a result, as
+// parsed by parseCustomerQuery
+var customerQueryParameters = []apiParameter{
+	{"country", "Comma-separated country codes or country groups"},
+	{"tag", "Only customers with this tag"},
+	{"sort", "Sort order of the customers"},
+	{"limit", "Page size"},
+	{"offset", "Index of the first customer"},
+}
+
+var thresholdParameter = apiParameter{"threshold", "Presence score above which a country counts as a market"}
+
+// forceParameter overrides the lockout protection of blocklist changes
+var forceParameter = apiParameter{"force", "true to apply a change that blocks your own location"}
+
+// apiOperations documents every v1 route by its registration pattern.
+// TestOpenAPIDocument fails when a registered route is missing here.
+var apiOperations = map[string]apiOperation{
+	"POST /customers": {
+		Summary:     "Fetch customers from Shopify",
+		Description: "Queues a fetch-customers job; poll GET /jobs/{id} for its CustomerResponse result.",
+		Request:     CustomerRequest{},
+		Response:    Job{},
+		Status:      http.StatusAccepted,
+	},
+	"GET /customers/{id}/export":     {Summary: "Export the data held about a customer", Response: CustomerDataExport{}},
+	"POST /customers/{id}/erase":     {Summary: "Erase the data held about a customer", Response: CustomerErasure{}},
+	"GET /secrets":                   {Summary: "List stored secrets without their values", Response: SecretsResponse{}},
+	"POST /secrets/rotate":           {Summary: "Rewrap secrets with the active master key", Response: SecretRotationResponse{}},
+	"GET /analyze-business-presence": {Summary: "Score business presence by country", Query: []apiParameter{thresholdParameter}, Response: BusinessPresenceResponse{}},
+	"GET /recommend-blocking":        {Summary: "Recommend countries to block", Query: []apiParameter{thresholdParameter}, Response: RecommendationResponse{}},
+	"GET /analyze-shipping-coverage": {Summary: "Compare shipping zones with the blocklist", Response: ShippingCoverageResponse{}},
+	"GET /analyze-blocked-demand":    {Summary: "Abandoned checkouts and draft orders from blocked countries", Response: BlockedDemandResponse{}},
+
+	"POST /block-countries":          {Summary: "Replace the blocked countries", Query: []apiParameter{forceParameter, {"override", "true to apply an update exceeding the blocking guardrails"}}, Request: BlockingRequest{}, Response: BlockingResponse{}},
+	"PUT /block-countries/{code}":    {Summary: "Block a country", Query: []apiParameter{forceParameter}, Response: BlockingResponse{}},
+	"DELETE /block-countries/{code}": {Summary: "Unblock a country", Response: BlockingResponse{}},
+	"GET /block-countries/export": {
+		Summary:     "Export the blocklist",
+		Description: "nginx and haproxy return a text deny-list; json and yaml return the policy document.",
+		Query:       []apiParameter{{"format", "nginx, haproxy, json or yaml"}},
+		Response:    PolicyDocument{},
+	},
+	"POST /block-countries/import": {
+		Summary:     "Import a policy document or country list",
+		Description: "A CSV or XLSX upload, as the body or the file field of a form, replaces the blocked countries and answers with a CountryListImportResponse reporting every row; with dry_run it is a preview.",
+		Query: []apiParameter{
+			{"format", "json, yaml, csv or xlsx, otherwise taken from the Content-Type"},
+			{"dry_run", "true to validate without applying"},
+			{"column", "Header name or 1-based number of the country column of a CSV or XLSX file"},
+			{"override", "true to apply a country list exceeding the blocking guardrails"},
+			forceParameter,
+		},
+		Request:  PolicyDocument{},
+		Response: PolicyImportResponse{},
+	},
+	"GET /block-countries/history":                     {Summary: "List policy versions", Response: PolicyHistoryResponse{}},
+	"GET /block-countries/history/{version}":           {Summary: "Get a policy version", Response: PolicyVersion{}},
+	"POST /block-countries/history/{version}/rollback": {Summary: "Roll the policy back to a version", Query: []apiParameter{forceParameter}, Response: RollbackResponse{}},
+	"POST /policy/plan":                                {Summary: "Plan a policy change", Request: PolicyDocument{}, Response: PolicyPlan{}},
+	"POST /policy/apply":                               {Summary: "Apply a planned policy change", Query: []apiParameter{forceParameter}, Request: PlanApplyRequest{}, Response: PlanApplyResponse{}},
+	"GET /storefront-sync":                             {Summary: "Storefront blocklist sync status", Response: StorefrontSyncStatus{}},
+	"POST /storefront-sync":                            {Summary: "Sync the blocklist to the storefront", Response: StorefrontSyncStatus{}},
+	"GET /edge-sync":                                   {Summary: "Diff the blocklist against the edge", Response: EdgeDiff{}},
+	"POST /edge-sync/apply": {
+		Summary:     "Apply the blocklist to the edge",
+		Description: "Queues an edge-apply job whose result is the applied EdgeDiff.",
+		Response:    Job{},
+		Status:      http.StatusAccepted,
+	},
+	"POST /edge-sync/rollback": {
+		Summary:     "Roll the edge back to its previous blocklist",
+		Description: "Queues an edge-rollback job whose result is the applied EdgeDiff.",
+		Response:    Job{},
+		Status:      http.StatusAccepted,
+	},
+	"POST /validate-blocking": {Summary: "Validate blocking against test countries", Request: ValidationRequest{}, Response: ValidationResponse{}},
+	"GET /explain-decision": {
+		Summary: "Explain the blocking decision for a request",
+		Query: []apiParameter{
+			{"ip", "Client IP address"},
+			{"country", "Country code, instead of resolving the IP"},
+			{"path", "Request path"},
+			{"host", "Storefront domain the request is for"},
+			{"principal", "Authenticated principal"},
+			{"reputation", "IP reputation score"},
+		},
+		Response: ExplainDecisionResponse{},
+	},
+	"GET /block-rules":                      {Summary: "List blocking rules", Response: BlockRulesResponse{}},
+	"POST /block-rules":                     {Summary: "Create or replace a blocking rule", Query: []apiParameter{forceParameter}, Request: BlockRuleRequest{}, Response: BlockRulesResponse{}},
+	"DELETE /block-rules":                   {Summary: "Delete a blocking rule", Query: []apiParameter{{"id", "Rule ID"}}, Response: BlockRulesResponse{}},
+	"DELETE /block-rules/{id}":              {Summary: "Delete a blocking rule", Response: BlockRulesResponse{}},
+	"GET /exemptions":                       {Summary: "List exemptions", Response: ExemptionsResponse{}},
+	"POST /exemptions":                      {Summary: "Create or replace an exemption", Request: geoblock.Exemption{}, Response: ExemptionsResponse{}},
+	"DELETE /exemptions/{id}":               {Summary: "Delete an exemption", Response: ExemptionsResponse{}},
+	"GET /block-countries/presets":          {Summary: "List country presets", Response: PresetListResponse{}},
+	"POST /block-countries/presets":         {Summary: "Apply a country preset", Query: []apiParameter{forceParameter}, Request: PresetApplyRequest{}, Response: PresetApplyResponse{}},
+	"POST /block-countries/presets/refresh": {Summary: "Refresh the country presets", Response: PresetRefreshResponse{}},
+	"POST /reload":                          {Summary: "Re-read the blocking policy", Response: ReloadResponse{}},
+	"GET /monitor-mode":                     {Summary: "Get monitor mode", Response: MonitorModeResponse{}},
+	"PUT /monitor-mode":                     {Summary: "Set monitor mode", Request: MonitorModeRequest{}, Response: MonitorModeResponse{}},
+	"GET /unknown-country":                  {Summary: "Get the unknown-country fallback", Response: UnknownCountryResponse{}},
+	"PUT /unknown-country":                  {Summary: "Set the unknown-country fallback", Request: UnknownCountryRequest{}, Response: UnknownCountryResponse{}},
+	"GET /audit-log":                        {Summary: "List policy changes", Response: AuditLogResponse{}},
+	"GET /events": {
+		Summary:     "Stream blocking decisions",
+		Description: "A text/event-stream of BlockingEvent objects until the client disconnects.",
+		Response:    BlockingEvent{},
+	},
+	"GET /analytics/traffic": {
+		Summary:  "Traffic by country",
+		Query:    []apiParameter{{"window", "1h, 24h or 7d"}, {"limit", "Number of countries"}},
+		Response: TrafficResponse{},
+	},
+	"GET /analytics/honeypot": {Summary: "Honeypot hits", Query: []apiParameter{{"limit", "Number of recent hits"}}, Response: HoneypotReport{}},
+	"GET /analytics/spikes":   {Summary: "Recent spikes in blocked traffic", Response: BlockSpikesResponse{}},
+	"GET /jobs/{id}": {
+		Summary:     "Get a job",
+		Description: "Customers of a fetch-customers result are filtered and paged by the query parameters.",
+		Query:       customerQueryParameters,
+		Response:    Job{},
+	},
+
+	"GET /test-access":  {Summary: "Test country blocking", Response: map[string]any{}, Public: true},
+	"POST /test-access": {Summary: "Test country blocking", Response: map[string]any{}, Public: true},
+	"POST /challenge": {
+		Summary:     "Verify a solved CAPTCHA",
+		Description: "Takes the provider's token as a form value and sets the challenge cookie.",
+		Status:      http.StatusNoContent,
+		Public:      true,
+	},
+	"POST /checkout/validate": {
+		Summary:     "Validate checkout shipping countries",
+		Description: "Takes and returns the input and result of a Shopify cart and checkout validation function, with an error for every delivery address in a blocked country.",
+		Request:     CheckoutValidationInput{},
+		Response:    CheckoutValidationResult{},
+		Public:      true,
+	},
+	"GET /ip-info":       {Summary: "IP and country of the caller", Response: IPInfo{}},
+	"POST /simulate-vpn": {Summary: "Simulate a request from a country", Request: VPNSimulationRequest{}, Response: VPNSimulationResponse{}},
+	"GET /countries":     {Summary: "List countries", Query: []apiParameter{{"locale", "Language of the country names"}}, Response: CountryListResponse{}},
+	"GET /countries/{code}/customers": {
+		Summary:  "Customers in a country",
+		Query:    customerQueryParameters[1:],
+		Response: CountryCustomersResponse{},
+	},
+	"GET /product-restrictions": {
+		Summary:     "List product and collection country restrictions",
+		Description: "Restrictions are stored in the geoblock.restricted_countries metafield of products and collections.",
+		Query:       []apiParameter{{"refresh", "true to reload the restrictions from Shopify first"}},
+		Response:    ProductRestrictionsResponse{},
+	},
+	"PUT /product-restrictions/{kind}/{id}":    {Summary: "Restrict a product or collection in some countries", Request: ProductRestrictionRequest{}, Response: ProductRestrictionsResponse{}},
+	"DELETE /product-restrictions/{kind}/{id}": {Summary: "Lift a product or collection restriction", Response: ProductRestrictionsResponse{}},
+	"GET /country-groups":                      {Summary: "List country groups", Response: CountryGroupsResponse{}},
+	"PUT /country-groups/{id}":                 {Summary: "Create or replace a country group", Request: geoblock.CountryGroup{}, Response: CountryGroupsResponse{}},
+	"DELETE /country-groups/{id}":              {Summary: "Delete a country group", Response: CountryGroupsResponse{}},
+	"GET /geo-provider/status":                 {Summary: "GeoIP provider status", Response: GeoProviderStatusResponse{}},
+	"GET /geo-provider/info":                   {Summary: "Active GeoIP providers and database versions", Response: GeoProviderInfoResponse{}},
+	"GET /geo-conflicts":                       {Summary: "Disagreements between GeoIP providers", Response: GeoConflictsResponse{}},
+	"GET /geo-corrections":                     {Summary: "List geolocation corrections", Response: GeoCorrectionsResponse{}},
+	"POST /geo-corrections":                    {Summary: "Correct the country of an IP", Query: []apiParameter{forceParameter, {"override", "true to apply a correction exceeding the blocking guardrails"}}, Request: GeoCorrectionRequest{}, Response: GeoCorrection{}, Status: http.StatusCreated},
+	"DELETE /geo-corrections/{id}":             {Summary: "Delete a geolocation correction", Status: http.StatusNoContent},
+	"GET /quarantine":                          {Summary: "List quarantined requests", Response: QuarantineListResponse{}},
+	"GET /quarantine/{id}":                     {Summary: "Get a quarantined request", Response: QuarantinedRequest{}},
+	"POST /quarantine/{id}/replay":             {Summary: "Replay a quarantined request", Response: QuarantineReplayResponse{}},
+	"DELETE /quarantine/{id}":                  {Summary: "Discard a quarantined request", Status: http.StatusNoContent},
+	"GET /anomalies":                           {Summary: "Impossible-travel anomalies", Response: GeoAnomaliesResponse{}},
+	"DELETE /anomalies/blocked-keys/{name}":    {Summary: "Unblock a key blocked for impossible travel", Status: http.StatusNoContent},
+	"GET /self-test": {
+		Summary:     "Run the end-to-end self-test",
+		Description: "Resolves a known IP, evaluates a sample rule set, checks the live blocklist and calls Shopify with the stored credentials. Answers 503 when a component fails.",
+		Response:    SelfTestResponse{},
+	},
+	"POST /benchmark": {
+		Summary:     "Benchmark the blocking middleware",
+		Description: "Times blocking decisions of the live blocklist over synthetic IPs, and lookups in the shared geo cache, against p99 latency and throughput budgets. Every field of the request is optional.",
+		Request:     BenchmarkRequest{},
+		Response:    BenchmarkResponse{},
+	},
+}
+
+// openAPIExtraSchemas are published as components although no route
+// returns them directly, e.g. the results of jobs
+var openAPIExtraSchemas = []any{CustomerResponse{}}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// openAPISchemas derives JSON schemas from Go types, collecting named
+// structs as reusable components
+type openAPISchemas struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+// componentName names a struct's component, prefixing its package when
+// another type already has the name
+func (s *openAPISchemas) componentName(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	if _, taken := s.components[name]; taken {
+		name = t.PkgPath()[strings.LastIndexByte(t.PkgPath(), '/')+1:] + "." + name
+	}
+	return name
+}
+
+// schema returns the JSON schema of a type
+func (s *openAPISchemas) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name, ok := s.names[t]
+		if !ok {
+			name = s.componentName(t)
+			s.names[t] = name
+			s.components[name] = nil // reserve the name while the fields refer back
+			s.components[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return s.object(t)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	}
+	// interface{} holds any JSON value
+	return map[string]any{}
+}
+
+// object returns the schema of a struct's JSON fields. Fields without
+// omitempty are required; embedded structs contribute their fields.
+func (s *openAPISchemas) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					addFields(embedded)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = s.schema(field.Type)
+			if !strings.Contains(","+options+",", ",omitempty,") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+var pathParameterPattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// openAPIOperation describes one registered route
+func openAPIOperation(schemas *openAPISchemas, pattern string) map[string]any {
+	doc, ok := apiOperations[pattern]
+	if !ok {
+		return map[string]any{"responses": map[string]any{"default": map[string]any{"description": "Undocumented"}}}
+	}
+	method, route, _ := strings.Cut(pattern, " ")
+	operation := map[string]any{
+		"operationId": strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_").Replace(route),
+		"summary":     doc.Summary,
+		"tags":        []string{strings.SplitN(strings.TrimPrefix(route, "/"), "/", 2)[0]},
+	}
+	if doc.Description != "" {
+		operation["description"] = doc.Description
+	}
+
+	var parameters []any
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(route, -1) {
+		parameters = append(parameters, map[string]any{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, param := range doc.Query {
+		parameters = append(parameters, map[string]any{
+			"name": param.Name, "in": "query", "description": param.Description, "schema": map[string]any{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if doc.Request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(doc.Request))}},
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if doc.Response != nil {
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(doc.Response))}}
+	}
+	errorResponse := map[string]any{"$ref": "#/components/responses/Error"}
+	responses := map[string]any{fmt.Sprint(status): success, "default": errorResponse}
+	if !doc.Public {
+		responses["401"] = errorResponse
+		responses["403"] = errorResponse
+	} else {
+		operation["security"] = []any{}
+	}
+	operation["responses"] = responses
+	return operation
+}
+
+// openAPIDocument describes the routes registered on an API router as an
+// OpenAPI 3.0 document
+func openAPIDocument(router *APIRouter) map[string]any {
+	schemas := &openAPISchemas{components: make(map[string]any), names: make(map[reflect.Type]string)}
+	schemas.schema(reflect.TypeFor[ErrorResponse]())
+	for _, extra := range openAPIExtraSchemas {
+		schemas.schema(reflect.TypeOf(extra))
+	}
+
+	paths := make(map[string]any)
+	for _, pattern := range router.Routes() {
+		method, route, found := strings.Cut(pattern, " ")
+		if !found || method == http.MethodOptions {
+			continue
+		}
+		item, ok := paths[route].(map[string]any)
+		if !ok {
+			item = make(map[string]any)
+			paths[route] = item
+		}
+		item[strings.ToLower(method)] = openAPIOperation(schemas, pattern)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Geo-Blocking API",
+			"version":     router.version,
+			"description": "Country blocking and business presence analysis for a Shopify store.",
+		},
+		"servers": []any{map[string]any{"url": router.Path("")}},
+		"paths":   paths,
+		"security": []any{
+			map[string]any{"bearerAuth": []string{}},
+			map[string]any{"apiKeyAuth": []string{}},
+		},
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"responses": map[string]any{
+				"Error": map[string]any{
+					"description": "Error",
+					"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/ErrorResponse"}}},
+				},
+			},
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKeyAuth": map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+// handleOpenAPI serves the router's OpenAPI document, built on the first
+// request once every route has been registered
+func handleOpenAPI(router *APIRouter) http.HandlerFunc {
+	var once sync.Once
+	var document []byte
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			document, _ = json.MarshalIndent(openAPIDocument(router), "", "  ")
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(document)
+	}
+}
+
+// swaggerUIPage renders /api/openapi.json with Swagger UI. Its scripts and
+// styles are loaded from the unpkg CDN.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Geo-Blocking API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// handleAPIDocs serves the Swagger UI page for the API
+func handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, swaggerUIPage)
+}
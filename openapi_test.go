@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shopify-customers/client"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json = %d", recorder.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+
+	operations := 0
+	for path, item := range doc.Paths {
+		for method, operation := range item {
+			operations++
+			if operation["summary"] == nil {
+				t.Errorf("%s %s is registered but not in apiOperations", strings.ToUpper(method), path)
+			}
+		}
+	}
+	if operations != len(apiOperations) {
+		t.Errorf("document has %d operations, apiOperations has %d; remove entries for routes that no longer exist", operations, len(apiOperations))
+	}
+
+	for _, name := range []string{"CustomerRequest", "CustomerResponse", "BlockingResponse", "VPNSimulationResponse", "ErrorResponse", "Exemption"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("missing schema %s", name)
+		}
+	}
+	// Refs must resolve to components
+	body := recorder.Body.String()
+	for _, ref := range strings.Split(body, `"$ref": "#/components/schemas/`)[1:] {
+		name := ref[:strings.IndexByte(ref, '"')]
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("dangling $ref %s", name)
+		}
+	}
+}
+
+func TestOpenAPISchema(t *testing.T) {
+	type inner struct {
+		Code string `json:"code"`
+	}
+	type sample struct {
+		inner
+		Name     string            `json:"name"`
+		Count    int64             `json:"count,omitempty"`
+		Tags     []string          `json:"tags"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Next     *sample           `json:"next,omitempty"`
+		Value    interface{}       `json:"value,omitempty"`
+		Secret   string            `json:"-"`
+		internal string
+	}
+
+	schemas := &openAPISchemas{components: make(map[string]any), names: make(map[reflect.Type]string)}
+	ref := schemas.schema(reflect.TypeFor[sample]())
+	if ref["$ref"] != "#/components/schemas/sample" {
+		t.Fatalf("schema(sample) = %v, want a $ref", ref)
+	}
+	object := schemas.components["sample"].(map[string]any)
+	properties := object["properties"].(map[string]any)
+	for _, name := range []string{"code", "name", "count", "tags", "labels", "next", "value"} {
+		if properties[name] == nil {
+			t.Errorf("missing property %s", name)
+		}
+	}
+	if len(properties) != 7 {
+		t.Errorf("properties = %v, want 7", properties)
+	}
+	if got := properties["next"].(map[string]any)["$ref"]; got != "#/components/schemas/sample" {
+		t.Errorf("next = %v, want a $ref to sample", got)
+	}
+	if got := properties["count"].(map[string]any)["format"]; got != "int64" {
+		t.Errorf("count format = %v", got)
+	}
+	if got := object["required"]; !reflect.DeepEqual(got, []string{"code", "name", "tags"}) {
+		t.Errorf("required = %v", got)
+	}
+}
+
+// The client package mirrors the API types; their schemas must stay equal
+func TestClientTypesMatchAPI(t *testing.T) {
+	pairs := []struct{ server, client any }{
+		{BlockingRequest{}, client.BlockingRequest{}},
+		{BlockingResponse{}, client.BlockingResponse{}},
+		{ValidationRequest{}, client.ValidationRequest{}},
+		{ValidationResponse{}, client.ValidationResponse{}},
+		{IPInfo{}, client.IPInfo{}},
+		{CustomerRequest{}, client.CustomerRequest{}},
+		{CustomerResponse{}, client.CustomerResponse{}},
+		{BlockingEvent{}, client.BlockingEvent{}},
+	}
+	for _, pair := range pairs {
+		server := &openAPISchemas{components: make(map[string]any), names: make(map[reflect.Type]string)}
+		server.schema(reflect.TypeOf(pair.server))
+		mirror := &openAPISchemas{components: make(map[string]any), names: make(map[reflect.Type]string)}
+		mirror.schema(reflect.TypeOf(pair.client))
+		if !reflect.DeepEqual(server.components, mirror.components) {
+			t.Errorf("client.%T does not match the API's %T", pair.client, pair.server)
+		}
+	}
+}
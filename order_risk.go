@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"shopify-customers/geoblock"
+)
+
+// orderRiskAnnotation compares the country of the IP each new order was
+// placed from with its shipping and billing countries, and adds a risk
+// assessment to the order when they diverge into a blocked country
+var orderRiskAnnotation = getEnv("ORDER_RISK_ANNOTATION", "false") == "true"
+
+// OrderCountryRisk is the risk assessment for an order whose countries diverge
+type OrderCountryRisk struct {
+	Level string
+	Facts []string
+}
+
+// assessOrderCountries compares the order's IP country with its shipping and
+// billing countries. It returns nil unless one of them differs from the IP
+// country and either side of the difference is blocked. The risk is high
+// when the goods ship to a blocked country and medium otherwise, such as a
+// customer in a blocked country shipping elsewhere.
+func assessOrderCountries(store *geoblock.Store, ipCountry, shipping, billing string) *OrderCountryRisk {
+	if ipCountry == "" {
+		return nil
+	}
+	ipBlocked := rejects(countryHandling(store, ipCountry))
+
+	var risk *OrderCountryRisk
+	for _, address := range []struct{ kind, country string }{{"shipping", shipping}, {"billing", billing}} {
+		if address.country == "" || address.country == ipCountry {
+			continue
+		}
+		addressBlocked := rejects(countryHandling(store, address.country))
+		if !ipBlocked && !addressBlocked {
+			continue
+		}
+
+		if risk == nil {
+			risk = &OrderCountryRisk{Level: "MEDIUM"}
+		}
+		if addressBlocked && address.kind == "shipping" {
+			risk.Level = "HIGH"
+		}
+		blocked := address.country
+		if ipBlocked {
+			blocked = ipCountry
+		}
+		risk.Facts = append(risk.Facts, fmt.Sprintf("Placed from an IP address in %s but the %s address is in %s; %s is geo-blocked",
+			countryLabel(ipCountry), address.kind, countryLabel(address.country), countryLabel(blocked)))
+	}
+	return risk
+}
+
+// countryLabel names a country with its code, e.g. "Germany (DE)"
+func countryLabel(code string) string {
+	if name, ok := getCountryName(code); ok {
+		return fmt.Sprintf("%s (%s)", name, code)
+	}
+	return code
+}
+
+// annotateOrderRisk resolves the country of the order's browser IP and
+// writes a risk assessment back to Shopify when it diverges from the
+// order's addresses into a blocked country. Orders without a public browser
+// IP, such as those created by staff, are not assessed.
+func annotateOrderRisk(ctx context.Context, order ShopifyOrder) error {
+	ip := order.browserIP()
+	if ip == "" || isPrivateIP(ip) {
+		return nil
+	}
+	ipCountry, err := geoResolver.Lookup(ctx, ip)
+	if err != nil {
+		fmt.Printf("⚠️  Could not assess order %s: no country for %s: %v\n", order.Name, ip, err)
+		return nil
+	}
+
+	risk := assessOrderCountries(blocklist, ipCountry, order.shippingCountry(), order.billingCountry())
+	if risk == nil {
+		return nil
+	}
+	if err := createOrderRiskAssessment(ctx, order, risk.Level, risk.Facts); err != nil {
+		return err
+	}
+	recordSystemAudit("annotate-order-risk", map[string]interface{}{
+		"order_id":   order.ID,
+		"order":      order.Name,
+		"ip_country": ipCountry,
+		"shipping":   order.shippingCountry(),
+		"billing":    order.billingCountry(),
+		"risk_level": risk.Level,
+	})
+	fmt.Printf("🛒 Order %s placed from %s diverges into a blocked country: %s risk\n", order.Name, ipCountry, risk.Level)
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAssessOrderCountries(t *testing.T) {
+	store := checkoutTestStore(t)
+	tests := []struct {
+		name      string
+		ipCountry string
+		shipping  string
+		billing   string
+		wantLevel string
+		wantFacts int
+	}{
+		{"all the same", "FR", "FR", "FR", "", 0},
+		{"mismatch between allowed countries", "FR", "DE", "DE", "", 0},
+		{"unknown IP country", "", "RU", "RU", "", 0},
+		{"ships to a blocked country", "FR", "RU", "FR", "HIGH", 1},
+		{"billed in a blocked country", "FR", "FR", "RU", "MEDIUM", 1},
+		{"placed from a blocked country", "RU", "FR", "FR", "MEDIUM", 2},
+		{"monitored country", "FR", "BR", "BR", "", 0},
+		{"digital order", "RU", "", "FR", "MEDIUM", 1},
+	}
+	for _, tt := range tests {
+		risk := assessOrderCountries(store, tt.ipCountry, tt.shipping, tt.billing)
+		if tt.wantLevel == "" {
+			if risk != nil {
+				t.Errorf("%s: risk = %+v, want none", tt.name, risk)
+			}
+			continue
+		}
+		if risk == nil || risk.Level != tt.wantLevel || len(risk.Facts) != tt.wantFacts {
+			t.Errorf("%s: risk = %+v, want %s with %d facts", tt.name, risk, tt.wantLevel, tt.wantFacts)
+		}
+	}
+
+	risk := assessOrderCountries(store, "FR", "RU", "")
+	if want := "Placed from an IP address in France (FR) but the shipping address is in Russian Federation (RU); Russian Federation (RU) is geo-blocked"; risk == nil || risk.Facts[0] != want {
+		t.Errorf("facts = %+v, want %q", risk, want)
+	}
+}
+
+func TestShopifyOrderBrowserIP(t *testing.T) {
+	var order ShopifyOrder
+	if err := json.Unmarshal([]byte(`{"client_details": {"browser_ip": "203.0.113.9"}, "billing_address": {"country_code": "de"}}`), &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.browserIP() != "203.0.113.9" || order.billingCountry() != "DE" || order.shippingCountry() != "" {
+		t.Errorf("order = %+v", order)
+	}
+	if !strings.Contains(countryLabel("DE"), "(DE)") || countryLabel("ZZ") != "ZZ" {
+		t.Errorf("countryLabel = %q, %q", countryLabel("DE"), countryLabel("ZZ"))
+	}
+}
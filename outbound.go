@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// outboundTransport is shared by every outbound HTTP client so calls to
+// Shopify, geolocation providers and other APIs reuse pooled keep-alive
+// connections instead of dialing a new one per request
+var outboundTransport = newOutboundTransport()
+
+// egress enforces the egress allowlist in front of the shared transport.
+// Clients from newHTTPClient use it as outboundRoundTripper; other
+// protocols such as SMTP ask it with check.
+var egress = &egressTransport{next: outboundTransport, allowed: getEnvList("EGRESS_ALLOWLIST", ""), offline: offlineMode}
+
+var outboundRoundTripper http.RoundTripper = egress
+
+// newOutboundTransport builds the shared transport, tuned by
+// HTTP_MAX_IDLE_CONNS, HTTP_MAX_IDLE_CONNS_PER_HOST and HTTP_IDLE_CONN_TIMEOUT
+func newOutboundTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   getEnvDuration("HTTP_DIAL_TIMEOUT", 5*time.Second),
+		KeepAlive: 30 * time.Second,
+	}
+	proxies := newProxyConfig(getEnv("OUTBOUND_PROXY", ""), getEnvList("OUTBOUND_PROXY_RULES", ""))
+	return &http.Transport{
+		Proxy:                 proxies.proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          getEnvInt("HTTP_MAX_IDLE_CONNS", 100),
+		MaxIdleConnsPerHost:   getEnvInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 20),
+		IdleConnTimeout:       getEnvDuration("HTTP_IDLE_CONN_TIMEOUT", 90*time.Second),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// newHTTPClient returns a client on the shared transport that gives up on a
+// whole request, including reading the body, after timeout
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: outboundRoundTripper, Timeout: timeout}
+}
+
+// proxyRule sends requests to hosts matching pattern through proxy, or
+// directly when proxy is nil
+type proxyRule struct {
+	pattern string
+	proxy   *url.URL
+}
+
+// proxyConfig chooses the proxy for each outbound request
+type proxyConfig struct {
+	rules    []proxyRule
+	fallback *url.URL
+}
+
+// newProxyConfig parses OUTBOUND_PROXY and OUTBOUND_PROXY_RULES entries
+// such as "*.myshopify.com=http://proxy:3128" or "ipinfo.io=direct".
+// Invalid entries are reported and skipped.
+func newProxyConfig(fallback string, rules []string) *proxyConfig {
+	config := &proxyConfig{}
+	if fallback != "" {
+		proxyURL, err := parseProxyURL(fallback)
+		if err != nil {
+			fmt.Printf("⚠️  Ignoring OUTBOUND_PROXY: %v\n", err)
+		} else {
+			config.fallback = proxyURL
+		}
+	}
+	for _, entry := range rules {
+		pattern, target, ok := strings.Cut(entry, "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		target = strings.TrimSpace(target)
+		if !ok || pattern == "" || target == "" {
+			fmt.Printf("⚠️  Ignoring OUTBOUND_PROXY_RULES entry %q: expected host=proxy-url or host=direct\n", entry)
+			continue
+		}
+		rule := proxyRule{pattern: pattern}
+		if !strings.EqualFold(target, "direct") {
+			proxyURL, err := parseProxyURL(target)
+			if err != nil {
+				fmt.Printf("⚠️  Ignoring OUTBOUND_PROXY_RULES entry %q: %v\n", entry, err)
+				continue
+			}
+			rule.proxy = proxyURL
+		}
+		config.rules = append(config.rules, rule)
+	}
+	return config
+}
+
+// parseProxyURL accepts http, https and socks5 proxy URLs
+func parseProxyURL(value string) (*url.URL, error) {
+	proxyURL, err := url.Parse(value)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL")
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+		return proxyURL, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+}
+
+// proxy returns the proxy for a request: the first matching
+// OUTBOUND_PROXY_RULES entry, then OUTBOUND_PROXY, then the standard
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables
+func (c *proxyConfig) proxy(req *http.Request) (*url.URL, error) {
+	host := req.URL.Hostname()
+	for _, rule := range c.rules {
+		if hostMatches(rule.pattern, host) {
+			return rule.proxy, nil
+		}
+	}
+	if c.fallback != nil {
+		return c.fallback, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// hostMatches reports whether host is pattern or, for a "*.example.com"
+// pattern, one of its subdomains
+func hostMatches(pattern, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// egressTransport refuses requests, including redirects, to hosts outside
+// the allowlist, so the service can run where outbound traffic is
+// restricted and fails fast instead of waiting on a firewall. An empty
+// allowlist allows every host; offline refuses them all.
+type egressTransport struct {
+	next    http.RoundTripper
+	allowed []string
+	offline bool
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.check(req.URL.Hostname()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// check returns an error if connections to host are not allowed
+func (t *egressTransport) check(host string) error {
+	switch {
+	case t.offline:
+		return fmt.Errorf("egress to %s is disabled in offline mode", host)
+	case !t.allows(host):
+		return fmt.Errorf("egress to %s is not allowed by EGRESS_ALLOWLIST", host)
+	}
+	return nil
+}
+
+func (t *egressTransport) allows(host string) bool {
+	if len(t.allowed) == 0 {
+		return true
+	}
+	for _, pattern := range t.allowed {
+		if hostMatches(strings.ToLower(pattern), host) {
+			return true
+		}
+	}
+	return false
+}
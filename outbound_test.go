@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientSharesTransport(t *testing.T) {
+	a, b := newHTTPClient(time.Second), newHTTPClient(time.Minute)
+	if a.Transport != outboundRoundTripper || b.Transport != outboundRoundTripper {
+		t.Fatal("clients should share the pooled outbound transport")
+	}
+	if a.Timeout != time.Second || b.Timeout != time.Minute {
+		t.Errorf("timeouts = %s, %s, want 1s, 1m", a.Timeout, b.Timeout)
+	}
+}
+
+func TestOutboundTransportTuning(t *testing.T) {
+	t.Setenv("HTTP_MAX_IDLE_CONNS_PER_HOST", "7")
+	t.Setenv("HTTP_IDLE_CONN_TIMEOUT", "15s")
+
+	transport := newOutboundTransport()
+	if transport.MaxIdleConnsPerHost != 7 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want 7", transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != 15*time.Second {
+		t.Errorf("IdleConnTimeout = %s, want 15s", transport.IdleConnTimeout)
+	}
+	if transport.Proxy == nil {
+		t.Error("proxies from the environment should be honored")
+	}
+}
+
+func TestProxyConfig(t *testing.T) {
+	config := newProxyConfig("http://corp-proxy:3128", []string{
+		"*.myshopify.com=http://shopify-proxy:8080",
+		"ipinfo.io=direct",
+		"broken",
+		"example.com=ftp://nope",
+	})
+	if len(config.rules) != 2 {
+		t.Fatalf("rules = %d, want 2 valid entries", len(config.rules))
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.myshopify.com/admin/api/customers.json", "http://shopify-proxy:8080"},
+		{"https://myshopify.com/", "http://corp-proxy:3128"},
+		{"https://ipinfo.io/8.8.8.8/json", ""},
+		{"https://api.abuseipdb.com/api/v2/check", "http://corp-proxy:3128"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		proxy, err := config.proxy(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		got := ""
+		if proxy != nil {
+			got = proxy.String()
+		}
+		if got != tt.want {
+			t.Errorf("proxy for %s = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestEgressAllowlist(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &egressTransport{next: http.DefaultTransport, allowed: []string{"127.0.0.1"}}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("allowed host refused: %v", err)
+	}
+	resp.Body.Close()
+
+	client.Transport = &egressTransport{next: http.DefaultTransport, allowed: []string{"*.myshopify.com", "ipinfo.io"}}
+	if _, err := client.Get(server.URL); err == nil || !strings.Contains(err.Error(), "EGRESS_ALLOWLIST") {
+		t.Errorf("err = %v, want the request refused by the allowlist", err)
+	}
+}
+
+func TestEgressOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request should leave the process in offline mode")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &egressTransport{next: http.DefaultTransport, allowed: []string{"127.0.0.1"}, offline: true}}
+	if _, err := client.Get(server.URL); err == nil || !strings.Contains(err.Error(), "offline mode") {
+		t.Errorf("err = %v, want the request refused in offline mode", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// piiMinimization strips names, emails and Shopify IDs from customer analysis
+// output and the database, keeping a hashed customer ID and country data
+var piiMinimization = getEnv("PII_MINIMIZATION", "false") == "true"
+
+// piiHashKey keys the customer ID hash, so hashes cannot be reversed by
+// hashing every possible ID
+var piiHashKey = loadPIIHashKey()
+
+// loadPIIHashKey reads PII_HASH_KEY. Without it a random key is used, so
+// hashes change on restart and stored customers can no longer be matched to
+// GDPR requests.
+func loadPIIHashKey() []byte {
+	if key := getEnv("PII_HASH_KEY", ""); key != "" {
+		return []byte(key)
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	if piiMinimization {
+		fmt.Println("⚠️  PII_MINIMIZATION is on without PII_HASH_KEY: customer hashes will change on restart")
+	}
+	return key
+}
+
+// customerHash is the keyed hash that stands in for a Shopify customer ID
+func customerHash(id int64) string {
+	mac := hmac.New(sha256.New, piiHashKey)
+	mac.Write([]byte(strconv.FormatInt(id, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// minimizeCustomers replaces each customer's ID with its hash and drops the
+// name, email, address IDs and geocoded cities and zips. Email hints and
+// address verification must run before this.
+func minimizeCustomers(customers []CustomerCountry) {
+	for i := range customers {
+		c := &customers[i]
+		c.CustomerHash = customerHash(c.CustomerID)
+		c.CustomerID, c.CustomerName, c.CustomerEmail = 0, "", ""
+		for j := range c.AddressIssues {
+			c.AddressIssues[j].AddressID = 0
+			delete(c.AddressIssues[j].Values, "city")
+			delete(c.AddressIssues[j].Values, "zip")
+		}
+	}
+}
+
+// matchesCustomer reports whether a customer record is the one with a Shopify
+// ID, whether or not it was minimized
+func matchesCustomer(customer CustomerCountry, id int64) bool {
+	if customer.CustomerHash != "" {
+		return customer.CustomerHash == customerHash(id)
+	}
+	return customer.CustomerID == id
+}
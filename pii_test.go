@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMinimizeCustomers(t *testing.T) {
+	customers := []CustomerCountry{{
+		CustomerID:     42,
+		CustomerName:   "Anna Schmidt",
+		CustomerEmail:  "anna@example.de",
+		CountryCodes:   []string{"DE"},
+		DefaultCountry: "DE",
+		AddressIssues:  []AddressIssue{{AddressID: 7, Problem: "conflict", Values: map[string]string{"country_code": "DE"}}},
+		CountryHints:   []CountryHint{{CountryCode: "DE", Source: "email_tld", Confidence: "low"}},
+	}}
+	minimizeCustomers(customers)
+
+	c := customers[0]
+	if c.CustomerHash != customerHash(42) || len(c.CustomerHash) != 64 {
+		t.Errorf("CustomerHash = %q, want the hash of 42", c.CustomerHash)
+	}
+	if c.DefaultCountry != "DE" || len(c.CountryHints) != 1 {
+		t.Errorf("country data = %q %v, want it kept", c.DefaultCountry, c.CountryHints)
+	}
+	data, _ := json.Marshal(c)
+	for _, pii := range []string{"Anna", "anna@", `"customer_id"`, `"address_id"`} {
+		if strings.Contains(string(data), pii) {
+			t.Errorf("minimized customer %s contains %s", data, pii)
+		}
+	}
+}
+
+func TestMatchesCustomer(t *testing.T) {
+	tests := []struct {
+		name     string
+		customer CustomerCountry
+		id       int64
+		want     bool
+	}{
+		{"same ID", CustomerCountry{CustomerID: 42}, 42, true},
+		{"other ID", CustomerCountry{CustomerID: 42}, 43, false},
+		{"same hash", CustomerCountry{CustomerHash: customerHash(42)}, 42, true},
+		{"other hash", CustomerCountry{CustomerHash: customerHash(42)}, 43, false},
+		{"minimized never matches by zero ID", CustomerCountry{CustomerHash: customerHash(42)}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesCustomer(tt.customer, tt.id); got != tt.want {
+				t.Errorf("matchesCustomer = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// planTTL is how long a plan can be applied after it was made
+const planTTL = 30 * time.Minute
+
+// planImpactWindow is the traffic window used to estimate a plan's impact
+const planImpactWindow = "24h"
+
+// errStalePlan rejects applying a plan made against a policy that has since changed
+var errStalePlan = errors.New("the blocking policy changed after the plan was made; create a new plan")
+
+// CountryChange is a country whose handling a plan changes. Before and After
+// are block, challenge, monitor, allow or conditional (blocked only for some
+// clients, e.g. by reputation); Requests and UniqueIPs are its
+// traffic over the impact window.
+type CountryChange struct {
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country_name,omitempty"`
+	Before      string `json:"before"`
+	After       string `json:"after"`
+	Requests    int    `json:"requests"`
+	UniqueIPs   int    `json:"unique_ips"`
+}
+
+// PlanChanges lists the IDs of added, removed and changed rules or exemptions
+type PlanChanges struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// PlanImpact estimates how much recent traffic a plan would newly reject or let through
+type PlanImpact struct {
+	Window            string `json:"window"`
+	RejectedRequests  int    `json:"newly_rejected_requests"`
+	RejectedUniqueIPs int    `json:"newly_rejected_unique_ips"`
+	AllowedRequests   int    `json:"newly_allowed_requests"`
+	AllowedUniqueIPs  int    `json:"newly_allowed_unique_ips"`
+}
+
+// PolicyPlan is the difference between the active policy and a proposed
+// one. Applying it replaces the policy only if the policy has not changed
+// in the meantime.
+type PolicyPlan struct {
+	ID              string          `json:"id"`
+	CreatedAt       string          `json:"created_at"`
+	ExpiresAt       string          `json:"expires_at"`
+	Principal       string          `json:"principal"`
+	NoChanges       bool            `json:"no_changes"`
+	Countries       []CountryChange `json:"countries"`
+	NetworksAdded   []string        `json:"networks_added"`
+	NetworksRemoved []string        `json:"networks_removed"`
+	Rules           PlanChanges     `json:"rules"`
+	Exemptions      PlanChanges     `json:"exemptions"`
+	Settings        []string        `json:"settings_changed"`
+	Impact          PlanImpact      `json:"impact"`
+
+	expires time.Time
+	base    *geoblock.Policy
+	desired *geoblock.Policy
+}
+
+type PlanApplyRequest struct {
+	PlanID string `json:"plan_id"`
+}
+
+type PlanApplyResponse struct {
+	Success          bool     `json:"success"`
+	Message          string   `json:"message"`
+	Version          int      `json:"version"`
+	BlockedCountries []string `json:"blocked_countries"`
+}
+
+// policyPlans holds plans until they are applied or expire
+var policyPlans = struct {
+	mu    sync.Mutex
+	plans map[string]*PolicyPlan
+}{plans: make(map[string]*PolicyPlan)}
+
+// countryHandling is what a store does to requests from a country right now
+func countryHandling(store *geoblock.Store, code string) string {
+	match := store.Match(code)
+	switch {
+	case match != nil && match.Conditional():
+		if store.IsBlocked(code) {
+			return "block"
+		}
+		return "conditional"
+	case match == nil || match.Fallback == geoblock.FallbackAllow:
+		return "allow"
+	case match.Monitor:
+		return "monitor"
+	case match.Challenges():
+		return "challenge"
+	}
+	return "block"
+}
+
+// rejects reports whether a handling keeps requests from reaching the store
+func rejects(handling string) bool {
+	return handling == "block" || handling == "challenge"
+}
+
+// diffByID compares two lists of items keyed by ID, serializing them to find changes
+func diffByID[T any](before, after []T, id func(T) string) PlanChanges {
+	changes := PlanChanges{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	old := make(map[string][]byte, len(before))
+	for _, item := range before {
+		old[id(item)], _ = json.Marshal(item)
+	}
+	seen := make(map[string]bool, len(after))
+	for _, item := range after {
+		key := id(item)
+		seen[key] = true
+		data, _ := json.Marshal(item)
+		previous, ok := old[key]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, key)
+		case string(previous) != string(data):
+			changes.Changed = append(changes.Changed, key)
+		}
+	}
+	for _, item := range before {
+		if !seen[id(item)] {
+			changes.Removed = append(changes.Removed, id(item))
+		}
+	}
+	return changes
+}
+
+// changedSettings names the policy-wide settings that differ between two policies
+func changedSettings(before, after *geoblock.Policy) []string {
+	settings := []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"monitor", before.Monitor, after.Monitor},
+		{"unknown_country", before.UnknownCountry, after.UnknownCountry},
+		{"block_response", before.BlockResponse, after.BlockResponse},
+		{"rate_limits", before.RateLimits, after.RateLimits},
+	}
+	changed := []string{}
+	for _, setting := range settings {
+		left, _ := json.Marshal(setting.before)
+		right, _ := json.Marshal(setting.after)
+		if string(left) != string(right) {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
+
+// planPolicyChange compares the current and desired policies, estimating
+// the impact of country changes from traffic over the impact window
+func planPolicyChange(current, desired *geoblock.Policy, traffic []CountryTraffic) (*PolicyPlan, error) {
+	before := geoblock.NewStore(geoblock.WithBlockPagesDir(blockPagesDir))
+	if _, err := before.ReplacePolicy(current); err != nil {
+		return nil, err
+	}
+	after := geoblock.NewStore(geoblock.WithBlockPagesDir(blockPagesDir))
+	if _, err := after.ReplacePolicy(desired); err != nil {
+		return nil, err
+	}
+
+	byCountry := make(map[string]CountryTraffic, len(traffic))
+	for _, entry := range traffic {
+		byCountry[entry.CountryCode] = entry
+	}
+
+	plan := &PolicyPlan{
+		Countries: []CountryChange{},
+		Impact:    PlanImpact{Window: planImpactWindow},
+		base:      current,
+		desired:   desired,
+	}
+	seen := make(map[string]bool)
+	for _, code := range append(before.Countries(), after.Countries()...) {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		change := CountryChange{CountryCode: code, Before: countryHandling(before, code), After: countryHandling(after, code)}
+		if change.Before == change.After {
+			continue
+		}
+		change.CountryName, _ = getCountryName(code)
+		change.Requests = byCountry[code].Requests
+		change.UniqueIPs = byCountry[code].UniqueIPs
+		switch {
+		case rejects(change.After) && !rejects(change.Before):
+			plan.Impact.RejectedRequests += change.Requests
+			plan.Impact.RejectedUniqueIPs += change.UniqueIPs
+		case rejects(change.Before) && !rejects(change.After):
+			plan.Impact.AllowedRequests += change.Requests
+			plan.Impact.AllowedUniqueIPs += change.UniqueIPs
+		}
+		plan.Countries = append(plan.Countries, change)
+	}
+	sort.Slice(plan.Countries, func(i, j int) bool { return plan.Countries[i].CountryCode < plan.Countries[j].CountryCode })
+
+	plan.NetworksAdded, plan.NetworksRemoved = diffCountries(current.BlockedNetworks, desired.BlockedNetworks)
+	if plan.NetworksAdded == nil {
+		plan.NetworksAdded = []string{}
+	}
+	if plan.NetworksRemoved == nil {
+		plan.NetworksRemoved = []string{}
+	}
+	plan.Rules = diffByID(current.Rules, desired.Rules, func(rule geoblock.Rule) string { return rule.ID })
+	plan.Exemptions = diffByID(current.Exemptions, desired.Exemptions, func(exemption geoblock.Exemption) string { return exemption.ID })
+	plan.Settings = changedSettings(current, desired)
+	plan.NoChanges = samePolicy(current, desired)
+	return plan, nil
+}
+
+// storePlan keeps a plan until it expires, dropping expired ones
+func storePlan(plan *PolicyPlan) {
+	policyPlans.mu.Lock()
+	defer policyPlans.mu.Unlock()
+
+	now := time.Now()
+	for id, stored := range policyPlans.plans {
+		if now.After(stored.expires) {
+			delete(policyPlans.plans, id)
+		}
+	}
+	policyPlans.plans[plan.ID] = plan
+}
+
+// takePlan removes and returns an unexpired plan
+func takePlan(id string) (*PolicyPlan, bool) {
+	policyPlans.mu.Lock()
+	defer policyPlans.mu.Unlock()
+
+	plan, ok := policyPlans.plans[id]
+	delete(policyPlans.plans, id)
+	if !ok || time.Now().After(plan.expires) {
+		return nil, false
+	}
+	return plan, true
+}
+
+// handlePlanPolicy compares a proposed policy document, as exported by
+// /block-countries/export?format=json|yaml, with the active policy. Nothing
+// changes until the returned plan is applied.
+func handlePlanPolicy(w http.ResponseWriter, r *http.Request) {
+	format, err := policyDocumentFormat(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicyDocumentSize))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("Failed to read policy document: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	doc, err := parsePolicyDocument(data, format)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	plan, err := planPolicyChange(blocklist.Policy(), &doc.Policy, trafficAnalytics.Summary(trafficWindows[planImpactWindow], now))
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	plan.ID = newRequestID()
+	plan.Principal = changePrincipal(r)
+	plan.CreatedAt = now.Format(time.RFC3339)
+	plan.expires = now.Add(planTTL)
+	plan.ExpiresAt = plan.expires.Format(time.RFC3339)
+	if !plan.NoChanges {
+		storePlan(plan)
+	}
+
+	fmt.Printf("📋 Policy plan %s by %s: %d country changes, would newly reject %d requests from the last %s\n",
+		plan.ID, plan.Principal, len(plan.Countries), plan.Impact.RejectedRequests, plan.Impact.Window)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// handleApplyPlan replaces the policy with the one a plan proposed, as long
+// as the policy is still the one the plan was made against
+func handleApplyPlan(w http.ResponseWriter, r *http.Request) {
+	var req PlanApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PlanID == "" {
+		writeError(w, r, "Request body must be {\"plan_id\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+	plan, ok := takePlan(req.PlanID)
+	if !ok {
+		writeError(w, r, fmt.Sprintf("Plan %s not found or expired", req.PlanID), http.StatusNotFound)
+		return
+	}
+
+	previous, version, err := updatePolicyVersion(r, "apply-plan", func(policy *geoblock.Policy) error {
+		if !samePolicy(policy, plan.base) {
+			return errStalePlan
+		}
+		*policy = *plan.desired.Clone()
+		return nil
+	})
+	switch {
+	case errors.Is(err, errStalePlan):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "apply-plan", map[string]interface{}{
+		"plan_id":    plan.ID,
+		"planned_by": plan.Principal,
+		"version":    version.Version,
+		"before":     previous,
+		"after":      blocklist.Countries(),
+		"countries":  plan.Countries,
+	})
+	fmt.Printf("✅ Applied policy plan %s as version %d\n", plan.ID, version.Version)
+
+	response := PlanApplyResponse{
+		Success:          true,
+		Message:          fmt.Sprintf("Applied plan %s as version %d", plan.ID, version.Version),
+		Version:          version.Version,
+		BlockedCountries: blocklist.Countries(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+func TestPlanPolicyChange(t *testing.T) {
+	current := &geoblock.Policy{
+		BlockedCountries: []string{"RU", "KP"},
+		Rules: []geoblock.Rule{
+			{ID: "borderline", Countries: []string{"BR"}, Challenge: true},
+			{ID: "old", Countries: []string{"CN"}},
+		},
+		Exemptions: []geoblock.Exemption{{ID: "office", Networks: []string{"203.0.113.0/24"}}},
+	}
+	desired := &geoblock.Policy{
+		BlockedCountries: []string{"RU", "IR"},
+		BlockedNetworks:  []string{"198.51.100.0/24"},
+		Rules: []geoblock.Rule{
+			{ID: "borderline", Countries: []string{"BR"}},
+			{ID: "trial", Countries: []string{"VN"}, Monitor: true},
+		},
+		Monitor: false,
+	}
+	traffic := []CountryTraffic{
+		{CountryCode: "BR", Requests: 100, UniqueIPs: 40},
+		{CountryCode: "IR", Requests: 10, UniqueIPs: 3},
+		{CountryCode: "KP", Requests: 2, UniqueIPs: 1},
+		{CountryCode: "CN", Requests: 7, UniqueIPs: 5},
+		{CountryCode: "US", Requests: 500, UniqueIPs: 200},
+	}
+
+	plan, err := planPolicyChange(current, desired, traffic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, change := range plan.Countries {
+		got[change.CountryCode] = change.Before + "->" + change.After
+	}
+	want := map[string]string{
+		"BR": "challenge->block",
+		"CN": "block->allow",
+		"IR": "allow->block",
+		"KP": "block->allow",
+		"VN": "allow->monitor",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("country changes = %v, want %v", got, want)
+	}
+
+	// BR was already rejected by its challenge, so only IR is newly rejected
+	wantImpact := PlanImpact{Window: "24h", RejectedRequests: 10, RejectedUniqueIPs: 3, AllowedRequests: 9, AllowedUniqueIPs: 6}
+	if plan.Impact != wantImpact {
+		t.Errorf("impact = %+v, want %+v", plan.Impact, wantImpact)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"rules", plan.Rules, PlanChanges{Added: []string{"trial"}, Removed: []string{"old"}, Changed: []string{"borderline"}}},
+		{"exemptions", plan.Exemptions, PlanChanges{Added: []string{}, Removed: []string{"office"}, Changed: []string{}}},
+		{"networks added", plan.NetworksAdded, []string{"198.51.100.0/24"}},
+		{"networks removed", plan.NetworksRemoved, []string{}},
+		{"settings", plan.Settings, []string{}},
+		{"no changes", plan.NoChanges, false},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	same, err := planPolicyChange(current, current.Clone(), traffic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same.NoChanges || len(same.Countries) != 0 {
+		t.Errorf("identical policies: no_changes = %v, countries = %v", same.NoChanges, same.Countries)
+	}
+}
+
+func TestTakePlan(t *testing.T) {
+	storePlan(&PolicyPlan{ID: "fresh", expires: time.Now().Add(time.Minute)})
+	storePlan(&PolicyPlan{ID: "expired", expires: time.Now().Add(-time.Minute)})
+
+	if _, ok := takePlan("expired"); ok {
+		t.Error("expired plan was returned")
+	}
+	if _, ok := takePlan("fresh"); !ok {
+		t.Error("fresh plan was not returned")
+	}
+	if _, ok := takePlan("fresh"); ok {
+		t.Error("plan could be applied twice")
+	}
+}
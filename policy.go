@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// normalizePolicy validates every country and network in the policy and assigns missing rule and exemption IDs
+func normalizePolicy(p *geoblock.Policy) error {
+	countries, invalid := normalizeCountryCodes(p.BlockedCountries)
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid blocked country %q: %s", invalid[0].Input, invalid[0].Error)
+	}
+	p.BlockedCountries = countries
+
+	networks, err := normalizeNetworks(p.BlockedNetworks)
+	if err != nil {
+		return err
+	}
+	p.BlockedNetworks = networks
+
+	ids := make(map[string]bool, len(p.Rules))
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.ID == "" {
+			rule.ID = fmt.Sprintf("rule-%d", i+1)
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		ids[rule.ID] = true
+		countries, invalid := normalizeCountryCodes(rule.Countries)
+		if len(invalid) > 0 {
+			return fmt.Errorf("rule %s: invalid country %q: %s", rule.ID, invalid[0].Input, invalid[0].Error)
+		}
+		rule.Countries = countries
+		if len(rule.ExceptCountries) > 0 {
+			except, invalid := normalizeCountryCodes(rule.ExceptCountries)
+			if len(invalid) > 0 {
+				return fmt.Errorf("rule %s: invalid excepted country %q: %s", rule.ID, invalid[0].Input, invalid[0].Error)
+			}
+			rule.ExceptCountries = except
+		}
+		if rule.Networks, err = normalizeNetworks(rule.Networks); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		rule.Hosts = normalizeHosts(rule.Hosts)
+	}
+
+	exemptionIDs := make(map[string]bool, len(p.Exemptions))
+	for i := range p.Exemptions {
+		exemption := &p.Exemptions[i]
+		if exemption.ID == "" {
+			exemption.ID = fmt.Sprintf("exemption-%d", i+1)
+		}
+		if exemptionIDs[exemption.ID] {
+			return fmt.Errorf("duplicate exemption id %q", exemption.ID)
+		}
+		exemptionIDs[exemption.ID] = true
+		if exemption.Networks, err = normalizeNetworks(exemption.Networks); err != nil {
+			return fmt.Errorf("exemption %s: %w", exemption.ID, err)
+		}
+		principals := exemption.Principals[:0]
+		for _, principal := range exemption.Principals {
+			if principal = strings.TrimSpace(principal); principal != "" && !slices.Contains(principals, principal) {
+				principals = append(principals, principal)
+			}
+		}
+		exemption.Principals = principals
+		if len(exemption.Networks) == 0 && len(exemption.Principals) == 0 {
+			return fmt.Errorf("exemption %s: needs at least one network or principal", exemption.ID)
+		}
+	}
+
+	for i := range p.RateLimits {
+		limit := &p.RateLimits[i]
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("rate limit %d: %w", i+1, err)
+		}
+		if len(limit.Countries) == 1 && limit.Countries[0] == "*" {
+			continue
+		}
+		countries, invalid := normalizeCountryCodes(limit.Countries)
+		if len(invalid) > 0 {
+			return fmt.Errorf("rate limit %d: invalid country %q: %s", i+1, invalid[0].Input, invalid[0].Error)
+		}
+		limit.Countries = countries
+	}
+	return normalizeCountryGroups(p)
+}
+
+// normalizeHosts lowercases rule hosts, strips ports and drops duplicates;
+// the store rejects what is still not a domain or *.domain
+func normalizeHosts(hosts []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if host = geoblock.NormalizeHost(host); !seen[host] {
+			seen[host] = true
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized
+}
+
+// normalizeNetworks canonicalizes IPv4 and IPv6 CIDR blocks and drops duplicates.
+// A bare address is treated as a single-host network (/32 or /128).
+func normalizeNetworks(networks []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool, len(networks))
+	for _, input := range networks {
+		value := strings.TrimSpace(input)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", input)
+			}
+			if ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", input)
+		}
+		if cidr := network.String(); !seen[cidr] {
+			seen[cidr] = true
+			normalized = append(normalized, cidr)
+		}
+	}
+	return normalized, nil
+}
+
+type ReloadResponse struct {
+	Success          bool     `json:"success"`
+	Message          string   `json:"message"`
+	BlockedCountries []string `json:"blocked_countries"`
+	ReloadedAt       string   `json:"reloaded_at"`
+}
+
+// policyFilePath is where the blocking policy is persisted and reloaded from
+var policyFilePath = getEnv("BLOCKING_POLICY_FILE", "blocking-policy.json")
+
+// blockPagesDir holds the HTML block pages that policies may reference by name
+var blockPagesDir = getEnv("BLOCK_PAGES_DIR", "block-pages")
+
+// blocklist is the active blocking policy; every change is persisted to the
+// policy file and shared with the other replicas
+var blocklist = geoblock.NewStore(
+	geoblock.WithPersist(persistPolicy),
+	geoblock.WithBlockPagesDir(blockPagesDir),
+)
+
+// loadPolicy reads the blocking policy from disk
+func loadPolicy(path string) (*geoblock.Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy geoblock.Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+	}
+
+	if err := normalizePolicy(&policy); err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
+
+// persistPolicy saves a changed policy to the policy file and the database and,
+// with shared state, publishes it to the other replicas. A Redis failure only
+// logs: the change is already saved.
+func persistPolicy(policy *geoblock.Policy) error {
+	if err := savePolicy(policyFilePath, policy); err != nil {
+		return err
+	}
+	if err := storePolicy(policy); err != nil {
+		return err
+	}
+	if err := sharedState.PublishPolicy(policy); err != nil {
+		fmt.Printf("⚠️  Blocking policy saved locally but not shared: %v\n", err)
+	}
+	return nil
+}
+
+// savePolicy writes the blocking policy to disk, replacing the previous file atomically
+func savePolicy(path string, policy *geoblock.Policy) error {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode policy: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".policy-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temp policy file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write policy: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write policy: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// updateErrorStatus maps a geoblock.Store.Update error to an HTTP status code
+func updateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, geoblock.ErrInvalidPolicy):
+		return http.StatusBadRequest
+	case errors.Is(err, errSelfLockout):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// reloadPolicy re-reads the policy file and swaps in the new blocklist,
+// recording it in the blocklist history if it changed. r is nil when the
+// server reloads on its own. A missing file is treated as an empty policy.
+func reloadPolicy(r *http.Request) (*geoblock.Policy, error) {
+	policy, err := loadPolicy(policyFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		policy = &geoblock.Policy{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	policyChangeMu.Lock()
+	defer policyChangeMu.Unlock()
+	if _, err := blocklist.ReplacePolicy(policy); err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", policyFilePath, err)
+	}
+	recordPolicyVersion(r, "reload-policy", policy)
+	if err := storePolicy(policy); err != nil {
+		fmt.Printf("⚠️  Reloaded blocking policy not stored: %v\n", err)
+	}
+	if err := sharedState.PublishPolicy(policy); err != nil {
+		fmt.Printf("⚠️  Reloaded blocking policy not shared: %v\n", err)
+	}
+	fmt.Printf("🔄 Loaded blocking policy from %s: %d countries blocked, %d rules\n", policyFilePath, len(policy.BlockedCountries), len(policy.Rules))
+	return policy, nil
+}
+
+// watchReloadSignal reloads the blocking policy whenever the process receives SIGHUP
+func watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			fmt.Println("📨 SIGHUP received, reloading blocking policy...")
+			if _, err := reloadPolicy(nil); err != nil {
+				fmt.Printf("❌ Policy reload failed, keeping current rules: %v\n", err)
+			}
+		}
+	}()
+}
+
+// handleReload re-reads the blocking policy without restarting the server
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	policy, err := reloadPolicy(r)
+	if err != nil {
+		fmt.Printf("❌ Policy reload failed, keeping current rules: %v\n", err)
+		writeError(w, r, fmt.Sprintf("Failed to reload policy: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "reload-policy", map[string]interface{}{
+		"source":            policyFilePath,
+		"blocked_countries": policy.BlockedCountries,
+	})
+
+	response := ReloadResponse{
+		Success:          true,
+		Message:          fmt.Sprintf("Reloaded %d blocked countries from %s", len(policy.BlockedCountries), policyFilePath),
+		BlockedCountries: policy.BlockedCountries,
+		ReloadedAt:       time.Now().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type MonitorModeRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type MonitorModeResponse struct {
+	Enabled        bool     `json:"enabled"`
+	MonitoredRules []string `json:"monitored_rules"`
+}
+
+// monitorModeStatus reports the global monitor flag and the rules monitored on their own
+func monitorModeStatus(policy *geoblock.Policy) MonitorModeResponse {
+	response := MonitorModeResponse{Enabled: policy.Monitor, MonitoredRules: []string{}}
+	for _, rule := range policy.Rules {
+		if rule.Monitor {
+			response.MonitoredRules = append(response.MonitoredRules, rule.ID)
+		}
+	}
+	return response
+}
+
+// handleGetMonitorMode reports whether the blocking policy only monitors
+func handleGetMonitorMode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(monitorModeStatus(blocklist.Policy()))
+}
+
+// handleSetMonitorMode switches the whole policy between monitoring and enforcing.
+// Rules with their own monitor flag stay in monitor mode either way.
+func handleSetMonitorMode(w http.ResponseWriter, r *http.Request) {
+	var req MonitorModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var updated *geoblock.Policy
+	_, err := updatePolicy(r, "monitor-mode", func(policy *geoblock.Policy) error {
+		policy.Monitor = req.Enabled
+		updated = policy
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("❌ Error saving blocking policy: %v\n", err)
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+	recordAudit(r, "monitor-mode", map[string]interface{}{"enabled": req.Enabled})
+
+	if req.Enabled {
+		fmt.Println("👀 Monitor mode enabled: matching requests are logged but not blocked")
+	} else {
+		fmt.Println("🛡️  Monitor mode disabled: blocking is enforced")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(monitorModeStatus(updated))
+}
+
+type UnknownCountryRequest struct {
+	Fallback geoblock.Fallback `json:"fallback"`
+}
+
+type UnknownCountryResponse struct {
+	Fallback   geoblock.Fallback            `json:"fallback"`
+	FailClosed bool                         `json:"fail_closed"`
+	Rules      map[string]geoblock.Fallback `json:"rules"`
+}
+
+// unknownCountryStatus reports the policy's unknown-country fallback and the
+// rules that set their own. Without a policy fallback, GEO_FAILURE_MODE decides.
+func unknownCountryStatus(policy *geoblock.Policy) UnknownCountryResponse {
+	response := UnknownCountryResponse{Fallback: policy.UnknownCountry, FailClosed: geoFailClosed, Rules: map[string]geoblock.Fallback{}}
+	for _, rule := range policy.Rules {
+		if rule.UnknownCountry != "" {
+			response.Rules[rule.ID] = rule.UnknownCountry
+		}
+	}
+	return response
+}
+
+// handleGetUnknownCountry reports how requests of an unknown country are handled
+func handleGetUnknownCountry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(unknownCountryStatus(blocklist.Policy()))
+}
+
+// handleSetUnknownCountry sets whether requests whose country could not be
+// determined are allowed, blocked or challenged. An empty fallback returns
+// the decision to GEO_FAILURE_MODE.
+func handleSetUnknownCountry(w http.ResponseWriter, r *http.Request) {
+	var req UnknownCountryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !req.Fallback.Valid() {
+		writeError(w, r, fmt.Sprintf("Invalid fallback %q: use allow, block or challenge", req.Fallback), http.StatusBadRequest)
+		return
+	}
+
+	var previous geoblock.Fallback
+	var updated *geoblock.Policy
+	_, err := updatePolicy(r, "unknown-country", func(policy *geoblock.Policy) error {
+		previous = policy.UnknownCountry
+		policy.UnknownCountry = req.Fallback
+		updated = policy
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("❌ Error saving blocking policy: %v\n", err)
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+	recordAudit(r, "unknown-country", map[string]interface{}{"before": previous, "after": req.Fallback})
+	fmt.Printf("❔ Unknown-country fallback set to %q\n", req.Fallback)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(unknownCountryStatus(updated))
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"shopify-customers/geoblock"
+)
+
+// policyDocumentVersion is the format version of exported policy documents
+const policyDocumentVersion = 1
+
+// maxPolicyDocumentSize bounds an imported policy document
+const maxPolicyDocumentSize = 1 << 20
+
+// PolicyDocument is the blocking policy (countries, networks, rules,
+// exemptions and settings) together with the presets its rules were created
+// from, so it can be kept in git and promoted between environments
+type PolicyDocument struct {
+	FormatVersion int    `json:"format_version"`
+	ExportedAt    string `json:"exported_at,omitempty"`
+	geoblock.Policy
+	Presets []CountryPreset `json:"presets,omitempty"`
+}
+
+type PolicyImportResponse struct {
+	Success          bool     `json:"success"`
+	Message          string   `json:"message"`
+	DryRun           bool     `json:"dry_run,omitempty"`
+	Version          int      `json:"version,omitempty"`
+	BlockedCountries []string `json:"blocked_countries"`
+	Rules            []string `json:"rules"`
+	Exemptions       []string `json:"exemptions"`
+	Presets          []string `json:"presets"`
+}
+
+// exportPolicyDocument builds a document of the active policy and the presets its rules use
+func exportPolicyDocument() PolicyDocument {
+	doc := PolicyDocument{
+		FormatVersion: policyDocumentVersion,
+		ExportedAt:    time.Now().UTC().Format(time.RFC3339),
+		Policy:        *blocklist.Policy(),
+	}
+	seen := make(map[string]bool)
+	for _, rule := range doc.Rules {
+		if rule.Preset == "" || seen[rule.Preset] {
+			continue
+		}
+		seen[rule.Preset] = true
+		if preset, ok := getPreset(rule.Preset); ok {
+			doc.Presets = append(doc.Presets, preset)
+		}
+	}
+	sort.Slice(doc.Presets, func(i, j int) bool { return doc.Presets[i].ID < doc.Presets[j].ID })
+	return doc
+}
+
+// marshalPolicyDocument renders a document as indented JSON or as YAML with
+// the same field names
+func marshalPolicyDocument(doc PolicyDocument, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil || format == "json" {
+		return data, err
+	}
+
+	// JSON is YAML, so going through it keeps the json tags, omitted fields
+	// and field order; only the flow style has to be reset to block style
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// blockStyle clears the JSON flow and quoting styles from a YAML node tree
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// parsePolicyDocument decodes a JSON or YAML document and validates its
+// policy and presets
+func parsePolicyDocument(data []byte, format string) (*PolicyDocument, error) {
+	if format == "yaml" {
+		var generic interface{}
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		converted, err := json.Marshal(generic)
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		data = converted
+	}
+
+	var doc PolicyDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	if doc.FormatVersion != policyDocumentVersion {
+		return nil, fmt.Errorf("unsupported format_version %d, expected %d", doc.FormatVersion, policyDocumentVersion)
+	}
+	if err := normalizePolicy(&doc.Policy); err != nil {
+		return nil, err
+	}
+
+	// parsePresets validates and normalizes the presets like a preset refresh
+	if len(doc.Presets) > 0 {
+		raw, err := json.Marshal(doc.Presets)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Presets, err = parsePresets(raw); err != nil {
+			return nil, err
+		}
+	}
+	return &doc, nil
+}
+
+// policyDocumentFormat picks json or yaml from ?format=, then the Content-Type
+func policyDocumentFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json", "yaml":
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid format %q: use json or yaml", format)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return "yaml", nil
+	}
+	return "json", nil
+}
+
+// writePolicyDocument answers an export request for the json or yaml format
+func writePolicyDocument(w http.ResponseWriter, r *http.Request, format string) {
+	data, err := marshalPolicyDocument(exportPolicyDocument(), format)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("Failed to export blocking policy: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "application/json"
+	if format == "yaml" {
+		contentType = "application/yaml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "blocking-policy."+format))
+	w.Write(data)
+	fmt.Printf("📤 Exported blocking policy as %s\n", format)
+}
+
+// storeImportedPresets adds imported presets to the preset list and to
+// PRESETS_FILE, so rules created from them can be refreshed after a restart
+func storeImportedPresets(imported []CountryPreset) error {
+	presetMu.Lock()
+	for i := range imported {
+		preset := imported[i]
+		presets[preset.ID] = &preset
+	}
+	presetMu.Unlock()
+
+	stored := map[string]CountryPreset{}
+	data, err := os.ReadFile(presetsFilePath)
+	switch {
+	case err == nil:
+		list, err := parsePresets(data)
+		if err != nil {
+			return fmt.Errorf("presets file %s: %w", presetsFilePath, err)
+		}
+		for _, preset := range list {
+			stored[preset.ID] = preset
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	for _, preset := range imported {
+		stored[preset.ID] = preset
+	}
+
+	list := make([]CountryPreset, 0, len(stored))
+	for _, preset := range stored {
+		list = append(list, preset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err = json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(presetsFilePath, data, 0o644)
+}
+
+// handleImportPolicy replaces the blocking policy with a JSON or YAML policy
+// document, or the blocked countries with a CSV or XLSX country list. With
+// ?dry_run=true the upload is only validated.
+func handleImportPolicy(w http.ResponseWriter, r *http.Request) {
+	if data, format, ok, err := countryListUpload(w, r); ok {
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handleImportCountryList(w, r, data, format)
+		return
+	}
+
+	format, err := policyDocumentFormat(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicyDocumentSize))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("Failed to read policy document: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	doc, err := parsePolicyDocument(data, format)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := PolicyImportResponse{
+		Success:          true,
+		DryRun:           r.URL.Query().Get("dry_run") == "true",
+		BlockedCountries: doc.BlockedCountries,
+		Rules:            []string{},
+		Exemptions:       []string{},
+		Presets:          []string{},
+	}
+	for _, rule := range doc.Rules {
+		response.Rules = append(response.Rules, rule.ID)
+	}
+	for _, exemption := range doc.Exemptions {
+		response.Exemptions = append(response.Exemptions, exemption.ID)
+	}
+	for _, preset := range doc.Presets {
+		response.Presets = append(response.Presets, preset.ID)
+	}
+
+	if response.DryRun {
+		// Compiling checks what normalizing cannot, such as block responses and schedules
+		candidate := geoblock.NewStore(geoblock.WithBlockPagesDir(blockPagesDir))
+		if _, err := candidate.ReplacePolicy(&doc.Policy); err != nil {
+			writeError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response.Message = "Policy document is valid; nothing was changed"
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	previous, version, err := updatePolicyVersion(r, "import-policy", func(policy *geoblock.Policy) error {
+		*policy = doc.Policy
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+	if len(doc.Presets) > 0 {
+		if err := storeImportedPresets(doc.Presets); err != nil {
+			fmt.Printf("⚠️  Imported presets not saved to %s: %v\n", presetsFilePath, err)
+		}
+	}
+
+	recordAudit(r, "import-policy", map[string]interface{}{
+		"format":     format,
+		"version":    version.Version,
+		"before":     previous,
+		"after":      doc.BlockedCountries,
+		"rules":      response.Rules,
+		"exemptions": response.Exemptions,
+		"presets":    response.Presets,
+	})
+	fmt.Printf("📥 Imported blocking policy from %s: %d countries, %d rules, %d exemptions\n",
+		format, len(doc.BlockedCountries), len(doc.Rules), len(doc.Exemptions))
+
+	response.Version = version.Version
+	response.Message = fmt.Sprintf("Imported blocking policy as version %d", version.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
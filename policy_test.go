@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+func TestNormalizeNetworks(t *testing.T) {
+	got, err := normalizeNetworks([]string{" 203.0.113.7 ", "198.51.100.9/24", "2001:DB8::1", "2001:db8:1::5/48", "198.51.100.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"203.0.113.7/32", "198.51.100.0/24", "2001:db8::1/128", "2001:db8:1::/48"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("normalizeNetworks = %v, want %v", got, want)
+	}
+
+	for _, input := range []string{"", "example.com", "10.0.0.0/33", "2001:db8::/129"} {
+		if _, err := normalizeNetworks([]string{input}); err == nil {
+			t.Errorf("normalizeNetworks(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestNormalizePolicyExemptions(t *testing.T) {
+	policy := &geoblock.Policy{Exemptions: []geoblock.Exemption{
+		{Networks: []string{"203.0.113.7"}},
+		{ID: "partner", Principals: []string{" partner-api ", "partner-api", ""}},
+	}}
+	if err := normalizePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if got := policy.Exemptions[0]; got.ID != "exemption-1" || strings.Join(got.Networks, ",") != "203.0.113.7/32" {
+		t.Errorf("exemption 0 = %+v", got)
+	}
+	if got := policy.Exemptions[1]; strings.Join(got.Principals, ",") != "partner-api" {
+		t.Errorf("exemption 1 principals = %q, want [partner-api]", got.Principals)
+	}
+
+	for _, exemptions := range [][]geoblock.Exemption{
+		{{ID: "empty"}},
+		{{ID: "bad", Networks: []string{"not-a-network"}}},
+		{{ID: "dup", Networks: []string{"192.0.2.1"}}, {ID: "dup", Networks: []string{"192.0.2.2"}}},
+	} {
+		if err := normalizePolicy(&geoblock.Policy{Exemptions: exemptions}); err == nil {
+			t.Errorf("normalizePolicy(%+v) succeeded, want error", exemptions)
+		}
+	}
+}
+
+func TestNormalizePolicyRuleHosts(t *testing.T) {
+	policy := &geoblock.Policy{Rules: []geoblock.Rule{{ID: "de", Countries: []string{"fr"}, Hosts: []string{"MyShop.de:443", "myshop.de", "*.MyShop.de"}}}}
+	if err := normalizePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(policy.Rules[0].Hosts, ","); got != "myshop.de,*.myshop.de" {
+		t.Errorf("hosts = %q, want myshop.de,*.myshop.de", got)
+	}
+}
+
+// useTestPolicyFile points reloads at a policy file in a temporary
+// directory, starting from a store that blocks RU
+func useTestPolicyFile(t *testing.T) string {
+	dir := t.TempDir()
+	savedPath, savedBlocklist, savedHistory := policyFilePath, blocklist, policyHistory
+	t.Cleanup(func() { policyFilePath, blocklist, policyHistory = savedPath, savedBlocklist, savedHistory })
+
+	policyFilePath = filepath.Join(dir, "blocking-policy.json")
+	blocklist = geoblock.NewStore()
+	if _, err := blocklist.ReplacePolicy(&geoblock.Policy{BlockedCountries: []string{"RU"}}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := NewPolicyHistory(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyHistory = history
+	return policyFilePath
+}
+
+func TestHandleReload(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		wantStatus  int
+		wantBlocked string
+	}{
+		{"valid policy", `{"blocked_countries": ["kp", "IR"]}`, http.StatusOK, "KP,IR"},
+		{"missing file clears the policy", "", http.StatusOK, ""},
+		{"malformed JSON keeps the old policy", `{"blocked_countries": [`, http.StatusInternalServerError, "RU"},
+		{"invalid country keeps the old policy", `{"blocked_countries": ["XX"]}`, http.StatusInternalServerError, "RU"},
+		{"invalid rule keeps the old policy", `{"rules": [{"id": "r", "countries": ["FR"], "reputation_above": 150}]}`, http.StatusInternalServerError, "RU"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := useTestPolicyFile(t)
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			handleReload(w, httptest.NewRequest("POST", "/api/v1/reload", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := strings.Join(blocklist.Countries(), ","); got != tt.wantBlocked {
+				t.Errorf("blocked = %q, want %q", got, tt.wantBlocked)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response ReloadResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if !response.Success || strings.Join(response.BlockedCountries, ",") != tt.wantBlocked {
+				t.Errorf("response = %+v", response)
+			}
+			if latest, _ := policyHistory.Latest(); latest.Action != "reload-policy" {
+				t.Errorf("latest history action = %q, want reload-policy", latest.Action)
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"shopify-customers/geoblock"
+)
+
+var (
+	// storageBackend selects where state is persisted: "file" (default) or "postgres"
+	storageBackend = strings.ToLower(getEnv("STORAGE_BACKEND", "file"))
+
+	// databaseURL is the Postgres connection string, e.g. postgres://user:password@db:5432/geoblock
+	databaseURL = getEnv("DATABASE_URL", "")
+)
+
+// postgresTimeout bounds each statement, so a slow database can't stall requests for long
+const postgresTimeout = 5 * time.Second
+
+// postgresMigrations holds the schema migrations, applied in file name order
+//
+//go:embed migrations/*.sql
+var postgresMigrations embed.FS
+
+// migration is one numbered schema change such as 001_initial.sql
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations reads the migrations from fsys, ordered by version. Each file
+// name must start with a unique version number followed by an underscore.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	paths, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(paths))
+	seen := make(map[int]string)
+	for _, p := range paths {
+		name := path.Base(p)
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a version number, like 001_initial.sql", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version %d", other, name, version)
+		}
+		seen[version] = name
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// PostgresStore persists the blocking policy, customers, encrypted secrets,
+// audit log and traffic aggregates in Postgres
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// openPostgresStore connects to the database and applies pending migrations
+func openPostgresStore(ctx context.Context, url string) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATABASE_URL: %w", err)
+	}
+	store := &PostgresStore{pool: pool}
+	if err := store.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := store.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate applies the migrations not yet recorded in schema_migrations. An
+// advisory lock keeps replicas starting together from applying them twice.
+func (s *PostgresStore) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations(postgresMigrations)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('geoblock-schema-migrations'))`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := tx.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if _, err := tx.Exec(ctx, m.sql); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+			return err
+		}
+		fmt.Printf("🗄️  Applied database migration %s\n", m.name)
+	}
+	return tx.Commit(ctx)
+}
+
+// Ping checks that the database answers
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+// LoadPolicy returns the stored blocking policy, or nil if none has been saved yet
+func (s *PostgresStore) LoadPolicy(ctx context.Context) (*geoblock.Policy, error) {
+	var data []byte
+	err := s.pool.QueryRow(ctx, `SELECT policy FROM blocking_policy WHERE id = 1`).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var policy geoblock.Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse stored policy: %w", err)
+	}
+	if err := normalizePolicy(&policy); err != nil {
+		return nil, fmt.Errorf("stored policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// SavePolicy replaces the stored blocking policy
+func (s *PostgresStore) SavePolicy(ctx context.Context, policy *geoblock.Policy) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode policy: %w", err)
+	}
+	_, err = s.pool.Exec(ctx, `INSERT INTO blocking_policy (id, policy, updated_at) VALUES (1, $1, now())
+		ON CONFLICT (id) DO UPDATE SET policy = EXCLUDED.policy, updated_at = EXCLUDED.updated_at`, data)
+	return err
+}
+
+// SaveCustomers upserts the customers fetched from Shopify with their
+// countries. Minimized customers go to anonymous_customers, keyed by hash.
+func (s *PostgresStore) SaveCustomers(ctx context.Context, customers []CustomerCountry) error {
+	batch := &pgx.Batch{}
+	for _, c := range customers {
+		if c.CustomerHash != "" {
+			batch.Queue(`INSERT INTO anonymous_customers
+				(customer_hash, country_codes, default_country, accepts_marketing, orders_count, total_spent, synced_at)
+				VALUES ($1, $2, $3, $4, $5, $6, now())
+				ON CONFLICT (customer_hash) DO UPDATE SET
+					country_codes = EXCLUDED.country_codes, default_country = EXCLUDED.default_country,
+					accepts_marketing = EXCLUDED.accepts_marketing, orders_count = EXCLUDED.orders_count,
+					total_spent = EXCLUDED.total_spent, synced_at = EXCLUDED.synced_at`,
+				c.CustomerHash, c.CountryCodes, c.DefaultCountry, c.AcceptsMarketing, c.OrdersCount, c.TotalSpent)
+			continue
+		}
+		batch.Queue(`INSERT INTO customers
+			(id, name, email, country_codes, default_country, accepts_marketing, orders_count, total_spent, synced_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now())
+			ON CONFLICT (id) DO UPDATE SET
+				name = EXCLUDED.name, email = EXCLUDED.email, country_codes = EXCLUDED.country_codes,
+				default_country = EXCLUDED.default_country, accepts_marketing = EXCLUDED.accepts_marketing,
+				orders_count = EXCLUDED.orders_count, total_spent = EXCLUDED.total_spent, synced_at = EXCLUDED.synced_at`,
+			c.CustomerID, c.CustomerName, c.CustomerEmail, c.CountryCodes, c.DefaultCountry,
+			c.AcceptsMarketing, c.OrdersCount, c.TotalSpent)
+	}
+	return s.pool.SendBatch(ctx, batch).Close()
+}
+
+// StoredCustomer is a customer row as saved by SaveCustomers
+type StoredCustomer struct {
+	CustomerID       int64     `json:"customer_id,omitempty"`
+	CustomerHash     string    `json:"customer_hash,omitempty"`
+	CustomerName     string    `json:"customer_name,omitempty"`
+	CustomerEmail    string    `json:"customer_email,omitempty"`
+	CountryCodes     []string  `json:"country_codes"`
+	DefaultCountry   string    `json:"default_country"`
+	AcceptsMarketing bool      `json:"accepts_marketing"`
+	OrdersCount      int       `json:"orders_count"`
+	TotalSpent       float64   `json:"total_spent"`
+	SyncedAt         time.Time `json:"synced_at"`
+}
+
+// GetCustomer returns a stored customer, or nil if there is none with the ID
+func (s *PostgresStore) GetCustomer(ctx context.Context, id int64) (*StoredCustomer, error) {
+	var c StoredCustomer
+	err := s.pool.QueryRow(ctx, `SELECT id, name, email, country_codes, default_country,
+		accepts_marketing, orders_count, total_spent::float8, synced_at FROM customers WHERE id = $1`, id).
+		Scan(&c.CustomerID, &c.CustomerName, &c.CustomerEmail, &c.CountryCodes, &c.DefaultCountry,
+			&c.AcceptsMarketing, &c.OrdersCount, &c.TotalSpent, &c.SyncedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetAnonymousCustomer returns a customer saved in PII minimization mode, or
+// nil if there is none with the hash
+func (s *PostgresStore) GetAnonymousCustomer(ctx context.Context, hash string) (*StoredCustomer, error) {
+	var c StoredCustomer
+	err := s.pool.QueryRow(ctx, `SELECT customer_hash, country_codes, default_country,
+		accepts_marketing, orders_count, total_spent::float8, synced_at FROM anonymous_customers WHERE customer_hash = $1`, hash).
+		Scan(&c.CustomerHash, &c.CountryCodes, &c.DefaultCountry,
+			&c.AcceptsMarketing, &c.OrdersCount, &c.TotalSpent, &c.SyncedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteCustomer removes a stored customer, and its anonymous row with the
+// given hash if not empty, returning how many rows were deleted
+func (s *PostgresStore) DeleteCustomer(ctx context.Context, id int64, hash string) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM customers WHERE id = $1`, id)
+	if err != nil {
+		return 0, err
+	}
+	deleted := tag.RowsAffected()
+	if hash == "" {
+		return deleted, nil
+	}
+	tag, err = s.pool.Exec(ctx, `DELETE FROM anonymous_customers WHERE customer_hash = $1`, hash)
+	if err != nil {
+		return deleted, err
+	}
+	return deleted + tag.RowsAffected(), nil
+}
+
+// DeleteAllCustomers removes every stored customer, anonymous or not,
+// returning how many there were
+func (s *PostgresStore) DeleteAllCustomers(ctx context.Context) (int64, error) {
+	var deleted int64
+	for _, table := range []string{"customers", "anonymous_customers"} {
+		tag, err := s.pool.Exec(ctx, `DELETE FROM `+table)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += tag.RowsAffected()
+	}
+	return deleted, nil
+}
+
+// SaveSecret stores an encrypted secret, replacing any with the same name
+func (s *PostgresStore) SaveSecret(ctx context.Context, secret EncryptedSecret) error {
+	_, err := s.pool.Exec(ctx, `INSERT INTO secrets (name, key_id, wrapped_key, ciphertext, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET key_id = EXCLUDED.key_id, wrapped_key = EXCLUDED.wrapped_key,
+			ciphertext = EXCLUDED.ciphertext, updated_at = EXCLUDED.updated_at`,
+		secret.Name, secret.KeyID, secret.WrappedKey, secret.Ciphertext, secret.UpdatedAt)
+	return err
+}
+
+// LoadSecret returns an encrypted secret, or nil if there is none with the name
+func (s *PostgresStore) LoadSecret(ctx context.Context, name string) (*EncryptedSecret, error) {
+	var secret EncryptedSecret
+	err := s.pool.QueryRow(ctx, `SELECT name, key_id, wrapped_key, ciphertext, updated_at FROM secrets WHERE name = $1`, name).
+		Scan(&secret.Name, &secret.KeyID, &secret.WrappedKey, &secret.Ciphertext, &secret.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// ListSecrets returns every encrypted secret, by name
+func (s *PostgresStore) ListSecrets(ctx context.Context) ([]EncryptedSecret, error) {
+	rows, err := s.pool.Query(ctx, `SELECT name, key_id, wrapped_key, ciphertext, updated_at FROM secrets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []EncryptedSecret
+	for rows.Next() {
+		var secret EncryptedSecret
+		if err := rows.Scan(&secret.Name, &secret.KeyID, &secret.WrappedKey, &secret.Ciphertext, &secret.UpdatedAt); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+// RewrapSecret replaces a secret's wrapped data key, unless the secret was
+// rewritten since old was read, reporting whether it was replaced
+func (s *PostgresStore) RewrapSecret(ctx context.Context, old, rewrapped EncryptedSecret) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `UPDATE secrets SET key_id = $2, wrapped_key = $3, updated_at = $4
+		WHERE name = $1 AND wrapped_key = $5`,
+		rewrapped.Name, rewrapped.KeyID, rewrapped.WrappedKey, rewrapped.UpdatedAt, old.WrappedKey)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AppendAudit stores one audit entry
+func (s *PostgresStore) AppendAudit(ctx context.Context, entry AuditEntry) error {
+	occurredAt, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil {
+		occurredAt = time.Now()
+	}
+	var details []byte
+	if entry.Details != nil {
+		if details, err = json.Marshal(entry.Details); err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+	}
+	_, err = s.pool.Exec(ctx, `INSERT INTO audit_log (occurred_at, principal, role, action, client_ip, details)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		occurredAt, entry.Principal, entry.Role, entry.Action, entry.ClientIP, details)
+	return err
+}
+
+// RecentAudit returns up to limit of the latest audit entries, newest last
+func (s *PostgresStore) RecentAudit(ctx context.Context, limit int) ([]AuditEntry, error) {
+	rows, err := s.pool.Query(ctx, `SELECT occurred_at, principal, role, action, client_ip, details
+		FROM (SELECT * FROM audit_log ORDER BY id DESC LIMIT $1) latest ORDER BY id`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var occurredAt time.Time
+		var details []byte
+		if err := rows.Scan(&occurredAt, &entry.Principal, &entry.Role, &entry.Action, &entry.ClientIP, &details); err != nil {
+			return nil, err
+		}
+		entry.Timestamp = occurredAt.Format(time.RFC3339)
+		if details != nil {
+			entry.Details = json.RawMessage(details)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// SaveTraffic upserts this instance's traffic counters
+func (s *PostgresStore) SaveTraffic(ctx context.Context, instance string, buckets []TrafficBucket) error {
+	batch := &pgx.Batch{}
+	for _, b := range buckets {
+		batch.Queue(`INSERT INTO traffic_aggregates
+			(bucket_start, country_code, instance, requests, blocks, monitored, unique_ips)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (bucket_start, country_code, instance) DO UPDATE SET
+				requests = EXCLUDED.requests, blocks = EXCLUDED.blocks,
+				monitored = EXCLUDED.monitored, unique_ips = EXCLUDED.unique_ips`,
+			b.Start, b.CountryCode, instance, b.Requests, b.Blocks, b.Monitored, b.UniqueIPs)
+	}
+	return s.pool.SendBatch(ctx, batch).Close()
+}
+
+// postgresStore is nil unless STORAGE_BACKEND is postgres
+var postgresStore *PostgresStore
+
+// startStorage connects to the configured storage backend and adopts its
+// blocking policy as the local policy file. With the file backend there is
+// nothing to start. It exits when a selected database is unusable, rather
+// than run without the durability it was configured for.
+func startStorage() {
+	switch storageBackend {
+	case "file":
+		return
+	case "postgres":
+	default:
+		log.Fatalf("❌ Invalid STORAGE_BACKEND %q: use file or postgres", storageBackend)
+	}
+	if databaseURL == "" {
+		log.Fatalf("❌ STORAGE_BACKEND=postgres needs DATABASE_URL")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store, err := openPostgresStore(ctx, databaseURL)
+	if err != nil {
+		log.Fatalf("❌ Failed to open Postgres storage: %v", err)
+	}
+	policy, err := store.LoadPolicy(ctx)
+	if err != nil {
+		log.Fatalf("❌ Failed to load blocking policy from Postgres: %v", err)
+	}
+	if policy != nil {
+		if err := savePolicy(policyFilePath, policy); err != nil {
+			fmt.Printf("⚠️  Could not save stored blocking policy to %s: %v\n", policyFilePath, err)
+		}
+	}
+
+	postgresStore = store
+	startTrafficFlush()
+	fmt.Println("🗄️  Persisting policy, customers, secrets, audit log and traffic to Postgres")
+}
+
+// storePolicy saves the policy to the database, if one is configured
+func storePolicy(policy *geoblock.Policy) error {
+	if postgresStore == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	if err := postgresStore.SavePolicy(ctx, policy); err != nil {
+		return fmt.Errorf("failed to save policy to Postgres: %w", err)
+	}
+	return nil
+}
+
+// storeCustomers saves fetched customers to the database, if one is configured,
+// logging failures since the customers were already fetched
+func storeCustomers(ctx context.Context, customers []CustomerCountry) {
+	if postgresStore == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := postgresStore.SaveCustomers(ctx, customers); err != nil {
+		fmt.Printf("⚠️  Customers not saved to Postgres: %v\n", err)
+	}
+}
+
+// startTrafficFlush periodically writes the latest traffic buckets to the
+// database, labelled with this host's name so replicas don't overwrite each other
+func startTrafficFlush() {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			buckets := trafficAnalytics.Buckets(now.Add(-2 * trafficBucketSize))
+			if len(buckets) == 0 {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+			if err := postgresStore.SaveTraffic(ctx, instance, buckets); err != nil {
+				fmt.Printf("⚠️  Traffic aggregates not saved to Postgres: %v\n", err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// checkPostgres reports whether the database is reachable
+func checkPostgres(ctx context.Context) error {
+	if postgresStore == nil {
+		return errCheckSkipped
+	}
+	return postgresStore.Ping(ctx)
+}
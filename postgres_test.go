@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(postgresMigrations)
+	if err != nil {
+		t.Fatalf("embedded migrations: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].version != 1 {
+		t.Fatalf("embedded migrations = %+v, want to start at version 1", migrations)
+	}
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []int
+		wantErr string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"migrations/010_traffic.sql": {Data: []byte("SELECT 10")},
+				"migrations/002_audit.sql":   {Data: []byte("SELECT 2")},
+				"migrations/001_initial.sql": {Data: []byte("SELECT 1")},
+				"migrations/README.md":       {Data: []byte("ignored")},
+			},
+			want: []int{1, 2, 10},
+		},
+		{
+			name:    "missing version",
+			files:   fstest.MapFS{"migrations/initial.sql": {}},
+			wantErr: "must start with a version number",
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"migrations/001_initial.sql": {},
+				"migrations/1_other.sql":     {},
+			},
+			wantErr: "same version 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, m := range migrations {
+				got = append(got, m.version)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("versions = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("versions = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
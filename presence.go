@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Weights of each signal in a country's business presence score
+const (
+	presenceCustomerWeight = 0.4
+	presenceOrderWeight    = 0.3
+	presenceRevenueWeight  = 0.3
+)
+
+// businessPresenceThreshold is the score from which a country counts as having
+// business presence; ?threshold= overrides it per request
+var businessPresenceThreshold = getEnvFloat("BUSINESS_PRESENCE_THRESHOLD", 0.05)
+
+// CountryPresence scores how much business a store does in one country.
+// Score is between 0 and 1, relative to the store's biggest market.
+type CountryPresence struct {
+	CountryCode string   `json:"country_code"`
+	CountryName string   `json:"country_name"`
+	Customers   int      `json:"customers"`
+	Orders      int      `json:"orders"`
+	Revenue     float64  `json:"revenue"`
+	Score       float64  `json:"score"`
+	HasPresence bool     `json:"has_presence"`
+	Blocked     bool     `json:"blocked"`
+	Currency    string   `json:"currency,omitempty"`
+	Languages   []string `json:"languages,omitempty"`
+}
+
+// primaryCountry is where a customer's orders and revenue are attributed:
+// their default address, or else the first country they have an address in
+func primaryCountry(cc CustomerCountry) string {
+	if cc.DefaultCountry != "" {
+		return cc.DefaultCountry
+	}
+	if len(cc.CountryCodes) > 0 {
+		return cc.CountryCodes[0]
+	}
+	return ""
+}
+
+// scoreBusinessPresence scores every country from its customer count, order
+// count and revenue. Each signal is scaled against the country where it is
+// highest, then combined by weight; signals no country has are left out so
+// e.g. a store without orders is scored on customers alone. Countries scoring
+// at least threshold have presence. Highest scores come first.
+func scoreBusinessPresence(customerCountries []CustomerCountry, threshold float64) []CountryPresence {
+	totals := make(map[string]*CountryPresence)
+	get := func(code string) *CountryPresence {
+		if totals[code] == nil {
+			totals[code] = &CountryPresence{CountryCode: code}
+		}
+		return totals[code]
+	}
+	for _, code := range getAllCountryCodes() {
+		get(code)
+	}
+	for _, cc := range customerCountries {
+		for _, code := range cc.CountryCodes {
+			get(code).Customers++
+		}
+		if code := primaryCountry(cc); code != "" {
+			get(code).Orders += cc.OrdersCount
+			get(code).Revenue += cc.TotalSpent
+		}
+	}
+
+	var maxCustomers, maxOrders, maxRevenue float64
+	for _, total := range totals {
+		maxCustomers = math.Max(maxCustomers, float64(total.Customers))
+		maxOrders = math.Max(maxOrders, float64(total.Orders))
+		maxRevenue = math.Max(maxRevenue, total.Revenue)
+	}
+	signals := []struct {
+		weight, max float64
+		value       func(*CountryPresence) float64
+	}{
+		{presenceCustomerWeight, maxCustomers, func(p *CountryPresence) float64 { return float64(p.Customers) }},
+		{presenceOrderWeight, maxOrders, func(p *CountryPresence) float64 { return float64(p.Orders) }},
+		{presenceRevenueWeight, maxRevenue, func(p *CountryPresence) float64 { return p.Revenue }},
+	}
+
+	presence := make([]CountryPresence, 0, len(totals))
+	for _, total := range totals {
+		var score, weights float64
+		for _, signal := range signals {
+			if signal.max > 0 {
+				score += signal.weight * signal.value(total) / signal.max
+				weights += signal.weight
+			}
+		}
+		if weights > 0 {
+			total.Score = math.Round(score/weights*1000) / 1000
+		}
+		total.Revenue = math.Round(total.Revenue*100) / 100
+		total.HasPresence = total.Score > 0 && total.Score >= threshold
+		if country, ok := lookupCountry(total.CountryCode); ok {
+			total.CountryName, total.Currency, total.Languages = country.ShortName(), country.Currency, country.Languages
+		}
+		total.Blocked = blocklist.IsBlocked(total.CountryCode)
+		presence = append(presence, *total)
+	}
+	sort.Slice(presence, func(i, j int) bool {
+		a, b := presence[i], presence[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.CountryCode < b.CountryCode
+	})
+	return presence
+}
+
+// presenceThreshold reads the optional ?threshold= parameter, writing an error if it is invalid
+func presenceThreshold(w http.ResponseWriter, r *http.Request) (float64, bool) {
+	value := r.URL.Query().Get("threshold")
+	if value == "" {
+		return businessPresenceThreshold, true
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		writeError(w, r, fmt.Sprintf("Invalid threshold %q: must be between 0 and 1", value), http.StatusBadRequest)
+		return 0, false
+	}
+	return threshold, true
+}
+
+// storeBusinessPresence scores countries from the customers of the store
+// loaded in step 1, writing an error if they can't be fetched
+func storeBusinessPresence(w http.ResponseWriter, r *http.Request, threshold float64) ([]CountryPresence, bool) {
+	customers, err := fetchAllCustomersFromShopify(r.Context(), currentShopifyConfig.APIKey, nil)
+	if err != nil {
+		fmt.Printf("❌ Error fetching customers: %v\n", err)
+		writeError(w, r, fmt.Sprintf("Failed to fetch customers: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return scoreBusinessPresence(extractCountryCodes(customers), threshold), true
+}
+
+// LocaleRequirement is a currency or language and the countries that need it
+type LocaleRequirement struct {
+	Code      string   `json:"code"`
+	Countries []string `json:"countries"`
+}
+
+// Localization lists the currencies and languages of the open countries with
+// business presence, most needed first
+type Localization struct {
+	Currencies []LocaleRequirement `json:"currencies"`
+	Languages  []LocaleRequirement `json:"languages"`
+}
+
+// localizationRequirements collects the currencies and languages a store
+// needs to support the markets it has presence in and does not block
+func localizationRequirements(presence []CountryPresence) Localization {
+	currencies := make(map[string][]string)
+	languages := make(map[string][]string)
+	for _, country := range presence {
+		if !country.HasPresence || country.Blocked {
+			continue
+		}
+		if country.Currency != "" {
+			currencies[country.Currency] = append(currencies[country.Currency], country.CountryCode)
+		}
+		for _, language := range country.Languages {
+			languages[language] = append(languages[language], country.CountryCode)
+		}
+	}
+	return Localization{Currencies: localeRequirements(currencies), Languages: localeRequirements(languages)}
+}
+
+// localeRequirements sorts codes by how many countries need them, then by code
+func localeRequirements(countriesByCode map[string][]string) []LocaleRequirement {
+	requirements := make([]LocaleRequirement, 0, len(countriesByCode))
+	for code, countries := range countriesByCode {
+		requirements = append(requirements, LocaleRequirement{Code: code, Countries: countries})
+	}
+	sort.Slice(requirements, func(i, j int) bool {
+		a, b := requirements[i], requirements[j]
+		if len(a.Countries) != len(b.Countries) {
+			return len(a.Countries) > len(b.Countries)
+		}
+		return a.Code < b.Code
+	})
+	return requirements
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScoreBusinessPresence(t *testing.T) {
+	customers := []CustomerCountry{
+		{CustomerID: 1, CountryCodes: []string{"US"}, DefaultCountry: "US", OrdersCount: 8, TotalSpent: 800},
+		{CustomerID: 2, CountryCodes: []string{"US"}, DefaultCountry: "US", OrdersCount: 2, TotalSpent: 200},
+		{CustomerID: 3, CountryCodes: []string{"CA", "DE"}, DefaultCountry: "DE", OrdersCount: 1, TotalSpent: 50},
+		{CustomerID: 4, CountryCodes: []string{"FR"}},
+	}
+
+	presence := scoreBusinessPresence(customers, 0.3)
+	byCode := make(map[string]CountryPresence, len(presence))
+	for _, country := range presence {
+		byCode[country.CountryCode] = country
+	}
+
+	tests := []struct {
+		code         string
+		wantScore    float64
+		wantPresence bool
+	}{
+		{"US", 1, true},
+		{"DE", 0.245, false},
+		{"CA", 0.2, false},
+		{"FR", 0.2, false},
+		{"JP", 0, false},
+	}
+	for _, tt := range tests {
+		got := byCode[tt.code]
+		if got.Score != tt.wantScore || got.HasPresence != tt.wantPresence {
+			t.Errorf("%s: score %v presence %v, want %v %v", tt.code, got.Score, got.HasPresence, tt.wantScore, tt.wantPresence)
+		}
+	}
+
+	if presence[0].CountryCode != "US" || presence[1].CountryCode != "DE" {
+		t.Errorf("presence not ordered by score: %+v", presence[:2])
+	}
+	if len(presence) != len(getAllCountryCodes()) {
+		t.Errorf("scored %d countries, want all %d", len(presence), len(getAllCountryCodes()))
+	}
+}
+
+func TestScoreBusinessPresenceWithoutOrders(t *testing.T) {
+	customers := []CustomerCountry{
+		{CustomerID: 1, CountryCodes: []string{"US"}},
+		{CustomerID: 2, CountryCodes: []string{"US", "GB"}},
+	}
+
+	for _, country := range scoreBusinessPresence(customers, 0.5) {
+		switch country.CountryCode {
+		case "US":
+			if country.Score != 1 || !country.HasPresence {
+				t.Errorf("US = %+v, want score 1 with presence", country)
+			}
+		case "GB":
+			if country.Score != 0.5 || !country.HasPresence {
+				t.Errorf("GB = %+v, want score 0.5 with presence", country)
+			}
+		}
+	}
+}
+
+func TestLocalizationRequirements(t *testing.T) {
+	presence := []CountryPresence{
+		{CountryCode: "DE", HasPresence: true, Currency: "EUR", Languages: []string{"de"}},
+		{CountryCode: "AT", HasPresence: true, Currency: "EUR", Languages: []string{"de"}},
+		{CountryCode: "CH", HasPresence: true, Currency: "CHF", Languages: []string{"de", "fr", "it", "rm"}},
+		{CountryCode: "FR", HasPresence: true, Blocked: true, Currency: "EUR", Languages: []string{"fr"}},
+		{CountryCode: "JP", Currency: "JPY", Languages: []string{"ja"}},
+	}
+
+	got := localizationRequirements(presence)
+	currencies := fmt.Sprint(got.Currencies)
+	if want := "[{EUR [DE AT]} {CHF [CH]}]"; currencies != want {
+		t.Errorf("currencies = %s, want %s", currencies, want)
+	}
+	languages := fmt.Sprint(got.Languages)
+	if want := "[{de [DE AT CH]} {fr [CH]} {it [CH]} {rm [CH]}]"; languages != want {
+		t.Errorf("languages = %s, want %s", languages, want)
+	}
+}
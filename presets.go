@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+//go:embed data/presets.json
+var builtinPresetsJSON []byte
+
+// CountryPreset is a named, versioned country list such as an embargo list.
+// AsOf is the date (YYYY-MM-DD) the list was last checked against its source.
+type CountryPreset struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	Version        string   `json:"version"`
+	AsOf           string   `json:"as_of,omitempty"`
+	Source         string   `json:"source,omitempty"`
+	LegalReference string   `json:"legal_reference,omitempty"`
+	Countries      []string `json:"countries"`
+}
+
+type PresetListResponse struct {
+	Presets []CountryPreset `json:"presets"`
+	Total   int             `json:"total"`
+}
+
+type PresetApplyRequest struct {
+	Preset string `json:"preset"`
+}
+
+type PresetApplyResponse struct {
+	Success          bool     `json:"success"`
+	Message          string   `json:"message"`
+	RuleID           string   `json:"rule_id,omitempty"`
+	Version          string   `json:"version,omitempty"`
+	AsOf             string   `json:"as_of,omitempty"`
+	BlockedCountries []string `json:"blocked_countries"`
+}
+
+type PresetRefreshResponse struct {
+	Success        bool     `json:"success"`
+	Message        string   `json:"message"`
+	Source         string   `json:"source"`
+	UpdatedPresets []string `json:"updated_presets"`
+	ReappliedRules []string `json:"reapplied_rules"`
+}
+
+var (
+	// presetsFilePath stores presets fetched by a refresh so they survive restarts
+	presetsFilePath = getEnv("PRESETS_FILE", "country-presets.json")
+
+	// presetsUpdateURL serves a JSON array of presets used to refresh the built-in lists
+	presetsUpdateURL = getEnv("PRESETS_UPDATE_URL", "")
+
+	presetMu sync.RWMutex
+	presets  = loadPresets()
+)
+
+// parsePresets decodes and validates a JSON array of presets
+func parsePresets(data []byte) ([]CountryPreset, error) {
+	var list []CountryPreset
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse presets: %w", err)
+	}
+
+	for i := range list {
+		preset := &list[i]
+		if preset.ID == "" || preset.Version == "" {
+			return nil, fmt.Errorf("preset %d is missing an id or version", i)
+		}
+		if preset.AsOf != "" {
+			if _, err := time.Parse(time.DateOnly, preset.AsOf); err != nil {
+				return nil, fmt.Errorf("preset %s: invalid as_of date %q", preset.ID, preset.AsOf)
+			}
+		}
+		countries, invalid := normalizeCountryCodes(preset.Countries)
+		if len(invalid) > 0 {
+			return nil, fmt.Errorf("preset %s: invalid country %q", preset.ID, invalid[0].Input)
+		}
+		preset.Countries = countries
+	}
+	return list, nil
+}
+
+// loadPresets reads the built-in presets, overridden by any previously refreshed presets file
+func loadPresets() map[string]*CountryPreset {
+	builtin, err := parsePresets(builtinPresetsJSON)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in presets: %v", err))
+	}
+
+	loaded := make(map[string]*CountryPreset, len(builtin))
+	for i := range builtin {
+		loaded[builtin[i].ID] = &builtin[i]
+	}
+
+	data, err := os.ReadFile(presetsFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return loaded
+	}
+	if err == nil {
+		var refreshed []CountryPreset
+		if refreshed, err = parsePresets(data); err == nil {
+			for i := range refreshed {
+				loaded[refreshed[i].ID] = &refreshed[i]
+			}
+			return loaded
+		}
+	}
+
+	fmt.Printf("⚠️  Ignoring presets file %s: %v\n", presetsFilePath, err)
+	return loaded
+}
+
+// listPresets returns all presets sorted by ID
+func listPresets() []CountryPreset {
+	presetMu.RLock()
+	defer presetMu.RUnlock()
+
+	list := make([]CountryPreset, 0, len(presets))
+	for _, preset := range presets {
+		list = append(list, *preset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func getPreset(id string) (CountryPreset, bool) {
+	presetMu.RLock()
+	defer presetMu.RUnlock()
+
+	preset, ok := presets[id]
+	if !ok {
+		return CountryPreset{}, false
+	}
+	return *preset, true
+}
+
+// presetRuleID is the ID of the blocking rule a preset is applied as
+func presetRuleID(presetID string) string {
+	return "preset-" + presetID
+}
+
+// applyPreset adds or updates the preset's blocking rule in a policy.
+// Presets with a legal reference respond with 451 and link to their source.
+func applyPreset(policy *geoblock.Policy, preset CountryPreset) string {
+	rule := geoblock.Rule{
+		ID:            presetRuleID(preset.ID),
+		Countries:     append([]string(nil), preset.Countries...),
+		Preset:        preset.ID,
+		PresetVersion: preset.Version,
+	}
+	if preset.LegalReference != "" {
+		rule.Response = &geoblock.ResponseTemplate{
+			LegalReference: preset.LegalReference,
+			PolicyURL:      preset.Source,
+		}
+	}
+
+	for i := range policy.Rules {
+		if policy.Rules[i].ID == rule.ID {
+			policy.Rules[i] = rule
+			return rule.ID
+		}
+	}
+	policy.Rules = append(policy.Rules, rule)
+	return rule.ID
+}
+
+// handleListPresets lists the available country presets
+func handleListPresets(w http.ResponseWriter, r *http.Request) {
+	list := listPresets()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PresetListResponse{Presets: list, Total: len(list)})
+}
+
+// handleApplyPreset adds or updates the blocking rule for a preset
+func handleApplyPreset(w http.ResponseWriter, r *http.Request) {
+	var req PresetApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	preset, ok := getPreset(req.Preset)
+	if !ok {
+		writeError(w, r, fmt.Sprintf("Unknown preset %q", req.Preset), http.StatusNotFound)
+		return
+	}
+
+	var ruleID string
+	previous, err := updatePolicy(r, "apply-preset", func(policy *geoblock.Policy) error {
+		ruleID = applyPreset(policy, preset)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("❌ Error applying preset %s: %v\n", preset.ID, err)
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "apply-preset", map[string]interface{}{
+		"preset":  preset.ID,
+		"version": preset.Version,
+		"as_of":   preset.AsOf,
+		"before":  previous,
+		"after":   blocklist.Countries(),
+	})
+	fmt.Printf("🛡️  Applied preset %s (v%s): %v\n", preset.ID, preset.Version, preset.Countries)
+
+	response := PresetApplyResponse{
+		Success:          true,
+		Message:          fmt.Sprintf("Applied preset %s version %s (%d countries)", preset.ID, preset.Version, len(preset.Countries)),
+		RuleID:           ruleID,
+		Version:          preset.Version,
+		AsOf:             preset.AsOf,
+		BlockedCountries: blocklist.Countries(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fetchPresetUpdates downloads presets from PRESETS_UPDATE_URL, or re-reads
+// PRESETS_FILE when no URL is configured
+func fetchPresetUpdates(ctx context.Context) ([]CountryPreset, string, error) {
+	if presetsUpdateURL == "" {
+		data, err := os.ReadFile(presetsFilePath)
+		if err != nil {
+			return nil, presetsFilePath, err
+		}
+		list, err := parsePresets(data)
+		return list, presetsFilePath, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", presetsUpdateURL, nil)
+	if err != nil {
+		return nil, presetsUpdateURL, fmt.Errorf("invalid PRESETS_UPDATE_URL: %w", err)
+	}
+	client := newHTTPClient(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, presetsUpdateURL, fmt.Errorf("failed to download presets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, presetsUpdateURL, fmt.Errorf("preset source returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, presetsUpdateURL, fmt.Errorf("failed to read presets: %w", err)
+	}
+
+	list, err := parsePresets(data)
+	if err != nil {
+		return nil, presetsUpdateURL, err
+	}
+	if err := os.WriteFile(presetsFilePath, data, 0o644); err != nil {
+		fmt.Printf("⚠️  Could not persist refreshed presets to %s: %v\n", presetsFilePath, err)
+	}
+	return list, presetsUpdateURL, nil
+}
+
+// handleRefreshPresets updates preset contents and re-applies changed presets
+// to any blocking rules created from them
+func handleRefreshPresets(w http.ResponseWriter, r *http.Request) {
+	list, source, err := fetchPresetUpdates(r.Context())
+	if err != nil {
+		fmt.Printf("❌ Preset refresh failed: %v\n", err)
+		writeError(w, r, fmt.Sprintf("Failed to refresh presets: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	updated := []string{}
+	presetMu.Lock()
+	for i := range list {
+		current, exists := presets[list[i].ID]
+		if !exists || current.Version != list[i].Version {
+			updated = append(updated, list[i].ID)
+		}
+		presets[list[i].ID] = &list[i]
+	}
+	presetMu.Unlock()
+
+	// Keep active preset rules in sync with the refreshed contents
+	reapplied := []string{}
+	_, err = updatePolicy(r, "refresh-presets", func(policy *geoblock.Policy) error {
+		for _, rule := range policy.Rules {
+			if rule.Preset == "" {
+				continue
+			}
+			if preset, ok := getPreset(rule.Preset); ok && preset.Version != rule.PresetVersion {
+				reapplied = append(reapplied, applyPreset(policy, preset))
+			}
+		}
+		if len(reapplied) == 0 {
+			return geoblock.ErrNoPolicyChange
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, geoblock.ErrNoPolicyChange) {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "refresh-presets", map[string]interface{}{
+		"source":          source,
+		"updated_presets": updated,
+		"reapplied_rules": reapplied,
+	})
+
+	response := PresetRefreshResponse{
+		Success:        true,
+		Message:        fmt.Sprintf("Refreshed %d presets, re-applied %d rules", len(updated), len(reapplied)),
+		Source:         source,
+		UpdatedPresets: updated,
+		ReappliedRules: reapplied,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The product and collection metafield holding a restriction, read by the
+// storefront as product.metafields.geoblock.restricted_countries
+const productRestrictionMetafieldKey = "restricted_countries"
+
+// productRestrictionMaxPages bounds how many pages of 250 products or
+// collections a refresh reads
+const productRestrictionMaxPages = 40
+
+// productRestrictionsEnabled refreshes the restrictions from Shopify every
+// PRODUCT_RESTRICTIONS_REFRESH and enforces them at checkout
+var productRestrictionsEnabled = getEnv("PRODUCT_RESTRICTIONS", "false") == "true"
+
+// productRestrictionsRefresh is how often restrictions changed in Shopify
+// are picked up
+var productRestrictionsRefresh = getEnvDuration("PRODUCT_RESTRICTIONS_REFRESH", 15*time.Minute)
+
+// productRestrictedMessage is shown at checkout for a restricted product;
+// the %s are the product title and the country name
+var productRestrictedMessage = getEnv("PRODUCT_RESTRICTED_MESSAGE", "%s can't be shipped to %s.")
+
+// Kinds of resource a restriction is set on
+const (
+	restrictionProduct    = "products"
+	restrictionCollection = "collections"
+)
+
+// errUnknownRestrictionKind is returned for a kind other than products or collections
+var errUnknownRestrictionKind = errors.New("kind must be products or collections")
+
+// ProductRestrictionValue is the metafield value
+type ProductRestrictionValue struct {
+	Countries []string `json:"countries"`
+	Reason    string   `json:"reason,omitempty"`
+}
+
+// ProductRestriction keeps a product, or every product of a collection, from
+// being sold to some countries, e.g. alcohol or export-controlled electronics
+type ProductRestriction struct {
+	Kind  string `json:"kind"`
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	ProductRestrictionValue
+
+	// Products are the IDs of a collection's products when restrictions
+	// were last refreshed
+	Products []int64 `json:"products,omitempty"`
+}
+
+// key identifies a restriction, e.g. "products/123"
+func (p ProductRestriction) key() string {
+	return p.Kind + "/" + strconv.FormatInt(p.ID, 10)
+}
+
+// ProductRestrictionsResponse lists the restrictions set in Shopify
+type ProductRestrictionsResponse struct {
+	Enabled      bool                 `json:"enabled"`
+	RefreshedAt  string               `json:"refreshed_at,omitempty"`
+	Restrictions []ProductRestriction `json:"restrictions"`
+}
+
+// ProductRestrictionRequest sets a restriction; countries may include
+// country groups
+type ProductRestrictionRequest struct {
+	Countries []string `json:"countries"`
+	Reason    string   `json:"reason"`
+}
+
+// ProductRestrictions caches the restrictions stored in product and
+// collection metafields, which stay the source of truth
+type ProductRestrictions struct {
+	mu           sync.RWMutex
+	restrictions map[string]ProductRestriction
+	refreshedAt  time.Time
+}
+
+var productRestrictions = &ProductRestrictions{restrictions: make(map[string]ProductRestriction)}
+
+// Replace swaps in a freshly fetched set of restrictions
+func (p *ProductRestrictions) Replace(restrictions []ProductRestriction, refreshedAt time.Time) {
+	byKey := make(map[string]ProductRestriction, len(restrictions))
+	for _, restriction := range restrictions {
+		byKey[restriction.key()] = restriction
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restrictions, p.refreshedAt = byKey, refreshedAt
+}
+
+// Set stores or, when it restricts no countries, removes one restriction
+func (p *ProductRestrictions) Set(restriction ProductRestriction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(restriction.Countries) == 0 {
+		delete(p.restrictions, restriction.key())
+		return
+	}
+	p.restrictions[restriction.key()] = restriction
+}
+
+// List returns the restrictions, products first, then by ID
+func (p *ProductRestrictions) List() ([]ProductRestriction, time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	list := make([]ProductRestriction, 0, len(p.restrictions))
+	for _, restriction := range p.restrictions {
+		list = append(list, restriction)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind > list[j].Kind
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, p.refreshedAt
+}
+
+// Restriction returns the restriction keeping a product from a country, its
+// own or one of a collection it is in, or nil if it may be sold there
+func (p *ProductRestrictions) Restriction(productID int64, country string) *ProductRestriction {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	restricts := func(restriction ProductRestriction) bool {
+		for _, code := range restriction.Countries {
+			if code == country {
+				return true
+			}
+		}
+		return false
+	}
+	if restriction, ok := p.restrictions[restrictionProduct+"/"+strconv.FormatInt(productID, 10)]; ok && restricts(restriction) {
+		return &restriction
+	}
+	for _, restriction := range p.restrictions {
+		if restriction.Kind != restrictionCollection || !restricts(restriction) {
+			continue
+		}
+		for _, id := range restriction.Products {
+			if id == productID {
+				return &restriction
+			}
+		}
+	}
+	return nil
+}
+
+// restrictionOwnerID is the Admin API ID of a product or collection
+func restrictionOwnerID(kind string, id int64) (string, error) {
+	switch kind {
+	case restrictionProduct:
+		return fmt.Sprintf("gid://shopify/Product/%d", id), nil
+	case restrictionCollection:
+		return fmt.Sprintf("gid://shopify/Collection/%d", id), nil
+	}
+	return "", errUnknownRestrictionKind
+}
+
+// parseShopifyID returns the numeric ID at the end of an Admin API ID such
+// as "gid://shopify/Product/123"
+func parseShopifyID(gid string) int64 {
+	id, _ := strconv.ParseInt(gid[strings.LastIndex(gid, "/")+1:], 10, 64)
+	return id
+}
+
+// restrictedResourcesQuery pages through products or collections with their
+// restriction metafield
+const restrictedResourcesQuery = `query Restricted($after: String) {
+  %s(first: 250, after: $after) {
+    nodes {
+      id
+      title
+      metafield(namespace: "geoblock", key: "restricted_countries") { value }
+    }
+    pageInfo { hasNextPage endCursor }
+  }
+}`
+
+// collectionProductsQuery pages through the products of a collection
+const collectionProductsQuery = `query CollectionProducts($id: ID!, $after: String) {
+  collection(id: $id) {
+    products(first: 250, after: $after) {
+      nodes { id }
+      pageInfo { hasNextPage endCursor }
+    }
+  }
+}`
+
+// fetchProductRestrictions reads the restriction metafield of every product
+// and collection, and the products of each restricted collection
+func fetchProductRestrictions(ctx context.Context, token string) ([]ProductRestriction, error) {
+	var restrictions []ProductRestriction
+	for _, kind := range []string{restrictionProduct, restrictionCollection} {
+		_, err := shopifyGraphQLPages(ctx, token, fmt.Sprintf(restrictedResourcesQuery, kind), kind, nil, productRestrictionMaxPages, func(data json.RawMessage) error {
+			var nodes []struct {
+				ID        string `json:"id"`
+				Title     string `json:"title"`
+				Metafield *struct {
+					Value string `json:"value"`
+				} `json:"metafield"`
+			}
+			if err := json.Unmarshal(data, &nodes); err != nil {
+				return fmt.Errorf("failed to parse JSON: %w", err)
+			}
+			for _, node := range nodes {
+				if node.Metafield == nil {
+					continue
+				}
+				restriction := ProductRestriction{Kind: kind, ID: parseShopifyID(node.ID), Title: node.Title}
+				if err := json.Unmarshal([]byte(node.Metafield.Value), &restriction.ProductRestrictionValue); err != nil {
+					fmt.Printf("⚠️  Ignoring the invalid restriction of %s %q: %v\n", kind, node.Title, err)
+					continue
+				}
+				restrictions = append(restrictions, restriction)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kind, err)
+		}
+	}
+
+	for i, restriction := range restrictions {
+		if restriction.Kind != restrictionCollection {
+			continue
+		}
+		products, err := fetchCollectionProducts(ctx, token, restriction.ID)
+		if err != nil {
+			return nil, err
+		}
+		restrictions[i].Products = products
+	}
+	return restrictions, nil
+}
+
+// fetchCollectionProducts returns the IDs of a collection's products
+func fetchCollectionProducts(ctx context.Context, token string, id int64) ([]int64, error) {
+	gid, _ := restrictionOwnerID(restrictionCollection, id)
+	var products []int64
+	_, err := shopifyGraphQLPages(ctx, token, collectionProductsQuery, "collection.products", map[string]interface{}{"id": gid}, productRestrictionMaxPages, func(data json.RawMessage) error {
+		var nodes []struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &nodes); err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		for _, node := range nodes {
+			products = append(products, parseShopifyID(node.ID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("products of collection %d: %w", id, err)
+	}
+	return products, nil
+}
+
+// refreshProductRestrictions reloads the restrictions from Shopify
+func refreshProductRestrictions(ctx context.Context) error {
+	restrictions, err := fetchProductRestrictions(ctx, shopifyToken(currentShopifyConfig.APIKey))
+	if err != nil {
+		return err
+	}
+	productRestrictions.Replace(restrictions, time.Now())
+	return nil
+}
+
+// startProductRestrictions keeps the restrictions up to date, if enabled
+func startProductRestrictions() {
+	if !productRestrictionsEnabled || offlineMode {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(productRestrictionsRefresh)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), storefrontPushTimeout)
+			if err := refreshProductRestrictions(ctx); err != nil {
+				fmt.Printf("⚠️  Could not refresh product restrictions: %v\n", err)
+			}
+			cancel()
+			<-ticker.C
+		}
+	}()
+}
+
+// writeProductRestriction sets, or with no countries deletes, the
+// restriction metafield of a product or collection
+func writeProductRestriction(ctx context.Context, kind string, id int64, value ProductRestrictionValue) error {
+	ownerID, err := restrictionOwnerID(kind, id)
+	if err != nil {
+		return err
+	}
+	token := shopifyToken(currentShopifyConfig.APIKey)
+
+	var result map[string]struct {
+		UserErrors []struct {
+			Message string `json:"message"`
+		} `json:"userErrors"`
+	}
+	if len(value.Countries) == 0 {
+		err = shopifyGraphQL(ctx, token, `mutation DeleteRestriction($metafields: [MetafieldIdentifierInput!]!) {
+  metafieldsDelete(metafields: $metafields) { userErrors { message } }
+}`, map[string]interface{}{
+			"metafields": []map[string]string{{"ownerId": ownerID, "namespace": storefrontMetafieldNamespace, "key": productRestrictionMetafieldKey}},
+		}, &result)
+	} else {
+		data, _ := json.Marshal(value)
+		err = shopifyGraphQL(ctx, token, `mutation SetRestriction($metafields: [MetafieldsSetInput!]!) {
+  metafieldsSet(metafields: $metafields) { userErrors { message } }
+}`, map[string]interface{}{
+			"metafields": []map[string]string{{
+				"ownerId":   ownerID,
+				"namespace": storefrontMetafieldNamespace,
+				"key":       productRestrictionMetafieldKey,
+				"type":      "json",
+				"value":     string(data),
+			}},
+		}, &result)
+	}
+	if err != nil {
+		return err
+	}
+	for _, mutation := range result {
+		if len(mutation.UserErrors) > 0 {
+			return errors.New(mutation.UserErrors[0].Message)
+		}
+	}
+	return nil
+}
+
+// restrictionParams reads the {kind} and {id} path parameters, writing an
+// error if they are invalid
+func restrictionParams(w http.ResponseWriter, r *http.Request) (string, int64, bool) {
+	kind := r.PathValue("kind")
+	if kind != restrictionProduct && kind != restrictionCollection {
+		writeError(w, r, errUnknownRestrictionKind.Error(), http.StatusBadRequest)
+		return "", 0, false
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, r, fmt.Sprintf("Invalid %s ID %q", strings.TrimSuffix(kind, "s"), r.PathValue("id")), http.StatusBadRequest)
+		return "", 0, false
+	}
+	return kind, id, true
+}
+
+// handleListProductRestrictions lists the product and collection
+// restrictions; ?refresh=true reloads them from Shopify first
+func handleListProductRestrictions(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("refresh") == "true" {
+		if err := refreshProductRestrictions(r.Context()); err != nil {
+			writeError(w, r, fmt.Sprintf("Failed to fetch product restrictions: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+	restrictions, refreshedAt := productRestrictions.List()
+	response := ProductRestrictionsResponse{Enabled: productRestrictionsEnabled, Restrictions: restrictions}
+	if !refreshedAt.IsZero() {
+		response.RefreshedAt = refreshedAt.Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleSetProductRestriction restricts the product or collection given by
+// the {kind} and {id} path parameters to the countries in the request, by
+// writing its metafield
+func handleSetProductRestriction(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := restrictionParams(w, r)
+	if !ok {
+		return
+	}
+	var req ProductRestrictionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	countries, invalid := normalizeCountryCodes(expandCountryGroups(blocklist.Policy(), req.Countries))
+	if len(invalid) > 0 {
+		writeErrorDetails(w, r, http.StatusBadRequest, "invalid_country",
+			fmt.Sprintf("%d of %d countries are not valid ISO 3166 codes", len(invalid), len(req.Countries)), invalid)
+		return
+	}
+	if len(countries) == 0 {
+		writeError(w, r, "No countries to restrict: use DELETE to lift the restriction", http.StatusBadRequest)
+		return
+	}
+
+	value := ProductRestrictionValue{Countries: countries, Reason: req.Reason}
+	saveProductRestriction(w, r, kind, id, value)
+}
+
+// handleDeleteProductRestriction lifts the restriction of a product or collection
+func handleDeleteProductRestriction(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := restrictionParams(w, r)
+	if !ok {
+		return
+	}
+	saveProductRestriction(w, r, kind, id, ProductRestrictionValue{})
+}
+
+// saveProductRestriction writes a restriction to Shopify and the cache,
+// keeping the title and collection products the cache already knows
+func saveProductRestriction(w http.ResponseWriter, r *http.Request, kind string, id int64, value ProductRestrictionValue) {
+	if err := writeProductRestriction(r.Context(), kind, id, value); err != nil {
+		writeError(w, r, fmt.Sprintf("Failed to update the %s metafield: %v", strings.TrimSuffix(kind, "s"), err), http.StatusBadGateway)
+		return
+	}
+
+	restriction := ProductRestriction{Kind: kind, ID: id, ProductRestrictionValue: value}
+	current, _ := productRestrictions.List()
+	for _, existing := range current {
+		if existing.key() == restriction.key() {
+			restriction.Title, restriction.Products = existing.Title, existing.Products
+		}
+	}
+	if kind == restrictionCollection && restriction.Products == nil && len(value.Countries) > 0 {
+		products, err := fetchCollectionProducts(r.Context(), shopifyToken(currentShopifyConfig.APIKey), id)
+		if err != nil {
+			fmt.Printf("⚠️  Restriction of collection %d applies from the next refresh: %v\n", id, err)
+		}
+		restriction.Products = products
+	}
+	productRestrictions.Set(restriction)
+
+	recordAudit(r, "product-restriction", map[string]interface{}{
+		"restriction": restriction.key(),
+		"countries":   value.Countries,
+		"reason":      value.Reason,
+	})
+	if len(value.Countries) == 0 {
+		fmt.Printf("📦 Lifted the country restriction of %s\n", restriction.key())
+	} else {
+		fmt.Printf("📦 %s may no longer be sold to %v\n", restriction.key(), value.Countries)
+	}
+	handleListProductRestrictions(w, r)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProductRestrictions(t *testing.T) {
+	restrictions := &ProductRestrictions{}
+	restrictions.Replace([]ProductRestriction{
+		{Kind: restrictionCollection, ID: 7, Title: "Spirits", ProductRestrictionValue: ProductRestrictionValue{Countries: []string{"SA", "KW"}}, Products: []int64{1, 2}},
+		{Kind: restrictionProduct, ID: 3, Title: "Drone", ProductRestrictionValue: ProductRestrictionValue{Countries: []string{"CN"}, Reason: "export control"}},
+	}, time.Now())
+
+	tests := []struct {
+		product int64
+		country string
+		want    string
+	}{
+		{1, "SA", "collections/7"},
+		{2, "KW", "collections/7"},
+		{1, "FR", ""},
+		{3, "CN", "products/3"},
+		{3, "SA", ""},
+		{4, "SA", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if restriction := restrictions.Restriction(tt.product, tt.country); restriction != nil {
+			got = restriction.key()
+		}
+		if got != tt.want {
+			t.Errorf("Restriction(%d, %s) = %q, want %q", tt.product, tt.country, got, tt.want)
+		}
+	}
+
+	restrictions.Set(ProductRestriction{Kind: restrictionProduct, ID: 3})
+	restrictions.Set(ProductRestriction{Kind: restrictionProduct, ID: 9, ProductRestrictionValue: ProductRestrictionValue{Countries: []string{"US"}}})
+	list, _ := restrictions.List()
+	if len(list) != 2 || list[0].key() != "products/9" || list[1].key() != "collections/7" {
+		t.Errorf("List() = %+v", list)
+	}
+}
+
+func TestShopifyIDs(t *testing.T) {
+	gid, err := restrictionOwnerID(restrictionCollection, 42)
+	if err != nil || gid != "gid://shopify/Collection/42" || parseShopifyID(gid) != 42 {
+		t.Errorf("restrictionOwnerID = %q, %v", gid, err)
+	}
+	if _, err := restrictionOwnerID("variants", 1); err != errUnknownRestrictionKind {
+		t.Errorf("unknown kind error = %v", err)
+	}
+	if parseShopifyID("not an id") != 0 {
+		t.Error("parseShopifyID accepted an invalid ID")
+	}
+}
+
+func TestSetProductRestrictionValidation(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /product-restrictions/{kind}/{id}", handleSetProductRestriction)
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/product-restrictions/variants/1", `{"countries": ["US"]}`},
+		{"/product-restrictions/products/abc", `{"countries": ["US"]}`},
+		{"/product-restrictions/products/1", `{"countries": ["XX"]}`},
+		{"/product-restrictions/products/1", `{"countries": []}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body))
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s %s = %d, want 400", tt.path, tt.body, recorder.Code)
+		}
+	}
+}
+
+func TestValidateCheckoutProductRestrictions(t *testing.T) {
+	restrictions := &ProductRestrictions{}
+	restrictions.Replace([]ProductRestriction{
+		{Kind: restrictionProduct, ID: 3, Title: "Drone", ProductRestrictionValue: ProductRestrictionValue{Countries: []string{"CN"}}},
+	}, time.Now())
+
+	var input CheckoutValidationInput
+	err := json.Unmarshal([]byte(`{"cart": {"deliveryGroups": [
+		{"deliveryAddress": {"countryCode": "CN"}, "cartLines": [
+			{"merchandise": {"product": {"id": "gid://shopify/Product/1", "title": "T-shirt"}}},
+			{"merchandise": {"product": {"id": "gid://shopify/Product/3", "title": "Drone"}}},
+			{"merchandise": {}}
+		]},
+		{"deliveryAddress": {"countryCode": "FR"}, "cartLines": [
+			{"merchandise": {"product": {"id": "gid://shopify/Product/3", "title": "Drone"}}}
+		]}
+	]}}`), &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := validateCheckout(checkoutTestStore(t), restrictions, input)
+	if len(result.Errors) != 1 || result.Errors[0].Target != "$.cart.deliveryGroups[0].cartLines[1]" {
+		t.Fatalf("errors = %+v, want one for the drone shipped to CN", result.Errors)
+	}
+	if len(validateCheckout(checkoutTestStore(t), nil, input).Errors) != 0 {
+		t.Error("restrictions were enforced while disabled")
+	}
+}
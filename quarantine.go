@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// maxQuarantinedRequests caps the requests kept for review; the oldest is dropped first
+const maxQuarantinedRequests = 500
+
+// maxQuarantineReplayResponse bounds the replayed response body returned to the admin
+const maxQuarantineReplayResponse = 64 << 10
+
+// quarantineBlocked stores blocked POST, PUT and PATCH requests for review
+// instead of only dropping them. The client still gets the block response.
+var quarantineBlocked = getEnv("QUARANTINE_BLOCKED", "false") == "true"
+
+// quarantineMaxBody is how many bytes of a quarantined body are kept
+var quarantineMaxBody = quarantineBodyLimit()
+
+func quarantineBodyLimit() int {
+	limit := 64 << 10
+	if value := getEnv("QUARANTINE_MAX_BODY", ""); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			fmt.Printf("⚠️  Invalid QUARANTINE_MAX_BODY %q, using %d\n", value, limit)
+		} else {
+			limit = n
+		}
+	}
+	return limit
+}
+
+var (
+	errQuarantineNotFound  = errors.New("quarantined request not found")
+	errAlreadyReplayed     = errors.New("quarantined request was already replayed")
+	errTruncatedQuarantine = errors.New("quarantined request body was truncated and cannot be replayed")
+)
+
+// QuarantinedRequest is a blocked request kept for review. Credential
+// headers are never stored, so replays run without them.
+type QuarantinedRequest struct {
+	ID            string              `json:"id"`
+	QuarantinedAt string              `json:"quarantined_at"`
+	Method        string              `json:"method"`
+	Path          string              `json:"path"`
+	Query         string              `json:"query,omitempty"`
+	ClientIP      string              `json:"client_ip"`
+	Country       string              `json:"country_code"`
+	RuleID        string              `json:"rule_id,omitempty"`
+	Network       string              `json:"network,omitempty"`
+	Header        map[string][]string `json:"headers"`
+	Body          string              `json:"body"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+
+	ReplayedAt     string `json:"replayed_at,omitempty"`
+	ReplayedBy     string `json:"replayed_by,omitempty"`
+	ReplayedStatus int    `json:"replayed_status,omitempty"`
+
+	geo geoblock.RequestGeo
+}
+
+// Quarantine holds blocked requests until an admin replays or discards them
+type Quarantine struct {
+	mu       sync.Mutex
+	requests []*QuarantinedRequest
+}
+
+// Add keeps a request, dropping the oldest once the quarantine is full
+func (q *Quarantine) Add(request *QuarantinedRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.requests = append(q.requests, request)
+	if len(q.requests) > maxQuarantinedRequests {
+		q.requests = q.requests[len(q.requests)-maxQuarantinedRequests:]
+	}
+}
+
+// List returns copies of the quarantined requests, newest first
+func (q *Quarantine) List() []QuarantinedRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]QuarantinedRequest, 0, len(q.requests))
+	for i := len(q.requests) - 1; i >= 0; i-- {
+		list = append(list, *q.requests[i])
+	}
+	return list
+}
+
+// Get returns a copy of a quarantined request
+func (q *Quarantine) Get(id string) (QuarantinedRequest, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, request := range q.requests {
+		if request.ID == id {
+			return *request, true
+		}
+	}
+	return QuarantinedRequest{}, false
+}
+
+// Delete discards a quarantined request, reporting whether it existed
+func (q *Quarantine) Delete(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, request := range q.requests {
+		if request.ID == id {
+			q.requests = append(q.requests[:i], q.requests[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// claim marks a request as replayed by principal, so it is replayed at most once
+func (q *Quarantine) claim(id, principal string, at time.Time) (QuarantinedRequest, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, request := range q.requests {
+		if request.ID != id {
+			continue
+		}
+		switch {
+		case request.ReplayedAt != "":
+			return *request, errAlreadyReplayed
+		case request.BodyTruncated:
+			return *request, errTruncatedQuarantine
+		}
+		request.ReplayedAt = at.UTC().Format(time.RFC3339)
+		request.ReplayedBy = principal
+		return *request, nil
+	}
+	return QuarantinedRequest{}, errQuarantineNotFound
+}
+
+// setReplayStatus records the status code a replay received
+func (q *Quarantine) setReplayStatus(id string, status int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, request := range q.requests {
+		if request.ID == id {
+			request.ReplayedStatus = status
+		}
+	}
+}
+
+// quarantine holds requests blocked by the live blocking middleware
+var quarantine = &Quarantine{}
+
+// quarantineRequest keeps a blocked request with a body for review
+func quarantineRequest(r *http.Request, decision geoblock.Decision) {
+	if !quarantineBlocked || !decision.Blocked {
+		return
+	}
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return
+	}
+
+	// The blocked request never reaches its handler, so its body is free to read
+	body, err := io.ReadAll(io.LimitReader(r.Body, int64(quarantineMaxBody)+1))
+	if err != nil {
+		fmt.Printf("⚠️  Could not quarantine %s %s: %v\n", r.Method, r.URL.Path, err)
+		return
+	}
+	request := &QuarantinedRequest{
+		ID:            newRequestID(),
+		QuarantinedAt: time.Now().UTC().Format(time.RFC3339),
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Query:         r.URL.RawQuery,
+		ClientIP:      decision.Geo.ClientIP,
+		Country:       decision.Geo.Country,
+		Header:        make(map[string][]string, len(r.Header)),
+		BodyTruncated: len(body) > quarantineMaxBody,
+		geo:           decision.Geo,
+	}
+	if decision.Match != nil {
+		request.RuleID, request.Network = decision.Match.RuleID(), decision.Match.Network
+	}
+	if request.BodyTruncated {
+		body = body[:quarantineMaxBody]
+	}
+	request.Body = string(body)
+	for name, values := range r.Header {
+		if !credentialHeaders[name] {
+			request.Header[name] = append([]string(nil), values...)
+		}
+	}
+
+	quarantine.Add(request)
+	fmt.Printf("🧪 QUARANTINED: %s %s from %s (%s) as %s\n", r.Method, r.URL.Path, request.ClientIP, request.Country, request.ID)
+}
+
+// quarantineReplayKey marks a replayed request, which skips country blocking
+type quarantineReplayKey struct{}
+
+// isQuarantineReplay reports whether a request is an admin's replay of a
+// quarantined request; external clients cannot set the marker
+func isQuarantineReplay(ctx context.Context) bool {
+	replay, _ := ctx.Value(quarantineReplayKey{}).(bool)
+	return replay
+}
+
+// quarantineReplayHandler serves replays; main sets it to the server's handler
+var quarantineReplayHandler http.Handler
+
+// replayQuarantined sends a quarantined request through handler, past the
+// country block it hit, and records the response
+func replayQuarantined(handler http.Handler, request QuarantinedRequest) *httptest.ResponseRecorder {
+	target := request.Path
+	if request.Query != "" {
+		target += "?" + request.Query
+	}
+	req := httptest.NewRequest(request.Method, target, bytes.NewReader([]byte(request.Body)))
+	for name, values := range request.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if request.ClientIP != "" {
+		req.RemoteAddr = net.JoinHostPort(request.ClientIP, "0")
+	}
+	ctx := context.WithValue(req.Context(), quarantineReplayKey{}, true)
+	ctx = geoblock.ContextWithGeo(ctx, request.geo)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req.WithContext(ctx))
+	return recorder
+}
+
+type QuarantineListResponse struct {
+	Enabled  bool                 `json:"enabled"`
+	MaxBody  int                  `json:"max_body_bytes"`
+	Requests []QuarantinedRequest `json:"requests"`
+	Total    int                  `json:"total"`
+}
+
+type QuarantineReplayResponse struct {
+	ID         string              `json:"id"`
+	StatusCode int                 `json:"status_code"`
+	Header     map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
+}
+
+// handleListQuarantine lists quarantined requests, newest first
+func handleListQuarantine(w http.ResponseWriter, r *http.Request) {
+	requests := quarantine.List()
+	response := QuarantineListResponse{
+		Enabled:  quarantineBlocked,
+		MaxBody:  quarantineMaxBody,
+		Requests: requests,
+		Total:    len(requests),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGetQuarantined returns one quarantined request
+func handleGetQuarantined(w http.ResponseWriter, r *http.Request) {
+	request, ok := quarantine.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, errQuarantineNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(request)
+}
+
+// handleReplayQuarantined replays a quarantined request once, bypassing
+// country blocking, and returns the response it received
+func handleReplayQuarantined(w http.ResponseWriter, r *http.Request) {
+	request, err := quarantine.claim(r.PathValue("id"), changePrincipal(r), time.Now())
+	switch {
+	case errors.Is(err, errQuarantineNotFound):
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+
+	recorder := replayQuarantined(quarantineReplayHandler, request)
+	quarantine.setReplayStatus(request.ID, recorder.Code)
+	recordAudit(r, "replay-quarantined-request", map[string]interface{}{
+		"id":          request.ID,
+		"method":      request.Method,
+		"path":        request.Path,
+		"client_ip":   request.ClientIP,
+		"country":     request.Country,
+		"rule_id":     request.RuleID,
+		"status_code": recorder.Code,
+	})
+	fmt.Printf("🔁 Replayed quarantined %s %s (%s) by %s: %d\n", request.Method, request.Path, request.ID, request.ReplayedBy, recorder.Code)
+
+	body := recorder.Body.Bytes()
+	if len(body) > maxQuarantineReplayResponse {
+		body = body[:maxQuarantineReplayResponse]
+	}
+	response := QuarantineReplayResponse{
+		ID:         request.ID,
+		StatusCode: recorder.Code,
+		Header:     recorder.Header(),
+		Body:       string(body),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleDeleteQuarantined discards a quarantined request
+func handleDeleteQuarantined(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !quarantine.Delete(id) {
+		writeError(w, r, errQuarantineNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	recordAudit(r, "delete-quarantined-request", map[string]string{"id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
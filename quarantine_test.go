@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+func TestQuarantineRequest(t *testing.T) {
+	enabled, maxBody, stored := quarantineBlocked, quarantineMaxBody, quarantine
+	defer func() { quarantineBlocked, quarantineMaxBody, quarantine = enabled, maxBody, stored }()
+	quarantineBlocked, quarantineMaxBody, quarantine = true, 8, &Quarantine{}
+
+	blocked := geoblock.Decision{Geo: geoblock.RequestGeo{ClientIP: "203.0.113.7", Country: "RU"}, Blocked: true}
+	tests := []struct {
+		name          string
+		method        string
+		body          string
+		decision      geoblock.Decision
+		wantStored    bool
+		wantTruncated bool
+	}{
+		{"blocked post", "POST", `{"a":1}`, blocked, true, false},
+		{"long body truncated", "PUT", `{"a":12345}`, blocked, true, true},
+		{"blocked get ignored", "GET", "", blocked, false, false},
+		{"allowed post ignored", "POST", `{"a":1}`, geoblock.Decision{}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quarantine = &Quarantine{}
+			req := httptest.NewRequest(tt.method, "/api/v1/test-access?x=1", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("Content-Type", "application/json")
+			quarantineRequest(req, tt.decision)
+
+			list := quarantine.List()
+			if (len(list) == 1) != tt.wantStored {
+				t.Fatalf("stored %d requests, want stored = %v", len(list), tt.wantStored)
+			}
+			if !tt.wantStored {
+				return
+			}
+			got := list[0]
+			if got.BodyTruncated != tt.wantTruncated || len(got.Body) > quarantineMaxBody {
+				t.Errorf("body = %q (truncated %v), want truncated %v", got.Body, got.BodyTruncated, tt.wantTruncated)
+			}
+			if _, ok := got.Header["Authorization"]; ok {
+				t.Error("credentials were stored")
+			}
+			if got.Query != "x=1" || got.Country != "RU" {
+				t.Errorf("request = %+v", got)
+			}
+		})
+	}
+}
+
+func TestQuarantineReplay(t *testing.T) {
+	q := &Quarantine{}
+	q.Add(&QuarantinedRequest{ID: "ok", Method: "POST", Path: "/api/v1/test-access", Body: `{"order":42}`,
+		Header: map[string][]string{"Content-Type": {"application/json"}}, ClientIP: "203.0.113.7"})
+	q.Add(&QuarantinedRequest{ID: "cut", Method: "POST", Path: "/api/v1/test-access", BodyTruncated: true})
+
+	tests := []struct {
+		id      string
+		wantErr error
+	}{
+		{"ok", nil},
+		{"ok", errAlreadyReplayed},
+		{"cut", errTruncatedQuarantine},
+		{"missing", errQuarantineNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := q.claim(tt.id, "admin", time.Now()); !errors.Is(err, tt.wantErr) {
+			t.Errorf("claim(%s) = %v, want %v", tt.id, err, tt.wantErr)
+		}
+	}
+
+	request, _ := q.Get("ok")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !isQuarantineReplay(r.Context()) || string(body) != `{"order":42}` || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("replayed request: replay marker %v, body %q", isQuarantineReplay(r.Context()), body)
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	if recorder := replayQuarantined(handler, request); recorder.Code != http.StatusCreated {
+		t.Errorf("replay status = %d, want %d", recorder.Code, http.StatusCreated)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+const (
+	// rateLimitBucketIdle is how long an unused bucket is kept before cleanup
+	rateLimitBucketIdle = 10 * time.Minute
+
+	// maxRateLimitBuckets bounds the limiter's memory when many distinct clients appear
+	maxRateLimitBuckets = 100000
+)
+
+// trustedProxies are the proxy addresses whose forwarding headers identify
+// the client for rate limiting, from TRUSTED_PROXIES (IPs or CIDRs)
+var trustedProxies = parseTrustedProxies(getEnvList("TRUSTED_PROXIES", ""))
+
+func parseTrustedProxies(entries []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		cidr := entry
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			fmt.Printf("⚠️  Ignoring invalid TRUSTED_PROXIES entry %q\n", entry)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// remoteIP returns the IP of the connection's peer, ignoring forwarding headers
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// isTrustedProxy reports whether an IP belongs to a configured trusted proxy
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy reports whether a request's forwarding headers may be
+// believed: its peer is a TRUSTED_PROXIES address or connected through the
+// Unix socket. Anyone else can send whatever headers they like.
+func fromTrustedProxy(r *http.Request) bool {
+	return isTrustedProxy(remoteIP(r)) || unixSocketPeer(r)
+}
+
+// rateLimitIP is the address per-IP limits apply to: the client address
+// geolocation uses, so forwarding headers count only from a trusted proxy
+// and TRUSTED_PROXY_HOPS applies to Forwarded and X-Forwarded-For alike
+func rateLimitIP(r *http.Request) string {
+	ip, _ := clientIP(r)
+	return ip
+}
+
+type tokenBucket struct {
+	tokens        float64
+	lastSeen      time.Time
+	ratePerSecond float64
+	burst         float64
+}
+
+// refilledAt reports whether the bucket would be full at t, making it
+// indistinguishable from a new bucket
+func (b *tokenBucket) refilledAt(t time.Time) bool {
+	return b.tokens+t.Sub(b.lastSeen).Seconds()*b.ratePerSecond >= b.burst
+}
+
+// RateLimiter is a keyed token-bucket limiter holding at most maxBuckets keys
+type RateLimiter struct {
+	mu         sync.Mutex
+	buckets    map[string]*tokenBucket
+	maxBuckets int
+}
+
+func NewRateLimiter(maxBuckets int) *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*tokenBucket), maxBuckets: maxBuckets}
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *RateLimiter) Allow(key string, perMinute, burst int) (bool, time.Duration) {
+	return l.allowAt(key, perMinute, burst, time.Now())
+}
+
+func (l *RateLimiter) allowAt(key string, perMinute, burst int, now time.Time) (bool, time.Duration) {
+	ratePerSecond := float64(perMinute) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		l.makeRoom(now)
+		bucket = &tokenBucket{tokens: float64(burst), lastSeen: now}
+		l.buckets[key] = bucket
+	}
+	bucket.ratePerSecond = ratePerSecond
+	bucket.burst = float64(burst)
+
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*ratePerSecond)
+	bucket.lastSeen = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / ratePerSecond * float64(time.Second))
+	return false, wait
+}
+
+// makeRoom keeps the limiter under maxBuckets before a new key is added.
+// Refilled buckets are dropped first since forgetting them changes nothing;
+// if every bucket is still draining, an arbitrary one is evicted.
+func (l *RateLimiter) makeRoom(now time.Time) {
+	if l.maxBuckets <= 0 || len(l.buckets) < l.maxBuckets {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if bucket.refilledAt(now) {
+			delete(l.buckets, key)
+		}
+	}
+	for key := range l.buckets {
+		if len(l.buckets) < l.maxBuckets {
+			break
+		}
+		delete(l.buckets, key)
+	}
+}
+
+// cleanup drops buckets that have not been used recently
+func (l *RateLimiter) cleanup(idle time.Duration) {
+	cutoff := time.Now().Add(-idle)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, bucket := range l.buckets {
+		if bucket.lastSeen.Before(cutoff) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Limiter takes a token from a keyed bucket, reporting how long to wait when it is empty
+type Limiter interface {
+	Allow(key string, perMinute, burst int) (bool, time.Duration)
+}
+
+// countryRateLimiter holds the buckets of this instance
+var countryRateLimiter = NewRateLimiter(maxRateLimitBuckets)
+
+// rateLimiter is what countryRateLimitMiddleware uses: countryRateLimiter, or
+// a RedisRateLimiter when the replicas share state
+var rateLimiter Limiter = countryRateLimiter
+
+// startRateLimitCleanup periodically frees idle rate limit buckets
+func startRateLimitCleanup() {
+	go func() {
+		ticker := time.NewTicker(rateLimitBucketIdle)
+		defer ticker.Stop()
+		for range ticker.C {
+			countryRateLimiter.cleanup(rateLimitBucketIdle)
+		}
+	}()
+}
+
+// retryAfterSeconds rounds a wait up to the whole seconds used by Retry-After
+func retryAfterSeconds(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// writeRateLimited sends a 429 error envelope with a Retry-After header,
+// repeating the wait in the details as retry_after
+func writeRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration, message string) {
+	seconds := retryAfterSeconds(wait)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorDetails(w, r, http.StatusTooManyRequests, errorCode(http.StatusTooManyRequests), message, map[string]int{"retry_after": seconds})
+}
+
+// countryRateLimitMiddleware applies the policy's per-country rate limits.
+// It must run inside countryBlockingMiddleware, which resolves the country.
+func countryRateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		geo, ok := geoblock.GeoFromContext(r.Context())
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		limit := blocklist.RateLimitFor(geo.Country)
+		if limit == nil {
+			next(w, r)
+			return
+		}
+
+		clientIP := rateLimitIP(r)
+		key := "ip:" + clientIP
+		if limit.Scope == "country" {
+			key = "country:" + geo.Country
+		}
+
+		if allowed, wait := rateLimiter.Allow(key, limit.RequestsPerMinute, limit.Burst); !allowed {
+			fmt.Printf("🐢 RATE LIMITED: %s (%s) exceeded %d req/min\n", clientIP, geo.Country, limit.RequestsPerMinute)
+			writeRateLimited(w, r, wait, fmt.Sprintf("Rate limit of %d requests per minute exceeded for %s", limit.RequestsPerMinute, geo.Country))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Management endpoints that call Shopify or rewrite the blocklist are limited
+// per API key to MANAGEMENT_RATE_LIMIT requests per minute (default 30, 0 to
+// turn off), with bursts of up to MANAGEMENT_RATE_BURST (default 10)
+var (
+	managementRateLimit = getEnvInt("MANAGEMENT_RATE_LIMIT", 30)
+	managementRateBurst = getEnvInt("MANAGEMENT_RATE_BURST", 10)
+)
+
+// managementRateLimitMiddleware limits calls of a group of endpoints per API
+// key, or per client IP for anonymous callers. Each group has its own
+// buckets, so fetching customers does not use up blocklist changes. It must
+// run inside requireRole, which identifies the caller.
+func managementRateLimitMiddleware(group string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if managementRateLimit <= 0 {
+			next(w, r)
+			return
+		}
+
+		caller := "ip:" + rateLimitIP(r)
+		if principal := principalFromContext(r.Context()); principal != anonymousPrincipal {
+			caller = "key:" + principal.Name
+		}
+		burst := managementRateBurst
+		if burst < 1 {
+			burst = 1
+		}
+
+		if allowed, wait := rateLimiter.Allow("mgmt:"+group+":"+caller, managementRateLimit, burst); !allowed {
+			fmt.Printf("🐢 RATE LIMITED: %s exceeded %d req/min on %s\n", caller, managementRateLimit, group)
+			writeRateLimited(w, r, wait, fmt.Sprintf("Rate limit of %d requests per minute exceeded for %s", managementRateLimit, group))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		after       time.Duration
+		wantAllowed bool
+		wantWait    time.Duration
+	}
+	tests := []struct {
+		name      string
+		perMinute int
+		burst     int
+		steps     []step
+	}{
+		{
+			name:      "burst then refill at one token per second",
+			perMinute: 60,
+			burst:     2,
+			steps: []step{
+				{0, true, 0},
+				{0, true, 0},
+				{0, false, time.Second},
+				{500 * time.Millisecond, false, 500 * time.Millisecond},
+				{time.Second, true, 0},
+			},
+		},
+		{
+			name:      "slow rate reports long waits",
+			perMinute: 6,
+			burst:     1,
+			steps: []step{
+				{0, true, 0},
+				{0, false, 10 * time.Second},
+				{4 * time.Second, false, 6 * time.Second},
+				{10 * time.Second, true, 0},
+			},
+		},
+		{
+			name:      "idle time never refills past the burst",
+			perMinute: 60,
+			burst:     1,
+			steps: []step{
+				{0, true, 0},
+				{time.Hour, true, 0},
+				{0, false, time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(0)
+			now := start
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				allowed, wait := limiter.allowAt("key", tt.perMinute, tt.burst, now)
+				if allowed != s.wantAllowed || (wait-s.wantWait).Abs() > time.Millisecond {
+					t.Errorf("step %d: Allow = %v, %s; want %v, %s", i, allowed, wait, s.wantAllowed, s.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	now := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(3)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		limiter.allowAt(key, 60, 5, now)
+	}
+	if got := len(limiter.buckets); got > 3 {
+		t.Errorf("limiter holds %d buckets, want at most 3", got)
+	}
+	if _, ok := limiter.buckets["e"]; !ok {
+		t.Errorf("newest key was evicted")
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{0, 1},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{1001 * time.Millisecond, 2},
+		{59500 * time.Millisecond, 60},
+	}
+	for _, tt := range tests {
+		if got := retryAfterSeconds(tt.wait); got != tt.want {
+			t.Errorf("retryAfterSeconds(%s) = %d, want %d", tt.wait, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitIP(t *testing.T) {
+	defer func(saved []*net.IPNet, hops int) { trustedProxies, trustedProxyHops = saved, hops }(trustedProxies, trustedProxyHops)
+	trustedProxies, trustedProxyHops = parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}), 1
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"direct client ignores forwarding headers", "203.0.113.7:4321", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy uses nearest untrusted hop", "10.1.2.3:80", "198.51.100.1, 203.0.113.9", "203.0.113.9"},
+		{"trusted proxy chain is skipped", "10.1.2.3:80", "203.0.113.9, 192.0.2.1, 10.9.9.9", "203.0.113.9"},
+		{"trusted proxy without header", "192.0.2.1:80", "", "192.0.2.1"},
+		{"ipv6 peer", "[2001:db8::1]:443", "198.51.100.1", "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := rateLimitIP(r); got != tt.want {
+				t.Errorf("rateLimitIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitIPMatchesGetRealIP(t *testing.T) {
+	defer func(saved []*net.IPNet, hops int) { trustedProxies, trustedProxyHops = saved, hops }(trustedProxies, trustedProxyHops)
+	trustedProxies, trustedProxyHops = parseTrustedProxies([]string{"10.0.0.0/8"}), 2
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"forwarded through two proxies", map[string]string{"Forwarded": "for=198.51.100.1, for=203.0.113.9, for=198.51.100.20"}, "203.0.113.9"},
+		{"forwarded wins over x-forwarded-for", map[string]string{"Forwarded": "for=203.0.113.9;proto=https, for=198.51.100.20", "X-Forwarded-For": "198.51.100.66"}, "203.0.113.9"},
+		{"x-forwarded-for through two proxies", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.5, 198.51.100.30"}, "203.0.113.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.1.2.3:80"
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := rateLimitIP(r); got != tt.want {
+				t.Errorf("rateLimitIP = %q, want %q", got, tt.want)
+			}
+			if got := getRealIP(r); got != tt.want {
+				t.Errorf("getRealIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagementRateLimitMiddleware(t *testing.T) {
+	previousLimiter, previousLimit, previousBurst := rateLimiter, managementRateLimit, managementRateBurst
+	rateLimiter, managementRateLimit, managementRateBurst = NewRateLimiter(100), 60, 2
+	defer func() {
+		rateLimiter, managementRateLimit, managementRateBurst = previousLimiter, previousLimit, previousBurst
+	}()
+
+	handler := func(group string) http.HandlerFunc {
+		return managementRateLimitMiddleware(group, func(w http.ResponseWriter, r *http.Request) {})
+	}
+	dashboard := &Principal{Name: "dashboard", Role: RoleAdmin}
+	script := &Principal{Name: "script", Role: RoleAdmin}
+
+	tests := []struct {
+		name       string
+		group      string
+		principal  *Principal
+		wantStatus int
+	}{
+		{"first in burst", "block-countries", dashboard, http.StatusOK},
+		{"second in burst", "block-countries", dashboard, http.StatusOK},
+		{"burst used up", "block-countries", dashboard, http.StatusTooManyRequests},
+		{"other key has its own bucket", "block-countries", script, http.StatusOK},
+		{"other group has its own bucket", "customers", dashboard, http.StatusOK},
+		{"anonymous callers are limited by IP", "customers", anonymousPrincipal, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/v1/"+tt.group, nil)
+			r = r.WithContext(context.WithValue(r.Context(), principalContextKey{}, tt.principal))
+			w := httptest.NewRecorder()
+			handler(tt.group)(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+				t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestWriteRateLimited(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/test-access", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, "req-1"))
+	w := httptest.NewRecorder()
+	writeRateLimited(w, r, 1500*time.Millisecond, "Rate limit exceeded")
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("got %d with Retry-After %q, want 429 with 2", w.Code, w.Header().Get("Retry-After"))
+	}
+	var body struct {
+		Error struct {
+			Code      string         `json:"code"`
+			Message   string         `json:"message"`
+			Details   map[string]int `json:"details"`
+			RequestID string         `json:"request_id"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != "too_many_requests" || body.Error.Details["retry_after"] != 2 || body.Error.RequestID != "req-1" {
+		t.Errorf("envelope = %+v", body.Error)
+	}
+}
@@ -128,7 +128,7 @@ class RealVPNTester {
         
         try {
             const response = await this.page.evaluate(async (apiUrl) => {
-                const resp = await fetch(`${apiUrl}/api/ip-info`);
+                const resp = await fetch(`${apiUrl}/api/v1/ip-info`);
                 if (!resp.ok) throw new Error(`HTTP ${resp.status}`);
                 return await resp.json();
             }, this.apiBaseUrl);
@@ -230,7 +230,7 @@ class RealVPNTester {
         
         try {
             const response = await this.page.evaluate(async (apiUrl) => {
-                const resp = await fetch(`${apiUrl}/api/test-access`);
+                const resp = await fetch(`${apiUrl}/api/v1/test-access`);
                 const data = await resp.json();
                 return {
                     status: resp.status,
@@ -260,7 +260,7 @@ class RealVPNTester {
         
         try {
             await this.page.evaluate(async (apiUrl, countriesToBlock) => {
-                const resp = await fetch(`${apiUrl}/api/block-countries`, {
+                const resp = await fetch(`${apiUrl}/api/v1/block-countries`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({ countries: countriesToBlock })
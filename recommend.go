@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// recommendationWindow is how much recent traffic a recommendation considers
+const recommendationWindow = "7d"
+
+// CountryRecommendation explains whether one country should be blocked
+type CountryRecommendation struct {
+	CountryCode      string   `json:"country_code"`
+	CountryName      string   `json:"country_name"`
+	Block            bool     `json:"block"`
+	CurrentlyBlocked bool     `json:"currently_blocked"`
+	PresenceScore    float64  `json:"presence_score"`
+	Customers        int      `json:"customers"`
+	Requests         int      `json:"requests"`
+	Blocks           int      `json:"blocks"`
+	RiskLists        []string `json:"risk_lists,omitempty"`
+	Reasons          []string `json:"reasons"`
+}
+
+// RecommendationResponse is a suggested blocklist. Sending Blocklist to
+// POST /api/v1/block-countries, edited or not, applies it.
+type RecommendationResponse struct {
+	Blocklist []string                `json:"recommended_blocklist"`
+	Add       []string                `json:"add"`
+	Remove    []string                `json:"remove"`
+	Countries []CountryRecommendation `json:"countries"`
+	Threshold float64                 `json:"threshold"`
+	Window    string                  `json:"window"`
+}
+
+// recommendBlocking decides for every country with customers, traffic, a
+// high-risk listing or an existing block whether it should be blocked:
+//   - legally mandated lists (sanctions) are always blocked
+//   - other high-risk lists are blocked unless the store has presence there
+//   - countries without presence are blocked once they send traffic, and stay blocked
+//   - countries with presence are never blocked otherwise
+//
+// Countries without any signal are left out: blocking them changes nothing.
+func recommendBlocking(presence []CountryPresence, threshold float64, traffic []CountryTraffic, riskLists []CountryPreset) RecommendationResponse {
+	trafficByCountry := make(map[string]CountryTraffic, len(traffic))
+	for _, country := range traffic {
+		trafficByCountry[country.CountryCode] = country
+	}
+	listed := make(map[string][]CountryPreset)
+	for _, list := range riskLists {
+		for _, code := range list.Countries {
+			listed[code] = append(listed[code], list)
+		}
+	}
+
+	response := RecommendationResponse{
+		Blocklist: []string{},
+		Add:       []string{},
+		Remove:    []string{},
+		Countries: []CountryRecommendation{},
+		Threshold: threshold,
+		Window:    recommendationWindow,
+	}
+	for _, country := range presence {
+		seen := trafficByCountry[country.CountryCode]
+		lists := listed[country.CountryCode]
+		if country.Customers == 0 && seen.Requests == 0 && len(lists) == 0 && !country.Blocked {
+			continue
+		}
+
+		rec := CountryRecommendation{
+			CountryCode:      country.CountryCode,
+			CountryName:      country.CountryName,
+			CurrentlyBlocked: country.Blocked,
+			PresenceScore:    country.Score,
+			Customers:        country.Customers,
+			Requests:         seen.Requests,
+			Blocks:           seen.Blocks,
+		}
+
+		mandated := false
+		for _, list := range lists {
+			rec.RiskLists = append(rec.RiskLists, list.ID)
+			if list.LegalReference != "" {
+				mandated = true
+				rec.Reasons = append(rec.Reasons, fmt.Sprintf("Legally mandated by %s", list.Name))
+			} else {
+				rec.Reasons = append(rec.Reasons, fmt.Sprintf("Listed on %s", list.Name))
+			}
+		}
+
+		switch {
+		case country.HasPresence:
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("Business presence: score %.3g from %d customer(s)", country.Score, country.Customers))
+		case country.Customers > 0:
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("Presence score %.3g is below the %.3g threshold", country.Score, response.Threshold))
+		default:
+			rec.Reasons = append(rec.Reasons, "No customers")
+		}
+		if country.Blocked {
+			rec.Reasons = append(rec.Reasons, "Currently blocked")
+		}
+		if seen.Requests > 0 {
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("%d request(s), %d blocked, in the last %s", seen.Requests, seen.Blocks, recommendationWindow))
+		}
+
+		rec.Block = mandated || (!country.HasPresence && (len(lists) > 0 || seen.Requests > 0 || country.Blocked))
+		if mandated && country.HasPresence {
+			rec.Reasons = append(rec.Reasons, "Blocking is required despite business presence")
+		}
+
+		if rec.Block {
+			response.Blocklist = append(response.Blocklist, rec.CountryCode)
+			if !rec.CurrentlyBlocked {
+				response.Add = append(response.Add, rec.CountryCode)
+			}
+		} else if rec.CurrentlyBlocked {
+			response.Remove = append(response.Remove, rec.CountryCode)
+		}
+		response.Countries = append(response.Countries, rec)
+	}
+
+	sort.Strings(response.Blocklist)
+	sort.Strings(response.Add)
+	sort.Strings(response.Remove)
+	sort.SliceStable(response.Countries, func(i, j int) bool {
+		return response.Countries[i].Block && !response.Countries[j].Block
+	})
+	return response
+}
+
+// handleRecommendBlocking suggests a blocklist from business presence, the
+// last week of traffic and the high-risk country presets, with the reasoning
+// for each country so the merchant can accept or edit it
+func handleRecommendBlocking(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("🧭 Building blocking recommendation...")
+
+	threshold, ok := presenceThreshold(w, r)
+	if !ok {
+		return
+	}
+	presence, ok := storeBusinessPresence(w, r, threshold)
+	if !ok {
+		return
+	}
+	traffic := trafficAnalytics.Summary(trafficWindows[recommendationWindow], time.Now())
+
+	response := recommendBlocking(presence, threshold, traffic, listPresets())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	fmt.Printf("✅ Recommended blocking %d countries (+%d, -%d)\n", len(response.Blocklist), len(response.Add), len(response.Remove))
+}
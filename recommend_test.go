@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecommendBlocking(t *testing.T) {
+	presence := []CountryPresence{
+		{CountryCode: "US", Customers: 10, Score: 1, HasPresence: true},
+		{CountryCode: "RU", Customers: 3, Score: 0.3, HasPresence: true},
+		{CountryCode: "IR", Customers: 2, Score: 0.2, HasPresence: true},
+		{CountryCode: "CA", Customers: 1, Score: 0.01, Blocked: true},
+		{CountryCode: "MM"},
+		{CountryCode: "BR"},
+		{CountryCode: "DE", Score: 0.5, Customers: 5, HasPresence: true, Blocked: true},
+		{CountryCode: "FI", Blocked: true},
+		{CountryCode: "JP"},
+	}
+	traffic := []CountryTraffic{
+		{CountryCode: "BR", Requests: 40, Blocks: 0},
+		{CountryCode: "US", Requests: 100},
+	}
+	riskLists := []CountryPreset{
+		{ID: "sanctions", Name: "Sanctions", LegalReference: "Act 1", Countries: []string{"IR"}},
+		{ID: "fraud", Name: "Fraud risk", Countries: []string{"RU", "MM"}},
+	}
+
+	got := recommendBlocking(presence, 0.05, traffic, riskLists)
+
+	if want := []string{"BR", "CA", "FI", "IR", "MM"}; !reflect.DeepEqual(got.Blocklist, want) {
+		t.Errorf("Blocklist = %v, want %v", got.Blocklist, want)
+	}
+	if want := []string{"BR", "IR", "MM"}; !reflect.DeepEqual(got.Add, want) {
+		t.Errorf("Add = %v, want %v", got.Add, want)
+	}
+	if want := []string{"DE"}; !reflect.DeepEqual(got.Remove, want) {
+		t.Errorf("Remove = %v, want %v", got.Remove, want)
+	}
+
+	byCode := make(map[string]CountryRecommendation)
+	for _, rec := range got.Countries {
+		byCode[rec.CountryCode] = rec
+		if len(rec.Reasons) == 0 {
+			t.Errorf("%s has no reasons", rec.CountryCode)
+		}
+	}
+	if _, ok := byCode["JP"]; ok {
+		t.Error("JP has no customers, traffic, listing or block and should be left out")
+	}
+	if rec := byCode["RU"]; rec.Block || !reflect.DeepEqual(rec.RiskLists, []string{"fraud"}) {
+		t.Errorf("RU = %+v, want listed on fraud but not blocked due to presence", rec)
+	}
+	if len(got.Countries) != 8 || !got.Countries[0].Block || got.Countries[len(got.Countries)-1].Block {
+		t.Errorf("countries should list the 5 blocked first, got %+v", got.Countries)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedMark replaces a masked value in log output
+const redactedMark = "[REDACTED]"
+
+// minLogSecretLength keeps very short configured values, which would mask
+// ordinary words, out of the secret list
+const minLogSecretLength = 6
+
+// logSecretEnv are the variables whose values never appear in logs
+var logSecretEnv = []string{
+	"SHOPIFY_ACCESS_TOKEN", "SHOPIFY_API_SECRET", "ADMIN_API_KEY", "CHALLENGE_SECRET",
+	"TURNSTILE_SECRET_KEY", "HCAPTCHA_SECRET", "IPINFO_TOKEN", "IPAPI_KEY", "IPSTACK_ACCESS_KEY",
+	"ABUSEIPDB_API_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "FASTLY_API_TOKEN",
+	"PII_HASH_KEY", "SECRETS_MASTER_KEY", "SECRETS_PREVIOUS_MASTER_KEYS", "GOOGLE_GEOCODING_API_KEY",
+}
+
+var (
+	// shopifyTokenPattern matches Shopify access tokens and app secrets
+	shopifyTokenPattern = regexp.MustCompile(`shp(at|ss|ca|pa)_[0-9A-Fa-f]{32}`)
+
+	// bearerPattern matches a bearer token, e.g. from an Authorization header
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9._~+/-]+=*`)
+
+	// secretParamPattern matches key=value and "key": "value" pairs whose
+	// name says they hold a credential, keeping the name
+	secretParamPattern = regexp.MustCompile(`(?i)(\b(?:access[_-]?token|api[_-]?key|token|secret|password|passwd)["']?\s*[:=]\s*["']?)([^\s"'&,;]+)`)
+
+	// urlPasswordPattern matches the password in URLs like postgres://user:password@db
+	urlPasswordPattern = regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`)
+
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@([A-Za-z0-9-]+\.)+[A-Za-z]{2,}`)
+
+	ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+	// ipv6CandidatePattern finds what may be an IPv6 address; net.ParseIP decides
+	ipv6CandidatePattern = regexp.MustCompile(`[0-9A-Fa-f]*:[0-9A-Fa-f]*:[0-9A-Fa-f:.]*`)
+)
+
+// LogRedactor masks secrets, emails and IP addresses in log lines
+type LogRedactor struct {
+	secretsEnabled bool
+	emails         bool
+	ips            bool
+
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// NewLogRedactor masks the categories named in kinds: "secrets" (known
+// secret values and anything shaped like a credential), "emails" and "ips".
+// "none" turns redaction off.
+func NewLogRedactor(kinds []string) *LogRedactor {
+	r := &LogRedactor{}
+	for _, kind := range kinds {
+		switch strings.ToLower(kind) {
+		case "secrets":
+			r.secretsEnabled = true
+		case "emails":
+			r.emails = true
+		case "ips":
+			r.ips = true
+		case "none":
+		default:
+			fmt.Printf("⚠️  Ignoring unknown LOG_REDACT entry %q: use secrets, emails, ips or none\n", kind)
+		}
+	}
+	return r
+}
+
+// Enabled reports whether any category is masked
+func (r *LogRedactor) Enabled() bool {
+	return r.secretsEnabled || r.emails || r.ips
+}
+
+// AddSecret masks a value wherever it appears, such as a token received at runtime
+func (r *LogRedactor) AddSecret(secret string) {
+	if len(secret) < minLogSecretLength {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, known := range r.secrets {
+		if known == secret {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret)
+	// Longest first, so a secret containing another is masked whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// Redact masks a log line
+func (r *LogRedactor) Redact(line string) string {
+	if r.secretsEnabled {
+		r.mu.RLock()
+		for _, secret := range r.secrets {
+			line = strings.ReplaceAll(line, secret, redactedMark)
+		}
+		r.mu.RUnlock()
+		line = shopifyTokenPattern.ReplaceAllString(line, redactedMark)
+		line = bearerPattern.ReplaceAllString(line, "$1 "+redactedMark)
+		line = secretParamPattern.ReplaceAllString(line, "${1}"+redactedMark)
+		line = urlPasswordPattern.ReplaceAllString(line, "${1}"+redactedMark+"@")
+	}
+	if r.emails {
+		line = emailPattern.ReplaceAllStringFunc(line, maskEmail)
+	}
+	if r.ips {
+		line = ipv4Pattern.ReplaceAllStringFunc(line, maskIP)
+		line = ipv6CandidatePattern.ReplaceAllStringFunc(line, maskIP)
+	}
+	return line
+}
+
+// maskEmail keeps the first character and the domain, e.g. "a***@example.com"
+func maskEmail(email string) string {
+	local, domain, _ := strings.Cut(email, "@")
+	return local[:1] + "***@" + domain
+}
+
+// maskIP keeps the network of an address, /24 for IPv4 and /48 for IPv6, so
+// logs still show where traffic comes from
+func maskIP(candidate string) string {
+	ip := net.ParseIP(candidate)
+	if ip == nil {
+		return candidate
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.x", v4[0], v4[1], v4[2])
+	}
+	masked := make(net.IP, net.IPv6len)
+	copy(masked, ip.Mask(net.CIDRMask(48, 128)))
+	return masked.String() + "/48"
+}
+
+// logRedactor masks log output. LOG_REDACT lists what is masked, by default
+// "secrets,emails"; add "ips" to mask client addresses too.
+var logRedactor = newLogRedactor()
+
+func newLogRedactor() *LogRedactor {
+	r := NewLogRedactor(getEnvList("LOG_REDACT", "secrets,emails"))
+	for _, name := range logSecretEnv {
+		for _, value := range getEnvList(name, "") {
+			r.AddSecret(value)
+		}
+	}
+	for token := range apiTokens {
+		r.AddSecret(token)
+	}
+	return r
+}
+
+// redactingWriter masks everything written through it
+type redactingWriter struct {
+	out      io.Writer
+	redactor *LogRedactor
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, w.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// installLogRedaction routes stdout, where the server logs with fmt.Print,
+// and the log package through logRedactor. Stdout is read back line by line,
+// so a line is only masked once complete.
+func installLogRedaction() {
+	if !logRedactor.Enabled() {
+		return
+	}
+	log.SetOutput(&redactingWriter{out: os.Stderr, redactor: logRedactor})
+
+	stdout := os.Stdout
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		fmt.Printf("⚠️  Log redaction disabled: %v\n", err)
+		return
+	}
+	os.Stdout = writer
+	go func() {
+		lines := bufio.NewReader(reader)
+		for {
+			line, err := lines.ReadString('\n')
+			if line != "" {
+				io.WriteString(stdout, logRedactor.Redact(line))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"shopify-customers/geoblock"
+)
+
+// redisTimeout bounds every Redis call on a request path, so a slow Redis
+// degrades to per-instance state instead of stalling requests
+const redisTimeout = 250 * time.Millisecond
+
+var (
+	// redisURL enables state shared by every replica, e.g. redis://:password@redis:6379/0
+	redisURL = getEnv("REDIS_URL", "")
+
+	// redisKeyPrefix namespaces keys and channels so several deployments can share one Redis
+	redisKeyPrefix = getEnv("REDIS_KEY_PREFIX", "geoblock:")
+
+	// geoCacheTTL is how long a resolved country is shared before it is looked up again
+	geoCacheTTL = getEnvDuration("GEO_CACHE_TTL", 24*time.Hour)
+)
+
+// SharedState keeps the blocklist, geo lookups and rate limit buckets in
+// Redis so replicas behind a load balancer act as one server. Blocklist
+// changes are announced on a pub/sub channel and every other replica reloads.
+type SharedState struct {
+	client   *redis.Client
+	prefix   string
+	instance string
+}
+
+// sharedState is nil unless REDIS_URL is set
+var sharedState = connectSharedState()
+
+func connectSharedState() *SharedState {
+	if redisURL == "" {
+		return nil
+	}
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		fmt.Printf("⚠️  Shared state disabled: invalid REDIS_URL: %v\n", err)
+		return nil
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &SharedState{
+		client:   redis.NewClient(options),
+		prefix:   redisKeyPrefix,
+		instance: hex.EncodeToString(id),
+	}
+}
+
+func (s *SharedState) policyKey() string     { return s.prefix + "policy" }
+func (s *SharedState) policyChannel() string { return s.prefix + "policy-changed" }
+
+// Ping checks that Redis answers
+func (s *SharedState) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// LoadPolicy returns the shared policy, or nil if none has been stored yet
+func (s *SharedState) LoadPolicy(ctx context.Context) (*geoblock.Policy, error) {
+	data, err := s.client.Get(ctx, s.policyKey()).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var policy geoblock.Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse shared policy: %w", err)
+	}
+	if err := normalizePolicy(&policy); err != nil {
+		return nil, fmt.Errorf("shared policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// PublishPolicy stores the policy and tells the other replicas to load it.
+// It does nothing when shared state is disabled.
+func (s *SharedState) PublishPolicy(policy *geoblock.Policy) error {
+	if s == nil {
+		return nil
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.client.Set(ctx, s.policyKey(), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to share blocking policy: %w", err)
+	}
+	return s.client.Publish(ctx, s.policyChannel(), s.instance).Err()
+}
+
+// Start adopts the shared policy, if there is one, as the local policy file
+// and then follows changes published by other replicas. It runs before the
+// policy is first loaded, so a new replica starts from the shared blocklist.
+func (s *SharedState) Start() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	policy, err := s.LoadPolicy(ctx)
+	cancel()
+	switch {
+	case err != nil:
+		fmt.Printf("⚠️  Could not load shared blocking policy, starting from %s: %v\n", policyFilePath, err)
+	case policy != nil:
+		if err := savePolicy(policyFilePath, policy); err != nil {
+			fmt.Printf("⚠️  Could not save shared blocking policy to %s: %v\n", policyFilePath, err)
+		}
+	}
+
+	pubsub := s.client.Subscribe(context.Background(), s.policyChannel())
+	go func() {
+		for message := range pubsub.Channel() {
+			if message.Payload != s.instance {
+				s.followPolicy()
+			}
+		}
+	}()
+	fmt.Printf("🔗 Sharing blocklist, geo cache and rate limits through Redis (instance %s)\n", s.instance)
+}
+
+// followPolicy applies a policy another replica published
+func (s *SharedState) followPolicy() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	policy, err := s.LoadPolicy(ctx)
+	if err != nil || policy == nil {
+		fmt.Printf("❌ Could not load blocking policy published by another instance: %v\n", err)
+		return
+	}
+
+	policyChangeMu.Lock()
+	defer policyChangeMu.Unlock()
+	if _, err := blocklist.ReplacePolicy(policy); err != nil {
+		fmt.Printf("❌ Rejected blocking policy published by another instance: %v\n", err)
+		return
+	}
+	if err := savePolicy(policyFilePath, policy); err != nil {
+		fmt.Printf("⚠️  Could not save shared blocking policy to %s: %v\n", policyFilePath, err)
+	}
+	recordPolicyVersion(nil, "sync-from-peer", policy)
+	fmt.Printf("🔗 Applied blocking policy from another instance: %d countries blocked\n", len(policy.BlockedCountries))
+}
+
+// redisGeoCache shares resolved countries between replicas
+type redisGeoCache struct {
+	state *SharedState
+}
+
+func (c redisGeoCache) key(ip string) string { return c.state.prefix + "geo:" + ip }
+
+func (c redisGeoCache) Get(ctx context.Context, ip string) (string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	country, err := c.state.client.Get(ctx, c.key(ip)).Result()
+	return country, err == nil && country != ""
+}
+
+func (c redisGeoCache) Set(ctx context.Context, ip, country string) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	c.state.client.Set(ctx, c.key(ip), country, geoCacheTTL)
+}
+
+// redisTokenBucket takes one token from a bucket stored as a hash of tokens
+// and last refill time (ms), returning {allowed, ms until the next token}
+var redisTokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`)
+
+// RedisRateLimiter is a token-bucket limiter whose buckets every replica shares.
+// If Redis fails, it falls back to the local limiter so requests keep flowing.
+type RedisRateLimiter struct {
+	state    *SharedState
+	fallback Limiter
+}
+
+func (l *RedisRateLimiter) Allow(key string, perMinute, burst int) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	rate := float64(perMinute) / 60
+	result, err := redisTokenBucket.Run(ctx, l.state.client, []string{l.state.prefix + "ratelimit:" + key},
+		rate, burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil || len(result) != 2 {
+		return l.fallback.Allow(key, perMinute, burst)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond
+}
+
+// startSharedState switches the geo cache and rate limiter to Redis and
+// follows blocklist changes from other replicas, if REDIS_URL is set
+func startSharedState() {
+	if sharedState == nil {
+		return
+	}
+	geoResolver.Cache = redisGeoCache{state: sharedState}
+	rateLimiter = &RedisRateLimiter{state: sharedState, fallback: countryRateLimiter}
+	sharedState.Start()
+}
+
+// checkRedis reports whether the shared state store is reachable
+func checkRedis(ctx context.Context) error {
+	if sharedState == nil {
+		return errCheckSkipped
+	}
+	return sharedState.Ping(ctx)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisRateLimiterFallsBackWhenRedisIsDown(t *testing.T) {
+	state := &SharedState{
+		client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}),
+		prefix: "test:",
+	}
+	defer state.client.Close()
+	limiter := &RedisRateLimiter{state: state, fallback: NewRateLimiter(10)}
+
+	if allowed, _ := limiter.Allow("ip:203.0.113.7", 60, 1); !allowed {
+		t.Fatal("first request denied, want the local bucket to allow it")
+	}
+	if allowed, wait := limiter.Allow("ip:203.0.113.7", 60, 1); allowed || wait <= 0 {
+		t.Errorf("second request = %v, %v, want denied by the local bucket", allowed, wait)
+	}
+}
+
+func TestSharedStateDisabled(t *testing.T) {
+	var state *SharedState
+	if err := state.PublishPolicy(nil); err != nil {
+		t.Errorf("PublishPolicy without Redis = %v, want nil", err)
+	}
+}
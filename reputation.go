@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// maxReputationEntries caps the addresses whose reputation score is cached
+const maxReputationEntries = 100000
+
+// reputationProvider scores clients for rules with reputation_above. It is
+// nil unless REPUTATION_PROVIDER is set, in which case those rules never match.
+var reputationProvider = newReputationProvider()
+
+// newReputationProvider builds the provider named by REPUTATION_PROVIDER,
+// caching scores for REPUTATION_CACHE_TTL
+func newReputationProvider() geoblock.ReputationProvider {
+	name := strings.ToLower(getEnv("REPUTATION_PROVIDER", ""))
+	timeout := getEnvDuration("REPUTATION_TIMEOUT", 3*time.Second)
+
+	var provider geoblock.ReputationProvider
+	switch name {
+	case "":
+		return nil
+	case "abuseipdb":
+		key := getEnv("ABUSEIPDB_API_KEY", "")
+		if key == "" {
+			fmt.Println("⚠️  Skipping abuseipdb reputation provider: ABUSEIPDB_API_KEY is not set")
+			return nil
+		}
+		maxAge := 90
+		if value := getEnv("ABUSEIPDB_MAX_AGE_DAYS", ""); value != "" {
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 1 || days > 365 {
+				fmt.Printf("⚠️  Invalid ABUSEIPDB_MAX_AGE_DAYS %q, using %d\n", value, maxAge)
+			} else {
+				maxAge = days
+			}
+		}
+		abuseIPDB := geoblock.NewAbuseIPDB(key, maxAge, timeout)
+		abuseIPDB.SetHTTPClient(newHTTPClient(timeout))
+		provider = abuseIPDB
+	default:
+		fmt.Printf("⚠️  Unknown reputation provider %q in REPUTATION_PROVIDER\n", name)
+		return nil
+	}
+
+	return geoblock.NewReputationCache(provider, getEnvDuration("REPUTATION_CACHE_TTL", 24*time.Hour), maxReputationEntries)
+}
+
+// reputationOptions configures the middleware's reputation provider, if any
+func reputationOptions() []geoblock.Option {
+	if reputationProvider == nil {
+		return nil
+	}
+	return []geoblock.Option{geoblock.WithReputation(reputationProvider)}
+}
@@ -26,7 +26,7 @@ Start-Sleep 4
 # Test the server
 Write-Host "🧪 Testing enhanced IP detection..." -ForegroundColor Cyan
 try {
-    $result = Invoke-RestMethod "http://localhost:8080/api/ip-info" -TimeoutSec 10
+    $result = Invoke-RestMethod "http://localhost:8080/api/v1/ip-info" -TimeoutSec 10
     Write-Host "✅ Success! Detected IP and Country:" -ForegroundColor Green
     Write-Host "   IP: $($result.ip)" -ForegroundColor White
     Write-Host "   Country: $($result.country_name) ($($result.country_code))" -ForegroundColor White
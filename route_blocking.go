@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"shopify-customers/geoblock"
+)
+
+// blockedRoutes lists further routes to put behind country blocking, in
+// addition to /api/v1/test-access. Entries are route patterns relative to
+// /api/v1, or /admin paths, with an optional method, e.g. "POST /customers";
+// a trailing "*" makes the path a prefix, e.g. "/block-countries*" or "*"
+var blockedRoutes = getEnvList("BLOCKED_ROUTES", "")
+
+// operatorCountries always pass the country check on BLOCKED_ROUTES, so a
+// blocklist change cannot lock the operators out of the management API.
+// BLOCKED_ROUTES is ignored unless it is set.
+var operatorCountries = loadOperatorCountries()
+
+// neverBlockedRoutes are never wrapped by BLOCKED_ROUTES: test-access is
+// always blocked and blocked clients must be able to answer a challenge
+var neverBlockedRoutes = []string{"/test-access", "/challenge"}
+
+// loadOperatorCountries reads OPERATOR_COUNTRIES, skipping invalid codes
+func loadOperatorCountries() []string {
+	codes, errs := normalizeCountryCodes(getEnvList("OPERATOR_COUNTRIES", ""))
+	for _, err := range errs {
+		fmt.Printf("⚠️  Ignoring OPERATOR_COUNTRIES entry: %s\n", err.Error)
+	}
+	return codes
+}
+
+// routeBlockingEnabled reports whether BLOCKED_ROUTES applies, warning once
+// about a configuration without the OPERATOR_COUNTRIES safeguard
+var routeBlockingEnabled = func() bool {
+	if len(blockedRoutes) == 0 {
+		return false
+	}
+	if len(operatorCountries) == 0 {
+		fmt.Println("⚠️  BLOCKED_ROUTES is ignored: set OPERATOR_COUNTRIES to the countries the API is managed from")
+		return false
+	}
+	return true
+}()
+
+// routeMatches reports whether a route pattern such as
+// "DELETE /block-countries/{code}" is listed in entries
+func routeMatches(entries []string, pattern string) bool {
+	method, route, found := strings.Cut(pattern, " ")
+	if !found {
+		method, route = "", pattern
+	}
+	for _, entry := range entries {
+		entryMethod, entryRoute, found := strings.Cut(entry, " ")
+		if !found {
+			entryMethod, entryRoute = "", entry
+		}
+		if entryMethod != "" && !strings.EqualFold(entryMethod, method) {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(entryRoute, "*"); ok {
+			if strings.HasPrefix(route, prefix) {
+				return true
+			}
+		} else if route == entryRoute {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlockedRoute reports whether BLOCKED_ROUTES puts a route behind
+// country blocking
+func isBlockedRoute(pattern string) bool {
+	if !routeBlockingEnabled {
+		return false
+	}
+	method, route, found := strings.Cut(pattern, " ")
+	if !found {
+		route = pattern
+	}
+	if method == http.MethodOptions || slices.Contains(neverBlockedRoutes, route) {
+		return false
+	}
+	return routeMatches(blockedRoutes, pattern)
+}
+
+// routeBlockingMiddleware applies country blocking to a BLOCKED_ROUTES
+// route, letting requests from OPERATOR_COUNTRIES through regardless of
+// the blocklist
+func routeBlockingMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	blocked := countryBlockingMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isQuarantineReplay(r.Context()) || blocker.Skips(r) {
+			next(w, r)
+			return
+		}
+		geo := resolveRequestGeo(r)
+		r = r.WithContext(geoblock.ContextWithGeo(r.Context(), geo))
+		if slices.Contains(operatorCountries, geo.Country) {
+			next(w, r)
+			return
+		}
+		blocked(w, r)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestRouteMatches(t *testing.T) {
+	entries := []string{"POST /customers", "/secrets", "/block-countries*", "get /admin/*"}
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"POST /customers", true},
+		{"GET /customers/{id}/export", false},
+		{"GET /secrets", true},
+		{"POST /secrets/rotate", false},
+		{"DELETE /block-countries/{code}", true},
+		{"POST /block-countries", true},
+		{"GET /block-rules", false},
+		{"GET /admin/summary", true},
+		{"GET /countries", false},
+	}
+	for _, tt := range tests {
+		if got := routeMatches(entries, tt.pattern); got != tt.want {
+			t.Errorf("routeMatches(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+
+	if !routeMatches([]string{"*"}, "GET /countries") {
+		t.Error(`"*" should match every route`)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// legacyAPISunset is announced on unversioned /api/ requests, which are
+// deprecated aliases for /api/v1
+const legacyAPISunset = "Thu, 01 Jul 2027 00:00:00 GMT"
+
+// registerRoutes registers every endpoint on the mux
+func registerRoutes(mux *http.ServeMux) {
+	// Versioned API; the unversioned /api/ paths remain as deprecated aliases of v1
+	v1 := NewAPIRouter(mux, "v1").WithLegacyPaths()
+	v1.Use(enableCORS, compressResponses)
+	v1.UseFor(isBlockedRoute, routeBlockingMiddleware)
+
+	// Protected endpoints with country blocking
+	v1.HandleFunc("POST /customers", requireRole(RoleOperator, managementRateLimitMiddleware("customers", handleCustomers)))
+	v1.HandleFunc("GET /customers/{id}/export", requireRole(RoleAdmin, handleExportCustomer))
+	v1.HandleFunc("POST /customers/{id}/erase", requireRole(RoleAdmin, handleEraseCustomer))
+	v1.HandleFunc("GET /secrets", requireRole(RoleAdmin, handleListSecrets))
+	v1.HandleFunc("POST /secrets/rotate", requireRole(RoleAdmin, handleRotateSecrets))
+	v1.HandleFunc("GET /analyze-business-presence", requireRole(RoleOperator, withETag(handleAnalyzeBusinessPresence)))
+	v1.HandleFunc("GET /recommend-blocking", requireRole(RoleOperator, withETag(handleRecommendBlocking)))
+	v1.HandleFunc("GET /analyze-shipping-coverage", requireRole(RoleOperator, withETag(handleShippingCoverage)))
+	v1.HandleFunc("GET /analyze-blocked-demand", requireRole(RoleOperator, withETag(handleBlockedDemand)))
+
+	// Management endpoints (not blocked unless listed in BLOCKED_ROUTES)
+	v1.HandleFunc("POST /block-countries", requireRole(RoleAdmin, managementRateLimitMiddleware("block-countries", handleBlockCountries)))
+	v1.HandleFunc("PUT /block-countries/{code}", requireRole(RoleAdmin, managementRateLimitMiddleware("block-countries", handleBlockCountry)))
+	v1.HandleFunc("DELETE /block-countries/{code}", requireRole(RoleAdmin, managementRateLimitMiddleware("block-countries", handleUnblockCountry)))
+	v1.HandleFunc("GET /block-countries/export", requireRole(RoleViewer, handleExportBlocklist))
+	v1.HandleFunc("POST /block-countries/import", requireRole(RoleAdmin, handleImportPolicy))
+	v1.HandleFunc("GET /block-countries/history", requireRole(RoleViewer, handlePolicyHistory))
+	v1.HandleFunc("GET /block-countries/history/{version}", requireRole(RoleViewer, handlePolicyVersion))
+	v1.HandleFunc("POST /block-countries/history/{version}/rollback", requireRole(RoleAdmin, handleRollbackPolicy))
+	v1.HandleFunc("POST /policy/plan", requireRole(RoleOperator, handlePlanPolicy))
+	v1.HandleFunc("POST /policy/apply", requireRole(RoleAdmin, handleApplyPlan))
+	v1.HandleFunc("GET /storefront-sync", requireRole(RoleViewer, handleStorefrontSyncStatus))
+	v1.HandleFunc("POST /storefront-sync", requireRole(RoleAdmin, handleStorefrontSync))
+	v1.HandleFunc("GET /edge-sync", requireRole(RoleViewer, handleEdgeDiff))
+	v1.HandleFunc("POST /edge-sync/apply", requireRole(RoleAdmin, handleEdgeApply))
+	v1.HandleFunc("POST /edge-sync/rollback", requireRole(RoleAdmin, handleEdgeRollback))
+	v1.HandleFunc("POST /validate-blocking", requireRole(RoleOperator, managementRateLimitMiddleware("validate-blocking", handleValidateBlocking)))
+	v1.HandleFunc("GET /explain-decision", requireRole(RoleOperator, handleExplainDecision))
+	v1.HandleFunc("GET /block-rules", requireRole(RoleViewer, handleListBlockRules))
+	v1.HandleFunc("POST /block-rules", requireRole(RoleAdmin, handleUpsertBlockRule))
+	v1.HandleFunc("DELETE /block-rules", requireRole(RoleAdmin, handleDeleteBlockRule))
+	v1.HandleFunc("DELETE /block-rules/{id}", requireRole(RoleAdmin, handleDeleteBlockRule))
+	v1.HandleFunc("GET /exemptions", requireRole(RoleViewer, handleListExemptions))
+	v1.HandleFunc("POST /exemptions", requireRole(RoleAdmin, handleUpsertExemption))
+	v1.HandleFunc("DELETE /exemptions/{id}", requireRole(RoleAdmin, handleDeleteExemption))
+	v1.HandleFunc("GET /block-countries/presets", requireRole(RoleViewer, handleListPresets))
+	v1.HandleFunc("POST /block-countries/presets", requireRole(RoleAdmin, handleApplyPreset))
+	v1.HandleFunc("POST /block-countries/presets/refresh", requireRole(RoleAdmin, handleRefreshPresets))
+	v1.HandleFunc("POST /reload", requireRole(RoleAdmin, handleReload))
+	v1.HandleFunc("GET /monitor-mode", requireRole(RoleViewer, handleGetMonitorMode))
+	v1.HandleFunc("PUT /monitor-mode", requireRole(RoleAdmin, handleSetMonitorMode))
+	v1.HandleFunc("GET /unknown-country", requireRole(RoleViewer, handleGetUnknownCountry))
+	v1.HandleFunc("PUT /unknown-country", requireRole(RoleAdmin, handleSetUnknownCountry))
+	v1.HandleFunc("GET /audit-log", requireRole(RoleViewer, handleAuditLog))
+	v1.HandleFunc("GET /events", requireRole(RoleViewer, handleEvents))
+	v1.HandleFunc("GET /analytics/traffic", requireRole(RoleViewer, handleTrafficAnalytics))
+	v1.HandleFunc("GET /analytics/honeypot", requireRole(RoleViewer, handleHoneypotAnalytics))
+	v1.HandleFunc("GET /analytics/spikes", requireRole(RoleViewer, handleBlockSpikes))
+	v1.HandleFunc("GET /jobs/{id}", requireRole(RoleOperator, withETag(handleGetJob)))
+
+	// Add new endpoint for testing blocking
+	v1.HandleFunc("GET /test-access", countryBlockingMiddleware(countryRateLimitMiddleware(handleTestAccess)))
+	v1.HandleFunc("POST /test-access", countryBlockingMiddleware(countryRateLimitMiddleware(handleTestAccess)))
+	v1.HandleFunc("POST /challenge", blocker.VerifyChallenge)
+	v1.HandleFunc("POST /checkout/validate", handleCheckoutValidation)
+	v1.HandleFunc("GET /ip-info", requireRole(RoleViewer, handleIPInfo))
+	v1.HandleFunc("POST /simulate-vpn", requireRole(RoleOperator, handleSimulateVPN))
+	v1.HandleFunc("GET /countries", requireRole(RoleViewer, handleCountries))
+	v1.HandleFunc("GET /countries/{code}/customers", requireRole(RoleOperator, withETag(handleCountryCustomers)))
+	v1.HandleFunc("GET /product-restrictions", requireRole(RoleViewer, handleListProductRestrictions))
+	v1.HandleFunc("PUT /product-restrictions/{kind}/{id}", requireRole(RoleAdmin, handleSetProductRestriction))
+	v1.HandleFunc("DELETE /product-restrictions/{kind}/{id}", requireRole(RoleAdmin, handleDeleteProductRestriction))
+	v1.HandleFunc("GET /country-groups", requireRole(RoleViewer, handleListCountryGroups))
+	v1.HandleFunc("PUT /country-groups/{id}", requireRole(RoleAdmin, handleUpsertCountryGroup))
+	v1.HandleFunc("DELETE /country-groups/{id}", requireRole(RoleAdmin, handleDeleteCountryGroup))
+	v1.HandleFunc("GET /geo-provider/status", requireRole(RoleViewer, handleGeoProviderStatus))
+	v1.HandleFunc("GET /geo-provider/info", requireRole(RoleViewer, handleGeoProviderInfo))
+	v1.HandleFunc("GET /geo-conflicts", requireRole(RoleViewer, handleGeoConflicts))
+	v1.HandleFunc("GET /geo-corrections", requireRole(RoleViewer, handleListGeoCorrections))
+	v1.HandleFunc("POST /geo-corrections", requireRole(RoleOperator, handleAddGeoCorrection))
+	v1.HandleFunc("DELETE /geo-corrections/{id}", requireRole(RoleOperator, handleDeleteGeoCorrection))
+	v1.HandleFunc("GET /quarantine", requireRole(RoleAdmin, handleListQuarantine))
+	v1.HandleFunc("GET /quarantine/{id}", requireRole(RoleAdmin, handleGetQuarantined))
+	v1.HandleFunc("POST /quarantine/{id}/replay", requireRole(RoleAdmin, handleReplayQuarantined))
+	v1.HandleFunc("DELETE /quarantine/{id}", requireRole(RoleAdmin, handleDeleteQuarantined))
+	v1.HandleFunc("GET /anomalies", requireRole(RoleViewer, handleGeoAnomalies))
+	v1.HandleFunc("DELETE /anomalies/blocked-keys/{name}", requireRole(RoleAdmin, handleUnblockKey))
+	v1.HandleFunc("GET /self-test", requireRole(RoleOperator, handleSelfTest))
+	v1.HandleFunc("POST /benchmark", requireRole(RoleAdmin, handleBenchmark))
+
+	// CORS preflight for every API path
+	v1.HandleFunc("OPTIONS /", func(w http.ResponseWriter, r *http.Request) {})
+
+	// OpenAPI document of the v1 API, and Swagger UI to browse it
+	mux.HandleFunc("GET /api/openapi.json", enableCORS(handleOpenAPI(v1)))
+	mux.HandleFunc("GET /docs", handleAPIDocs)
+
+	// Admin dashboard, for browsers
+	registerAdminRoutes(mux)
+
+	// Decoy routes from HONEYPOT_PATHS, answered as blocked
+	registerHoneypots(mux)
+
+	// Shopify compliance and order webhooks, authenticated by their HMAC signature
+	mux.HandleFunc("POST /webhooks/shopify", handleShopifyWebhook)
+
+	// Kubernetes liveness and readiness probes (unauthenticated)
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	mux.HandleFunc("GET /readyz", handleReadyz)
+
+	// Everything else goes to GATEWAY_UPSTREAM, if set
+	registerGateway(mux)
+}
+
+// Middleware wraps a handler, e.g. enableCORS
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// APIRouter registers handlers under a versioned prefix such as /api/v1.
+// A breaking change to a response shape ships as a handler on a newer
+// version's router while older versions keep their handlers.
+type APIRouter struct {
+	mux        *http.ServeMux
+	version    string
+	middleware []routeMiddleware
+
+	// legacy also serves every route at its unversioned /api/ path
+	legacy bool
+
+	// routes are the registered patterns, relative to the version prefix
+	routes []string
+}
+
+// routeMiddleware is middleware for the routes whose pattern matches, or
+// for every route when match is nil
+type routeMiddleware struct {
+	match      func(pattern string) bool
+	middleware Middleware
+}
+
+// NewAPIRouter creates a router for one API version on the given mux
+func NewAPIRouter(mux *http.ServeMux, version string) *APIRouter {
+	return &APIRouter{mux: mux, version: version}
+}
+
+// WithLegacyPaths makes the router also answer on the unversioned /api/ paths,
+// marking those responses as deprecated in favour of the versioned path
+func (a *APIRouter) WithLegacyPaths() *APIRouter {
+	a.legacy = true
+	return a
+}
+
+// Use adds middleware to every route registered afterwards. The first
+// middleware added is the outermost.
+func (a *APIRouter) Use(middleware ...Middleware) {
+	for _, m := range middleware {
+		a.middleware = append(a.middleware, routeMiddleware{middleware: m})
+	}
+}
+
+// UseFor is like Use but only wraps routes whose pattern, e.g.
+// "POST /customers", satisfies match
+func (a *APIRouter) UseFor(match func(pattern string) bool, middleware ...Middleware) {
+	for _, m := range middleware {
+		a.middleware = append(a.middleware, routeMiddleware{match: match, middleware: m})
+	}
+}
+
+// Path returns the versioned path for a route, e.g. "/customers" -> "/api/v1/customers"
+func (a *APIRouter) Path(route string) string {
+	return "/api/" + a.version + route
+}
+
+// HandleFunc registers a handler for a route in this version. The pattern
+// uses net/http syntax relative to the version prefix, with an optional
+// method and path parameters, e.g. "DELETE /block-rules/{id}".
+func (a *APIRouter) HandleFunc(pattern string, handler http.HandlerFunc) {
+	method, route, found := strings.Cut(pattern, " ")
+	if !found {
+		method, route = "", pattern
+	} else {
+		method += " "
+	}
+
+	a.routes = append(a.routes, pattern)
+
+	for i := len(a.middleware) - 1; i >= 0; i-- {
+		if m := a.middleware[i]; m.match == nil || m.match(pattern) {
+			handler = m.middleware(handler)
+		}
+	}
+
+	a.mux.HandleFunc(method+a.Path(route), handler)
+	if a.legacy {
+		a.mux.HandleFunc(method+"/api"+route, deprecatedAlias(a.Path(route), handler))
+	}
+}
+
+// Routes returns the patterns registered on the router, in order
+func (a *APIRouter) Routes() []string {
+	return a.routes
+}
+
+// deprecatedAlias serves a handler on an old path, pointing clients at its successor
+func deprecatedAlias(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Sunset", legacyAPISunset)
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
+
+// statusCapture records the status a handler writes and discards the body
+type statusCapture struct {
+	header http.Header
+	status int
+}
+
+func (c *statusCapture) Header() http.Header         { return c.header }
+func (c *statusCapture) Write(b []byte) (int, error) { return len(b), nil }
+func (c *statusCapture) WriteHeader(status int)      { c.status = status }
+
+// jsonRouteErrors serves the mux, answering requests that match no route
+// (404) or no method of a route (405) with the JSON error envelope instead
+// of the mux's plain-text responses
+func jsonRouteErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		capture := &statusCapture{header: http.Header{}, status: http.StatusOK}
+		handler.ServeHTTP(capture, r)
+		switch capture.status {
+		case http.StatusNotFound:
+			writeError(w, r, fmt.Sprintf("No route for %s %s", r.Method, r.URL.Path), http.StatusNotFound)
+		case http.StatusMethodNotAllowed:
+			w.Header().Set("Allow", capture.header.Get("Allow"))
+			writeError(w, r, fmt.Sprintf("Method %s not allowed for %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+		default:
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
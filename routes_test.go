@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIRouter(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Route", r.Method+" "+r.PathValue("code"))
+		w.WriteHeader(http.StatusNoContent)
+	}
+	tagged := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "yes")
+			next(w, r)
+		}
+	}
+
+	v1 := NewAPIRouter(mux, "v1").WithLegacyPaths()
+	v1.Use(tagged)
+	v1.HandleFunc("GET /countries", handler)
+	v1.HandleFunc("DELETE /block-countries/{code}", handler)
+	NewAPIRouter(mux, "v2").HandleFunc("GET /countries", handler)
+	router := jsonRouteErrors(mux)
+
+	tests := []struct {
+		method     string
+		path       string
+		status     int
+		route      string
+		deprecated bool
+		middleware bool
+	}{
+		{"GET", "/api/v1/countries", http.StatusNoContent, "GET ", false, true},
+		{"HEAD", "/api/v1/countries", http.StatusNoContent, "HEAD ", false, true},
+		{"GET", "/api/v2/countries", http.StatusNoContent, "GET ", false, false},
+		{"GET", "/api/countries", http.StatusNoContent, "GET ", true, true},
+		{"DELETE", "/api/v1/block-countries/IR", http.StatusNoContent, "DELETE IR", false, true},
+		{"POST", "/api/v1/countries", http.StatusMethodNotAllowed, "", false, false},
+		{"GET", "/api/v3/countries", http.StatusNotFound, "", false, false},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+		if recorder.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, recorder.Code, tt.status)
+			continue
+		}
+		if got := recorder.Header().Get("X-Route"); got != tt.route {
+			t.Errorf("%s %s: route = %q, want %q", tt.method, tt.path, got, tt.route)
+		}
+		if got := recorder.Header().Get("X-Middleware") == "yes"; got != tt.middleware {
+			t.Errorf("%s %s: middleware applied = %v, want %v", tt.method, tt.path, got, tt.middleware)
+		}
+		if got := recorder.Header().Get("Deprecation") == "true"; got != tt.deprecated {
+			t.Errorf("%s %s: deprecated = %v, want %v", tt.method, tt.path, got, tt.deprecated)
+		}
+		if tt.deprecated && recorder.Header().Get("Link") != `</api/v1/countries>; rel="successor-version"` {
+			t.Errorf("%s %s: Link = %q", tt.method, tt.path, recorder.Header().Get("Link"))
+		}
+		if tt.status >= 400 {
+			var body ErrorResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil || body.Error.Code == "" {
+				t.Errorf("%s %s: response is not a JSON error envelope", tt.method, tt.path)
+			}
+		}
+		if tt.status == http.StatusMethodNotAllowed && recorder.Header().Get("Allow") == "" {
+			t.Errorf("%s %s: missing Allow header", tt.method, tt.path)
+		}
+	}
+}
+
+func TestAPIRouterUseFor(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	scoped := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Scoped", "yes")
+			next(w, r)
+		}
+	}
+
+	v1 := NewAPIRouter(mux, "v1")
+	v1.UseFor(func(pattern string) bool { return pattern == "POST /customers" }, scoped)
+	v1.HandleFunc("POST /customers", handler)
+	v1.HandleFunc("GET /countries", handler)
+
+	for path, want := range map[string]bool{"/api/v1/customers": true, "/api/v1/countries": false} {
+		method := "GET"
+		if want {
+			method = "POST"
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		if got := recorder.Header().Get("X-Scoped") == "yes"; got != want {
+			t.Errorf("%s %s: middleware applied = %v, want %v", method, path, got, want)
+		}
+	}
+}
+
+func TestRegisterRoutes(t *testing.T) {
+	// ServeMux panics on conflicting patterns
+	registerRoutes(http.NewServeMux())
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// ruleExpiryInterval is how often lapsed time-limited rules are removed
+const ruleExpiryInterval = 30 * time.Second
+
+// BlockRuleRequest creates or replaces a rule. Duration is a shortcut for
+// a temporary block that sets EffectiveUntil relative to now, e.g. "2h".
+type BlockRuleRequest struct {
+	geoblock.Rule
+	Duration string `json:"duration,omitempty"`
+}
+
+type BlockRuleStatus struct {
+	geoblock.Rule
+	Active bool `json:"active"`
+}
+
+type BlockRulesResponse struct {
+	Rules []BlockRuleStatus `json:"rules"`
+	Total int               `json:"total"`
+}
+
+// handleListBlockRules lists every rule and whether it is active right now
+func handleListBlockRules(w http.ResponseWriter, r *http.Request) {
+	policy := blocklist.Policy()
+	now := time.Now()
+
+	rules := make([]BlockRuleStatus, 0, len(policy.Rules))
+	for _, rule := range policy.Rules {
+		active := false
+		countries, _ := policy.RuleCountries(&rule)
+		for _, code := range countries {
+			if match := blocklist.MatchAt(code, now); match != nil && match.RuleID() == rule.ID {
+				active = true
+				break
+			}
+		}
+		for _, cidr := range rule.Networks {
+			if active {
+				break
+			}
+			// Check the network's first address, as rules are matched in order
+			ip, _, _ := net.ParseCIDR(cidr)
+			if match := blocklist.MatchIPAt(ip.String(), now); match != nil && match.RuleID() == rule.ID {
+				active = true
+			}
+		}
+		rules = append(rules, BlockRuleStatus{Rule: rule, Active: active})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BlockRulesResponse{Rules: rules, Total: len(rules)})
+}
+
+// handleUpsertBlockRule creates a rule or replaces the rule with the same ID
+func handleUpsertBlockRule(w http.ResponseWriter, r *http.Request) {
+	var req BlockRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	rule := req.Rule
+	if rule.ID == "" {
+		rule.ID = fmt.Sprintf("rule-%d", time.Now().UnixNano())
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			writeError(w, r, fmt.Sprintf("Invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+		until := time.Now().Add(duration).UTC()
+		rule.EffectiveUntil = &until
+	}
+
+	previous, err := updatePolicy(r, "upsert-block-rule", func(policy *geoblock.Policy) error {
+		replaced := false
+		for i := range policy.Rules {
+			if policy.Rules[i].ID == rule.ID {
+				policy.Rules[i] = rule
+				replaced = true
+			}
+		}
+		if !replaced {
+			policy.Rules = append(policy.Rules, rule)
+		}
+		if err := normalizePolicy(policy); err != nil {
+			return fmt.Errorf("%w: %v", geoblock.ErrInvalidPolicy, err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	details := map[string]interface{}{
+		"rule":   rule.ID,
+		"before": previous,
+		"after":  blocklist.Countries(),
+	}
+	if rule.UnknownCountry != "" {
+		details["unknown_country"] = rule.UnknownCountry
+	}
+	recordAudit(r, "upsert-block-rule", details)
+	fmt.Printf("📝 Saved blocking rule %s for %v %v %v\n", rule.ID, rule.Countries, rule.Groups, rule.Networks)
+
+	handleListBlockRules(w, r)
+}
+
+// handleDeleteBlockRule removes the rule given by the {id} path parameter,
+// or by the ?id= query parameter on the collection path
+func handleDeleteBlockRule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		id = r.URL.Query().Get("id")
+	}
+
+	previous, err := updatePolicy(r, "delete-block-rule", func(policy *geoblock.Policy) error {
+		kept := policy.Rules[:0]
+		for _, rule := range policy.Rules {
+			if rule.ID != id {
+				kept = append(kept, rule)
+			}
+		}
+		if len(kept) == len(policy.Rules) {
+			return geoblock.ErrNoPolicyChange
+		}
+		policy.Rules = kept
+		return nil
+	})
+	if errors.Is(err, geoblock.ErrNoPolicyChange) {
+		writeError(w, r, fmt.Sprintf("Rule %q not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	recordAudit(r, "delete-block-rule", map[string]interface{}{
+		"rule":   id,
+		"before": previous,
+		"after":  blocklist.Countries(),
+	})
+	fmt.Printf("🗑️  Deleted blocking rule %s\n", id)
+
+	handleListBlockRules(w, r)
+}
+
+// expireRules removes rules whose effective period has ended
+func expireRules(now time.Time) {
+	var expired []string
+	previous, err := updatePolicy(nil, "expire-block-rules", func(policy *geoblock.Policy) error {
+		kept := policy.Rules[:0]
+		for _, rule := range policy.Rules {
+			if rule.ExpiredAt(now) {
+				expired = append(expired, rule.ID)
+				continue
+			}
+			kept = append(kept, rule)
+		}
+		if len(expired) == 0 {
+			return geoblock.ErrNoPolicyChange
+		}
+		policy.Rules = kept
+		return nil
+	})
+	if errors.Is(err, geoblock.ErrNoPolicyChange) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to remove expired rules %v: %v\n", expired, err)
+		return
+	}
+
+	recordSystemAudit("expire-block-rules", map[string]interface{}{
+		"rules":  expired,
+		"before": previous,
+		"after":  blocklist.Countries(),
+	})
+	fmt.Printf("⏰ Removed expired blocking rules: %v\n", expired)
+}
+
+// startRuleExpirer periodically removes lapsed time-limited rules
+func startRuleExpirer() {
+	go func() {
+		ticker := time.NewTicker(ruleExpiryInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			expireRules(now)
+		}
+	}()
+}
@@ -16,7 +16,7 @@ echo "✅ Go is installed"
 echo "🏃 Running the Shopify customer fetcher..."
 echo
 
-go run shopify_customers.go
+go run .
 
 echo
 echo "✅ Program completed!"
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// shopifyTokenSecret names the stored Shopify token sent with POST /customers
+const shopifyTokenSecret = "shopify_access_token"
+
+var (
+	errNoMasterKey      = errors.New("no master key: set SECRETS_MASTER_KEY or SECRETS_KMS_KEY_ID")
+	errUnknownMasterKey = errors.New("secret is wrapped with an unknown master key")
+)
+
+// KeyWrapper encrypts the data keys of stored secrets with a master key
+type KeyWrapper interface {
+	ID() string
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// EncryptedSecret is a secret sealed with its own AES-256-GCM data key, which
+// is stored wrapped by the master key KeyID. Only metadata is serialized.
+type EncryptedSecret struct {
+	Name       string    `json:"name"`
+	KeyID      string    `json:"key_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	WrappedKey []byte    `json:"-"`
+	Ciphertext []byte    `json:"-"`
+}
+
+// SecretKeyring seals secrets with its active master key and opens secrets
+// wrapped by any of its keys, so old keys stay readable during rotation
+type SecretKeyring struct {
+	active KeyWrapper
+	keys   map[string]KeyWrapper
+}
+
+// NewSecretKeyring creates a keyring sealing with active and also opening
+// secrets wrapped by previous
+func NewSecretKeyring(active KeyWrapper, previous ...KeyWrapper) *SecretKeyring {
+	keyring := &SecretKeyring{active: active, keys: map[string]KeyWrapper{active.ID(): active}}
+	for _, key := range previous {
+		if _, ok := keyring.keys[key.ID()]; !ok {
+			keyring.keys[key.ID()] = key
+		}
+	}
+	return keyring
+}
+
+// sealGCM encrypts plaintext with key, prefixing the random nonce
+func sealGCM(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// openGCM decrypts what sealGCM returned
+func openGCM(key, sealed, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts a secret under a fresh data key. The name is authenticated,
+// so a ciphertext cannot be passed off as another secret.
+func (k *SecretKeyring) Seal(ctx context.Context, name, value string) (EncryptedSecret, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return EncryptedSecret{}, err
+	}
+	ciphertext, err := sealGCM(dataKey, []byte(value), []byte(name))
+	if err != nil {
+		return EncryptedSecret{}, err
+	}
+	wrapped, err := k.active.Wrap(ctx, dataKey)
+	if err != nil {
+		return EncryptedSecret{}, fmt.Errorf("failed to wrap data key with %s: %w", k.active.ID(), err)
+	}
+	return EncryptedSecret{Name: name, KeyID: k.active.ID(), UpdatedAt: time.Now().UTC(), WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts a sealed secret
+func (k *SecretKeyring) Open(ctx context.Context, secret EncryptedSecret) (string, error) {
+	dataKey, err := k.unwrap(ctx, secret)
+	if err != nil {
+		return "", err
+	}
+	value, err := openGCM(dataKey, secret.Ciphertext, []byte(secret.Name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %w", secret.Name, err)
+	}
+	return string(value), nil
+}
+
+func (k *SecretKeyring) unwrap(ctx context.Context, secret EncryptedSecret) ([]byte, error) {
+	key, ok := k.keys[secret.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", errUnknownMasterKey, secret.KeyID)
+	}
+	dataKey, err := key.Unwrap(ctx, secret.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key of %s with %s: %w", secret.Name, secret.KeyID, err)
+	}
+	return dataKey, nil
+}
+
+// Rewrap wraps a secret's data key with the active master key, reporting
+// whether it changed. The ciphertext is kept, since the data key is.
+func (k *SecretKeyring) Rewrap(ctx context.Context, secret EncryptedSecret) (EncryptedSecret, bool, error) {
+	if secret.KeyID == k.active.ID() {
+		return secret, false, nil
+	}
+	dataKey, err := k.unwrap(ctx, secret)
+	if err != nil {
+		return secret, false, err
+	}
+	wrapped, err := k.active.Wrap(ctx, dataKey)
+	if err != nil {
+		return secret, false, fmt.Errorf("failed to wrap data key with %s: %w", k.active.ID(), err)
+	}
+	secret.KeyID, secret.WrappedKey, secret.UpdatedAt = k.active.ID(), wrapped, time.Now().UTC()
+	return secret, true, nil
+}
+
+// LocalKeyWrapper wraps data keys with an AES-256 master key held in memory
+type LocalKeyWrapper struct {
+	id  string
+	key []byte
+}
+
+// NewLocalKeyWrapper creates a wrapper for a 32-byte master key. Its ID is
+// derived from the key, so the key itself is never stored.
+func NewLocalKeyWrapper(key []byte) (*LocalKeyWrapper, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	sum := sha256.Sum256(key)
+	return &LocalKeyWrapper{id: "local:" + hex.EncodeToString(sum[:4]), key: key}, nil
+}
+
+func (w *LocalKeyWrapper) ID() string { return w.id }
+
+func (w *LocalKeyWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return sealGCM(w.key, dataKey, []byte(w.id))
+}
+
+func (w *LocalKeyWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return openGCM(w.key, wrapped, []byte(w.id))
+}
+
+// AWSKMSKeyWrapper wraps data keys with an AWS KMS key, which never leaves KMS
+type AWSKMSKeyWrapper struct {
+	keyID    string
+	endpoint string
+	region   string
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	client          *http.Client
+}
+
+// newAWSKMSKeyWrapper uses the KMS key keyID with the standard AWS_*
+// credentials; AWS_KMS_ENDPOINT overrides the regional endpoint
+func newAWSKMSKeyWrapper(keyID string) (*AWSKMSKeyWrapper, error) {
+	region := getEnv("AWS_REGION", "us-east-1")
+	wrapper := &AWSKMSKeyWrapper{
+		keyID:           keyID,
+		endpoint:        getEnv("AWS_KMS_ENDPOINT", fmt.Sprintf("https://kms.%s.amazonaws.com", region)),
+		region:          region,
+		accessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		secretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		sessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		client:          newHTTPClient(10 * time.Second),
+	}
+	if wrapper.accessKeyID == "" || wrapper.secretAccessKey == "" {
+		return nil, fmt.Errorf("SECRETS_KMS_KEY_ID needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return wrapper, nil
+}
+
+func (w *AWSKMSKeyWrapper) ID() string { return "aws-kms:" + w.keyID }
+
+// kmsEncryptionContext is bound to every data key, so KMS refuses to
+// decrypt them for other purposes
+var kmsEncryptionContext = map[string]string{"purpose": "geoblock-secret"}
+
+func (w *AWSKMSKeyWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var output struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}
+	input := map[string]interface{}{"KeyId": w.keyID, "Plaintext": dataKey, "EncryptionContext": kmsEncryptionContext}
+	if err := w.call(ctx, "Encrypt", input, &output); err != nil {
+		return nil, err
+	}
+	return output.CiphertextBlob, nil
+}
+
+func (w *AWSKMSKeyWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var output struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	input := map[string]interface{}{"KeyId": w.keyID, "CiphertextBlob": wrapped, "EncryptionContext": kmsEncryptionContext}
+	if err := w.call(ctx, "Decrypt", input, &output); err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
+
+// call invokes a KMS API action. Error bodies are not returned, as a failed
+// call should never echo key material.
+func (w *AWSKMSKeyWrapper) call(ctx context.Context, action string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	signAWSRequest(req, body, time.Now().UTC(), w.region, "kms", w.accessKeyID, w.secretAccessKey, w.sessionToken)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms %s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kms %s returned status %d", action, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+// secretKeyring encrypts secrets before they are stored; nil when no master
+// key is configured, in which case secrets are never persisted
+var secretKeyring = loadSecretKeyring()
+
+// loadSecretKeyring reads SECRETS_KMS_KEY_ID or SECRETS_MASTER_KEY (base64,
+// 32 bytes) as the active key; SECRETS_PREVIOUS_MASTER_KEYS lists retired
+// local keys that are still needed to open and rotate older secrets. With
+// KMS active, SECRETS_MASTER_KEY is kept for opening only.
+func loadSecretKeyring() *SecretKeyring {
+	var keys []KeyWrapper
+	if keyID := getEnv("SECRETS_KMS_KEY_ID", ""); keyID != "" {
+		wrapper, err := newAWSKMSKeyWrapper(keyID)
+		if err != nil {
+			fmt.Printf("⚠️  Secrets will not be stored: %v\n", err)
+			return nil
+		}
+		keys = append(keys, wrapper)
+	}
+	encoded := append(getEnvList("SECRETS_MASTER_KEY", ""), getEnvList("SECRETS_PREVIOUS_MASTER_KEYS", "")...)
+	for i, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err == nil {
+			var wrapper *LocalKeyWrapper
+			if wrapper, err = NewLocalKeyWrapper(key); err == nil {
+				keys = append(keys, wrapper)
+				continue
+			}
+		}
+		// Never print the value, only which entry is wrong
+		fmt.Printf("⚠️  Ignoring master key %d: %v\n", i+1, err)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return NewSecretKeyring(keys[0], keys[1:]...)
+}
+
+// storeSecret seals a secret and saves it to the database. Without a
+// database it is not persisted; without a master key it is refused rather
+// than stored in plain text.
+func storeSecret(ctx context.Context, name, value string) error {
+	if postgresStore == nil {
+		return nil
+	}
+	if secretKeyring == nil {
+		return errNoMasterKey
+	}
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	secret, err := secretKeyring.Seal(ctx, name, value)
+	if err != nil {
+		return err
+	}
+	return postgresStore.SaveSecret(ctx, secret)
+}
+
+// loadSecret reads and opens a stored secret, returning "" if there is none
+func loadSecret(ctx context.Context, name string) (string, error) {
+	if postgresStore == nil || secretKeyring == nil {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, postgresTimeout)
+	defer cancel()
+	secret, err := postgresStore.LoadSecret(ctx, name)
+	if err != nil || secret == nil {
+		return "", err
+	}
+	return secretKeyring.Open(ctx, *secret)
+}
+
+// restoreStoredSecrets brings back the Shopify token last sent with
+// POST /customers, so the analysis endpoints work after a restart
+func restoreStoredSecrets() {
+	token, err := loadSecret(context.Background(), shopifyTokenSecret)
+	if err != nil {
+		fmt.Printf("⚠️  Could not restore the stored Shopify token: %v\n", err)
+		return
+	}
+	if token != "" && currentShopifyConfig.APIKey == "" {
+		logRedactor.AddSecret(token)
+		currentShopifyConfig.APIKey = token
+		fmt.Println("🔐 Restored the stored Shopify token")
+	}
+}
+
+// rotateSecrets rewraps every stored secret not yet under the active master
+// key, returning how many were rewrapped
+func rotateSecrets(ctx context.Context) (int, error) {
+	secrets, err := postgresStore.ListSecrets(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rotated := 0
+	for _, secret := range secrets {
+		rewrapped, changed, err := secretKeyring.Rewrap(ctx, secret)
+		if err != nil {
+			return rotated, err
+		}
+		if !changed {
+			continue
+		}
+		// Only replace the key if the secret was not rewritten meanwhile
+		saved, err := postgresStore.RewrapSecret(ctx, secret, rewrapped)
+		if err != nil {
+			return rotated, err
+		}
+		if saved {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+type SecretsResponse struct {
+	Enabled   bool              `json:"enabled"`
+	ActiveKey string            `json:"active_key,omitempty"`
+	Secrets   []EncryptedSecret `json:"secrets"`
+}
+
+type SecretRotationResponse struct {
+	ActiveKey string `json:"active_key"`
+	Rotated   int    `json:"rotated"`
+}
+
+// secretsAvailable writes an error unless secrets can be stored
+func secretsAvailable(w http.ResponseWriter, r *http.Request) bool {
+	switch {
+	case postgresStore == nil:
+		writeError(w, r, "Secrets are only stored with STORAGE_BACKEND=postgres", http.StatusServiceUnavailable)
+		return false
+	case secretKeyring == nil:
+		writeError(w, r, errNoMasterKey.Error(), http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// handleListSecrets lists the stored secrets and their master keys, never
+// their values
+func handleListSecrets(w http.ResponseWriter, r *http.Request) {
+	response := SecretsResponse{Enabled: postgresStore != nil && secretKeyring != nil, Secrets: []EncryptedSecret{}}
+	if secretKeyring != nil {
+		response.ActiveKey = secretKeyring.active.ID()
+	}
+	if postgresStore != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), postgresTimeout)
+		defer cancel()
+		secrets, err := postgresStore.ListSecrets(ctx)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("Failed to list secrets: %v", err), http.StatusInternalServerError)
+			return
+		}
+		response.Secrets = append(response.Secrets, secrets...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleRotateSecrets rewraps stored secrets with the active master key.
+// Retired keys can be removed from SECRETS_PREVIOUS_MASTER_KEYS afterwards.
+func handleRotateSecrets(w http.ResponseWriter, r *http.Request) {
+	if !secretsAvailable(w, r) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	rotated, err := rotateSecrets(ctx)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("Secret rotation stopped after %d secrets: %v", rotated, err), http.StatusInternalServerError)
+		return
+	}
+	response := SecretRotationResponse{ActiveKey: secretKeyring.active.ID(), Rotated: rotated}
+	recordAudit(r, "rotate-secrets", response)
+	fmt.Printf("🔐 Rewrapped %d secrets with %s\n", rotated, response.ActiveKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
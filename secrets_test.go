@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestKeyWrapper(t *testing.T, fill byte) *LocalKeyWrapper {
+	t.Helper()
+	wrapper, err := NewLocalKeyWrapper(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wrapper
+}
+
+func TestSecretKeyring(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := newTestKeyWrapper(t, 1), newTestKeyWrapper(t, 2)
+
+	sealed, err := NewSecretKeyring(oldKey).Seal(ctx, shopifyTokenSecret, "shpat_example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed.Ciphertext, []byte("shpat_example")) || sealed.KeyID != oldKey.ID() {
+		t.Fatalf("sealed = %+v, want ciphertext under %s", sealed, oldKey.ID())
+	}
+	renamed := sealed
+	renamed.Name = "other"
+
+	rotating := NewSecretKeyring(newKey, oldKey)
+	rewrapped, changed, err := rotating.Rewrap(ctx, sealed)
+	if err != nil || !changed || rewrapped.KeyID != newKey.ID() {
+		t.Fatalf("Rewrap = %+v, %v, %v; want wrapped by %s", rewrapped, changed, err, newKey.ID())
+	}
+	if _, changed, _ := rotating.Rewrap(ctx, rewrapped); changed {
+		t.Error("Rewrap changed a secret already under the active key")
+	}
+
+	tests := []struct {
+		name    string
+		keyring *SecretKeyring
+		secret  EncryptedSecret
+		want    string
+		wantErr string
+	}{
+		{"same key", NewSecretKeyring(oldKey), sealed, "shpat_example", ""},
+		{"previous key", rotating, sealed, "shpat_example", ""},
+		{"rewrapped", NewSecretKeyring(newKey), rewrapped, "shpat_example", ""},
+		{"retired key", NewSecretKeyring(newKey), sealed, "", "unknown master key"},
+		{"other name", rotating, renamed, "", "failed to decrypt secret other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keyring.Open(ctx, tt.secret)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Open error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Open = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLocalKeyWrapperRejectsShortKeys(t *testing.T) {
+	if _, err := NewLocalKeyWrapper([]byte("too short")); err == nil {
+		t.Error("NewLocalKeyWrapper accepted a 9-byte key")
+	}
+}
+
+func TestAWSKMSKeyWrapper(t *testing.T) {
+	// The fake KMS "encrypts" by prefixing, which is enough to check the calls
+	var denied atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if denied.Load() || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var input struct {
+			KeyId             string
+			Plaintext         []byte
+			CiphertextBlob    []byte
+			EncryptionContext map[string]string
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		if input.KeyId != "alias/geoblock" || input.EncryptionContext["purpose"] != "geoblock-secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"CiphertextBlob": append([]byte("kms:"), input.Plaintext...)})
+		case "TrentService.Decrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": bytes.TrimPrefix(input.CiphertextBlob, []byte("kms:"))})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	kms := &AWSKMSKeyWrapper{
+		keyID: "alias/geoblock", endpoint: server.URL, region: "us-east-1",
+		accessKeyID: "AKIDEXAMPLE", secretAccessKey: "example", client: server.Client(),
+	}
+	keyring := NewSecretKeyring(kms)
+	sealed, err := keyring.Seal(context.Background(), "ipinfo_token", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.KeyID != "aws-kms:alias/geoblock" || !bytes.HasPrefix(sealed.WrappedKey, []byte("kms:")) {
+		t.Fatalf("sealed = %+v, want a data key wrapped by KMS", sealed)
+	}
+	if got, err := keyring.Open(context.Background(), sealed); err != nil || got != "token" {
+		t.Errorf("Open = %q, %v; want token", got, err)
+	}
+
+	denied.Store(true)
+	if _, err := keyring.Open(context.Background(), sealed); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Open error = %v, want the KMS status", err)
+	}
+}
+
+func TestStoreSecretWithoutDatabase(t *testing.T) {
+	if err := storeSecret(context.Background(), shopifyTokenSecret, "token"); err != nil {
+		t.Errorf("storeSecret without a database = %v, want nil", err)
+	}
+	if value, err := loadSecret(context.Background(), shopifyTokenSecret); value != "" || err != nil {
+		t.Errorf("loadSecret without a database = %q, %v", value, err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// untaggedSegment groups customers without any tags
+const untaggedSegment = "untagged"
+
+// CustomerSegment shows where the customers with one tag live
+type CustomerSegment struct {
+	Tag           string           `json:"tag"`
+	CustomerCount int              `json:"customer_count"`
+	Countries     []SegmentCountry `json:"countries"`
+}
+
+// SegmentCountry counts a segment's customers with an address in one country
+type SegmentCountry struct {
+	CountryCode   string `json:"country_code"`
+	CustomerCount int    `json:"customer_count"`
+}
+
+// parseCustomerTags splits Shopify's comma-separated tags into lowercase,
+// de-duplicated segment names, e.g. "VIP, wholesale" -> [vip wholesale]
+func parseCustomerTags(tags string) []string {
+	var parsed []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(parsed, tag) {
+			parsed = append(parsed, tag)
+		}
+	}
+	return parsed
+}
+
+// groupCountriesBySegment counts, for each customer tag, how many tagged
+// customers have an address in each country. Customers without tags form the
+// "untagged" segment. Segments and their countries are ordered by customer
+// count, largest first.
+func groupCountriesBySegment(customerCountries []CustomerCountry) []CustomerSegment {
+	customers := make(map[string]int)
+	countries := make(map[string]map[string]int)
+
+	for _, cc := range customerCountries {
+		tags := cc.Tags
+		if len(tags) == 0 {
+			tags = []string{untaggedSegment}
+		}
+		for _, tag := range tags {
+			if countries[tag] == nil {
+				countries[tag] = make(map[string]int)
+			}
+			customers[tag]++
+			for _, code := range cc.CountryCodes {
+				countries[tag][code]++
+			}
+		}
+	}
+
+	segments := make([]CustomerSegment, 0, len(customers))
+	for tag, count := range customers {
+		segment := CustomerSegment{Tag: tag, CustomerCount: count, Countries: []SegmentCountry{}}
+		for code, n := range countries[tag] {
+			segment.Countries = append(segment.Countries, SegmentCountry{CountryCode: code, CustomerCount: n})
+		}
+		sort.Slice(segment.Countries, func(i, j int) bool {
+			a, b := segment.Countries[i], segment.Countries[j]
+			if a.CustomerCount != b.CustomerCount {
+				return a.CustomerCount > b.CustomerCount
+			}
+			return a.CountryCode < b.CountryCode
+		})
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].CustomerCount != segments[j].CustomerCount {
+			return segments[i].CustomerCount > segments[j].CustomerCount
+		}
+		return segments[i].Tag < segments[j].Tag
+	})
+	return segments
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCustomerTags(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"VIP", []string{"vip"}},
+		{" VIP, wholesale ,vip,, ", []string{"vip", "wholesale"}},
+	}
+
+	for _, tt := range tests {
+		if got := parseCustomerTags(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCustomerTags(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGroupCountriesBySegment(t *testing.T) {
+	customers := []CustomerCountry{
+		{CustomerID: 1, CountryCodes: []string{"US", "CA"}, Tags: []string{"vip", "wholesale"}},
+		{CustomerID: 2, CountryCodes: []string{"US"}, Tags: []string{"wholesale"}},
+		{CustomerID: 3, CountryCodes: []string{"DE"}},
+		{CustomerID: 4, Tags: []string{"vip"}},
+	}
+
+	want := []CustomerSegment{
+		{Tag: "vip", CustomerCount: 2, Countries: []SegmentCountry{{"CA", 1}, {"US", 1}}},
+		{Tag: "wholesale", CustomerCount: 2, Countries: []SegmentCountry{{"US", 2}, {"CA", 1}}},
+		{Tag: "untagged", CustomerCount: 1, Countries: []SegmentCountry{{"DE", 1}}},
+	}
+	if got := groupCountriesBySegment(customers); !reflect.DeepEqual(got, want) {
+		t.Errorf("groupCountriesBySegment = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// selfTestIP and selfTestCountry are the known address the self-test
+// resolves and the country it must resolve to
+var (
+	selfTestIP      = getEnv("SELF_TEST_IP", "8.8.8.8")
+	selfTestCountry = strings.ToUpper(getEnv("SELF_TEST_COUNTRY", "US"))
+)
+
+// SelfTestCheck is the result of testing one component
+type SelfTestCheck struct {
+	Component string `json:"component"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+type SelfTestResponse struct {
+	Passed     bool            `json:"passed"`
+	Checks     []SelfTestCheck `json:"checks"`
+	CheckedAt  string          `json:"checked_at"`
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// selfTestComponent is a named self-test step. It returns a detail
+// describing what passed, or an error; errCheckSkipped skips it.
+type selfTestComponent struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+var selfTestComponents = []selfTestComponent{
+	{name: "geo_resolution", run: selfTestGeoResolution},
+	{name: "rule_evaluation", run: selfTestRuleEvaluation},
+	{name: "live_policy", run: selfTestLivePolicy},
+	{name: "shopify", run: selfTestShopify},
+}
+
+// selfTestGeoResolution resolves the known IP through the provider chain
+func selfTestGeoResolution(ctx context.Context) (string, error) {
+	if len(geoResolver.Providers()) == 0 {
+		return "", fmt.Errorf("no geolocation providers configured")
+	}
+	country, err := geoResolver.Lookup(ctx, selfTestIP)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", selfTestIP, err)
+	}
+	if country != selfTestCountry {
+		return "", fmt.Errorf("%s resolved to %q, want %s", selfTestIP, country, selfTestCountry)
+	}
+	return fmt.Sprintf("%s resolved to %s", selfTestIP, country), nil
+}
+
+// selfTestCase is a synthetic request of the sample rule set and the
+// decision it must get
+type selfTestCase struct {
+	country string
+	want    string
+}
+
+// selfTestPolicy is the sample rule set: one blocked country and one
+// challenged by a rule
+var selfTestPolicy = geoblock.Policy{
+	BlockedCountries: []string{"KP"},
+	Rules:            []geoblock.Rule{{ID: "self-test-challenge", Countries: []string{"RU"}, Challenge: true}},
+}
+
+var selfTestCases = []selfTestCase{
+	{country: "KP", want: "block"},
+	{country: "RU", want: "challenge"},
+	{country: "US", want: "allow"},
+}
+
+// selfTestDecision names the outcome of a validation request
+func selfTestDecision(result TestResult) string {
+	switch {
+	case result.Challenged:
+		return "challenge"
+	case result.Monitored:
+		return "monitor"
+	case result.Blocked:
+		return "block"
+	}
+	return "allow"
+}
+
+// selfTestRuleEvaluation sends synthetic requests through the blocking
+// middleware with the sample rule set, leaving the live policy alone
+func selfTestRuleEvaluation(ctx context.Context) (string, error) {
+	policy := selfTestPolicy
+	policy.Rules = append([]geoblock.Rule(nil), selfTestPolicy.Rules...)
+	if err := normalizePolicy(&policy); err != nil {
+		return "", fmt.Errorf("sample policy: %w", err)
+	}
+	store := geoblock.NewStore(geoblock.WithBlockPagesDir(blockPagesDir))
+	if _, err := store.ReplacePolicy(&policy); err != nil {
+		return "", fmt.Errorf("sample policy: %w", err)
+	}
+
+	blocker := newValidationBlocker(store)
+	var failures []string
+	for _, tc := range selfTestCases {
+		result := validateCountry(blocker, tc.country)
+		if got := selfTestDecision(result); got != tc.want {
+			failures = append(failures, fmt.Sprintf("%s got %s, want %s", tc.country, got, tc.want))
+		}
+	}
+	if len(failures) > 0 {
+		return "", errors.New(strings.Join(failures, "; "))
+	}
+	return fmt.Sprintf("%d sample requests decided as expected", len(selfTestCases)), nil
+}
+
+// selfTestLivePolicy checks that every country on the live blocklist is
+// blocked, or monitored in monitor mode, by the middleware
+func selfTestLivePolicy(ctx context.Context) (string, error) {
+	policy := blocklist.Policy()
+	if len(policy.BlockedCountries) == 0 {
+		return "", errCheckSkipped
+	}
+
+	want := "block"
+	if policy.Monitor {
+		want = "monitor"
+	}
+	blocker := newValidationBlocker(blocklist)
+	var failures []string
+	for _, code := range policy.BlockedCountries {
+		result := validateCountry(blocker, code)
+		if got := selfTestDecision(result); got != want && blocklist.Exemption(result.SimulatedIP, "") == nil {
+			failures = append(failures, fmt.Sprintf("%s got %s, want %s", code, got, want))
+		}
+	}
+	if len(failures) > 0 {
+		return "", errors.New(strings.Join(failures, "; "))
+	}
+	return fmt.Sprintf("%d blocked countries enforced", len(policy.BlockedCountries)), nil
+}
+
+// selfTestShopify calls the Admin API with the stored Shopify credentials
+func selfTestShopify(ctx context.Context) (string, error) {
+	token := shopifyToken(currentShopifyConfig.APIKey)
+	if token == "" || offlineMode {
+		return "", errCheckSkipped
+	}
+	if err := pingShopify(ctx, token); err != nil {
+		return "", err
+	}
+	return "Admin API answered for " + shopifyShop, nil
+}
+
+// runSelfTest runs every component in turn, each with its own deadline.
+// Skipped components do not fail the test.
+func runSelfTest(ctx context.Context) SelfTestResponse {
+	start := time.Now()
+	response := SelfTestResponse{Passed: true, CheckedAt: start.Format(time.RFC3339)}
+	for _, component := range selfTestComponents {
+		checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+		checkStart := time.Now()
+		detail, err := component.run(checkCtx)
+		cancel()
+
+		check := SelfTestCheck{
+			Component: component.name,
+			Status:    "pass",
+			Detail:    detail,
+			LatencyMs: time.Since(checkStart).Milliseconds(),
+		}
+		switch {
+		case errors.Is(err, errCheckSkipped):
+			check.Status = "skipped"
+		case err != nil:
+			check.Status = "fail"
+			check.Error = err.Error()
+			response.Passed = false
+		}
+		response.Checks = append(response.Checks, check)
+	}
+	response.DurationMs = time.Since(start).Milliseconds()
+	return response
+}
+
+// handleSelfTest runs the end-to-end self-test for post-deploy
+// verification, answering 503 and notifying if any component failed
+func handleSelfTest(w http.ResponseWriter, r *http.Request) {
+	response := runSelfTest(r.Context())
+	for _, check := range response.Checks {
+		if check.Status == "fail" {
+			fmt.Printf("❌ Self-test %s failed: %s\n", check.Component, check.Error)
+		}
+	}
+	if !response.Passed {
+		notifier.Notify(validationFailedNotification(response))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !response.Passed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
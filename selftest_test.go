@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSelfTestRuleEvaluation(t *testing.T) {
+	detail, err := selfTestRuleEvaluation(context.Background())
+	if err != nil {
+		t.Fatalf("selfTestRuleEvaluation: %v", err)
+	}
+	if detail == "" {
+		t.Error("selfTestRuleEvaluation() detail is empty")
+	}
+	if len(selfTestPolicy.Rules[0].Countries) != 1 {
+		t.Errorf("sample rule changed by normalization: %+v", selfTestPolicy.Rules[0])
+	}
+}
+
+func TestSelfTestShopifySkipped(t *testing.T) {
+	savedToken, savedKey := shopifyAccessToken, currentShopifyConfig.APIKey
+	shopifyAccessToken, currentShopifyConfig.APIKey = "", ""
+	t.Cleanup(func() { shopifyAccessToken, currentShopifyConfig.APIKey = savedToken, savedKey })
+
+	if _, err := selfTestShopify(context.Background()); !errors.Is(err, errCheckSkipped) {
+		t.Errorf("selfTestShopify() error = %v, want skipped", err)
+	}
+}
+
+func TestRunSelfTest(t *testing.T) {
+	saved := selfTestComponents
+	t.Cleanup(func() { selfTestComponents = saved })
+
+	pass := func(ctx context.Context) (string, error) { return "ok", nil }
+	skip := func(ctx context.Context) (string, error) { return "", errCheckSkipped }
+	fail := func(ctx context.Context) (string, error) { return "", errors.New("broken") }
+
+	tests := []struct {
+		name       string
+		components []selfTestComponent
+		wantPassed bool
+		wantStatus []string
+	}{
+		{"all pass", []selfTestComponent{{"a", pass}, {"b", pass}}, true, []string{"pass", "pass"}},
+		{"skipped passes", []selfTestComponent{{"a", pass}, {"b", skip}}, true, []string{"pass", "skipped"}},
+		{"one fails", []selfTestComponent{{"a", fail}, {"b", pass}}, false, []string{"fail", "pass"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selfTestComponents = tt.components
+			response := runSelfTest(context.Background())
+			if response.Passed != tt.wantPassed {
+				t.Errorf("Passed = %v, want %v", response.Passed, tt.wantPassed)
+			}
+			for i, check := range response.Checks {
+				if check.Status != tt.wantStatus[i] {
+					t.Errorf("%s status = %s, want %s", check.Component, check.Status, tt.wantStatus[i])
+				}
+			}
+		})
+	}
+}
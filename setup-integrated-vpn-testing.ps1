@@ -93,7 +93,7 @@ if ($foundVPNs.Count -eq 0) {
 # Check Go server
 Write-Host "`n🔍 Checking Go server..." -ForegroundColor Yellow
 try {
-    $response = Invoke-RestMethod "http://localhost:8080/api/ip-info" -TimeoutSec 3 -ErrorAction Stop
+    $response = Invoke-RestMethod "http://localhost:8080/api/v1/ip-info" -TimeoutSec 3 -ErrorAction Stop
     Write-Host "✅ Go server is running" -ForegroundColor Green
     Write-Host "📍 Current IP: $($response.ip)" -ForegroundColor White
     Write-Host "📍 Current Country: $($response.country_name) ($($response.country_code))" -ForegroundColor White
@@ -110,7 +110,7 @@ try {
             Start-Sleep 6
             
             try {
-                $response = Invoke-RestMethod "http://localhost:8080/api/ip-info" -TimeoutSec 5
+                $response = Invoke-RestMethod "http://localhost:8080/api/v1/ip-info" -TimeoutSec 5
                 Write-Host "✅ Server started successfully!" -ForegroundColor Green
             } catch {
                 Write-Host "⚠️  Server may still be starting..." -ForegroundColor Yellow
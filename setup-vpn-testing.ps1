@@ -18,7 +18,7 @@ try {
 # Check if Go server is running
 Write-Host "`n🔍 Checking Go server status..." -ForegroundColor Yellow
 try {
-    $response = Invoke-RestMethod "http://localhost:8080/api/ip-info" -TimeoutSec 5 -ErrorAction Stop
+    $response = Invoke-RestMethod "http://localhost:8080/api/v1/ip-info" -TimeoutSec 5 -ErrorAction Stop
     Write-Host "✅ Go server is running" -ForegroundColor Green
     Write-Host "📍 Current IP: $($response.ip)" -ForegroundColor White
     Write-Host "📍 Current Country: $($response.country_name) ($($response.country_code))" -ForegroundColor White
@@ -34,7 +34,7 @@ try {
         Start-Sleep 5
         
         try {
-            $response = Invoke-RestMethod "http://localhost:8080/api/ip-info" -TimeoutSec 5
+            $response = Invoke-RestMethod "http://localhost:8080/api/v1/ip-info" -TimeoutSec 5
             Write-Host "✅ Server started successfully!" -ForegroundColor Green
         } catch {
             Write-Host "❌ Server failed to start" -ForegroundColor Red
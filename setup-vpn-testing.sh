@@ -17,9 +17,9 @@ fi
 
 # Check if Go server is running
 echo -e "\n🔍 Checking Go server status..."
-if curl -s "http://localhost:8080/api/ip-info" > /dev/null; then
+if curl -s "http://localhost:8080/api/v1/ip-info" > /dev/null; then
     echo "✅ Go server is running"
-    IP_INFO=$(curl -s "http://localhost:8080/api/ip-info")
+    IP_INFO=$(curl -s "http://localhost:8080/api/v1/ip-info")
     echo "📍 Server is accessible"
 else
     echo "❌ Go server is not running!"
@@ -33,7 +33,7 @@ else
         echo "⏳ Waiting for server to start..."
         sleep 5
         
-        if curl -s "http://localhost:8080/api/ip-info" > /dev/null; then
+        if curl -s "http://localhost:8080/api/v1/ip-info" > /dev/null; then
             echo "✅ Server started successfully!"
         else
             echo "❌ Server failed to start"
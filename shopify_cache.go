@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shopifyPage is a raw page of a Shopify list endpoint with the validators
+// to ask whether it changed
+type shopifyPage struct {
+	etag         string
+	lastModified string
+	link         string
+	body         []byte
+	used         time.Time
+}
+
+// ShopifyPageCache keeps raw Shopify pages so re-syncs can send conditional
+// GETs, and Shopify answers 304 Not Modified for unchanged pages. Pages are
+// keyed by URL and a hash of the access token, so a page is only reused for
+// the credentials that fetched it. Once the pages exceed maxBytes the least
+// recently used are dropped. A nil cache caches nothing.
+type ShopifyPageCache struct {
+	maxBytes int
+
+	mu    sync.Mutex
+	size  int
+	pages map[string]*shopifyPage
+}
+
+// NewShopifyPageCache creates a cache of at most maxBytes, or returns nil if
+// maxBytes is not positive
+func NewShopifyPageCache(maxBytes int) *ShopifyPageCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &ShopifyPageCache{maxBytes: maxBytes, pages: make(map[string]*shopifyPage)}
+}
+
+// shopifyPages caches customer pages for SHOPIFY_PAGE_CACHE_MB megabytes (0
+// disables it). Raw pages hold every customer field, so PII_MINIMIZATION
+// disables the cache too.
+var shopifyPages = newShopifyPages()
+
+func newShopifyPages() *ShopifyPageCache {
+	if piiMinimization {
+		return nil
+	}
+	return NewShopifyPageCache(getEnvInt("SHOPIFY_PAGE_CACHE_MB", 64) << 20)
+}
+
+// shopifyPageKey identifies a page fetched with a token, without keeping the token
+func shopifyPageKey(url, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return url + " " + hex.EncodeToString(sum[:8])
+}
+
+// Conditional adds If-None-Match and If-Modified-Since to a request for a
+// cached page, returning the cached page to use if Shopify answers 304
+func (c *ShopifyPageCache) Conditional(req *http.Request, key string) *shopifyPage {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	page := c.pages[key]
+	if page == nil {
+		return nil
+	}
+	page.used = time.Now()
+	if page.etag != "" {
+		req.Header.Set("If-None-Match", page.etag)
+	}
+	if page.lastModified != "" {
+		req.Header.Set("If-Modified-Since", page.lastModified)
+	}
+	return page
+}
+
+// Store caches a page fetched with a 200 response, if it has a validator
+func (c *ShopifyPageCache) Store(key string, header http.Header, body []byte) {
+	if c == nil {
+		return
+	}
+	page := &shopifyPage{
+		etag:         header.Get("ETag"),
+		lastModified: header.Get("Last-Modified"),
+		link:         header.Get("Link"),
+		body:         body,
+		used:         time.Now(),
+	}
+	if (page.etag == "" && page.lastModified == "") || len(body) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old := c.pages[key]; old != nil {
+		c.size -= len(old.body)
+	}
+	c.pages[key] = page
+	c.size += len(body)
+	for c.size > c.maxBytes {
+		oldestKey, oldest := "", (*shopifyPage)(nil)
+		for k, p := range c.pages {
+			if oldest == nil || p.used.Before(oldest.used) {
+				oldestKey, oldest = k, p
+			}
+		}
+		delete(c.pages, oldestKey)
+		c.size -= len(oldest.body)
+	}
+}
+
+// Stats returns how many pages are cached and their total size in bytes
+func (c *ShopifyPageCache) Stats() (pages, bytes int) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pages), c.size
+}
+
+// Clear drops every cached page, returning how many there were
+func (c *ShopifyPageCache) Clear() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dropped := len(c.pages)
+	c.pages = make(map[string]*shopifyPage)
+	c.size = 0
+	return dropped
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShopifyPageCache(t *testing.T) {
+	cache := NewShopifyPageCache(10)
+	header := http.Header{"Etag": {`"v1"`}, "Link": {`<https://next>; rel="next"`}}
+	key := shopifyPageKey("https://shop/customers.json", "token-a")
+
+	req := httptest.NewRequest("GET", "https://shop/customers.json", nil)
+	if page := cache.Conditional(req, key); page != nil || req.Header.Get("If-None-Match") != "" {
+		t.Fatalf("empty cache made the request conditional")
+	}
+
+	cache.Store(key, header, []byte("page-1"))
+	page := cache.Conditional(req, key)
+	if page == nil || string(page.body) != "page-1" || page.link != header.Get("Link") {
+		t.Fatalf("Conditional() = %+v, want the stored page", page)
+	}
+	if got := req.Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("If-None-Match = %q", got)
+	}
+
+	other := httptest.NewRequest("GET", "https://shop/customers.json", nil)
+	if cache.Conditional(other, shopifyPageKey("https://shop/customers.json", "token-b")) != nil {
+		t.Error("page reused for another token")
+	}
+
+	// Storing past the size limit drops the least recently used page
+	cache.Store(shopifyPageKey("https://shop/2", "token-a"), header, []byte("page-2"))
+	if cache.Conditional(httptest.NewRequest("GET", "/", nil), key) != nil {
+		t.Error("least recently used page kept over the size limit")
+	}
+
+	cache.Store("no-validator", http.Header{}, []byte("x"))
+	if cache.Conditional(httptest.NewRequest("GET", "/", nil), "no-validator") != nil {
+		t.Error("page without ETag or Last-Modified cached")
+	}
+	if dropped := cache.Clear(); dropped != 1 {
+		t.Errorf("Clear() = %d, want 1", dropped)
+	}
+
+	var disabled *ShopifyPageCache
+	disabled.Store(key, header, []byte("page"))
+	if disabled.Conditional(req, key) != nil || disabled.Clear() != 0 {
+		t.Error("nil cache cached a page")
+	}
+}
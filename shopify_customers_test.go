@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// syntheticCustomers returns n customers with one to three addresses each,
+// spread over every country, for benchmarks on store-sized datasets
+func syntheticCustomers(n int) []Customer {
+	countries := getAllCountryCodes()
+	customers := make([]Customer, n)
+	for i := range customers {
+		customer := &customers[i]
+		customer.ID = int64(i + 1)
+		customer.FirstName, customer.LastName = "Customer", fmt.Sprint(i)
+		customer.Tags = "vip, wholesale"
+		customer.TotalSpent = "12.50"
+		for j := 0; j <= i%3; j++ {
+			customer.Addresses = append(customer.Addresses, Address{
+				ID:          int64(i*3 + j),
+				Address1:    fmt.Sprintf("%d Main St", j),
+				City:        "City",
+				CountryCode: countries[(i+j*7)%len(countries)],
+			})
+		}
+		customer.DefaultAddress = &customer.Addresses[0]
+	}
+	return customers
+}
+
+func TestExtractCountryCodesParallel(t *testing.T) {
+	saved := extractWorkers
+	t.Cleanup(func() { extractWorkers = saved })
+	customers := syntheticCustomers(5*extractChunkSize + 123)
+
+	extractWorkers = 1
+	serial := extractCountryCodes(customers)
+	for _, workers := range []int{2, 8} {
+		extractWorkers = workers
+		if parallel := extractCountryCodes(customers); !reflect.DeepEqual(parallel, serial) {
+			t.Errorf("%d workers: result differs from serial extraction", workers)
+		}
+	}
+	if got := extractCountryCodes(nil); got != nil {
+		t.Errorf("extractCountryCodes(nil) = %v, want nil", got)
+	}
+}
+
+func BenchmarkExtractCountryCodes(b *testing.B) {
+	saved := extractWorkers
+	b.Cleanup(func() { extractWorkers = saved })
+	customers := syntheticCustomers(100000)
+
+	for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			extractWorkers = workers
+			for i := 0; i < b.N; i++ {
+				extractCountryCodes(customers)
+			}
+		})
+	}
+}
+
+func BenchmarkExtractUniqueCountries(b *testing.B) {
+	customerCountries := extractCountryCodes(syntheticCustomers(100000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		extractUniqueCountries(customerCountries)
+	}
+}
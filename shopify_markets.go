@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// restOfWorldCode is the shipping zone country code Shopify uses for "Rest of world"
+const restOfWorldCode = "*"
+
+// ShippingZone is a Shopify shipping zone and the countries it ships to
+type ShippingZone struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	Countries []ShippingCountry `json:"countries"`
+}
+
+// ShippingCountry is one country of a shipping zone; Code is "*" for "Rest of world"
+type ShippingCountry struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// ShopifyMarket is a Shopify Market and the countries it sells to
+type ShopifyMarket struct {
+	Name      string   `json:"name"`
+	Active    bool     `json:"active"`
+	Countries []string `json:"countries"`
+}
+
+// marketsQuery lists the store's markets with the countries in each
+const marketsQuery = `{
+  markets(first: 50) {
+    nodes {
+      name
+      status
+      conditions {
+        regionsCondition {
+          regions(first: 250) {
+            nodes { ... on MarketRegionCountry { code } }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// CoverageGap is a country where customers and shipping don't line up
+type CoverageGap struct {
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country_name"`
+	Customers   int    `json:"customers"`
+	InMarket    bool   `json:"in_market"`
+	ShipsTo     bool   `json:"ships_to"`
+	Blocked     bool   `json:"blocked"`
+}
+
+// ShippingCoverageResponse compares where the store ships and sells with where its customers are
+type ShippingCoverageResponse struct {
+	ShippingZones      []ShippingZone  `json:"shipping_zones"`
+	Markets            []ShopifyMarket `json:"markets"`
+	ShipsToRestOfWorld bool            `json:"ships_to_rest_of_world"`
+	ShippingCountries  []string        `json:"shipping_countries"`
+	MarketCountries    []string        `json:"market_countries"`
+	CustomerCountries  []string        `json:"customer_countries"`
+
+	// CustomersWithoutShipping are countries customers come from that the store doesn't ship to
+	CustomersWithoutShipping []CoverageGap `json:"customers_without_shipping"`
+	// ShippingWithoutCustomers are countries the store ships to that no customer comes from
+	ShippingWithoutCustomers []CoverageGap `json:"shipping_without_customers"`
+	// MarketsWithoutShipping are countries in an active market that no shipping zone covers
+	MarketsWithoutShipping []CoverageGap `json:"markets_without_shipping"`
+}
+
+// shopifyAdminRequest calls an Admin API path such as "/shipping_zones.json"
+// and decodes the JSON response into out. A non-nil body is sent as JSON.
+func shopifyAdminRequest(ctx context.Context, method, path, token string, body interface{}, out interface{}) error {
+	if offlineMode {
+		return errShopifyOffline
+	}
+	if token == "" {
+		return fmt.Errorf("no Shopify access token: set SHOPIFY_ACCESS_TOKEN or send api_key")
+	}
+
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+
+	// Every caller is a read or an idempotent write, so transient failures
+	// are retried; each attempt needs a fresh body reader
+	client := newHTTPClient(30 * time.Second)
+	resp, err := shopifyRetry.Do(ctx, func() (*http.Response, error) {
+		var reader io.Reader
+		if payload != nil {
+			reader = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, shopifyAdminBaseURL()+path, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("X-Shopify-Access-Token", token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		return client.Do(req)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return nil
+}
+
+// fetchShippingZones returns the store's shipping zones
+func fetchShippingZones(ctx context.Context, token string) ([]ShippingZone, error) {
+	var response struct {
+		ShippingZones []ShippingZone `json:"shipping_zones"`
+	}
+	if err := shopifyAdminRequest(ctx, "GET", "/shipping_zones.json", token, nil, &response); err != nil {
+		return nil, fmt.Errorf("shipping zones: %w", err)
+	}
+	return response.ShippingZones, nil
+}
+
+// shopifyGraphQL runs an Admin GraphQL query and decodes its data into out,
+// turning any GraphQL errors into an error
+func shopifyGraphQL(ctx context.Context, token, query string, variables map[string]interface{}, out interface{}) error {
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body := map[string]interface{}{"query": query}
+	if variables != nil {
+		body["variables"] = variables
+	}
+	if err := shopifyAdminRequest(ctx, "POST", "/graphql.json", token, body, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		return errors.New(response.Errors[0].Message)
+	}
+	if err := json.Unmarshal(response.Data, out); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return nil
+}
+
+// shopifyGraphQLPages runs a paginated query, passing the previous page's
+// end cursor as $after, until the connection at the dotted path (e.g.
+// "collection.products") has no next page or maxPages were read. Each
+// page's nodes are passed to each as JSON. It reports whether pages were
+// left unread.
+func shopifyGraphQLPages(ctx context.Context, token, query, path string, variables map[string]interface{}, maxPages int, each func(nodes json.RawMessage) error) (bool, error) {
+	vars := map[string]interface{}{"after": nil}
+	for name, value := range variables {
+		vars[name] = value
+	}
+	for page := 0; page < maxPages; page++ {
+		var data json.RawMessage
+		if err := shopifyGraphQL(ctx, token, query, vars, &data); err != nil {
+			return false, err
+		}
+		for _, field := range strings.Split(path, ".") {
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal(data, &object); err != nil {
+				return false, fmt.Errorf("failed to parse JSON: %w", err)
+			}
+			data = object[field]
+		}
+		var connection struct {
+			Nodes    json.RawMessage `json:"nodes"`
+			PageInfo struct {
+				HasNextPage bool   `json:"hasNextPage"`
+				EndCursor   string `json:"endCursor"`
+			} `json:"pageInfo"`
+		}
+		if err := json.Unmarshal(data, &connection); err != nil {
+			return false, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		if err := each(connection.Nodes); err != nil {
+			return false, err
+		}
+		if !connection.PageInfo.HasNextPage {
+			return false, nil
+		}
+		vars["after"] = connection.PageInfo.EndCursor
+	}
+	return true, nil
+}
+
+// fetchMarkets returns the store's Shopify Markets, which are only available over GraphQL
+func fetchMarkets(ctx context.Context, token string) ([]ShopifyMarket, error) {
+	var data struct {
+		Markets struct {
+			Nodes []struct {
+				Name       string `json:"name"`
+				Status     string `json:"status"`
+				Conditions struct {
+					RegionsCondition *struct {
+						Regions struct {
+							Nodes []struct {
+								Code string `json:"code"`
+							} `json:"nodes"`
+						} `json:"regions"`
+					} `json:"regionsCondition"`
+				} `json:"conditions"`
+			} `json:"nodes"`
+		} `json:"markets"`
+	}
+	if err := shopifyGraphQL(ctx, token, marketsQuery, nil, &data); err != nil {
+		return nil, fmt.Errorf("markets: %w", err)
+	}
+
+	markets := []ShopifyMarket{}
+	for _, node := range data.Markets.Nodes {
+		market := ShopifyMarket{Name: node.Name, Active: node.Status == "ACTIVE", Countries: []string{}}
+		if node.Conditions.RegionsCondition != nil {
+			for _, region := range node.Conditions.RegionsCondition.Regions.Nodes {
+				if region.Code != "" {
+					market.Countries = append(market.Countries, strings.ToUpper(region.Code))
+				}
+			}
+		}
+		markets = append(markets, market)
+	}
+	return markets, nil
+}
+
+// compareShippingCoverage lines up shipping zones and active markets with the
+// countries customers have addresses in. A "Rest of world" zone ships
+// everywhere, so no customer country lacks shipping.
+func compareShippingCoverage(zones []ShippingZone, markets []ShopifyMarket, customerCountries []CustomerCountry) ShippingCoverageResponse {
+	response := ShippingCoverageResponse{
+		ShippingZones:            zones,
+		Markets:                  markets,
+		CustomersWithoutShipping: []CoverageGap{},
+		ShippingWithoutCustomers: []CoverageGap{},
+		MarketsWithoutShipping:   []CoverageGap{},
+	}
+
+	shipping := make(map[string]bool)
+	for _, zone := range zones {
+		for _, country := range zone.Countries {
+			if country.Code == restOfWorldCode {
+				response.ShipsToRestOfWorld = true
+			} else {
+				shipping[strings.ToUpper(country.Code)] = true
+			}
+		}
+	}
+	inMarket := make(map[string]bool)
+	for _, market := range markets {
+		if market.Active {
+			for _, code := range market.Countries {
+				inMarket[code] = true
+			}
+		}
+	}
+	customers := make(map[string]int)
+	for _, cc := range customerCountries {
+		for _, code := range cc.CountryCodes {
+			customers[code]++
+		}
+	}
+
+	gap := func(code string) CoverageGap {
+		name, _ := getCountryName(code)
+		return CoverageGap{
+			CountryCode: code,
+			CountryName: name,
+			Customers:   customers[code],
+			InMarket:    inMarket[code],
+			ShipsTo:     response.ShipsToRestOfWorld || shipping[code],
+			Blocked:     blocklist.IsBlocked(code),
+		}
+	}
+	response.ShippingCountries = sortedKeys(shipping)
+	response.MarketCountries = sortedKeys(inMarket)
+	response.CustomerCountries = make([]string, 0, len(customers))
+	for code := range customers {
+		response.CustomerCountries = append(response.CustomerCountries, code)
+	}
+	sort.Strings(response.CustomerCountries)
+
+	for _, code := range response.CustomerCountries {
+		if !response.ShipsToRestOfWorld && !shipping[code] {
+			response.CustomersWithoutShipping = append(response.CustomersWithoutShipping, gap(code))
+		}
+	}
+	sort.SliceStable(response.CustomersWithoutShipping, func(i, j int) bool {
+		return response.CustomersWithoutShipping[i].Customers > response.CustomersWithoutShipping[j].Customers
+	})
+	for _, code := range response.ShippingCountries {
+		if customers[code] == 0 {
+			response.ShippingWithoutCustomers = append(response.ShippingWithoutCustomers, gap(code))
+		}
+	}
+	for _, code := range response.MarketCountries {
+		if !response.ShipsToRestOfWorld && !shipping[code] {
+			response.MarketsWithoutShipping = append(response.MarketsWithoutShipping, gap(code))
+		}
+	}
+	return response
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handleShippingCoverage compares the store's shipping zones and Shopify
+// Markets with the countries its customers come from
+func handleShippingCoverage(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("🚚 Comparing shipping zones and markets with customer countries...")
+
+	fail := func(err error) {
+		fmt.Printf("❌ Error fetching store data: %v\n", err)
+		writeError(w, r, fmt.Sprintf("Failed to fetch store data: %v", err), http.StatusInternalServerError)
+	}
+
+	token := shopifyToken(currentShopifyConfig.APIKey)
+	zones, err := fetchShippingZones(r.Context(), token)
+	if err != nil {
+		fail(err)
+		return
+	}
+	markets, err := fetchMarkets(r.Context(), token)
+	if err != nil {
+		fail(err)
+		return
+	}
+	customers, err := fetchAllCustomersFromShopify(r.Context(), currentShopifyConfig.APIKey, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	response := compareShippingCoverage(zones, markets, extractCountryCodes(customers))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	fmt.Printf("✅ %d customer countries without shipping, %d shipping countries without customers\n",
+		len(response.CustomersWithoutShipping), len(response.ShippingWithoutCustomers))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareShippingCoverage(t *testing.T) {
+	zones := []ShippingZone{
+		{Name: "Domestic", Countries: []ShippingCountry{{Code: "US"}}},
+		{Name: "Europe", Countries: []ShippingCountry{{Code: "de"}, {Code: "FR"}}},
+	}
+	markets := []ShopifyMarket{
+		{Name: "North America", Active: true, Countries: []string{"US", "CA"}},
+		{Name: "Japan", Active: false, Countries: []string{"JP"}},
+	}
+	customers := []CustomerCountry{
+		{CustomerID: 1, CountryCodes: []string{"US"}},
+		{CustomerID: 2, CountryCodes: []string{"US", "GB"}},
+		{CustomerID: 3, CountryCodes: []string{"CA"}},
+		{CustomerID: 4, CountryCodes: []string{"GB"}},
+		{CustomerID: 5, CountryCodes: []string{"DE"}},
+	}
+
+	got := compareShippingCoverage(zones, markets, customers)
+
+	codes := func(gaps []CoverageGap) []string {
+		list := []string{}
+		for _, gap := range gaps {
+			list = append(list, gap.CountryCode)
+		}
+		return list
+	}
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"shipping countries", got.ShippingCountries, []string{"DE", "FR", "US"}},
+		{"market countries", got.MarketCountries, []string{"CA", "US"}},
+		{"customer countries", got.CustomerCountries, []string{"CA", "DE", "GB", "US"}},
+		{"customers without shipping", codes(got.CustomersWithoutShipping), []string{"GB", "CA"}},
+		{"shipping without customers", codes(got.ShippingWithoutCustomers), []string{"FR"}},
+		{"markets without shipping", codes(got.MarketsWithoutShipping), []string{"CA"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if gap := got.CustomersWithoutShipping[0]; gap.Customers != 2 || gap.ShipsTo || gap.InMarket {
+		t.Errorf("GB gap = %+v, want 2 customers, not shipped to, not in a market", gap)
+	}
+
+	zones = append(zones, ShippingZone{Name: "Rest of world", Countries: []ShippingCountry{{Code: "*"}}})
+	got = compareShippingCoverage(zones, markets, customers)
+	if !got.ShipsToRestOfWorld || len(got.CustomersWithoutShipping) != 0 || len(got.MarketsWithoutShipping) != 0 {
+		t.Errorf("with rest of world: %+v", got)
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"", ""},
+		{`<https://shop.myshopify.com/admin/api/2025-07/customers.json?limit=250&page_info=abc>; rel="next"`,
+			"https://shop.myshopify.com/admin/api/2025-07/customers.json?limit=250&page_info=abc"},
+		{`<https://shop/customers.json?page_info=prev>; rel="previous", <https://shop/customers.json?page_info=next>; rel="next"`,
+			"https://shop/customers.json?page_info=next"},
+		{`<https://shop/customers.json?page_info=prev>; rel="previous"`, ""},
+	}
+	for _, tt := range tests {
+		if got := nextPageURL(tt.link); got != tt.want {
+			t.Errorf("nextPageURL(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"shopify-customers/geoblock"
+)
+
+// maxRangesPerCountry bounds how many networks per country and IP version are kept from a GeoIP database
+const maxRangesPerCountry = 64
+
+// simulationFallbackIP and simulationFallbackIPv6 are returned for countries
+// without any known allocation. They are in the documentation ranges
+// (RFC 5737 and RFC 3849) and never geolocate.
+const (
+	simulationFallbackIP   = "198.51.100.1"
+	simulationFallbackIPv6 = "2001:db8::1"
+)
+
+// builtinIPRangesJSON maps countries to well-known public allocations of their
+// major networks. It seeds simulation when no GeoIP database is configured.
+//
+//go:embed data/ip_ranges.json
+var builtinIPRangesJSON []byte
+
+var (
+	countryRangesOnce sync.Once
+	countryRanges     map[string][]*net.IPNet
+)
+
+// parseIPRanges decodes a {"CC": ["cidr", ...]} table
+func parseIPRanges(data []byte) (map[string][]*net.IPNet, error) {
+	var table map[string][]string
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse IP ranges: %w", err)
+	}
+
+	ranges := make(map[string][]*net.IPNet, len(table))
+	for country, cidrs := range table {
+		code, err := normalizeCountryCode(country)
+		if err != nil {
+			return nil, err
+		}
+		for _, cidr := range cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", country, err)
+			}
+			ranges[code] = append(ranges[code], network)
+		}
+	}
+	return ranges, nil
+}
+
+// geoDatabaseRanges collects networks per country from a GeoLite2/GeoIP2 Country
+// database, keeping at most perCountry networks per IP version (0 keeps all).
+// A non-nil countries set limits the result to those countries.
+func geoDatabaseRanges(reader *maxminddb.Reader, perCountry int, countries map[string]bool) map[string][]*net.IPNet {
+	ranges := make(map[string][]*net.IPNet)
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	counts := make(map[string]int)
+	networks := reader.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		network, err := networks.Network(&record)
+		if err != nil || record.Country.ISOCode == "" || (countries != nil && !countries[record.Country.ISOCode]) {
+			continue
+		}
+		key := record.Country.ISOCode + "/6"
+		if network.IP.To4() != nil {
+			key = record.Country.ISOCode + "/4"
+		}
+		if perCountry == 0 || counts[key] < perCountry {
+			counts[key]++
+			ranges[record.Country.ISOCode] = append(ranges[record.Country.ISOCode], network)
+		}
+	}
+	return ranges
+}
+
+// loadCountryRanges builds the simulation table: the built-in seed, then
+// networks from the configured MaxMind database, then IP_RANGES_FILE, with
+// later sources replacing a country's ranges
+func loadCountryRanges() map[string][]*net.IPNet {
+	ranges, err := parseIPRanges(builtinIPRangesJSON)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in IP ranges: %v", err))
+	}
+
+	for _, provider := range geoResolver.Providers() {
+		if mm, ok := provider.(*geoblock.MaxMind); ok {
+			for country, networks := range geoDatabaseRanges(mm.Reader(), maxRangesPerCountry, nil) {
+				ranges[country] = networks
+			}
+			fmt.Printf("🗺️  Loaded simulation IP ranges for %d countries from %s\n", len(ranges), mm.Path())
+			break
+		}
+	}
+
+	if path := getEnv("IP_RANGES_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var custom map[string][]*net.IPNet
+			if custom, err = parseIPRanges(data); err == nil {
+				for country, networks := range custom {
+					ranges[country] = networks
+				}
+			}
+		}
+		if err != nil {
+			fmt.Printf("⚠️  Ignoring IP_RANGES_FILE %s: %v\n", path, err)
+		}
+	}
+
+	return ranges
+}
+
+// randomIPInNetwork picks a random host address inside an IPv4 or IPv6
+// network, avoiding the network address (and the IPv4 broadcast address)
+// where the network is large enough to have them
+func randomIPInNetwork(network *net.IPNet) net.IP {
+	base := network.IP.To4()
+	if base == nil {
+		base = network.IP.To16()
+	}
+	mask := network.Mask[len(network.Mask)-len(base):]
+	ones, bits := network.Mask.Size()
+	reserved := bits-ones >= 2
+
+	ip := make(net.IP, len(base))
+	for {
+		broadcast := true
+		for i := range ip {
+			ip[i] = base[i]&mask[i] | byte(rand.Intn(256))&^mask[i]
+			broadcast = broadcast && ip[i]|mask[i] == 0xff
+		}
+		if !reserved || (!ip.Equal(base) && !(broadcast && len(ip) == net.IPv4len)) {
+			return ip
+		}
+	}
+}
+
+// generateSimulatedIP returns a random public IPv4 address allocated to the country
+func generateSimulatedIP(countryCode string) string {
+	return generateSimulatedIPVersion(countryCode, 4)
+}
+
+// generateSimulatedIPVersion returns a random public address of the given IP
+// version (4 or 6) allocated to the country
+func generateSimulatedIPVersion(countryCode string, version int) string {
+	countryRangesOnce.Do(func() { countryRanges = loadCountryRanges() })
+
+	var networks []*net.IPNet
+	for _, network := range countryRanges[countryCode] {
+		if (network.IP.To4() == nil) == (version == 6) {
+			networks = append(networks, network)
+		}
+	}
+
+	if len(networks) == 0 {
+		fallback := simulationFallbackIP
+		if version == 6 {
+			fallback = simulationFallbackIPv6
+		}
+		fmt.Printf("⚠️  No known IPv%d allocation for %s, using %s\n", version, countryCode, fallback)
+		return fallback
+	}
+	return randomIPInNetwork(networks[rand.Intn(len(networks))]).String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRandomIPInNetwork(t *testing.T) {
+	for _, cidr := range []string{"8.8.8.0/24", "12.0.0.0/8", "192.0.2.4/30", "192.0.2.8/31", "192.0.2.10/32", "2001:db8::/32", "2001:db8::/126", "2001:db8::1/128"} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, bits := network.Mask.Size()
+		broadcast := make(net.IP, len(network.IP))
+		for i := range broadcast {
+			broadcast[i] = network.IP[i] | ^network.Mask[i]
+		}
+		for i := 0; i < 100; i++ {
+			ip := randomIPInNetwork(network)
+			if !network.Contains(ip) {
+				t.Fatalf("%s: generated %s outside the network", cidr, ip)
+			}
+			if bits-ones >= 2 && ip.Equal(network.IP) {
+				t.Fatalf("%s: generated network address %s", cidr, ip)
+			}
+			if bits == 32 && ones <= 30 && ip.Equal(broadcast) {
+				t.Fatalf("%s: generated broadcast address %s", cidr, ip)
+			}
+		}
+	}
+}
+
+func TestBuiltinIPRanges(t *testing.T) {
+	ranges, err := parseIPRanges(builtinIPRangesJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for country, networks := range ranges {
+		for _, network := range networks {
+			if isPrivateIP(network.IP.String()) {
+				t.Errorf("%s: %s is a private range", country, network)
+			}
+		}
+	}
+}
+
+func TestGenerateSimulatedIPVersion(t *testing.T) {
+	for _, version := range []int{4, 6} {
+		ip := net.ParseIP(generateSimulatedIPVersion("DE", version))
+		if ip == nil {
+			t.Fatalf("IPv%d: generated an unparseable address", version)
+		}
+		if isV4 := ip.To4() != nil; isV4 != (version == 4) {
+			t.Errorf("IPv%d: generated %s", version, ip)
+		}
+	}
+	if got := generateSimulatedIPVersion("AQ", 6); got != simulationFallbackIPv6 {
+		t.Errorf("unknown country: got %s, want %s", got, simulationFallbackIPv6)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBlockSpikes caps the spikes remembered for /analytics/spikes
+const maxBlockSpikes = 100
+
+// BlockSpike is a country whose blocked requests in the last window rose
+// above its rolling baseline by the configured factor
+type BlockSpike struct {
+	CountryCode string  `json:"country_code"`
+	CountryName string  `json:"country_name,omitempty"`
+	Blocked     int     `json:"blocked"`
+	Baseline    float64 `json:"baseline"`
+	Factor      float64 `json:"factor"`
+	DetectedAt  string  `json:"detected_at"`
+}
+
+// SpikeDetector watches blocked requests per country, counting monitored
+// requests that would have been blocked, and flags a country when the last
+// window exceeds its baseline, the average per window over the preceding
+// baseline period, by factor. Countries with fewer than minBlocks blocked
+// requests in the window are ignored, and each country is flagged at most
+// once per cooldown.
+type SpikeDetector struct {
+	window    time.Duration
+	baseline  time.Duration
+	factor    float64
+	minBlocks int
+	cooldown  time.Duration
+
+	// started bounds the baseline to the time traffic has been counted
+	started time.Time
+
+	mu        sync.Mutex
+	lastAlert map[string]time.Time
+	spikes    []BlockSpike
+}
+
+// NewSpikeDetector creates a detector that has been counting since started
+func NewSpikeDetector(window, baseline time.Duration, factor float64, minBlocks int, cooldown time.Duration, started time.Time) *SpikeDetector {
+	return &SpikeDetector{
+		window:    window,
+		baseline:  baseline,
+		factor:    factor,
+		minBlocks: minBlocks,
+		cooldown:  cooldown,
+		started:   started,
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+var spikeDetector = NewSpikeDetector(
+	getEnvDuration("SPIKE_WINDOW", 15*time.Minute),
+	getEnvDuration("SPIKE_BASELINE", 24*time.Hour),
+	getEnvFloat("SPIKE_FACTOR", 5),
+	getEnvInt("SPIKE_MIN_BLOCKS", 50),
+	getEnvDuration("SPIKE_COOLDOWN", time.Hour),
+	time.Now(),
+)
+
+// Check compares the traffic buckets against the baseline at now and
+// returns the new spikes
+func (d *SpikeDetector) Check(buckets []TrafficBucket, now time.Time) []BlockSpike {
+	windowStart := now.Add(-d.window)
+	baselineStart := windowStart.Add(-d.baseline)
+	if baselineStart.Before(d.started) {
+		baselineStart = d.started
+	}
+	// Without a full window of history every country would look new
+	span := windowStart.Sub(baselineStart)
+	if span < d.window {
+		return nil
+	}
+
+	current := make(map[string]int)
+	history := make(map[string]int)
+	for _, bucket := range buckets {
+		blocked := bucket.Blocks + bucket.Monitored
+		switch {
+		case !bucket.Start.Before(windowStart):
+			current[bucket.CountryCode] += blocked
+		case !bucket.Start.Before(baselineStart):
+			history[bucket.CountryCode] += blocked
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var spikes []BlockSpike
+	for country, blocked := range current {
+		baseline := float64(history[country]) * float64(d.window) / float64(span)
+		// A country never blocked before spikes once it reaches minBlocks
+		if blocked < d.minBlocks || float64(blocked) <= d.factor*max(baseline, 1) {
+			continue
+		}
+		if last, ok := d.lastAlert[country]; ok && now.Sub(last) < d.cooldown {
+			continue
+		}
+		d.lastAlert[country] = now
+		name, _ := getCountryName(country)
+		spikes = append(spikes, BlockSpike{
+			CountryCode: country,
+			CountryName: name,
+			Blocked:     blocked,
+			Baseline:    baseline,
+			Factor:      d.factor,
+			DetectedAt:  now.Format(time.RFC3339),
+		})
+	}
+	sort.Slice(spikes, func(i, j int) bool { return spikes[i].Blocked > spikes[j].Blocked })
+
+	d.spikes = append(d.spikes, spikes...)
+	if len(d.spikes) > maxBlockSpikes {
+		d.spikes = d.spikes[len(d.spikes)-maxBlockSpikes:]
+	}
+	return spikes
+}
+
+// Spikes returns the remembered spikes, most recent first
+func (d *SpikeDetector) Spikes() []BlockSpike {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	spikes := make([]BlockSpike, 0, len(d.spikes))
+	for i := len(d.spikes) - 1; i >= 0; i-- {
+		spikes = append(spikes, d.spikes[i])
+	}
+	return spikes
+}
+
+// startSpikeDetector checks the traffic analytics for spikes every
+// SPIKE_CHECK_INTERVAL and notifies about each one
+func startSpikeDetector() {
+	interval := getEnvDuration("SPIKE_CHECK_INTERVAL", trafficBucketSize)
+	if interval <= 0 || spikeDetector.factor <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now()
+			buckets := trafficAnalytics.Buckets(now.Add(-spikeDetector.window - spikeDetector.baseline))
+			for _, spike := range spikeDetector.Check(buckets, now) {
+				fmt.Printf("📈 SPIKE: %d blocked requests from %s in %s, baseline %.1f\n",
+					spike.Blocked, spike.CountryCode, shortDuration(spikeDetector.window), spike.Baseline)
+				notifier.Notify(blockedTrafficSpikeNotification(spike.CountryCode, spike.Blocked, spike.Baseline, spikeDetector.window))
+			}
+		}
+	}()
+}
+
+type BlockSpikesResponse struct {
+	Window   string       `json:"window"`
+	Baseline string       `json:"baseline"`
+	Factor   float64      `json:"factor"`
+	Spikes   []BlockSpike `json:"spikes"`
+}
+
+// handleBlockSpikes lists recently detected spikes in blocked traffic
+func handleBlockSpikes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BlockSpikesResponse{
+		Window:   shortDuration(spikeDetector.window),
+		Baseline: shortDuration(spikeDetector.baseline),
+		Factor:   spikeDetector.factor,
+		Spikes:   spikeDetector.Spikes(),
+	})
+}
+
+// shortDuration formats a duration without trailing zero units, e.g. "15m"
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
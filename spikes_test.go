@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpikeDetector(t *testing.T) {
+	start := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(3 * time.Hour)
+	detector := NewSpikeDetector(15*time.Minute, 24*time.Hour, 5, 50, time.Hour, start)
+
+	bucket := func(at time.Time, country string, blocks, monitored int) TrafficBucket {
+		return TrafficBucket{Start: at, CountryTraffic: CountryTraffic{CountryCode: country, Blocks: blocks, Monitored: monitored}}
+	}
+	var buckets []TrafficBucket
+	// RU is blocked steadily, 20 an hour; CN only now
+	for at := start; at.Before(now); at = at.Add(trafficBucketSize) {
+		buckets = append(buckets, bucket(at, "RU", 2, 0))
+	}
+	buckets = append(buckets,
+		bucket(now.Add(-10*time.Minute), "RU", 20, 0),
+		bucket(now.Add(-10*time.Minute), "CN", 40, 20),
+		bucket(now.Add(-5*time.Minute), "BR", 10, 0),
+	)
+
+	spikes := detector.Check(buckets, now)
+	if len(spikes) != 1 || spikes[0].CountryCode != "CN" || spikes[0].Blocked != 60 || spikes[0].Baseline != 0 {
+		t.Fatalf("spikes = %+v, want only CN with 60 blocked", spikes)
+	}
+
+	// A steady country spikes once its window is factor times its baseline
+	buckets = append(buckets, bucket(now.Add(-5*time.Minute), "RU", 60, 0))
+	spikes = detector.Check(buckets, now)
+	if len(spikes) != 1 || spikes[0].CountryCode != "RU" {
+		t.Fatalf("spikes = %+v, want RU", spikes)
+	}
+
+	// Within the cooldown neither is reported again
+	if spikes := detector.Check(buckets, now.Add(time.Minute)); len(spikes) != 0 {
+		t.Errorf("spikes during cooldown = %+v", spikes)
+	}
+	if got := len(detector.Spikes()); got != 2 {
+		t.Errorf("remembered %d spikes, want 2", got)
+	}
+
+	// Right after startup there is no baseline to compare with
+	fresh := NewSpikeDetector(15*time.Minute, 24*time.Hour, 5, 50, time.Hour, now.Add(-20*time.Minute))
+	if spikes := fresh.Check(buckets, now); len(spikes) != 0 {
+		t.Errorf("spikes without history = %+v", spikes)
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{15 * time.Minute: "15m", time.Hour: "1h", 90 * time.Minute: "1h30m", 45 * time.Second: "45s"} {
+		if got := shortDuration(d); got != want {
+			t.Errorf("shortDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// storefrontSyncEnabled pushes every blocklist change to a shop metafield,
+// where the storefront (a theme app embed or Shopify Function) enforces it
+var storefrontSyncEnabled = getEnv("STOREFRONT_SYNC", "false") == "true"
+
+// The shop metafield holding the blocklist, read by the storefront as shop.metafields.geoblock.blocklist
+const (
+	storefrontMetafieldNamespace = "geoblock"
+	storefrontMetafieldKey       = "blocklist"
+)
+
+// storefrontPushTimeout is the deadline for writing the metafield, including the shop lookup
+const storefrontPushTimeout = time.Minute
+
+// Storefront sync states
+const (
+	storefrontDisabled = "disabled"
+	storefrontPending  = "pending"
+	storefrontSynced   = "synced"
+	storefrontFailed   = "failed"
+)
+
+// StorefrontBlocklist is the metafield value the storefront reads
+type StorefrontBlocklist struct {
+	BlockedCountries []string `json:"blocked_countries"`
+	Version          int      `json:"version"`
+	UpdatedAt        string   `json:"updated_at"`
+}
+
+// StorefrontSyncStatus reports whether the storefront enforces the current blocklist
+type StorefrontSyncStatus struct {
+	Enabled         bool     `json:"enabled"`
+	State           string   `json:"state"`
+	Metafield       string   `json:"metafield"`
+	PendingVersion  int      `json:"pending_version,omitempty"`
+	SyncedVersion   int      `json:"synced_version,omitempty"`
+	SyncedCountries []string `json:"synced_countries,omitempty"`
+	LastAttemptAt   string   `json:"last_attempt_at,omitempty"`
+	LastSyncedAt    string   `json:"last_synced_at,omitempty"`
+	LastError       string   `json:"last_error,omitempty"`
+}
+
+// StorefrontSyncer pushes the blocklist to the storefront in the background.
+// Changes made while a push is running are coalesced into one more push of
+// the then-current blocklist, so the storefront always ends on the latest one.
+type StorefrontSyncer struct {
+	mu      sync.Mutex
+	status  StorefrontSyncStatus
+	trigger chan struct{}
+
+	// syncMu runs one push at a time, so an older blocklist never lands last
+	syncMu sync.Mutex
+
+	current func() StorefrontBlocklist
+	push    func(StorefrontBlocklist) error
+}
+
+// NewStorefrontSyncer creates a syncer that pushes the blocklist returned by current
+func NewStorefrontSyncer(enabled bool, current func() StorefrontBlocklist, push func(StorefrontBlocklist) error) *StorefrontSyncer {
+	state := storefrontDisabled
+	if enabled {
+		state = storefrontPending
+	}
+	return &StorefrontSyncer{
+		status: StorefrontSyncStatus{
+			Enabled:   enabled,
+			State:     state,
+			Metafield: storefrontMetafieldNamespace + "." + storefrontMetafieldKey,
+		},
+		trigger: make(chan struct{}, 1),
+		current: current,
+		push:    push,
+	}
+}
+
+// Trigger schedules a push of the blocklist after it changed to version
+func (s *StorefrontSyncer) Trigger(version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.status.Enabled {
+		return
+	}
+	s.status.State = storefrontPending
+	s.status.PendingVersion = version
+
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Start pushes the blocklist whenever it is triggered
+func (s *StorefrontSyncer) Start() {
+	go func() {
+		for range s.trigger {
+			s.Sync()
+		}
+	}()
+}
+
+// Sync pushes the current blocklist now and returns the resulting status
+func (s *StorefrontSyncer) Sync() (StorefrontSyncStatus, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	list := s.current()
+	attemptedAt := time.Now().Format(time.RFC3339)
+	err := s.push(list)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastAttemptAt = attemptedAt
+	if err != nil {
+		// Announce a new failure, not every retry of the same one
+		if s.status.State != storefrontFailed || s.status.LastError != err.Error() {
+			notifier.Notify(shopifySyncFailedNotification(list.Version, err))
+		}
+		s.status.State = storefrontFailed
+		s.status.LastError = err.Error()
+		fmt.Printf("❌ Storefront sync of blocklist version %d failed: %v\n", list.Version, err)
+		return s.status, err
+	}
+
+	s.status.SyncedVersion = list.Version
+	s.status.SyncedCountries = list.BlockedCountries
+	s.status.LastSyncedAt = attemptedAt
+	s.status.LastError = ""
+	if s.status.PendingVersion <= list.Version {
+		s.status.State = storefrontSynced
+		s.status.PendingVersion = 0
+	}
+	fmt.Printf("🛍️  Storefront now blocks %v (version %d)\n", list.BlockedCountries, list.Version)
+	return s.status, nil
+}
+
+// Status returns the latest sync status
+func (s *StorefrontSyncer) Status() StorefrontSyncStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// storefrontSync keeps the storefront's copy of the blocklist up to date
+var storefrontSync = NewStorefrontSyncer(storefrontSyncEnabled, currentStorefrontBlocklist, pushShopMetafield)
+
+// currentStorefrontBlocklist is the active blocklist and its history version
+func currentStorefrontBlocklist() StorefrontBlocklist {
+	list := StorefrontBlocklist{
+		BlockedCountries: blocklist.Countries(),
+		UpdatedAt:        time.Now().Format(time.RFC3339),
+	}
+	if latest, ok := policyHistory.Latest(); ok {
+		list.Version = latest.Version
+	}
+	return list
+}
+
+// pushShopMetafield writes the blocklist to the shop's geoblock.blocklist JSON metafield
+func pushShopMetafield(list StorefrontBlocklist) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storefrontPushTimeout)
+	defer cancel()
+	token := shopifyToken(currentShopifyConfig.APIKey)
+
+	var shop struct {
+		Shop struct {
+			ID string `json:"id"`
+		} `json:"shop"`
+	}
+	if err := shopifyGraphQL(ctx, token, `{ shop { id } }`, nil, &shop); err != nil {
+		return fmt.Errorf("shop lookup: %w", err)
+	}
+
+	value, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		MetafieldsSet struct {
+			UserErrors []struct {
+				Message string `json:"message"`
+			} `json:"userErrors"`
+		} `json:"metafieldsSet"`
+	}
+	err = shopifyGraphQL(ctx, token, `mutation SetBlocklist($metafields: [MetafieldsSetInput!]!) {
+  metafieldsSet(metafields: $metafields) { userErrors { message } }
+}`, map[string]interface{}{
+		"metafields": []map[string]string{{
+			"ownerId":   shop.Shop.ID,
+			"namespace": storefrontMetafieldNamespace,
+			"key":       storefrontMetafieldKey,
+			"type":      "json",
+			"value":     string(value),
+		}},
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("metafield update: %w", err)
+	}
+	if errs := result.MetafieldsSet.UserErrors; len(errs) > 0 {
+		return fmt.Errorf("metafield update: %s", errs[0].Message)
+	}
+	return nil
+}
+
+// handleStorefrontSyncStatus reports whether the storefront enforces the current blocklist
+func handleStorefrontSyncStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(storefrontSync.Status())
+}
+
+// handleStorefrontSync pushes the blocklist to the storefront now, e.g. to retry a failed sync
+func handleStorefrontSync(w http.ResponseWriter, r *http.Request) {
+	if !storefrontSyncEnabled {
+		writeError(w, r, "Storefront sync is disabled: set STOREFRONT_SYNC=true", http.StatusConflict)
+		return
+	}
+
+	status, err := storefrontSync.Sync()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("Storefront sync failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	recordAudit(r, "storefront-sync", map[string]interface{}{
+		"version":   status.SyncedVersion,
+		"countries": status.SyncedCountries,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
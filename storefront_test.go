@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStorefrontSyncer(t *testing.T) {
+	list := StorefrontBlocklist{BlockedCountries: []string{"RU"}, Version: 1}
+	var pushed []StorefrontBlocklist
+	var pushErr error
+	syncer := NewStorefrontSyncer(true,
+		func() StorefrontBlocklist { return list },
+		func(l StorefrontBlocklist) error {
+			pushed = append(pushed, l)
+			return pushErr
+		})
+
+	syncer.Trigger(1)
+	if status := syncer.Status(); status.State != storefrontPending || status.PendingVersion != 1 {
+		t.Errorf("after trigger: %+v, want pending version 1", status)
+	}
+
+	pushErr = errors.New("shopify unreachable")
+	if status, err := syncer.Sync(); err == nil || status.State != storefrontFailed || status.LastError != "shopify unreachable" {
+		t.Errorf("failed sync = %+v, %v", status, err)
+	}
+
+	pushErr = nil
+	list = StorefrontBlocklist{BlockedCountries: []string{"RU", "KP"}, Version: 2}
+	syncer.Trigger(2)
+	status, err := syncer.Sync()
+	if err != nil || status.State != storefrontSynced || status.SyncedVersion != 2 || status.PendingVersion != 0 {
+		t.Errorf("sync = %+v, %v, want synced version 2", status, err)
+	}
+	if !reflect.DeepEqual(status.SyncedCountries, []string{"RU", "KP"}) || len(pushed) != 2 {
+		t.Errorf("pushed %+v, status countries %v", pushed, status.SyncedCountries)
+	}
+
+	// A change made during a push keeps the status pending until it is pushed too
+	syncer.Trigger(3)
+	if status, _ := syncer.Sync(); status.State != storefrontPending || status.SyncedVersion != 2 {
+		t.Errorf("sync of older version = %+v, want still pending", status)
+	}
+}
+
+func TestStorefrontSyncerDisabled(t *testing.T) {
+	syncer := NewStorefrontSyncer(false,
+		func() StorefrontBlocklist { return StorefrontBlocklist{} },
+		func(StorefrontBlocklist) error { t.Error("disabled syncer pushed"); return nil })
+
+	syncer.Trigger(1)
+	if status := syncer.Status(); status.Enabled || status.State != storefrontDisabled || status.PendingVersion != 0 {
+		t.Errorf("disabled status = %+v", status)
+	}
+	select {
+	case <-syncer.trigger:
+		t.Error("disabled syncer was triggered")
+	default:
+	}
+}
@@ -45,7 +45,7 @@ class VPNGeoBlockingTester {
     async checkServerStatus() {
         console.log('🔍 Checking server status...');
         try {
-            const response = await this.page.goto(`${this.apiBaseUrl}/api/ip-info`, {
+            const response = await this.page.goto(`${this.apiBaseUrl}/api/v1/ip-info`, {
                 waitUntil: 'networkidle2',
                 timeout: 5000
             });
@@ -69,7 +69,7 @@ class VPNGeoBlockingTester {
         
         try {
             const response = await this.page.evaluate(async (apiUrl) => {
-                const resp = await fetch(`${apiUrl}/api/ip-info`);
+                const resp = await fetch(`${apiUrl}/api/v1/ip-info`);
                 return await resp.json();
             }, this.apiBaseUrl);
             
@@ -93,7 +93,7 @@ class VPNGeoBlockingTester {
         
         try {
             const response = await this.page.evaluate(async (apiUrl) => {
-                const resp = await fetch(`${apiUrl}/api/test-access`);
+                const resp = await fetch(`${apiUrl}/api/v1/test-access`);
                 const data = await resp.json();
                 return {
                     status: resp.status,
@@ -123,7 +123,7 @@ class VPNGeoBlockingTester {
         
         try {
             const response = await this.page.evaluate(async (apiUrl, countriesToBlock) => {
-                const resp = await fetch(`${apiUrl}/api/block-countries`, {
+                const resp = await fetch(`${apiUrl}/api/v1/block-countries`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({ countries: countriesToBlock })
@@ -145,7 +145,7 @@ class VPNGeoBlockingTester {
         
         try {
             const response = await this.page.evaluate(async (apiUrl, country) => {
-                const resp = await fetch(`${apiUrl}/api/simulate-vpn`, {
+                const resp = await fetch(`${apiUrl}/api/v1/simulate-vpn`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({ country_code: country })
@@ -7,7 +7,7 @@ Write-Host "================================" -ForegroundColor Cyan
 # Test 1: Check current location
 Write-Host "`n1️⃣  Checking current location..." -ForegroundColor Yellow
 try {
-    $location = Invoke-RestMethod "http://localhost:8080/api/ip-info" -TimeoutSec 10
+    $location = Invoke-RestMethod "http://localhost:8080/api/v1/ip-info" -TimeoutSec 10
     Write-Host "   📍 IP Address: $($location.ip)" -ForegroundColor Green
     Write-Host "   🌍 Country: $($location.country_name) ($($location.country_code))" -ForegroundColor Green
     Write-Host "   🏢 ISP: $($location.isp)" -ForegroundColor Green
@@ -21,7 +21,7 @@ try {
 # Test 2: Test API access
 Write-Host "`n2️⃣  Testing API access from $currentCountry..." -ForegroundColor Yellow
 try {
-    $access = Invoke-RestMethod "http://localhost:8080/api/test-access" -TimeoutSec 10
+    $access = Invoke-RestMethod "http://localhost:8080/api/v1/test-access" -TimeoutSec 10
     Write-Host "   ✅ ACCESS GRANTED" -ForegroundColor Green
     Write-Host "   📝 Message: $($access.message)" -ForegroundColor Green
     Write-Host "   🕒 Time: $($access.timestamp)" -ForegroundColor Green
@@ -49,7 +49,7 @@ foreach ($country in $testCountries) {
         $body = @{ country_code = $country } | ConvertTo-Json
         $headers = @{ "Content-Type" = "application/json" }
         
-        $response = Invoke-WebRequest -Uri "http://localhost:8080/api/simulate-vpn" -Method POST -Body $body -Headers $headers -TimeoutSec 10
+        $response = Invoke-WebRequest -Uri "http://localhost:8080/api/v1/simulate-vpn" -Method POST -Body $body -Headers $headers -TimeoutSec 10
         $simulation = $response.Content | ConvertFrom-Json
         
         if ($response.StatusCode -eq 200) {
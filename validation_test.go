@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"shopify-customers/geoblock"
+)
+
+// countingReputation counts the addresses it is asked to score
+type countingReputation struct{ calls atomic.Int32 }
+
+func (c *countingReputation) Name() string { return "counting" }
+
+func (c *countingReputation) Score(ctx context.Context, ip string) (int, error) {
+	c.calls.Add(1)
+	return 100, nil
+}
+
+func (c *countingReputation) Status() geoblock.ProviderStatus {
+	return geoblock.ProviderStatus{Provider: c.Name()}
+}
+
+func TestValidateCountriesSkipsReputation(t *testing.T) {
+	reputation := &countingReputation{}
+	saved := reputationProvider
+	reputationProvider = reputation
+	defer func() { reputationProvider = saved }()
+
+	store := geoblock.NewStore()
+	_, err := store.ReplacePolicy(&geoblock.Policy{
+		BlockedCountries: []string{"RU"},
+		Rules:            []geoblock.Rule{{ID: "abusive-de", Countries: []string{"DE"}, ReputationAbove: 50}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := validateCountries(store, []string{"DE", "FR", "RU"})
+	if calls := reputation.calls.Load(); calls != 0 {
+		t.Errorf("validation scored %d made-up addresses, want none", calls)
+	}
+	for i, want := range []bool{false, false, true} {
+		if results[i].Blocked != want {
+			t.Errorf("%s blocked = %v, want %v", results[i].Country, results[i].Blocked, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+// maxGeoAnomalies caps the anomalies remembered for /anomalies
+const maxGeoAnomalies = 500
+
+// GeoSighting is where and when an API key was seen
+type GeoSighting struct {
+	Country string `json:"country_code"`
+	IP      string `json:"ip"`
+	At      string `json:"at"`
+
+	at time.Time
+}
+
+// GeoAnomaly is an impossible travel: one API key seen from two countries
+// within the velocity window
+type GeoAnomaly struct {
+	ID          string      `json:"id"`
+	Principal   string      `json:"principal"`
+	From        GeoSighting `json:"from"`
+	To          GeoSighting `json:"to"`
+	Interval    string      `json:"interval"`
+	AutoBlocked bool        `json:"auto_blocked"`
+}
+
+// BlockedKey is an API key suspended after an anomaly
+type BlockedKey struct {
+	Principal string `json:"principal"`
+	AnomalyID string `json:"anomaly_id"`
+	BlockedAt string `json:"blocked_at"`
+}
+
+// GeoVelocityTracker remembers the last country each API key was seen from
+// and flags a different country within window. Without coordinates it
+// cannot tell neighbours apart, so any country change in the window counts.
+type GeoVelocityTracker struct {
+	window    time.Duration
+	autoBlock bool
+
+	mu        sync.Mutex
+	last      map[string]GeoSighting
+	anomalies []GeoAnomaly
+	blocked   map[string]BlockedKey
+}
+
+// NewGeoVelocityTracker creates a tracker; with autoBlock, keys are
+// suspended at their first anomaly
+func NewGeoVelocityTracker(window time.Duration, autoBlock bool) *GeoVelocityTracker {
+	return &GeoVelocityTracker{
+		window:    window,
+		autoBlock: autoBlock,
+		last:      make(map[string]GeoSighting),
+		blocked:   make(map[string]BlockedKey),
+	}
+}
+
+// Observe records a located request of an API key and returns the anomaly
+// it causes, if any. Requests without a key or a known country are ignored.
+func (t *GeoVelocityTracker) Observe(principal, country, ip string, at time.Time) *GeoAnomaly {
+	if principal == "" || country == "" || country == geoblock.UnknownCountry || country == geoblock.DisputedCountry {
+		return nil
+	}
+	sighting := GeoSighting{Country: country, IP: ip, At: at.UTC().Format(time.RFC3339), at: at}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, seen := t.last[principal]
+	t.last[principal] = sighting
+	if !seen || previous.Country == country || at.Sub(previous.at) > t.window {
+		return nil
+	}
+
+	anomaly := GeoAnomaly{
+		ID:        newRequestID(),
+		Principal: principal,
+		From:      previous,
+		To:        sighting,
+		Interval:  at.Sub(previous.at).Round(time.Second).String(),
+	}
+	if _, blocked := t.blocked[principal]; t.autoBlock && !blocked {
+		anomaly.AutoBlocked = true
+		t.blocked[principal] = BlockedKey{Principal: principal, AnomalyID: anomaly.ID, BlockedAt: sighting.At}
+	}
+	t.anomalies = append(t.anomalies, anomaly)
+	if len(t.anomalies) > maxGeoAnomalies {
+		t.anomalies = t.anomalies[len(t.anomalies)-maxGeoAnomalies:]
+	}
+	return &anomaly
+}
+
+// Blocked reports whether an API key is suspended
+func (t *GeoVelocityTracker) Blocked(principal string) bool {
+	if principal == "" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, blocked := t.blocked[principal]
+	return blocked
+}
+
+// Unblock lifts a suspension, reporting whether the key was suspended. The
+// key's last sighting is forgotten so its next request starts afresh.
+func (t *GeoVelocityTracker) Unblock(principal string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, blocked := t.blocked[principal]
+	delete(t.blocked, principal)
+	delete(t.last, principal)
+	return blocked
+}
+
+// Report returns the anomalies, newest first, and the suspended keys
+func (t *GeoVelocityTracker) Report() ([]GeoAnomaly, []BlockedKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	anomalies := make([]GeoAnomaly, 0, len(t.anomalies))
+	for i := len(t.anomalies) - 1; i >= 0; i-- {
+		anomalies = append(anomalies, t.anomalies[i])
+	}
+	blocked := make([]BlockedKey, 0, len(t.blocked))
+	for _, key := range t.blocked {
+		blocked = append(blocked, key)
+	}
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].Principal < blocked[j].Principal })
+	return anomalies, blocked
+}
+
+// geoVelocity watches API keys used on geo-blocked endpoints.
+// GEO_VELOCITY_WINDOW (default 30m) is how soon a second country counts as
+// impossible travel; GEO_VELOCITY_AUTO_BLOCK=true suspends the key.
+var geoVelocity = NewGeoVelocityTracker(
+	getEnvDuration("GEO_VELOCITY_WINDOW", 30*time.Minute),
+	getEnv("GEO_VELOCITY_AUTO_BLOCK", "false") == "true",
+)
+
+// observeGeoVelocity checks a blocking decision for impossible travel of its API key
+func observeGeoVelocity(r *http.Request, decision geoblock.Decision) {
+	anomaly := geoVelocity.Observe(requestPrincipalName(r), decision.Geo.Country, decision.Geo.ClientIP, time.Now())
+	if anomaly == nil {
+		return
+	}
+	fmt.Printf("🛫 IMPOSSIBLE TRAVEL: API key %s seen from %s (%s) and %s (%s) within %s\n",
+		anomaly.Principal, anomaly.From.Country, anomaly.From.IP, anomaly.To.Country, anomaly.To.IP, anomaly.Interval)
+	if anomaly.AutoBlocked {
+		fmt.Printf("⛔ Suspended API key %s after anomaly %s\n", anomaly.Principal, anomaly.ID)
+		recordSystemAudit("auto-block-api-key", anomaly)
+	}
+}
+
+// suspendedKeyMessage explains why a suspended API key is rejected
+const suspendedKeyMessage = "Forbidden: API key suspended after impossible travel; an admin can lift it at /api/v1/anomalies/blocked-keys/{name}"
+
+type GeoAnomaliesResponse struct {
+	Window      string       `json:"window"`
+	AutoBlock   bool         `json:"auto_block"`
+	Anomalies   []GeoAnomaly `json:"anomalies"`
+	BlockedKeys []BlockedKey `json:"blocked_keys"`
+	Total       int          `json:"total"`
+}
+
+// handleGeoAnomalies lists impossible travel anomalies and suspended API keys
+func handleGeoAnomalies(w http.ResponseWriter, r *http.Request) {
+	anomalies, blocked := geoVelocity.Report()
+	response := GeoAnomaliesResponse{
+		Window:      geoVelocity.window.String(),
+		AutoBlock:   geoVelocity.autoBlock,
+		Anomalies:   anomalies,
+		BlockedKeys: blocked,
+		Total:       len(anomalies),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleUnblockKey lifts the suspension of an API key
+func handleUnblockKey(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !geoVelocity.Unblock(name) {
+		writeError(w, r, fmt.Sprintf("API key %s is not suspended", name), http.StatusNotFound)
+		return
+	}
+	recordAudit(r, "unblock-api-key", map[string]string{"principal": name})
+	fmt.Printf("✅ Lifted suspension of API key %s\n", name)
+	w.WriteHeader(http.StatusNoContent)
+}
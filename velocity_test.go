@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"shopify-customers/geoblock"
+)
+
+func TestGeoVelocityTracker(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	type sighting struct {
+		principal, country string
+		after              time.Duration
+	}
+
+	tests := []struct {
+		name          string
+		autoBlock     bool
+		sightings     []sighting
+		wantAnomalies int
+		wantBlocked   bool
+	}{
+		{"same country", false, []sighting{{"shop", "US", 0}, {"shop", "US", time.Minute}}, 0, false},
+		{"impossible travel", false, []sighting{{"shop", "US", 0}, {"shop", "CN", 5 * time.Minute}}, 1, false},
+		{"slow travel", false, []sighting{{"shop", "US", 0}, {"shop", "CN", 2 * time.Hour}}, 0, false},
+		{"different keys", false, []sighting{{"shop", "US", 0}, {"dashboard", "CN", time.Minute}}, 0, false},
+		{"unknown country ignored", false, []sighting{{"shop", "US", 0}, {"shop", geoblock.UnknownCountry, time.Minute}, {"shop", "US", 2 * time.Minute}}, 0, false},
+		{"anonymous ignored", false, []sighting{{"", "US", 0}, {"", "CN", time.Minute}}, 0, false},
+		{"auto-blocked", true, []sighting{{"shop", "US", 0}, {"shop", "CN", time.Minute}, {"shop", "US", 2 * time.Minute}}, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewGeoVelocityTracker(30*time.Minute, tt.autoBlock)
+			for _, s := range tt.sightings {
+				tracker.Observe(s.principal, s.country, "203.0.113.7", start.Add(s.after))
+			}
+			anomalies, blocked := tracker.Report()
+			if len(anomalies) != tt.wantAnomalies {
+				t.Errorf("anomalies = %+v, want %d", anomalies, tt.wantAnomalies)
+			}
+			if tracker.Blocked("shop") != tt.wantBlocked || (len(blocked) == 1) != tt.wantBlocked {
+				t.Errorf("blocked = %v (%+v), want %v", tracker.Blocked("shop"), blocked, tt.wantBlocked)
+			}
+			if tt.wantBlocked && (!anomalies[len(anomalies)-1].AutoBlocked || anomalies[0].AutoBlocked) {
+				t.Errorf("only the first anomaly should suspend the key: %+v", anomalies)
+			}
+		})
+	}
+
+	tracker := NewGeoVelocityTracker(time.Hour, true)
+	tracker.Observe("shop", "US", "192.0.2.1", start)
+	tracker.Observe("shop", "CN", "203.0.113.7", start.Add(time.Minute))
+	if !tracker.Unblock("shop") || tracker.Blocked("shop") || tracker.Unblock("shop") {
+		t.Error("Unblock should lift the suspension once")
+	}
+	if tracker.Observe("shop", "DE", "198.51.100.1", start.Add(2*time.Minute)) != nil {
+		t.Error("the first sighting after unblocking should not be an anomaly")
+	}
+}